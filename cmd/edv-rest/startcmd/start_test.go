@@ -6,28 +6,147 @@ SPDX-License-Identifier: Apache-2.0
 package startcmd
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
 	"github.com/hyperledger/aries-framework-go/component/storageutil/mock"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/require"
 	"github.com/trustbloc/edge-core/pkg/log"
 
+	"github.com/trustbloc/edv/pkg/audit"
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/auth/zcapld"
+	"github.com/trustbloc/edv/pkg/bulkhead"
+	"github.com/trustbloc/edv/pkg/compression"
 	"github.com/trustbloc/edv/pkg/edvprovider"
+	"github.com/trustbloc/edv/pkg/faultinjection"
+	"github.com/trustbloc/edv/pkg/ratelimit"
+	adminoperation "github.com/trustbloc/edv/pkg/restapi/admin/operation"
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/operation"
 )
 
 type mockServer struct{}
 
-func (s *mockServer) ListenAndServe(host, certFile, keyFile string, handler http.Handler) error {
+func (s *mockServer) ListenAndServe(host, certFile, keyFile string, _ *tls.Config, handler http.Handler) error {
 	return nil
 }
 
+func (s *mockServer) RegisterOnShutdown(func(ctx context.Context) error) {}
+
+func (s *mockServer) Shutdown(context.Context) error {
+	return nil
+}
+
+// handlerCapturingServer keeps the handler and TLS config it's started with, so that requests can be sent to it,
+// along with the functions registered to be called when it's shut down.
+type handlerCapturingServer struct {
+	handler       http.Handler
+	tlsConfig     *tls.Config
+	shutdownHooks []func(ctx context.Context) error
+}
+
+func (s *handlerCapturingServer) ListenAndServe(host, certFile, keyFile string, serverTLSConfig *tls.Config,
+	handler http.Handler) error {
+	s.handler = handler
+	s.tlsConfig = serverTLSConfig
+
+	return nil
+}
+
+func (s *handlerCapturingServer) RegisterOnShutdown(hook func(ctx context.Context) error) {
+	s.shutdownHooks = append(s.shutdownHooks, hook)
+}
+
+func (s *handlerCapturingServer) Shutdown(context.Context) error {
+	return nil
+}
+
+// signalledServer is a server that runs until it's shut down, which is expected to happen once the process has been
+// sent the given signal.
+type signalledServer struct {
+	mockServer
+	signal      os.Signal
+	stopped     chan struct{}
+	shutdownCtx context.Context
+	shutdownErr error
+}
+
+func (s *signalledServer) ListenAndServe(string, string, string, *tls.Config, http.Handler) error {
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		return err
+	}
+
+	err = p.Signal(s.signal)
+	if err != nil {
+		return err
+	}
+
+	<-s.stopped
+
+	return nil
+}
+
+func (s *signalledServer) Shutdown(ctx context.Context) error {
+	s.shutdownCtx = ctx
+
+	close(s.stopped)
+
+	return s.shutdownErr
+}
+
+// failingServer fails to listen, and records whether it was shut down.
+type failingServer struct {
+	mockServer
+	shutDown bool
+}
+
+func (s *failingServer) ListenAndServe(string, string, string, *tls.Config, http.Handler) error {
+	return errors.New("address already in use")
+}
+
+func (s *failingServer) Shutdown(context.Context) error {
+	s.shutDown = true
+
+	return nil
+}
+
+// closeRecordingProvider is a storage provider that records whether it was closed.
+type closeRecordingProvider struct {
+	storage.Provider
+	closed bool
+}
+
+func (p *closeRecordingProvider) Close() error {
+	p.closed = true
+
+	return p.Provider.Close()
+}
+
 func TestStartCmdContents(t *testing.T) {
 	startCmd := GetStartCmd(&mockServer{})
 
@@ -74,6 +193,30 @@ func TestStartCmdWithMissingArg(t *testing.T) {
 			"EDV_LOCALKMS_SECRETS_DATABASE_URL (environment variable) have been set")
 	})
 
+	t.Run("test missing capability database url arg - couchdb", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem", "--" +
+			capabilityDatabaseTypeFlagName, "couchdb", "--" + authEnableFlagName, "true", "--" +
+			localKMSSecretsDatabaseTypeFlagName, "mem"}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, "Neither capability-database-url (command line flag) nor "+
+			"EDV_CAPABILITY_DATABASE_URL (environment variable) have been set.")
+	})
+	t.Run("test invalid capability database type", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem", "--" +
+			capabilityDatabaseTypeFlagName, "NotARealDatabaseType", "--" + capabilityDatabaseURLFlagName, "url",
+			"--" + authEnableFlagName, "true", "--" + localKMSSecretsDatabaseTypeFlagName, "mem"}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Equal(t, errInvalidDatabaseType, err)
+	})
+
 	t.Run("test auth enable wrong value", func(t *testing.T) {
 		startCmd := GetStartCmd(&mockServer{})
 
@@ -104,7 +247,9 @@ func TestStartCmdValidArgs(t *testing.T) {
 			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
 			"--" + authEnableFlagName, "true", "--" + localKMSSecretsDatabaseTypeFlagName, "mem",
 			"--" + extensionsFlagName, returnFullDocumentOnQueryExtensionName +
-				"," + readAllDocumentsExtensionName + "," + batchExtensionName, "--" + corsEnableFlagName, "true",
+				"," + readAllDocumentsExtensionName + "," + batchExtensionName + "," + notificationsExtensionName,
+			"--" + corsEnableFlagName, "true",
+			"--" + adminTokenFlagName, "adminToken",
 		}
 		startCmd.SetArgs(args)
 
@@ -114,6 +259,105 @@ func TestStartCmdValidArgs(t *testing.T) {
 	})
 }
 
+func TestStartCmdShutdownHooks(t *testing.T) {
+	srv := &handlerCapturingServer{}
+
+	startCmd := GetStartCmd(srv)
+
+	startCmd.SetArgs([]string{
+		"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+		"--" + extensionsFlagName, notificationsExtensionName,
+	})
+
+	require.NoError(t, startCmd.Execute())
+
+	// The notification service and then the provider are shut down.
+	require.Len(t, srv.shutdownHooks, 2)
+
+	for i := len(srv.shutdownHooks) - 1; i >= 0; i-- {
+		require.NoError(t, srv.shutdownHooks[i](context.Background()))
+	}
+}
+
+func TestStartCmdRollback(t *testing.T) {
+	t.Run("Started components are stopped if a later one fails to start", func(t *testing.T) {
+		database := &closeRecordingProvider{Provider: mem.NewProvider()}
+
+		edvprovider.RegisterBackend("rollbacktest", func(string, string) (storage.Provider, error) {
+			return database, nil
+		})
+
+		srv := &handlerCapturingServer{}
+
+		startCmd := GetStartCmd(srv)
+
+		startCmd.SetArgs([]string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "rollbacktest",
+			"--" + authEnableFlagName, "true", "--" + localKMSSecretsDatabaseTypeFlagName, "mem",
+			"--" + authPolicyURLFlagName, "opa:8181/v1/data/edv/allow",
+			"--" + extensionsFlagName, notificationsExtensionName,
+		})
+
+		require.EqualError(t, startCmd.Execute(),
+			`policy decision URL must be an absolute http or https URL: "opa:8181/v1/data/edv/allow"`)
+
+		require.True(t, database.closed)
+		require.Empty(t, srv.shutdownHooks)
+	})
+	t.Run("Server is shut down if it fails to listen", func(t *testing.T) {
+		srv := &failingServer{}
+
+		startCmd := GetStartCmd(srv)
+
+		startCmd.SetArgs([]string{"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem"})
+
+		require.EqualError(t, startCmd.Execute(), "address already in use")
+		require.True(t, srv.shutDown)
+	})
+}
+
+func TestStartCmdShutdownOnSignal(t *testing.T) {
+	t.Run("Server is shut down within the shutdown timeout", func(t *testing.T) {
+		srv := &signalledServer{signal: syscall.SIGTERM, stopped: make(chan struct{})}
+
+		startCmd := GetStartCmd(srv)
+
+		startCmd.SetArgs([]string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + shutdownTimeoutFlagName, "5",
+		})
+
+		start := time.Now()
+
+		require.NoError(t, startCmd.Execute())
+
+		deadline, ok := srv.shutdownCtx.Deadline()
+		require.True(t, ok)
+		require.WithinDuration(t, start.Add(5*time.Second), deadline, 5*time.Second)
+	})
+	t.Run("Fail to shut down gracefully", func(t *testing.T) {
+		srv := &signalledServer{
+			signal: os.Interrupt, stopped: make(chan struct{}), shutdownErr: context.DeadlineExceeded,
+		}
+
+		startCmd := GetStartCmd(srv)
+
+		startCmd.SetArgs([]string{"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem"})
+
+		require.EqualError(t, startCmd.Execute(), "failed to shut down gracefully: context deadline exceeded")
+	})
+	t.Run("Invalid shutdown timeout", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		startCmd.SetArgs([]string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + shutdownTimeoutFlagName, "soon",
+		})
+
+		require.Contains(t, startCmd.Execute().Error(), "failed to parse shutdown-timeout soon")
+	})
+}
+
 func TestStartCmdLogLevels(t *testing.T) {
 	t.Run(`Log level not specified - default to "info"`, func(t *testing.T) {
 		startCmd := GetStartCmd(&mockServer{})
@@ -249,7 +493,7 @@ func TestKeyManager(t *testing.T) {
 	t.Run("Error - invalid database type", func(t *testing.T) {
 		parameters := edvParameters{localKMSSecretsStorage: &storageParameters{storageType: "NotARealDatabaseType"}}
 
-		provider, err := createKeyManager(&parameters)
+		provider, _, err := createKeyManager(&parameters)
 		require.Nil(t, provider)
 		require.Equal(t, errInvalidDatabaseType, err)
 	})
@@ -260,10 +504,11 @@ func TestKeyManager(t *testing.T) {
 			storageURL:  "%",
 		}, databaseTimeout: 1}
 
-		provider, err := createKeyManager(&parameters)
+		provider, _, err := createKeyManager(&parameters)
 		require.Error(t, err)
 		require.Nil(t, provider)
-		require.Contains(t, err.Error(), "failed to connect to couchdb: failed to ping couchDB")
+		require.Contains(t, err.Error(), "failed to connect to couchdb: "+
+			"failed to create new CouchDB storage provider: failed to ping couchDB")
 	})
 }
 
@@ -271,21 +516,21 @@ func TestCreateProvider(t *testing.T) {
 	t.Run("Successfully create memory storage provider", func(t *testing.T) {
 		parameters := edvParameters{databaseType: databaseTypeMemOption}
 
-		provider, err := createEDVProvider(&parameters)
+		provider, err := createEDVProvider(&parameters, nil, &mockServer{})
 		require.NoError(t, err)
 		require.NotNil(t, provider)
 	})
 	t.Run("Error - invalid database type", func(t *testing.T) {
 		parameters := edvParameters{databaseType: "NotARealDatabaseType"}
 
-		provider, err := createEDVProvider(&parameters)
+		provider, err := createEDVProvider(&parameters, nil, &mockServer{})
 		require.Nil(t, provider)
 		require.Equal(t, errInvalidDatabaseType, err)
 	})
 	t.Run("Error - CouchDB url is blank", func(t *testing.T) {
 		parameters := edvParameters{databaseType: databaseTypeCouchDBOption, databaseURL: "", databaseTimeout: 1}
 
-		provider, err := createEDVProvider(&parameters)
+		provider, err := createEDVProvider(&parameters, nil, &mockServer{})
 		require.Nil(t, provider)
 		require.EqualError(t, err, "failed to connect to couchdb: "+
 			"failed to create new CouchDB storage provider: failed to ping couchDB: url can't be blank")
@@ -293,12 +538,28 @@ func TestCreateProvider(t *testing.T) {
 	t.Run("Error - CouchDB url is invalid", func(t *testing.T) {
 		parameters := edvParameters{databaseType: databaseTypeCouchDBOption, databaseURL: "%", databaseTimeout: 1}
 
-		provider, err := createEDVProvider(&parameters)
+		provider, err := createEDVProvider(&parameters, nil, &mockServer{})
 		require.Nil(t, provider)
 		require.EqualError(t, err, "failed to connect to couchdb: "+
 			"failed to create new CouchDB storage provider: "+
 			`failed to ping couchDB: parse "http://%": invalid URL escape "%"`)
 	})
+	t.Run("Error - PostgreSQL url is invalid", func(t *testing.T) {
+		parameters := edvParameters{databaseType: databaseTypePostgresOption, databaseURL: "%", databaseTimeout: 1}
+
+		provider, err := createEDVProvider(&parameters, nil, &mockServer{})
+		require.Nil(t, provider)
+		require.Contains(t, err.Error(), "failed to connect to postgres: "+
+			"failed to create new PostgreSQL storage provider")
+	})
+	t.Run("All built-in storage backends are registered", func(t *testing.T) {
+		_, err := createEDVProvider(&edvParameters{databaseType: databaseTypeMemOption}, nil, &mockServer{})
+		require.NoError(t, err)
+
+		require.Subset(t, edvprovider.Backends(), []string{
+			databaseTypeCouchDBOption, databaseTypeMemOption, databaseTypeMongoDBOption, databaseTypePostgresOption,
+		})
+	})
 }
 
 func TestHttpHandler_ServeHTTP(t *testing.T) {
@@ -315,7 +576,22 @@ func TestHttpHandler_ServeHTTP(t *testing.T) {
 			require.Equal(t, r.RequestURI, createVaultPath)
 		}}
 		h := httpHandler{routerHandler: m, authSvc: &mockAuthService{}}
-		h.ServeHTTP(&httptest.ResponseRecorder{}, &http.Request{RequestURI: createVaultPath})
+		h.ServeHTTP(&httptest.ResponseRecorder{}, httptest.NewRequest(http.MethodGet, createVaultPath, nil))
+	})
+
+	t.Run("test import vault request", func(t *testing.T) {
+		m := &mockHTTPHandler{serveHTTPFun: func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, r.RequestURI, importVaultPath)
+		}}
+		h := httpHandler{routerHandler: m, authSvc: &mockAuthService{
+			handlerFunc: func(resourceID string, req *http.Request, w http.ResponseWriter,
+				next http.HandlerFunc) (http.HandlerFunc, error) {
+				require.FailNow(t, "import requests must not be authorized with a zcap")
+
+				return nil, nil
+			},
+		}}
+		h.ServeHTTP(&httptest.ResponseRecorder{}, httptest.NewRequest(http.MethodGet, importVaultPath, nil))
 	})
 
 	t.Run("test health check request", func(t *testing.T) {
@@ -323,7 +599,24 @@ func TestHttpHandler_ServeHTTP(t *testing.T) {
 			require.Equal(t, r.RequestURI, healthCheckPath)
 		}}
 		h := httpHandler{routerHandler: m, authSvc: &mockAuthService{}}
-		h.ServeHTTP(&httptest.ResponseRecorder{}, &http.Request{RequestURI: healthCheckPath})
+		h.ServeHTTP(&httptest.ResponseRecorder{}, httptest.NewRequest(http.MethodGet, healthCheckPath, nil))
+	})
+
+	t.Run("test admin request", func(t *testing.T) {
+		adminPath := adminoperation.PathPrefix + "/capabilities"
+
+		m := &mockHTTPHandler{serveHTTPFun: func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, r.RequestURI, adminPath)
+		}}
+		h := httpHandler{routerHandler: m, authSvc: &mockAuthService{
+			handlerFunc: func(resourceID string, req *http.Request, w http.ResponseWriter,
+				next http.HandlerFunc) (http.HandlerFunc, error) {
+				require.FailNow(t, "admin requests must not be authorized with a zcap")
+
+				return nil, nil
+			},
+		}}
+		h.ServeHTTP(&httptest.ResponseRecorder{}, httptest.NewRequest(http.MethodGet, adminPath, nil))
 	})
 
 	t.Run("test error from auth handler", func(t *testing.T) {
@@ -335,9 +628,25 @@ func TestHttpHandler_ServeHTTP(t *testing.T) {
 		}}
 
 		responseRecorder := httptest.NewRecorder()
-		h.ServeHTTP(responseRecorder, &http.Request{RequestURI: createVaultPath + "/vaultID"})
+		h.ServeHTTP(responseRecorder, httptest.NewRequest(http.MethodGet, createVaultPath+"/vaultID", nil))
 
 		require.Contains(t, responseRecorder.Body.String(), "failed to create auth handler")
+		require.Equal(t, http.StatusInternalServerError, responseRecorder.Code)
+	})
+
+	t.Run("test root capability not found", func(t *testing.T) {
+		h := httpHandler{authSvc: &mockAuthService{
+			handlerFunc: func(resourceID string, req *http.Request, w http.ResponseWriter,
+				next http.HandlerFunc) (http.HandlerFunc, error) {
+				return nil, fmt.Errorf("failed to get root capability: %w", zcapld.ErrCapabilityNotFound)
+			},
+		}}
+
+		responseRecorder := httptest.NewRecorder()
+		h.ServeHTTP(responseRecorder, httptest.NewRequest(http.MethodGet, createVaultPath+"/vaultID", nil))
+
+		require.Equal(t, http.StatusForbidden, responseRecorder.Code)
+		require.Contains(t, responseRecorder.Body.String(), zcapld.ErrorCodeCapabilityNotFound)
 	})
 
 	t.Run("test auth handler success", func(t *testing.T) {
@@ -351,7 +660,47 @@ func TestHttpHandler_ServeHTTP(t *testing.T) {
 		}}
 
 		responseRecorder := httptest.NewRecorder()
-		h.ServeHTTP(responseRecorder, &http.Request{RequestURI: createVaultPath + "/vaultID"})
+		h.ServeHTTP(responseRecorder, httptest.NewRequest(http.MethodGet, createVaultPath+"/vaultID", nil))
+	})
+
+	t.Run("test query string doesn't change the exemptions", func(t *testing.T) {
+		var served bool
+
+		m := &mockHTTPHandler{serveHTTPFun: func(w http.ResponseWriter, r *http.Request) {
+			served = true
+		}}
+		h := httpHandler{routerHandler: m, authSvc: &mockAuthService{
+			handlerFunc: func(resourceID string, req *http.Request, w http.ResponseWriter,
+				next http.HandlerFunc) (http.HandlerFunc, error) {
+				require.FailNow(t, "exempt requests must not be authorized with a zcap")
+
+				return nil, nil
+			},
+		}}
+
+		for _, path := range []string{createVaultPath, importVaultPath, healthCheckPath, readyPath, versionPath} {
+			served = false
+
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path+"?a=b/c/d", nil))
+			require.True(t, served, path)
+		}
+	})
+
+	t.Run("test query string isn't part of the vault ID", func(t *testing.T) {
+		var authorizedResourceID string
+
+		h := httpHandler{routerHandler: &mockHTTPHandler{}, authSvc: &mockAuthService{
+			handlerFunc: func(resourceID string, req *http.Request, w http.ResponseWriter,
+				next http.HandlerFunc) (http.HandlerFunc, error) {
+				authorizedResourceID = resourceID
+
+				return next, nil
+			},
+		}}
+
+		h.ServeHTTP(httptest.NewRecorder(),
+			httptest.NewRequest(http.MethodGet, createVaultPath+"/vaultID?a=b", nil))
+		require.Equal(t, "vaultID", authorizedResourceID)
 	})
 }
 
@@ -374,6 +723,18 @@ func (m *mockAuthService) Create(resourceID, verificationMethod string) ([]byte,
 	return nil, nil
 }
 
+func (m *mockAuthService) DeleteCapabilities(resourceID string) error {
+	return nil
+}
+
+func (m *mockAuthService) Delegate(resourceID string, delegation *zcapld.Delegation) ([]byte, error) {
+	return nil, nil
+}
+
+func (m *mockAuthService) Revoke(resourceID, capabilityID, revokerID string) error {
+	return nil
+}
+
 func (m *mockAuthService) Handler(resourceID string, req *http.Request, w http.ResponseWriter,
 	next http.HandlerFunc) (http.HandlerFunc, error) {
 	if m.handlerFunc != nil {
@@ -385,11 +746,74 @@ func (m *mockAuthService) Handler(resourceID string, req *http.Request, w http.R
 
 func TestListenAndServe(t *testing.T) {
 	h := HTTPServer{}
-	err := h.ListenAndServe("localhost:8080", "test.key", "test.cert", nil)
+	err := h.ListenAndServe("localhost:8080", "test.key", "test.cert", nil, nil)
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "open test.key: no such file or directory")
 }
 
+func TestHTTPServer_Shutdown(t *testing.T) {
+	t.Run("Server stops and hooks are called in reverse order", func(t *testing.T) {
+		h := &HTTPServer{}
+
+		var calls []string
+
+		h.RegisterOnShutdown(func(context.Context) error {
+			calls = append(calls, "first")
+
+			return errors.New("first hook error")
+		})
+		h.RegisterOnShutdown(func(context.Context) error {
+			calls = append(calls, "second")
+
+			return errors.New("second hook error")
+		})
+
+		served := make(chan error)
+
+		go func() {
+			served <- h.ListenAndServe("127.0.0.1:0", "", "", nil, http.NotFoundHandler())
+		}()
+
+		require.EqualError(t, h.Shutdown(context.Background()), "second hook error")
+		require.NoError(t, <-served)
+		require.Equal(t, []string{"second", "first"}, calls)
+	})
+	t.Run("Server that hasn't been started", func(t *testing.T) {
+		require.NoError(t, (&HTTPServer{}).Shutdown(context.Background()))
+	})
+}
+
+func TestCreatePolicyEnforcer(t *testing.T) {
+	t.Run("Invalid policy URL", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		startCmd.SetArgs([]string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + authEnableFlagName, "true", "--" + localKMSSecretsDatabaseTypeFlagName, "mem",
+			"--" + authPolicyURLFlagName, "opa:8181/v1/data/edv/allow",
+		})
+
+		require.EqualError(t, startCmd.Execute(),
+			`policy decision URL must be an absolute http or https URL: "opa:8181/v1/data/edv/allow"`)
+	})
+	t.Run("Multi-tenant mode", func(t *testing.T) {
+		enforcer, err := createPolicyEnforcer("http://localhost:8181/v1/data/edv/allow",
+			edvprovider.NewProvider(mem.NewProvider(), 100, edvprovider.WithMultiTenancy()))
+		require.NoError(t, err)
+		require.NotNil(t, enforcer)
+	})
+}
+
+func TestCloseOnShutdown(t *testing.T) {
+	srv := &handlerCapturingServer{}
+
+	closeOnShutdown(srv, "test database", &mock.Provider{ErrClose: errors.New("close error")})
+
+	require.Len(t, srv.shutdownHooks, 1)
+	require.EqualError(t, srv.shutdownHooks[0](context.Background()),
+		"failed to close test database: close error")
+}
+
 func TestCreateConfigStore(t *testing.T) {
 	t.Run("Success - mem", func(t *testing.T) {
 		provider := edvprovider.NewProvider(mem.NewProvider(), 100)
@@ -422,6 +846,1657 @@ func TestGetTimeout(t *testing.T) {
 	})
 }
 
+func TestGetBatchLimits(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + extensionsFlagName, batchExtensionName,
+			"--" + batchMaxOperationsFlagName, "100", "--" + batchMaxBytesFlagName, "1000000",
+			"--" + batchMaxConcurrentFlagName, "5",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+
+		batchLimits, err := getBatchLimits(startCmd)
+		require.NoError(t, err)
+		require.Equal(t, uint(100), batchLimits.MaxOperations)
+		require.Equal(t, uint64(1000000), batchLimits.MaxBytes)
+		require.Equal(t, uint(5), batchLimits.MaxConcurrentBatches)
+	})
+	t.Run("failure - invalid batch max operations", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + batchMaxOperationsFlagName, "-1",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `failed to parse batch-max-operations -1 into an unsigned integer: `+
+			`strconv.ParseUint: parsing "-1": invalid syntax`)
+	})
+	t.Run("failure - invalid batch max bytes", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + batchMaxBytesFlagName, "NotAnInt",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to parse batch-max-bytes NotAnInt into an unsigned integer")
+	})
+	t.Run("failure - invalid batch max concurrent", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + batchMaxConcurrentFlagName, "NotAnInt",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to parse batch-max-concurrent NotAnInt into an unsigned integer")
+	})
+}
+
+func TestGetRateLimits(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		srv := &handlerCapturingServer{}
+		startCmd := GetStartCmd(srv)
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + rateLimitClientRateFlagName, "1", "--" + rateLimitClientBurstFlagName, "2",
+			"--" + rateLimitVaultWriteRateFlagName, "5", "--" + metricsEnableFlagName, "true",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+
+		rateLimits, err := getRateLimits(startCmd)
+		require.NoError(t, err)
+		require.Equal(t, ratelimit.Limits{ClientRate: 1, ClientBurst: 2, VaultWriteRate: 5}, rateLimits)
+
+		for _, code := range []int{http.StatusNotFound, http.StatusNotFound, http.StatusTooManyRequests} {
+			rw := httptest.NewRecorder()
+
+			srv.handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet,
+				"/encrypted-data-vaults/Sr7yHjomhn1aeaFnxREfRN/documents/VJYHHJx4C8J9Fsgz7rZqSp", nil))
+			require.Equal(t, code, rw.Code)
+		}
+
+		rw := httptest.NewRecorder()
+
+		srv.handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.Contains(t, rw.Body.String(), `edv_rate_limited_total{limit="client"} 1`)
+	})
+	t.Run("failure - invalid client rate", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + rateLimitClientRateFlagName, "-1",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `failed to parse rate-limit-client-rate -1 into an unsigned integer: `+
+			`strconv.ParseUint: parsing "-1": invalid syntax`)
+	})
+	t.Run("failure - invalid vault write burst", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + rateLimitVaultWriteBurstFlagName, "NotAnInt",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(),
+			"failed to parse rate-limit-vault-write-burst NotAnInt into an unsigned integer")
+	})
+}
+
+func TestCORS(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		srv := &handlerCapturingServer{}
+		startCmd := GetStartCmd(srv)
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + corsEnableFlagName, "true", "--" + corsAllowedOriginsFlagName, "https://wallet.example.com",
+			"--" + corsAllowedMethodsFlagName, "GET, POST", "--" + corsAllowedHeadersFlagName, "Content-Type",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+
+		for _, tc := range []struct {
+			origin  string
+			method  string
+			allowed bool
+		}{
+			{origin: "https://wallet.example.com", method: http.MethodPost, allowed: true},
+			{origin: "https://wallet.example.com", method: http.MethodDelete},
+			{origin: "https://attacker.example.com", method: http.MethodPost},
+		} {
+			req := httptest.NewRequest(http.MethodOptions, "/encrypted-data-vaults", nil)
+			req.Header.Set("Origin", tc.origin)
+			req.Header.Set("Access-Control-Request-Method", tc.method)
+			req.Header.Set("Access-Control-Request-Headers", "Content-Type")
+
+			rw := httptest.NewRecorder()
+			srv.handler.ServeHTTP(rw, req)
+
+			if tc.allowed {
+				require.Equal(t, tc.origin, rw.Header().Get("Access-Control-Allow-Origin"))
+			} else {
+				require.Empty(t, rw.Header().Get("Access-Control-Allow-Origin"), "%s %s", tc.origin, tc.method)
+			}
+		}
+	})
+	t.Run("defaults", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		startCmd.SetArgs([]string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + corsEnableFlagName, "true",
+		})
+		require.NoError(t, startCmd.Execute())
+
+		corsParams, err := getCORSParameters(startCmd)
+		require.NoError(t, err)
+		require.Equal(t, []string{"*"}, corsParams.allowedOrigins)
+		require.Contains(t, corsParams.allowedMethods, http.MethodPatch)
+		require.Equal(t, []string{"*"}, corsParams.allowedHeaders)
+	})
+	t.Run("allowed origins only apply if CORS is enabled", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		startCmd.SetArgs([]string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + corsAllowedOriginsFlagName, "https://wallet.example.com",
+		})
+		require.NoError(t, startCmd.Execute())
+
+		corsParams, err := getCORSParameters(startCmd)
+		require.NoError(t, err)
+		require.Nil(t, corsParams)
+	})
+}
+
+func TestTLSClientAuth(t *testing.T) {
+	clientCACertFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, ioutil.WriteFile(clientCACertFile, newTestCACertPEM(t), 0o600))
+
+	tlsArgs := []string{
+		"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+		"--" + tlsCertFileFlagName, "cert.pem", "--" + tlsKeyFileFlagName, "key.pem",
+	}
+
+	t.Run("success", func(t *testing.T) {
+		srv := &handlerCapturingServer{}
+		startCmd := GetStartCmd(srv)
+
+		startCmd.SetArgs(append(tlsArgs, "--"+tlsClientCACertsFlagName, clientCACertFile))
+		require.NoError(t, startCmd.Execute())
+		require.NotNil(t, srv.tlsConfig.ClientCAs)
+		require.Equal(t, tls.RequireAndVerifyClientCert, srv.tlsConfig.ClientAuth)
+	})
+	t.Run("success - verify if given, with client certificate binding", func(t *testing.T) {
+		srv := &handlerCapturingServer{}
+		startCmd := GetStartCmd(srv)
+
+		startCmd.SetArgs(append(tlsArgs, "--"+tlsClientCACertsFlagName, clientCACertFile,
+			"--"+tlsClientAuthFlagName, tlsClientAuthVerifyIfGiven, "--"+tlsClientCertBindingEnableFlagName, "true"))
+		require.NoError(t, startCmd.Execute())
+		require.Equal(t, tls.VerifyClientCertIfGiven, srv.tlsConfig.ClientAuth)
+
+		config, err := getTLS(startCmd)
+		require.NoError(t, err)
+		require.True(t, config.clientCertBinding)
+	})
+	t.Run("mutual TLS isn't enabled by default", func(t *testing.T) {
+		srv := &handlerCapturingServer{}
+		startCmd := GetStartCmd(srv)
+
+		startCmd.SetArgs(tlsArgs)
+		require.NoError(t, startCmd.Execute())
+		require.Nil(t, srv.tlsConfig)
+	})
+	t.Run("failure - client CA certs without a server certificate", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		startCmd.SetArgs([]string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + tlsClientCACertsFlagName, clientCACertFile,
+		})
+		require.EqualError(t, startCmd.Execute(), "tls-client-cacerts can only be set if tls-cert-file and "+
+			"tls-key-file are set")
+	})
+	t.Run("failure - invalid client auth", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		startCmd.SetArgs(append(tlsArgs, "--"+tlsClientCACertsFlagName, clientCACertFile,
+			"--"+tlsClientAuthFlagName, "request"))
+		require.EqualError(t, startCmd.Execute(),
+			`invalid TLS client auth "request": must be one of require, verify-if-given`)
+	})
+	t.Run("failure - client certificate binding without client CA certs", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		startCmd.SetArgs(append(tlsArgs, "--"+tlsClientCertBindingEnableFlagName, "true"))
+		require.EqualError(t, startCmd.Execute(), "tls-client-cert-binding-enable can only be enabled if "+
+			"tls-client-cacerts is set")
+	})
+	t.Run("failure - client CA cert file doesn't exist", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		startCmd.SetArgs(append(tlsArgs, "--"+tlsClientCACertsFlagName, "missing.pem"))
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to load TLS client CA certs")
+	})
+}
+
+// newTestCACertPEM returns a self-signed CA certificate in PEM format.
+func newTestCACertPEM(t *testing.T) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "EDV test client CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+}
+
+func TestGetBulkheadLimits(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		srv := &handlerCapturingServer{}
+		startCmd := GetStartCmd(srv)
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + maxConcurrentQueriesFlagName, "10", "--" + maxConcurrentReadsFlagName, "100",
+			"--" + maxConcurrentWritesFlagName, "50", "--" + metricsEnableFlagName, "true",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+
+		bulkheadLimits, err := getBulkheadLimits(startCmd)
+		require.NoError(t, err)
+		require.Equal(t, bulkhead.Limits{MaxQueries: 10, MaxReads: 100, MaxWrites: 50}, bulkheadLimits)
+
+		rw := httptest.NewRecorder()
+
+		srv.handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.Contains(t, rw.Body.String(), `edv_bulkhead_capacity{pool="query"} 10`)
+	})
+	t.Run("failure - invalid max concurrent queries", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + maxConcurrentQueriesFlagName, "-1",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `failed to parse max-concurrent-queries -1 into an unsigned integer: `+
+			`strconv.ParseUint: parsing "-1": invalid syntax`)
+	})
+	t.Run("failure - invalid max concurrent reads", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + maxConcurrentReadsFlagName, "NotAnInt",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to parse max-concurrent-reads NotAnInt into an unsigned integer")
+	})
+	t.Run("failure - invalid max concurrent writes", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + maxConcurrentWritesFlagName, "NotAnInt",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to parse max-concurrent-writes NotAnInt into an unsigned integer")
+	})
+}
+
+func TestCompression(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		srv := &handlerCapturingServer{}
+		startCmd := GetStartCmd(srv)
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + compressionFlagName, "gzip, ZSTD", "--" + maxDocumentSizeFlagName, "1048576",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+
+		encodings, err := getCompressionEncodings(startCmd)
+		require.NoError(t, err)
+		require.Equal(t, []string{compression.Gzip, compression.Zstd}, encodings)
+
+		req := httptest.NewRequest(http.MethodGet, versionPath, nil)
+		req.Header.Set("Accept-Encoding", "zstd")
+
+		rw := httptest.NewRecorder()
+
+		srv.handler.ServeHTTP(rw, req)
+		require.Equal(t, http.StatusOK, rw.Code)
+		require.Equal(t, compression.Zstd, rw.Header().Get("Content-Encoding"))
+
+		maxDecompressedSize, err := getMaxDecompressedSize(startCmd)
+		require.NoError(t, err)
+		require.Equal(t, uint64(compression.DefaultMaxDecompressedSize), maxDecompressedSize)
+	})
+	t.Run("success - max decompressed size", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + compressionFlagName, "gzip", "--" + compressionMaxDecompressedSizeFlagName, "0",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+
+		maxDecompressedSize, err := getMaxDecompressedSize(startCmd)
+		require.NoError(t, err)
+		require.Zero(t, maxDecompressedSize)
+	})
+	t.Run("failure - invalid max decompressed size", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + compressionMaxDecompressedSizeFlagName, "NotAnInt",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(),
+			"failed to parse compression-max-decompressed-size NotAnInt into an unsigned integer")
+	})
+	t.Run("failure - invalid encoding", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + compressionFlagName, "gzip,br",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `invalid compression "br", must be gzip or zstd`)
+	})
+	t.Run("failure - invalid max document size", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + maxDocumentSizeFlagName, "NotAnInt",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to parse max-document-size NotAnInt into an unsigned integer")
+	})
+}
+
+func TestQueryLatencyBudget(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + queryLatencyBudgetFlagName, "500",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+	t.Run("failure - invalid query latency budget", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + queryLatencyBudgetFlagName, "1s",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `failed to parse query-latency-budget 1s into an unsigned integer: `+
+			`strconv.ParseUint: parsing "1s": invalid syntax`)
+	})
+}
+
+func TestTombstoneRetention(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + tombstoneRetentionFlagName, "86400",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+	t.Run("failure - invalid tombstone retention", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + tombstoneRetentionFlagName, "1d",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `failed to parse tombstone-retention 1d into an unsigned integer: `+
+			`strconv.ParseUint: parsing "1d": invalid syntax`)
+	})
+}
+
+func TestConsistencyCheckInterval(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + consistencyCheckIntervalFlagName, "3600",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+	t.Run("failure - invalid consistency check interval", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + consistencyCheckIntervalFlagName, "1h",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `failed to parse consistency-check-interval 1h into an unsigned integer: `+
+			`strconv.ParseUint: parsing "1h": invalid syntax`)
+	})
+}
+
+func TestAsyncIndexingWorkers(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + asyncIndexingWorkersFlagName, "4",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+	t.Run("failure - invalid number of async indexing workers", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + asyncIndexingWorkersFlagName, "all",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `failed to parse async-indexing-workers all into an unsigned integer: `+
+			`strconv.ParseUint: parsing "all": invalid syntax`)
+	})
+}
+
+func TestDatabaseBatchRetries(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + databaseBatchRetriesFlagName, "3",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+	t.Run("failure - invalid database batch retries", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + databaseBatchRetriesFlagName, "-1",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `failed to parse database-batch-retries -1 into an unsigned integer: `+
+			`strconv.ParseUint: parsing "-1": invalid syntax`)
+	})
+}
+
+func TestDocumentIDPolicy(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + documentIDPolicyFlagName, "did-url",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+	t.Run("failure - invalid document ID policy", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + documentIDPolicyFlagName, "ulid",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `invalid document ID policy "ulid": must be one of base58-128, uuid, did-url`)
+	})
+}
+
+func TestMappingDocumentCodec(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + mappingDocumentCodecFlagName, "cbor",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+	t.Run("failure - invalid mapping document codec", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + mappingDocumentCodecFlagName, "msgpack",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `invalid mapping document codec "msgpack": must be one of json, cbor`)
+	})
+}
+
+func TestStorageRetry(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + databaseReadRetriesFlagName, "3", "--" + databaseWriteRetriesFlagName, "1",
+			"--" + databaseRetryBackoffFlagName, "50",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+
+		retry, err := getStorageRetry(startCmd)
+		require.NoError(t, err)
+		require.Equal(t, &edvprovider.StorageRetry{
+			Read: edvprovider.StorageRetryPolicy{
+				MaxRetries: 3, Backoff: 50 * time.Millisecond, MaxBackoff: 5 * time.Second, Jitter: storageRetryJitter,
+			},
+			Write: edvprovider.StorageRetryPolicy{
+				MaxRetries: 1, Backoff: 50 * time.Millisecond, MaxBackoff: 5 * time.Second, Jitter: storageRetryJitter,
+			},
+		}, retry)
+	})
+	t.Run("failure - invalid database retry backoff", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + databaseReadRetriesFlagName, "3", "--" + databaseRetryMaxBackoffFlagName, "1s",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `failed to parse database-retry-max-backoff 1s into an unsigned integer: `+
+			`strconv.ParseUint: parsing "1s": invalid syntax`)
+	})
+}
+
+func TestMaxMappingDocuments(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + maxMappingDocumentsFlagName, "50",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+	t.Run("failure - invalid max mapping documents", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + maxMappingDocumentsFlagName, "many",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `failed to parse max-mapping-documents many into an unsigned integer: `+
+			`strconv.ParseUint: parsing "many": invalid syntax`)
+	})
+}
+
+func TestMaxVaultsPerController(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + maxVaultsPerControllerFlagName, "10",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+	t.Run("failure - invalid max vaults per controller", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + maxVaultsPerControllerFlagName, "-1",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `failed to parse max-vaults-per-controller -1 into an unsigned integer: `+
+			`strconv.ParseUint: parsing "-1": invalid syntax`)
+	})
+}
+
+func TestAttributeCacheSize(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + attributeCacheSizeFlagName, "1000",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+	t.Run("failure - invalid attribute cache size", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + attributeCacheSizeFlagName, "-5",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `failed to parse attribute-cache-size -5 into an unsigned integer: `+
+			`strconv.ParseUint: parsing "-5": invalid syntax`)
+	})
+}
+
+func TestIndexCorruptionAlerts(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + readRepairEnableFlagName, "true",
+			"--" + indexCorruptionAlertThresholdFlagName, "10",
+			"--" + indexCorruptionAlertURLFlagName, "https://example.com/alerts",
+			"--" + indexCorruptionAlertSecretFlagName, "secret",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+	t.Run("failure - invalid threshold", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + indexCorruptionAlertThresholdFlagName, "many",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `failed to parse index-corruption-alert-threshold many into an unsigned `+
+			`integer: strconv.ParseUint: parsing "many": invalid syntax`)
+	})
+	t.Run("failure - invalid URL", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + indexCorruptionAlertThresholdFlagName, "0",
+			"--" + indexCorruptionAlertURLFlagName, "ftp://example.com/alerts",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `invalid index-corruption-alert-url: webhook URL must be an absolute http or https URL: `+
+			`"ftp://example.com/alerts"`)
+	})
+	t.Run("private URL is only allowed if private addresses are", func(t *testing.T) {
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + indexCorruptionAlertThresholdFlagName, "0",
+			"--" + indexCorruptionAlertURLFlagName, "http://localhost:9090/alerts",
+		}
+
+		startCmd := GetStartCmd(&mockServer{})
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `invalid index-corruption-alert-url: webhook URL must not be on a loopback, `+
+			`private or link-local address: "http://localhost:9090/alerts"`)
+
+		startCmd = GetStartCmd(&mockServer{})
+		startCmd.SetArgs(append(args, "--"+webhookAllowPrivateAddressesFlagName, "true"))
+
+		require.NoError(t, startCmd.Execute())
+	})
+}
+
+func TestReadRepairEnable(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + readRepairEnableFlagName, "true",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+	t.Run("failure - invalid read-repair enable value", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + readRepairEnableFlagName, "sometimes",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `strconv.ParseBool: parsing "sometimes": invalid syntax`)
+	})
+}
+
+func TestEncryptionAtRestEnable(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + encryptionAtRestEnableFlagName, "true", "--" + localKMSSecretsDatabaseTypeFlagName, "mem",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+	t.Run("failure - local KMS secrets database not set", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + encryptionAtRestEnableFlagName, "true",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "Neither localkms-secrets-database-type (command line flag) nor "+
+			"EDV_LOCALKMS_SECRETS_DATABASE_TYPE (environment variable) have been set")
+	})
+	t.Run("failure - invalid encryption at rest enable value", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + encryptionAtRestEnableFlagName, "sometimes",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `strconv.ParseBool: parsing "sometimes": invalid syntax`)
+	})
+}
+
+func TestWebhookAllowPrivateAddresses(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + extensionsFlagName, "Notifications", "--" + webhookAllowPrivateAddressesFlagName, "true",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+	t.Run("failure - invalid value", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + webhookAllowPrivateAddressesFlagName, "sometimes",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `strconv.ParseBool: parsing "sometimes": invalid syntax`)
+	})
+}
+
+func TestOutboxEnable(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + extensionsFlagName, "Notifications", "--" + outboxEnableFlagName, "true",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+	t.Run("failure - invalid outbox enable value", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + outboxEnableFlagName, "sometimes",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `strconv.ParseBool: parsing "sometimes": invalid syntax`)
+	})
+	t.Run("outbox only applies with notifications", func(t *testing.T) {
+		provider, err := createEDVProvider(&edvParameters{databaseType: databaseTypeMemOption, outboxEnable: true}, nil,
+			&mockServer{})
+		require.NoError(t, err)
+		require.False(t, provider.OutboxEnabled())
+
+		provider, err = createEDVProvider(&edvParameters{
+			databaseType: databaseTypeMemOption, outboxEnable: true,
+			extensionsToEnable: &operation.EnabledExtensions{Notifications: true},
+		}, nil, &mockServer{})
+		require.NoError(t, err)
+		require.True(t, provider.OutboxEnabled())
+	})
+}
+
+func TestRevisionHistoryEnable(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + revisionHistoryEnableFlagName, "true",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+	t.Run("revisions are kept if enabled", func(t *testing.T) {
+		for _, enabled := range []bool{true, false} {
+			provider, err := createEDVProvider(&edvParameters{
+				databaseType: databaseTypeMemOption, revisionHistoryEnable: enabled,
+			}, nil, &mockServer{})
+			require.NoError(t, err)
+
+			require.NoError(t, provider.CreateVaultStore("Sr7yHjomhn1aeaFnxREfRN"))
+
+			store, err := provider.OpenStore("Sr7yHjomhn1aeaFnxREfRN")
+			require.NoError(t, err)
+
+			_, err = store.Revision("VJYHHJx4C8J9Fsgz7rZqSp", 0)
+			require.Equal(t, enabled, !errors.Is(err, messages.ErrRevisionHistoryNotEnabled))
+		}
+	})
+	t.Run("failure - invalid revision history enable value", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + revisionHistoryEnableFlagName, "sometimes",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `parsing "sometimes": invalid syntax`)
+	})
+}
+
+func TestEnforcesUniqueConstraints(t *testing.T) {
+	for databaseType, enforces := range map[string]bool{
+		databaseTypeMemOption:      false,
+		databaseTypeCouchDBOption:  false,
+		databaseTypeMongoDBOption:  true,
+		databaseTypePostgresOption: true,
+	} {
+		require.Equal(t, enforces, enforcesUniqueConstraints(databaseType), databaseType)
+	}
+}
+
+func TestMultiTenancyEnable(t *testing.T) {
+	t.Run("success - tenants can be provisioned at the admin endpoint", func(t *testing.T) {
+		srv := &handlerCapturingServer{}
+		startCmd := GetStartCmd(srv)
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + authEnableFlagName, "true", "--" + localKMSSecretsDatabaseTypeFlagName, "mem",
+			"--" + adminTokenFlagName, "adminToken", "--" + multiTenancyEnableFlagName, "true",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/admin/tenants", strings.NewReader(`{"id":"tenant-1"}`))
+		req.Header.Set("Authorization", "Bearer adminToken")
+
+		rw := httptest.NewRecorder()
+
+		srv.handler.ServeHTTP(rw, req)
+		require.Equal(t, http.StatusCreated, rw.Code)
+		require.Equal(t, "/admin/tenants/tenant-1", rw.Header().Get("Location"))
+	})
+	t.Run("failure - admin endpoints aren't enabled", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"--" + multiTenancyEnableFlagName, "true"},
+			{"--" + multiTenancyEnableFlagName, "true", "--" + adminTokenFlagName, "adminToken"},
+			{
+				"--" + multiTenancyEnableFlagName, "true", "--" + authEnableFlagName, "true",
+				"--" + localKMSSecretsDatabaseTypeFlagName, "mem",
+			},
+		} {
+			startCmd := GetStartCmd(&mockServer{})
+			startCmd.SetArgs(append([]string{
+				"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			}, args...))
+
+			err := startCmd.Execute()
+			require.EqualError(t, err, "multi-tenancy-enable can only be enabled if auth-enable is true and "+
+				"admin-token is set", args)
+		}
+	})
+	t.Run("failure - invalid multi-tenancy enable value", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + multiTenancyEnableFlagName, "sometimes",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `invalid value for multi-tenancy-enable: strconv.ParseBool: parsing "sometimes": `+
+			"invalid syntax")
+	})
+	t.Run("provider option", func(t *testing.T) {
+		provider, err := createEDVProvider(&edvParameters{databaseType: databaseTypeMemOption}, nil, &mockServer{})
+		require.NoError(t, err)
+		require.False(t, provider.MultiTenancyEnabled())
+
+		provider, err = createEDVProvider(&edvParameters{databaseType: databaseTypeMemOption, multiTenancyEnable: true},
+			nil, &mockServer{})
+		require.NoError(t, err)
+		require.True(t, provider.MultiTenancyEnabled())
+	})
+}
+
+func TestMetricsEnable(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		srv := &handlerCapturingServer{}
+		startCmd := GetStartCmd(srv)
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + metricsEnableFlagName, "true",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+
+		srv.handler.ServeHTTP(httptest.NewRecorder(),
+			httptest.NewRequest(http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", nil))
+
+		rw := httptest.NewRecorder()
+
+		srv.handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.Equal(t, http.StatusOK, rw.Code)
+		require.Contains(t, rw.Body.String(), `edv_requests_total{code="404",operation="get"} 1`)
+	})
+	t.Run("metrics endpoint not served if not enabled", func(t *testing.T) {
+		srv := &handlerCapturingServer{}
+		startCmd := GetStartCmd(srv)
+
+		args := []string{"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem"}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+
+		srv.handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.Equal(t, http.StatusNotFound, rw.Code)
+	})
+	t.Run("failure - invalid metrics enable value", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + metricsEnableFlagName, "sometimes",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `strconv.ParseBool: parsing "sometimes": invalid syntax`)
+	})
+}
+
+func TestAuditLog(t *testing.T) {
+	t.Run("success - entries are appended to the audit file", func(t *testing.T) {
+		auditFile := filepath.Join(t.TempDir(), "audit.log")
+
+		srv := &handlerCapturingServer{}
+		startCmd := GetStartCmd(srv)
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + auditEnableFlagName, "true", "--" + auditFileFlagName, auditFile,
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+
+		srv.handler.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/encrypted-data-vaults",
+			strings.NewReader(`{"controller":"did:example:controller","referenceId":"ref1",`+
+				`"kek":{"id":"https://example.com/kms/1","type":"AesKeyWrappingKey2019"},`+
+				`"hmac":{"id":"https://example.com/kms/2","type":"Sha256HmacKey2019"}}`)))
+		require.Equal(t, http.StatusCreated, rw.Code)
+
+		// Entries are written to the file in the background.
+		var auditBytes []byte
+
+		require.Eventually(t, func() bool {
+			auditBytes, err = ioutil.ReadFile(filepath.Clean(auditFile))
+
+			return err == nil && len(auditBytes) > 0
+		}, time.Second, 10*time.Millisecond)
+
+		var entry audit.Entry
+
+		require.NoError(t, json.Unmarshal(auditBytes, &entry))
+		require.Equal(t, audit.CreateVaultOperation, entry.Operation)
+		require.Equal(t, "did:example:controller", entry.Actor)
+		require.NotEmpty(t, entry.VaultID)
+	})
+	t.Run("success - entries can be queried at the admin endpoint", func(t *testing.T) {
+		srv := &handlerCapturingServer{}
+		startCmd := GetStartCmd(srv)
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + authEnableFlagName, "true", "--" + localKMSSecretsDatabaseTypeFlagName, "mem",
+			"--" + adminTokenFlagName, "adminToken", "--" + auditEnableFlagName, "true",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/admin/audit", nil)
+		req.Header.Set("Authorization", "Bearer adminToken")
+
+		rw := httptest.NewRecorder()
+
+		srv.handler.ServeHTTP(rw, req)
+		require.Equal(t, http.StatusOK, rw.Code)
+		require.Equal(t, "[]\n", rw.Body.String())
+	})
+	t.Run("failure - invalid audit enable value", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + auditEnableFlagName, "sometimes",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `invalid value for audit-enable: strconv.ParseBool: parsing "sometimes": `+
+			"invalid syntax")
+	})
+	t.Run("failure - invalid sinks", func(t *testing.T) {
+		for _, sinkArgs := range [][]string{
+			{"--" + auditFileFlagName, filepath.Join(t.TempDir(), "missing", "audit.log")},
+			{"--" + auditSyslogEnableFlagName, "sometimes"},
+			{"--" + auditSyslogEnableFlagName, "true", "--" + auditSyslogAddressFlagName, "syslog.example.com:514"},
+			{"--" + auditKafkaURLFlagName, "kafka"},
+		} {
+			startCmd := GetStartCmd(&mockServer{})
+
+			args := append([]string{
+				"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+				"--" + auditEnableFlagName, "true",
+			}, sinkArgs...)
+			startCmd.SetArgs(args)
+
+			require.Error(t, startCmd.Execute(), sinkArgs)
+		}
+	})
+	t.Run("success - vault audit logs can be exported", func(t *testing.T) {
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+
+		keyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		require.NoError(t, err)
+
+		srv := &handlerCapturingServer{}
+		startCmd := GetStartCmd(srv)
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + auditEnableFlagName, "true",
+			"--" + auditSigningKeyFlagName, writeAuditSigningKey(t, "PRIVATE KEY", keyBytes),
+		}
+		startCmd.SetArgs(args)
+
+		err = startCmd.Execute()
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+
+		srv.handler.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/encrypted-data-vaults",
+			strings.NewReader(`{"controller":"did:example:controller","referenceId":"ref1",`+
+				`"kek":{"id":"https://example.com/kms/1","type":"AesKeyWrappingKey2019"},`+
+				`"hmac":{"id":"https://example.com/kms/2","type":"Sha256HmacKey2019"}}`)))
+		require.Equal(t, http.StatusCreated, rw.Code)
+
+		location := rw.Header().Get("Location")
+		vaultID := location[strings.LastIndex(location, "/")+1:]
+
+		// Entries are stored in the background, so the vault's entry may not be exported straight away.
+		require.Eventually(t, func() bool {
+			rw = httptest.NewRecorder()
+
+			srv.handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/encrypted-data-vaults/"+vaultID+"/audit",
+				nil))
+			require.Equal(t, http.StatusOK, rw.Code)
+
+			head, errVerify := audit.VerifyExport(rw.Body)
+			require.NoError(t, errVerify)
+
+			return head.Entries == 1
+		}, time.Second, 10*time.Millisecond)
+	})
+	t.Run("failure - invalid signing keys", func(t *testing.T) {
+		ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+
+		ecdsaKeyBytes, err := x509.MarshalPKCS8PrivateKey(ecdsaKey)
+		require.NoError(t, err)
+
+		for signingKey, expectedErr := range map[string]string{
+			filepath.Join(t.TempDir(), "missing.pem"):             "failed to read audit signing key",
+			writeAuditSigningKey(t, "", nil):                      "no PEM block found",
+			writeAuditSigningKey(t, "PRIVATE KEY", []byte("key")): "failed to parse audit signing key",
+			writeAuditSigningKey(t, "PRIVATE KEY", ecdsaKeyBytes): "audit signing key must be an Ed25519 key",
+		} {
+			startCmd := GetStartCmd(&mockServer{})
+
+			args := []string{
+				"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+				"--" + auditEnableFlagName, "true", "--" + auditSigningKeyFlagName, signingKey,
+			}
+			startCmd.SetArgs(args)
+
+			err := startCmd.Execute()
+			require.Error(t, err)
+			require.Contains(t, err.Error(), expectedErr)
+		}
+	})
+}
+
+// writeAuditSigningKey writes a PEM file with a block of the given type and bytes, or an empty file if the type is
+// empty, and returns its path.
+func writeAuditSigningKey(t *testing.T, blockType string, keyBytes []byte) string {
+	t.Helper()
+
+	var fileBytes []byte
+
+	if blockType != "" {
+		fileBytes = pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: keyBytes})
+	}
+
+	keyFile, err := ioutil.TempFile(t.TempDir(), "key-*.pem")
+	require.NoError(t, err)
+
+	_, err = keyFile.Write(fileBytes)
+	require.NoError(t, err)
+
+	require.NoError(t, keyFile.Close())
+
+	return keyFile.Name()
+}
+
+func TestFaultInjection(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		srv := &handlerCapturingServer{}
+		startCmd := GetStartCmd(srv)
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + faultInjectionFileFlagName,
+			writeFaultInjectionFile(t, `[{"method":"GET","path":"/healthcheck","errorRate":1,"errorStatus":500}]`),
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+
+		srv.handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/healthcheck", nil))
+		require.Equal(t, http.StatusInternalServerError, rw.Code)
+		require.Equal(t, "true", rw.Header().Get(faultinjection.InjectedHeader))
+	})
+	t.Run("failure - invalid fault injection files", func(t *testing.T) {
+		for rulesFile, expectedErr := range map[string]string{
+			filepath.Join(t.TempDir(), "missing.json"):                 "failed to read fault injection file",
+			writeFaultInjectionFile(t, `{"path":"/healthcheck"}`):      "failed to unmarshal fault injection rules",
+			writeFaultInjectionFile(t, `[{"path":"/","errorRate":2}]`): "error rate 2 must be between 0 and 1",
+		} {
+			startCmd := GetStartCmd(&mockServer{})
+
+			args := []string{
+				"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+				"--" + faultInjectionFileFlagName, rulesFile,
+			}
+			startCmd.SetArgs(args)
+
+			err := startCmd.Execute()
+			require.Error(t, err)
+			require.Contains(t, err.Error(), expectedErr)
+		}
+	})
+}
+
+// writeFaultInjectionFile writes a fault injection file with the given rules, and returns its path.
+func writeFaultInjectionFile(t *testing.T, rulesJSON string) string {
+	t.Helper()
+
+	rulesFile, err := ioutil.TempFile(t.TempDir(), "faults-*.json")
+	require.NoError(t, err)
+
+	_, err = rulesFile.WriteString(rulesJSON)
+	require.NoError(t, err)
+
+	require.NoError(t, rulesFile.Close())
+
+	return rulesFile.Name()
+}
+
+func TestVersion(t *testing.T) {
+	srv := &handlerCapturingServer{}
+	startCmd := GetStartCmd(srv)
+
+	args := []string{
+		"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+		"--" + extensionsFlagName, batchExtensionName + "," + notificationsExtensionName,
+	}
+	startCmd.SetArgs(args)
+
+	err := startCmd.Execute()
+	require.NoError(t, err)
+
+	rw := httptest.NewRecorder()
+
+	srv.handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, versionPath, nil))
+	require.Equal(t, http.StatusOK, rw.Code)
+	require.JSONEq(t, `{"version":"dev","commit":"unknown","buildDate":"unknown",`+
+		`"extensions":["Batch","Notifications"],"storageBackend":"mem"}`, rw.Body.String())
+}
+
+func TestReady(t *testing.T) {
+	srv := &handlerCapturingServer{}
+	startCmd := GetStartCmd(srv)
+
+	args := []string{
+		"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+		"--" + authEnableFlagName, "true", "--" + localKMSSecretsDatabaseTypeFlagName, "mem",
+	}
+	startCmd.SetArgs(args)
+
+	err := startCmd.Execute()
+	require.NoError(t, err)
+
+	rw := httptest.NewRecorder()
+
+	srv.handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, readyPath, nil))
+	require.Equal(t, http.StatusOK, rw.Code)
+
+	var resp struct {
+		Status       string `json:"status"`
+		Dependencies map[string]struct {
+			Status string `json:"status"`
+		} `json:"dependencies"`
+	}
+
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &resp))
+	require.Equal(t, "ready", resp.Status)
+	require.Len(t, resp.Dependencies, 3)
+
+	for _, name := range []string{"database", "localKMSSecretsDatabase", "capabilityDatabase"} {
+		require.Equal(t, "up", resp.Dependencies[name].Status, name)
+	}
+}
+
+func TestAuthModes(t *testing.T) {
+	t.Run("success - bearer tokens for some routes", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + authEnableFlagName, "true", "--" + localKMSSecretsDatabaseTypeFlagName, "mem",
+			"--" + authRouteModesFlagName, "documents=bearer,query=both",
+			"--" + authBearerIssuerFlagName, "https://as.example.com",
+			"--" + authBearerIntrospectionURLFlagName, "https://as.example.com/token/introspect",
+			"--" + authBearerClientIDFlagName, "edv", "--" + authBearerClientSecretFlagName, "secret",
+			"--" + authBearerReadScopeFlagName, "{vaultID}.read",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+	t.Run("success - bearer settings are ignored if auth is disabled", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + authModeFlagName, "bearer",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+	})
+	t.Run("failure - invalid auth mode", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + authModeFlagName, "oidc",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `unknown authorization mode "oidc", must be one of [zcap] [bearer] [both]`)
+	})
+	t.Run("failure - invalid route mode", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + authRouteModesFlagName, "documents",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `invalid route mode "documents", must be in the form route=mode`)
+	})
+	t.Run("failure - bearer token issuer not set", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + authEnableFlagName, "true", "--" + localKMSSecretsDatabaseTypeFlagName, "mem",
+			"--" + authModeFlagName, "both",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Equal(t, errBearerIssuerNotSet, err)
+	})
+	t.Run("failure - invalid bearer token issuer", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + authEnableFlagName, "true", "--" + localKMSSecretsDatabaseTypeFlagName, "mem",
+			"--" + authModeFlagName, "bearer", "--" + authBearerIssuerFlagName, "as.example.com",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to create bearer token service")
+	})
+}
+
+func TestProtectedResourceMetadata(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		srv := &handlerCapturingServer{}
+		startCmd := GetStartCmd(srv)
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + authEnableFlagName, "true", "--" + localKMSSecretsDatabaseTypeFlagName, "mem",
+			"--" + authRouteModesFlagName, "documents=bearer",
+			"--" + authBearerIssuerFlagName, "https://as.example.com",
+			"--" + authBearerWriteScopeFlagName, "{vaultID}.write",
+			"--" + authResourceURLFlagName, "https://edv.example.com",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		srv.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, auth.ProtectedResourceMetadataPath, nil))
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.JSONEq(t, `{"resource":"https://edv.example.com","authorization_servers":["https://as.example.com"],`+
+			`"bearer_methods_supported":["header"],"scopes_supported":["edv:read:{vaultID}","{vaultID}.write"],`+
+			`"authorization_schemes_supported":["Bearer","GNAP"],`+
+			`"edv_auth_modes":{"default":"zcap","documents":"bearer"}}`, rr.Body.String())
+	})
+	t.Run("not served if auth is disabled", func(t *testing.T) {
+		srv := &handlerCapturingServer{}
+		startCmd := GetStartCmd(srv)
+
+		args := []string{"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem"}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		srv.handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, auth.ProtectedResourceMetadataPath, nil))
+
+		require.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestZCAPLimits(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + authEnableFlagName, "true", "--" + localKMSSecretsDatabaseTypeFlagName, "mem",
+			"--" + zcapMaxChainLengthFlagName, "5", "--" + zcapMaxCaveatsFlagName, "10",
+			"--" + zcapMaxDocumentSizeFlagName, "65536",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+
+		limits, err := getZCAPLimits(startCmd)
+		require.NoError(t, err)
+		require.Equal(t, zcapld.Limits{MaxChainLength: 5, MaxCaveats: 10, MaxDocumentSize: 65536}, limits)
+	})
+	t.Run("failure - invalid max chain length", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + zcapMaxChainLengthFlagName, "deep",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `failed to parse zcap-max-chain-length deep into an unsigned integer: `+
+			`strconv.ParseUint: parsing "deep": invalid syntax`)
+	})
+	t.Run("failure - invalid max caveats", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + zcapMaxCaveatsFlagName, "-1",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to parse zcap-max-caveats -1 into an unsigned integer")
+	})
+	t.Run("failure - invalid max document size", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + zcapMaxDocumentSizeFlagName, "NotAnInt",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to parse zcap-max-document-size NotAnInt into an unsigned integer")
+	})
+}
+
+func TestHotVaults(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + hotVaultsFlagName, "vault1, vault2,",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.NoError(t, err)
+
+		require.Equal(t, []string{"vault1", "vault2"}, getHotVaults(startCmd))
+	})
+	t.Run("vaults that don't exist are skipped", func(t *testing.T) {
+		provider := edvprovider.NewProvider(mem.NewProvider(), 100)
+
+		require.NoError(t, provider.CreateVaultStore("vault2"))
+
+		warmUpVaults(provider, []string{"vault1", "vault2"})
+
+		exists, err := provider.StoreExists("vault1")
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+}
+
 func TestStartCmdEmptyDomain(t *testing.T) {
 	startCmd := GetStartCmd(&mockServer{})
 
@@ -0,0 +1,98 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package startcmd
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// shutdownRegistrar is what components register the functions that stop them with.
+type shutdownRegistrar interface {
+	RegisterOnShutdown(hook func(ctx context.Context) error)
+}
+
+// startup keeps track of the components of the EDV server as they're started, so that the ones that were started can
+// be stopped if a later one fails to start. Otherwise, a failed start would leave databases open and background
+// goroutines running. Components register the functions that stop them with RegisterOnShutdown, like they would with
+// the server, and the work that they do in the background with goOnceStarted. Once every component has started,
+// commit hands the functions over to the server and starts the background work.
+type startup struct {
+	shutdownHooks []func(ctx context.Context) error
+	background    []func()
+}
+
+// RegisterOnShutdown registers a function that stops a component that has been started. Like the server's, the
+// functions are called in the reverse order of their registration.
+func (s *startup) RegisterOnShutdown(hook func(ctx context.Context) error) {
+	s.shutdownHooks = append(s.shutdownHooks, hook)
+}
+
+// goOnceStarted has fn run in its own goroutine once every component has started. fn must return once the components
+// that it uses have been stopped.
+func (s *startup) goOnceStarted(fn func()) {
+	s.background = append(s.background, fn)
+}
+
+// group starts components that don't depend on each other concurrently, giving each one its own startup. Once they've
+// all returned, what they registered is added to s in the order that they were given in, so that the components are
+// stopped in a predictable order however their starts interleaved. The first error that any of them failed with is
+// returned.
+func (s *startup) group(starts ...func(s *startup) error) error {
+	components := make([]*startup, len(starts))
+
+	var g errgroup.Group
+
+	for i, start := range starts {
+		component, start := &startup{}, start
+		components[i] = component
+
+		g.Go(func() error {
+			return start(component)
+		})
+	}
+
+	err := g.Wait()
+
+	for _, component := range components {
+		s.shutdownHooks = append(s.shutdownHooks, component.shutdownHooks...)
+		s.background = append(s.background, component.background...)
+	}
+
+	return err
+}
+
+// rollback stops the components that were started, giving them up to timeout to stop, and returns startErr, which is
+// the error that a later component failed to start with. Errors from stopping the components are only logged, so
+// that the reason why the EDV server didn't start isn't hidden. The background work is never started.
+func (s *startup) rollback(startErr error, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for i := len(s.shutdownHooks) - 1; i >= 0; i-- {
+		err := s.shutdownHooks[i](ctx)
+		if err != nil {
+			logger.Warnf("Failed to stop a component after the EDV server failed to start: %s", err)
+		}
+	}
+
+	return startErr
+}
+
+// commit registers the functions that stop the components with srv, so that they're called when it's shut down, and
+// then starts the background work.
+func (s *startup) commit(srv shutdownRegistrar) {
+	for _, hook := range s.shutdownHooks {
+		srv.RegisterOnShutdown(hook)
+	}
+
+	for _, fn := range s.background {
+		go fn()
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package startcmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartup(t *testing.T) {
+	// record returns a shutdown hook that adds name to the calls.
+	record := func(calls *[]string, name string) func(context.Context) error {
+		return func(context.Context) error {
+			*calls = append(*calls, name)
+
+			return nil
+		}
+	}
+
+	t.Run("Components started together are stopped in the order they were given in", func(t *testing.T) {
+		var calls []string
+
+		s := &startup{}
+		s.RegisterOnShutdown(record(&calls, "kms"))
+
+		require.NoError(t, s.group(
+			func(s *startup) error {
+				// Registers last, but is still stopped after the components given after it.
+				time.Sleep(10 * time.Millisecond)
+
+				s.RegisterOnShutdown(record(&calls, "auth"))
+
+				return nil
+			},
+			func(s *startup) error {
+				s.RegisterOnShutdown(record(&calls, "storage"))
+
+				return nil
+			},
+		))
+
+		srv := &handlerCapturingServer{}
+		s.commit(srv)
+
+		for i := len(srv.shutdownHooks) - 1; i >= 0; i-- {
+			require.NoError(t, srv.shutdownHooks[i](context.Background()))
+		}
+
+		require.Equal(t, []string{"storage", "auth", "kms"}, calls)
+	})
+	t.Run("Started components are stopped if one fails to start", func(t *testing.T) {
+		var calls []string
+
+		errStart := errors.New("start error")
+
+		s := &startup{}
+		s.RegisterOnShutdown(record(&calls, "kms"))
+		s.goOnceStarted(func() {
+			calls = append(calls, "background")
+		})
+
+		err := s.group(
+			func(s *startup) error {
+				s.RegisterOnShutdown(record(&calls, "auth"))
+
+				return errStart
+			},
+			func(s *startup) error {
+				s.RegisterOnShutdown(func(context.Context) error {
+					return errors.New("stop error")
+				})
+
+				return nil
+			},
+		)
+		require.Equal(t, errStart, err)
+
+		// Errors from stopping the components don't hide the one that the start failed with.
+		require.Equal(t, errStart, s.rollback(err, time.Second))
+		require.Equal(t, []string{"auth", "kms"}, calls)
+	})
+	t.Run("Background work starts once committed", func(t *testing.T) {
+		started := make(chan struct{})
+
+		s := &startup{}
+		s.goOnceStarted(func() {
+			close(started)
+		})
+
+		select {
+		case <-started:
+			require.Fail(t, "background work started before the components were committed")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		s.commit(&mockServer{})
+
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			require.Fail(t, "background work wasn't started")
+		}
+	})
+}
@@ -0,0 +1,157 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package audit records an append-only trail of the operations performed on vaults: who performed which operation
+// on which vault or document, when, and whether it succeeded. Entries only ever hold identifiers and outcomes,
+// never the content of requests or responses, so no ciphertext or JWE is written to any sink.
+package audit
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/trustbloc/edv/pkg/logging"
+)
+
+// The operations that are audited.
+const (
+	CreateVaultOperation         = "create-vault"
+	DeleteVaultOperation         = "delete-vault"
+	QueryOperation               = "query"
+	CountQueryOperation          = "count-query"
+	CreateDocumentOperation      = "create-document"
+	ReadDocumentOperation        = "read-document"
+	CheckDocumentOperation       = "check-document"
+	UpdateDocumentOperation      = "update-document"
+	DeleteDocumentOperation      = "delete-document"
+	RestoreDocumentOperation     = "restore-document"
+	BatchOperation               = "batch"
+	BatchCapacityOperation       = "batch-capacity"
+	DelegateCapabilityOperation  = "delegate-capability"
+	RevokeCapabilityOperation    = "revoke-capability"
+	UpdateConfigurationOperation = "update-configuration"
+	ListDocumentsOperation       = "list-documents"
+	ExportVaultOperation         = "export-vault"
+	ImportVaultOperation         = "import-vault"
+	ExportAuditLogOperation      = "export-audit-log"
+	IndexingStatusOperation      = "indexing-status"
+	RotateReferenceIDOperation   = "rotate-reference-id"
+	CreateSubscriptionOperation  = "create-subscription"
+	ReadSubscriptionsOperation   = "read-subscriptions"
+	DeleteSubscriptionOperation  = "delete-subscription"
+)
+
+// The outcomes of audited operations.
+const (
+	// OutcomeSuccess is the outcome of operations that were responded to with a 1xx, 2xx or 3xx status code.
+	OutcomeSuccess = "success"
+	// OutcomeFailure is the outcome of operations that were responded to with a 4xx or 5xx status code.
+	OutcomeFailure = "failure"
+)
+
+const logModuleName = "audit"
+
+var logger = logging.New(logModuleName)
+
+type entryContextKey struct{}
+
+// Entry is a record of an operation performed on a vault.
+type Entry struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	// Actor is the invoker of the ZCAP, the subject of the bearer token, or, for created vaults, the controller of
+	// the vault. It's empty if the operation wasn't authorized by either.
+	Actor      string `json:"actor,omitempty"`
+	Operation  string `json:"operation"`
+	VaultID    string `json:"vaultID,omitempty"`
+	DocumentID string `json:"documentID,omitempty"`
+	StatusCode int    `json:"statusCode"`
+	Outcome    string `json:"outcome"`
+	// CorrelationID is the correlation ID of the request, which is included in the lines logged while handling it.
+	CorrelationID string `json:"correlationID,omitempty"`
+}
+
+// Sink is somewhere that audit entries are written to. Sinks must only ever append entries.
+type Sink interface {
+	Write(entry *Entry) error
+}
+
+// Query selects audit entries. Fields that aren't set don't restrict the entries that are selected.
+type Query struct {
+	VaultID   string
+	Actor     string
+	Operation string
+	// Since and Until bound the times of the selected entries, inclusively.
+	Since time.Time
+	Until time.Time
+	// Limit is the maximum number of entries to return, newest first.
+	Limit int
+}
+
+// Log records audit entries to each of its sinks.
+type Log struct {
+	sinks  []Sink
+	logger logging.Logger
+}
+
+// New returns a new audit log that writes to the given sinks.
+func New(sinks ...Sink) *Log {
+	return &Log{sinks: sinks, logger: logger}
+}
+
+// WithLogger returns a copy of the audit log that logs the entries its sinks fail to write with the given logger,
+// instead of the edge-core logger for the audit module.
+func (l *Log) WithLogger(logger logging.Logger) *Log {
+	return &Log{sinks: l.sinks, logger: logger}
+}
+
+// Record sets the ID, time and outcome of the entry if they aren't set, and writes it to every sink. The requests
+// being audited have already been handled, so a sink that fails to write the entry is logged as an error and
+// doesn't stop the entry from being written to the other sinks. Slow sinks can be wrapped in a QueuedSink, so that
+// Record doesn't wait for them.
+func (l *Log) Record(entry *Entry) {
+	if entry.ID == "" {
+		entry.ID = uuid.New().String()
+	}
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+
+	if entry.Outcome == "" {
+		entry.Outcome = OutcomeSuccess
+
+		if entry.StatusCode >= http.StatusBadRequest {
+			entry.Outcome = OutcomeFailure
+		}
+	}
+
+	logger := logging.WithCorrelationID(l.logger, entry.CorrelationID)
+
+	for _, sink := range l.sinks {
+		if err := sink.Write(entry); err != nil {
+			logger.Errorf("Failed to write audit entry %s for %s operation on vault %s: %s", entry.ID,
+				entry.Operation, entry.VaultID, err)
+		}
+	}
+}
+
+// NewContext returns a copy of ctx that carries the given entry, so that the handler of the audited request can
+// fill in what the request alone doesn't say (see SetActor).
+func NewContext(ctx context.Context, entry *Entry) context.Context {
+	return context.WithValue(ctx, entryContextKey{}, entry)
+}
+
+// SetActor sets the actor of the entry carried by ctx, unless the entry already has one or ctx doesn't carry one.
+func SetActor(ctx context.Context, actor string) {
+	entry, ok := ctx.Value(entryContextKey{}).(*Entry)
+	if ok && entry.Actor == "" {
+		entry.Actor = actor
+	}
+}
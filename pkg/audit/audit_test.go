@@ -0,0 +1,66 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLog_Record(t *testing.T) {
+	t.Run("Entries are completed and written to every sink", func(t *testing.T) {
+		failing := &mockSink{err: errors.New("sink unavailable")}
+		working := &mockSink{}
+
+		log := New(failing, working)
+
+		log.Record(&Entry{Operation: ReadDocumentOperation, VaultID: "vault1", StatusCode: http.StatusOK})
+		log.Record(&Entry{Operation: DeleteDocumentOperation, VaultID: "vault1", StatusCode: http.StatusNotFound})
+
+		require.Len(t, failing.entries, 2)
+		require.Len(t, working.entries, 2)
+
+		require.NotEmpty(t, working.entries[0].ID)
+		require.False(t, working.entries[0].Time.IsZero())
+		require.Equal(t, OutcomeSuccess, working.entries[0].Outcome)
+		require.Equal(t, OutcomeFailure, working.entries[1].Outcome)
+		require.NotEqual(t, working.entries[0].ID, working.entries[1].ID)
+	})
+	t.Run("No sinks", func(t *testing.T) {
+		New().Record(&Entry{Operation: QueryOperation})
+	})
+}
+
+func TestSetActor(t *testing.T) {
+	entry := &Entry{}
+	ctx := NewContext(context.Background(), entry)
+
+	SetActor(ctx, "did:example:controller")
+	require.Equal(t, "did:example:controller", entry.Actor)
+
+	// The actor that authorized the request is kept.
+	SetActor(ctx, "did:example:other")
+	require.Equal(t, "did:example:controller", entry.Actor)
+
+	// A context without an entry is ignored.
+	SetActor(context.Background(), "did:example:controller")
+}
+
+type mockSink struct {
+	entries []Entry
+	err     error
+}
+
+func (m *mockSink) Write(entry *Entry) error {
+	m.entries = append(m.entries, *entry)
+
+	return m.err
+}
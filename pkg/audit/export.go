@@ -0,0 +1,271 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/pkg/vdr/fingerprint"
+)
+
+const (
+	// exportSignatureAlgorithm is the JWS algorithm (RFC 8037) of the signatures over exported chain heads.
+	exportSignatureAlgorithm = "EdDSA"
+	// jwsParts is the number of parts of a compact JWS: header, payload and signature.
+	jwsParts = 3
+	// maxExportLineSize is the maximum size of a line that VerifyExport reads. Audit entries only hold identifiers,
+	// so they're far smaller.
+	maxExportLineSize = 1 << 20
+)
+
+// ErrInvalidExport is returned when an exported audit log fails verification.
+var ErrInvalidExport = errors.New("invalid audit log export")
+
+// ExportRecord is a line of an exported audit log, other than the last one. Hash is the hex-encoded SHA-256 hash of
+// the previous record's hash (an empty string for the first record) followed by the bytes of Entry, so that each
+// record is chained to all the ones before it.
+type ExportRecord struct {
+	Entry json.RawMessage `json:"entry"`
+	Hash  string          `json:"hash"`
+}
+
+// ExportSignature is the last line of an exported audit log. Signature is a compact JWS (RFC 7515), signed by the
+// EDV server with EdDSA, whose payload is the ExportHead of the export. Its kid header is the did:key URL of the
+// server's signing key.
+type ExportSignature struct {
+	Signature string `json:"signature"`
+}
+
+// ExportHead is what the EDV server signs at the end of an exported audit log: the hash of the last record, which
+// is the head of the chain, along with the vault it's for and the number of records.
+type ExportHead struct {
+	VaultID    string    `json:"vaultID"`
+	Entries    int       `json:"entries"`
+	Head       string    `json:"head"`
+	ExportedAt time.Time `json:"exportedAt"`
+	// KeyID is the kid header of the signature. It's only set by VerifyExport, and isn't part of the payload.
+	KeyID string `json:"-"`
+}
+
+type jwsHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// Exporter exports the audit entries of vaults as signed, hash-chained JSON lines, so that controllers can archive
+// access histories that can be verified independently of the EDV server.
+type Exporter struct {
+	store      *Store
+	privateKey ed25519.PrivateKey
+	keyID      string
+}
+
+// NewExporter returns a new Exporter that exports the entries kept in the given store, and signs the exports with
+// the given key.
+func NewExporter(store *Store, privateKey ed25519.PrivateKey) *Exporter {
+	_, keyID := fingerprint.CreateDIDKey(privateKey.Public().(ed25519.PublicKey))
+
+	return &Exporter{store: store, privateKey: privateKey, keyID: keyID}
+}
+
+// KeyID returns the did:key URL of the key that exports are signed with. Verifiers should check that the signatures
+// of exports were made with it.
+func (e *Exporter) KeyID() string {
+	return e.keyID
+}
+
+// Export writes the audit entries of the given vault to w, oldest first, one ExportRecord per line, followed by an
+// ExportSignature over the head of the chain. It returns the number of entries written. If writing fails part way
+// through, then the export has no signature, so verifiers can tell that it was cut short.
+func (e *Exporter) Export(w io.Writer, vaultID string) (int, error) {
+	entries, err := e.store.queryEntries(vaultTagName+":"+vaultID, &Query{})
+	if err != nil {
+		return 0, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+
+	encoder := json.NewEncoder(w)
+
+	var hash string
+
+	for i := range entries {
+		entryBytes, errMarshal := json.Marshal(&entries[i])
+		if errMarshal != nil {
+			return i, fmt.Errorf("failed to marshal audit entry: %w", errMarshal)
+		}
+
+		hash = chainHash(hash, entryBytes)
+
+		if errEncode := encoder.Encode(&ExportRecord{Entry: entryBytes, Hash: hash}); errEncode != nil {
+			return i, fmt.Errorf("failed to write audit entry: %w", errEncode)
+		}
+	}
+
+	signature, err := e.sign(&ExportHead{
+		VaultID: vaultID, Entries: len(entries), Head: hash, ExportedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return len(entries), err
+	}
+
+	if err = encoder.Encode(&ExportSignature{Signature: signature}); err != nil {
+		return len(entries), fmt.Errorf("failed to write audit log signature: %w", err)
+	}
+
+	return len(entries), nil
+}
+
+// sign returns a compact JWS with the given head as its payload.
+func (e *Exporter) sign(head *ExportHead) (string, error) {
+	headerBytes, err := json.Marshal(&jwsHeader{Algorithm: exportSignatureAlgorithm, KeyID: e.keyID})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal signature header: %w", err)
+	}
+
+	payloadBytes, err := json.Marshal(head)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal chain head: %w", err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerBytes) + "." +
+		base64.RawURLEncoding.EncodeToString(payloadBytes)
+
+	signature := ed25519.Sign(e.privateKey, []byte(signingInput))
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// VerifyExport checks an audit log exported by an Exporter: that each record is chained to the ones before it, and
+// that the signature at the end is valid and covers the last record and the number of records. The signature is
+// verified with the key in its kid header, so the returned head's KeyID must be checked against the EDV server's
+// key as well.
+func VerifyExport(r io.Reader) (*ExportHead, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxExportLineSize)
+
+	var (
+		hash    string
+		entries int
+	)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		var signature ExportSignature
+
+		if err := json.Unmarshal(line, &signature); err == nil && signature.Signature != "" {
+			if scanner.Scan() {
+				return nil, fmt.Errorf("%w: records follow the signature", ErrInvalidExport)
+			}
+
+			return verifyExportHead(signature.Signature, hash, entries)
+		}
+
+		var record ExportRecord
+
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf("%w: record %d: %s", ErrInvalidExport, entries+1, err)
+		}
+
+		hash = chainHash(hash, record.Entry)
+		entries++
+
+		if record.Hash != hash {
+			return nil, fmt.Errorf("%w: hash of record %d doesn't match the chain", ErrInvalidExport, entries)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log export: %w", err)
+	}
+
+	return nil, fmt.Errorf("%w: the export isn't signed", ErrInvalidExport)
+}
+
+// verifyExportHead verifies the signature at the end of an export, and checks that it covers the chain with the
+// given head and number of records.
+func verifyExportHead(signature, hash string, entries int) (*ExportHead, error) {
+	parts := strings.Split(signature, ".")
+	if len(parts) != jwsParts {
+		return nil, fmt.Errorf("%w: the signature isn't a compact JWS", ErrInvalidExport)
+	}
+
+	var header jwsHeader
+
+	if err := decodeJWSPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+
+	if header.Algorithm != exportSignatureAlgorithm {
+		return nil, fmt.Errorf("%w: unsupported signature algorithm %q", ErrInvalidExport, header.Algorithm)
+	}
+
+	did := header.KeyID
+	if fragment := strings.Index(did, "#"); fragment >= 0 {
+		did = did[:fragment]
+	}
+
+	publicKey, err := fingerprint.PubKeyFromDIDKey(did)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%w: kid %q isn't an Ed25519 did:key", ErrInvalidExport, header.KeyID)
+	}
+
+	signatureBytes, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !ed25519.Verify(publicKey, []byte(parts[0]+"."+parts[1]), signatureBytes) {
+		return nil, fmt.Errorf("%w: the signature isn't valid", ErrInvalidExport)
+	}
+
+	var head ExportHead
+
+	if err = decodeJWSPart(parts[1], &head); err != nil {
+		return nil, err
+	}
+
+	if head.Head != hash || head.Entries != entries {
+		return nil, fmt.Errorf("%w: the signature covers %d records with head %q, but the export has %d with head %q",
+			ErrInvalidExport, head.Entries, head.Head, entries, hash)
+	}
+
+	head.KeyID = header.KeyID
+
+	return &head, nil
+}
+
+func decodeJWSPart(part string, v interface{}) error {
+	partBytes, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return fmt.Errorf("%w: failed to decode signature: %s", ErrInvalidExport, err)
+	}
+
+	if err = json.Unmarshal(partBytes, v); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal signature: %s", ErrInvalidExport, err)
+	}
+
+	return nil
+}
+
+// chainHash returns the hex-encoded SHA-256 hash of the previous hash followed by the entry's bytes.
+func chainHash(previousHash string, entryBytes []byte) string {
+	hash := sha256.Sum256(bytes.Join([][]byte{[]byte(previousHash), entryBytes}, nil))
+
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,173 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExporter(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	store, err := NewStore(mem.NewProvider())
+	require.NoError(t, err)
+
+	start := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	// Written out of order, so that the export has to sort them.
+	for i, entry := range []*Entry{
+		{ID: "b", Operation: CreateDocumentOperation, VaultID: "vault1", DocumentID: "doc1"},
+		{ID: "a", Actor: "did:example:alice", Operation: CreateVaultOperation, VaultID: "vault1"},
+		{ID: "c", Operation: ReadDocumentOperation, VaultID: "vault1", DocumentID: "<doc&2>"},
+		{ID: "d", Operation: CreateVaultOperation, VaultID: "vault2"},
+	} {
+		entry.Time = start.Add(time.Duration(strings.Index("abcd", entry.ID)) * time.Minute)
+		entry.StatusCode = 200 + i
+
+		require.NoError(t, store.Write(entry))
+	}
+
+	exporter := NewExporter(store, privateKey)
+	require.True(t, strings.HasPrefix(exporter.KeyID(), "did:key:z"))
+
+	t.Run("Success", func(t *testing.T) {
+		var export bytes.Buffer
+
+		written, err := exporter.Export(&export, "vault1")
+		require.NoError(t, err)
+		require.Equal(t, 3, written)
+
+		lines := strings.Split(strings.TrimSuffix(export.String(), "\n"), "\n")
+		require.Len(t, lines, 4)
+
+		for i, id := range []string{"a", "b", "c"} {
+			var record ExportRecord
+
+			require.NoError(t, json.Unmarshal([]byte(lines[i]), &record))
+
+			var entry Entry
+
+			require.NoError(t, json.Unmarshal(record.Entry, &entry))
+			require.Equal(t, id, entry.ID)
+		}
+
+		head, err := VerifyExport(strings.NewReader(export.String()))
+		require.NoError(t, err)
+		require.Equal(t, "vault1", head.VaultID)
+		require.Equal(t, 3, head.Entries)
+		require.Equal(t, exporter.KeyID(), head.KeyID)
+		require.False(t, head.ExportedAt.IsZero())
+	})
+	t.Run("Vault without entries", func(t *testing.T) {
+		var export bytes.Buffer
+
+		written, err := exporter.Export(&export, "vault3")
+		require.NoError(t, err)
+		require.Zero(t, written)
+
+		head, err := VerifyExport(&export)
+		require.NoError(t, err)
+		require.Zero(t, head.Entries)
+		require.Empty(t, head.Head)
+	})
+	t.Run("Tampered exports fail verification", func(t *testing.T) {
+		var export bytes.Buffer
+
+		_, err := exporter.Export(&export, "vault1")
+		require.NoError(t, err)
+
+		lines := strings.Split(strings.TrimSuffix(export.String(), "\n"), "\n")
+
+		otherExporter := NewExporter(store, ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize)))
+
+		var otherExport bytes.Buffer
+
+		_, err = otherExporter.Export(&otherExport, "vault1")
+		require.NoError(t, err)
+
+		otherLines := strings.Split(strings.TrimSuffix(otherExport.String(), "\n"), "\n")
+
+		var signature ExportSignature
+
+		require.NoError(t, json.Unmarshal([]byte(lines[3]), &signature))
+
+		parts := strings.Split(signature.Signature, ".")
+
+		// The signature of the other export, with the payload of this one.
+		var otherSignature ExportSignature
+
+		require.NoError(t, json.Unmarshal([]byte(otherLines[3]), &otherSignature))
+
+		otherParts := strings.Split(otherSignature.Signature, ".")
+
+		forgedSignature, err := json.Marshal(&ExportSignature{
+			Signature: otherParts[0] + "." + parts[1] + "." + parts[2],
+		})
+		require.NoError(t, err)
+
+		tests := []struct {
+			name  string
+			lines []string
+			err   string
+		}{
+			{"Altered entry", []string{strings.Replace(lines[0], "alice", "mallory", 1), lines[1], lines[2], lines[3]},
+				"hash of record 1 doesn't match the chain"},
+			{"Removed entry", []string{lines[0], lines[2], lines[3]}, "hash of record 2 doesn't match the chain"},
+			{"Reordered entries", []string{lines[1], lines[0], lines[2], lines[3]},
+				"hash of record 1 doesn't match the chain"},
+			{"Truncated export", []string{lines[0], lines[1]}, "the export isn't signed"},
+			{"Truncated chain", []string{lines[0], lines[1], lines[3]}, "the signature covers 3 records"},
+			{"Records after the signature", append(append([]string{}, lines...), lines[0]),
+				"records follow the signature"},
+			{"Signature swapped for another key's", []string{lines[0], lines[1], lines[2], string(forgedSignature)},
+				"the signature isn't valid"},
+			{"Invalid record", []string{"{"}, "record 1"},
+			{"Invalid signature", []string{`{"signature":"abc"}`}, "the signature isn't a compact JWS"},
+			{"Undecodable signature", []string{`{"signature":"!.!.!"}`}, "failed to decode signature"},
+			{"Unsupported algorithm", []string{`{"signature":"eyJhbGciOiJub25lIn0.e30."}`},
+				`unsupported signature algorithm "none"`},
+			{"Invalid key", []string{`{"signature":"eyJhbGciOiJFZERTQSIsImtpZCI6ImtleTEifQ.e30."}`},
+				`kid "key1" isn't an Ed25519 did:key`},
+		}
+
+		for _, test := range tests {
+			_, err := VerifyExport(strings.NewReader(strings.Join(test.lines, "\n") + "\n"))
+			require.True(t, errors.Is(err, ErrInvalidExport), test.name)
+			require.Contains(t, err.Error(), test.err, test.name)
+		}
+	})
+	t.Run("Fail to query entries", func(t *testing.T) {
+		failingStore := &Store{store: &mockstorage.MockStore{ErrQuery: errors.New("query error")}}
+
+		_, err := NewExporter(failingStore, privateKey).Export(&bytes.Buffer{}, "vault1")
+		require.EqualError(t, err, "failed to query audit store: query error")
+	})
+	t.Run("Fail to write", func(t *testing.T) {
+		_, err := exporter.Export(failingWriter{}, "vault1")
+		require.EqualError(t, err, "failed to write audit entry: write error")
+
+		_, err = exporter.Export(failingWriter{}, "vault3")
+		require.EqualError(t, err, "failed to write audit log signature: write error")
+	})
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write error")
+}
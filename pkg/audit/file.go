@@ -0,0 +1,57 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const auditFilePermissions = 0o600
+
+// FileSink is a sink that appends each entry to a file as a line of JSON.
+type FileSink struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// NewFileSink returns a new FileSink that appends to the file at the given path, which is created if it doesn't
+// exist. The file is opened in append-only mode, so existing entries are never overwritten.
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(filepath.Clean(path), os.O_WRONLY|os.O_APPEND|os.O_CREATE, auditFilePermissions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+
+	return &FileSink{file: file}, nil
+}
+
+// Write appends the entry to the file.
+func (f *FileSink) Write(entry *Entry) error {
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	_, err = f.file.Write(append(entryBytes, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write audit entry to file: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the file.
+func (f *FileSink) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,57 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	sink, err := NewFileSink(path)
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(&Entry{ID: "1", Operation: CreateVaultOperation}))
+	require.NoError(t, sink.Close())
+
+	// Reopening the file appends to it.
+	sink, err = NewFileSink(path)
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(&Entry{ID: "2", Operation: DeleteVaultOperation}))
+	require.NoError(t, sink.Close())
+
+	file, err := os.Open(filepath.Clean(path))
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, file.Close())
+	}()
+
+	var ids []string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+
+		ids = append(ids, entry.ID)
+	}
+
+	require.Equal(t, []string{"1", "2"}, ids)
+
+	require.Error(t, sink.Write(&Entry{ID: "3"}))
+
+	_, err = NewFileSink(filepath.Join(t.TempDir(), "missing", "audit.log"))
+	require.Error(t, err)
+}
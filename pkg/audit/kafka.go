@@ -0,0 +1,116 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	kafkaContentType       = "application/vnd.kafka.json.v2+json"
+	kafkaMaxErrorBodyBytes = 1024
+	defaultKafkaTimeout    = 10 * time.Second
+)
+
+type httpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// KafkaOption configures a KafkaSink.
+type KafkaOption func(k *KafkaSink)
+
+// WithKafkaHTTPClient sets the HTTP client used to call the Kafka REST Proxy.
+func WithKafkaHTTPClient(client httpClient) KafkaOption {
+	return func(k *KafkaSink) {
+		k.httpClient = client
+	}
+}
+
+// KafkaSink is a sink that produces each entry to a Kafka topic through a Kafka REST Proxy (v2 API), keyed by the
+// entry's vault ID so that the entries of a vault stay in order.
+type KafkaSink struct {
+	topicURL   string
+	httpClient httpClient
+}
+
+// NewKafkaSink returns a new KafkaSink that produces to the given topic through the REST Proxy at proxyURL.
+func NewKafkaSink(proxyURL, topic string, opts ...KafkaOption) (*KafkaSink, error) {
+	if topic == "" {
+		return nil, errors.New("a Kafka topic is required")
+	}
+
+	if _, err := url.ParseRequestURI(proxyURL); err != nil {
+		return nil, fmt.Errorf("invalid Kafka REST Proxy URL: %w", err)
+	}
+
+	k := &KafkaSink{
+		topicURL:   strings.TrimSuffix(proxyURL, "/") + "/topics/" + url.PathEscape(topic),
+		httpClient: &http.Client{Timeout: defaultKafkaTimeout},
+	}
+
+	for _, opt := range opts {
+		opt(k)
+	}
+
+	return k, nil
+}
+
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaRecord struct {
+	Key   string `json:"key,omitempty"`
+	Value *Entry `json:"value"`
+}
+
+// Write produces the entry to the topic.
+func (k *KafkaSink) Write(entry *Entry) error {
+	body, err := json.Marshal(&kafkaRecords{Records: []kafkaRecord{{Key: entry.VaultID, Value: entry}}})
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, k.topicURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create Kafka REST Proxy request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", kafkaContentType)
+
+	resp, err := k.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send audit entry to Kafka REST Proxy: %w", err)
+	}
+
+	defer func() {
+		if errClose := resp.Body.Close(); errClose != nil {
+			logger.Warnf("Failed to close Kafka REST Proxy response body: %s", errClose)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, errRead := ioutil.ReadAll(io.LimitReader(resp.Body, kafkaMaxErrorBodyBytes))
+		if errRead != nil {
+			return fmt.Errorf("failed to read Kafka REST Proxy response: %w", errRead)
+		}
+
+		return fmt.Errorf("failed to produce audit entry to %s, status code %d: %s", k.topicURL, resp.StatusCode,
+			respBody)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKafkaSink(t *testing.T) {
+	t.Run("Entries are produced to the topic, keyed by vault", func(t *testing.T) {
+		var (
+			path        string
+			contentType string
+			records     kafkaRecords
+		)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			contentType = r.Header.Get("Content-Type")
+
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&records))
+		}))
+		defer srv.Close()
+
+		sink, err := NewKafkaSink(srv.URL+"/", "edv-audit")
+		require.NoError(t, err)
+
+		require.NoError(t, sink.Write(&Entry{ID: "1", Operation: QueryOperation, VaultID: "vault1"}))
+
+		require.Equal(t, "/topics/edv-audit", path)
+		require.Equal(t, kafkaContentType, contentType)
+		require.Len(t, records.Records, 1)
+		require.Equal(t, "vault1", records.Records[0].Key)
+		require.Equal(t, "1", records.Records[0].Value.ID)
+	})
+	t.Run("REST Proxy rejects the entry", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "topic not found", http.StatusNotFound)
+		}))
+		defer srv.Close()
+
+		sink, err := NewKafkaSink(srv.URL, "edv-audit")
+		require.NoError(t, err)
+
+		err = sink.Write(&Entry{ID: "1"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "status code 404: topic not found")
+	})
+	t.Run("REST Proxy unreachable", func(t *testing.T) {
+		sink, err := NewKafkaSink("http://localhost:8082", "edv-audit",
+			WithKafkaHTTPClient(&failingHTTPClient{}))
+		require.NoError(t, err)
+
+		require.EqualError(t, sink.Write(&Entry{ID: "1"}),
+			"failed to send audit entry to Kafka REST Proxy: connection refused")
+	})
+	t.Run("Invalid configuration", func(t *testing.T) {
+		_, err := NewKafkaSink("http://localhost:8082", "")
+		require.EqualError(t, err, "a Kafka topic is required")
+
+		_, err = NewKafkaSink("localhost", "edv-audit")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid Kafka REST Proxy URL")
+	})
+}
+
+type failingHTTPClient struct{}
+
+func (f *failingHTTPClient) Do(*http.Request) (*http.Response, error) {
+	return nil, errors.New("connection refused")
+}
@@ -0,0 +1,130 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/trustbloc/edv/pkg/logging"
+)
+
+// ErrQueueFull is returned by QueuedSink.Write when the entry was dropped because the sink's queue was full.
+var ErrQueueFull = errors.New("audit queue is full")
+
+// Metrics records the audit entries that are dropped. Its methods are called concurrently.
+type Metrics interface {
+	// AuditEntryDropped is called for each entry that the given sink's queue had no room for.
+	AuditEntryDropped(sink string)
+}
+
+// QueueOption configures a QueuedSink.
+type QueueOption func(q *QueuedSink)
+
+// WithMetrics has the queued sink record the entries that it drops with the given metrics.
+func WithMetrics(metrics Metrics) QueueOption {
+	return func(q *QueuedSink) {
+		q.metrics = metrics
+	}
+}
+
+// WithLogger has the queued sink log the entries that it fails to write with the given logger, instead of the
+// edge-core logger for the audit module.
+func WithLogger(logger logging.Logger) QueueOption {
+	return func(q *QueuedSink) {
+		q.logger = logger
+	}
+}
+
+// QueuedSink writes entries to another sink in a background goroutine, in the order they were recorded, so that a
+// slow sink doesn't hold up the requests being audited. Entries that come in while the queue is full are dropped.
+type QueuedSink struct {
+	name    string
+	sink    Sink
+	entries chan Entry
+	metrics Metrics
+	logger  logging.Logger
+	mutex   sync.RWMutex
+	closed  bool
+	stopped chan struct{}
+}
+
+// NewQueuedSink returns a new QueuedSink that writes to sink, with room for up to queueSize entries waiting to be
+// written. name identifies the sink in the dropped entry metrics and in the logs.
+func NewQueuedSink(name string, sink Sink, queueSize uint, opts ...QueueOption) *QueuedSink {
+	q := &QueuedSink{
+		name:    name,
+		sink:    sink,
+		entries: make(chan Entry, queueSize),
+		logger:  logger,
+		stopped: make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	go q.run()
+
+	return q
+}
+
+// Write queues a copy of the entry to be written to the sink. If the queue is full, or the sink has been shut down,
+// then the entry is dropped and ErrQueueFull is returned.
+func (q *QueuedSink) Write(entry *Entry) error {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	if !q.closed {
+		select {
+		case q.entries <- *entry:
+			return nil
+		default:
+		}
+	}
+
+	if q.metrics != nil {
+		q.metrics.AuditEntryDropped(q.name)
+	}
+
+	return ErrQueueFull
+}
+
+// Shutdown stops the sink from taking new entries and waits for the ones already queued to be written. If ctx is
+// done first, its error is returned.
+func (q *QueuedSink) Shutdown(ctx context.Context) error {
+	q.mutex.Lock()
+
+	if !q.closed {
+		q.closed = true
+		close(q.entries)
+	}
+
+	q.mutex.Unlock()
+
+	select {
+	case <-q.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *QueuedSink) run() {
+	defer close(q.stopped)
+
+	for entry := range q.entries {
+		entry := entry
+
+		if err := q.sink.Write(&entry); err != nil {
+			logging.WithCorrelationID(q.logger, entry.CorrelationID).Errorf(
+				"Failed to write audit entry %s for %s operation on vault %s to %s: %s", entry.ID, entry.Operation,
+				entry.VaultID, q.name, err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueuedSink(t *testing.T) {
+	t.Run("Entries are written in the background, in order", func(t *testing.T) {
+		sink := &blockingSink{}
+		queued := NewQueuedSink("test", sink, 10)
+
+		log := New(queued)
+
+		log.Record(&Entry{ID: "1", Operation: ReadDocumentOperation})
+		log.Record(&Entry{ID: "2", Operation: DeleteDocumentOperation})
+
+		require.NoError(t, queued.Shutdown(context.Background()))
+		require.Equal(t, []string{"1", "2"}, sink.ids())
+
+		// Entries recorded after the sink was shut down are dropped.
+		require.True(t, errors.Is(queued.Write(&Entry{ID: "3"}), ErrQueueFull))
+		require.NoError(t, queued.Shutdown(context.Background()))
+	})
+	t.Run("Entries are dropped while the queue is full", func(t *testing.T) {
+		sink := &blockingSink{unblock: make(chan struct{}), blocked: make(chan struct{})}
+		metrics := &mockMetrics{}
+		queued := NewQueuedSink("slow", sink, 1, WithMetrics(metrics))
+
+		require.NoError(t, queued.Write(&Entry{ID: "1"}))
+
+		// The first entry is being written, so the queue has room for one more.
+		<-sink.blocked
+
+		require.NoError(t, queued.Write(&Entry{ID: "2"}))
+		require.True(t, errors.Is(queued.Write(&Entry{ID: "3"}), ErrQueueFull))
+		require.Equal(t, 1, metrics.dropped["slow"])
+
+		close(sink.unblock)
+
+		require.NoError(t, queued.Shutdown(context.Background()))
+		require.Equal(t, []string{"1", "2"}, sink.ids())
+	})
+	t.Run("Shutdown stops waiting once the context is done", func(t *testing.T) {
+		sink := &blockingSink{unblock: make(chan struct{}), blocked: make(chan struct{})}
+		queued := NewQueuedSink("slow", sink, 1)
+
+		require.NoError(t, queued.Write(&Entry{ID: "1"}))
+
+		<-sink.blocked
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		require.True(t, errors.Is(queued.Shutdown(ctx), context.Canceled))
+
+		close(sink.unblock)
+
+		require.NoError(t, queued.Shutdown(context.Background()))
+	})
+	t.Run("Failures to write are logged", func(t *testing.T) {
+		sink := &mockSink{err: errors.New("sink unavailable")}
+		queued := NewQueuedSink("failing", sink, 1)
+
+		require.NoError(t, queued.Write(&Entry{ID: "1"}))
+		require.NoError(t, queued.Shutdown(context.Background()))
+		require.Len(t, sink.entries, 1)
+	})
+}
+
+// blockingSink is a sink that, if unblock is set, signals blocked and waits for unblock to be closed before writing
+// its first entry.
+type blockingSink struct {
+	mutex   sync.Mutex
+	entries []string
+	unblock chan struct{}
+	blocked chan struct{}
+}
+
+func (s *blockingSink) Write(entry *Entry) error {
+	if s.unblock != nil && len(s.ids()) == 0 {
+		close(s.blocked)
+		<-s.unblock
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.entries = append(s.entries, entry.ID)
+
+	return nil
+}
+
+func (s *blockingSink) ids() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]string(nil), s.entries...)
+}
+
+type mockMetrics struct {
+	dropped map[string]int
+}
+
+func (m *mockMetrics) AuditEntryDropped(sink string) {
+	if m.dropped == nil {
+		m.dropped = make(map[string]int)
+	}
+
+	m.dropped[sink]++
+}
@@ -0,0 +1,157 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+const (
+	// StoreName is the name of the store that Store keeps audit entries in.
+	StoreName = "audit"
+
+	// timeTagName tags every entry with its time, in Unix nanoseconds.
+	timeTagName = "AuditTime"
+	// vaultTagName tags entries for a vault with the vault's ID.
+	vaultTagName = "AuditVault"
+
+	queryPageSize = 100
+)
+
+// Query limits used by Store.
+const (
+	// DefaultQueryLimit is the number of entries returned by queries that don't set a limit.
+	DefaultQueryLimit = 100
+	// MaxQueryLimit is the maximum number of entries returned by a query.
+	MaxQueryLimit = 1000
+)
+
+// Store is a sink that keeps audit entries in a database so they can be queried. Entries are only ever added to it.
+type Store struct {
+	store storage.Store
+}
+
+// NewStore returns a new Store that keeps audit entries in the given provider.
+func NewStore(provider storage.Provider) (*Store, error) {
+	store, err := provider.OpenStore(StoreName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit store: %w", err)
+	}
+
+	err = provider.SetStoreConfig(StoreName, storage.StoreConfiguration{TagNames: []string{timeTagName, vaultTagName}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set audit store configuration: %w", err)
+	}
+
+	return &Store{store: store}, nil
+}
+
+// Write stores the entry.
+func (s *Store) Write(entry *Entry) error {
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+
+	tags := []storage.Tag{{Name: timeTagName, Value: strconv.FormatInt(entry.Time.UnixNano(), 10)}}
+
+	if entry.VaultID != "" {
+		tags = append(tags, storage.Tag{Name: vaultTagName, Value: entry.VaultID})
+	}
+
+	err = s.store.Put(entry.ID, entryBytes, tags...)
+	if err != nil {
+		return fmt.Errorf("failed to store audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// Query returns the entries selected by the query, newest first. At most DefaultQueryLimit entries are returned if
+// the query doesn't set a limit, and never more than MaxQueryLimit.
+func (s *Store) Query(query *Query) ([]Entry, error) {
+	expression := timeTagName
+	if query.VaultID != "" {
+		expression = vaultTagName + ":" + query.VaultID
+	}
+
+	entries, err := s.queryEntries(expression, query)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.After(entries[j].Time)
+	})
+
+	if limit := queryLimit(query); len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	return entries, nil
+}
+
+// queryEntries returns all the entries with the tag in the given expression that match the query, in no particular
+// order. The query's limit is ignored.
+func (s *Store) queryEntries(expression string, query *Query) ([]Entry, error) {
+	iterator, err := s.store.Query(expression, storage.WithPageSize(queryPageSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit store: %w", err)
+	}
+
+	defer storage.Close(iterator, logger)
+
+	var entries []Entry
+
+	more, err := iterator.Next()
+
+	for ; err == nil && more; more, err = iterator.Next() {
+		entryBytes, errValue := iterator.Value()
+		if errValue != nil {
+			return nil, fmt.Errorf("failed to get audit entry: %w", errValue)
+		}
+
+		var entry Entry
+
+		if errUnmarshal := json.Unmarshal(entryBytes, &entry); errUnmarshal != nil {
+			return nil, fmt.Errorf("failed to unmarshal audit entry: %w", errUnmarshal)
+		}
+
+		if matches(query, &entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate over audit entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+func matches(query *Query, entry *Entry) bool {
+	return (query.Actor == "" || entry.Actor == query.Actor) &&
+		(query.Operation == "" || entry.Operation == query.Operation) &&
+		(query.Since.IsZero() || !entry.Time.Before(query.Since)) &&
+		(query.Until.IsZero() || !entry.Time.After(query.Until))
+}
+
+func queryLimit(query *Query) int {
+	switch {
+	case query.Limit <= 0:
+		return DefaultQueryLimit
+	case query.Limit > MaxQueryLimit:
+		return MaxQueryLimit
+	default:
+		return query.Limit
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	store, err := NewStore(mem.NewProvider())
+	require.NoError(t, err)
+
+	start := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	entries := []*Entry{
+		{Actor: "did:example:alice", Operation: CreateVaultOperation, VaultID: "vault1"},
+		{Actor: "did:example:alice", Operation: CreateDocumentOperation, VaultID: "vault1", DocumentID: "doc1"},
+		{Actor: "did:example:bob", Operation: ReadDocumentOperation, VaultID: "vault1", DocumentID: "doc1"},
+		{Actor: "did:example:bob", Operation: CreateVaultOperation, VaultID: "vault2"},
+		{Operation: CreateVaultOperation},
+	}
+
+	for i, entry := range entries {
+		entry.ID = string(rune('a' + i))
+		entry.Time = start.Add(time.Duration(i) * time.Minute)
+
+		require.NoError(t, store.Write(entry))
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		ids   []string
+	}{
+		{"All entries, newest first", Query{}, []string{"e", "d", "c", "b", "a"}},
+		{"By vault", Query{VaultID: "vault1"}, []string{"c", "b", "a"}},
+		{"By actor", Query{Actor: "did:example:bob"}, []string{"d", "c"}},
+		{"By operation", Query{Operation: CreateVaultOperation}, []string{"e", "d", "a"}},
+		{"By time", Query{Since: start.Add(time.Minute), Until: start.Add(3 * time.Minute)}, []string{"d", "c", "b"}},
+		{"With a limit", Query{VaultID: "vault1", Limit: 2}, []string{"c", "b"}},
+		{"No matches", Query{VaultID: "vault3"}, nil},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			found, err := store.Query(&test.query)
+			require.NoError(t, err)
+
+			var ids []string
+			for _, entry := range found {
+				ids = append(ids, entry.ID)
+			}
+
+			require.Equal(t, test.ids, ids)
+		})
+	}
+}
+
+func TestNewStore(t *testing.T) {
+	t.Run("Fail to open store", func(t *testing.T) {
+		_, err := NewStore(&mockstorage.MockStoreProvider{ErrOpenStoreHandle: errors.New("open error")})
+		require.EqualError(t, err, "failed to open audit store: open error")
+	})
+	t.Run("Fail to set store configuration", func(t *testing.T) {
+		_, err := NewStore(&mockstorage.MockStoreProvider{
+			Store:             &mockstorage.MockStore{Store: make(map[string]mockstorage.DBEntry)},
+			ErrSetStoreConfig: errors.New("config error"),
+		})
+		require.EqualError(t, err, "failed to set audit store configuration: config error")
+	})
+}
+
+func TestStore_Query(t *testing.T) {
+	t.Run("Fail to query", func(t *testing.T) {
+		store, err := NewStore(&mockstorage.MockStoreProvider{Store: &mockstorage.MockStore{
+			Store: make(map[string]mockstorage.DBEntry), ErrQuery: errors.New("query error"),
+		}})
+		require.NoError(t, err)
+
+		_, err = store.Query(&Query{})
+		require.EqualError(t, err, "failed to query audit store: query error")
+	})
+}
+
+func TestQueryLimit(t *testing.T) {
+	require.Equal(t, DefaultQueryLimit, queryLimit(&Query{}))
+	require.Equal(t, 5, queryLimit(&Query{Limit: 5}))
+	require.Equal(t, MaxQueryLimit, queryLimit(&Query{Limit: MaxQueryLimit + 1}))
+}
@@ -0,0 +1,52 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+)
+
+// SyslogSink is a sink that sends each entry to a syslog daemon as a JSON message, with the authpriv facility.
+type SyslogSink struct {
+	writer *syslog.Writer
+}
+
+// NewSyslogSink returns a new SyslogSink that connects to the syslog daemon at the given address over the given
+// network ("tcp" or "udp"), or to the local syslog daemon if the network is empty. Messages are tagged with tag.
+func NewSyslogSink(network, address, tag string) (*SyslogSink, error) {
+	writer, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_AUTHPRIV, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+
+	return &SyslogSink{writer: writer}, nil
+}
+
+// Write sends the entry to syslog.
+func (s *SyslogSink) Write(entry *Entry) error {
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+
+	err = s.writer.Info(string(entryBytes))
+	if err != nil {
+		return fmt.Errorf("failed to write audit entry to syslog: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the connection to syslog.
+func (s *SyslogSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,49 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyslogSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, conn.Close())
+	}()
+
+	sink, err := NewSyslogSink("udp", conn.LocalAddr().String(), "edv-audit")
+	require.NoError(t, err)
+
+	require.NoError(t, sink.Write(&Entry{ID: "1", Operation: ReadDocumentOperation, VaultID: "vault1"}))
+
+	buf := make([]byte, 1024)
+
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+
+	message := string(buf[:n])
+
+	// authpriv.info
+	require.True(t, strings.HasPrefix(message, "<86>"), message)
+	require.Contains(t, message, "edv-audit")
+	require.Contains(t, message, `"operation":"read-document"`)
+
+	require.NoError(t, sink.Close())
+
+	_, err = NewSyslogSink("invalid", "", "edv-audit")
+	require.Error(t, err)
+}
@@ -0,0 +1,30 @@
+//go:build windows || plan9
+// +build windows plan9
+
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import "errors"
+
+// SyslogSink is not supported on this platform.
+type SyslogSink struct{}
+
+// NewSyslogSink returns an error, since syslog isn't supported on this platform.
+func NewSyslogSink(_, _, _ string) (*SyslogSink, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
+
+// Write does nothing.
+func (s *SyslogSink) Write(*Entry) error {
+	return nil
+}
+
+// Close does nothing.
+func (s *SyslogSink) Close() error {
+	return nil
+}
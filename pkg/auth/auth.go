@@ -0,0 +1,229 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Mode is the way the requests to a route are authorized.
+type Mode string
+
+const (
+	// ModeZCAP authorizes requests with ZCAP-LD capability invocations.
+	ModeZCAP Mode = "zcap"
+	// ModeBearer authorizes requests with bearer access tokens issued by an OAuth2 or GNAP authorization server.
+	ModeBearer Mode = "bearer"
+	// ModeBoth authorizes requests that have a bearer access token with it, and all other requests with ZCAP-LD.
+	ModeBoth Mode = "both"
+)
+
+// Routes that can be given their own Mode. Every route is for a vault, and is named after the first path segment
+// after the vault ID.
+const (
+	// RouteVault is the route for the vault itself: /encrypted-data-vaults/{vaultID}.
+	RouteVault = "vault"
+	// RouteDocuments is the route for the documents in a vault: /encrypted-data-vaults/{vaultID}/documents/...
+	RouteDocuments = "documents"
+	// RouteQuery is the route for querying a vault: /encrypted-data-vaults/{vaultID}/query.
+	RouteQuery = "query"
+	// RouteBatch is the route for batch operations in a vault: /encrypted-data-vaults/{vaultID}/batch/...
+	RouteBatch = "batch"
+	// RouteConfiguration is the route for the configuration of a vault:
+	// /encrypted-data-vaults/{vaultID}/configuration/...
+	RouteConfiguration = "configuration"
+	// RouteCapabilities is the route for delegating and revoking the capabilities of a vault:
+	// /encrypted-data-vaults/{vaultID}/capabilities/...
+	RouteCapabilities = "capabilities"
+	// RouteExport is the route for exporting a vault: /encrypted-data-vaults/{vaultID}/export.
+	RouteExport = "export"
+	// RouteAudit is the route for exporting the audit log of a vault: /encrypted-data-vaults/{vaultID}/audit.
+	RouteAudit = "audit"
+	// RouteIndexing is the route for the indexing status of a vault: /encrypted-data-vaults/{vaultID}/indexing.
+	RouteIndexing = "indexing"
+)
+
+// routeSubscriptions is the route of the deprecated subscription endpoints of a vault:
+// /encrypted-data-vaults/{vaultID}/subscriptions/... They change the vault's webhooks, which are part of its
+// configuration, so they're authorized like the RouteConfiguration route, and "subscriptions" is accepted as another
+// name for it in route modes.
+const routeSubscriptions = "subscriptions"
+
+// Authorization schemes that carry bearer access tokens. GNAP access tokens are sent with their own scheme.
+const (
+	bearerScheme = "Bearer "
+	gnapScheme   = "GNAP "
+)
+
+type actorContextKey struct{}
+
+// ErrAuthorizerNotConfigured is returned when a Mode requires an authorizer that wasn't given to the Router.
+var ErrAuthorizerNotConfigured = errors.New("authorizer not configured")
+
+// Authorizer authorizes the requests for a resource (vault). The returned handler checks the request and calls next
+// if the request is authorized. Otherwise, it writes the authorization failure to the response.
+type Authorizer interface {
+	Handler(resourceID string, req *http.Request, w http.ResponseWriter, next http.HandlerFunc) (http.HandlerFunc,
+		error)
+}
+
+// Router authorizes each request with the Authorizer for the Mode of the request's route.
+type Router struct {
+	zcap        Authorizer
+	bearer      Authorizer
+	defaultMode Mode
+	routeModes  map[string]Mode
+}
+
+// NewRouter returns a new Router. Routes that aren't in routeModes use defaultMode. zcap and bearer may be nil if
+// none of the modes need them.
+func NewRouter(zcap, bearer Authorizer, defaultMode Mode, routeModes map[string]Mode) (*Router, error) {
+	modes := []Mode{defaultMode}
+	for _, mode := range routeModes {
+		modes = append(modes, mode)
+	}
+
+	for _, mode := range modes {
+		switch mode {
+		case ModeZCAP:
+			if zcap == nil {
+				return nil, fmt.Errorf("%w: %s mode needs a ZCAP-LD authorizer", ErrAuthorizerNotConfigured, mode)
+			}
+		case ModeBearer:
+			if bearer == nil {
+				return nil, fmt.Errorf("%w: %s mode needs a bearer token authorizer", ErrAuthorizerNotConfigured, mode)
+			}
+		case ModeBoth:
+			if zcap == nil || bearer == nil {
+				return nil, fmt.Errorf("%w: %s mode needs both a ZCAP-LD and a bearer token authorizer",
+					ErrAuthorizerNotConfigured, mode)
+			}
+		default:
+			return nil, fmt.Errorf("unknown authorization mode %q", mode)
+		}
+	}
+
+	return &Router{zcap: zcap, bearer: bearer, defaultMode: defaultMode, routeModes: routeModes}, nil
+}
+
+// Handler returns the handler of the Authorizer for the Mode of the request's route.
+func (r *Router) Handler(resourceID string, req *http.Request, w http.ResponseWriter,
+	next http.HandlerFunc) (http.HandlerFunc, error) {
+	mode, ok := r.routeModes[route(req)]
+	if !ok {
+		mode = r.defaultMode
+	}
+
+	if mode == ModeBearer || (mode == ModeBoth && BearerToken(req) != "") {
+		return r.bearer.Handler(resourceID, req, w, next)
+	}
+
+	return r.zcap.Handler(resourceID, req, w, next)
+}
+
+// ParseMode returns the Mode with the given name.
+func ParseMode(name string) (Mode, error) {
+	switch mode := Mode(name); mode {
+	case ModeZCAP, ModeBearer, ModeBoth:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown authorization mode %q, must be one of [%s] [%s] [%s]", name,
+			ModeZCAP, ModeBearer, ModeBoth)
+	}
+}
+
+// ParseRouteModes parses a comma-separated list of route=mode pairs, for example "documents=bearer,query=both".
+func ParseRouteModes(routeModesCSV string) (map[string]Mode, error) {
+	routeModes := make(map[string]Mode)
+
+	for _, routeMode := range strings.Split(routeModesCSV, ",") {
+		routeMode = strings.TrimSpace(routeMode)
+		if routeMode == "" {
+			continue
+		}
+
+		separator := strings.Index(routeMode, "=")
+		if separator < 0 {
+			return nil, fmt.Errorf("invalid route mode %q, must be in the form route=mode", routeMode)
+		}
+
+		routeName, modeName := strings.TrimSpace(routeMode[:separator]), routeMode[separator+1:]
+
+		if routeName == routeSubscriptions {
+			routeName = RouteConfiguration
+		}
+
+		switch routeName {
+		case RouteVault, RouteDocuments, RouteQuery, RouteBatch, RouteConfiguration, RouteCapabilities, RouteExport,
+			RouteAudit, RouteIndexing:
+		default:
+			return nil, fmt.Errorf("unknown route %q, must be one of [%s] [%s] [%s] [%s] [%s] [%s] [%s] [%s] [%s]",
+				routeName, RouteVault, RouteDocuments, RouteQuery, RouteBatch, RouteConfiguration, RouteCapabilities,
+				RouteExport, RouteAudit, RouteIndexing)
+		}
+
+		mode, err := ParseMode(strings.TrimSpace(modeName))
+		if err != nil {
+			return nil, err
+		}
+
+		routeModes[routeName] = mode
+	}
+
+	return routeModes, nil
+}
+
+// BearerToken returns the access token in the request's Authorization header if it uses the Bearer or GNAP scheme.
+// Otherwise, an empty string is returned.
+func BearerToken(req *http.Request) string {
+	authorization := req.Header.Get("Authorization")
+
+	for _, scheme := range []string{bearerScheme, gnapScheme} {
+		if len(authorization) > len(scheme) && strings.EqualFold(authorization[:len(scheme)], scheme) {
+			return strings.TrimSpace(authorization[len(scheme):])
+		}
+	}
+
+	return ""
+}
+
+// IsRead returns whether the request only reads from the vault, in which case it needs read rather than write access.
+func IsRead(req *http.Request) bool {
+	return req.Method == http.MethodGet || req.Method == http.MethodHead
+}
+
+// WithActor returns a copy of ctx that carries the actor of an authorized request: the invoker of the capability for
+// ZCAP-LD, or the subject of the access token for bearer tokens. Authorizers call it before passing the request on.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// Actor returns the actor of the authorized request that ctx belongs to, or an empty string if the request wasn't
+// authorized or its authorizer doesn't know who made it.
+func Actor(ctx context.Context) string {
+	actor, _ := ctx.Value(actorContextKey{}).(string)
+
+	return actor
+}
+
+// route returns the name of the route that the request is for, based on the path segment after the vault ID.
+func route(req *http.Request) string {
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+
+	switch {
+	case len(segments) < 3 || segments[2] == "":
+		return RouteVault
+	case segments[2] == routeSubscriptions:
+		return RouteConfiguration
+	default:
+		return segments[2]
+	}
+}
@@ -0,0 +1,170 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRouter(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		_, err := NewRouter(&mockAuthorizer{}, nil, ModeZCAP, nil)
+		require.NoError(t, err)
+	})
+	t.Run("bearer authorizer missing", func(t *testing.T) {
+		_, err := NewRouter(&mockAuthorizer{}, nil, ModeZCAP, map[string]Mode{RouteQuery: ModeBoth})
+		require.True(t, errors.Is(err, ErrAuthorizerNotConfigured))
+	})
+	t.Run("ZCAP-LD authorizer missing", func(t *testing.T) {
+		_, err := NewRouter(nil, &mockAuthorizer{}, ModeZCAP, nil)
+		require.True(t, errors.Is(err, ErrAuthorizerNotConfigured))
+
+		_, err = NewRouter(nil, nil, ModeBearer, nil)
+		require.True(t, errors.Is(err, ErrAuthorizerNotConfigured))
+	})
+	t.Run("unknown mode", func(t *testing.T) {
+		_, err := NewRouter(&mockAuthorizer{}, &mockAuthorizer{}, "oidc", nil)
+		require.EqualError(t, err, `unknown authorization mode "oidc"`)
+	})
+}
+
+func TestRouter_Handler(t *testing.T) {
+	zcap := &mockAuthorizer{}
+	bearer := &mockAuthorizer{}
+
+	router, err := NewRouter(zcap, bearer, ModeZCAP, map[string]Mode{
+		RouteDocuments:     ModeBearer,
+		RouteQuery:         ModeBoth,
+		RouteConfiguration: ModeBearer,
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		expected      *mockAuthorizer
+	}{
+		{name: "vault uses the default mode", path: "/encrypted-data-vaults/vault1", expected: zcap},
+		{name: "documents use bearer tokens", path: "/encrypted-data-vaults/vault1/documents/doc1", expected: bearer},
+		{
+			name: "query with a bearer token", path: "/encrypted-data-vaults/vault1/query",
+			authorization: "Bearer token1", expected: bearer,
+		},
+		{
+			name: "query with a GNAP token", path: "/encrypted-data-vaults/vault1/query",
+			authorization: "GNAP token1", expected: bearer,
+		},
+		{
+			name: "query with an HTTP signature", path: "/encrypted-data-vaults/vault1/query",
+			authorization: `Signature keyId="key1"`, expected: zcap,
+		},
+		{
+			name: "subscriptions are authorized like the configuration",
+			path: "/encrypted-data-vaults/vault1/subscriptions/subscription1", expected: bearer,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			zcap.calls, bearer.calls = 0, 0
+
+			req := httptest.NewRequest(http.MethodPost, tc.path, nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+
+			_, err := router.Handler("vault1", req, httptest.NewRecorder(), nil)
+			require.NoError(t, err)
+			require.Equal(t, 1, tc.expected.calls)
+			require.Equal(t, 1, zcap.calls+bearer.calls)
+		})
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	mode, err := ParseMode("both")
+	require.NoError(t, err)
+	require.Equal(t, ModeBoth, mode)
+
+	_, err = ParseMode("oidc")
+	require.EqualError(t, err, `unknown authorization mode "oidc", must be one of [zcap] [bearer] [both]`)
+}
+
+func TestParseRouteModes(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		routeModes, err := ParseRouteModes(" documents=bearer, query = both,capabilities=zcap,audit=bearer")
+		require.NoError(t, err)
+		require.Equal(t, map[string]Mode{
+			RouteDocuments: ModeBearer, RouteQuery: ModeBoth, RouteCapabilities: ModeZCAP, RouteAudit: ModeBearer,
+		}, routeModes)
+
+		routeModes, err = ParseRouteModes("subscriptions=bearer")
+		require.NoError(t, err)
+		require.Equal(t, map[string]Mode{RouteConfiguration: ModeBearer}, routeModes)
+
+		routeModes, err = ParseRouteModes("")
+		require.NoError(t, err)
+		require.Empty(t, routeModes)
+	})
+	t.Run("missing mode", func(t *testing.T) {
+		_, err := ParseRouteModes("documents")
+		require.EqualError(t, err, `invalid route mode "documents", must be in the form route=mode`)
+	})
+	t.Run("unknown route", func(t *testing.T) {
+		_, err := ParseRouteModes("admin=bearer")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `unknown route "admin"`)
+	})
+	t.Run("unknown mode", func(t *testing.T) {
+		_, err := ParseRouteModes("documents=oidc")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `unknown authorization mode "oidc"`)
+	})
+}
+
+func TestBearerToken(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	require.Empty(t, BearerToken(req))
+
+	req.Header.Set("Authorization", "bearer token1")
+	require.Equal(t, "token1", BearerToken(req))
+
+	req.Header.Set("Authorization", "Bearer ")
+	require.Empty(t, BearerToken(req))
+}
+
+func TestIsRead(t *testing.T) {
+	for method, isRead := range map[string]bool{
+		http.MethodGet: true, http.MethodHead: true, http.MethodPost: false, http.MethodPatch: false,
+		http.MethodDelete: false,
+	} {
+		require.Equal(t, isRead, IsRead(httptest.NewRequest(method, "/", nil)), method)
+	}
+}
+
+func TestActor(t *testing.T) {
+	require.Empty(t, Actor(context.Background()))
+	require.Equal(t, "did:example:alice", Actor(WithActor(context.Background(), "did:example:alice")))
+}
+
+type mockAuthorizer struct {
+	calls int
+}
+
+func (m *mockAuthorizer) Handler(string, *http.Request, http.ResponseWriter, http.HandlerFunc) (http.HandlerFunc,
+	error) {
+	m.calls++
+
+	return func(http.ResponseWriter, *http.Request) {}, nil
+}
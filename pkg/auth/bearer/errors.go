@@ -0,0 +1,109 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bearer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/trustbloc/edv/pkg/logging"
+)
+
+var (
+	// ErrInvalidIssuer is returned when the issuer URL or introspection endpoint given to New isn't an absolute
+	// http(s) URL.
+	ErrInvalidIssuer = errors.New("issuer and introspection endpoint must be absolute http or https URLs")
+	// ErrScopeNotVaultBound is returned when a scope given to New doesn't contain VaultIDPlaceholder, which would
+	// let a token with the scope access every vault.
+	ErrScopeNotVaultBound = errors.New("scopes must contain " + VaultIDPlaceholder)
+	// ErrTokenMissing is returned when a request doesn't have a bearer access token.
+	ErrTokenMissing = errors.New("access token missing")
+	// ErrTokenInvalid is returned when the authorization server reports that a request's access token isn't active,
+	// or the token was issued by another authorization server or has expired.
+	ErrTokenInvalid = errors.New("access token is invalid")
+	// ErrInsufficientScope is returned when a valid access token doesn't have the scope needed for the request.
+	ErrInsufficientScope = errors.New("access token doesn't have the required scope")
+)
+
+// Error codes used in ErrorResponse. Apart from ErrorCodeTokenMissing and ErrorCodeInternal, they're the error
+// codes defined by RFC 6750, which are also sent in the WWW-Authenticate header.
+const (
+	ErrorCodeTokenMissing      = "token_missing"
+	ErrorCodeInvalidToken      = "invalid_token"
+	ErrorCodeInsufficientScope = "insufficient_scope"
+	ErrorCodeInternal          = "internal_error"
+)
+
+// ErrorResponse is the body of the responses sent when a request fails authorization.
+type ErrorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	// CorrelationID is the correlation ID of the request (see logging.Middleware), if it has one, so that the failure
+	// can be found in the server's logs.
+	CorrelationID string `json:"correlationID,omitempty"`
+}
+
+// HTTPStatus returns the HTTP status code to use for the given authorization error.
+func HTTPStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrTokenMissing), errors.Is(err, ErrTokenInvalid):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrInsufficientScope):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// WriteError writes the given authorization error to w as an ErrorResponse, using the status code from HTTPStatus.
+// Responses with a 401 or 403 status code get a WWW-Authenticate header as described in RFC 6750.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(logging.FromContext(r.Context(), logger), w, r, err)
+}
+
+func writeError(logger logging.Logger, w http.ResponseWriter, r *http.Request, err error) {
+	statusCode := HTTPStatus(err)
+
+	logger.Infof("Request failed authorization with status code %d: %s", statusCode, err)
+
+	responseBytes, errMarshal := json.Marshal(ErrorResponse{
+		Error: errorCode(err), Message: err.Error(), CorrelationID: logging.CorrelationID(r.Context()),
+	})
+	if errMarshal != nil {
+		logger.Errorf("Failed to marshal authorization error response: %s", errMarshal)
+	}
+
+	switch {
+	case errors.Is(err, ErrTokenMissing):
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	case errors.Is(err, ErrTokenInvalid), errors.Is(err, ErrInsufficientScope):
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer error=%q", errorCode(err)))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	_, errWrite := w.Write(responseBytes)
+	if errWrite != nil {
+		logger.Errorf(errWrite.Error())
+	}
+}
+
+func errorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrTokenMissing):
+		return ErrorCodeTokenMissing
+	case errors.Is(err, ErrTokenInvalid):
+		return ErrorCodeInvalidToken
+	case errors.Is(err, ErrInsufficientScope):
+		return ErrorCodeInsufficientScope
+	default:
+		return ErrorCodeInternal
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bearer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/logging"
+)
+
+func TestHTTPStatus(t *testing.T) {
+	require.Equal(t, http.StatusUnauthorized, HTTPStatus(ErrTokenMissing))
+	require.Equal(t, http.StatusUnauthorized, HTTPStatus(fmt.Errorf("wrapped: %w", ErrTokenInvalid)))
+	require.Equal(t, http.StatusForbidden, HTTPStatus(fmt.Errorf("wrapped: %w", ErrInsufficientScope)))
+	require.Equal(t, http.StatusInternalServerError, HTTPStatus(errors.New("introspection failure")))
+}
+
+func TestWriteError(t *testing.T) {
+	t.Run("missing token", func(t *testing.T) {
+		responseRecorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+
+		WriteError(responseRecorder, request, ErrTokenMissing)
+
+		require.Equal(t, http.StatusUnauthorized, responseRecorder.Code)
+		require.Equal(t, "Bearer", responseRecorder.Header().Get("WWW-Authenticate"))
+
+		var errorResponse ErrorResponse
+
+		require.NoError(t, json.Unmarshal(responseRecorder.Body.Bytes(), &errorResponse))
+		require.Equal(t, ErrorResponse{Error: ErrorCodeTokenMissing, Message: "access token missing"}, errorResponse)
+	})
+
+	t.Run("insufficient scope", func(t *testing.T) {
+		responseRecorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+
+		WriteError(responseRecorder, request, fmt.Errorf("%w: edv:write", ErrInsufficientScope))
+
+		require.Equal(t, http.StatusForbidden, responseRecorder.Code)
+		require.Equal(t, "application/json", responseRecorder.Header().Get("Content-Type"))
+		require.Equal(t, `Bearer error="insufficient_scope"`, responseRecorder.Header().Get("WWW-Authenticate"))
+
+		var errorResponse ErrorResponse
+
+		require.NoError(t, json.Unmarshal(responseRecorder.Body.Bytes(), &errorResponse))
+		require.Equal(t, ErrorCodeInsufficientScope, errorResponse.Error)
+	})
+
+	t.Run("untyped error", func(t *testing.T) {
+		responseRecorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+
+		WriteError(responseRecorder, request, errors.New("introspection failure"))
+
+		require.Equal(t, http.StatusInternalServerError, responseRecorder.Code)
+		require.Empty(t, responseRecorder.Header().Get("WWW-Authenticate"))
+
+		var errorResponse ErrorResponse
+
+		require.NoError(t, json.Unmarshal(responseRecorder.Body.Bytes(), &errorResponse))
+		require.Equal(t, ErrorResponse{Error: ErrorCodeInternal, Message: "introspection failure"}, errorResponse)
+	})
+
+	t.Run("correlation ID", func(t *testing.T) {
+		responseRecorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request = request.WithContext(logging.NewContext(request.Context(), "correlation-1"))
+
+		WriteError(responseRecorder, request, ErrTokenMissing)
+
+		var errorResponse ErrorResponse
+
+		require.NoError(t, json.Unmarshal(responseRecorder.Body.Bytes(), &errorResponse))
+		require.Equal(t, "correlation-1", errorResponse.CorrelationID)
+	})
+}
@@ -0,0 +1,252 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bearer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/logging"
+)
+
+const (
+	// DefaultReadScope is the scope that an access token needs to read from a vault, unless set with WithScopes.
+	DefaultReadScope = "edv:read:" + VaultIDPlaceholder
+	// DefaultWriteScope is the scope that an access token needs to write to a vault, unless set with WithScopes.
+	DefaultWriteScope = "edv:write:" + VaultIDPlaceholder
+	// VaultIDPlaceholder is replaced with the ID of the vault being accessed in the scopes, so that a token is only
+	// valid for the vaults it was issued for. Every scope must contain it.
+	VaultIDPlaceholder = "{vaultID}"
+
+	introspectionPath     = "/introspect"
+	defaultRequestTimeout = 10 * time.Second
+)
+
+var logger = logging.New("auth-bearer-service")
+
+type httpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Option configures the service.
+type Option func(s *Service)
+
+// WithHTTPClient sets the HTTP client used to call the authorization server's introspection endpoint.
+func WithHTTPClient(client httpClient) Option {
+	return func(s *Service) {
+		s.httpClient = client
+	}
+}
+
+// WithIntrospectionEndpoint sets the URL of the authorization server's token introspection endpoint.
+// It defaults to the issuer URL followed by /introspect.
+func WithIntrospectionEndpoint(endpoint string) Option {
+	return func(s *Service) {
+		s.introspectionEndpoint = endpoint
+	}
+}
+
+// WithClientCredentials sets the credentials that the service authenticates itself with to the introspection
+// endpoint, using HTTP basic authentication. By default, no credentials are sent.
+func WithClientCredentials(clientID, clientSecret string) Option {
+	return func(s *Service) {
+		s.clientID = clientID
+		s.clientSecret = clientSecret
+	}
+}
+
+// WithScopes sets the scopes that an access token needs to read from and write to a vault. Both scopes must contain
+// VaultIDPlaceholder. Empty scopes are ignored.
+func WithScopes(readScope, writeScope string) Option {
+	return func(s *Service) {
+		if readScope != "" {
+			s.readScope = readScope
+		}
+
+		if writeScope != "" {
+			s.writeScope = writeScope
+		}
+	}
+}
+
+// WithLogger has the service log with the given logger instead of the edge-core logger for its module.
+func WithLogger(logger logging.Logger) Option {
+	return func(s *Service) {
+		s.logger = logger
+	}
+}
+
+// Service authorizes requests with bearer access tokens issued by an OAuth2 or GNAP authorization server.
+// Tokens are validated with the authorization server's token introspection endpoint (RFC 7662) on every request.
+// GET requests need the read scope, and all other requests need the write scope.
+type Service struct {
+	issuer                string
+	introspectionEndpoint string
+	clientID              string
+	clientSecret          string
+	readScope             string
+	writeScope            string
+	httpClient            httpClient
+	logger                logging.Logger
+}
+
+// introspectionResponse is the part of an RFC 7662 introspection response that the service uses.
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope"`
+	Issuer    string `json:"iss"`
+	ExpiresAt int64  `json:"exp"`
+	Subject   string `json:"sub"`
+	ClientID  string `json:"client_id"`
+}
+
+// New returns a new service that accepts access tokens issued by the authorization server with the given issuer URL.
+func New(issuer string, opts ...Option) (*Service, error) {
+	s := &Service{
+		issuer:                issuer,
+		introspectionEndpoint: strings.TrimSuffix(issuer, "/") + introspectionPath,
+		readScope:             DefaultReadScope,
+		writeScope:            DefaultWriteScope,
+		httpClient:            &http.Client{Timeout: defaultRequestTimeout},
+		logger:                logger,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	for _, rawURL := range []string{s.issuer, s.introspectionEndpoint} {
+		parsedURL, err := url.Parse(rawURL)
+		if err != nil || !parsedURL.IsAbs() || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidIssuer, rawURL)
+		}
+	}
+
+	for _, scope := range []string{s.readScope, s.writeScope} {
+		if !strings.Contains(scope, VaultIDPlaceholder) {
+			return nil, fmt.Errorf("%w: %s", ErrScopeNotVaultBound, scope)
+		}
+	}
+
+	return s, nil
+}
+
+// Handler returns a handler that checks the request's access token before calling next.
+// Authorization failures are written as an ErrorResponse, with a 401 or 403 status code (see HTTPStatus).
+// Authorized requests are passed to next with the subject of their access token as their actor (see auth.Actor),
+// or with the client it was issued to if the token has no subject.
+func (s *Service) Handler(resourceID string, _ *http.Request, _ http.ResponseWriter,
+	next http.HandlerFunc) (http.HandlerFunc, error) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		introspection, err := s.authorize(resourceID, r)
+		if err != nil {
+			writeError(logging.FromContext(r.Context(), s.logger), w, r, err)
+
+			return
+		}
+
+		actor := introspection.Subject
+		if actor == "" {
+			actor = introspection.ClientID
+		}
+
+		next(w, r.WithContext(auth.WithActor(r.Context(), actor)))
+	}, nil
+}
+
+func (s *Service) authorize(resourceID string, req *http.Request) (*introspectionResponse, error) {
+	token := auth.BearerToken(req)
+	if token == "" {
+		return nil, ErrTokenMissing
+	}
+
+	introspection, err := s.introspect(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if !introspection.Active {
+		return nil, fmt.Errorf("%w: token is not active", ErrTokenInvalid)
+	}
+
+	// The issuer and expiry are optional in introspection responses, so they're only checked if they're there.
+	if introspection.Issuer != "" && introspection.Issuer != s.issuer {
+		return nil, fmt.Errorf("%w: token was issued by %s", ErrTokenInvalid, introspection.Issuer)
+	}
+
+	if introspection.ExpiresAt != 0 && time.Now().Unix() >= introspection.ExpiresAt {
+		return nil, fmt.Errorf("%w: token has expired", ErrTokenInvalid)
+	}
+
+	requiredScope := s.writeScope
+	if auth.IsRead(req) {
+		requiredScope = s.readScope
+	}
+
+	requiredScope = strings.ReplaceAll(requiredScope, VaultIDPlaceholder, resourceID)
+
+	for _, scope := range strings.Fields(introspection.Scope) {
+		if scope == requiredScope {
+			return introspection, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrInsufficientScope, requiredScope)
+}
+
+func (s *Service) introspect(token string) (*introspectionResponse, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+
+	req, err := http.NewRequest(http.MethodPost, s.introspectionEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create introspection request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	if s.clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(s.clientID), url.QueryEscape(s.clientSecret))
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send introspection request: %w", err)
+	}
+
+	defer func() {
+		errClose := resp.Body.Close()
+		if errClose != nil {
+			s.logger.Warnf("Failed to close response body from %s: %s", s.introspectionEndpoint, errClose)
+		}
+	}()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read introspection response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection endpoint %s responded with status code %d: %s",
+			s.introspectionEndpoint, resp.StatusCode, body)
+	}
+
+	var introspection introspectionResponse
+
+	err = json.Unmarshal(body, &introspection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal introspection response: %w", err)
+	}
+
+	return &introspection, nil
+}
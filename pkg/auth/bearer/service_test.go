@@ -0,0 +1,225 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bearer
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/auth"
+)
+
+const (
+	testIssuer  = "https://as.example.com"
+	testVaultID = "vault1"
+	testToken   = "token1"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		s, err := New(testIssuer + "/")
+		require.NoError(t, err)
+		require.Equal(t, testIssuer+"/introspect", s.introspectionEndpoint)
+	})
+	t.Run("invalid issuer", func(t *testing.T) {
+		_, err := New("as.example.com")
+		require.True(t, errors.Is(err, ErrInvalidIssuer))
+	})
+	t.Run("invalid introspection endpoint", func(t *testing.T) {
+		_, err := New(testIssuer, WithIntrospectionEndpoint("ftp://as.example.com/introspect"))
+		require.True(t, errors.Is(err, ErrInvalidIssuer))
+	})
+	t.Run("scopes not bound to a vault", func(t *testing.T) {
+		_, err := New(testIssuer, WithScopes("edv:read", ""))
+		require.True(t, errors.Is(err, ErrScopeNotVaultBound))
+
+		_, err = New(testIssuer, WithScopes("", "edv:write"))
+		require.True(t, errors.Is(err, ErrScopeNotVaultBound))
+	})
+}
+
+func TestService_Handler(t *testing.T) {
+	t.Run("authorized read and write", func(t *testing.T) {
+		s := newTestService(t, &introspectionResponse{
+			Active: true, Scope: "edv:read:vault1 edv:write:vault1", Issuer: testIssuer,
+		})
+
+		require.Equal(t, http.StatusOK, serve(t, s, http.MethodGet, "Bearer "+testToken).Code)
+		require.Equal(t, http.StatusOK, serve(t, s, http.MethodPost, "GNAP "+testToken).Code)
+	})
+	t.Run("the token's subject is the actor", func(t *testing.T) {
+		for response, actor := range map[*introspectionResponse]string{
+			{Active: true, Scope: "edv:read:vault1", Subject: "alice", ClientID: "wallet"}: "alice",
+			{Active: true, Scope: "edv:read:vault1", ClientID: "wallet"}:                   "wallet",
+		} {
+			s := newTestService(t, response)
+
+			req := httptest.NewRequest(http.MethodGet, "/encrypted-data-vaults/"+testVaultID+"/documents", nil)
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			var requestActor string
+
+			handler, err := s.Handler(testVaultID, req, nil, func(_ http.ResponseWriter, r *http.Request) {
+				requestActor = auth.Actor(r.Context())
+			})
+			require.NoError(t, err)
+
+			handler(httptest.NewRecorder(), req)
+			require.Equal(t, actor, requestActor)
+		}
+	})
+	t.Run("scopes of other vaults", func(t *testing.T) {
+		s := newTestService(t, &introspectionResponse{Active: true, Scope: "edv:read:vault2 edv:write:vault2"})
+
+		require.Equal(t, http.StatusForbidden, serve(t, s, http.MethodGet, "Bearer "+testToken).Code)
+		require.Equal(t, http.StatusForbidden, serve(t, s, http.MethodPost, "Bearer "+testToken).Code)
+	})
+	t.Run("custom scopes", func(t *testing.T) {
+		s := newTestService(t, &introspectionResponse{Active: true, Scope: "vault1.read"},
+			WithScopes("{vaultID}.read", "{vaultID}.write"))
+
+		require.Equal(t, http.StatusOK, serve(t, s, http.MethodGet, "Bearer "+testToken).Code)
+		require.Equal(t, http.StatusOK, serve(t, s, http.MethodHead, "Bearer "+testToken).Code)
+		require.Equal(t, http.StatusForbidden, serve(t, s, http.MethodPost, "Bearer "+testToken).Code)
+	})
+	t.Run("client credentials are sent to the introspection endpoint", func(t *testing.T) {
+		var clientID, clientSecret, token string
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			clientID, clientSecret, _ = r.BasicAuth()
+			token = r.FormValue("token")
+
+			require.NoError(t, json.NewEncoder(w).Encode(&introspectionResponse{Active: true, Scope: "edv:read:vault1"}))
+		}))
+		defer srv.Close()
+
+		s, err := New(testIssuer, WithIntrospectionEndpoint(srv.URL), WithClientCredentials("edv", "secret"))
+		require.NoError(t, err)
+
+		require.Equal(t, http.StatusOK, serve(t, s, http.MethodGet, "Bearer "+testToken).Code)
+		require.Equal(t, "edv", clientID)
+		require.Equal(t, "secret", clientSecret)
+		require.Equal(t, testToken, token)
+	})
+	t.Run("missing token", func(t *testing.T) {
+		s := newTestService(t, &introspectionResponse{Active: true, Scope: "edv:read:vault1"})
+
+		require.Equal(t, http.StatusUnauthorized, serve(t, s, http.MethodGet, "").Code)
+		require.Equal(t, http.StatusUnauthorized, serve(t, s, http.MethodGet, "Signature keyId=\"key1\"").Code)
+	})
+	t.Run("inactive token", func(t *testing.T) {
+		s := newTestService(t, &introspectionResponse{Active: false})
+
+		rr := serve(t, s, http.MethodGet, "Bearer "+testToken)
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+		require.Contains(t, rr.Body.String(), "token is not active")
+	})
+	t.Run("token from another issuer", func(t *testing.T) {
+		s := newTestService(t, &introspectionResponse{Active: true, Scope: "edv:read:vault1", Issuer: "https://other"})
+
+		rr := serve(t, s, http.MethodGet, "Bearer "+testToken)
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+		require.Contains(t, rr.Body.String(), "token was issued by https://other")
+	})
+	t.Run("expired token", func(t *testing.T) {
+		s := newTestService(t, &introspectionResponse{
+			Active: true, Scope: "edv:read:vault1", ExpiresAt: time.Now().Add(-time.Minute).Unix(),
+		})
+
+		rr := serve(t, s, http.MethodGet, "Bearer "+testToken)
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+		require.Contains(t, rr.Body.String(), "token has expired")
+	})
+	t.Run("missing scope", func(t *testing.T) {
+		s := newTestService(t, &introspectionResponse{Active: true, Scope: "edv:read:vault1"})
+
+		rr := serve(t, s, http.MethodPost, "Bearer "+testToken)
+		require.Equal(t, http.StatusForbidden, rr.Code)
+		require.Contains(t, rr.Body.String(), "edv:write:vault1")
+	})
+	t.Run("introspection endpoint fails", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+
+		s, err := New(testIssuer, WithIntrospectionEndpoint(srv.URL))
+		require.NoError(t, err)
+
+		rr := serve(t, s, http.MethodGet, "Bearer "+testToken)
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Contains(t, rr.Body.String(), "responded with status code 503")
+	})
+	t.Run("invalid introspection response", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, errWrite := w.Write([]byte("not JSON"))
+			require.NoError(t, errWrite)
+		}))
+		defer srv.Close()
+
+		s, err := New(testIssuer, WithIntrospectionEndpoint(srv.URL))
+		require.NoError(t, err)
+
+		rr := serve(t, s, http.MethodGet, "Bearer "+testToken)
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Contains(t, rr.Body.String(), "failed to unmarshal introspection response")
+	})
+	t.Run("introspection endpoint unreachable", func(t *testing.T) {
+		s, err := New(testIssuer, WithHTTPClient(&failingHTTPClient{}))
+		require.NoError(t, err)
+
+		rr := serve(t, s, http.MethodGet, "Bearer "+testToken)
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Contains(t, rr.Body.String(), "failed to send introspection request")
+	})
+}
+
+func newTestService(t *testing.T, response *introspectionResponse, opts ...Option) *Service {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewEncoder(w).Encode(response))
+	}))
+	t.Cleanup(srv.Close)
+
+	s, err := New(testIssuer, append([]Option{WithIntrospectionEndpoint(srv.URL)}, opts...)...)
+	require.NoError(t, err)
+
+	return s
+}
+
+func serve(t *testing.T, s *Service, method, authorization string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, "/encrypted-data-vaults/"+testVaultID+"/documents", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	rr := httptest.NewRecorder()
+
+	handler, err := s.Handler(testVaultID, req, rr, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	require.NoError(t, err)
+
+	handler(rr, req)
+
+	return rr
+}
+
+type failingHTTPClient struct{}
+
+func (c *failingHTTPClient) Do(*http.Request) (*http.Response, error) {
+	return nil, errors.New("connection refused")
+}
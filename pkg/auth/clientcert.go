@@ -0,0 +1,115 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auth
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/trustbloc/edv/pkg/logging"
+)
+
+// ErrorCodeClientCertificateMismatch is the error code of the responses sent when a request fails the client
+// certificate binding (see BindClientCertificates).
+const ErrorCodeClientCertificateMismatch = "client_certificate_mismatch"
+
+// ErrClientCertificateMismatch is returned when an authorized request wasn't made with a client certificate bound to
+// its actor.
+var ErrClientCertificateMismatch = errors.New("client certificate isn't bound to the actor of the request")
+
+var logger = logging.New("auth")
+
+// clientCertificateErrorResponse is the body of the responses sent when a request fails the client certificate
+// binding. It has the same shape as the error responses of the authorizers.
+type clientCertificateErrorResponse struct {
+	Error         string `json:"error"`
+	Message       string `json:"message"`
+	CorrelationID string `json:"correlationID,omitempty"`
+}
+
+// BindClientCertificates returns a handler that only passes authorized requests on to next if they were made over
+// mutual TLS with a client certificate that has their actor (see Actor) as one of its URI subject alternative names.
+// An actor that is a DID URL, such as the verification method that invoked a capability, is also matched by its DID.
+// This binds the capabilities and access tokens of clients to their client certificates, so that a stolen capability
+// can't be invoked by anyone else. Requests that weren't authorized aren't checked. Requests that fail the binding
+// are rejected with a 403 status code, and logged with the given logger, or the edge-core logger for the auth module
+// if it's nil.
+func BindClientCertificates(next http.Handler, bindingLogger logging.Logger) http.Handler {
+	if bindingLogger == nil {
+		bindingLogger = logger
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor := Actor(r.Context())
+		if actor == "" {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			writeClientCertificateError(bindingLogger, w, r,
+				fmt.Errorf("%w: no client certificate was given", ErrClientCertificateMismatch))
+
+			return
+		}
+
+		if !certificateNames(r.TLS.PeerCertificates[0], actor) {
+			writeClientCertificateError(bindingLogger, w, r, fmt.Errorf(
+				"%w: %s isn't a URI subject alternative name of the client certificate", ErrClientCertificateMismatch, actor))
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// certificateNames returns whether one of the URI subject alternative names of the certificate is the actor, or the
+// DID of the actor if it's a DID URL.
+func certificateNames(certificate *x509.Certificate, actor string) bool {
+	did := actor
+
+	if i := strings.Index(actor, "#"); i >= 0 {
+		did = actor[:i]
+	}
+
+	for _, uri := range certificate.URIs {
+		if name := uri.String(); name == actor || name == did {
+			return true
+		}
+	}
+
+	return false
+}
+
+func writeClientCertificateError(logger logging.Logger, w http.ResponseWriter, r *http.Request, err error) {
+	logger = logging.FromContext(r.Context(), logger)
+
+	logger.Infof("Request failed client certificate binding: %s", err)
+
+	responseBytes, errMarshal := json.Marshal(clientCertificateErrorResponse{
+		Error:         ErrorCodeClientCertificateMismatch,
+		Message:       err.Error(),
+		CorrelationID: logging.CorrelationID(r.Context()),
+	})
+	if errMarshal != nil {
+		logger.Errorf("Failed to marshal client certificate error response: %s", errMarshal)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+
+	_, errWrite := w.Write(responseBytes)
+	if errWrite != nil {
+		logger.Errorf(errWrite.Error())
+	}
+}
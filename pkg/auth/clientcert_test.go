@@ -0,0 +1,63 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindClientCertificates(t *testing.T) {
+	certificate := &x509.Certificate{URIs: []*url.URL{{Scheme: "did", Opaque: "example:alice"}}}
+
+	handler := BindClientCertificates(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), nil)
+
+	for _, tc := range []struct {
+		name         string
+		actor        string
+		certificates []*x509.Certificate
+		expected     int
+	}{
+		{name: "Actor is the DID of the certificate", actor: "did:example:alice", certificates: []*x509.Certificate{
+			certificate,
+		}, expected: http.StatusOK},
+		{name: "Actor is a DID URL of the certificate", actor: "did:example:alice#key1",
+			certificates: []*x509.Certificate{certificate}, expected: http.StatusOK},
+		{name: "Unauthorized requests aren't checked", expected: http.StatusOK},
+		{name: "Actor isn't in the certificate", actor: "did:example:bob", certificates: []*x509.Certificate{
+			certificate,
+		}, expected: http.StatusForbidden},
+		{name: "No certificate", actor: "did:example:alice", expected: http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", nil)
+			req.TLS = &tls.ConnectionState{PeerCertificates: tc.certificates}
+
+			if tc.actor != "" {
+				req = req.WithContext(WithActor(req.Context(), tc.actor))
+			}
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+			require.Equal(t, tc.expected, rw.Code)
+
+			if tc.expected == http.StatusForbidden {
+				var response clientCertificateErrorResponse
+
+				require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &response))
+				require.Equal(t, ErrorCodeClientCertificateMismatch, response.Error)
+			}
+		})
+	}
+}
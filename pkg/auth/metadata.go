@@ -0,0 +1,86 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auth
+
+import (
+	"sort"
+	"strings"
+)
+
+// ProtectedResourceMetadataPath is the well-known path that the metadata of the EDV server as an OAuth 2.0 protected
+// resource is served at (RFC 9728).
+const ProtectedResourceMetadataPath = "/.well-known/oauth-protected-resource"
+
+// defaultRouteModeKey is the key of the default Mode in ProtectedResourceMetadata.AuthModes.
+const defaultRouteModeKey = "default"
+
+// ProtectedResourceMetadata describes how requests to the EDV server's vaults are authorized, so that authorization
+// servers and clients can configure themselves against it. The fields are those of RFC 9728, along with the
+// authorization modes of the EDV server's routes.
+type ProtectedResourceMetadata struct {
+	// Resource is the URL that identifies the EDV server. If it's empty, then it's taken from the URL that the
+	// metadata is requested at.
+	Resource string `json:"resource"`
+	// AuthorizationServers are the issuer URLs of the authorization servers that issue bearer access tokens. Clients
+	// find their token endpoints in their own metadata (RFC 8414).
+	AuthorizationServers   []string `json:"authorization_servers,omitempty"`
+	BearerMethodsSupported []string `json:"bearer_methods_supported,omitempty"`
+	ScopesSupported        []string `json:"scopes_supported,omitempty"`
+	// AuthorizationSchemesSupported are the schemes that access tokens can be sent with in the Authorization header.
+	AuthorizationSchemesSupported []string `json:"authorization_schemes_supported,omitempty"`
+	// AuthModes maps each route whose Mode was set to its Mode, and "default" to the Mode of all other routes.
+	AuthModes map[string]Mode `json:"edv_auth_modes"`
+}
+
+// NewProtectedResourceMetadata returns the metadata of an EDV server whose routes are authorized with the given modes,
+// as given to NewRouter. issuer and scopes are the ones that bearer access tokens are validated with, and are left out
+// if no route uses bearer tokens. VaultIDPlaceholder is left in the scopes that have it.
+func NewProtectedResourceMetadata(resource string, defaultMode Mode, routeModes map[string]Mode, issuer string,
+	scopes ...string) *ProtectedResourceMetadata {
+	metadata := &ProtectedResourceMetadata{
+		Resource:  resource,
+		AuthModes: map[string]Mode{defaultRouteModeKey: defaultMode},
+	}
+
+	usesBearerTokens := defaultMode != ModeZCAP
+
+	for route, mode := range routeModes {
+		metadata.AuthModes[route] = mode
+
+		usesBearerTokens = usesBearerTokens || mode != ModeZCAP
+	}
+
+	if usesBearerTokens {
+		metadata.AuthorizationServers = []string{issuer}
+		metadata.BearerMethodsSupported = []string{"header"}
+		metadata.AuthorizationSchemesSupported = []string{strings.TrimSpace(bearerScheme), strings.TrimSpace(gnapScheme)}
+		metadata.ScopesSupported = uniqueScopes(scopes)
+	}
+
+	return metadata
+}
+
+// uniqueScopes returns the non-empty scopes without duplicates, sorted.
+func uniqueScopes(scopes []string) []string {
+	seen := make(map[string]bool, len(scopes))
+
+	var unique []string
+
+	for _, scope := range scopes {
+		if scope == "" || seen[scope] {
+			continue
+		}
+
+		seen[scope] = true
+
+		unique = append(unique, scope)
+	}
+
+	sort.Strings(unique)
+
+	return unique
+}
@@ -0,0 +1,46 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProtectedResourceMetadata(t *testing.T) {
+	t.Run("ZCAP-LD only", func(t *testing.T) {
+		metadata := NewProtectedResourceMetadata("https://edv.example.com", ModeZCAP,
+			map[string]Mode{RouteQuery: ModeZCAP}, "https://as.example.com", "edv:read", "edv:write")
+
+		require.Equal(t, &ProtectedResourceMetadata{
+			Resource:  "https://edv.example.com",
+			AuthModes: map[string]Mode{"default": ModeZCAP, RouteQuery: ModeZCAP},
+		}, metadata)
+	})
+	t.Run("Bearer tokens", func(t *testing.T) {
+		metadata := NewProtectedResourceMetadata("https://edv.example.com", ModeBoth, nil, "https://as.example.com",
+			"edv:write:{vaultID}", "", "edv:read", "edv:write:{vaultID}")
+
+		require.Equal(t, &ProtectedResourceMetadata{
+			Resource:                      "https://edv.example.com",
+			AuthorizationServers:          []string{"https://as.example.com"},
+			BearerMethodsSupported:        []string{"header"},
+			ScopesSupported:               []string{"edv:read", "edv:write:{vaultID}"},
+			AuthorizationSchemesSupported: []string{"Bearer", "GNAP"},
+			AuthModes:                     map[string]Mode{"default": ModeBoth},
+		}, metadata)
+	})
+	t.Run("Bearer tokens for some routes", func(t *testing.T) {
+		metadata := NewProtectedResourceMetadata("", ModeZCAP, map[string]Mode{RouteDocuments: ModeBearer},
+			"https://as.example.com")
+
+		require.Equal(t, []string{"https://as.example.com"}, metadata.AuthorizationServers)
+		require.Empty(t, metadata.ScopesSupported)
+		require.Equal(t, map[string]Mode{"default": ModeZCAP, RouteDocuments: ModeBearer}, metadata.AuthModes)
+	})
+}
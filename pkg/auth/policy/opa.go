@@ -0,0 +1,114 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const defaultRequestTimeout = 5 * time.Second
+
+type httpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// OPAOption configures an OPA decider.
+type OPAOption func(o *OPA)
+
+// WithHTTPClient sets the HTTP client used to call the policy decision point.
+func WithHTTPClient(client httpClient) OPAOption {
+	return func(o *OPA) {
+		o.httpClient = client
+	}
+}
+
+// OPA is a Decider that asks an external policy decision point through the Data API of Open Policy Agent: the input
+// is sent in a POST request to the URL of a boolean rule, such as http://localhost:8181/v1/data/edv/authz/allow, and
+// the request is allowed if the rule's result is true. A rule that's undefined for the input denies the request.
+type OPA struct {
+	decisionURL string
+	httpClient  httpClient
+}
+
+// opaRequest is the body of the requests sent to the Data API.
+type opaRequest struct {
+	Input *Input `json:"input"`
+}
+
+// opaResponse is the body of the Data API's responses. Result is missing if the rule is undefined for the input.
+type opaResponse struct {
+	Result *bool `json:"result"`
+}
+
+// NewOPA returns a new OPA decider that gets its decisions from the rule at the given URL.
+func NewOPA(decisionURL string, opts ...OPAOption) (*OPA, error) {
+	parsedURL, err := url.Parse(decisionURL)
+	if err != nil || !parsedURL.IsAbs() || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+		return nil, fmt.Errorf("policy decision URL must be an absolute http or https URL: %q", decisionURL)
+	}
+
+	o := &OPA{decisionURL: decisionURL, httpClient: &http.Client{Timeout: defaultRequestTimeout}}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o, nil
+}
+
+// Decide returns whether the policy decision point allows the request with the given input.
+func (o *OPA) Decide(ctx context.Context, input *Input) (bool, error) {
+	requestBytes, err := json.Marshal(opaRequest{Input: input})
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal policy input: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.decisionURL, bytes.NewReader(requestBytes))
+	if err != nil {
+		return false, fmt.Errorf("failed to create policy decision request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to send policy decision request: %w", err)
+	}
+
+	defer func() {
+		errClose := resp.Body.Close()
+		if errClose != nil {
+			logger.Warnf("Failed to close policy decision response body: %s", errClose)
+		}
+	}()
+
+	responseBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, fmt.Errorf("failed to read policy decision response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("policy decision point responded with status code %d: %s", resp.StatusCode,
+			responseBytes)
+	}
+
+	var response opaResponse
+
+	err = json.Unmarshal(responseBytes, &response)
+	if err != nil {
+		return false, fmt.Errorf("failed to unmarshal policy decision response: %w", err)
+	}
+
+	return response.Result != nil && *response.Result, nil
+}
@@ -0,0 +1,103 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type failingHTTPClient struct{}
+
+func (f *failingHTTPClient) Do(*http.Request) (*http.Response, error) {
+	return nil, errors.New("request error")
+}
+
+func TestNewOPA(t *testing.T) {
+	_, err := NewOPA("localhost:8181/v1/data/edv/allow")
+	require.EqualError(t, err,
+		`policy decision URL must be an absolute http or https URL: "localhost:8181/v1/data/edv/allow"`)
+}
+
+func TestOPA_Decide(t *testing.T) {
+	input := &Input{Action: ActionRead, VaultID: "vault1", Invoker: "did:example:alice"}
+
+	t.Run("Decision is the result of the rule", func(t *testing.T) {
+		for _, tc := range []struct {
+			response string
+			expected bool
+		}{
+			{response: `{"result": true}`, expected: true},
+			{response: `{"result": false}`, expected: false},
+			{response: `{}`, expected: false},
+		} {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "/v1/data/edv/allow", r.URL.Path)
+
+				body, err := ioutil.ReadAll(r.Body)
+				require.NoError(t, err)
+
+				var request opaRequest
+
+				require.NoError(t, json.Unmarshal(body, &request))
+				require.Equal(t, input, request.Input)
+
+				_, err = fmt.Fprint(w, tc.response)
+				require.NoError(t, err)
+			}))
+
+			opa, err := NewOPA(srv.URL + "/v1/data/edv/allow")
+			require.NoError(t, err)
+
+			allowed, err := opa.Decide(context.Background(), input)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, allowed, tc.response)
+
+			srv.Close()
+		}
+	})
+	t.Run("Policy decision point fails", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer srv.Close()
+
+		opa, err := NewOPA(srv.URL)
+		require.NoError(t, err)
+
+		_, err = opa.Decide(context.Background(), input)
+		require.EqualError(t, err, "policy decision point responded with status code 500: ")
+	})
+	t.Run("Result isn't a boolean", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, err := fmt.Fprint(w, `{"result": {"allow": true}}`)
+			require.NoError(t, err)
+		}))
+		defer srv.Close()
+
+		opa, err := NewOPA(srv.URL)
+		require.NoError(t, err)
+
+		_, err = opa.Decide(context.Background(), input)
+		require.Contains(t, err.Error(), "failed to unmarshal policy decision response")
+	})
+	t.Run("Fail to send request", func(t *testing.T) {
+		opa, err := NewOPA("https://example.com/v1/data/edv/allow", WithHTTPClient(&failingHTTPClient{}))
+		require.NoError(t, err)
+
+		_, err = opa.Decide(context.Background(), input)
+		require.EqualError(t, err, "failed to send policy decision request: request error")
+	})
+}
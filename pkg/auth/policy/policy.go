@@ -0,0 +1,211 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package policy combines the authorization of requests to vaults with the decisions of a policy engine, such as
+// Open Policy Agent, so that enterprises can apply their centralized policies on top of ZCAP-LD and bearer tokens.
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/logging"
+)
+
+// Error codes of the responses sent when a request isn't allowed by the policy.
+const (
+	// ErrorCodePolicyDenied is sent with a 403 status code when the policy denies a request.
+	ErrorCodePolicyDenied = "policy_denied"
+	// ErrorCodePolicyUnavailable is sent with a 503 status code when the policy decision couldn't be made.
+	ErrorCodePolicyUnavailable = "policy_unavailable"
+)
+
+// Actions that a request can take on a vault. They match the ZCAP-LD actions that the request needs.
+const (
+	ActionRead  = "read"
+	ActionWrite = "write"
+)
+
+// ErrDenied is returned when the policy denies a request.
+var ErrDenied = errors.New("request denied by policy")
+
+var logger = logging.New("auth-policy")
+
+// Input is the attributes of a request that the policy decides on.
+type Input struct {
+	// Action is ActionRead for requests that only read from the vault, and ActionWrite for all others.
+	Action string `json:"action"`
+	// Route is the route of the request, as named for auth-route-modes (see auth.RouteVault and the others).
+	Route   string `json:"route"`
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	VaultID string `json:"vaultID"`
+	// Invoker is the actor of the request (see auth.Actor): the invoker of the capability for ZCAP-LD, or the subject
+	// of the access token for bearer tokens.
+	Invoker string `json:"invoker"`
+	// Tenant is the ID of the tenant that the vault is bound to in multi-tenant mode, and is empty otherwise.
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// Decider decides whether requests are allowed. It's called concurrently. Programs that embed the EDV server can
+// implement it with an embedded policy engine, for example OPA's rego package.
+type Decider interface {
+	Decide(ctx context.Context, input *Input) (bool, error)
+}
+
+// TenantSource looks up the tenant that a vault is bound to. It returns an empty string if the vault isn't bound to
+// one.
+type TenantSource interface {
+	VaultTenant(vaultID string) (string, error)
+}
+
+// Option configures the enforcer.
+type Option func(e *Enforcer)
+
+// WithTenants has the enforcer look up the tenant of each request's vault, so that the policy can decide on it.
+func WithTenants(tenants TenantSource) Option {
+	return func(e *Enforcer) {
+		e.tenants = tenants
+	}
+}
+
+// WithLogger has the enforcer log with the given logger instead of the edge-core logger for its module.
+func WithLogger(logger logging.Logger) Option {
+	return func(e *Enforcer) {
+		e.logger = logger
+	}
+}
+
+// Enforcer asks a Decider whether the authorized requests to vaults are allowed.
+type Enforcer struct {
+	decider Decider
+	tenants TenantSource
+	logger  logging.Logger
+}
+
+// New returns a new enforcer that asks decider whether requests are allowed.
+func New(decider Decider, opts ...Option) *Enforcer {
+	e := &Enforcer{decider: decider, logger: logger}
+
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return e
+}
+
+// errorResponse is the body of the responses sent when a request isn't allowed by the policy. It has the same shape
+// as the error responses of the authorizers.
+type errorResponse struct {
+	Error         string `json:"error"`
+	Message       string `json:"message"`
+	CorrelationID string `json:"correlationID,omitempty"`
+}
+
+// Middleware returns a handler that only passes authorized requests on to next if the policy allows them too, so that
+// a request has to be allowed both by its capability or access token and by the policy. Requests that weren't
+// authorized, such as the ones that create vaults, aren't checked. Requests that the policy denies are rejected with
+// a 403 status code, and ones that it couldn't decide on with a 503 status code.
+func (e *Enforcer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor := auth.Actor(r.Context())
+		if actor == "" {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		logger := logging.FromContext(r.Context(), e.logger)
+
+		allowed, err := e.decide(r, actor)
+		if err != nil {
+			logger.Errorf("Failed to get policy decision for %s request to %s: %s", r.Method, r.URL.Path, err)
+
+			writeError(logger, w, r, http.StatusServiceUnavailable, ErrorCodePolicyUnavailable, err)
+
+			return
+		}
+
+		if !allowed {
+			logger.Infof("Policy denied %s request to %s by %s", r.Method, r.URL.Path, actor)
+
+			writeError(logger, w, r, http.StatusForbidden, ErrorCodePolicyDenied, ErrDenied)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (e *Enforcer) decide(r *http.Request, actor string) (bool, error) {
+	input := &Input{
+		Action:  ActionWrite,
+		Route:   route(r),
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		VaultID: vaultID(r),
+		Invoker: actor,
+	}
+
+	if auth.IsRead(r) {
+		input.Action = ActionRead
+	}
+
+	if e.tenants != nil {
+		tenant, err := e.tenants.VaultTenant(input.VaultID)
+		if err != nil {
+			return false, fmt.Errorf("failed to get tenant of vault: %w", err)
+		}
+
+		input.Tenant = tenant
+	}
+
+	return e.decider.Decide(r.Context(), input)
+}
+
+// vaultID returns the ID of the vault that the request is for.
+func vaultID(r *http.Request) string {
+	segments := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	if len(segments) < 2 {
+		return ""
+	}
+
+	return segments[1]
+}
+
+// route returns the name of the request's route, which is the first path segment after the vault ID.
+func route(r *http.Request) string {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	if len(segments) < 3 || segments[2] == "" {
+		return auth.RouteVault
+	}
+
+	return segments[2]
+}
+
+func writeError(logger logging.Logger, w http.ResponseWriter, r *http.Request, status int, code string, err error) {
+	responseBytes, errMarshal := json.Marshal(errorResponse{
+		Error: code, Message: err.Error(), CorrelationID: logging.CorrelationID(r.Context()),
+	})
+	if errMarshal != nil {
+		logger.Errorf("Failed to marshal policy error response: %s", errMarshal)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	_, errWrite := w.Write(responseBytes)
+	if errWrite != nil {
+		logger.Errorf("Failed to write response: %s", errWrite)
+	}
+}
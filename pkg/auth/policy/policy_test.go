@@ -0,0 +1,148 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/logging"
+)
+
+type recordingDecider struct {
+	allowed bool
+	err     error
+	input   *Input
+}
+
+func (d *recordingDecider) Decide(_ context.Context, input *Input) (bool, error) {
+	d.input = input
+
+	return d.allowed, d.err
+}
+
+type mockTenantSource struct {
+	tenant string
+	err    error
+}
+
+func (m *mockTenantSource) VaultTenant(string) (string, error) {
+	return m.tenant, m.err
+}
+
+func TestEnforcer_Middleware(t *testing.T) {
+	t.Run("Requests allowed by the policy are passed on", func(t *testing.T) {
+		decider := &recordingDecider{allowed: true}
+
+		rw := serve(New(decider, WithTenants(&mockTenantSource{tenant: "tenant1"})), http.MethodGet,
+			"/encrypted-data-vaults/vault1/documents/doc1", "did:example:alice")
+		require.Equal(t, http.StatusOK, rw.Code)
+		require.Equal(t, &Input{
+			Action: ActionRead, Route: auth.RouteDocuments, Method: http.MethodGet,
+			Path: "/encrypted-data-vaults/vault1/documents/doc1", VaultID: "vault1", Invoker: "did:example:alice",
+			Tenant: "tenant1",
+		}, decider.input)
+
+		rw = serve(New(decider), http.MethodPost, "/encrypted-data-vaults/vault1", "did:example:alice")
+		require.Equal(t, http.StatusOK, rw.Code)
+		require.Equal(t, ActionWrite, decider.input.Action)
+		require.Equal(t, auth.RouteVault, decider.input.Route)
+		require.Empty(t, decider.input.Tenant)
+	})
+	t.Run("Unauthorized requests aren't checked", func(t *testing.T) {
+		decider := &recordingDecider{}
+
+		rw := serve(New(decider), http.MethodPost, "/encrypted-data-vaults", "")
+		require.Equal(t, http.StatusOK, rw.Code)
+		require.Nil(t, decider.input)
+	})
+	t.Run("Requests denied by the policy", func(t *testing.T) {
+		rw := serve(New(&recordingDecider{}), http.MethodPost, "/encrypted-data-vaults/vault1/query",
+			"did:example:alice")
+		requireErrorResponse(t, rw, http.StatusForbidden, ErrorCodePolicyDenied)
+	})
+	t.Run("Fail to get decision", func(t *testing.T) {
+		rw := serve(New(&recordingDecider{allowed: true, err: errors.New("decision error")}), http.MethodGet,
+			"/encrypted-data-vaults/vault1/documents/doc1", "did:example:alice")
+		requireErrorResponse(t, rw, http.StatusServiceUnavailable, ErrorCodePolicyUnavailable)
+	})
+	t.Run("Fail to get tenant", func(t *testing.T) {
+		enforcer := New(&recordingDecider{allowed: true},
+			WithTenants(&mockTenantSource{err: errors.New("tenant error")}))
+
+		rw := serve(enforcer, http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", "did:example:alice")
+		requireErrorResponse(t, rw, http.StatusServiceUnavailable, ErrorCodePolicyUnavailable)
+	})
+	t.Run("Denials are logged and responded to with the request's correlation ID", func(t *testing.T) {
+		logger := &recordingLogger{}
+
+		req := httptest.NewRequest(http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", nil)
+		req = req.WithContext(logging.NewContext(auth.WithActor(req.Context(), "did:example:alice"), "correlation-1"))
+
+		rw := httptest.NewRecorder()
+
+		New(&recordingDecider{}, WithLogger(logger)).Middleware(
+			http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(rw, req)
+		requireErrorResponse(t, rw, http.StatusForbidden, ErrorCodePolicyDenied)
+
+		var response errorResponse
+
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &response))
+		require.Equal(t, "correlation-1", response.CorrelationID)
+		require.Len(t, logger.lines, 1)
+		require.Contains(t, logger.lines[0], "[correlationID=correlation-1] Policy denied")
+	})
+}
+
+func serve(enforcer *Enforcer, method, path, actor string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+
+	if actor != "" {
+		req = req.WithContext(auth.WithActor(req.Context(), actor))
+	}
+
+	rw := httptest.NewRecorder()
+
+	enforcer.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(rw, req)
+
+	return rw
+}
+
+func requireErrorResponse(t *testing.T, rw *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+
+	require.Equal(t, status, rw.Code)
+
+	var response errorResponse
+
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &response))
+	require.Equal(t, code, response.Error)
+}
+
+// recordingLogger records the lines that it logs.
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) log(msg string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(msg, args...))
+}
+
+func (l *recordingLogger) Panicf(msg string, args ...interface{}) { l.log(msg, args...) }
+func (l *recordingLogger) Fatalf(msg string, args ...interface{}) { l.log(msg, args...) }
+func (l *recordingLogger) Errorf(msg string, args ...interface{}) { l.log(msg, args...) }
+func (l *recordingLogger) Warnf(msg string, args ...interface{})  { l.log(msg, args...) }
+func (l *recordingLogger) Infof(msg string, args ...interface{})  { l.log(msg, args...) }
+func (l *recordingLogger) Debugf(msg string, args ...interface{}) { l.log(msg, args...) }
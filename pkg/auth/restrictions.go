@@ -0,0 +1,70 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auth
+
+import (
+	"context"
+)
+
+// Operations on a vault that Restrictions can allow.
+const (
+	// OperationRead reads from the vault without changing it: reading, checking and listing documents, and exporting
+	// the vault or its audit log.
+	OperationRead = "read"
+	// OperationQuery queries the documents of the vault, or counts the documents that match a query.
+	OperationQuery = "query"
+	// OperationWrite changes the vault, its documents, its configuration or its capabilities.
+	OperationWrite = "write"
+)
+
+type restrictionsContextKey struct{}
+
+// Attribute is an encrypted index attribute: the name and value of one of the indexed attributes of documents, as
+// they're sent to the EDV server.
+type Attribute struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Restrictions restrict what an authorized request may do in a vault, on top of what its authorizer checked.
+// Authorizers only know which vault a request is for, so they attach the restrictions to the request with
+// WithRestrictions, and leave them to the EDV operations to enforce.
+type Restrictions struct {
+	// Operations, if not nil, are the only operations that the request may perform. An empty list allows none.
+	Operations []string
+	// Attributes, if not empty, restrict the request to the documents that are indexed with all of these attributes.
+	Attributes []Attribute
+}
+
+// AllowsOperation returns whether the restrictions allow the given operation. Nil restrictions allow everything.
+func (r *Restrictions) AllowsOperation(operation string) bool {
+	if r == nil || r.Operations == nil {
+		return true
+	}
+
+	for _, allowed := range r.Operations {
+		if allowed == operation {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WithRestrictions returns a copy of ctx that carries the restrictions of an authorized request. Authorizers call it
+// before passing the request on. Requests without restrictions may perform any operation that their route allows.
+func WithRestrictions(ctx context.Context, restrictions *Restrictions) context.Context {
+	return context.WithValue(ctx, restrictionsContextKey{}, restrictions)
+}
+
+// RestrictionsFrom returns the restrictions of the authorized request that ctx belongs to, or nil if the request
+// isn't restricted.
+func RestrictionsFrom(ctx context.Context) *Restrictions {
+	restrictions, _ := ctx.Value(restrictionsContextKey{}).(*Restrictions)
+
+	return restrictions
+}
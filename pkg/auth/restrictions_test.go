@@ -0,0 +1,38 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestrictions(t *testing.T) {
+	t.Run("Unrestricted requests", func(t *testing.T) {
+		require.Nil(t, RestrictionsFrom(context.Background()))
+
+		var restrictions *Restrictions
+
+		require.True(t, restrictions.AllowsOperation(OperationWrite))
+		require.True(t, (&Restrictions{}).AllowsOperation(OperationWrite))
+	})
+	t.Run("Restricted requests", func(t *testing.T) {
+		restrictions := &Restrictions{
+			Operations: []string{OperationRead, OperationQuery},
+			Attributes: []Attribute{{Name: "name", Value: "value"}},
+		}
+
+		require.Equal(t, restrictions, RestrictionsFrom(WithRestrictions(context.Background(), restrictions)))
+
+		require.True(t, restrictions.AllowsOperation(OperationRead))
+		require.True(t, restrictions.AllowsOperation(OperationQuery))
+		require.False(t, restrictions.AllowsOperation(OperationWrite))
+		require.False(t, (&Restrictions{Operations: []string{}}).AllowsOperation(OperationRead))
+	})
+}
@@ -0,0 +1,331 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package zcapld
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	ariesstorage "github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/trustbloc/edge-core/pkg/zcapld"
+)
+
+// rootCapabilityTagsKey marks a capability store whose root capabilities have all been tagged with
+// rootCapabilityTagName. Stores written to by earlier versions don't have it until TagRootCapabilities is called.
+const rootCapabilityTagsKey = "root_capability_tags"
+
+// RootCapability describes a stored root capability.
+type RootCapability struct {
+	ID       string `json:"id"`
+	Resource string `json:"resource"`
+}
+
+// RootCapabilities returns the stored root capabilities for the given resource.
+// If resourceID is empty, then the root capabilities for all resources are returned.
+// Root capabilities created before they were tagged with their resource aren't included until they're tagged by
+// TagRootCapabilities.
+func (s *Service) RootCapabilities(resourceID string) ([]RootCapability, error) {
+	expression := rootCapabilityTagName
+	if resourceID != "" {
+		expression = fmt.Sprintf("%s:%s", rootCapabilityTagName, resourceID)
+	}
+
+	itr, err := s.store.Query(expression)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query root capabilities: %w", err)
+	}
+
+	defer ariesstorage.Close(itr, s.log())
+
+	rootCapabilities := []RootCapability{}
+
+	moreEntries, err := itr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next entry from iterator: %w", err)
+	}
+
+	for moreEntries {
+		key, errKey := itr.Key()
+		if errKey != nil {
+			return nil, fmt.Errorf("failed to get key from iterator: %w", errKey)
+		}
+
+		tags, errTags := itr.Tags()
+		if errTags != nil {
+			return nil, fmt.Errorf("failed to get tags from iterator: %w", errTags)
+		}
+
+		for _, tag := range tags {
+			if tag.Name == rootCapabilityTagName {
+				rootCapabilities = append(rootCapabilities, RootCapability{ID: key, Resource: tag.Value})
+			}
+		}
+
+		moreEntries, err = itr.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get next entry from iterator: %w", err)
+		}
+	}
+
+	return rootCapabilities, nil
+}
+
+// TagRootCapabilities tags the root capabilities of the given resources that were created before root capabilities
+// were tagged with their resource, so that RootCapabilities and OrphanedRootCapabilities find them, and returns the
+// number of root capabilities tagged. Untagged root capabilities can only be found through the ID of their resource,
+// so the ones of resources that aren't given stay unknown. It only does anything the first time it's called.
+func (s *Service) TagRootCapabilities(resourceIDs []string) (int, error) {
+	_, err := s.store.Get(rootCapabilityTagsKey)
+	if err == nil {
+		return 0, nil
+	}
+
+	if !errors.Is(err, ariesstorage.ErrDataNotFound) {
+		return 0, fmt.Errorf("failed to get root capability tags marker: %w", err)
+	}
+
+	var tagged int
+
+	for _, resourceID := range resourceIDs {
+		wasTagged, errTag := s.tagRootCapability(resourceID)
+		if errTag != nil {
+			return tagged, errTag
+		}
+
+		if wasTagged {
+			tagged++
+		}
+	}
+
+	err = s.store.Put(rootCapabilityTagsKey, []byte("{}"))
+	if err != nil {
+		return tagged, fmt.Errorf("failed to store root capability tags marker: %w", err)
+	}
+
+	return tagged, nil
+}
+
+// tagRootCapability tags the root capability of the given resource, unless it's already tagged. It returns whether
+// the root capability was tagged. Resources without a root capability are skipped.
+func (s *Service) tagRootCapability(resourceID string) (bool, error) {
+	tags, err := s.store.GetTags(resourceID)
+	if errors.Is(err, ariesstorage.ErrDataNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to get tags of root capability for resource %s: %w", resourceID, err)
+	}
+
+	for _, tag := range tags {
+		if tag.Name == resourceTagName {
+			return false, nil
+		}
+	}
+
+	rootCapabilityBytes, err := s.store.Get(resourceID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get root capability for resource %s: %w", resourceID, err)
+	}
+
+	rootCapability, err := zcapld.ParseCapability(rootCapabilityBytes)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse root capability for resource %s: %w", resourceID, err)
+	}
+
+	resourceTag := ariesstorage.Tag{Name: resourceTagName, Value: resourceID}
+
+	err = s.store.Put(rootCapability.ID, rootCapabilityBytes,
+		ariesstorage.Tag{Name: rootCapabilityTagName, Value: resourceID}, resourceTag)
+	if err != nil {
+		return false, fmt.Errorf("failed to tag root capability for resource %s: %w", resourceID, err)
+	}
+
+	err = s.store.Put(resourceID, rootCapabilityBytes, resourceTag)
+	if err != nil {
+		return false, fmt.Errorf("failed to tag root capability for resource %s: %w", resourceID, err)
+	}
+
+	return true, nil
+}
+
+// OrphanedRootCapabilities returns the stored root capabilities whose resources no longer exist,
+// as determined by resourceExists.
+// Like RootCapabilities, it doesn't find untagged root capabilities (see TagRootCapabilities).
+func (s *Service) OrphanedRootCapabilities(
+	resourceExists func(resourceID string) (bool, error)) ([]RootCapability, error) {
+	rootCapabilities, err := s.RootCapabilities("")
+	if err != nil {
+		return nil, err
+	}
+
+	orphanedRootCapabilities := []RootCapability{}
+
+	for _, rootCapability := range rootCapabilities {
+		exists, err := resourceExists(rootCapability.Resource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine whether resource %s exists: %w", rootCapability.Resource, err)
+		}
+
+		if !exists {
+			orphanedRootCapabilities = append(orphanedRootCapabilities, rootCapability)
+		}
+	}
+
+	return orphanedRootCapabilities, nil
+}
+
+// DeleteCapabilities deletes the root capability for the given resource, along with every capability
+// that was delegated from it and the revocations of its capabilities. ErrCapabilityNotFound is returned if there
+// are no capabilities for the resource.
+func (s *Service) DeleteCapabilities(resourceID string) error {
+	keys, err := s.capabilityKeys(resourceID)
+	if err != nil {
+		return err
+	}
+
+	if len(keys) == 0 {
+		return fmt.Errorf("%w: no capabilities stored for resource %s", ErrCapabilityNotFound, resourceID)
+	}
+
+	for _, key := range keys {
+		err = s.store.Delete(key)
+		if err != nil {
+			return fmt.Errorf("failed to delete capability %s: %w", key, err)
+		}
+	}
+
+	s.log().Infof("Deleted %d capabilities for resource %s", len(keys), resourceID)
+
+	return nil
+}
+
+// capabilityKeys returns the keys of all the entries in the store for the given resource.
+func (s *Service) capabilityKeys(resourceID string) ([]string, error) {
+	itr, err := s.store.Query(fmt.Sprintf("%s:%s", resourceTagName, resourceID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query capabilities: %w", err)
+	}
+
+	defer ariesstorage.Close(itr, s.log())
+
+	keys := make(map[string]struct{})
+
+	moreEntries, err := itr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next entry from iterator: %w", err)
+	}
+
+	for moreEntries {
+		key, errKey := itr.Key()
+		if errKey != nil {
+			return nil, fmt.Errorf("failed to get key from iterator: %w", errKey)
+		}
+
+		keys[key] = struct{}{}
+
+		moreEntries, err = itr.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get next entry from iterator: %w", err)
+		}
+	}
+
+	// Root capabilities created before entries were tagged can still be found through the resource ID.
+	rootCapabilityBytes, err := s.store.Get(resourceID)
+	if err != nil && !errors.Is(err, ariesstorage.ErrDataNotFound) {
+		return nil, fmt.Errorf("failed to get root capability for resource %s: %w", resourceID, err)
+	}
+
+	if err == nil {
+		keys[resourceID] = struct{}{}
+
+		rootCapability, err := zcapld.ParseCapability(rootCapabilityBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse root capability for resource %s: %w", resourceID, err)
+		}
+
+		keys[rootCapability.ID] = struct{}{}
+	}
+
+	keyList := make([]string, 0, len(keys))
+	for key := range keys {
+		keyList = append(keyList, key)
+	}
+
+	return keyList, nil
+}
+
+// ExportCapabilities returns the stored capabilities for the given resource, so that they can be imported into
+// another EDV server with ImportCapabilities. The capabilities are returned as-is, including their proofs.
+// Revocations (see Service.Revoke) aren't exported.
+func (s *Service) ExportCapabilities(resourceID string) ([]json.RawMessage, error) {
+	keys, err := s.capabilityKeys(resourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	capabilities := make([]json.RawMessage, 0, len(keys))
+
+	for _, key := range keys {
+		// The root capability is stored under both its own ID and the resource ID. Only export it once.
+		if key == resourceID || strings.HasPrefix(key, revocationKeyPrefix) {
+			continue
+		}
+
+		capabilityBytes, err := s.store.Get(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get capability %s: %w", key, err)
+		}
+
+		capabilities = append(capabilities, capabilityBytes)
+	}
+
+	return capabilities, nil
+}
+
+// ImportCapabilities stores capabilities exported from another EDV server with ExportCapabilities.
+// Every capability must have the given resource (or one of its documents) as its invocation target. Existing
+// capabilities with the same IDs are overwritten.
+func (s *Service) ImportCapabilities(resourceID string, capabilities []json.RawMessage) error {
+	for _, capabilityBytes := range capabilities {
+		capability, err := zcapld.ParseCapability(capabilityBytes)
+		if err != nil {
+			return fmt.Errorf("%w: failed to parse capability: %s", ErrInvocationInvalid, err)
+		}
+
+		if checkResource(resourceID, capability) != nil {
+			return fmt.Errorf("%w: capability %s is for resource %s, not %s", ErrInvocationInvalid,
+				capability.ID, capability.InvocationTarget.ID, resourceID)
+		}
+
+		resourceTag := ariesstorage.Tag{Name: resourceTagName, Value: resourceID}
+
+		if capability.Parent != "" {
+			err = s.store.Put(capability.ID, capabilityBytes, resourceTag)
+			if err != nil {
+				return fmt.Errorf("failed to store capability: %w", err)
+			}
+
+			continue
+		}
+
+		err = s.store.Put(capability.ID, capabilityBytes,
+			ariesstorage.Tag{Name: rootCapabilityTagName, Value: resourceID}, resourceTag)
+		if err != nil {
+			return fmt.Errorf("failed to store root capability: %w", err)
+		}
+
+		err = s.store.Put(resourceID, capabilityBytes, resourceTag)
+		if err != nil {
+			return fmt.Errorf("failed to store root capability: %w", err)
+		}
+	}
+
+	return nil
+}
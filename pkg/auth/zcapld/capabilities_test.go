@@ -0,0 +1,347 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package zcapld
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mock"
+	mockcrypto "github.com/hyperledger/aries-framework-go/pkg/mock/crypto"
+	mockkms "github.com/hyperledger/aries-framework-go/pkg/mock/kms"
+	ariesstorage "github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/edge-core/pkg/zcapld"
+)
+
+func TestService_RootCapabilities(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t, "vault1", "vault2")
+
+		rootCapabilities, err := svc.RootCapabilities("")
+		require.NoError(t, err)
+		require.Len(t, rootCapabilities, 2)
+		require.ElementsMatch(t, []string{"vault1", "vault2"},
+			[]string{rootCapabilities[0].Resource, rootCapabilities[1].Resource})
+
+		rootCapabilities, err = svc.RootCapabilities("vault1")
+		require.NoError(t, err)
+		require.Len(t, rootCapabilities, 1)
+		require.Equal(t, "vault1", rootCapabilities[0].Resource)
+
+		rootCapability, err := svc.getCapability("vault1")
+		require.NoError(t, err)
+		require.Equal(t, rootCapability.ID, rootCapabilities[0].ID)
+
+		rootCapabilities, err = svc.RootCapabilities("vault3")
+		require.NoError(t, err)
+		require.Empty(t, rootCapabilities)
+	})
+	t.Run("failed to read iterator", func(t *testing.T) {
+		for _, itr := range []*mock.Iterator{
+			{ErrNext: errors.New("next error")},
+			{NextReturn: true, ErrKey: errors.New("key error")},
+			{NextReturn: true, ErrTags: errors.New("tags error")},
+		} {
+			svc := &Service{store: &mock.Store{QueryReturn: itr}}
+
+			rootCapabilities, err := svc.RootCapabilities("")
+			require.Error(t, err)
+			require.Nil(t, rootCapabilities)
+		}
+	})
+	t.Run("failed to query", func(t *testing.T) {
+		svc := &Service{store: &mock.Store{ErrQuery: errors.New("query error")}}
+
+		rootCapabilities, err := svc.RootCapabilities("")
+		require.EqualError(t, err, "failed to query root capabilities: query error")
+		require.Nil(t, rootCapabilities)
+	})
+}
+
+func TestService_TagRootCapabilities(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t, "vault1", "vault2")
+
+		// Overwrite vault1's entries without tags, the way they were stored before tagging was introduced.
+		rootCapability, err := svc.getCapability("vault1")
+		require.NoError(t, err)
+
+		rootCapabilityBytes, err := svc.store.Get("vault1")
+		require.NoError(t, err)
+
+		require.NoError(t, svc.store.Put("vault1", rootCapabilityBytes))
+		require.NoError(t, svc.store.Put(rootCapability.ID, rootCapabilityBytes))
+
+		rootCapabilities, err := svc.RootCapabilities("")
+		require.NoError(t, err)
+		require.Len(t, rootCapabilities, 1)
+
+		tagged, err := svc.TagRootCapabilities([]string{"vault1", "vault2", "vault3"})
+		require.NoError(t, err)
+		require.Equal(t, 1, tagged)
+
+		rootCapabilities, err = svc.RootCapabilities("vault1")
+		require.NoError(t, err)
+		require.Len(t, rootCapabilities, 1)
+		require.Equal(t, rootCapability.ID, rootCapabilities[0].ID)
+
+		orphanedRootCapabilities, err := svc.OrphanedRootCapabilities(func(resourceID string) (bool, error) {
+			return resourceID == "vault2", nil
+		})
+		require.NoError(t, err)
+		require.Len(t, orphanedRootCapabilities, 1)
+		require.Equal(t, "vault1", orphanedRootCapabilities[0].Resource)
+
+		// Root capabilities are only tagged once.
+		require.NoError(t, svc.store.Put("vault1", rootCapabilityBytes))
+
+		tagged, err = svc.TagRootCapabilities([]string{"vault1"})
+		require.NoError(t, err)
+		require.Zero(t, tagged)
+	})
+	t.Run("failed to get marker", func(t *testing.T) {
+		svc := &Service{store: &mock.Store{ErrGet: errors.New("get error")}}
+
+		_, err := svc.TagRootCapabilities([]string{"vault1"})
+		require.EqualError(t, err, "failed to get root capability tags marker: get error")
+	})
+	t.Run("failed to get tags", func(t *testing.T) {
+		svc := &Service{store: &mock.Store{
+			ErrGet: ariesstorage.ErrDataNotFound, ErrGetTags: errors.New("get tags error"),
+		}}
+
+		_, err := svc.TagRootCapabilities([]string{"vault1"})
+		require.EqualError(t, err, "failed to get tags of root capability for resource vault1: get tags error")
+	})
+	t.Run("invalid root capability", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t)
+
+		require.NoError(t, svc.store.Put("vault1", []byte("NotJSON")))
+
+		_, err := svc.TagRootCapabilities([]string{"vault1"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to parse root capability for resource vault1")
+	})
+}
+
+func TestService_OrphanedRootCapabilities(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t, "vault1", "vault2")
+
+		orphanedRootCapabilities, err := svc.OrphanedRootCapabilities(func(resourceID string) (bool, error) {
+			return resourceID == "vault1", nil
+		})
+		require.NoError(t, err)
+		require.Len(t, orphanedRootCapabilities, 1)
+		require.Equal(t, "vault2", orphanedRootCapabilities[0].Resource)
+	})
+	t.Run("failed to determine whether resource exists", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t, "vault1")
+
+		orphanedRootCapabilities, err := svc.OrphanedRootCapabilities(func(string) (bool, error) {
+			return false, errors.New("exists error")
+		})
+		require.EqualError(t, err, "failed to determine whether resource vault1 exists: exists error")
+		require.Nil(t, orphanedRootCapabilities)
+	})
+	t.Run("failed to query", func(t *testing.T) {
+		svc := &Service{store: &mock.Store{ErrQuery: errors.New("query error")}}
+
+		orphanedRootCapabilities, err := svc.OrphanedRootCapabilities(nil)
+		require.EqualError(t, err, "failed to query root capabilities: query error")
+		require.Nil(t, orphanedRootCapabilities)
+	})
+}
+
+func TestService_DeleteCapabilities(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t, "vault1", "vault2")
+
+		rootCapability, err := svc.getCapability("vault1")
+		require.NoError(t, err)
+
+		err = svc.DeleteCapabilities("vault1")
+		require.NoError(t, err)
+
+		_, err = svc.getCapability("vault1")
+		require.True(t, errors.Is(err, ErrCapabilityNotFound))
+
+		_, err = svc.getCapability(rootCapability.ID)
+		require.True(t, errors.Is(err, ErrCapabilityNotFound))
+
+		keys, err := svc.capabilityKeys("vault1")
+		require.NoError(t, err)
+		require.Empty(t, keys)
+
+		rootCapabilities, err := svc.RootCapabilities("")
+		require.NoError(t, err)
+		require.Len(t, rootCapabilities, 1)
+		require.Equal(t, "vault2", rootCapabilities[0].Resource)
+	})
+	t.Run("untagged root capability", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t)
+
+		rootCapability, err := svc.createRootCapability("vault1")
+		require.NoError(t, err)
+
+		rootCapabilityBytes, err := svc.store.Get("vault1")
+		require.NoError(t, err)
+
+		// Overwrite the entries without tags, the way they were stored before tagging was introduced.
+		require.NoError(t, svc.store.Put("vault1", rootCapabilityBytes))
+		require.NoError(t, svc.store.Put(rootCapability.ID, rootCapabilityBytes))
+
+		err = svc.DeleteCapabilities("vault1")
+		require.NoError(t, err)
+
+		_, err = svc.getCapability(rootCapability.ID)
+		require.True(t, errors.Is(err, ErrCapabilityNotFound))
+	})
+	t.Run("no capabilities for resource", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t)
+
+		err := svc.DeleteCapabilities("vault1")
+		require.True(t, errors.Is(err, ErrCapabilityNotFound))
+	})
+	t.Run("failed to read iterator", func(t *testing.T) {
+		svc := &Service{store: &mock.Store{QueryReturn: &mock.Iterator{ErrNext: errors.New("next error")}}}
+
+		err := svc.DeleteCapabilities("vault1")
+		require.EqualError(t, err, "failed to get next entry from iterator: next error")
+	})
+	t.Run("failed to delete", func(t *testing.T) {
+		svc := &Service{store: &mock.Store{
+			QueryReturn: &mock.Iterator{}, GetReturn: []byte("{}"), ErrDelete: errors.New("delete error"),
+		}}
+
+		err := svc.DeleteCapabilities("vault1")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "delete error")
+	})
+	t.Run("failed to query", func(t *testing.T) {
+		svc := &Service{store: &mock.Store{ErrQuery: errors.New("query error")}}
+
+		err := svc.DeleteCapabilities("vault1")
+		require.EqualError(t, err, "failed to query capabilities: query error")
+	})
+	t.Run("failed to get root capability", func(t *testing.T) {
+		svc := &Service{store: &mock.Store{QueryReturn: &mock.Iterator{}, ErrGet: errors.New("get error")}}
+
+		err := svc.DeleteCapabilities("vault1")
+		require.EqualError(t, err, "failed to get root capability for resource vault1: get error")
+	})
+	t.Run("failed to parse root capability", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t)
+
+		require.NoError(t, svc.store.Put("vault1", []byte("not a capability")))
+
+		err := svc.DeleteCapabilities("vault1")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to parse root capability for resource vault1")
+	})
+}
+
+func TestService_ExportCapabilities(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t, "vault1", "vault2")
+
+		capabilities, err := svc.ExportCapabilities("vault1")
+		require.NoError(t, err)
+		// The root capability and the capability delegated by Create.
+		require.Len(t, capabilities, 2)
+
+		for _, capabilityBytes := range capabilities {
+			capability, errParse := zcapld.ParseCapability(capabilityBytes)
+			require.NoError(t, errParse)
+			require.Equal(t, "vault1", capability.InvocationTarget.ID)
+		}
+
+		capabilities, err = svc.ExportCapabilities("vault3")
+		require.NoError(t, err)
+		require.Empty(t, capabilities)
+	})
+	t.Run("failed to query", func(t *testing.T) {
+		svc := &Service{store: &mock.Store{ErrQuery: errors.New("query error")}}
+
+		capabilities, err := svc.ExportCapabilities("vault1")
+		require.EqualError(t, err, "failed to query capabilities: query error")
+		require.Nil(t, capabilities)
+	})
+}
+
+func TestService_ImportCapabilities(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		source := newTestServiceWithCapabilities(t, "vault1")
+
+		capabilities, err := source.ExportCapabilities("vault1")
+		require.NoError(t, err)
+
+		target := newTestServiceWithCapabilities(t)
+
+		err = target.ImportCapabilities("vault1", capabilities)
+		require.NoError(t, err)
+
+		sourceRootCapability, err := source.getCapability("vault1")
+		require.NoError(t, err)
+
+		targetRootCapability, err := target.getCapability("vault1")
+		require.NoError(t, err)
+		require.Equal(t, sourceRootCapability.ID, targetRootCapability.ID)
+
+		rootCapabilities, err := target.RootCapabilities("vault1")
+		require.NoError(t, err)
+		require.Equal(t, []RootCapability{{ID: sourceRootCapability.ID, Resource: "vault1"}}, rootCapabilities)
+
+		importedCapabilities, err := target.ExportCapabilities("vault1")
+		require.NoError(t, err)
+		require.ElementsMatch(t, capabilities, importedCapabilities)
+	})
+	t.Run("capability is for another resource", func(t *testing.T) {
+		source := newTestServiceWithCapabilities(t, "vault1")
+
+		capabilities, err := source.ExportCapabilities("vault1")
+		require.NoError(t, err)
+
+		err = newTestServiceWithCapabilities(t).ImportCapabilities("vault2", capabilities)
+		require.True(t, errors.Is(err, ErrInvocationInvalid))
+	})
+	t.Run("invalid capability", func(t *testing.T) {
+		err := newTestServiceWithCapabilities(t).ImportCapabilities("vault1",
+			[]json.RawMessage{[]byte("not a capability")})
+		require.True(t, errors.Is(err, ErrInvocationInvalid))
+	})
+	t.Run("failed to store capability", func(t *testing.T) {
+		source := newTestServiceWithCapabilities(t, "vault1")
+
+		capabilities, err := source.ExportCapabilities("vault1")
+		require.NoError(t, err)
+
+		svc := &Service{store: &mock.Store{ErrPut: errors.New("put error")}}
+
+		err = svc.ImportCapabilities("vault1", capabilities)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "put error")
+	})
+}
+
+func newTestServiceWithCapabilities(t *testing.T, resourceIDs ...string) *Service {
+	t.Helper()
+
+	svc, err := New(&mockkms.KeyManager{}, &mockcrypto.Crypto{}, mem.NewProvider(), createTestDocumentLoader(t), nil)
+	require.NoError(t, err)
+
+	for i, resourceID := range resourceIDs {
+		_, err = svc.Create(resourceID, fmt.Sprintf("did:key:z%d", i))
+		require.NoError(t, err)
+	}
+
+	return svc
+}
@@ -0,0 +1,184 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package zcapld
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/trustbloc/edge-core/pkg/zcapld"
+
+	"github.com/trustbloc/edv/pkg/auth"
+)
+
+// Types of the caveats that restrict what a capability allows in a vault, beyond its allowed actions and invocation
+// target. They're enforced by the EDV operations, which get them from the request as auth.Restrictions.
+// Caveats only have a type and a duration, so the parameters of these caveats are encoded in their type as a query
+// string, for example "EDVOperations?operation=read&operation=query".
+const (
+	// caveatTypeOperations restricts a capability to the operations in its operation parameters (see
+	// auth.OperationRead, auth.OperationQuery and auth.OperationWrite).
+	caveatTypeOperations = "EDVOperations"
+	// caveatTypeAttribute restricts a capability to the documents indexed with the attribute in its name and value
+	// parameters.
+	caveatTypeAttribute = "EDVAttribute"
+
+	caveatParamsSeparator = "?"
+	operationParam        = "operation"
+	attributeNameParam    = "name"
+	attributeValueParam   = "value"
+)
+
+// delegationCaveats returns the caveats that restrict a capability delegated from parent as described by
+// delegation. The operations must all be allowed by the parent.
+func delegationCaveats(parent *zcapld.Capability, delegation *Delegation) ([]zcapld.Caveat, error) {
+	var caveats []zcapld.Caveat
+
+	if len(delegation.Operations) > 0 {
+		parentRestrictions, err := restrictions([]*zcapld.Capability{parent})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, operation := range delegation.Operations {
+			if !isOperation(operation) {
+				return nil, fmt.Errorf("%w: unknown operation %q", ErrDelegationInvalid, operation)
+			}
+
+			if !parentRestrictions.AllowsOperation(operation) {
+				return nil, fmt.Errorf("%w: operation %q isn't allowed by parent capability %s",
+					ErrDelegationInvalid, operation, parent.ID)
+			}
+		}
+
+		caveats = append(caveats, zcapld.Caveat{
+			Type: caveatTypeOperations + caveatParamsSeparator +
+				url.Values{operationParam: delegation.Operations}.Encode(),
+		})
+	}
+
+	if delegation.Attribute != nil {
+		if delegation.Attribute.Name == "" || delegation.Attribute.Value == "" {
+			return nil, fmt.Errorf("%w: the name and value of the attribute that the delegated capability is "+
+				"restricted to must be set", ErrDelegationInvalid)
+		}
+
+		caveats = append(caveats, zcapld.Caveat{
+			Type: caveatTypeAttribute + caveatParamsSeparator + url.Values{
+				attributeNameParam:  {delegation.Attribute.Name},
+				attributeValueParam: {delegation.Attribute.Value},
+			}.Encode(),
+		})
+	}
+
+	return caveats, nil
+}
+
+// restrictions returns the restrictions of the EDV caveats of the given capabilities, which are the capabilities
+// in the chain of an invoked capability. A capability can only narrow the restrictions of the capabilities it was
+// delegated from: a request may only perform the operations that all of them allow, on the documents that have
+// all of their attributes. Nil is returned if none of the capabilities have EDV caveats.
+func restrictions(capabilities []*zcapld.Capability) (*auth.Restrictions, error) {
+	var result *auth.Restrictions
+
+	for _, capability := range capabilities {
+		for _, caveat := range capability.Caveats {
+			caveatType, params, err := parseCaveat(caveat)
+			if err != nil {
+				return nil, fmt.Errorf("%w: capability %s has an invalid caveat: %s", ErrInvocationInvalid,
+					capability.ID, err)
+			}
+
+			if caveatType != caveatTypeOperations && caveatType != caveatTypeAttribute {
+				continue
+			}
+
+			if result == nil {
+				result = &auth.Restrictions{}
+			}
+
+			if caveatType == caveatTypeOperations {
+				result.Operations = allowedOperations(result.Operations, params[operationParam])
+
+				continue
+			}
+
+			attribute := auth.Attribute{Name: params.Get(attributeNameParam), Value: params.Get(attributeValueParam)}
+			if !containsAttribute(result.Attributes, attribute) {
+				result.Attributes = append(result.Attributes, attribute)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// parseCaveat returns the type of the caveat without its parameters, and its parameters if it's an EDV caveat.
+func parseCaveat(caveat zcapld.Caveat) (string, url.Values, error) {
+	caveatType, rawParams := caveat.Type, ""
+
+	if separator := strings.Index(caveat.Type, caveatParamsSeparator); separator >= 0 {
+		caveatType, rawParams = caveat.Type[:separator], caveat.Type[separator+1:]
+	}
+
+	if caveatType != caveatTypeOperations && caveatType != caveatTypeAttribute {
+		return caveatType, nil, nil
+	}
+
+	params, err := url.ParseQuery(rawParams)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse the parameters of caveat %s: %w", caveatType, err)
+	}
+
+	switch caveatType {
+	case caveatTypeOperations:
+		for _, operation := range params[operationParam] {
+			if !isOperation(operation) {
+				return "", nil, fmt.Errorf("unknown operation %q in caveat %s", operation, caveatType)
+			}
+		}
+	case caveatTypeAttribute:
+		if params.Get(attributeNameParam) == "" || params.Get(attributeValueParam) == "" {
+			return "", nil, fmt.Errorf("caveat %s must have a name and a value", caveatType)
+		}
+	}
+
+	return caveatType, params, nil
+}
+
+// allowedOperations returns the operations that are allowed by both allowed and operations. A nil list allows every
+// operation.
+func allowedOperations(allowed, operations []string) []string {
+	if allowed == nil {
+		return append([]string{}, operations...)
+	}
+
+	intersection := []string{}
+
+	for _, operation := range allowed {
+		if containsString(operations, operation) {
+			intersection = append(intersection, operation)
+		}
+	}
+
+	return intersection
+}
+
+func isOperation(operation string) bool {
+	return operation == auth.OperationRead || operation == auth.OperationQuery || operation == auth.OperationWrite
+}
+
+func containsAttribute(attributes []auth.Attribute, attribute auth.Attribute) bool {
+	for _, a := range attributes {
+		if a == attribute {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,61 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package zcapld
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/edge-core/pkg/zcapld"
+
+	"github.com/trustbloc/edv/pkg/auth"
+)
+
+func TestRestrictions(t *testing.T) {
+	t.Run("No EDV caveats", func(t *testing.T) {
+		capabilityRestrictions, err := restrictions([]*zcapld.Capability{
+			{ID: "urn:uuid:1"},
+			{ID: "urn:uuid:2", Caveats: []zcapld.Caveat{{Type: zcapld.CaveatTypeExpiry, Duration: 60}, {Type: "other?%"}}},
+		})
+		require.NoError(t, err)
+		require.Nil(t, capabilityRestrictions)
+	})
+	t.Run("Restrictions are combined", func(t *testing.T) {
+		capabilityRestrictions, err := restrictions([]*zcapld.Capability{
+			{ID: "urn:uuid:1", Caveats: []zcapld.Caveat{
+				{Type: "EDVOperations?operation=read&operation=write"},
+				{Type: "EDVAttribute?name=name1&value=value1"},
+			}},
+			{ID: "urn:uuid:2", Caveats: []zcapld.Caveat{
+				{Type: "EDVOperations?operation=query&operation=write"},
+				{Type: "EDVAttribute?name=name1&value=value1"},
+				{Type: "EDVAttribute?name=name2&value=value%3D2"},
+			}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, &auth.Restrictions{
+			Operations: []string{auth.OperationWrite},
+			Attributes: []auth.Attribute{{Name: "name1", Value: "value1"}, {Name: "name2", Value: "value=2"}},
+		}, capabilityRestrictions)
+	})
+	t.Run("No operations allowed", func(t *testing.T) {
+		capabilityRestrictions, err := restrictions([]*zcapld.Capability{
+			{ID: "urn:uuid:1", Caveats: []zcapld.Caveat{{Type: "EDVOperations"}}},
+		})
+		require.NoError(t, err)
+		require.False(t, capabilityRestrictions.AllowsOperation(auth.OperationRead))
+	})
+	t.Run("Invalid caveats", func(t *testing.T) {
+		for _, caveatType := range []string{
+			"EDVOperations?operation=delete", "EDVOperations?%", "EDVAttribute?name=name", "EDVAttribute",
+		} {
+			_, err := restrictions([]*zcapld.Capability{{ID: "urn:uuid:1", Caveats: []zcapld.Caveat{{Type: caveatType}}}})
+			require.True(t, errors.Is(err, ErrInvocationInvalid), caveatType)
+		}
+	})
+}
@@ -0,0 +1,581 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package zcapld
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	ariesstorage "github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/trustbloc/edge-core/pkg/zcapld"
+
+	"github.com/trustbloc/edv/pkg/auth"
+)
+
+const (
+	// edvDocumentResource is the invocation target type of capabilities scoped to a single document in a vault.
+	edvDocumentResource = "urn:edv:document"
+	// documentTargetSeparator separates the vault ID from the document ID in the invocation target ID of
+	// capabilities scoped to a single document.
+	documentTargetSeparator = "/documents/"
+
+	// revocationKeyPrefix is the prefix of the keys of revocation entries. Vault IDs don't contain a "/", so the
+	// resource ID and capability ID in the rest of the key can't be confused with each other.
+	revocationKeyPrefix = "revoked/"
+
+	proofPurposeField         = "proofPurpose"
+	proofCreatedField         = "created"
+	proofCapabilityChainField = "capabilityChain"
+
+	capabilityInvocationParam = "capability="
+)
+
+// Delegation describes a capability to delegate from an existing capability.
+type Delegation struct {
+	// Parent is the ID of the capability to delegate from. If empty, the root capability of the resource is used.
+	Parent string
+	// Invoker is the verification method (e.g. a did:key URL) that may invoke the delegated capability.
+	Invoker string
+	// AllowedActions are the actions granted by the delegated capability. They must all be granted by the parent.
+	// If empty, the delegated capability grants the same actions as its parent.
+	AllowedActions []string
+	// DocumentID, if set, restricts the delegated capability to the document with this ID. Capabilities delegated
+	// from a capability scoped to a document are always scoped to the same document.
+	DocumentID string
+	// Expires, if set, is the time after which the delegated capability can no longer be invoked. A capability never
+	// outlives its parent, so it expires no later than its parent does.
+	Expires time.Time
+	// Operations, if set, restricts the delegated capability to these operations (see auth.OperationRead,
+	// auth.OperationQuery and auth.OperationWrite), which must all be allowed by the parent. Unlike AllowedActions,
+	// they tell queries apart from writes, so that a capability can allow reads and queries only.
+	Operations []string
+	// Attribute, if set, restricts the delegated capability to the documents indexed with this attribute, and to
+	// queries for it. A capability is restricted to the attributes of the capabilities it was delegated from as well.
+	Attribute *auth.Attribute
+	// NotFromRoot, if set, rejects delegating from the root capability of the resource. It's set for delegations
+	// that aren't made by invoking the parent, such as those authorized with bearer access tokens, so that they
+	// can't hand out the full authority of the resource's controller.
+	NotFromRoot bool
+}
+
+// Delegate creates a capability for the given resource from an existing capability, as described by delegation.
+// The delegated capability is signed by the server and stored, so that it can be revoked and is exported along
+// with the other capabilities of the resource.
+func (s *Service) Delegate(resourceID string, delegation *Delegation) ([]byte, error) {
+	if delegation.Invoker == "" {
+		return nil, fmt.Errorf("%w: the invoker of the delegated capability must be set", ErrDelegationInvalid)
+	}
+
+	parent, err := s.delegationParent(resourceID, delegation.Parent)
+	if err != nil {
+		return nil, err
+	}
+
+	if delegation.NotFromRoot && parent.Parent == "" {
+		return nil, fmt.Errorf("%w: capabilities can't be delegated from the root capability %s without invoking it",
+			ErrActionNotAllowed, parent.ID)
+	}
+
+	if s.limits.MaxChainLength > 0 && len(capabilityChain(parent))+1 > s.limits.MaxChainLength {
+		return nil, fmt.Errorf("%w: a capability delegated from capability %s would be delegated through more "+
+			"than the maximum of %d capabilities", ErrDelegationInvalid, parent.ID, s.limits.MaxChainLength)
+	}
+
+	options, err := delegationOptions(resourceID, parent, delegation)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := s.newSigner()
+	if err != nil {
+		return nil, err
+	}
+
+	capability, err := zcapld.NewCapability(signer, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new capability: %w", err)
+	}
+
+	capabilityBytes, err := json.Marshal(capability)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal capability: %w", err)
+	}
+
+	if err := s.store.Put(capability.ID, capabilityBytes,
+		ariesstorage.Tag{Name: resourceTagName, Value: resourceID}); err != nil {
+		return nil, fmt.Errorf("failed to store capability: %w", err)
+	}
+
+	s.log().Infof("Delegated capability %s from capability %s for resource %s", capability.ID, parent.ID,
+		resourceID)
+
+	return capabilityBytes, nil
+}
+
+// Revoke revokes the capability with the given ID, along with every capability delegated from it, so that
+// invoking any of them is rejected by Handler. Capabilities that were delegated by clients and never stored by
+// the server can be revoked too. The root capability of a resource can't be revoked.
+//
+// If revokerID is set, it's the ID of the capability invoked to revoke the capability. A stored capability can
+// then only be revoked with the capability itself or one of the capabilities it was delegated from. The capabilities
+// that a capability that isn't stored was delegated from aren't known, so it can only be revoked with the authority
+// of the resource's controller: by invoking the root capability, or a capability delegated directly from it.
+//
+// Revocations are only known to this server. They aren't exported by ExportCapabilities, though the revoked
+// capability is deleted, so that it's no longer exported either.
+func (s *Service) Revoke(resourceID, capabilityID, revokerID string) error {
+	rootCapability, err := s.getCapability(resourceID)
+	if err != nil {
+		return fmt.Errorf("failed to get root capability %s from db: %w", resourceID, err)
+	}
+
+	if capabilityID == resourceID || capabilityID == rootCapability.ID {
+		return fmt.Errorf("%w: the root capability of resource %s can't be revoked", ErrDelegationInvalid,
+			resourceID)
+	}
+
+	capability, err := s.getCapability(capabilityID)
+	if err != nil && !errors.Is(err, ErrCapabilityNotFound) {
+		return fmt.Errorf("failed to get capability %s from db: %w", capabilityID, err)
+	}
+
+	if capability != nil {
+		if errResource := checkResource(resourceID, capability); errResource != nil {
+			return errResource
+		}
+
+		if revokerID != "" && revokerID != capabilityID && !containsString(capabilityChain(capability), revokerID) {
+			return fmt.Errorf("%w: capability %s wasn't delegated from capability %s, so it can't be revoked "+
+				"with it", ErrActionNotAllowed, capabilityID, revokerID)
+		}
+	} else if err = s.checkControllerAuthority(rootCapability, revokerID); err != nil {
+		return fmt.Errorf("capability %s isn't stored, so it can only be revoked by the resource's controller: %w",
+			capabilityID, err)
+	}
+
+	err = s.store.Put(revocationKey(resourceID, capabilityID), []byte(capabilityID),
+		ariesstorage.Tag{Name: resourceTagName, Value: resourceID})
+	if err != nil {
+		return fmt.Errorf("failed to store revocation of capability %s: %w", capabilityID, err)
+	}
+
+	if capability != nil {
+		err = s.store.Delete(capabilityID)
+		if err != nil {
+			return fmt.Errorf("failed to delete revoked capability %s: %w", capabilityID, err)
+		}
+	}
+
+	s.log().Infof("Revoked capability %s for resource %s", capabilityID, resourceID)
+
+	return nil
+}
+
+// CheckControllerAuthority returns an error wrapping ErrActionNotAllowed unless the capability with the given ID has
+// the authority of the controller of the given resource: it must be the resource's root capability, or a capability
+// delegated directly from it. It's used for actions that a capability delegated further mustn't be able to take,
+// such as deleting the resource.
+func (s *Service) CheckControllerAuthority(resourceID, capabilityID string) error {
+	rootCapability, err := s.getCapability(resourceID)
+	if err != nil {
+		return fmt.Errorf("failed to get root capability %s from db: %w", resourceID, err)
+	}
+
+	return s.checkControllerAuthority(rootCapability, capabilityID)
+}
+
+// checkControllerAuthority returns an error unless the capability with the given ID has the authority of the
+// controller of the resource with the given root capability, which is the case for the root capability and the
+// capabilities delegated directly from it.
+func (s *Service) checkControllerAuthority(rootCapability *zcapld.Capability, capabilityID string) error {
+	if capabilityID == "" {
+		return fmt.Errorf("%w: no capability was invoked", ErrActionNotAllowed)
+	}
+
+	if capabilityID == rootCapability.ID {
+		return nil
+	}
+
+	capability, err := s.getCapability(capabilityID)
+	if errors.Is(err, ErrCapabilityNotFound) {
+		return fmt.Errorf("%w: capability %s isn't stored", ErrActionNotAllowed, capabilityID)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to get capability %s from db: %w", capabilityID, err)
+	}
+
+	if capability.Parent != rootCapability.ID {
+		return fmt.Errorf("%w: capability %s wasn't delegated from root capability %s", ErrActionNotAllowed,
+			capabilityID, rootCapability.ID)
+	}
+
+	return nil
+}
+
+// InvokedCapability returns the capability invoked by the request's capability-invocation header, or nil if the
+// request doesn't invoke one. The capability isn't verified, which is left to Handler.
+func InvokedCapability(req *http.Request) (*zcapld.Capability, error) {
+	compressed := invokedCapabilityParam(req)
+	if compressed == "" {
+		return nil, nil
+	}
+
+	capability, err := zcapld.DecompressZCAP(compressed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse invoked capability: %s", ErrInvocationInvalid, err)
+	}
+
+	return capability, nil
+}
+
+// invoker returns the invoker of the capability invoked by the request, which falls back to the capability's
+// controller if it doesn't name one. It returns an empty string if the request doesn't invoke a capability.
+func invoker(req *http.Request) string {
+	capability, err := InvokedCapability(req)
+	if err != nil || capability == nil {
+		return ""
+	}
+
+	if capability.Invoker != "" {
+		return capability.Invoker
+	}
+
+	return capability.Controller
+}
+
+// invokedCapabilityParam returns the compressed capability in the request's capability-invocation header, or an
+// empty string if there isn't one.
+func invokedCapabilityParam(req *http.Request) string {
+	value := strings.TrimSpace(strings.Join(req.Header.Values(zcapld.CapabilityInvocationHTTPHeader), ", "))
+	if value == "" {
+		return ""
+	}
+
+	for _, param := range strings.Split(value[strings.Index(value, " ")+1:], ",") {
+		param = strings.TrimSpace(param)
+
+		if strings.HasPrefix(param, capabilityInvocationParam) {
+			return strings.Trim(param[len(capabilityInvocationParam):], `"`)
+		}
+	}
+
+	return ""
+}
+
+// delegationParent returns the capability to delegate a new capability from, which must be one of the stored
+// capabilities of the resource that isn't revoked.
+func (s *Service) delegationParent(resourceID, parentID string) (*zcapld.Capability, error) {
+	if parentID == "" {
+		parentID = resourceID
+	}
+
+	parent, err := s.getCapability(parentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get parent capability %s from db: %w", parentID, err)
+	}
+
+	if err = checkResource(resourceID, parent); err != nil {
+		return nil, err
+	}
+
+	for _, id := range append(capabilityChain(parent), parent.ID) {
+		revoked, errRevoked := s.isRevoked(resourceID, id)
+		if errRevoked != nil {
+			return nil, errRevoked
+		}
+
+		if revoked {
+			return nil, fmt.Errorf("%w: parent capability %s can't be delegated from: capability %s was revoked",
+				ErrCapabilityRevoked, parent.ID, id)
+		}
+	}
+
+	return parent, nil
+}
+
+// delegationOptions returns the options for creating the capability described by delegation from parent.
+func delegationOptions(resourceID string, parent *zcapld.Capability,
+	delegation *Delegation) ([]zcapld.CapabilityOption, error) {
+	allowedActions := delegation.AllowedActions
+	if len(allowedActions) == 0 {
+		allowedActions = parent.AllowedAction
+	}
+
+	for _, action := range allowedActions {
+		if !containsString(parent.AllowedAction, action) {
+			return nil, fmt.Errorf("%w: action %q isn't allowed by parent capability %s", ErrDelegationInvalid,
+				action, parent.ID)
+		}
+	}
+
+	_, parentDocumentID, err := documentScope(resourceID, parent)
+	if err != nil {
+		return nil, err
+	}
+
+	documentID := delegation.DocumentID
+	if parentDocumentID != "" && documentID != "" && documentID != parentDocumentID {
+		return nil, fmt.Errorf("%w: parent capability %s is restricted to document %s", ErrDelegationInvalid,
+			parent.ID, parentDocumentID)
+	}
+
+	if documentID == "" {
+		documentID = parentDocumentID
+	}
+
+	target := zcapld.InvocationTarget{ID: resourceID, Type: edvResource}
+	if documentID != "" {
+		target = zcapld.InvocationTarget{
+			ID: resourceID + documentTargetSeparator + documentID, Type: edvDocumentResource,
+		}
+	}
+
+	options := []zcapld.CapabilityOption{
+		zcapld.WithParent(parent.ID), zcapld.WithInvoker(delegation.Invoker),
+		zcapld.WithAllowedActions(allowedActions...), zcapld.WithInvocationTarget(target.ID, target.Type),
+		zcapld.WithCapabilityChain(chainLinks(append(capabilityChain(parent), parent.ID))...),
+	}
+
+	expires := delegation.Expires
+	if parentExpires, ok := expiry(parent); ok && (expires.IsZero() || parentExpires.Before(expires)) {
+		expires = parentExpires
+	}
+
+	caveats, err := delegationCaveats(parent, delegation)
+	if err != nil {
+		return nil, err
+	}
+
+	if !expires.IsZero() {
+		duration := time.Until(expires)
+		if duration < time.Second {
+			return nil, fmt.Errorf("%w: the delegated capability would expire at %s, which isn't in the future",
+				ErrDelegationInvalid, expires.Format(time.RFC3339))
+		}
+
+		caveats = append(caveats,
+			zcapld.Caveat{Type: zcapld.CaveatTypeExpiry, Duration: uint64(duration / time.Second)})
+	}
+
+	if len(caveats) > 0 {
+		options = append(options, zcapld.WithCaveats(caveats...))
+	}
+
+	return options, nil
+}
+
+// checkInvocation rejects the request if it invokes a revoked capability, or a capability that's scoped to
+// another document than the one requested. It's called after the zcapld middleware has verified the invocation.
+// It returns the restrictions of the EDV caveats of the invoked capability and of the capabilities it was
+// delegated from (see Delegation), which are left to the EDV operations to enforce.
+func (s *Service) checkInvocation(resourceID string, req *http.Request) (*auth.Restrictions, error) {
+	capability, err := InvokedCapability(req)
+	if err != nil || capability == nil {
+		return nil, err
+	}
+
+	chain := capabilityChain(capability)
+
+	for _, id := range append(chain, capability.ID) {
+		revoked, errRevoked := s.isRevoked(resourceID, id)
+		if errRevoked != nil {
+			return nil, errRevoked
+		}
+
+		if revoked {
+			return nil, fmt.Errorf("%w: capability %s was revoked", ErrCapabilityRevoked, id)
+		}
+	}
+
+	scopedCapabilities := []*zcapld.Capability{capability}
+
+	// The capabilities in the chain have been resolved by the middleware, so the stored ones are the ones that
+	// were verified. The root capability is the first one in the chain.
+	for _, id := range chain {
+		chainCapability, errGet := s.getCapability(id)
+		if errGet == nil {
+			scopedCapabilities = append(scopedCapabilities, chainCapability)
+		}
+	}
+
+	requestedDocumentID := requestedDocument(req)
+
+	for _, scopedCapability := range scopedCapabilities {
+		scoped, documentID, errScope := documentScope(resourceID, scopedCapability)
+		if errScope != nil {
+			return nil, errScope
+		}
+
+		if scoped && documentID != requestedDocumentID {
+			return nil, fmt.Errorf("%w: capability %s is restricted to document %s", ErrActionNotAllowed,
+				scopedCapability.ID, documentID)
+		}
+	}
+
+	// Caveats aren't covered by the proofs of capabilities, so the caveats of the invoked capability are taken from
+	// the stored copy if the server delegated it, in case the invoker removed them.
+	if storedCapability, errGet := s.getCapability(capability.ID); errGet == nil {
+		scopedCapabilities[0] = storedCapability
+	}
+
+	return restrictions(scopedCapabilities)
+}
+
+func (s *Service) isRevoked(resourceID, capabilityID string) (bool, error) {
+	_, err := s.store.Get(revocationKey(resourceID, capabilityID))
+	if err != nil {
+		if errors.Is(err, ariesstorage.ErrDataNotFound) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("failed to get revocation of capability %s: %w", capabilityID, err)
+	}
+
+	return true, nil
+}
+
+func revocationKey(resourceID, capabilityID string) string {
+	return revocationKeyPrefix + resourceID + "/" + capabilityID
+}
+
+// checkResource returns ErrCapabilityNotFound if the stored capability isn't for the given resource.
+func checkResource(resourceID string, capability *zcapld.Capability) error {
+	if capability.InvocationTarget.ID == resourceID {
+		return nil
+	}
+
+	if _, _, err := documentScope(resourceID, capability); err != nil ||
+		capability.InvocationTarget.Type != edvDocumentResource {
+		return fmt.Errorf("%w: capability %s is for resource %s, not %s", ErrCapabilityNotFound, capability.ID,
+			capability.InvocationTarget.ID, resourceID)
+	}
+
+	return nil
+}
+
+// documentScope returns whether the capability is scoped to a single document of the resource, and the ID of
+// that document. An error is returned if the capability is scoped to a document of another resource.
+func documentScope(resourceID string, capability *zcapld.Capability) (bool, string, error) {
+	if capability.InvocationTarget.Type != edvDocumentResource {
+		return false, "", nil
+	}
+
+	prefix := resourceID + documentTargetSeparator
+
+	if !strings.HasPrefix(capability.InvocationTarget.ID, prefix) ||
+		len(capability.InvocationTarget.ID) == len(prefix) {
+		return false, "", fmt.Errorf("%w: capability %s is for %s, which isn't a document of resource %s",
+			ErrActionNotAllowed, capability.ID, capability.InvocationTarget.ID, resourceID)
+	}
+
+	return true, capability.InvocationTarget.ID[len(prefix):], nil
+}
+
+// requestedDocument returns the ID of the document that the request is for, or an empty string if the request
+// isn't for a single document (for example, a query).
+// Document paths are in the form /encrypted-data-vaults/{vaultID}/documents/{docID}.
+func requestedDocument(req *http.Request) string {
+	segments := strings.Split(strings.Trim(req.URL.EscapedPath(), "/"), "/")
+
+	if len(segments) < 4 || "/"+segments[2]+"/" != documentTargetSeparator {
+		return ""
+	}
+
+	documentID, err := url.PathUnescape(segments[3])
+	if err != nil {
+		return ""
+	}
+
+	return documentID
+}
+
+// capabilityChain returns the IDs of the capabilities that the capability was delegated from, starting with the
+// root capability, as listed in its delegation proof. Root capabilities don't have a chain.
+func capabilityChain(capability *zcapld.Capability) []string {
+	if capability.Parent == "" {
+		return nil
+	}
+
+	for _, proof := range capability.Proof {
+		if proof[proofPurposeField] != zcapld.ProofPurpose {
+			continue
+		}
+
+		links, ok := proof[proofCapabilityChainField].([]interface{})
+		if !ok {
+			continue
+		}
+
+		chain := make([]string, 0, len(links))
+
+		for _, link := range links {
+			switch l := link.(type) {
+			case string:
+				chain = append(chain, l)
+			case map[string]interface{}: // Embedded capabilities.
+				if id, ok := l["id"].(string); ok {
+					chain = append(chain, id)
+				}
+			}
+		}
+
+		return chain
+	}
+
+	return nil
+}
+
+// expiry returns the time at which the capability expires, if it has an expiry caveat.
+func expiry(capability *zcapld.Capability) (time.Time, bool) {
+	if len(capability.Proof) == 0 {
+		return time.Time{}, false
+	}
+
+	created, ok := capability.Proof[0][proofCreatedField].(string)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	createdTime, err := time.Parse(time.RFC3339Nano, created)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	for _, caveat := range capability.Caveats {
+		if caveat.Type == zcapld.CaveatTypeExpiry {
+			return createdTime.Add(time.Duration(caveat.Duration) * time.Second), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func chainLinks(chain []string) []interface{} {
+	links := make([]interface{}, len(chain))
+
+	for i, id := range chain {
+		links[i] = id
+	}
+
+	return links
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
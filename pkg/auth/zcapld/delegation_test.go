@@ -0,0 +1,518 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package zcapld
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mock"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/verifiable"
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/edge-core/pkg/zcapld"
+
+	"github.com/trustbloc/edv/pkg/auth"
+)
+
+func TestService_Delegate(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t, "vault1")
+		parent := controllerCapability(t, svc, "vault1")
+
+		capabilityBytes, err := svc.Delegate("vault1", &Delegation{
+			Parent: parent.ID, Invoker: "did:key:z1", AllowedActions: []string{"read"},
+		})
+		require.NoError(t, err)
+
+		capability, err := zcapld.ParseCapability(capabilityBytes)
+		require.NoError(t, err)
+		require.Equal(t, parent.ID, capability.Parent)
+		require.Equal(t, "did:key:z1", capability.Invoker)
+		require.Equal(t, []string{"read"}, capability.AllowedAction)
+		require.Equal(t, zcapld.InvocationTarget{ID: "vault1", Type: edvResource}, capability.InvocationTarget)
+		require.Equal(t, append(capabilityChain(parent), parent.ID), capabilityChain(capability))
+
+		storedCapability, err := svc.getCapability(capability.ID)
+		require.NoError(t, err)
+		require.Equal(t, capability.ID, storedCapability.ID)
+	})
+	t.Run("defaults to the root capability and its actions", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t, "vault1")
+
+		capabilityBytes, err := svc.Delegate("vault1", &Delegation{Invoker: "did:key:z1"})
+		require.NoError(t, err)
+
+		capability, err := zcapld.ParseCapability(capabilityBytes)
+		require.NoError(t, err)
+
+		rootCapability, err := svc.getCapability("vault1")
+		require.NoError(t, err)
+		require.Equal(t, rootCapability.ID, capability.Parent)
+		require.Equal(t, []string{rootCapability.ID}, capabilityChain(capability))
+		require.Equal(t, rootCapability.AllowedAction, capability.AllowedAction)
+	})
+	t.Run("scoped to a document", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t, "vault1")
+
+		capabilityBytes, err := svc.Delegate("vault1", &Delegation{Invoker: "did:key:z1", DocumentID: "doc1"})
+		require.NoError(t, err)
+
+		capability, err := zcapld.ParseCapability(capabilityBytes)
+		require.NoError(t, err)
+		require.Equal(t, zcapld.InvocationTarget{ID: "vault1/documents/doc1", Type: edvDocumentResource},
+			capability.InvocationTarget)
+
+		// Capabilities delegated from it keep its scope.
+		childBytes, err := svc.Delegate("vault1", &Delegation{Parent: capability.ID, Invoker: "did:key:z2"})
+		require.NoError(t, err)
+
+		child, err := zcapld.ParseCapability(childBytes)
+		require.NoError(t, err)
+		require.Equal(t, capability.InvocationTarget, child.InvocationTarget)
+
+		_, err = svc.Delegate("vault1", &Delegation{Parent: capability.ID, Invoker: "did:key:z2", DocumentID: "doc2"})
+		require.True(t, errors.Is(err, ErrDelegationInvalid))
+	})
+	t.Run("expires no later than its parent", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t, "vault1")
+
+		parentBytes, err := svc.Delegate("vault1", &Delegation{
+			Invoker: "did:key:z1", Expires: time.Now().Add(time.Hour),
+		})
+		require.NoError(t, err)
+
+		parent, err := zcapld.ParseCapability(parentBytes)
+		require.NoError(t, err)
+
+		parentExpires, ok := expiry(parent)
+		require.True(t, ok)
+		require.WithinDuration(t, time.Now().Add(time.Hour), parentExpires, 5*time.Second)
+
+		childBytes, err := svc.Delegate("vault1", &Delegation{
+			Parent: parent.ID, Invoker: "did:key:z2", Expires: time.Now().Add(2 * time.Hour),
+		})
+		require.NoError(t, err)
+
+		child, err := zcapld.ParseCapability(childBytes)
+		require.NoError(t, err)
+
+		childExpires, ok := expiry(child)
+		require.True(t, ok)
+		require.False(t, childExpires.After(parentExpires))
+	})
+	t.Run("restricted to operations and an attribute", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t, "vault1")
+
+		capabilityBytes, err := svc.Delegate("vault1", &Delegation{
+			Invoker: "did:key:z1", Operations: []string{auth.OperationRead, auth.OperationQuery},
+			Attribute: &auth.Attribute{Name: "CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ", Value: "RV58Va4904K-18_L5g="},
+			Expires:   time.Now().Add(time.Hour),
+		})
+		require.NoError(t, err)
+
+		capability, err := zcapld.ParseCapability(capabilityBytes)
+		require.NoError(t, err)
+		require.Len(t, capability.Caveats, 3)
+
+		_, ok := expiry(capability)
+		require.True(t, ok)
+
+		capabilityRestrictions, err := restrictions([]*zcapld.Capability{capability})
+		require.NoError(t, err)
+		require.Equal(t, &auth.Restrictions{
+			Operations: []string{auth.OperationRead, auth.OperationQuery},
+			Attributes: []auth.Attribute{
+				{Name: "CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ", Value: "RV58Va4904K-18_L5g="},
+			},
+		}, capabilityRestrictions)
+
+		// Capabilities delegated from it can only narrow its operations.
+		childBytes, err := svc.Delegate("vault1", &Delegation{
+			Parent: capability.ID, Invoker: "did:key:z2", Operations: []string{auth.OperationQuery},
+		})
+		require.NoError(t, err)
+
+		child, err := zcapld.ParseCapability(childBytes)
+		require.NoError(t, err)
+
+		childRestrictions, err := restrictions([]*zcapld.Capability{capability, child})
+		require.NoError(t, err)
+		require.Equal(t, []string{auth.OperationQuery}, childRestrictions.Operations)
+		require.Equal(t, capabilityRestrictions.Attributes, childRestrictions.Attributes)
+
+		_, err = svc.Delegate("vault1", &Delegation{
+			Parent: capability.ID, Invoker: "did:key:z2", Operations: []string{auth.OperationWrite},
+		})
+		require.True(t, errors.Is(err, ErrDelegationInvalid))
+	})
+	t.Run("invalid delegation", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t, "vault1")
+		parent, err := svc.Delegate("vault1", &Delegation{Invoker: "did:key:z1", AllowedActions: []string{"read"}})
+		require.NoError(t, err)
+
+		parentCapability, err := zcapld.ParseCapability(parent)
+		require.NoError(t, err)
+
+		for _, delegation := range []*Delegation{
+			{},
+			{Parent: parentCapability.ID, Invoker: "did:key:z2", AllowedActions: []string{"write"}},
+			{Invoker: "did:key:z2", Expires: time.Now().Add(-time.Minute)},
+			{Invoker: "did:key:z2", Operations: []string{"delete"}},
+			{Invoker: "did:key:z2", Attribute: &auth.Attribute{Name: "name"}},
+		} {
+			_, err = svc.Delegate("vault1", delegation)
+			require.True(t, errors.Is(err, ErrDelegationInvalid), err)
+		}
+	})
+	t.Run("parent capability not found", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t, "vault1", "vault2")
+
+		_, err := svc.Delegate("vault1", &Delegation{Parent: "urn:uuid:unknown", Invoker: "did:key:z1"})
+		require.True(t, errors.Is(err, ErrCapabilityNotFound))
+
+		_, err = svc.Delegate("vault1", &Delegation{
+			Parent: controllerCapability(t, svc, "vault2").ID, Invoker: "did:key:z1",
+		})
+		require.True(t, errors.Is(err, ErrCapabilityNotFound))
+	})
+	t.Run("parent capability revoked", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t, "vault1")
+		parent := controllerCapability(t, svc, "vault1")
+
+		childBytes, err := svc.Delegate("vault1", &Delegation{Parent: parent.ID, Invoker: "did:key:z1"})
+		require.NoError(t, err)
+
+		child, err := zcapld.ParseCapability(childBytes)
+		require.NoError(t, err)
+
+		require.NoError(t, svc.Revoke("vault1", parent.ID, ""))
+
+		_, err = svc.Delegate("vault1", &Delegation{Parent: child.ID, Invoker: "did:key:z2"})
+		require.True(t, errors.Is(err, ErrCapabilityRevoked))
+	})
+	t.Run("not from the root capability", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t, "vault1")
+		parent := controllerCapability(t, svc, "vault1")
+
+		_, err := svc.Delegate("vault1", &Delegation{Invoker: "did:key:z1", NotFromRoot: true})
+		require.True(t, errors.Is(err, ErrActionNotAllowed))
+
+		_, err = svc.Delegate("vault1", &Delegation{Parent: "vault1", Invoker: "did:key:z1", NotFromRoot: true})
+		require.True(t, errors.Is(err, ErrActionNotAllowed))
+
+		_, err = svc.Delegate("vault1", &Delegation{Parent: parent.ID, Invoker: "did:key:z1", NotFromRoot: true})
+		require.NoError(t, err)
+	})
+}
+
+func TestService_Revoke(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t, "vault1")
+		parent := controllerCapability(t, svc, "vault1")
+
+		childBytes, err := svc.Delegate("vault1", &Delegation{Parent: parent.ID, Invoker: "did:key:z1"})
+		require.NoError(t, err)
+
+		child, err := zcapld.ParseCapability(childBytes)
+		require.NoError(t, err)
+
+		require.NoError(t, svc.Revoke("vault1", child.ID, parent.ID))
+
+		revoked, err := svc.isRevoked("vault1", child.ID)
+		require.NoError(t, err)
+		require.True(t, revoked)
+
+		_, err = svc.getCapability(child.ID)
+		require.True(t, errors.Is(err, ErrCapabilityNotFound))
+
+		// Revocations aren't exported, but they're deleted along with the other capabilities of the vault.
+		capabilities, err := svc.ExportCapabilities("vault1")
+		require.NoError(t, err)
+		require.Len(t, capabilities, 2)
+
+		require.NoError(t, svc.DeleteCapabilities("vault1"))
+
+		revoked, err = svc.isRevoked("vault1", child.ID)
+		require.NoError(t, err)
+		require.False(t, revoked)
+	})
+	t.Run("capability delegated by a client", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t, "vault1")
+		controller := controllerCapability(t, svc, "vault1")
+
+		rootCapability, err := svc.getCapability("vault1")
+		require.NoError(t, err)
+
+		childBytes, err := svc.Delegate("vault1", &Delegation{Parent: controller.ID, Invoker: "did:key:z1"})
+		require.NoError(t, err)
+
+		child, err := zcapld.ParseCapability(childBytes)
+		require.NoError(t, err)
+
+		// Only the controller can revoke capabilities that aren't stored.
+		for _, revokerID := range []string{"", "urn:uuid:other", child.ID} {
+			err = svc.Revoke("vault1", "urn:uuid:client-delegated", revokerID)
+			require.True(t, errors.Is(err, ErrActionNotAllowed), revokerID)
+		}
+
+		revoked, err := svc.isRevoked("vault1", "urn:uuid:client-delegated")
+		require.NoError(t, err)
+		require.False(t, revoked)
+
+		for _, revokerID := range []string{controller.ID, rootCapability.ID} {
+			require.NoError(t, svc.Revoke("vault1", "urn:uuid:client-delegated", revokerID))
+
+			revoked, err = svc.isRevoked("vault1", "urn:uuid:client-delegated")
+			require.NoError(t, err)
+			require.True(t, revoked)
+		}
+	})
+	t.Run("root capability can't be revoked", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t, "vault1")
+
+		rootCapability, err := svc.getCapability("vault1")
+		require.NoError(t, err)
+
+		err = svc.Revoke("vault1", rootCapability.ID, "")
+		require.True(t, errors.Is(err, ErrDelegationInvalid))
+	})
+	t.Run("revoker isn't in the chain of the capability", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t, "vault1")
+		parent := controllerCapability(t, svc, "vault1")
+
+		childBytes, err := svc.Delegate("vault1", &Delegation{Parent: parent.ID, Invoker: "did:key:z1"})
+		require.NoError(t, err)
+
+		child, err := zcapld.ParseCapability(childBytes)
+		require.NoError(t, err)
+
+		err = svc.Revoke("vault1", parent.ID, child.ID)
+		require.True(t, errors.Is(err, ErrActionNotAllowed))
+	})
+	t.Run("capability of another vault", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t, "vault1", "vault2")
+
+		err := svc.Revoke("vault1", controllerCapability(t, svc, "vault2").ID, "")
+		require.True(t, errors.Is(err, ErrCapabilityNotFound))
+	})
+	t.Run("root capability not found", func(t *testing.T) {
+		svc := newTestServiceWithCapabilities(t)
+
+		err := svc.Revoke("vault1", "urn:uuid:capability", "")
+		require.True(t, errors.Is(err, ErrCapabilityNotFound))
+	})
+}
+
+func TestService_CheckControllerAuthority(t *testing.T) {
+	svc := newTestServiceWithCapabilities(t, "vault1", "vault2")
+	controller := controllerCapability(t, svc, "vault1")
+
+	rootCapability, err := svc.getCapability("vault1")
+	require.NoError(t, err)
+
+	childBytes, err := svc.Delegate("vault1", &Delegation{Parent: controller.ID, Invoker: "did:key:z1"})
+	require.NoError(t, err)
+
+	child, err := zcapld.ParseCapability(childBytes)
+	require.NoError(t, err)
+
+	for _, capabilityID := range []string{rootCapability.ID, controller.ID} {
+		require.NoError(t, svc.CheckControllerAuthority("vault1", capabilityID))
+	}
+
+	for _, capabilityID := range []string{"", "urn:uuid:other", child.ID, controllerCapability(t, svc, "vault2").ID} {
+		err = svc.CheckControllerAuthority("vault1", capabilityID)
+		require.True(t, errors.Is(err, ErrActionNotAllowed), capabilityID)
+	}
+
+	err = svc.CheckControllerAuthority("vault3", controller.ID)
+	require.True(t, errors.Is(err, ErrCapabilityNotFound))
+}
+
+func TestService_CheckInvocation(t *testing.T) {
+	svc := newTestServiceWithCapabilities(t, "vault1")
+
+	documentCapabilityBytes, err := svc.Delegate("vault1", &Delegation{Invoker: "did:key:z1", DocumentID: "doc1"})
+	require.NoError(t, err)
+
+	documentCapability, err := zcapld.ParseCapability(documentCapabilityBytes)
+	require.NoError(t, err)
+
+	t.Run("no invocation", func(t *testing.T) {
+		restrictions, err := svc.checkInvocation("vault1", httptest.NewRequest(http.MethodGet,
+			"/encrypted-data-vaults/vault1/documents/doc2", nil))
+		require.NoError(t, err)
+		require.Nil(t, restrictions)
+	})
+	t.Run("capability scoped to the requested document", func(t *testing.T) {
+		for _, path := range []string{
+			"/encrypted-data-vaults/vault1/documents/doc1", "/encrypted-data-vaults/vault1/documents/doc1/restore",
+		} {
+			req := newInvocationRequest(t, http.MethodGet, path, documentCapability)
+
+			restrictions, err := svc.checkInvocation("vault1", req)
+			require.NoError(t, err)
+			require.Nil(t, restrictions)
+		}
+	})
+	t.Run("capability scoped to another document", func(t *testing.T) {
+		for _, path := range []string{
+			"/encrypted-data-vaults/vault1/documents/doc2", "/encrypted-data-vaults/vault1/query",
+		} {
+			req := newInvocationRequest(t, http.MethodPost, path, documentCapability)
+
+			_, err := svc.checkInvocation("vault1", req)
+			require.True(t, errors.Is(err, ErrActionNotAllowed), path)
+		}
+	})
+	t.Run("capability delegated from a document scoped capability", func(t *testing.T) {
+		// A client delegating a capability for the whole vault from a document scoped capability doesn't lift the
+		// restriction, since the stored capabilities in the chain are checked too.
+		capability := &zcapld.Capability{
+			ID: "urn:uuid:client-delegated", Parent: documentCapability.ID,
+			InvocationTarget: zcapld.InvocationTarget{ID: "vault1", Type: edvResource},
+			Proof: []verifiable.Proof{{
+				proofPurposeField:         zcapld.ProofPurpose,
+				proofCapabilityChainField: chainLinks(append(capabilityChain(documentCapability), documentCapability.ID)),
+			}},
+		}
+
+		req := newInvocationRequest(t, http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc2", capability)
+
+		_, err := svc.checkInvocation("vault1", req)
+		require.True(t, errors.Is(err, ErrActionNotAllowed))
+	})
+	t.Run("restrictions of the capability chain", func(t *testing.T) {
+		attribute := auth.Attribute{Name: "name", Value: "value"}
+
+		capabilityBytes, err := svc.Delegate("vault1", &Delegation{
+			Invoker: "did:key:z1", Operations: []string{auth.OperationRead, auth.OperationQuery}, Attribute: &attribute,
+		})
+		require.NoError(t, err)
+
+		capability, err := zcapld.ParseCapability(capabilityBytes)
+		require.NoError(t, err)
+
+		childBytes, err := svc.Delegate("vault1", &Delegation{
+			Parent: capability.ID, Invoker: "did:key:z2", Operations: []string{auth.OperationRead},
+		})
+		require.NoError(t, err)
+
+		child, err := zcapld.ParseCapability(childBytes)
+		require.NoError(t, err)
+
+		// The invoker removing the caveats of the invoked capability doesn't lift its restrictions, since the caveats
+		// of the stored copy are checked.
+		child.Caveats = nil
+
+		req := newInvocationRequest(t, http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", child)
+
+		restrictions, err := svc.checkInvocation("vault1", req)
+		require.NoError(t, err)
+		require.Equal(t, &auth.Restrictions{
+			Operations: []string{auth.OperationRead}, Attributes: []auth.Attribute{attribute},
+		}, restrictions)
+	})
+	t.Run("revoked capability", func(t *testing.T) {
+		capabilityBytes, err := svc.Delegate("vault1", &Delegation{Invoker: "did:key:z1"})
+		require.NoError(t, err)
+
+		capability, err := zcapld.ParseCapability(capabilityBytes)
+		require.NoError(t, err)
+
+		childBytes, err := svc.Delegate("vault1", &Delegation{Parent: capability.ID, Invoker: "did:key:z2"})
+		require.NoError(t, err)
+
+		child, err := zcapld.ParseCapability(childBytes)
+		require.NoError(t, err)
+
+		req := newInvocationRequest(t, http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", child)
+		_, err = svc.checkInvocation("vault1", req)
+		require.NoError(t, err)
+
+		require.NoError(t, svc.Revoke("vault1", capability.ID, ""))
+
+		_, err = svc.checkInvocation("vault1", req)
+		require.True(t, errors.Is(err, ErrCapabilityRevoked))
+		require.Equal(t, http.StatusForbidden, HTTPStatus(err))
+	})
+	t.Run("invalid invocation", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", nil)
+		req.Header.Set(zcapld.CapabilityInvocationHTTPHeader, `zcap capability="invalid",action="read"`)
+
+		_, err := svc.checkInvocation("vault1", req)
+		require.True(t, errors.Is(err, ErrInvocationInvalid))
+	})
+	t.Run("failed to get revocation", func(t *testing.T) {
+		req := newInvocationRequest(t, http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1",
+			documentCapability)
+
+		_, err := (&Service{store: &mock.Store{ErrGet: errors.New("get error")}}).checkInvocation("vault1", req)
+		require.EqualError(t, err, fmt.Sprintf("failed to get revocation of capability %s: get error",
+			capabilityChain(documentCapability)[0]))
+	})
+}
+
+func TestInvokedCapability(t *testing.T) {
+	capability := &zcapld.Capability{ID: "urn:uuid:capability"}
+
+	req := newInvocationRequest(t, http.MethodGet, "/encrypted-data-vaults/vault1", capability)
+
+	invokedCapability, err := InvokedCapability(req)
+	require.NoError(t, err)
+	require.Equal(t, capability.ID, invokedCapability.ID)
+
+	invokedCapability, err = InvokedCapability(httptest.NewRequest(http.MethodGet, "/", nil))
+	require.NoError(t, err)
+	require.Nil(t, invokedCapability)
+}
+
+func TestInvoker(t *testing.T) {
+	require.Equal(t, "did:example:alice#key1", invoker(newInvocationRequest(t, http.MethodGet,
+		"/encrypted-data-vaults/vault1", &zcapld.Capability{ID: "urn:uuid:1", Invoker: "did:example:alice#key1"})))
+	require.Equal(t, "did:example:bob", invoker(newInvocationRequest(t, http.MethodGet,
+		"/encrypted-data-vaults/vault1", &zcapld.Capability{ID: "urn:uuid:2", Controller: "did:example:bob"})))
+	require.Empty(t, invoker(httptest.NewRequest(http.MethodGet, "/", nil)))
+}
+
+// controllerCapability returns the capability that was delegated to the vault's controller by Create.
+func controllerCapability(t *testing.T, svc *Service, resourceID string) *zcapld.Capability {
+	t.Helper()
+
+	capabilities, err := svc.ExportCapabilities(resourceID)
+	require.NoError(t, err)
+
+	for _, capabilityBytes := range capabilities {
+		capability, err := zcapld.ParseCapability(capabilityBytes)
+		require.NoError(t, err)
+
+		if capability.Parent != "" {
+			return capability
+		}
+	}
+
+	require.FailNow(t, "no delegated capability for resource "+resourceID)
+
+	return nil
+}
+
+func newInvocationRequest(t *testing.T, method, path string, capability *zcapld.Capability) *http.Request {
+	t.Helper()
+
+	compressedCapability, err := zcapld.CompressZCAP(capability)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set(zcapld.CapabilityInvocationHTTPHeader,
+		fmt.Sprintf(`zcap capability="%s",action="read"`, compressedCapability))
+
+	return req
+}
@@ -0,0 +1,149 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package zcapld
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/trustbloc/edv/pkg/logging"
+)
+
+var (
+	// ErrCapabilityNotFound is returned when a capability referenced by a request (including the root capability of
+	// the vault being accessed) doesn't exist.
+	ErrCapabilityNotFound = errors.New("capability not found")
+	// ErrInvocationInvalid is returned when a request's capability invocation can't be authenticated, for example
+	// because the HTTP signature is missing or wrong, the invocation headers are malformed, or a proof in the
+	// capability chain doesn't verify.
+	ErrInvocationInvalid = errors.New("capability invocation is invalid")
+	// ErrActionNotAllowed is returned when a valid capability is invoked for an action it doesn't grant.
+	ErrActionNotAllowed = errors.New("action not allowed by capability")
+	// ErrCapabilityRevoked is returned when a request invokes a capability that was revoked, or that was delegated
+	// from a revoked capability.
+	ErrCapabilityRevoked = errors.New("capability revoked")
+	// ErrDelegationInvalid is returned when a capability can't be delegated or revoked as requested, for example
+	// because the delegated capability would grant more than its parent.
+	ErrDelegationInvalid = errors.New("capability delegation is invalid")
+	// ErrCapabilityLimitExceeded is returned when a request invokes a capability that goes over the configured
+	// limits, for example because it was delegated through too many capabilities (see Limits).
+	ErrCapabilityLimitExceeded = errors.New("capability limits exceeded")
+)
+
+// Error codes used in ErrorResponse.
+const (
+	ErrorCodeCapabilityNotFound = "capability_not_found"
+	ErrorCodeInvocationInvalid  = "invocation_invalid"
+	ErrorCodeActionNotAllowed   = "action_not_allowed"
+	ErrorCodeCapabilityRevoked  = "capability_revoked"
+	ErrorCodeDelegationInvalid  = "delegation_invalid"
+	ErrorCodeLimitExceeded      = "capability_limit_exceeded"
+	ErrorCodeInternal           = "internal_error"
+)
+
+// Prefixes of the errors passed to the ErrConsumer by the edge-core zcapld middleware, which doesn't expose
+// typed errors of its own.
+const (
+	middlewareHTTPSigErrPrefix     = "failed to verify http signature"
+	middlewareProofParamsErrPrefix = "failed to parse proof params"
+	middlewareVerifyZCAPErrPrefix  = "failed to verify zcap"
+	capabilityActionErrPrefix      = `capability action "`
+)
+
+// ErrorResponse is the body of the responses sent when a request fails authorization.
+type ErrorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	// CorrelationID is the correlation ID of the request (see logging.Middleware), if it has one, so that the failure
+	// can be found in the server's logs.
+	CorrelationID string `json:"correlationID,omitempty"`
+}
+
+// HTTPStatus returns the HTTP status code to use for the given authorization error.
+func HTTPStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvocationInvalid):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrCapabilityNotFound), errors.Is(err, ErrActionNotAllowed),
+		errors.Is(err, ErrCapabilityRevoked), errors.Is(err, ErrCapabilityLimitExceeded):
+		return http.StatusForbidden
+	case errors.Is(err, ErrDelegationInvalid):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// WriteError writes the given authorization error to w as an ErrorResponse, using the status code from HTTPStatus.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(logging.FromContext(r.Context(), logger), w, r, err)
+}
+
+func writeError(logger logging.Logger, w http.ResponseWriter, r *http.Request, err error) {
+	statusCode := HTTPStatus(err)
+
+	logger.Infof("Request failed authorization with status code %d: %s", statusCode, err)
+
+	responseBytes, errMarshal := json.Marshal(ErrorResponse{
+		Error: errorCode(err), Message: err.Error(), CorrelationID: logging.CorrelationID(r.Context()),
+	})
+	if errMarshal != nil {
+		logger.Errorf("Failed to marshal authorization error response: %s", errMarshal)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	_, errWrite := w.Write(responseBytes)
+	if errWrite != nil {
+		logger.Errorf(errWrite.Error())
+	}
+}
+
+func errorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrCapabilityNotFound):
+		return ErrorCodeCapabilityNotFound
+	case errors.Is(err, ErrInvocationInvalid):
+		return ErrorCodeInvocationInvalid
+	case errors.Is(err, ErrActionNotAllowed):
+		return ErrorCodeActionNotAllowed
+	case errors.Is(err, ErrCapabilityRevoked):
+		return ErrorCodeCapabilityRevoked
+	case errors.Is(err, ErrDelegationInvalid):
+		return ErrorCodeDelegationInvalid
+	case errors.Is(err, ErrCapabilityLimitExceeded):
+		return ErrorCodeLimitExceeded
+	default:
+		return ErrorCodeInternal
+	}
+}
+
+// classifyMiddlewareError wraps an error from the zcapld middleware with the matching typed error.
+// Errors that don't indicate an authorization failure (e.g. the verifier failing to initialize) are returned as-is.
+func classifyMiddlewareError(err error) error {
+	message := err.Error()
+
+	switch {
+	case errors.Is(err, ErrCapabilityNotFound), errors.Is(err, ErrCapabilityLimitExceeded):
+		return err
+	case strings.HasPrefix(message, middlewareHTTPSigErrPrefix),
+		strings.HasPrefix(message, middlewareProofParamsErrPrefix):
+		return fmt.Errorf("%w: %s", ErrInvocationInvalid, message)
+	case strings.HasPrefix(message, middlewareVerifyZCAPErrPrefix):
+		if strings.Contains(message, capabilityActionErrPrefix) {
+			return fmt.Errorf("%w: %s", ErrActionNotAllowed, message)
+		}
+
+		return fmt.Errorf("%w: %s", ErrInvocationInvalid, message)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package zcapld
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/logging"
+)
+
+func TestHTTPStatus(t *testing.T) {
+	require.Equal(t, http.StatusForbidden, HTTPStatus(fmt.Errorf("wrapped: %w", ErrCapabilityNotFound)))
+	require.Equal(t, http.StatusUnauthorized, HTTPStatus(fmt.Errorf("wrapped: %w", ErrInvocationInvalid)))
+	require.Equal(t, http.StatusForbidden, HTTPStatus(fmt.Errorf("wrapped: %w", ErrActionNotAllowed)))
+	require.Equal(t, http.StatusForbidden, HTTPStatus(fmt.Errorf("wrapped: %w", ErrCapabilityRevoked)))
+	require.Equal(t, http.StatusBadRequest, HTTPStatus(fmt.Errorf("wrapped: %w", ErrDelegationInvalid)))
+	require.Equal(t, http.StatusForbidden, HTTPStatus(fmt.Errorf("wrapped: %w", ErrCapabilityLimitExceeded)))
+	require.Equal(t, http.StatusInternalServerError, HTTPStatus(errors.New("db failure")))
+}
+
+func TestWriteError(t *testing.T) {
+	t.Run("typed error", func(t *testing.T) {
+		responseRecorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+
+		WriteError(responseRecorder, request, fmt.Errorf("%w: r1", ErrCapabilityNotFound))
+
+		require.Equal(t, http.StatusForbidden, responseRecorder.Code)
+		require.Equal(t, "application/json", responseRecorder.Header().Get("Content-Type"))
+
+		var errorResponse ErrorResponse
+
+		require.NoError(t, json.Unmarshal(responseRecorder.Body.Bytes(), &errorResponse))
+		require.Equal(t, ErrorResponse{Error: ErrorCodeCapabilityNotFound, Message: "capability not found: r1"},
+			errorResponse)
+	})
+
+	t.Run("untyped error", func(t *testing.T) {
+		responseRecorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+
+		WriteError(responseRecorder, request, errors.New("db failure"))
+
+		require.Equal(t, http.StatusInternalServerError, responseRecorder.Code)
+
+		var errorResponse ErrorResponse
+
+		require.NoError(t, json.Unmarshal(responseRecorder.Body.Bytes(), &errorResponse))
+		require.Equal(t, ErrorResponse{Error: ErrorCodeInternal, Message: "db failure"}, errorResponse)
+	})
+
+	t.Run("correlation ID", func(t *testing.T) {
+		responseRecorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request = request.WithContext(logging.NewContext(request.Context(), "correlation-1"))
+
+		WriteError(responseRecorder, request, fmt.Errorf("%w: r1", ErrCapabilityNotFound))
+
+		var errorResponse ErrorResponse
+
+		require.NoError(t, json.Unmarshal(responseRecorder.Body.Bytes(), &errorResponse))
+		require.Equal(t, "correlation-1", errorResponse.CorrelationID)
+	})
+}
+
+func TestClassifyMiddlewareError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		expectedErr error
+	}{
+		{
+			name:        "bad http signature",
+			err:         errors.New("failed to verify http signature: signature not found"),
+			expectedErr: ErrInvocationInvalid,
+		},
+		{
+			name:        "malformed invocation header",
+			err:         errors.New(`failed to parse proof params: "capability-invocation" header is missing`),
+			expectedErr: ErrInvocationInvalid,
+		},
+		{
+			name: "action not allowed",
+			err: errors.New(`failed to verify zcap: capability action "write" is not allowed by the capability; ` +
+				"allowed actions are: [read]"),
+			expectedErr: ErrActionNotAllowed,
+		},
+		{
+			name:        "invalid capability chain",
+			err:         errors.New("failed to verify zcap: invalid capability chain: chain is empty"),
+			expectedErr: ErrInvocationInvalid,
+		},
+		{
+			name:        "capability not found",
+			err:         fmt.Errorf("failed to verify zcap: failed to resolve root capability: %w", ErrCapabilityNotFound),
+			expectedErr: ErrCapabilityNotFound,
+		},
+		{
+			name: "capability limit exceeded",
+			err: fmt.Errorf("failed to verify zcap: failed to resolve capability c1: %w",
+				ErrCapabilityLimitExceeded),
+			expectedErr: ErrCapabilityLimitExceeded,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			err := classifyMiddlewareError(tc.err)
+			require.True(t, errors.Is(err, tc.expectedErr))
+			require.Contains(t, err.Error(), tc.err.Error())
+		})
+	}
+
+	t.Run("other error", func(t *testing.T) {
+		errVerifier := errors.New("middleware failed to init verifier: some failure")
+
+		require.Equal(t, errVerifier, classifyMiddlewareError(errVerifier))
+	})
+}
@@ -0,0 +1,120 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package zcapld
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/trustbloc/edge-core/pkg/zcapld"
+)
+
+// Limits bounds the capabilities that requests can invoke. They're checked before any proof in the capability
+// chain is verified, so that a maliciously large capability or deep capability chain is rejected without spending
+// CPU on it. A limit of zero means there's no limit.
+type Limits struct {
+	// MaxChainLength is the maximum number of capabilities that an invoked capability can have been delegated
+	// through, including the root capability.
+	MaxChainLength int
+	// MaxCaveats is the maximum number of caveats that a capability can have.
+	MaxCaveats int
+	// MaxDocumentSize is the maximum size in bytes of a capability, once decompressed from the
+	// capability-invocation header.
+	MaxDocumentSize int
+}
+
+// Option configures the service.
+type Option func(svc *Service)
+
+// WithLimits sets the limits on the capabilities that requests can invoke.
+func WithLimits(limits Limits) Option {
+	return func(svc *Service) {
+		svc.limits = limits
+	}
+}
+
+// checkLimits checks the capability invoked by the request, if any, against the service's limits.
+// An error wrapping ErrCapabilityLimitExceeded is returned if the capability goes over a limit.
+func (s *Service) checkLimits(req *http.Request) error {
+	if s.limits == (Limits{}) {
+		return nil
+	}
+
+	compressed := invokedCapabilityParam(req)
+	if compressed == "" {
+		return nil
+	}
+
+	capability, err := decompressCapability(compressed, s.limits.MaxDocumentSize)
+	if err != nil {
+		return err
+	}
+
+	return s.checkCapabilityLimits(capability)
+}
+
+func (s *Service) checkCapabilityLimits(capability *zcapld.Capability) error {
+	chainLength := len(capabilityChain(capability))
+
+	if s.limits.MaxChainLength > 0 && chainLength > s.limits.MaxChainLength {
+		return fmt.Errorf("%w: capability %s was delegated through %d capabilities, more than the maximum of %d",
+			ErrCapabilityLimitExceeded, capability.ID, chainLength, s.limits.MaxChainLength)
+	}
+
+	if s.limits.MaxCaveats > 0 && len(capability.Caveats) > s.limits.MaxCaveats {
+		return fmt.Errorf("%w: capability %s has %d caveats, more than the maximum of %d",
+			ErrCapabilityLimitExceeded, capability.ID, len(capability.Caveats), s.limits.MaxCaveats)
+	}
+
+	return nil
+}
+
+// decompressCapability decodes a capability as compressed in a capability-invocation header (see
+// zcapld.CompressZCAP). Unlike zcapld.DecompressZCAP, it stops decompressing once maxSize bytes have been read,
+// so that a small header can't decompress into a huge document. A maxSize of zero means there's no limit.
+func decompressCapability(compressed string, maxSize int) (*zcapld.Capability, error) {
+	decoded, err := base64.URLEncoding.DecodeString(compressed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to base64URL-decode invoked capability: %s", ErrInvocationInvalid, err)
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(decoded))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decompress invoked capability: %s", ErrInvocationInvalid, err)
+	}
+
+	var limitedReader io.Reader = reader
+
+	if maxSize > 0 {
+		limitedReader = io.LimitReader(reader, int64(maxSize)+1)
+	}
+
+	capabilityBytes, err := ioutil.ReadAll(limitedReader)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decompress invoked capability: %s", ErrInvocationInvalid, err)
+	}
+
+	if maxSize > 0 && len(capabilityBytes) > maxSize {
+		return nil, fmt.Errorf("%w: the invoked capability is larger than the maximum of %d bytes",
+			ErrCapabilityLimitExceeded, maxSize)
+	}
+
+	var capability zcapld.Capability
+
+	err = json.Unmarshal(capabilityBytes, &capability)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal invoked capability: %s", ErrInvocationInvalid, err)
+	}
+
+	return &capability, nil
+}
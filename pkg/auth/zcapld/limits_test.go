@@ -0,0 +1,137 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package zcapld
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/pkg/doc/verifiable"
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/edge-core/pkg/zcapld"
+)
+
+func TestService_CheckLimits(t *testing.T) {
+	t.Run("capability within the limits", func(t *testing.T) {
+		svc := &Service{limits: Limits{MaxChainLength: 3, MaxCaveats: 1, MaxDocumentSize: 1000}}
+
+		req := newInvocationRequest(t, http.MethodGet, "/", delegatedCapability(3, 1))
+		require.NoError(t, svc.checkLimits(req))
+	})
+	t.Run("no limits", func(t *testing.T) {
+		svc := &Service{}
+
+		req := newInvocationRequest(t, http.MethodGet, "/", delegatedCapability(100, 100))
+		require.NoError(t, svc.checkLimits(req))
+	})
+	t.Run("no invocation", func(t *testing.T) {
+		svc := &Service{limits: Limits{MaxChainLength: 1}}
+
+		require.NoError(t, svc.checkLimits(httptest.NewRequest(http.MethodGet, "/", nil)))
+	})
+	t.Run("capability chain too long", func(t *testing.T) {
+		svc := &Service{limits: Limits{MaxChainLength: 3}}
+
+		err := svc.checkLimits(newInvocationRequest(t, http.MethodGet, "/", delegatedCapability(4, 0)))
+		require.True(t, errors.Is(err, ErrCapabilityLimitExceeded))
+		require.Contains(t, err.Error(), "delegated through 4 capabilities, more than the maximum of 3")
+	})
+	t.Run("too many caveats", func(t *testing.T) {
+		svc := &Service{limits: Limits{MaxCaveats: 1}}
+
+		err := svc.checkLimits(newInvocationRequest(t, http.MethodGet, "/", delegatedCapability(1, 2)))
+		require.True(t, errors.Is(err, ErrCapabilityLimitExceeded))
+		require.Contains(t, err.Error(), "has 2 caveats, more than the maximum of 1")
+	})
+	t.Run("capability too large", func(t *testing.T) {
+		svc := &Service{limits: Limits{MaxDocumentSize: 100}}
+
+		capability := delegatedCapability(1, 0)
+		capability.Invoker = strings.Repeat("a", 1000)
+
+		err := svc.checkLimits(newInvocationRequest(t, http.MethodGet, "/", capability))
+		require.True(t, errors.Is(err, ErrCapabilityLimitExceeded))
+		require.Contains(t, err.Error(), "larger than the maximum of 100 bytes")
+	})
+	t.Run("invalid invocation", func(t *testing.T) {
+		svc := &Service{limits: Limits{MaxChainLength: 1}}
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(zcapld.CapabilityInvocationHTTPHeader, `zcap capability="invalid",action="read"`)
+
+		require.True(t, errors.Is(svc.checkLimits(req), ErrInvocationInvalid))
+	})
+}
+
+func TestService_HandlerLimits(t *testing.T) {
+	svc := newTestServiceWithCapabilities(t, "vault1")
+	svc.limits = Limits{MaxChainLength: 1}
+
+	rw := httptest.NewRecorder()
+
+	handler, err := svc.Handler("vault1", httptest.NewRequest(http.MethodGet, "/", nil), rw,
+		func(http.ResponseWriter, *http.Request) {
+			require.FailNow(t, "the request shouldn't be handled")
+		})
+	require.NoError(t, err)
+
+	handler(rw, newInvocationRequest(t, http.MethodGet, "/encrypted-data-vaults/vault1", delegatedCapability(2, 0)))
+
+	require.Equal(t, http.StatusForbidden, rw.Code)
+
+	var response ErrorResponse
+
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &response))
+	require.Equal(t, ErrorCodeLimitExceeded, response.Error)
+}
+
+func TestService_DelegateLimits(t *testing.T) {
+	svc := newTestServiceWithCapabilities(t, "vault1")
+	svc.limits = Limits{MaxChainLength: 2}
+
+	// The controller's capability is delegated from the root capability, so its chain has one capability.
+	parent := controllerCapability(t, svc, "vault1")
+
+	capabilityBytes, err := svc.Delegate("vault1", &Delegation{Parent: parent.ID, Invoker: "did:key:z1"})
+	require.NoError(t, err)
+
+	capability, err := zcapld.ParseCapability(capabilityBytes)
+	require.NoError(t, err)
+
+	_, err = svc.Delegate("vault1", &Delegation{Parent: capability.ID, Invoker: "did:key:z2"})
+	require.True(t, errors.Is(err, ErrDelegationInvalid))
+	require.Contains(t, err.Error(), "more than the maximum of 2 capabilities")
+
+	// Capabilities in the chain are checked as they're resolved.
+	svc.limits = Limits{MaxChainLength: 1}
+
+	_, err = capabilityResolver{svc: svc}.Resolve(capability.ID)
+	require.True(t, errors.Is(err, ErrCapabilityLimitExceeded))
+}
+
+// delegatedCapability returns a capability delegated through chainLength capabilities, with the given number of
+// caveats.
+func delegatedCapability(chainLength, caveats int) *zcapld.Capability {
+	chain := make([]interface{}, chainLength)
+	for i := range chain {
+		chain[i] = "urn:uuid:" + strings.Repeat("c", i+1)
+	}
+
+	return &zcapld.Capability{
+		ID:      "urn:uuid:capability",
+		Parent:  chain[len(chain)-1].(string),
+		Caveats: make([]zcapld.Caveat, caveats),
+		Proof: []verifiable.Proof{{
+			proofPurposeField:         zcapld.ProofPurpose,
+			proofCapabilityChainField: chain,
+		}},
+	}
+}
@@ -8,6 +8,7 @@ package zcapld
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -22,16 +23,24 @@ import (
 	"github.com/hyperledger/aries-framework-go/pkg/vdr/fingerprint"
 	ariesstorage "github.com/hyperledger/aries-framework-go/spi/storage"
 	"github.com/piprate/json-gold/ld"
-	"github.com/trustbloc/edge-core/pkg/log"
 	"github.com/trustbloc/edge-core/pkg/zcapld"
+
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/logging"
 )
 
 const (
 	storeName   = "zcap_capability"
 	edvResource = "urn:edv:vault"
+
+	// rootCapabilityTagName tags root capabilities with the ID of the resource (vault) they're for.
+	rootCapabilityTagName = "RootCapability"
+	// resourceTagName tags every stored capability (including the root capability entry keyed by the resource ID)
+	// with the ID of the resource it's for, so they can all be removed once the resource is gone.
+	resourceTagName = "Resource"
 )
 
-var logger = log.New("auth-zcap-service")
+var logger = logging.New("auth-zcap-service")
 
 // Service to provide zcapld functionality
 type Service struct {
@@ -40,19 +49,49 @@ type Service struct {
 	store        ariesstorage.Store
 	jsonLDLoader ld.DocumentLoader
 	vdrResolver  zcapld.VDRResolver
+	limits       Limits
+	logger       logging.Logger
 }
 
 // New return zcap service
 func New(keyManager kms.KeyManager, crypto cryptoapi.Crypto, storeProv ariesstorage.Provider,
-	jsonLDLoader ld.DocumentLoader, vdrResolver zcapld.VDRResolver) (*Service, error) {
+	jsonLDLoader ld.DocumentLoader, vdrResolver zcapld.VDRResolver, opts ...Option) (*Service, error) {
 	store, err := storeProv.OpenStore(storeName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open store %s: %w", storeName, err)
 	}
 
-	return &Service{
+	err = storeProv.SetStoreConfig(storeName,
+		ariesstorage.StoreConfiguration{TagNames: []string{rootCapabilityTagName, resourceTagName}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set store config for %s: %w", storeName, err)
+	}
+
+	svc := &Service{
 		keyManager: keyManager, crypto: crypto, store: store, jsonLDLoader: jsonLDLoader, vdrResolver: vdrResolver,
-	}, nil
+	}
+
+	for _, opt := range opts {
+		opt(svc)
+	}
+
+	return svc, nil
+}
+
+// WithLogger has the service log with the given logger instead of the edge-core logger for its module.
+func WithLogger(logger logging.Logger) Option {
+	return func(svc *Service) {
+		svc.logger = logger
+	}
+}
+
+// log returns the service's logger, or the edge-core logger if none was given.
+func (s *Service) log() logging.Logger {
+	if s.logger == nil {
+		return logger
+	}
+
+	return s.logger
 }
 
 // Create zcap payload
@@ -62,19 +101,13 @@ func (s *Service) Create(resourceID, verificationMethod string) ([]byte, error)
 		return nil, err
 	}
 
-	signer, err := signature.NewCryptoSigner(s.crypto, s.keyManager, kms.ED25519)
+	signer, err := s.newSigner()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create crypto signer: %w", err)
+		return nil, err
 	}
 
-	_, didKeyURL := fingerprint.CreateDIDKey(signer.PublicKeyBytes())
-
-	capability, err := zcapld.NewCapability(&zcapld.Signer{
-		SignatureSuite:     ed25519signature2018.New(suite.WithSigner(signer)),
-		SuiteType:          ed25519signature2018.SignatureType,
-		VerificationMethod: didKeyURL,
-		ProcessorOpts:      []jsonld.ProcessorOpts{jsonld.WithDocumentLoader(s.jsonLDLoader)},
-	}, zcapld.WithParent(rootCapability.ID), zcapld.WithInvoker(verificationMethod),
+	capability, err := zcapld.NewCapability(signer,
+		zcapld.WithParent(rootCapability.ID), zcapld.WithInvoker(verificationMethod),
 		zcapld.WithAllowedActions("read", "write"), zcapld.WithInvocationTarget(resourceID, edvResource),
 		zcapld.WithCapabilityChain(rootCapability.ID))
 	if err != nil {
@@ -86,14 +119,22 @@ func (s *Service) Create(resourceID, verificationMethod string) ([]byte, error)
 		return nil, fmt.Errorf("failed to marshal capability: %w", err)
 	}
 
-	if err := s.store.Put(capability.ID, capabilityBytes); err != nil {
+	if err := s.store.Put(capability.ID, capabilityBytes,
+		ariesstorage.Tag{Name: resourceTagName, Value: resourceID}); err != nil {
 		return nil, fmt.Errorf("failed to store capability: %w", err)
 	}
 
 	return capabilityBytes, nil
 }
 
-// Handler will create auth handler
+// Handler will create auth handler.
+// Authorization failures are written to w as an ErrorResponse, with a 401 or 403 status code (see HTTPStatus).
+// Besides the checks done by the zcapld middleware, the handler rejects invocations of revoked capabilities
+// (see Revoke) and of capabilities scoped to a document other than the one requested (see Delegation).
+// Authorized requests are passed to next with the invoker of their capability as their actor (see auth.Actor), and
+// with the restrictions of the EDV caveats of their capability chain (see auth.RestrictionsFrom).
+// Invoked capabilities that go over the service's limits (see WithLimits) are rejected before their capability
+// chain is verified.
 func (s *Service) Handler(resourceID string, req *http.Request, w http.ResponseWriter,
 	next http.HandlerFunc) (http.HandlerFunc, error) {
 	rootCapability, err := s.getCapability(resourceID)
@@ -102,11 +143,15 @@ func (s *Service) Handler(resourceID string, req *http.Request, w http.ResponseW
 	}
 
 	action := "write"
-	if req.Method == http.MethodGet {
+	if auth.IsRead(req) {
 		action = "read"
 	}
 
-	return zcapld.NewHTTPSigAuthHandler(
+	authResponseWriter := &authResponseWriter{
+		ResponseWriter: w, request: req, logger: logging.FromContext(req.Context(), s.log()),
+	}
+
+	authHandler := zcapld.NewHTTPSigAuthHandler(
 		&zcapld.HTTPSigAuthConfig{
 			CapabilityResolver: capabilityResolver{svc: s},
 			KeyResolver:        zcapld.NewDIDKeyResolver(s.vdrResolver),
@@ -118,7 +163,7 @@ func (s *Service) Handler(resourceID string, req *http.Request, w http.ResponseW
 				), zcapld.WithLDDocumentLoaders(s.jsonLDLoader),
 			},
 			Secrets:     &zcapld.AriesDIDKeySecrets{},
-			ErrConsumer: logError{w: w}.Log,
+			ErrConsumer: authResponseWriter.writeError,
 			KMS:         s.keyManager,
 			Crypto:      s.crypto,
 		},
@@ -127,27 +172,46 @@ func (s *Service) Handler(resourceID string, req *http.Request, w http.ResponseW
 			RootCapability: rootCapability.ID,
 			Action:         action,
 		},
-		next,
-	), nil
+		func(rw http.ResponseWriter, r *http.Request) {
+			restrictions, err := s.checkInvocation(resourceID, r)
+			if err != nil {
+				writeError(logging.FromContext(r.Context(), s.log()), rw, r, err)
+
+				return
+			}
+
+			ctx := auth.WithActor(r.Context(), invoker(r))
+
+			if restrictions != nil {
+				ctx = auth.WithRestrictions(ctx, restrictions)
+			}
+
+			next(rw, r.WithContext(ctx))
+		},
+	)
+
+	return func(_ http.ResponseWriter, r *http.Request) {
+		if err := s.checkLimits(r); err != nil {
+			writeError(logging.FromContext(r.Context(), s.log()), w, r, err)
+
+			return
+		}
+
+		authHandler(authResponseWriter, r)
+	}, nil
 }
 
 func (s *Service) createRootCapability(resourceID string) (*zcapld.Capability, error) {
 	// create root capability and store in db
-	signer, err := signature.NewCryptoSigner(s.crypto, s.keyManager, kms.ED25519)
+	signer, err := s.newSigner()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create crypto signer: %w", err)
+		return nil, err
 	}
 
 	rootID := uuid.New().URN()
 
-	_, didKeyURL := fingerprint.CreateDIDKey(signer.PublicKeyBytes())
-
-	rootCapability, err := zcapld.NewCapability(&zcapld.Signer{
-		SignatureSuite:     ed25519signature2018.New(suite.WithSigner(signer)),
-		SuiteType:          ed25519signature2018.SignatureType,
-		VerificationMethod: didKeyURL,
-		ProcessorOpts:      []jsonld.ProcessorOpts{jsonld.WithDocumentLoader(s.jsonLDLoader)},
-	}, zcapld.WithID(rootID), zcapld.WithInvocationTarget(resourceID, edvResource),
+	rootCapability, err := zcapld.NewCapability(signer,
+		zcapld.WithID(rootID), zcapld.WithInvocationTarget(resourceID, edvResource),
 		zcapld.WithAllowedActions("read", "write"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new root capability: %w", err)
@@ -158,20 +222,44 @@ func (s *Service) createRootCapability(resourceID string) (*zcapld.Capability, e
 		return nil, fmt.Errorf("failed to marshal root capability: %w", err)
 	}
 
-	if err := s.store.Put(rootCapability.ID, rootCapabilityBytes); err != nil {
+	if err := s.store.Put(rootCapability.ID, rootCapabilityBytes,
+		ariesstorage.Tag{Name: rootCapabilityTagName, Value: resourceID},
+		ariesstorage.Tag{Name: resourceTagName, Value: resourceID}); err != nil {
 		return nil, fmt.Errorf("failed to store root capability: %w", err)
 	}
 
-	if err := s.store.Put(resourceID, rootCapabilityBytes); err != nil {
+	if err := s.store.Put(resourceID, rootCapabilityBytes,
+		ariesstorage.Tag{Name: resourceTagName, Value: resourceID}); err != nil {
 		return nil, fmt.Errorf("failed to store root capability: %w", err)
 	}
 
 	return rootCapability, nil
 }
 
+// newSigner returns a signer for a new capability, using a newly created key.
+func (s *Service) newSigner() (*zcapld.Signer, error) {
+	signer, err := signature.NewCryptoSigner(s.crypto, s.keyManager, kms.ED25519)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create crypto signer: %w", err)
+	}
+
+	_, didKeyURL := fingerprint.CreateDIDKey(signer.PublicKeyBytes())
+
+	return &zcapld.Signer{
+		SignatureSuite:     ed25519signature2018.New(suite.WithSigner(signer)),
+		SuiteType:          ed25519signature2018.SignatureType,
+		VerificationMethod: didKeyURL,
+		ProcessorOpts:      []jsonld.ProcessorOpts{jsonld.WithDocumentLoader(s.jsonLDLoader)},
+	}, nil
+}
+
 func (s *Service) getCapability(id string) (*zcapld.Capability, error) {
 	bytes, err := s.store.Get(id)
 	if err != nil {
+		if errors.Is(err, ariesstorage.ErrDataNotFound) {
+			return nil, fmt.Errorf("%w: %s: %s", ErrCapabilityNotFound, id, err)
+		}
+
 		return nil, err
 	}
 
@@ -183,21 +271,64 @@ type capabilityResolver struct {
 	svc *Service
 }
 
-// Resolve resolves capabilities.
+// Resolve resolves capabilities. Capabilities in the chain of an invoked capability are checked against the
+// service's limits as they're resolved.
 func (s capabilityResolver) Resolve(uri string) (*zcapld.Capability, error) {
-	return s.svc.getCapability(uri)
+	capability, err := s.svc.getCapability(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.svc.checkCapabilityLimits(capability)
+	if err != nil {
+		return nil, err
+	}
+
+	return capability, nil
+}
+
+// authResponseWriter writes authorization failures reported by the zcapld middleware as an ErrorResponse.
+// The middleware writes its own plain-text response after reporting the error, which is discarded.
+type authResponseWriter struct {
+	http.ResponseWriter
+	request      *http.Request
+	logger       logging.Logger
+	errorWritten bool
+}
+
+func (a *authResponseWriter) writeError(err error) {
+	writeError(a.logger, a.ResponseWriter, a.request, classifyMiddlewareError(err))
+
+	a.errorWritten = true
+}
+
+func (a *authResponseWriter) Header() http.Header {
+	if a.errorWritten {
+		return http.Header{}
+	}
+
+	return a.ResponseWriter.Header()
 }
 
-// logError log error
-type logError struct {
-	w http.ResponseWriter
+func (a *authResponseWriter) WriteHeader(statusCode int) {
+	if a.errorWritten {
+		return
+	}
+
+	a.ResponseWriter.WriteHeader(statusCode)
 }
 
-func (l logError) Log(err error) {
-	l.w.WriteHeader(http.StatusBadRequest)
+func (a *authResponseWriter) Write(b []byte) (int, error) {
+	if a.errorWritten {
+		return len(b), nil
+	}
+
+	return a.ResponseWriter.Write(b)
+}
 
-	_, errWrite := l.w.Write([]byte(err.Error()))
-	if errWrite != nil {
-		logger.Errorf(errWrite.Error())
+// Flush sends any buffered data to the client, if the underlying response writer supports it.
+func (a *authResponseWriter) Flush() {
+	if flusher, ok := a.ResponseWriter.(http.Flusher); ok && !a.errorWritten {
+		flusher.Flush()
 	}
 }
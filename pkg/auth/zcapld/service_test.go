@@ -7,6 +7,7 @@ SPDX-License-Identifier: Apache-2.0
 package zcapld
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -46,6 +47,20 @@ func TestNew(t *testing.T) {
 		require.Contains(t, err.Error(), "failed to open")
 		require.Nil(t, svc)
 	})
+	t.Run("failed to set store config", func(t *testing.T) {
+		svc, err := New(&mockkms.KeyManager{},
+			&mockcrypto.Crypto{},
+			&mockstorage.MockStoreProvider{
+				Store:             &mockstorage.MockStore{Store: make(map[string]mockstorage.DBEntry)},
+				ErrSetStoreConfig: fmt.Errorf("failed to set store config"),
+			},
+			createTestDocumentLoader(t),
+			nil,
+		)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to set store config")
+		require.Nil(t, svc)
+	})
 }
 
 func TestService_Create(t *testing.T) {
@@ -113,9 +128,48 @@ func TestService_Handler(t *testing.T) {
 		h, err := svc.Handler("r1", &http.Request{Method: http.MethodGet}, nil, nil)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "failed to get root capability r1 from db")
+		require.True(t, errors.Is(err, ErrCapabilityNotFound))
+		require.Equal(t, http.StatusForbidden, HTTPStatus(err))
 		require.Nil(t, h)
 	})
 
+	t.Run("test request without http signature", func(t *testing.T) {
+		s := mockstorage.NewMockStoreProvider()
+
+		bytes, err := json.Marshal(&zcapld.Capability{})
+		require.NoError(t, err)
+
+		require.NoError(t, s.Store.Put("r1", bytes))
+
+		svc, err := New(&mockkms.KeyManager{},
+			&mockcrypto.Crypto{},
+			s,
+			createTestDocumentLoader(t),
+			nil,
+		)
+		require.NoError(t, err)
+
+		responseRecorder := httptest.NewRecorder()
+
+		req := httptest.NewRequest(http.MethodGet, "/encrypted-data-vaults/r1/documents/d1", nil)
+
+		h, err := svc.Handler("r1", req, responseRecorder, func(http.ResponseWriter, *http.Request) {
+			require.FailNow(t, "next handler must not be called")
+		})
+		require.NoError(t, err)
+
+		h.ServeHTTP(responseRecorder, req)
+
+		require.Equal(t, http.StatusUnauthorized, responseRecorder.Code)
+		require.Equal(t, "application/json", responseRecorder.Header().Get("Content-Type"))
+
+		var errorResponse ErrorResponse
+
+		require.NoError(t, json.Unmarshal(responseRecorder.Body.Bytes(), &errorResponse))
+		require.Equal(t, ErrorCodeInvocationInvalid, errorResponse.Error)
+		require.Contains(t, errorResponse.Message, "failed to verify http signature")
+	})
+
 	t.Run("test success", func(t *testing.T) {
 		s := mockstorage.NewMockStoreProvider()
 
@@ -178,14 +232,41 @@ func TestCapabilityResolver_Resolve(t *testing.T) {
 	})
 }
 
-func TestLogError_Log(t *testing.T) {
-	t.Run("success", func(t *testing.T) {
-		responseWriter := httptest.NewRecorder()
+func TestAuthResponseWriter(t *testing.T) {
+	t.Run("passes writes through until an error is written", func(t *testing.T) {
+		responseRecorder := httptest.NewRecorder()
+
+		w := &authResponseWriter{
+			ResponseWriter: responseRecorder, request: httptest.NewRequest(http.MethodGet, "/", nil), logger: logger,
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+
+		_, err := w.Write([]byte("data"))
+		require.NoError(t, err)
+
+		require.Equal(t, http.StatusAccepted, responseRecorder.Code)
+		require.Equal(t, "data", responseRecorder.Body.String())
+	})
+
+	t.Run("discards writes after an error is written", func(t *testing.T) {
+		responseRecorder := httptest.NewRecorder()
+
+		w := &authResponseWriter{
+			ResponseWriter: responseRecorder, request: httptest.NewRequest(http.MethodGet, "/", nil), logger: logger,
+		}
+
+		w.writeError(fmt.Errorf("failed to verify zcap: capability action \"write\" does not match " +
+			"the expected capability action of \"read\""))
+
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+
+		require.Equal(t, http.StatusForbidden, responseRecorder.Code)
 
-		l := logError{w: responseWriter}
-		l.Log(fmt.Errorf("error"))
+		var errorResponse ErrorResponse
 
-		require.Contains(t, responseWriter.Body.String(), "error")
+		require.NoError(t, json.Unmarshal(responseRecorder.Body.Bytes(), &errorResponse))
+		require.Equal(t, ErrorCodeActionNotAllowed, errorResponse.Error)
 	})
 }
 
@@ -0,0 +1,216 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package bulkhead limits the number of requests to vaults that the EDV server handles at the same time, with
+// separate limits for queries, reads and writes. Since each kind of request has its own pool, a flood of expensive
+// queries can't take up the capacity needed for simple document reads, and vice versa.
+package bulkhead
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/trustbloc/edv/pkg/logging"
+)
+
+// The pools that requests to vaults are split into.
+const (
+	// QueryPool is for encrypted index queries.
+	QueryPool = "query"
+	// ReadPool is for the other GET requests to vaults.
+	ReadPool = "read"
+	// WritePool is for the other requests to vaults, which create, change or delete vaults, documents or other
+	// vault resources.
+	WritePool = "write"
+)
+
+const (
+	logModuleName = "bulkhead"
+
+	vaultsPathSegment = "encrypted-data-vaults"
+	queryPathSegment  = "query"
+	// The number of segments in the path of a vault's queries.
+	queryPathLength = 3
+
+	// serverAtCapacity is the body of the response to requests that are rejected because their pool is full.
+	serverAtCapacity = "server is currently handling %d %s requests, which is the maximum allowed"
+)
+
+// Limits defines the maximum number of requests that can be handled at the same time in each pool.
+// Any limit that is set to 0 is not enforced.
+type Limits struct {
+	MaxQueries uint
+	MaxReads   uint
+	MaxWrites  uint
+}
+
+// Metrics records how saturated the pools are. Its methods are called concurrently.
+type Metrics interface {
+	// BulkheadCapacity is called once for each pool that has a limit, with its limit.
+	BulkheadCapacity(pool string, capacity int)
+	// BulkheadAcquired is called when a request starts being handled in a pool.
+	BulkheadAcquired(pool string)
+	// BulkheadReleased is called when a request is no longer being handled in a pool.
+	BulkheadReleased(pool string)
+	// BulkheadRejected is called for each request rejected because its pool was full.
+	BulkheadRejected(pool string)
+}
+
+// Option configures the bulkheads.
+type Option func(b *Bulkheads)
+
+// WithMetrics has the bulkheads record how saturated their pools are with the given metrics.
+func WithMetrics(metrics Metrics) Option {
+	return func(b *Bulkheads) {
+		b.metrics = metrics
+	}
+}
+
+// WithLogger has the bulkheads log with the given logger instead of the edge-core logger for their module.
+func WithLogger(logger logging.Logger) Option {
+	return func(b *Bulkheads) {
+		b.logger = logger
+	}
+}
+
+// Bulkheads limits the number of requests handled at the same time in each pool.
+type Bulkheads struct {
+	pools   map[string]*pool
+	metrics Metrics
+	logger  logging.Logger
+}
+
+type pool struct {
+	capacity int32
+	// The number of requests currently being handled in the pool. Must only be accessed atomically.
+	inFlight int32
+}
+
+// New returns new bulkheads with the given limits.
+func New(limits Limits, opts ...Option) *Bulkheads {
+	b := &Bulkheads{pools: make(map[string]*pool)}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	if b.logger == nil {
+		b.logger = logging.New(logModuleName)
+	}
+
+	for name, capacity := range map[string]uint{
+		QueryPool: limits.MaxQueries,
+		ReadPool:  limits.MaxReads,
+		WritePool: limits.MaxWrites,
+	} {
+		if capacity == 0 {
+			continue
+		}
+
+		b.pools[name] = &pool{capacity: int32(capacity)}
+
+		if b.metrics != nil {
+			b.metrics.BulkheadCapacity(name, int(capacity))
+		}
+	}
+
+	return b
+}
+
+// Middleware returns a handler that passes requests to next if there's room for them in their pool, and otherwise
+// rejects them with a 503 status code. Requests that aren't for a vault aren't limited.
+func (b *Bulkheads) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := Pool(r)
+
+		p, limited := b.pools[name]
+		if !limited {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		if !b.acquire(name, p) {
+			logger := logging.FromContext(r.Context(), b.logger)
+
+			logger.Warnf("Rejected %s request to %s since the %s pool is full", r.Method, r.URL.Path, name)
+
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			_, err := w.Write([]byte(fmt.Sprintf(serverAtCapacity, p.capacity, name)))
+			if err != nil {
+				logger.Errorf("Failed to write response: %s", err)
+			}
+
+			return
+		}
+
+		defer b.release(name, p)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Rejection returns the body of the response that requests in the same pool as r are rejected with while the pool is
+// full, if it's full right now, and otherwise an empty string. r itself takes up room in its pool while it's being
+// handled, so a full pool is only reported once r's handler is one of the requests filling it.
+func (b *Bulkheads) Rejection(r *http.Request) string {
+	name := Pool(r)
+
+	p, limited := b.pools[name]
+	if !limited || atomic.LoadInt32(&p.inFlight) < p.capacity {
+		return ""
+	}
+
+	return fmt.Sprintf(serverAtCapacity, p.capacity, name)
+}
+
+func (b *Bulkheads) acquire(name string, p *pool) bool {
+	if atomic.AddInt32(&p.inFlight, 1) > p.capacity {
+		atomic.AddInt32(&p.inFlight, -1)
+
+		if b.metrics != nil {
+			b.metrics.BulkheadRejected(name)
+		}
+
+		return false
+	}
+
+	if b.metrics != nil {
+		b.metrics.BulkheadAcquired(name)
+	}
+
+	return true
+}
+
+func (b *Bulkheads) release(name string, p *pool) {
+	atomic.AddInt32(&p.inFlight, -1)
+
+	if b.metrics != nil {
+		b.metrics.BulkheadReleased(name)
+	}
+}
+
+// Pool returns the pool that the given request is handled in, or an empty string if it isn't a request to a vault.
+func Pool(r *http.Request) string {
+	segments := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	if segments[0] != vaultsPathSegment {
+		return ""
+	}
+
+	switch {
+	case r.Method == http.MethodPost && len(segments) == queryPathLength && segments[2] == queryPathSegment:
+		return QueryPool
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return ReadPool
+	case r.Method == http.MethodOptions:
+		return ""
+	default:
+		return WritePool
+	}
+}
@@ -0,0 +1,181 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package bulkhead
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBulkheads_Middleware(t *testing.T) {
+	t.Run("A full pool doesn't block the other pools", func(t *testing.T) {
+		metrics := &mockMetrics{}
+		bulkheads := New(Limits{MaxQueries: 1, MaxReads: 1}, WithMetrics(metrics))
+
+		require.Equal(t, map[string]int{QueryPool: 1, ReadPool: 1}, metrics.capacities)
+
+		var once sync.Once
+
+		queryStarted := make(chan struct{})
+		finishQuery := make(chan struct{})
+
+		handler := bulkheads.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if Pool(r) == QueryPool {
+				once.Do(func() { close(queryStarted) })
+				<-finishQuery
+			}
+		}))
+
+		queryDone := make(chan int)
+
+		go func() {
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/encrypted-data-vaults/vault1/query", nil))
+			queryDone <- rw.Code
+		}()
+
+		<-queryStarted
+
+		// The query pool is full.
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/encrypted-data-vaults/vault1/query", nil))
+		require.Equal(t, http.StatusServiceUnavailable, rw.Code)
+		require.Equal(t, "server is currently handling 1 query requests, which is the maximum allowed",
+			rw.Body.String())
+
+		// Reads are still handled.
+		rw = httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", nil))
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		// Writes have no limit.
+		rw = httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/encrypted-data-vaults/vault1/documents", nil))
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		close(finishQuery)
+		require.Equal(t, http.StatusOK, <-queryDone)
+
+		// The query pool has room again.
+		rw = httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/encrypted-data-vaults/vault1/query", nil))
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		require.Equal(t, map[string]int{QueryPool: 1}, metrics.rejected)
+		require.Equal(t, map[string]int{QueryPool: 0, ReadPool: 0}, metrics.inFlight)
+	})
+	t.Run("No limits", func(t *testing.T) {
+		handler := New(Limits{}).Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/encrypted-data-vaults/vault1/query", nil))
+		require.Equal(t, http.StatusOK, rw.Code)
+	})
+}
+
+func TestBulkheads_Rejection(t *testing.T) {
+	bulkheads := New(Limits{MaxWrites: 2})
+
+	var rejections []string
+
+	handler := bulkheads.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rejections = append(rejections, bulkheads.Rejection(r))
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodPost, "/encrypted-data-vaults/vault1/batch/capacity", nil))
+	require.Equal(t, []string{""}, rejections)
+
+	// Along with the request itself, the write pool is full.
+	require.True(t, bulkheads.acquire(WritePool, bulkheads.pools[WritePool]))
+
+	handler.ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodPost, "/encrypted-data-vaults/vault1/batch/capacity", nil))
+	require.Equal(t, "server is currently handling 2 write requests, which is the maximum allowed", rejections[1])
+
+	// Pools without a limit are never full.
+	require.Empty(t, bulkheads.Rejection(httptest.NewRequest(http.MethodGet, "/encrypted-data-vaults/vault1/documents",
+		nil)))
+}
+
+func TestPool(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		pool   string
+	}{
+		{http.MethodPost, "/encrypted-data-vaults/vault1/query", QueryPool},
+		{http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", ReadPool},
+		{http.MethodHead, "/encrypted-data-vaults/vault1/documents/doc1", ReadPool},
+		{http.MethodPost, "/encrypted-data-vaults", WritePool},
+		{http.MethodPost, "/encrypted-data-vaults/vault1/documents", WritePool},
+		{http.MethodPost, "/encrypted-data-vaults/vault1/documents/doc1", WritePool},
+		{http.MethodDelete, "/encrypted-data-vaults/vault1/documents/doc1", WritePool},
+		{http.MethodPatch, "/encrypted-data-vaults/vault1/configuration", WritePool},
+		{http.MethodPost, "/encrypted-data-vaults/vault1/batch", WritePool},
+		{http.MethodOptions, "/encrypted-data-vaults/vault1/documents", ""},
+		{http.MethodGet, "/healthcheck", ""},
+		{http.MethodGet, "/metrics", ""},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.pool, Pool(httptest.NewRequest(test.method, test.path, nil)),
+			"%s %s", test.method, test.path)
+	}
+}
+
+type mockMetrics struct {
+	mutex      sync.Mutex
+	capacities map[string]int
+	inFlight   map[string]int
+	rejected   map[string]int
+}
+
+func (m *mockMetrics) BulkheadCapacity(pool string, capacity int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.capacities == nil {
+		m.capacities = make(map[string]int)
+	}
+
+	m.capacities[pool] = capacity
+}
+
+func (m *mockMetrics) BulkheadAcquired(pool string) {
+	m.addInFlight(pool, 1)
+}
+
+func (m *mockMetrics) BulkheadReleased(pool string) {
+	m.addInFlight(pool, -1)
+}
+
+func (m *mockMetrics) BulkheadRejected(pool string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.rejected == nil {
+		m.rejected = make(map[string]int)
+	}
+
+	m.rejected[pool]++
+}
+
+func (m *mockMetrics) addInFlight(pool string, delta int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.inFlight == nil {
+		m.inFlight = make(map[string]int)
+	}
+
+	m.inFlight[pool] += delta
+}
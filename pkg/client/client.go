@@ -10,20 +10,26 @@ import (
 	"bytes"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 
-	"github.com/trustbloc/edge-core/pkg/log"
-
+	"github.com/trustbloc/edv/pkg/logging"
 	"github.com/trustbloc/edv/pkg/restapi/models"
 )
 
 const failSendRequestForDocument = "failure while sending request to vault %s to retrieve document %s: %w"
 
-var logger = log.New("edv-client")
+const (
+	partialResultsHeader    = "EDV-Query-Partial"
+	continuationTokenHeader = "EDV-Query-Continuation-Token"
+)
+
+var logger = logging.New("edv-client")
 
 type addHeaders func(req *http.Request) (*http.Header, error)
 
@@ -40,6 +46,8 @@ type Client struct {
 	httpClient   HTTPClient
 	marshal      marshalFunc
 	headersFunc  addHeaders
+	retry        *retry
+	logger       logging.Logger
 }
 
 // Option configures the edv client
@@ -50,14 +58,14 @@ type Option func(opts *Client)
 func WithTLSConfig(tlsConfig *tls.Config) Option {
 	return func(opts *Client) {
 		if opts.httpClient == nil {
-			logger.Errorf("WithTLSConfig: http client is nil")
+			opts.log().Errorf("WithTLSConfig: http client is nil")
 
 			return
 		}
 
 		client, ok := opts.httpClient.(*http.Client)
 		if !ok {
-			logger.Errorf("WithTLSConfig: http client is not *http.Client")
+			opts.log().Errorf("WithTLSConfig: http client is not *http.Client")
 
 			return
 		}
@@ -80,9 +88,18 @@ func WithHeaders(addHeadersFunc addHeaders) Option {
 	}
 }
 
+// WithLogger option has the client log with the given logger instead of the edge-core logger for its module.
+func WithLogger(logger logging.Logger) Option {
+	return func(opts *Client) {
+		opts.logger = logger
+	}
+}
+
 // ReqOpts is used to interact with an EDV operation.
 type ReqOpts struct {
 	addHeadersFunc addHeaders
+	hmacKeyID      string
+	pageSize       uint
 }
 
 // ReqOption edv req option
@@ -95,6 +112,21 @@ func WithRequestHeader(addHeadersFunc addHeaders) ReqOption {
 	}
 }
 
+// WithHMACKeyID option restricts a query to the indexed attribute collections whose HMAC key has the given ID.
+func WithHMACKeyID(hmacKeyID string) ReqOption {
+	return func(opts *ReqOpts) {
+		opts.hmacKeyID = hmacKeyID
+	}
+}
+
+// WithPageSize option sets the number of mapping documents that the EDV server fetches from its database at a time
+// for a query, overriding the vault's and the server's retrieval page sizes.
+func WithPageSize(pageSize uint) ReqOption {
+	return func(opts *ReqOpts) {
+		opts.pageSize = pageSize
+	}
+}
+
 // New returns a new instance of an EDV client.
 func New(edvServerURL string, opts ...Option) *Client {
 	c := &Client{edvServerURL: edvServerURL, httpClient: &http.Client{}, marshal: json.Marshal}
@@ -120,7 +152,7 @@ func (c *Client) CreateDataVault(config *models.DataVaultConfiguration, opts ...
 		return "", nil, fmt.Errorf("failed to marshal data vault configuration: %w", err)
 	}
 
-	logger.Debugf("Sending request to create a new data vault with the following data vault configuration: %s",
+	c.log().Debugf("Sending request to create a new data vault with the following data vault configuration: %s",
 		jsonToSend)
 
 	statusCode, httpHdr, respBytes, err := c.sendHTTPRequest(http.MethodPost, c.edvServerURL, jsonToSend,
@@ -151,7 +183,7 @@ func (c *Client) CreateDocument(vaultID string, document *models.EncryptedDocume
 		return "", fmt.Errorf("failed to marshal document: %w", err)
 	}
 
-	logger.Debugf("Sending request to create the following document: %s", jsonToSend)
+	c.log().Debugf("Sending request to create the following document: %s", jsonToSend)
 
 	statusCode, httpHdr, respBytes, err := c.sendHTTPRequest(http.MethodPost,
 		c.edvServerURL+fmt.Sprintf("/%s/documents", url.PathEscape(vaultID)), jsonToSend, c.getHeaderFunc(reqOpt))
@@ -199,7 +231,85 @@ func (c *Client) ReadDocument(vaultID, docID string, opts ...ReqOption) (*models
 	}
 }
 
+// DocumentExists sends the EDV server a request to check whether the specified document exists, without retrieving
+// it. It returns false if the document or its vault doesn't exist, or if the document has been deleted.
+func (c *Client) DocumentExists(vaultID, docID string, opts ...ReqOption) (bool, error) {
+	reqOpt := &ReqOpts{}
+
+	for _, o := range opts {
+		o(reqOpt)
+	}
+
+	endpoint := fmt.Sprintf("%s/%s/documents/%s", c.edvServerURL, url.PathEscape(vaultID), url.PathEscape(docID))
+
+	statusCode, _, _, err := c.sendHTTPRequest(http.MethodHead, endpoint, nil, c.getHeaderFunc(reqOpt))
+	if err != nil {
+		return false, fmt.Errorf(failSendRequestForDocument, vaultID, docID, err)
+	}
+
+	switch statusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound, http.StatusGone:
+		return false, nil
+	default:
+		return false, fmt.Errorf("the EDV server returned status code %d", statusCode)
+	}
+}
+
+// ReadDocumentStream sends the EDV server a request to retrieve the specified document, and returns a reader for the
+// document as it's received, so that very large documents don't have to be held in memory. The document is read
+// straight from the response body, so the caller must close the reader once it's done with it.
+func (c *Client) ReadDocumentStream(vaultID, docID string, opts ...ReqOption) (io.ReadCloser, error) {
+	reqOpt := &ReqOpts{}
+
+	for _, o := range opts {
+		o(reqOpt)
+	}
+
+	endpoint := fmt.Sprintf("%s/%s/documents/%s", c.edvServerURL, url.PathEscape(vaultID), url.PathEscape(docID))
+
+	resp, err := c.sendStreamingHTTPRequest(http.MethodGet, endpoint, c.getHeaderFunc(reqOpt))
+	if err != nil {
+		return nil, fmt.Errorf(failSendRequestForDocument, vaultID, docID, err)
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		return resp.Body, nil
+	}
+
+	defer c.closeReadCloser(resp.Body)
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf(failSendRequestForDocument, vaultID, docID, err)
+	}
+
+	return nil, fmt.Errorf("the EDV server returned status code %d along with the following message: %s",
+		resp.StatusCode, respBody)
+}
+
+// ReadDocumentTo sends the EDV server a request to retrieve the specified document, and copies the document to w as
+// it's received. The number of bytes copied is returned. If an error occurs part way through, then w may have been
+// given part of the document.
+func (c *Client) ReadDocumentTo(vaultID, docID string, w io.Writer, opts ...ReqOption) (int64, error) {
+	document, err := c.ReadDocumentStream(vaultID, docID, opts...)
+	if err != nil {
+		return 0, err
+	}
+
+	defer c.closeReadCloser(document)
+
+	written, err := io.Copy(w, document)
+	if err != nil {
+		return written, fmt.Errorf("failed to copy document %s from vault %s: %w", docID, vaultID, err)
+	}
+
+	return written, nil
+}
+
 // QueryVault queries the given vault and returns the URLs of all documents that match the given query.
+// If the EDV server responds with partial results, then the rest of them are queried with its continuation tokens.
 func (c *Client) QueryVault(vaultID, name, value string, opts ...ReqOption) ([]string, error) {
 	reqOpt := &ReqOpts{}
 
@@ -211,39 +321,143 @@ func (c *Client) QueryVault(vaultID, name, value string, opts ...ReqOption) ([]s
 		ReturnFullDocuments: false,
 		Name:                name,
 		Value:               value,
+		HMACKeyID:           reqOpt.hmacKeyID,
+		PageSize:            reqOpt.pageSize,
 	}
 
-	jsonToSend, err := c.marshal(query)
+	var docURLs []string
+
+	err := c.sendQuery(vaultID, &query, reqOpt, func(respBytes []byte) error {
+		var pageURLs []string
+
+		err := json.Unmarshal(respBytes, &pageURLs)
+		if err != nil {
+			return err
+		}
+
+		docURLs = append(docURLs, pageURLs...)
+
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	endpoint := fmt.Sprintf("%s/%s/query", c.edvServerURL, url.PathEscape(vaultID))
+	return docURLs, nil
+}
 
-	statusCode, _, respBytes, err := c.sendHTTPRequest(http.MethodPost, endpoint, jsonToSend, c.getHeaderFunc(reqOpt))
+// QueryVaultForFullDocuments queries the given vault and returns all documents that match the given query.
+// Requires the EDV server to support the ReturnFullDocumentsOnQuery extension. If the EDV server responds with
+// partial results, then the rest of them are queried with its continuation tokens.
+func (c *Client) QueryVaultForFullDocuments(vaultID, name, value string,
+	opts ...ReqOption) ([]models.EncryptedDocument, error) {
+	reqOpt := &ReqOpts{}
+
+	for _, o := range opts {
+		o(reqOpt)
+	}
+
+	query := models.Query{
+		ReturnFullDocuments: true,
+		Name:                name,
+		Value:               value,
+		HMACKeyID:           reqOpt.hmacKeyID,
+		PageSize:            reqOpt.pageSize,
+	}
+
+	var documents []models.EncryptedDocument
+
+	err := c.sendQuery(vaultID, &query, reqOpt, func(respBytes []byte) error {
+		var pageDocuments []models.EncryptedDocument
+
+		err := json.Unmarshal(respBytes, &pageDocuments)
+		if err != nil {
+			return err
+		}
+
+		documents = append(documents, pageDocuments...)
+
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	if statusCode == http.StatusOK {
-		var docURLs []string
+	return documents, nil
+}
 
-		err = json.Unmarshal(respBytes, &docURLs)
+// sendQuery sends the given query to the given vault and passes the body of the response to addResults. As long as
+// the EDV server responds with partial results (see its query-latency-budget parameter), the query is sent again
+// with the continuation token of the last response, and the body of each response is passed to addResults.
+func (c *Client) sendQuery(vaultID string, query *models.Query, reqOpt *ReqOpts,
+	addResults func(respBytes []byte) error) error {
+	jsonToSend, err := c.marshal(query)
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("%s/%s/query", c.edvServerURL, url.PathEscape(vaultID))
+
+	var continuationToken string
+
+	for {
+		statusCode, header, respBytes, err := c.sendHTTPRequest(http.MethodPost, endpoint, jsonToSend,
+			withContinuationToken(c.getHeaderFunc(reqOpt), continuationToken))
 		if err != nil {
-			return nil, err
+			return err
+		}
+
+		if statusCode != http.StatusOK {
+			return fmt.Errorf("the EDV server returned status code %d along with the following message: %s",
+				statusCode, respBytes)
+		}
+
+		err = addResults(respBytes)
+		if err != nil {
+			return err
+		}
+
+		if header.Get(partialResultsHeader) != "true" {
+			return nil
+		}
+
+		continuationToken = header.Get(continuationTokenHeader)
+		if continuationToken == "" {
+			return errors.New("the EDV server returned partial results without a continuation token")
 		}
+	}
+}
 
-		return docURLs, nil
+// withContinuationToken returns a function that adds the headers of addHeadersFunc to a request, along with the
+// given continuation token if it isn't empty.
+func withContinuationToken(addHeadersFunc addHeaders, continuationToken string) addHeaders {
+	if continuationToken == "" {
+		return addHeadersFunc
 	}
 
-	return nil, fmt.Errorf("the EDV server returned status code %d along with the following message: %s",
-		statusCode, respBytes)
+	return func(req *http.Request) (*http.Header, error) {
+		headers := &req.Header
+
+		if addHeadersFunc != nil {
+			addedHeaders, err := addHeadersFunc(req)
+			if err != nil {
+				return nil, err
+			}
+
+			if addedHeaders != nil {
+				headers = addedHeaders
+			}
+		}
+
+		headers.Set(continuationTokenHeader, continuationToken)
+
+		return headers, nil
+	}
 }
 
-// QueryVaultForFullDocuments queries the given vault and returns all documents that match the given query.
-// Requires the EDV server to support the ReturnFullDocumentsOnQuery extension.
-func (c *Client) QueryVaultForFullDocuments(vaultID, name, value string,
-	opts ...ReqOption) ([]models.EncryptedDocument, error) {
+// CountQueryMatches queries the given vault and returns the number of documents that match the given query, without
+// fetching them.
+func (c *Client) CountQueryMatches(vaultID, name, value string, opts ...ReqOption) (int, error) {
 	reqOpt := &ReqOpts{}
 
 	for _, o := range opts {
@@ -251,38 +465,122 @@ func (c *Client) QueryVaultForFullDocuments(vaultID, name, value string,
 	}
 
 	query := models.Query{
-		ReturnFullDocuments: true,
-		Name:                name,
-		Value:               value,
+		Name:      name,
+		Value:     value,
+		HMACKeyID: reqOpt.hmacKeyID,
+		PageSize:  reqOpt.pageSize,
+		Count:     true,
 	}
 
 	jsonToSend, err := c.marshal(query)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
 	endpoint := fmt.Sprintf("%s/%s/query", c.edvServerURL, url.PathEscape(vaultID))
 
 	statusCode, _, respBytes, err := c.sendHTTPRequest(http.MethodPost, endpoint, jsonToSend, c.getHeaderFunc(reqOpt))
+	if err != nil {
+		return 0, err
+	}
+
+	if statusCode == http.StatusOK {
+		var queryCount models.QueryCount
+
+		err = json.Unmarshal(respBytes, &queryCount)
+		if err != nil {
+			return 0, err
+		}
+
+		return queryCount.Count, nil
+	}
+
+	return 0, fmt.Errorf("the EDV server returned status code %d along with the following message: %s",
+		statusCode, respBytes)
+}
+
+// ListDocuments sends the EDV server a request to list the IDs and sequences of the documents in the specified vault,
+// sorted by sequence and then by ID. If afterSequence is nil, then the list starts at the first document. Otherwise,
+// only the documents after afterSequence are listed, or after afterSequence and afterID if afterID isn't empty.
+// If limit is greater than 0, then at most limit documents are listed, and the More field of the returned list is
+// set if there are more documents, which can be listed by passing the sequence and ID of the last listed document.
+func (c *Client) ListDocuments(vaultID string, afterSequence *uint64, afterID string, limit int,
+	opts ...ReqOption) (*models.DocumentList, error) {
+	reqOpt := &ReqOpts{}
+
+	for _, o := range opts {
+		o(reqOpt)
+	}
+
+	query := url.Values{}
+
+	if afterSequence != nil {
+		query.Set("afterSequence", strconv.FormatUint(*afterSequence, 10))
+	}
+
+	if afterID != "" {
+		query.Set("afterId", afterID)
+	}
+
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	endpoint := fmt.Sprintf("%s/%s/documents", c.edvServerURL, url.PathEscape(vaultID))
+
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	statusCode, _, respBytes, err := c.sendHTTPRequest(http.MethodGet, endpoint, nil, c.getHeaderFunc(reqOpt))
 	if err != nil {
 		return nil, err
 	}
 
 	if statusCode == http.StatusOK {
-		var documents []models.EncryptedDocument
+		var list models.DocumentList
 
-		err = json.Unmarshal(respBytes, &documents)
+		err = json.Unmarshal(respBytes, &list)
 		if err != nil {
 			return nil, err
 		}
 
-		return documents, nil
+		return &list, nil
 	}
 
 	return nil, fmt.Errorf("the EDV server returned status code %d along with the following message: %s",
 		statusCode, respBytes)
 }
 
+// ListAllDocuments lists the IDs and sequences of all the documents in the specified vault, sorted by sequence and
+// then by ID. The documents are listed pageSize at a time (see ListDocuments), so that large vaults don't have to be
+// listed in a single response. If pageSize is 0, then they're listed in one request.
+func (c *Client) ListAllDocuments(vaultID string, pageSize int,
+	opts ...ReqOption) ([]models.DocumentListEntry, error) {
+	var (
+		documents     []models.DocumentListEntry
+		afterSequence *uint64
+		afterID       string
+	)
+
+	for {
+		list, err := c.ListDocuments(vaultID, afterSequence, afterID, pageSize, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		documents = append(documents, list.Documents...)
+
+		if !list.More || len(list.Documents) == 0 {
+			return documents, nil
+		}
+
+		last := list.Documents[len(list.Documents)-1]
+
+		afterSequence, afterID = &last.Sequence, last.ID
+	}
+}
+
 // UpdateDocument sends the EDV server a request to update the specified document.
 func (c *Client) UpdateDocument(vaultID, docID string, document *models.EncryptedDocument, opts ...ReqOption) error {
 	reqOpt := &ReqOpts{}
@@ -296,7 +594,7 @@ func (c *Client) UpdateDocument(vaultID, docID string, document *models.Encrypte
 		return fmt.Errorf("failed to marshal document: %w", err)
 	}
 
-	logger.Debugf("Sending request to update the following document: %s", jsonToSend)
+	c.log().Debugf("Sending request to update the following document: %s", jsonToSend)
 
 	endpoint := c.edvServerURL + fmt.Sprintf("/%s/documents/%s", url.PathEscape(vaultID), url.PathEscape(docID))
 
@@ -313,6 +611,30 @@ func (c *Client) UpdateDocument(vaultID, docID string, document *models.Encrypte
 		statusCode, respBytes)
 }
 
+// DeleteDataVault sends the EDV server a request to delete the specified data vault, along with all of its documents.
+func (c *Client) DeleteDataVault(vaultID string, opts ...ReqOption) error {
+	reqOpt := &ReqOpts{}
+
+	for _, o := range opts {
+		o(reqOpt)
+	}
+
+	endpoint := c.edvServerURL + "/" + url.PathEscape(vaultID)
+
+	statusCode, _, respBytes, err := c.sendHTTPRequest(
+		http.MethodDelete, endpoint, nil, c.getHeaderFunc(reqOpt))
+	if err != nil {
+		return err
+	}
+
+	if statusCode == http.StatusOK {
+		return nil
+	}
+
+	return fmt.Errorf("the EDV server returned status code %d along with the following message: %s",
+		statusCode, respBytes)
+}
+
 // DeleteDocument sends the EDV server a request to delete the specified document.
 func (c *Client) DeleteDocument(vaultID, docID string, opts ...ReqOption) error {
 	reqOpt := &ReqOpts{}
@@ -337,6 +659,32 @@ func (c *Client) DeleteDocument(vaultID, docID string, opts ...ReqOption) error
 		statusCode, respBytes)
 }
 
+// RestoreDocument sends the EDV server a request to restore the specified deleted document. This only works if the
+// EDV server keeps tombstones for deleted documents and the document's retention window hasn't passed yet.
+func (c *Client) RestoreDocument(vaultID, docID string, opts ...ReqOption) error {
+	reqOpt := &ReqOpts{}
+
+	for _, o := range opts {
+		o(reqOpt)
+	}
+
+	endpoint := c.edvServerURL + fmt.Sprintf("/%s/documents/%s/restore", url.PathEscape(vaultID),
+		url.PathEscape(docID))
+
+	statusCode, _, respBytes, err := c.sendHTTPRequest(
+		http.MethodPost, endpoint, nil, c.getHeaderFunc(reqOpt))
+	if err != nil {
+		return err
+	}
+
+	if statusCode == http.StatusOK {
+		return nil
+	}
+
+	return fmt.Errorf("the EDV server returned status code %d along with the following message: %s",
+		statusCode, respBytes)
+}
+
 // Batch performs batch operations within a vault. Requires the EDV server to support the Batch extension.
 func (c *Client) Batch(vaultID string, batch *models.Batch, opts ...ReqOption) ([]string, error) {
 	reqOpt := &ReqOpts{}
@@ -372,46 +720,242 @@ func (c *Client) Batch(vaultID string, batch *models.Batch, opts ...ReqOption) (
 		statusCode, respBytes)
 }
 
-func (c *Client) sendHTTPRequest(method, endpoint string, body []byte,
-	addHeadersFunc addHeaders) (int, http.Header, []byte, error) {
-	req, errReq := http.NewRequest(method, endpoint, bytes.NewBuffer(body))
-	if errReq != nil {
-		return -1, nil, nil, errReq
+// CheckBatchCapacity asks the EDV server whether a batch with the given number of operations and total size in bytes
+// would currently be accepted. Requires the EDV server to support the Batch extension.
+func (c *Client) CheckBatchCapacity(vaultID string, numOperations uint, totalBytes uint64,
+	opts ...ReqOption) (*models.BatchCapacityCheckResult, error) {
+	reqOpt := &ReqOpts{}
+
+	for _, o := range opts {
+		o(reqOpt)
 	}
 
-	if addHeadersFunc != nil {
-		httpHeaders, err := addHeadersFunc(req)
+	jsonToSend, err := c.marshal(models.BatchCapacityCheck{NumOperations: numOperations, TotalBytes: totalBytes})
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf("%s/%s/batch/capacity", c.edvServerURL, url.PathEscape(vaultID))
+
+	statusCode, _, respBytes, err := c.sendHTTPRequest(http.MethodPost, endpoint, jsonToSend, c.getHeaderFunc(reqOpt))
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode == http.StatusOK {
+		var result models.BatchCapacityCheckResult
+
+		err = json.Unmarshal(respBytes, &result)
 		if err != nil {
-			return -1, nil, nil, fmt.Errorf("add optional request headers error: %w", err)
+			return nil, err
 		}
 
-		if httpHeaders != nil {
-			req.Header = httpHeaders.Clone()
+		return &result, nil
+	}
+
+	return nil, fmt.Errorf("the EDV server returned status code %d along with the following message: %s",
+		statusCode, respBytes)
+}
+
+// DelegateCapability sends the EDV server a request to delegate a new capability for the specified data vault.
+// The delegated capability is returned. Requires the EDV server to have auth enabled.
+func (c *Client) DelegateCapability(vaultID string, delegation *models.CapabilityDelegation,
+	opts ...ReqOption) ([]byte, error) {
+	reqOpt := &ReqOpts{}
+
+	for _, o := range opts {
+		o(reqOpt)
+	}
+
+	jsonToSend, err := c.marshal(delegation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal capability delegation: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/%s/capabilities", c.edvServerURL, url.PathEscape(vaultID))
+
+	statusCode, _, respBytes, err := c.sendHTTPRequest(http.MethodPost, endpoint, jsonToSend, c.getHeaderFunc(reqOpt))
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode == http.StatusCreated {
+		return respBytes, nil
+	}
+
+	return nil, fmt.Errorf("the EDV server returned status code %d along with the following message: %s",
+		statusCode, respBytes)
+}
+
+// RevokeCapability sends the EDV server a request to revoke the specified capability for the specified data vault,
+// along with every capability delegated from it. Requires the EDV server to have auth enabled.
+func (c *Client) RevokeCapability(vaultID, capabilityID string, opts ...ReqOption) error {
+	reqOpt := &ReqOpts{}
+
+	for _, o := range opts {
+		o(reqOpt)
+	}
+
+	endpoint := c.edvServerURL + fmt.Sprintf("/%s/capabilities/%s", url.PathEscape(vaultID),
+		url.PathEscape(capabilityID))
+
+	statusCode, _, respBytes, err := c.sendHTTPRequest(
+		http.MethodDelete, endpoint, nil, c.getHeaderFunc(reqOpt))
+	if err != nil {
+		return err
+	}
+
+	if statusCode == http.StatusOK {
+		return nil
+	}
+
+	return fmt.Errorf("the EDV server returned status code %d along with the following message: %s",
+		statusCode, respBytes)
+}
+
+// UpdateDataVaultConfiguration sends the EDV server a request to update the configuration of the specified data
+// vault. Fields of the update that are left out aren't changed. The updated configuration is returned, along with
+// the capability delegated to the new controller if the update sets the controller and the EDV server has auth enabled.
+func (c *Client) UpdateDataVaultConfiguration(vaultID string, update *models.DataVaultConfigurationUpdate,
+	opts ...ReqOption) (*models.DataVaultConfigurationUpdateResult, error) {
+	reqOpt := &ReqOpts{}
+
+	for _, o := range opts {
+		o(reqOpt)
+	}
+
+	jsonToSend, err := c.marshal(update)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal data vault configuration update: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/%s/configuration", c.edvServerURL, url.PathEscape(vaultID))
+
+	statusCode, _, respBytes, err := c.sendHTTPRequest(http.MethodPatch, endpoint, jsonToSend,
+		c.getHeaderFunc(reqOpt))
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode == http.StatusOK {
+		var result models.DataVaultConfigurationUpdateResult
+
+		err = json.Unmarshal(respBytes, &result)
+		if err != nil {
+			return nil, err
 		}
+
+		return &result, nil
 	}
 
-	if method == http.MethodPost {
-		req.Header.Set("Content-Type", "application/json")
+	return nil, fmt.Errorf("the EDV server returned status code %d along with the following message: %s",
+		statusCode, respBytes)
+}
+
+// RotateReferenceID sends the EDV server a request to replace the reference ID of the specified data vault with the
+// one in rotation. The updated configuration is returned.
+func (c *Client) RotateReferenceID(vaultID string, rotation *models.ReferenceIDRotation,
+	opts ...ReqOption) (*models.DataVaultConfiguration, error) {
+	reqOpt := &ReqOpts{}
+
+	for _, o := range opts {
+		o(reqOpt)
 	}
 
-	resp, err := c.httpClient.Do(req) //nolint: bodyclose
+	jsonToSend, err := c.marshal(rotation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal reference ID rotation: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/%s/configuration/reference-id", c.edvServerURL, url.PathEscape(vaultID))
+
+	statusCode, _, respBytes, err := c.sendHTTPRequest(http.MethodPost, endpoint, jsonToSend,
+		c.getHeaderFunc(reqOpt))
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode == http.StatusOK {
+		var config models.DataVaultConfiguration
+
+		err = json.Unmarshal(respBytes, &config)
+		if err != nil {
+			return nil, err
+		}
+
+		return &config, nil
+	}
+
+	return nil, fmt.Errorf("the EDV server returned status code %d along with the following message: %s",
+		statusCode, respBytes)
+}
+
+func (c *Client) sendHTTPRequest(method, endpoint string, body []byte,
+	addHeadersFunc addHeaders) (int, http.Header, []byte, error) {
+	resp, err := c.do(method, endpoint, body, addHeadersFunc) //nolint: bodyclose
 	if err != nil {
 		return -1, nil, nil, err
 	}
 
-	defer closeReadCloser(resp.Body)
+	defer c.closeReadCloser(resp.Body)
 
 	respBytes, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return -1, nil, nil, err
 	}
 
-	logger.Debugf(`sent %s request to %s response status code: %d response body: %s`, method, endpoint,
+	c.log().Debugf(`sent %s request to %s response status code: %d response body: %s`, method, endpoint,
 		resp.StatusCode, respBytes)
 
 	return resp.StatusCode, resp.Header, respBytes, nil
 }
 
+// sendStreamingHTTPRequest sends a request without a body and returns the response without reading its body.
+// The caller must close the response body.
+func (c *Client) sendStreamingHTTPRequest(method, endpoint string, addHeadersFunc addHeaders) (*http.Response, error) {
+	resp, err := c.do(method, endpoint, nil, addHeadersFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	c.log().Debugf(`sent %s request to %s response status code: %d`, method, endpoint, resp.StatusCode)
+
+	return resp, nil
+}
+
+func newRequest(method, endpoint string, body []byte, addHeadersFunc addHeaders) (*http.Request, error) {
+	req, err := http.NewRequest(method, endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if addHeadersFunc != nil {
+		httpHeaders, errHeaders := addHeadersFunc(req)
+		if errHeaders != nil {
+			return nil, fmt.Errorf("add optional request headers error: %w", errHeaders)
+		}
+
+		if httpHeaders != nil {
+			req.Header = httpHeaders.Clone()
+		}
+	}
+
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return req, nil
+}
+
+// log returns the client's logger, or the edge-core logger if none was given.
+func (c *Client) log() logging.Logger {
+	if c.logger == nil {
+		return logger
+	}
+
+	return c.logger
+}
+
 func (c *Client) getHeaderFunc(reqOpt *ReqOpts) addHeaders {
 	headersFunc := c.headersFunc
 
@@ -422,8 +966,8 @@ func (c *Client) getHeaderFunc(reqOpt *ReqOpts) addHeaders {
 	return headersFunc
 }
 
-func closeReadCloser(respBody io.ReadCloser) {
+func (c *Client) closeReadCloser(respBody io.ReadCloser) {
 	if err := respBody.Close(); err != nil {
-		logger.Errorf("Failed to close response body: %s", err)
+		c.log().Errorf("Failed to close response body: %s", err)
 	}
 }
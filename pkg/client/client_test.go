@@ -7,6 +7,7 @@ SPDX-License-Identifier: Apache-2.0
 package client
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/json"
@@ -14,6 +15,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -251,6 +253,137 @@ func TestClient_ReadDocument(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestClient_DocumentExists(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		srvAddr := randomURL()
+
+		srv := startEDVServer(t, srvAddr, &operation.EnabledExtensions{})
+
+		waitForServerToStart(t, srvAddr)
+
+		client := New("http://" + srvAddr + "/encrypted-data-vaults")
+
+		validConfig := getTestValidDataVaultConfiguration()
+		vaultLocationURL, _, err := client.CreateDataVault(&validConfig)
+		require.NoError(t, err)
+
+		vaultID := getVaultIDFromURL(vaultLocationURL)
+
+		exists, err := client.DocumentExists(vaultID, testDocumentID)
+		require.NoError(t, err)
+		require.False(t, exists)
+
+		_, err = client.CreateDocument(vaultID, getTestValidEncryptedDocument(testJWE))
+		require.NoError(t, err)
+
+		exists, err = client.DocumentExists(vaultID, testDocumentID)
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		exists, err = client.DocumentExists(testVaultIDNonExistent, testDocumentID)
+		require.NoError(t, err)
+		require.False(t, exists)
+
+		err = srv.Shutdown(context.Background())
+		require.NoError(t, err)
+	})
+	t.Run("Failure: unexpected status code", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer srv.Close()
+
+		client := New(srv.URL + "/encrypted-data-vaults")
+
+		exists, err := client.DocumentExists(testVaultIDNonExistent, testDocumentID)
+		require.EqualError(t, err, "the EDV server returned status code 500")
+		require.False(t, exists)
+	})
+	t.Run("Failure: server unreachable", func(t *testing.T) {
+		client := New("http://" + randomURL() + "/encrypted-data-vaults")
+
+		exists, err := client.DocumentExists(testVaultIDNonExistent, testDocumentID)
+		require.Error(t, err)
+		require.False(t, exists)
+	})
+}
+
+func TestClient_ListDocuments(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		srvAddr := randomURL()
+
+		srv := startEDVServer(t, srvAddr, &operation.EnabledExtensions{})
+
+		waitForServerToStart(t, srvAddr)
+
+		client := New("http://" + srvAddr + "/encrypted-data-vaults")
+
+		validConfig := getTestValidDataVaultConfiguration()
+		vaultLocationURL, _, err := client.CreateDataVault(&validConfig)
+		require.NoError(t, err)
+
+		vaultID := getVaultIDFromURL(vaultLocationURL)
+
+		_, err = client.CreateDocument(vaultID, getTestValidEncryptedDocument(testJWE))
+		require.NoError(t, err)
+
+		_, err = client.CreateDocument(vaultID, &models.EncryptedDocument{ID: testDocumentID2, JWE: []byte(testJWE2)})
+		require.NoError(t, err)
+
+		list, err := client.ListDocuments(vaultID, nil, "", 1)
+		require.NoError(t, err)
+		require.Equal(t, &models.DocumentList{
+			Documents: []models.DocumentListEntry{{ID: testDocumentID2, Sequence: 0}},
+			More:      true,
+		}, list)
+
+		list, err = client.ListDocuments(vaultID, &list.Documents[0].Sequence, list.Documents[0].ID, 0)
+		require.NoError(t, err)
+		require.Equal(t, &models.DocumentList{
+			Documents: []models.DocumentListEntry{{ID: testDocumentID, Sequence: 0}},
+		}, list)
+
+		documents, err := client.ListAllDocuments(vaultID, 1)
+		require.NoError(t, err)
+		require.Equal(t, []models.DocumentListEntry{{ID: testDocumentID2}, {ID: testDocumentID}}, documents)
+
+		documents, err = client.ListAllDocuments(vaultID, 0)
+		require.NoError(t, err)
+		require.Len(t, documents, 2)
+
+		err = srv.Shutdown(context.Background())
+		require.NoError(t, err)
+	})
+	t.Run("Failure: vault doesn't exist", func(t *testing.T) {
+		srvAddr := randomURL()
+
+		srv := startEDVServer(t, srvAddr, &operation.EnabledExtensions{})
+
+		waitForServerToStart(t, srvAddr)
+
+		client := New("http://" + srvAddr + "/encrypted-data-vaults")
+
+		list, err := client.ListDocuments(testVaultIDNonExistent, nil, "", 0)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "the EDV server returned status code 404")
+		require.Nil(t, list)
+
+		documents, err := client.ListAllDocuments(testVaultIDNonExistent, 1)
+		require.Error(t, err)
+		require.Nil(t, documents)
+
+		err = srv.Shutdown(context.Background())
+		require.NoError(t, err)
+	})
+	t.Run("Failure: server unreachable", func(t *testing.T) {
+		client := New("http://" + randomURL() + "/encrypted-data-vaults")
+
+		list, err := client.ListDocuments(testVaultIDNonExistent, nil, "", 0)
+		require.Error(t, err)
+		require.Nil(t, list)
+	})
+}
+
 func TestClient_ReadDocument_UnmarshalFail(t *testing.T) {
 	srvAddr := randomURL()
 
@@ -351,6 +484,106 @@ func TestClient_ReadDocument_UnableToReachReadCredentialEndpoint(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestClient_ReadDocumentStream(t *testing.T) {
+	srvAddr := randomURL()
+
+	srv := startEDVServer(t, srvAddr, &operation.EnabledExtensions{})
+
+	waitForServerToStart(t, srvAddr)
+
+	client := New("http://" + srvAddr + "/encrypted-data-vaults")
+
+	validConfig := getTestValidDataVaultConfiguration()
+	vaultLocationURL, _, err := client.CreateDataVault(&validConfig)
+	require.NoError(t, err)
+
+	vaultID := getVaultIDFromURL(vaultLocationURL)
+
+	_, err = client.CreateDocument(vaultID, getTestValidEncryptedDocument(testJWE))
+	require.NoError(t, err)
+
+	t.Run("Success", func(t *testing.T) {
+		reader, errRead := client.ReadDocumentStream(vaultID, testDocumentID)
+		require.NoError(t, errRead)
+
+		var document models.EncryptedDocument
+
+		require.NoError(t, json.NewDecoder(reader).Decode(&document))
+		require.NoError(t, reader.Close())
+		require.Equal(t, testDocumentID, document.ID)
+		require.Equal(t, testJWE, string(document.JWE))
+	})
+	t.Run("Document not found", func(t *testing.T) {
+		reader, errRead := client.ReadDocumentStream(vaultID, testDocumentID2)
+		require.Nil(t, reader)
+		require.Contains(t, errRead.Error(), "status code 404")
+		require.Contains(t, errRead.Error(), messages.ErrDocumentNotFound.Error())
+	})
+	t.Run("Server unreachable", func(t *testing.T) {
+		reader, errRead := New("http://"+randomURL()).ReadDocumentStream(vaultID, testDocumentID)
+		require.Nil(t, reader)
+		require.Contains(t, errRead.Error(), "connection refused")
+	})
+	t.Run("Fail to add request headers", func(t *testing.T) {
+		reader, errRead := client.ReadDocumentStream(vaultID, testDocumentID,
+			WithRequestHeader(func(req *http.Request) (*http.Header, error) {
+				return nil, errors.New("header error")
+			}))
+		require.Nil(t, reader)
+		require.EqualError(t, errRead, "failure while sending request to vault "+vaultID+" to retrieve document "+
+			testDocumentID+": add optional request headers error: header error")
+	})
+
+	err = srv.Shutdown(context.Background())
+	require.NoError(t, err)
+}
+
+func TestClient_ReadDocumentTo(t *testing.T) {
+	srvAddr := randomURL()
+
+	srv := startEDVServer(t, srvAddr, &operation.EnabledExtensions{})
+
+	waitForServerToStart(t, srvAddr)
+
+	client := New("http://" + srvAddr + "/encrypted-data-vaults")
+
+	validConfig := getTestValidDataVaultConfiguration()
+	vaultLocationURL, _, err := client.CreateDataVault(&validConfig)
+	require.NoError(t, err)
+
+	vaultID := getVaultIDFromURL(vaultLocationURL)
+
+	_, err = client.CreateDocument(vaultID, getTestValidEncryptedDocument(testJWE))
+	require.NoError(t, err)
+
+	t.Run("Success", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		written, errRead := client.ReadDocumentTo(vaultID, testDocumentID, &buf)
+		require.NoError(t, errRead)
+		require.Equal(t, int64(buf.Len()), written)
+
+		var document models.EncryptedDocument
+
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &document))
+		require.Equal(t, testDocumentID, document.ID)
+		require.Equal(t, testJWE, string(document.JWE))
+	})
+	t.Run("Document not found", func(t *testing.T) {
+		written, errRead := client.ReadDocumentTo(vaultID, testDocumentID2, &bytes.Buffer{})
+		require.Zero(t, written)
+		require.Contains(t, errRead.Error(), messages.ErrDocumentNotFound.Error())
+	})
+	t.Run("Fail to write document", func(t *testing.T) {
+		_, errRead := client.ReadDocumentTo(vaultID, testDocumentID, &failingWriter{})
+		require.EqualError(t, errRead, "failed to copy document "+testDocumentID+" from vault "+vaultID+
+			": failingWriter always fails")
+	})
+
+	err = srv.Shutdown(context.Background())
+	require.NoError(t, err)
+}
+
 func TestClient_UpdateDocument(t *testing.T) {
 	srvAddr := randomURL()
 
@@ -369,7 +602,10 @@ func TestClient_UpdateDocument(t *testing.T) {
 	_, err = client.CreateDocument(vaultID, getTestValidEncryptedDocument(testJWE))
 	require.NoError(t, err)
 
-	err = client.UpdateDocument(vaultID, testDocumentID, getTestValidEncryptedDocument(testJWE2),
+	updatedDocument := getTestValidEncryptedDocument(testJWE2)
+	updatedDocument.Sequence = 1
+
+	err = client.UpdateDocument(vaultID, testDocumentID, updatedDocument,
 		WithRequestHeader(func(req *http.Request) (*http.Header, error) {
 			return nil, nil
 		}))
@@ -379,6 +615,13 @@ func TestClient_UpdateDocument(t *testing.T) {
 	require.NoError(t, err)
 
 	require.Equal(t, testJWE2, string(document.JWE))
+	require.Equal(t, uint64(1), document.Sequence)
+
+	// Updating again from the same starting sequence is rejected, since the document has moved on.
+	err = client.UpdateDocument(vaultID, testDocumentID, updatedDocument)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), messages.ErrDocumentSequenceConflict.Error())
+	require.Contains(t, err.Error(), "status code 409")
 
 	err = srv.Shutdown(context.Background())
 	require.NoError(t, err)
@@ -414,6 +657,47 @@ func TestClient_UpdateDocument_ServerUnreachable(t *testing.T) {
 	require.True(t, testPassed)
 }
 
+func TestClient_DeleteDataVault(t *testing.T) {
+	srvAddr := randomURL()
+
+	srv := startEDVServer(t, srvAddr, &operation.EnabledExtensions{})
+
+	waitForServerToStart(t, srvAddr)
+
+	client := New("http://" + srvAddr + "/encrypted-data-vaults")
+
+	validConfig := getTestValidDataVaultConfiguration()
+	vaultLocationURL, _, err := client.CreateDataVault(&validConfig)
+	require.NoError(t, err)
+
+	vaultID := getVaultIDFromURL(vaultLocationURL)
+
+	_, err = client.CreateDocument(vaultID, getTestValidEncryptedDocument(testJWE))
+	require.NoError(t, err)
+
+	err = client.DeleteDataVault(vaultID)
+	require.NoError(t, err)
+
+	err = client.DeleteDataVault(vaultID)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), messages.ErrVaultNotFound.Error())
+	require.Contains(t, err.Error(), "status code 404")
+
+	err = srv.Shutdown(context.Background())
+	require.NoError(t, err)
+}
+
+func TestClient_DeleteDataVault_ServerUnreachable(t *testing.T) {
+	srvAddr := randomURL()
+
+	client := New("http://" + srvAddr)
+
+	err := client.DeleteDataVault(testVaultIDNonExistent)
+
+	testPassed := strings.Contains(err.Error(), "EOF") || strings.Contains(err.Error(), "connection refused")
+	require.True(t, testPassed)
+}
+
 func TestClient_DeleteDocument(t *testing.T) {
 	srvAddr := randomURL()
 
@@ -446,6 +730,57 @@ func TestClient_DeleteDocument(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestClient_RestoreDocument(t *testing.T) {
+	srvAddr := randomURL()
+
+	srv := startEDVServer(t, srvAddr, &operation.EnabledExtensions{}, edvprovider.WithTombstoneRetention(time.Hour))
+
+	waitForServerToStart(t, srvAddr)
+
+	client := New("http://" + srvAddr + "/encrypted-data-vaults")
+
+	validConfig := getTestValidDataVaultConfiguration()
+	vaultLocationURL, _, err := client.CreateDataVault(&validConfig)
+	require.NoError(t, err)
+
+	vaultID := getVaultIDFromURL(vaultLocationURL)
+
+	_, err = client.CreateDocument(vaultID, getTestValidEncryptedDocument(testJWE))
+	require.NoError(t, err)
+
+	err = client.DeleteDocument(vaultID, testDocumentID)
+	require.NoError(t, err)
+
+	_, err = client.ReadDocument(vaultID, testDocumentID)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "status code 410")
+
+	err = client.RestoreDocument(vaultID, testDocumentID)
+	require.NoError(t, err)
+
+	receivedDoc, err := client.ReadDocument(vaultID, testDocumentID)
+	require.NoError(t, err)
+	require.Equal(t, testDocumentID, receivedDoc.ID)
+
+	err = client.RestoreDocument(vaultID, testDocumentID)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "status code 404")
+
+	err = srv.Shutdown(context.Background())
+	require.NoError(t, err)
+}
+
+func TestClient_RestoreDocument_ServerUnreachable(t *testing.T) {
+	srvAddr := randomURL()
+
+	client := New("http://" + srvAddr)
+
+	err := client.RestoreDocument(testVaultIDNonExistent, testDocumentID)
+
+	testPassed := strings.Contains(err.Error(), "EOF") || strings.Contains(err.Error(), "connection refused")
+	require.True(t, testPassed)
+}
+
 func TestClient_DeleteDocument_VaultNotFound(t *testing.T) {
 	srvAddr := randomURL()
 
@@ -497,6 +832,104 @@ func TestClient_QueryVault(t *testing.T) {
 		err = srv.Shutdown(context.Background())
 		require.NoError(t, err)
 	})
+	t.Run("Success: with query options", func(t *testing.T) {
+		srvAddr := randomURL()
+
+		var query models.Query
+
+		mockQueryVaultHTTPHandler :=
+			support.NewHTTPHandler(queryVaultEndpointPath, http.MethodPost,
+				func(rw http.ResponseWriter, req *http.Request) {
+					require.NoError(t, json.NewDecoder(req.Body).Decode(&query))
+
+					mockSuccessQueryVaultHandler(rw, req)
+				})
+
+		srv := startMockEDVServer(srvAddr, mockQueryVaultHTTPHandler)
+
+		waitForServerToStart(t, srvAddr)
+
+		client := New("http://" + srvAddr + "/encrypted-data-vaults")
+
+		ids, err := client.QueryVault("testVaultID", "name", "value",
+			WithHMACKeyID("https://example.com/kms/z7BgF536GaR"), WithPageSize(500))
+		require.NoError(t, err)
+		require.Len(t, ids, 2)
+		require.Equal(t, models.Query{
+			Name: "name", Value: "value", HMACKeyID: "https://example.com/kms/z7BgF536GaR", PageSize: 500,
+		}, query)
+
+		err = srv.Shutdown(context.Background())
+		require.NoError(t, err)
+	})
+	t.Run("Success: partial results are continued", func(t *testing.T) {
+		srvAddr := randomURL()
+
+		var continuationTokens []string
+
+		mockQueryVaultHTTPHandler :=
+			support.NewHTTPHandler(queryVaultEndpointPath, http.MethodPost,
+				func(rw http.ResponseWriter, req *http.Request) {
+					continuationToken := req.Header.Get(continuationTokenHeader)
+					continuationTokens = append(continuationTokens, continuationToken)
+
+					if continuationToken == "" {
+						rw.Header().Set(partialResultsHeader, "true")
+						rw.Header().Set(continuationTokenHeader, "token1")
+
+						_, err := rw.Write([]byte(`["docID1"]`))
+						require.NoError(t, err)
+
+						return
+					}
+
+					_, err := rw.Write([]byte(`["docID2"]`))
+					require.NoError(t, err)
+				})
+
+		srv := startMockEDVServer(srvAddr, mockQueryVaultHTTPHandler)
+
+		waitForServerToStart(t, srvAddr)
+
+		client := New("http://"+srvAddr+"/encrypted-data-vaults",
+			WithHeaders(func(req *http.Request) (*http.Header, error) {
+				req.Header.Set("Authorization", "Bearer token")
+
+				return &req.Header, nil
+			}))
+
+		ids, err := client.QueryVault("testVaultID", "name", "value")
+		require.NoError(t, err)
+		require.Equal(t, []string{"docID1", "docID2"}, ids)
+		require.Equal(t, []string{"", "token1"}, continuationTokens)
+
+		err = srv.Shutdown(context.Background())
+		require.NoError(t, err)
+	})
+	t.Run("Failure: partial results without a continuation token", func(t *testing.T) {
+		srvAddr := randomURL()
+
+		mockQueryVaultHTTPHandler :=
+			support.NewHTTPHandler(queryVaultEndpointPath, http.MethodPost,
+				func(rw http.ResponseWriter, req *http.Request) {
+					rw.Header().Set(partialResultsHeader, "true")
+
+					mockSuccessQueryVaultHandler(rw, req)
+				})
+
+		srv := startMockEDVServer(srvAddr, mockQueryVaultHTTPHandler)
+
+		waitForServerToStart(t, srvAddr)
+
+		client := New("http://" + srvAddr + "/encrypted-data-vaults")
+
+		ids, err := client.QueryVault("testVaultID", "name", "value")
+		require.EqualError(t, err, "the EDV server returned partial results without a continuation token")
+		require.Empty(t, ids)
+
+		err = srv.Shutdown(context.Background())
+		require.NoError(t, err)
+	})
 	t.Run("Failure: server unreachable", func(t *testing.T) {
 		srvAddr := randomURL()
 
@@ -556,6 +989,59 @@ func TestClient_QueryVault(t *testing.T) {
 	})
 }
 
+func TestClient_CountQueryMatches(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		srvAddr := randomURL()
+
+		var query models.Query
+
+		mockQueryVaultHTTPHandler :=
+			support.NewHTTPHandler(queryVaultEndpointPath, http.MethodPost,
+				func(rw http.ResponseWriter, req *http.Request) {
+					require.NoError(t, json.NewDecoder(req.Body).Decode(&query))
+
+					_, err := rw.Write([]byte(`{"count": 2}`))
+					require.NoError(t, err)
+				})
+
+		srv := startMockEDVServer(srvAddr, mockQueryVaultHTTPHandler)
+
+		waitForServerToStart(t, srvAddr)
+
+		client := New("http://" + srvAddr + "/encrypted-data-vaults")
+
+		count, err := client.CountQueryMatches("testVaultID", "name", "value", WithPageSize(500))
+		require.NoError(t, err)
+		require.Equal(t, 2, count)
+		require.Equal(t, models.Query{Name: "name", Value: "value", PageSize: 500, Count: true}, query)
+
+		err = srv.Shutdown(context.Background())
+		require.NoError(t, err)
+	})
+	t.Run("Failure: unexpected status code", func(t *testing.T) {
+		srvAddr := randomURL()
+
+		mockQueryVaultHTTPHandler :=
+			support.NewHTTPHandler(queryVaultEndpointPath, http.MethodPost,
+				func(rw http.ResponseWriter, req *http.Request) {
+					rw.WriteHeader(http.StatusBadRequest)
+				})
+
+		srv := startMockEDVServer(srvAddr, mockQueryVaultHTTPHandler)
+
+		waitForServerToStart(t, srvAddr)
+
+		client := New("http://" + srvAddr + "/encrypted-data-vaults")
+
+		_, err := client.CountQueryMatches("testVaultID", "name", "value")
+		require.EqualError(t, err,
+			"the EDV server returned status code 400 along with the following message: ")
+
+		err = srv.Shutdown(context.Background())
+		require.NoError(t, err)
+	})
+}
+
 func TestClient_QueryVaultForFullDocuments(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		srvAddr := randomURL()
@@ -650,7 +1136,7 @@ func TestClient_Batch(t *testing.T) {
 
 	upsertExistingDoc1 := models.VaultOperation{
 		Operation:         models.UpsertDocumentVaultOperation,
-		EncryptedDocument: models.EncryptedDocument{ID: testDocumentID, JWE: []byte(testJWE)},
+		EncryptedDocument: models.EncryptedDocument{ID: testDocumentID, Sequence: 1, JWE: []byte(testJWE)},
 	}
 
 	deleteExistingDoc1 := models.VaultOperation{
@@ -771,6 +1257,225 @@ func TestClient_Batch(t *testing.T) {
 	})
 }
 
+func TestClient_UpdateDataVaultConfiguration(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		srvAddr := randomURL()
+
+		srv := startEDVServer(t, srvAddr, nil)
+
+		waitForServerToStart(t, srvAddr)
+
+		client := New("http://" + srvAddr + "/encrypted-data-vaults")
+
+		validConfig := getTestValidDataVaultConfiguration()
+		vaultLocationURL, _, err := client.CreateDataVault(&validConfig)
+		require.NoError(t, err)
+
+		vaultID := getVaultIDFromURL(vaultLocationURL)
+
+		invokers := []string{"did:example:invoker"}
+
+		result, err := client.UpdateDataVaultConfiguration(vaultID,
+			&models.DataVaultConfigurationUpdate{Invoker: &invokers})
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), result.Configuration.Sequence)
+		require.Equal(t, invokers, result.Configuration.Invoker)
+		require.Equal(t, validConfig.Controller, result.Configuration.Controller)
+
+		err = srv.Shutdown(context.Background())
+		require.NoError(t, err)
+	})
+	t.Run("Failure: vault doesn't exist", func(t *testing.T) {
+		srvAddr := randomURL()
+
+		srv := startEDVServer(t, srvAddr, nil)
+
+		waitForServerToStart(t, srvAddr)
+
+		client := New("http://" + srvAddr + "/encrypted-data-vaults")
+
+		result, err := client.UpdateDataVaultConfiguration(testVaultIDNonExistent,
+			&models.DataVaultConfigurationUpdate{})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "the EDV server returned status code 404")
+		require.Nil(t, result)
+
+		err = srv.Shutdown(context.Background())
+		require.NoError(t, err)
+	})
+	t.Run("Failure: server unreachable", func(t *testing.T) {
+		client := New("http://" + randomURL() + "/encrypted-data-vaults")
+
+		result, err := client.UpdateDataVaultConfiguration(testVaultIDNonExistent,
+			&models.DataVaultConfigurationUpdate{})
+		require.Error(t, err)
+		require.Nil(t, result)
+	})
+}
+
+func TestClient_RotateReferenceID(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		srvAddr := randomURL()
+
+		srv := startEDVServer(t, srvAddr, nil)
+
+		waitForServerToStart(t, srvAddr)
+
+		client := New("http://" + srvAddr + "/encrypted-data-vaults")
+
+		validConfig := getTestValidDataVaultConfiguration()
+		vaultLocationURL, _, err := client.CreateDataVault(&validConfig)
+		require.NoError(t, err)
+
+		vaultID := getVaultIDFromURL(vaultLocationURL)
+
+		config, err := client.RotateReferenceID(vaultID, &models.ReferenceIDRotation{ReferenceID: "rotatedRefID"})
+		require.NoError(t, err)
+		require.Equal(t, "rotatedRefID", config.ReferenceID)
+		require.Equal(t, uint64(1), config.Sequence)
+
+		err = srv.Shutdown(context.Background())
+		require.NoError(t, err)
+	})
+	t.Run("Failure: vault doesn't exist", func(t *testing.T) {
+		srvAddr := randomURL()
+
+		srv := startEDVServer(t, srvAddr, nil)
+
+		waitForServerToStart(t, srvAddr)
+
+		client := New("http://" + srvAddr + "/encrypted-data-vaults")
+
+		config, err := client.RotateReferenceID(testVaultIDNonExistent,
+			&models.ReferenceIDRotation{ReferenceID: "rotatedRefID"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "the EDV server returned status code 404")
+		require.Nil(t, config)
+
+		err = srv.Shutdown(context.Background())
+		require.NoError(t, err)
+	})
+}
+
+func TestClient_CheckBatchCapacity(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		srvAddr := randomURL()
+
+		srv := startEDVServer(t, srvAddr, &operation.EnabledExtensions{Batch: true})
+
+		waitForServerToStart(t, srvAddr)
+
+		client := New("http://" + srvAddr + "/encrypted-data-vaults")
+
+		validConfig := getTestValidDataVaultConfiguration()
+		vaultLocationURL, _, err := client.CreateDataVault(&validConfig)
+		require.NoError(t, err)
+
+		vaultID := getVaultIDFromURL(vaultLocationURL)
+
+		result, err := client.CheckBatchCapacity(vaultID, 10, 1000)
+		require.NoError(t, err)
+		require.True(t, result.Accepted)
+
+		err = srv.Shutdown(context.Background())
+		require.NoError(t, err)
+	})
+	t.Run("Failure: vault doesn't exist", func(t *testing.T) {
+		srvAddr := randomURL()
+
+		srv := startEDVServer(t, srvAddr, &operation.EnabledExtensions{Batch: true})
+
+		waitForServerToStart(t, srvAddr)
+
+		client := New("http://" + srvAddr + "/encrypted-data-vaults")
+
+		result, err := client.CheckBatchCapacity(testVaultIDNonExistent, 10, 1000)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "the EDV server returned status code 404")
+		require.Nil(t, result)
+
+		err = srv.Shutdown(context.Background())
+		require.NoError(t, err)
+	})
+	t.Run("Failure: server unreachable", func(t *testing.T) {
+		client := New("http://" + randomURL() + "/encrypted-data-vaults")
+
+		result, err := client.CheckBatchCapacity(testVaultIDNonExistent, 10, 1000)
+		require.Error(t, err)
+		require.Nil(t, result)
+	})
+	t.Run("Failure: error while marshalling capacity check", func(t *testing.T) {
+		client := New("EDVServerURL")
+		client.marshal = failingMarshal
+
+		result, err := client.CheckBatchCapacity("VaultID", 10, 1000)
+		require.EqualError(t, err, errFailingMarshal.Error())
+		require.Nil(t, result)
+	})
+}
+
+func TestClient_DelegateAndRevokeCapability(t *testing.T) {
+	const testCapability = `{"id":"urn:uuid:delegated"}`
+
+	var receivedDelegation models.CapabilityDelegation
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/encrypted-data-vaults/vault1/capabilities":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&receivedDelegation))
+
+			w.WriteHeader(http.StatusCreated)
+
+			_, err := w.Write([]byte(testCapability))
+			require.NoError(t, err)
+		case r.Method == http.MethodDelete &&
+			r.URL.EscapedPath() == "/encrypted-data-vaults/vault1/capabilities/urn:uuid:delegated":
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL + "/encrypted-data-vaults")
+
+	t.Run("Success", func(t *testing.T) {
+		capability, err := client.DelegateCapability("vault1",
+			&models.CapabilityDelegation{Invoker: "did:key:z1", AllowedActions: []string{"read"}})
+		require.NoError(t, err)
+		require.Equal(t, testCapability, string(capability))
+		require.Equal(t, models.CapabilityDelegation{Invoker: "did:key:z1", AllowedActions: []string{"read"}},
+			receivedDelegation)
+
+		require.NoError(t, client.RevokeCapability("vault1", "urn:uuid:delegated"))
+	})
+	t.Run("Failure: server returned an error", func(t *testing.T) {
+		capability, err := client.DelegateCapability("vault2", &models.CapabilityDelegation{})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "the EDV server returned status code 403")
+		require.Nil(t, capability)
+
+		err = client.RevokeCapability("vault2", "urn:uuid:delegated")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "the EDV server returned status code 403")
+	})
+	t.Run("Failure: server unreachable", func(t *testing.T) {
+		unreachableClient := New("http://" + randomURL() + "/encrypted-data-vaults")
+
+		_, err := unreachableClient.DelegateCapability("vault1", &models.CapabilityDelegation{})
+		require.Error(t, err)
+
+		err = unreachableClient.RevokeCapability("vault1", "urn:uuid:delegated")
+		require.Error(t, err)
+	})
+	t.Run("Failure: error while marshalling capability delegation", func(t *testing.T) {
+		failingClient := New("EDVServerURL")
+		failingClient.marshal = failingMarshal
+
+		_, err := failingClient.DelegateCapability("vault1", &models.CapabilityDelegation{})
+		require.EqualError(t, err, "failed to marshal capability delegation: "+errFailingMarshal.Error())
+	})
+}
+
 func getTestValidDataVaultConfiguration() models.DataVaultConfiguration {
 	testDataVaultConfiguration := models.DataVaultConfiguration{
 		Sequence:   0,
@@ -800,10 +1505,11 @@ func getTestValidEncryptedDocument(testJWE string) *models.EncryptedDocument {
 }
 
 // Returns a reference to the server so the caller can stop it.
-func startEDVServer(t *testing.T, srvAddr string, enabledExtensions *operation.EnabledExtensions) *http.Server {
+func startEDVServer(t *testing.T, srvAddr string, enabledExtensions *operation.EnabledExtensions,
+	providerOpts ...edvprovider.Option) *http.Server {
 	t.Helper()
 
-	memProv := edvprovider.NewProvider(mem.NewProvider(), 100)
+	memProv := edvprovider.NewProvider(mem.NewProvider(), 100, providerOpts...)
 	_, err := memProv.OpenStore(edvprovider.VaultConfigurationStoreName)
 	require.NoError(t, err)
 
@@ -885,6 +1591,12 @@ func mockFailQueryVaultHandler(rw http.ResponseWriter, req *http.Request) {
 	}
 }
 
+type failingWriter struct{}
+
+func (*failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("failingWriter always fails")
+}
+
 func failingMarshal(_ interface{}) ([]byte, error) {
 	return nil, errFailingMarshal
 }
@@ -0,0 +1,102 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type retry struct {
+	retries uint
+	backoff time.Duration
+}
+
+// WithRetry option makes the client retry requests that the EDV server rejected with a 429 (Too Many Requests) or
+// 503 (Service Unavailable) status code, along with GET, HEAD and DELETE requests that couldn't be sent, up to retries
+// times. A retry waits for as long as the Retry-After header of the rejected request says, or otherwise for backoff,
+// which doubles with every retry of the request.
+func WithRetry(retries uint, backoff time.Duration) Option {
+	return func(opts *Client) {
+		opts.retry = &retry{retries: retries, backoff: backoff}
+	}
+}
+
+// do sends a request and returns its response, retrying it as described in WithRetry. The request is created again
+// for every retry, so that its headers (and their signatures) are too.
+func (c *Client) do(method, endpoint string, body []byte, addHeadersFunc addHeaders) (*http.Response, error) {
+	var backoff time.Duration
+
+	if c.retry != nil {
+		backoff = c.retry.backoff
+	}
+
+	for attempt := uint(0); ; attempt++ {
+		req, err := newRequest(method, endpoint, body, addHeadersFunc)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.httpClient.Do(req) //nolint: bodyclose
+		if c.retry == nil || attempt == c.retry.retries || !shouldRetry(method, resp, err) {
+			return resp, err
+		}
+
+		wait := backoff
+
+		if err == nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				wait = retryAfter
+			}
+
+			c.closeReadCloser(resp.Body)
+
+			c.log().Debugf("retrying %s request to %s in %s after status code %d", method, endpoint, wait,
+				resp.StatusCode)
+		} else {
+			c.log().Debugf("retrying %s request to %s in %s after error: %s", method, endpoint, wait, err)
+		}
+
+		time.Sleep(wait)
+
+		backoff *= 2
+	}
+}
+
+// shouldRetry returns whether a request should be retried given its response, or the error from sending it. Only
+// requests that the server couldn't have handled are retried, unless they're idempotent.
+func shouldRetry(method string, resp *http.Response, err error) bool {
+	if err != nil {
+		return method == http.MethodGet || method == http.MethodHead || method == http.MethodDelete
+	}
+
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a number of seconds or an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	wait := time.Until(date)
+	if wait < 0 {
+		wait = 0
+	}
+
+	return wait, true
+}
@@ -0,0 +1,134 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// flakyHTTPClient fails to send the first failures requests, and sends the others with the default HTTP client.
+type flakyHTTPClient struct {
+	failures int
+	requests int
+}
+
+func (c *flakyHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	c.requests++
+
+	if c.requests <= c.failures {
+		return nil, errors.New("connection reset")
+	}
+
+	return http.DefaultClient.Do(req)
+}
+
+func TestWithRetry(t *testing.T) {
+	t.Run("Rejected requests are retried", func(t *testing.T) {
+		var requests int
+
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			requests++
+
+			switch requests {
+			case 1:
+				rw.Header().Set("Retry-After", "0")
+				rw.WriteHeader(http.StatusTooManyRequests)
+			case 2:
+				rw.WriteHeader(http.StatusServiceUnavailable)
+			default:
+				rw.WriteHeader(http.StatusOK)
+			}
+		}))
+		defer srv.Close()
+
+		client := New(srv.URL, WithRetry(2, time.Millisecond))
+
+		require.NoError(t, client.UpdateDocument("vault1", "doc1", getTestValidEncryptedDocument(testJWE)))
+		require.Equal(t, 3, requests)
+	})
+	t.Run("The last response is returned once retries are used up", func(t *testing.T) {
+		var requests int
+
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			requests++
+
+			rw.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer srv.Close()
+
+		client := New(srv.URL, WithRetry(1, time.Millisecond))
+
+		err := client.DeleteDocument("vault1", "doc1")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "429")
+		require.Equal(t, 2, requests)
+	})
+	t.Run("Requests that fail to be sent are only retried if they're idempotent", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(http.StatusOK)
+		}))
+		defer srv.Close()
+
+		httpClient := &flakyHTTPClient{failures: 1}
+
+		client := New(srv.URL, WithHTTPClient(httpClient), WithRetry(1, time.Millisecond))
+
+		exists, err := client.DocumentExists("vault1", "doc1")
+		require.NoError(t, err)
+		require.True(t, exists)
+		require.Equal(t, 2, httpClient.requests)
+
+		httpClient = &flakyHTTPClient{failures: 1}
+
+		client = New(srv.URL, WithHTTPClient(httpClient), WithRetry(1, time.Millisecond))
+
+		err = client.UpdateDocument("vault1", "doc1", getTestValidEncryptedDocument(testJWE))
+		require.EqualError(t, err, "connection reset")
+		require.Equal(t, 1, httpClient.requests)
+	})
+	t.Run("Requests aren't retried without the option", func(t *testing.T) {
+		var requests int
+
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			requests++
+
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+
+		client := New(srv.URL)
+
+		require.Error(t, client.DeleteDocument("vault1", "doc1"))
+		require.Equal(t, 1, requests)
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	wait, ok := parseRetryAfter("3")
+	require.True(t, ok)
+	require.Equal(t, 3*time.Second, wait)
+
+	wait, ok = parseRetryAfter(time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat))
+	require.True(t, ok)
+	require.Zero(t, wait)
+
+	wait, ok = parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	require.True(t, ok)
+	require.InDelta(t, time.Hour, wait, float64(time.Minute))
+
+	_, ok = parseRetryAfter("")
+	require.False(t, ok)
+
+	_, ok = parseRetryAfter("soon")
+	require.False(t, ok)
+}
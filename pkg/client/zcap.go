@@ -0,0 +1,63 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/hyperledger/aries-framework-go/pkg/crypto"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	"github.com/igor-pavlenko/httpsignatures-go"
+	"github.com/trustbloc/edge-core/pkg/zcapld"
+)
+
+// WithZCAP option authorizes the client's requests with ZCAP-LD, by invoking the given capability. Each request gets
+// a Capability-Invocation header with the compressed capability and the action of the request ("read" for GET and
+// HEAD requests, and "write" for the others), and the header is then signed with HTTP signatures by the key of
+// verificationMethod (a did:key URL), using crypto and the keys in keyManager. Requests are signed again whenever
+// they're retried. The headers replace those set with WithHeaders, and are themselves replaced by those set with the
+// WithRequestHeader request option.
+func WithZCAP(capability *zcapld.Capability, verificationMethod string, crypto crypto.Crypto,
+	keyManager kms.KeyManager) Option {
+	return func(opts *Client) {
+		opts.headersFunc = func(req *http.Request) (*http.Header, error) {
+			compressedCapability, err := zcapld.CompressZCAP(capability)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compress capability: %w", err)
+			}
+
+			req.Header.Set(zcapld.CapabilityInvocationHTTPHeader,
+				fmt.Sprintf(`zcap capability="%s",action="%s"`, compressedCapability, invocationAction(req)))
+
+			signatures := httpsignatures.NewHTTPSignatures(&zcapld.AriesDIDKeySecrets{})
+			// The invocation is signed along with the time of the signature, so that it can't be changed.
+			signatures.SetDefaultSignatureHeaders([]string{"(created)", zcapld.CapabilityInvocationHTTPHeader})
+			signatures.SetSignatureHashAlgorithm(&zcapld.AriesDIDKeySignatureHashAlgorithm{
+				Crypto: crypto,
+				KMS:    keyManager,
+			})
+
+			err = signatures.Sign(verificationMethod, req)
+			if err != nil {
+				return nil, fmt.Errorf("failed to sign request: %w", err)
+			}
+
+			return &req.Header, nil
+		}
+	}
+}
+
+// invocationAction returns the action that the EDV server expects a capability invocation for the given request to
+// have.
+func invocationAction(req *http.Request) string {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return "read"
+	}
+
+	return "write"
+}
@@ -0,0 +1,74 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	mockcrypto "github.com/hyperledger/aries-framework-go/pkg/mock/crypto"
+	mockkms "github.com/hyperledger/aries-framework-go/pkg/mock/kms"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr/fingerprint"
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/edge-core/pkg/zcapld"
+)
+
+func TestWithZCAP(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	_, verificationMethod := fingerprint.CreateDIDKey(publicKey)
+
+	capability := &zcapld.Capability{ID: "urn:uuid:capability", Invoker: verificationMethod}
+
+	compressedCapability, err := zcapld.CompressZCAP(capability)
+	require.NoError(t, err)
+
+	t.Run("Requests are signed invocations of the capability", func(t *testing.T) {
+		invocations := make(map[string]string)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			invocations[req.Method] = req.Header.Get(zcapld.CapabilityInvocationHTTPHeader)
+
+			signature := req.Header.Get("Signature")
+			require.Contains(t, signature, `keyId="`+verificationMethod+`"`)
+			require.Contains(t, signature, zcapld.CapabilityInvocationHTTPHeader)
+
+			rw.WriteHeader(http.StatusOK)
+		}))
+		defer srv.Close()
+
+		client := New(srv.URL, WithZCAP(capability, verificationMethod,
+			&mockcrypto.Crypto{SignValue: []byte("signature")}, &mockkms.KeyManager{}))
+
+		exists, err := client.DocumentExists("vault1", "doc1")
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		require.NoError(t, client.DeleteDocument("vault1", "doc1"))
+
+		require.Equal(t, map[string]string{
+			http.MethodHead:   `zcap capability="` + compressedCapability + `",action="read"`,
+			http.MethodDelete: `zcap capability="` + compressedCapability + `",action="write"`,
+		}, invocations)
+	})
+	t.Run("Fail to sign request", func(t *testing.T) {
+		client := New("http://localhost", WithZCAP(capability, verificationMethod,
+			&mockcrypto.Crypto{SignErr: errors.New("sign error")}, &mockkms.KeyManager{}))
+
+		exists, err := client.DocumentExists("vault1", "doc1")
+		require.False(t, exists)
+		require.Error(t, err)
+		require.True(t, strings.Contains(err.Error(), "failed to sign request") &&
+			strings.Contains(err.Error(), "sign error"), err.Error())
+	})
+}
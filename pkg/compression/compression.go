@@ -0,0 +1,506 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package compression decompresses request bodies and compresses response bodies for the EDV server. The encoding of
+// a request body is given by its Content-Encoding header, and responses are compressed with the encoding that the
+// client prefers out of the ones listed in its Accept-Encoding header.
+package compression
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/trustbloc/edv/pkg/logging"
+)
+
+// The encodings that are supported.
+const (
+	// Gzip is the gzip encoding.
+	Gzip = "gzip"
+	// Zstd is the Zstandard encoding.
+	Zstd = "zstd"
+)
+
+const (
+	logModuleName = "compression"
+
+	identityEncoding = "identity"
+	anyEncoding      = "*"
+	qualityParameter = "q"
+	// The number of parts in a parameter of an Accept-Encoding entry, which are its name and its value.
+	parameterParts = 2
+
+	acceptEncodingHeader  = "Accept-Encoding"
+	contentEncodingHeader = "Content-Encoding"
+	contentLengthHeader   = "Content-Length"
+	contentTypeHeader     = "Content-Type"
+	varyHeader            = "Vary"
+
+	// unsupportedEncoding is the body of the response to requests whose body has an encoding that isn't supported.
+	unsupportedEncoding = "request body has unsupported content encoding %s"
+	// invalidBody is the body of the response to requests whose body can't be decompressed.
+	invalidBody = "failed to decompress %s request body: %s"
+	// bodyTooLarge is the body of the response to requests whose decompressed body is larger than the maximum size.
+	bodyTooLarge = "decompressed request body is larger than the maximum of %d bytes"
+
+	// DefaultMaxDecompressedSize is the maximum size in bytes of a decompressed request body, unless set with
+	// WithMaxDecompressedSize.
+	DefaultMaxDecompressedSize = 64 << 20
+)
+
+// ErrBodyTooLarge is returned when reading a decompressed request body that's larger than the maximum size.
+var ErrBodyTooLarge = errors.New("decompressed request body is too large")
+
+var logger = logging.New(logModuleName)
+
+// Option configures the Compressor.
+type Option func(c *Compressor)
+
+// WithLogger has the Compressor log with the given logger instead of the edge-core logger for its module.
+func WithLogger(logger logging.Logger) Option {
+	return func(c *Compressor) {
+		c.logger = logger
+	}
+}
+
+// WithMaxDecompressedSize sets the maximum size in bytes of a decompressed request body, so that a small compressed
+// body can't expand into one that exhausts the server's memory. If it's 0, then there's no limit. Defaults to
+// DefaultMaxDecompressedSize.
+func WithMaxDecompressedSize(maxSize uint64) Option {
+	return func(c *Compressor) {
+		c.maxDecompressedSize = maxSize
+	}
+}
+
+// Compressor decompresses request bodies and compresses response bodies with the encodings it supports.
+type Compressor struct {
+	encodings           []string
+	maxDecompressedSize uint64
+	logger              logging.Logger
+}
+
+// New returns a new Compressor that supports the given encodings. If a client accepts more than one of them equally,
+// then the one that comes first is used to compress responses.
+func New(encodings []string, opts ...Option) (*Compressor, error) {
+	for _, encoding := range encodings {
+		if encoding != Gzip && encoding != Zstd {
+			return nil, fmt.Errorf("unsupported encoding %s", encoding)
+		}
+	}
+
+	c := &Compressor{encodings: encodings, maxDecompressedSize: DefaultMaxDecompressedSize, logger: logger}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
+}
+
+// Middleware returns a handler that decompresses the body of each request before passing it to next, and that
+// compresses what next writes if the client accepts one of the supported encodings. Requests whose body has an
+// encoding that isn't supported are rejected with a 415 status code. Once more than the maximum decompressed size has
+// been read from a request's body, reading it fails with ErrBodyTooLarge, and the request is rejected with a 413
+// status code instead of next's response, unless next has already started responding.
+func (c *Compressor) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.FromContext(r.Context(), c.logger)
+
+		body, ok := c.decompressRequest(logger, w, r)
+		if !ok {
+			return
+		}
+
+		if body != nil {
+			defer func() {
+				if err := body.Close(); err != nil {
+					logger.Warnf("Failed to close decompressed request body: %s", err)
+				}
+			}()
+		}
+
+		w.Header().Add(varyHeader, acceptEncodingHeader)
+
+		encoding := c.responseEncoding(r.Header.Get(acceptEncodingHeader))
+		if encoding == "" || r.Method == http.MethodHead {
+			serveLimited(logger, next, w, r, body)
+
+			return
+		}
+
+		cw := &compressingResponseWriter{ResponseWriter: w, encoding: encoding, logger: logger}
+		defer cw.close()
+
+		serveLimited(logger, next, cw, r, body)
+	})
+}
+
+// serveLimited passes r on to next, and responds with a 413 status code instead of next's response if more of r's
+// body was read than the limit allows.
+func serveLimited(logger logging.Logger, next http.Handler, w http.ResponseWriter, r *http.Request,
+	body io.ReadCloser) {
+	limited, ok := body.(*limitedBody)
+	if !ok {
+		next.ServeHTTP(w, r)
+
+		return
+	}
+
+	lw := &limitedResponseWriter{ResponseWriter: w, body: limited}
+
+	next.ServeHTTP(lw, r)
+
+	if lw.discard() {
+		logger.Infof("Rejected %s request to %s since its decompressed body is larger than %d bytes", r.Method,
+			r.URL.Path, limited.maxSize)
+
+		w.Header().Set(contentTypeHeader, "text/plain; charset=utf-8")
+		writeError(logger, w, http.StatusRequestEntityTooLarge, fmt.Sprintf(bodyTooLarge, limited.maxSize))
+	}
+}
+
+// decompressRequest replaces the body of r with one that decompresses it, and returns the new body so that it can be
+// closed once the request has been handled. If the body can't be decompressed, then an error response is written and
+// false is returned.
+func (c *Compressor) decompressRequest(logger logging.Logger, w http.ResponseWriter,
+	r *http.Request) (io.ReadCloser, bool) {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get(contentEncodingHeader)))
+	if encoding == "" || encoding == identityEncoding {
+		return nil, true
+	}
+
+	if !c.supports(encoding) {
+		w.Header().Set(acceptEncodingHeader, strings.Join(c.encodings, ", "))
+		writeError(logger, w, http.StatusUnsupportedMediaType, fmt.Sprintf(unsupportedEncoding, encoding))
+
+		return nil, false
+	}
+
+	body, err := newDecoder(encoding, r.Body)
+	if err != nil {
+		writeError(logger, w, http.StatusBadRequest, fmt.Sprintf(invalidBody, encoding, err))
+
+		return nil, false
+	}
+
+	if c.maxDecompressedSize > 0 {
+		body = &limitedBody{ReadCloser: body, maxSize: c.maxDecompressedSize, remaining: c.maxDecompressedSize}
+	}
+
+	r.Body = body
+	r.ContentLength = -1
+	r.Header.Del(contentEncodingHeader)
+	r.Header.Del(contentLengthHeader)
+
+	return body, true
+}
+
+func (c *Compressor) supports(encoding string) bool {
+	for _, supported := range c.encodings {
+		if encoding == supported {
+			return true
+		}
+	}
+
+	return false
+}
+
+// responseEncoding returns the supported encoding that the given Accept-Encoding header gives the highest quality to,
+// or an empty string if it doesn't accept any of them.
+func (c *Compressor) responseEncoding(acceptEncoding string) string {
+	qualities := acceptedEncodings(acceptEncoding)
+
+	var (
+		best        string
+		bestQuality float64
+	)
+
+	for _, encoding := range c.encodings {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality = qualities[anyEncoding]
+		}
+
+		if quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+
+	return best
+}
+
+// acceptedEncodings returns the quality that the given Accept-Encoding header gives to each encoding in it.
+func acceptedEncodings(acceptEncoding string) map[string]float64 {
+	qualities := make(map[string]float64)
+
+	for _, entry := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(entry, ";")
+
+		encoding := strings.ToLower(strings.TrimSpace(params[0]))
+		if encoding == "" {
+			continue
+		}
+
+		quality := 1.0
+
+		for _, param := range params[1:] {
+			nameAndValue := strings.SplitN(param, "=", parameterParts)
+			if len(nameAndValue) != parameterParts || strings.TrimSpace(nameAndValue[0]) != qualityParameter {
+				continue
+			}
+
+			var err error
+
+			quality, err = strconv.ParseFloat(strings.TrimSpace(nameAndValue[1]), 64)
+			if err != nil {
+				quality = 0
+			}
+		}
+
+		qualities[encoding] = quality
+	}
+
+	return qualities
+}
+
+func newDecoder(encoding string, body io.Reader) (io.ReadCloser, error) {
+	if encoding == Zstd {
+		decoder, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+
+		return decoder.IOReadCloser(), nil
+	}
+
+	return gzip.NewReader(body)
+}
+
+// encoder is implemented by both gzip.Writer and zstd.Encoder.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+func newEncoder(encoding string, w io.Writer) (encoder, error) {
+	if encoding == Zstd {
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	}
+
+	return gzip.NewWriter(w), nil
+}
+
+// compressingResponseWriter compresses what's written to it. The status code is held back until the body starts
+// being written, so that responses without a body or with one that's already encoded are left as they are.
+type compressingResponseWriter struct {
+	http.ResponseWriter
+	encoding string
+	logger   logging.Logger
+	status   int
+	started  bool
+	encoder  encoder
+}
+
+func (w *compressingResponseWriter) WriteHeader(statusCode int) {
+	if w.started || w.status != 0 {
+		return
+	}
+
+	if !bodyAllowed(statusCode) {
+		w.started = true
+		w.ResponseWriter.WriteHeader(statusCode)
+
+		return
+	}
+
+	w.status = statusCode
+}
+
+func (w *compressingResponseWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.start(p)
+	}
+
+	if w.encoder == nil {
+		return w.ResponseWriter.Write(p)
+	}
+
+	return w.encoder.Write(p)
+}
+
+// Flush sends what has been compressed so far to the client, so that streamed responses stay streamed.
+func (w *compressingResponseWriter) Flush() {
+	if !w.started {
+		w.start(nil)
+	}
+
+	if w.encoder != nil {
+		if err := w.encoder.Flush(); err != nil {
+			w.logger.Warnf("Failed to flush %s response: %s", w.encoding, err)
+		}
+	}
+
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// start writes the status code, and sets up the encoder unless the handler has already encoded the body itself.
+// firstWrite is used to detect the content type of the body if the handler didn't set it.
+func (w *compressingResponseWriter) start(firstWrite []byte) {
+	w.started = true
+
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	header := w.Header()
+
+	if header.Get(contentEncodingHeader) == "" {
+		compressor, err := newEncoder(w.encoding, w.ResponseWriter)
+		if err != nil {
+			w.logger.Warnf("Failed to create %s encoder, so the response won't be compressed: %s", w.encoding, err)
+		} else {
+			// Otherwise the content type would be detected from the compressed body.
+			if header.Get(contentTypeHeader) == "" && len(firstWrite) > 0 {
+				header.Set(contentTypeHeader, http.DetectContentType(firstWrite))
+			}
+
+			header.Set(contentEncodingHeader, w.encoding)
+			header.Del(contentLengthHeader)
+
+			w.encoder = compressor
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// close finishes the compressed body, or writes the status code if nothing was written.
+func (w *compressingResponseWriter) close() {
+	if !w.started {
+		w.started = true
+
+		if w.status != 0 {
+			w.ResponseWriter.WriteHeader(w.status)
+		}
+
+		return
+	}
+
+	if w.encoder != nil {
+		if err := w.encoder.Close(); err != nil {
+			w.logger.Warnf("Failed to finish %s response: %s", w.encoding, err)
+		}
+	}
+}
+
+// limitedBody fails with ErrBodyTooLarge once more than maxSize bytes have been read from the body it wraps.
+type limitedBody struct {
+	io.ReadCloser
+	maxSize   uint64
+	remaining uint64
+	exceeded  bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, ErrBodyTooLarge
+	}
+
+	if b.remaining == 0 {
+		// The body is as large as it's allowed to be, so it must end here.
+		var next [1]byte
+
+		n, err := b.ReadCloser.Read(next[:])
+		if n > 0 {
+			b.exceeded = true
+
+			return 0, ErrBodyTooLarge
+		}
+
+		return 0, err
+	}
+
+	if uint64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= uint64(n)
+
+	return n, err
+}
+
+// limitedResponseWriter discards the response that the handler writes once it has read more of the request body
+// than the limit allows, so that a 413 response can be written instead. Responses that have already been started are
+// left as they are.
+type limitedResponseWriter struct {
+	http.ResponseWriter
+	body       *limitedBody
+	started    bool
+	discarding bool
+}
+
+func (w *limitedResponseWriter) WriteHeader(statusCode int) {
+	if w.discard() {
+		return
+	}
+
+	w.started = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *limitedResponseWriter) Write(p []byte) (int, error) {
+	if w.discard() {
+		return len(p), nil
+	}
+
+	w.started = true
+
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush sends any buffered data to the client, if the underlying response writer supports it.
+func (w *limitedResponseWriter) Flush() {
+	if w.discard() {
+		return
+	}
+
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.started = true
+
+		flusher.Flush()
+	}
+}
+
+// discard returns whether what the handler writes is to be discarded.
+func (w *limitedResponseWriter) discard() bool {
+	if !w.started && w.body.exceeded {
+		w.discarding = true
+	}
+
+	return w.discarding
+}
+
+func bodyAllowed(statusCode int) bool {
+	return statusCode >= http.StatusOK && statusCode != http.StatusNoContent && statusCode != http.StatusNotModified
+}
+
+func writeError(logger logging.Logger, w http.ResponseWriter, statusCode int, message string) {
+	w.WriteHeader(statusCode)
+
+	if _, err := w.Write([]byte(message)); err != nil {
+		logger.Errorf("Failed to write response: %s", err)
+	}
+}
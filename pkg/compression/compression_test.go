@@ -0,0 +1,335 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+const testBody = `{"id":"VJYHHJx4C8J9Fsgz7rZqSp"}`
+
+func TestNew(t *testing.T) {
+	_, err := New([]string{Gzip, Zstd})
+	require.NoError(t, err)
+
+	_, err = New([]string{"br"})
+	require.EqualError(t, err, "unsupported encoding br")
+}
+
+func TestCompressor_Middleware_Requests(t *testing.T) {
+	compressor, err := New([]string{Gzip, Zstd})
+	require.NoError(t, err)
+
+	var (
+		received        []byte
+		contentEncoding string
+	)
+
+	handler := compressor.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var errRead error
+
+		received, errRead = ioutil.ReadAll(r.Body)
+		require.NoError(t, errRead)
+
+		contentEncoding = r.Header.Get(contentEncodingHeader)
+	}))
+
+	t.Run("Compressed request bodies are decompressed", func(t *testing.T) {
+		for _, encoding := range []string{Gzip, Zstd, "GZIP"} {
+			received = nil
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(compress(t, encoding, testBody)))
+			req.Header.Set(contentEncodingHeader, encoding)
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			require.Equal(t, http.StatusOK, rw.Code, encoding)
+			require.Equal(t, testBody, string(received), encoding)
+			require.Empty(t, contentEncoding, encoding)
+		}
+	})
+	t.Run("Uncompressed request bodies are passed through", func(t *testing.T) {
+		for _, encoding := range []string{"", identityEncoding} {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(testBody))
+			req.Header.Set(contentEncodingHeader, encoding)
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			require.Equal(t, http.StatusOK, rw.Code)
+			require.Equal(t, testBody, string(received))
+		}
+	})
+	t.Run("Unsupported encoding", func(t *testing.T) {
+		gzipOnly, errNew := New([]string{Gzip})
+		require.NoError(t, errNew)
+
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(compress(t, Zstd, testBody)))
+		req.Header.Set(contentEncodingHeader, Zstd)
+
+		rw := httptest.NewRecorder()
+		gzipOnly.Middleware(handler).ServeHTTP(rw, req)
+
+		require.Equal(t, http.StatusUnsupportedMediaType, rw.Code)
+		require.Equal(t, "request body has unsupported content encoding zstd", rw.Body.String())
+		require.Equal(t, Gzip, rw.Header().Get(acceptEncodingHeader))
+	})
+	t.Run("Invalid gzip body", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(testBody))
+		req.Header.Set(contentEncodingHeader, Gzip)
+
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		require.Equal(t, http.StatusBadRequest, rw.Code)
+		require.Equal(t, "failed to decompress gzip request body: gzip: invalid header", rw.Body.String())
+	})
+	t.Run("Decompressed bodies larger than the maximum size", func(t *testing.T) {
+		limited, errNew := New([]string{Gzip}, WithMaxDecompressedSize(uint64(len(testBody))))
+		require.NoError(t, errNew)
+
+		var errRead error
+
+		limitedHandler := limited.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, errRead = ioutil.ReadAll(r.Body)
+			if errRead != nil {
+				w.Header().Set(contentTypeHeader, "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}))
+
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(compress(t, Gzip, testBody)))
+		req.Header.Set(contentEncodingHeader, Gzip)
+
+		rw := httptest.NewRecorder()
+		limitedHandler.ServeHTTP(rw, req)
+
+		require.NoError(t, errRead)
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		req = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(compress(t, Gzip, testBody+" ")))
+		req.Header.Set(contentEncodingHeader, Gzip)
+		req.Header.Set(acceptEncodingHeader, Gzip)
+
+		rw = httptest.NewRecorder()
+		limitedHandler.ServeHTTP(rw, req)
+
+		require.ErrorIs(t, errRead, ErrBodyTooLarge)
+		require.Equal(t, http.StatusRequestEntityTooLarge, rw.Code)
+		require.Equal(t, "text/plain; charset=utf-8", rw.Header().Get(contentTypeHeader))
+		require.Equal(t, "decompressed request body is larger than the maximum of 31 bytes",
+			decompress(t, Gzip, rw.Body.Bytes()))
+	})
+	t.Run("Handlers that don't respond to a body over the maximum size", func(t *testing.T) {
+		limited, errNew := New([]string{Gzip}, WithMaxDecompressedSize(1))
+		require.NoError(t, errNew)
+
+		limitedHandler := limited.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = ioutil.ReadAll(r.Body)
+		}))
+
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(compress(t, Gzip, testBody)))
+		req.Header.Set(contentEncodingHeader, Gzip)
+
+		rw := httptest.NewRecorder()
+		limitedHandler.ServeHTTP(rw, req)
+
+		require.Equal(t, http.StatusRequestEntityTooLarge, rw.Code)
+		require.Equal(t, "decompressed request body is larger than the maximum of 1 bytes", rw.Body.String())
+	})
+}
+
+func TestCompressor_Middleware_Responses(t *testing.T) {
+	compressor, err := New([]string{Zstd, Gzip})
+	require.NoError(t, err)
+
+	t.Run("Responses are compressed with the encoding the client prefers", func(t *testing.T) {
+		tests := []struct {
+			acceptEncoding string
+			encoding       string
+		}{
+			{"gzip", Gzip},
+			{"gzip, zstd", Zstd},
+			{"gzip;q=1.0, zstd;q=0.5", Gzip},
+			{"zstd;q=0, *", Gzip},
+			{"br, *;q=0.1", Zstd},
+			{"br", ""},
+			{"gzip;q=0", ""},
+			{"gzip;q=invalid", ""},
+			{"", ""},
+		}
+
+		handler := compressor.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(contentLengthHeader, "30")
+			w.WriteHeader(http.StatusCreated)
+
+			_, errWrite := w.Write([]byte(testBody))
+			require.NoError(t, errWrite)
+		}))
+
+		for _, test := range tests {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(acceptEncodingHeader, test.acceptEncoding)
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			require.Equal(t, http.StatusCreated, rw.Code, test.acceptEncoding)
+			require.Equal(t, test.encoding, rw.Header().Get(contentEncodingHeader), test.acceptEncoding)
+			require.Equal(t, acceptEncodingHeader, rw.Header().Get(varyHeader), test.acceptEncoding)
+			require.Equal(t, testBody, decompress(t, test.encoding, rw.Body.Bytes()), test.acceptEncoding)
+
+			if test.encoding != "" {
+				require.Empty(t, rw.Header().Get(contentLengthHeader), test.acceptEncoding)
+				require.Equal(t, "text/plain; charset=utf-8", rw.Header().Get(contentTypeHeader))
+			}
+		}
+	})
+	t.Run("Responses without a body aren't compressed", func(t *testing.T) {
+		for _, status := range []int{http.StatusOK, http.StatusNoContent, http.StatusNotModified} {
+			handler := compressor.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(status)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(acceptEncodingHeader, Gzip)
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			require.Equal(t, status, rw.Code)
+			require.Empty(t, rw.Header().Get(contentEncodingHeader))
+			require.Empty(t, rw.Body.Bytes())
+		}
+	})
+	t.Run("Responses that are already encoded aren't compressed again", func(t *testing.T) {
+		handler := compressor.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(contentEncodingHeader, Gzip)
+
+			_, errWrite := w.Write(compress(t, Gzip, testBody))
+			require.NoError(t, errWrite)
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(acceptEncodingHeader, "gzip, zstd")
+
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		require.Equal(t, Gzip, rw.Header().Get(contentEncodingHeader))
+		require.Equal(t, testBody, decompress(t, Gzip, rw.Body.Bytes()))
+	})
+	t.Run("Responses to HEAD requests aren't compressed", func(t *testing.T) {
+		handler := compressor.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		req := httptest.NewRequest(http.MethodHead, "/", nil)
+		req.Header.Set(acceptEncodingHeader, Gzip)
+
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		require.Equal(t, http.StatusOK, rw.Code)
+		require.Empty(t, rw.Header().Get(contentEncodingHeader))
+	})
+	t.Run("Flushed responses are sent as they're written", func(t *testing.T) {
+		for _, encoding := range []string{Gzip, Zstd} {
+			rw := httptest.NewRecorder()
+
+			handler := compressor.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, errWrite := w.Write([]byte(testBody))
+				require.NoError(t, errWrite)
+
+				w.(http.Flusher).Flush()
+
+				// What was written so far can be decompressed before the response is finished.
+				require.True(t, rw.Flushed)
+				require.Equal(t, testBody, decompressPartial(t, encoding, rw.Body.Bytes()))
+
+				_, errWrite = w.Write([]byte(testBody))
+				require.NoError(t, errWrite)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(acceptEncodingHeader, encoding)
+
+			handler.ServeHTTP(rw, req)
+
+			require.Equal(t, testBody+testBody, decompress(t, encoding, rw.Body.Bytes()))
+		}
+	})
+}
+
+func compress(t *testing.T, encoding, data string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	w, err := newEncoder(encoding, &buf)
+	require.NoError(t, err)
+
+	_, err = w.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	return buf.Bytes()
+}
+
+func decompress(t *testing.T, encoding string, data []byte) string {
+	t.Helper()
+
+	if encoding == "" {
+		return string(data)
+	}
+
+	r, err := newDecoder(encoding, bytes.NewReader(data))
+	require.NoError(t, err)
+
+	decompressed, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+
+	return string(decompressed)
+}
+
+// decompressPartial decompresses the start of a compressed stream that hasn't been finished yet.
+func decompressPartial(t *testing.T, encoding string, data []byte) string {
+	t.Helper()
+
+	buf := make([]byte, len(testBody))
+
+	var r io.Reader
+
+	if encoding == Zstd {
+		decoder, err := zstd.NewReader(bytes.NewReader(data))
+		require.NoError(t, err)
+
+		defer decoder.Close()
+
+		r = decoder
+	} else {
+		gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+		require.NoError(t, err)
+
+		r = gzipReader
+	}
+
+	_, err := io.ReadFull(r, buf)
+	require.NoError(t, err)
+
+	return string(buf)
+}
@@ -0,0 +1,350 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+
+	"github.com/trustbloc/edv/pkg/edvutils"
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// webhooksConfigurationMember is the member of a configuration that's left out of archives. Exporting a vault only
+// needs the read action, so the secret of its webhooks mustn't be in its archive, which would let anyone who can read
+// the vault sign events for its webhooks. Vaults created by clients that sent their webhooks along with their
+// configuration have them in its extensions.
+const webhooksConfigurationMember = "webhooks"
+
+// backupCheckpointKey is the key that the checkpoint of a vault's last archive is stored under in the vault's store.
+// Document IDs are base58-encoded, so they can't collide with it.
+const backupCheckpointKey = "backup_checkpoint"
+
+// backupCheckpoint records the sequences of the documents that an archive captured, so that an incremental archive
+// can tell which documents changed since.
+type backupCheckpoint struct {
+	ID        string            `json:"id"`
+	Documents map[string]uint64 `json:"documents"`
+}
+
+// VaultArchive is an archive of a vault that's ready to be written (see models.VaultArchiveEntry).
+type VaultArchive struct {
+	store             *Store
+	configuration     *models.DataVaultConfiguration
+	since             string
+	sinceSequences    map[string]uint64
+	documentSequences map[string]uint64
+	documentIDs       []string
+	deletedIDs        []string
+}
+
+// OpenVaultArchive reads the configuration of the given vault and lists its documents, so that any failure to do
+// so is known before the archive starts being written. Only the configuration itself is archived, not the vault's
+// webhooks, their secret or its retrieval page size. messages.ErrVaultNotFound is returned if the vault doesn't
+// exist.
+func (c *Provider) OpenVaultArchive(vaultID string) (*VaultArchive, error) {
+	configStore, err := c.coreProvider.OpenStore(VaultConfigurationStoreName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store for vault configurations: %w", err)
+	}
+
+	configEntry, err := getVaultConfigurationMapping(configStore, c.encryption, vaultID)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := c.openVaultArchive(vaultID)
+	if err != nil {
+		return nil, err
+	}
+
+	archive.configuration = archivedConfiguration(&configEntry.DataVaultConfiguration)
+
+	for documentID := range archive.documentSequences {
+		archive.documentIDs = append(archive.documentIDs, documentID)
+	}
+
+	sort.Strings(archive.documentIDs)
+
+	return archive, nil
+}
+
+// OpenVaultArchiveIncrement is like OpenVaultArchive, but the archive only has the documents that were created or
+// updated since the given checkpoint, and the IDs of the ones that were deleted. Only the checkpoint of the vault's
+// last archive is kept, so messages.ErrBackupCheckpointNotFound is returned for any other.
+func (c *Provider) OpenVaultArchiveIncrement(vaultID, since string) (*VaultArchive, error) {
+	exists, err := c.StoreExists(vaultID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, messages.ErrVaultNotFound
+	}
+
+	archive, err := c.openVaultArchive(vaultID)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint, err := archive.store.backupCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	if checkpoint.ID != since {
+		return nil, fmt.Errorf("%w: the vault's last checkpoint is %s", messages.ErrBackupCheckpointNotFound,
+			checkpoint.ID)
+	}
+
+	archive.since = since
+	archive.sinceSequences = checkpoint.Documents
+
+	for documentID, sequence := range archive.documentSequences {
+		if checkpointSequence, ok := checkpoint.Documents[documentID]; !ok || checkpointSequence != sequence {
+			archive.documentIDs = append(archive.documentIDs, documentID)
+		}
+	}
+
+	for documentID := range checkpoint.Documents {
+		if _, ok := archive.documentSequences[documentID]; !ok {
+			archive.deletedIDs = append(archive.deletedIDs, documentID)
+		}
+	}
+
+	sort.Strings(archive.documentIDs)
+	sort.Strings(archive.deletedIDs)
+
+	return archive, nil
+}
+
+// archivedConfiguration returns a copy of configuration without its webhooks.
+func archivedConfiguration(configuration *models.DataVaultConfiguration) *models.DataVaultConfiguration {
+	archived := *configuration
+	archived.Extensions = models.Extensions{}
+
+	for name, value := range configuration.Extensions {
+		if name != webhooksConfigurationMember {
+			archived.Extensions[name] = value
+		}
+	}
+
+	return &archived
+}
+
+func (c *Provider) openVaultArchive(vaultID string) (*VaultArchive, error) {
+	store, err := c.OpenStore(vaultID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store for vault: %w", err)
+	}
+
+	documentSequences, err := store.DocumentSequences()
+	if err != nil {
+		return nil, err
+	}
+
+	return &VaultArchive{store: store, documentSequences: documentSequences}, nil
+}
+
+// WriteTo writes the archive to w: the vault's configuration, or the checkpoint it's an increment of, then its
+// documents sorted by ID, then the end of the archive. The documents are streamed from the database one at a time,
+// and ones deleted since the archive was opened are left out. Once the archive has been written, its checkpoint
+// replaces the vault's last one.
+func (a *VaultArchive) WriteTo(w io.Writer) (int64, error) {
+	writer := &countingWriter{writer: bufio.NewWriter(w)}
+
+	firstEntry := &models.VaultArchiveEntry{Configuration: a.configuration}
+	if a.configuration == nil {
+		firstEntry = &models.VaultArchiveEntry{Increment: &models.VaultArchiveIncrement{Since: a.since}}
+	}
+
+	err := writeVaultArchiveEntry(writer, firstEntry)
+	if err != nil {
+		return writer.written, err
+	}
+
+	var documents int
+
+	for _, documentID := range a.documentIDs {
+		written, errWrite := a.writeDocument(writer, documentID)
+		if errWrite != nil {
+			return writer.written, errWrite
+		}
+
+		if written {
+			documents++
+
+			continue
+		}
+
+		// The checkpoint has to match the archive, so the document is left out of it, and is deleted from the
+		// archive that this one is an increment of.
+		delete(a.documentSequences, documentID)
+
+		if _, ok := a.sinceSequences[documentID]; ok {
+			a.deletedIDs = append(a.deletedIDs, documentID)
+		}
+	}
+
+	for _, documentID := range a.deletedIDs {
+		err = writeVaultArchiveEntry(writer, &models.VaultArchiveEntry{Deleted: documentID})
+		if err != nil {
+			return writer.written, err
+		}
+	}
+
+	checkpointID, err := edvutils.GenerateEDVCompatibleID()
+	if err != nil {
+		return writer.written, fmt.Errorf("failed to generate checkpoint ID: %w", err)
+	}
+
+	err = writeVaultArchiveEntry(writer, &models.VaultArchiveEntry{End: &models.VaultArchiveEnd{
+		Documents: documents, Deleted: len(a.deletedIDs), Checkpoint: checkpointID,
+	}})
+	if err != nil {
+		return writer.written, err
+	}
+
+	err = writer.writer.Flush()
+	if err != nil {
+		return writer.written, err
+	}
+
+	return writer.written, a.store.storeBackupCheckpoint(&backupCheckpoint{
+		ID: checkpointID, Documents: a.documentSequences,
+	})
+}
+
+// writeDocument writes the entry for the given document, copying the document from the database as-is. Stored
+// documents are marshalled without newlines, so the entry is a single line. It returns false if the document no
+// longer exists.
+func (a *VaultArchive) writeDocument(writer *countingWriter, documentID string) (bool, error) {
+	document, err := a.store.GetStream(documentID)
+	if err != nil {
+		if errors.Is(err, storage.ErrDataNotFound) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("failed to get document %s: %w", documentID, err)
+	}
+
+	defer func() {
+		if errClose := document.Close(); errClose != nil {
+			a.store.log().Warnf("Failed to close document %s: %s", documentID, errClose)
+		}
+	}()
+
+	_, err = writer.Write([]byte(`{"document":`))
+	if err != nil {
+		return false, err
+	}
+
+	_, err = io.Copy(writer, document)
+	if err != nil {
+		return false, fmt.Errorf("failed to write document %s: %w", documentID, err)
+	}
+
+	_, err = writer.Write([]byte("}\n"))
+
+	return true, err
+}
+
+// RestoreDocuments stores documents from an incremental archive like UpsertBulk. The mapping documents of the ones
+// that are already stored are deleted first, so that none are left for attributes that they no longer have.
+// Their sequences aren't checked, since a document can have been updated more than once in between two archives.
+func (c *Store) RestoreDocuments(documents []models.EncryptedDocument) error {
+	store, err := c.beginWrite()
+	if err != nil {
+		return err
+	}
+
+	return store.restoreDocuments(documents)
+}
+
+func (c *Store) restoreDocuments(documents []models.EncryptedDocument) error {
+	for i := range documents {
+		mappingDocuments, err := c.getMappingDocuments(
+			documentIDQuery(MappingDocumentMatchingEncryptedDocIDTagName, documents[i].ID))
+		if err != nil {
+			return fmt.Errorf("failed to get mapping documents: %w", err)
+		}
+
+		for _, mappingDocument := range mappingDocuments {
+			err = c.deleteMappingDocument(mappingDocument)
+			if err != nil {
+				return fmt.Errorf(messages.DeleteMappingDocumentFailure, err)
+			}
+		}
+	}
+
+	return c.upsertBulk(documents, models.DocumentUpsertedVaultEvent, c.indexingWorkers > 0, nil, nil)
+}
+
+func (c *Store) backupCheckpoint() (*backupCheckpoint, error) {
+	checkpointBytes, err := c.coreStore.Get(backupCheckpointKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrDataNotFound) {
+			return nil, messages.ErrBackupCheckpointNotFound
+		}
+
+		return nil, fmt.Errorf("failed to get backup checkpoint: %w", err)
+	}
+
+	var checkpoint backupCheckpoint
+
+	err = json.Unmarshal(checkpointBytes, &checkpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal backup checkpoint: %w", err)
+	}
+
+	return &checkpoint, nil
+}
+
+func (c *Store) storeBackupCheckpoint(checkpoint *backupCheckpoint) error {
+	checkpointBytes, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup checkpoint: %w", err)
+	}
+
+	err = c.coreStore.Put(backupCheckpointKey, checkpointBytes)
+	if err != nil {
+		return fmt.Errorf("failed to store backup checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+func writeVaultArchiveEntry(writer io.Writer, entry *models.VaultArchiveEntry) error {
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal vault archive entry: %w", err)
+	}
+
+	_, err = writer.Write(append(entryBytes, '\n'))
+
+	return err
+}
+
+// countingWriter counts the bytes written to the writer it wraps.
+type countingWriter struct {
+	writer  *bufio.Writer
+	written int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.written += int64(n)
+
+	return n, err
+}
@@ -0,0 +1,253 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const testDocID3 = "BJYHHJx4C8J9Fsgz7rZqSp"
+
+func TestProvider_OpenVaultArchive(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+		store := createVaultWithDocuments(t, provider)
+
+		archive, err := provider.OpenVaultArchive(testVaultID)
+		require.NoError(t, err)
+
+		var buffer bytes.Buffer
+
+		written, err := archive.WriteTo(&buffer)
+		require.NoError(t, err)
+		require.Equal(t, int64(buffer.Len()), written)
+
+		entries := readVaultArchive(t, buffer.Bytes())
+		require.Len(t, entries, 4)
+		require.Equal(t, testReferenceID, entries[0].Configuration.ReferenceID)
+		require.Equal(t, 2, entries[3].End.Documents)
+		require.NotEmpty(t, entries[3].End.Checkpoint)
+
+		// The documents are sorted by ID and archived as they're stored.
+		for i, docID := range []string{testDocID2, testDocID1} {
+			storedDocument, errGet := store.Get(docID)
+			require.NoError(t, errGet)
+			require.JSONEq(t, string(storedDocument), string(entries[i+1].Document))
+		}
+	})
+	t.Run("Webhooks and their secret are left out", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+
+		err := provider.CreateVaultStore(testVaultID)
+		require.NoError(t, err)
+
+		configStore, err := provider.OpenStore(VaultConfigurationStoreName)
+		require.NoError(t, err)
+
+		err = configStore.StoreDataVaultConfiguration(&models.DataVaultConfiguration{
+			ReferenceID: testReferenceID,
+			Extensions: models.Extensions{
+				"webhooks": json.RawMessage(`{"endpoints":["https://example.com/old"],"secret":"oldSecret"}`),
+				"other":    json.RawMessage(`"value"`),
+			},
+		}, testVaultID)
+		require.NoError(t, err)
+
+		err = provider.UpdateVaultWebhooks(testVaultID, &models.VaultWebhooks{
+			Endpoints: []string{"https://example.com/webhook"}, Secret: "secret",
+		})
+		require.NoError(t, err)
+
+		archive, err := provider.OpenVaultArchive(testVaultID)
+		require.NoError(t, err)
+
+		var buffer bytes.Buffer
+
+		_, err = archive.WriteTo(&buffer)
+		require.NoError(t, err)
+		require.NotContains(t, buffer.String(), "webhook")
+		require.NotContains(t, buffer.String(), "ecret")
+
+		entries := readVaultArchive(t, buffer.Bytes())
+		require.Equal(t, models.Extensions{"other": json.RawMessage(`"value"`)}, entries[0].Configuration.Extensions)
+	})
+	t.Run("Documents deleted after the archive was opened are left out", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+		store := createVaultWithDocuments(t, provider)
+
+		archive, err := provider.OpenVaultArchive(testVaultID)
+		require.NoError(t, err)
+
+		require.NoError(t, store.Delete(testDocID1))
+
+		var buffer bytes.Buffer
+
+		_, err = archive.WriteTo(&buffer)
+		require.NoError(t, err)
+
+		entries := readVaultArchive(t, buffer.Bytes())
+		require.Len(t, entries, 3)
+		require.Equal(t, 1, entries[2].End.Documents)
+
+		// The document isn't in the checkpoint either, so it isn't deleted by the next increment.
+		increment := writeVaultArchiveIncrement(t, provider, entries[2].End.Checkpoint)
+		require.Len(t, increment, 2)
+		require.Equal(t, 0, increment[1].End.Deleted)
+	})
+	t.Run("Vault not found", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+
+		_, err := provider.OpenVaultArchive(testVaultID)
+		require.True(t, errors.Is(err, messages.ErrVaultNotFound))
+
+		_, err = provider.OpenVaultArchiveIncrement(testVaultID, "checkpoint")
+		require.True(t, errors.Is(err, messages.ErrVaultNotFound))
+	})
+	t.Run("Fail to open config store", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{ErrOpenStore: errors.New("open store error")}, 100)
+
+		_, err := provider.OpenVaultArchive(testVaultID)
+		require.EqualError(t, err, "failed to open store for vault configurations: open store error")
+	})
+	t.Run("Fail to get document", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+		store := createVaultWithDocuments(t, provider)
+
+		archive, err := provider.OpenVaultArchive(testVaultID)
+		require.NoError(t, err)
+
+		archive.store = &Store{coreStore: &mock.Store{ErrGet: errors.New("get error")}, name: store.name}
+
+		_, err = archive.WriteTo(&bytes.Buffer{})
+		require.EqualError(t, err, "failed to get document "+testDocID2+": get error")
+	})
+}
+
+func TestProvider_OpenVaultArchiveIncrement(t *testing.T) {
+	t.Run("Increments have the documents that changed since the last checkpoint", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+		store := createVaultWithDocuments(t, provider)
+
+		_, err := provider.OpenVaultArchiveIncrement(testVaultID, "checkpoint")
+		require.True(t, errors.Is(err, messages.ErrBackupCheckpointNotFound))
+
+		archive, err := provider.OpenVaultArchive(testVaultID)
+		require.NoError(t, err)
+
+		var buffer bytes.Buffer
+
+		_, err = archive.WriteTo(&buffer)
+		require.NoError(t, err)
+
+		entries := readVaultArchive(t, buffer.Bytes())
+		checkpoint := entries[len(entries)-1].End.Checkpoint
+
+		// Nothing has changed yet.
+		increment := writeVaultArchiveIncrement(t, provider, checkpoint)
+		require.Equal(t, []models.VaultArchiveEntry{
+			{Increment: &models.VaultArchiveIncrement{Since: checkpoint}},
+			{End: &models.VaultArchiveEnd{Checkpoint: increment[1].End.Checkpoint}},
+		}, increment)
+
+		// Only the last checkpoint is kept.
+		_, err = provider.OpenVaultArchiveIncrement(testVaultID, checkpoint)
+		require.True(t, errors.Is(err, messages.ErrBackupCheckpointNotFound))
+
+		checkpoint = increment[1].End.Checkpoint
+
+		updatedDocument := buildEncryptedDoc(testDocID1, models.IndexedAttributeCollection{})
+		updatedDocument.Sequence = 1
+
+		require.NoError(t, store.UpsertBulk(createTestDocuments(t, testDocID3)))
+		require.NoError(t, store.UpsertBulk([]models.EncryptedDocument{updatedDocument}))
+		require.NoError(t, store.Delete(testDocID2))
+
+		increment = writeVaultArchiveIncrement(t, provider, checkpoint)
+		require.Len(t, increment, 5)
+		require.Equal(t, checkpoint, increment[0].Increment.Since)
+		require.Equal(t, testDocID2, increment[3].Deleted)
+		require.Equal(t, 2, increment[4].End.Documents)
+		require.Equal(t, 1, increment[4].End.Deleted)
+
+		for i, docID := range []string{testDocID3, testDocID1} {
+			storedDocument, errGet := store.Get(docID)
+			require.NoError(t, errGet)
+			require.JSONEq(t, string(storedDocument), string(increment[i+1].Document))
+		}
+	})
+	t.Run("Fail to get checkpoint", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+		store := createVaultWithDocuments(t, provider)
+
+		require.NoError(t, store.coreStore.Put(backupCheckpointKey, []byte("{")))
+
+		_, err := provider.OpenVaultArchiveIncrement(testVaultID, "checkpoint")
+		require.EqualError(t, err, "failed to unmarshal backup checkpoint: unexpected end of JSON input")
+	})
+}
+
+func TestStore_RestoreDocuments(t *testing.T) {
+	provider := NewProvider(mem.NewProvider(), 100)
+	store := createVaultWithDocuments(t, provider)
+
+	restoredDocument := buildEncryptedDoc(testDocID1, models.IndexedAttributeCollection{
+		IndexedAttributes: []models.IndexedAttribute{{Name: testIndexName3, Value: "value"}},
+	})
+
+	require.NoError(t, store.RestoreDocuments([]models.EncryptedDocument{restoredDocument}))
+
+	// The mapping document for the attribute that the document no longer has was deleted.
+	mappingDocuments, err := store.getMappingDocuments(
+		documentIDQuery(MappingDocumentMatchingEncryptedDocIDTagName, testDocID1))
+	require.NoError(t, err)
+	require.Len(t, mappingDocuments, 1)
+	require.Equal(t, testIndexName3, mappingDocuments[0].AttributeName)
+}
+
+func writeVaultArchiveIncrement(t *testing.T, provider *Provider, since string) []models.VaultArchiveEntry {
+	t.Helper()
+
+	archive, err := provider.OpenVaultArchiveIncrement(testVaultID, since)
+	require.NoError(t, err)
+
+	var buffer bytes.Buffer
+
+	_, err = archive.WriteTo(&buffer)
+	require.NoError(t, err)
+
+	return readVaultArchive(t, buffer.Bytes())
+}
+
+func readVaultArchive(t *testing.T, archive []byte) []models.VaultArchiveEntry {
+	t.Helper()
+
+	var entries []models.VaultArchiveEntry
+
+	scanner := bufio.NewScanner(bytes.NewReader(archive))
+	for scanner.Scan() {
+		var entry models.VaultArchiveEntry
+
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+
+		entries = append(entries, entry)
+	}
+
+	require.NoError(t, scanner.Err())
+
+	return entries
+}
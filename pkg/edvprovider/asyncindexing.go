@@ -0,0 +1,332 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// IndexingQueueTagName is the tag name used for the indexing queue entries of a vault, which hold the IDs of the
+// documents whose mapping documents haven't been created yet (see WithAsyncIndexing). The tag value is the
+// document's ID.
+const IndexingQueueTagName = "IndexingQueue"
+
+const indexingQueueKeyPrefix = "indexing_"
+
+// WithAsyncIndexing enables asynchronous indexing, which trades query freshness for write throughput during bulk
+// ingests. UpsertBulk then only stores the documents, along with an indexing queue entry for each of them, and their
+// mapping documents are created afterwards by ProcessIndexingQueues, with up to workers documents indexed at a time.
+// Until then, queries may not find the documents by their new encrypted indices (see Store.IndexingStatus).
+// The queue is stored in the vault, so documents upserted before the EDV server stopped are indexed once it's
+// restarted. Documents stored through Put and Update are still indexed before they return.
+func WithAsyncIndexing(workers uint) Option {
+	return func(p *Provider) {
+		p.indexingWorkers = workers
+	}
+}
+
+// AsyncIndexingEnabled returns whether asynchronous indexing is enabled, in which case the mapping documents of
+// documents stored through UpsertBulk are created by ProcessIndexingQueues.
+func (c *Provider) AsyncIndexingEnabled() bool {
+	return c.indexingWorkers > 0
+}
+
+// ProcessIndexingQueues creates the mapping documents of the documents in the indexing queue of every vault, and
+// removes them from the queue. It returns the number of documents indexed. A document that fails to be indexed is
+// left in the queue for the next call. Vaults whose queue fails to be processed are logged and skipped, and their
+// errors are returned together once the other vaults are done. It does nothing if asynchronous indexing isn't
+// enabled.
+func (c *Provider) ProcessIndexingQueues() (int, error) {
+	if c.indexingWorkers == 0 {
+		return 0, nil
+	}
+
+	err := c.background.begin()
+	if err != nil {
+		return 0, err
+	}
+
+	defer c.background.end()
+
+	configStore, err := c.coreProvider.OpenStore(VaultConfigurationStoreName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open store for vault configurations: %w", err)
+	}
+
+	vaultIDs, err := entryKeys(configStore, VaultConfigReferenceIDTagName, c.retrievalPageSize, c.log())
+	if err != nil {
+		return 0, fmt.Errorf("failed to get vaults: %w", err)
+	}
+
+	var (
+		indexed  int
+		failures joinedError
+	)
+
+	// A vault whose queue can't be processed, for example because of an entry that can't be read, mustn't hold up
+	// the indexing of the others.
+	for _, vaultID := range vaultIDs {
+		count, errProcess := c.processVaultIndexingQueue(vaultID)
+		indexed += count
+
+		if errProcess != nil {
+			c.log().Warnf("Failed to index queued documents: %s", errProcess)
+
+			failures = append(failures, errProcess)
+		}
+	}
+
+	if len(failures) > 0 {
+		return indexed, failures
+	}
+
+	return indexed, nil
+}
+
+func (c *Provider) processVaultIndexingQueue(vaultID string) (int, error) {
+	store, err := c.OpenStore(vaultID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open store for vault %s: %w", vaultID, err)
+	}
+
+	indexed, err := store.processIndexingQueue(c.indexingWorkers)
+	if err != nil {
+		return indexed, fmt.Errorf("failed to process indexing queue of vault %s: %w", vaultID, err)
+	}
+
+	return indexed, nil
+}
+
+// joinedError is the error of a task that carried on past more than one failure. errors.Is and errors.As match any
+// of its errors.
+type joinedError []error
+
+func (e joinedError) Error() string {
+	messages := make([]string, len(e))
+
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+func (e joinedError) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e joinedError) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IndexingStatus returns the number of documents in the vault whose mapping documents are yet to be created by
+// asynchronous indexing. Queries are consistent with the documents once there are none.
+func (c *Store) IndexingStatus() (*models.IndexingStatus, error) {
+	queue, err := c.indexingQueue()
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.IndexingStatus{
+		PendingDocuments: len(queue.documentIDs),
+		Consistent:       len(queue.documentIDs) == 0,
+	}, nil
+}
+
+type indexingQueueEntry struct {
+	DocumentID string `json:"documentID"`
+}
+
+// indexingQueue holds the IDs of the documents in a vault's indexing queue, in the order in which they were found,
+// and the keys of each document's entries.
+type indexingQueue struct {
+	documentIDs []string
+	keys        map[string][]string
+}
+
+// indexingQueueOperations returns the operation that queues the given document for indexing if indexing is deferred.
+// Each write gets its own entry, so that a document written again while it's being indexed stays in the queue.
+func indexingQueueOperations(documentID string, deferIndexing bool) ([]storage.Operation, error) {
+	if !deferIndexing {
+		return nil, nil
+	}
+
+	entryBytes, err := json.Marshal(indexingQueueEntry{DocumentID: documentID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal indexing queue entry for document %s: %w", documentID, err)
+	}
+
+	return []storage.Operation{{
+		Key:   indexingQueueKeyPrefix + uuid.New().String(),
+		Value: entryBytes,
+		Tags:  []storage.Tag{documentIDTag(IndexingQueueTagName, documentID)},
+	}}, nil
+}
+
+// processIndexingQueue indexes the documents in the store's indexing queue with the given number of workers, and
+// returns the number of documents indexed. If any documents fail to be indexed, then the first error is returned
+// once the others are done.
+func (c *Store) processIndexingQueue(workers uint) (int, error) {
+	queue, err := c.indexingQueue()
+	if err != nil {
+		return 0, err
+	}
+
+	documentIDs := make(chan string)
+
+	var (
+		wait     sync.WaitGroup
+		mutex    sync.Mutex
+		indexed  int
+		firstErr error
+	)
+
+	for i := uint(0); i < workers; i++ {
+		wait.Add(1)
+
+		go func() {
+			defer wait.Done()
+
+			for documentID := range documentIDs {
+				errIndex := c.indexDocument(documentID, queue.keys[documentID])
+
+				mutex.Lock()
+
+				if errIndex == nil {
+					indexed++
+				} else if firstErr == nil {
+					firstErr = errIndex
+				}
+
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for _, documentID := range queue.documentIDs {
+		documentIDs <- documentID
+	}
+
+	close(documentIDs)
+	wait.Wait()
+
+	if indexed > 0 {
+		c.log().Debugf("Indexed %d documents in vault %s", indexed, c.name)
+	}
+
+	return indexed, firstErr
+}
+
+// indexDocument brings the mapping documents of the given document in line with its current encrypted indices, and
+// then deletes the given indexing queue entries. It holds the document's lock, so that it doesn't race with updates
+// and deletions of the document. A document that has been deleted since it was queued only has its entries deleted.
+func (c *Store) indexDocument(documentID string, keys []string) error {
+	locks := c.documentLocks.lockAll(c.namespace.Key(documentID))
+	defer locks.unlock()
+
+	documentBytes, err := c.coreStore.Get(documentID)
+	if err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+		return fmt.Errorf("failed to get document %s: %w", documentID, err)
+	}
+
+	if err == nil {
+		var document models.EncryptedDocument
+
+		err = json.Unmarshal(documentBytes, &document)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal document %s: %w", documentID, err)
+		}
+
+		err = c.updateMappingDocuments(documentID, document.IndexedAttributeCollections)
+		if err != nil {
+			return fmt.Errorf("failed to index document %s: %w", documentID, err)
+		}
+	}
+
+	operations := make([]storage.Operation, len(keys))
+
+	for i, key := range keys {
+		operations[i] = storage.Operation{Key: key}
+	}
+
+	_, err = c.batch(locks, operations)
+	if err != nil {
+		return fmt.Errorf("failed to delete indexing queue entries of document %s: %w", documentID, err)
+	}
+
+	return nil
+}
+
+// indexingQueue returns the documents in the store's indexing queue.
+func (c *Store) indexingQueue() (*indexingQueue, error) {
+	itr, err := c.coreStore.Query(IndexingQueueTagName, storage.WithPageSize(int(c.retrievalPageSize)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query indexing queue: %w", err)
+	}
+
+	defer storage.Close(itr, c.log())
+
+	queue := &indexingQueue{keys: make(map[string][]string)}
+
+	moreEntries, err := itr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next entry from iterator: %w", err)
+	}
+
+	for moreEntries {
+		key, errKey := itr.Key()
+		if errKey != nil {
+			return nil, fmt.Errorf("failed to get key from iterator: %w", errKey)
+		}
+
+		value, errValue := itr.Value()
+		if errValue != nil {
+			return nil, fmt.Errorf("failed to get value from iterator: %w", errValue)
+		}
+
+		var entry indexingQueueEntry
+
+		err = json.Unmarshal(value, &entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal indexing queue entry %s: %w", key, err)
+		}
+
+		if _, queued := queue.keys[entry.DocumentID]; !queued {
+			queue.documentIDs = append(queue.documentIDs, entry.DocumentID)
+		}
+
+		queue.keys[entry.DocumentID] = append(queue.keys[entry.DocumentID], key)
+
+		moreEntries, err = itr.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get next entry from iterator: %w", err)
+		}
+	}
+
+	return queue, nil
+}
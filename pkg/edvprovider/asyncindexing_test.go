@@ -0,0 +1,204 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestProvider_ProcessIndexingQueues(t *testing.T) {
+	t.Run("Upserted documents are indexed once their queue is processed", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100, WithAsyncIndexing(2))
+		require.True(t, provider.AsyncIndexingEnabled())
+
+		store := createVaultWithDocuments(t, provider)
+		requireIndexingStatus(t, store, 0)
+
+		documents := createTestDocuments(t, testDocID1, testDocID2, testDocID3)
+		documents[0].Sequence = 1
+		documents[1].Sequence = 1
+		require.NoError(t, store.UpsertBulk(documents))
+
+		// The documents are stored, but can't be found by their encrypted indices yet.
+		exists, err := store.Exists(testDocID3)
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		requireIndexingStatus(t, store, 3)
+		requireQueryResults(t, store, testDocID3, 0)
+
+		indexed, err := provider.ProcessIndexingQueues()
+		require.NoError(t, err)
+		require.Equal(t, 3, indexed)
+
+		requireIndexingStatus(t, store, 0)
+		requireQueryResults(t, store, testDocID3, 1)
+
+		// Documents that were indexed before being upserted have their old mapping documents removed.
+		docs, err := store.Query(&models.Query{Has: testIndexName2})
+		require.NoError(t, err)
+		require.Empty(t, docs)
+
+		indexed, err = provider.ProcessIndexingQueues()
+		require.NoError(t, err)
+		require.Zero(t, indexed)
+	})
+	t.Run("A document upserted more than once is indexed once", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100, WithAsyncIndexing(1))
+		store := createVaultWithDocuments(t, provider)
+
+		documents := createTestDocuments(t, testDocID3)
+		require.NoError(t, store.UpsertBulk(documents))
+
+		documents[0].Sequence = 1
+		require.NoError(t, store.UpsertBulk(documents))
+
+		requireIndexingStatus(t, store, 1)
+
+		indexed, err := provider.ProcessIndexingQueues()
+		require.NoError(t, err)
+		require.Equal(t, 1, indexed)
+
+		requireQueryResults(t, store, testDocID3, 1)
+	})
+	t.Run("Documents deleted before being indexed are removed from the queue", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100, WithAsyncIndexing(1))
+		store := createVaultWithDocuments(t, provider)
+
+		require.NoError(t, store.UpsertBulk(createTestDocuments(t, testDocID3)))
+		require.NoError(t, store.Delete(testDocID3))
+
+		indexed, err := provider.ProcessIndexingQueues()
+		require.NoError(t, err)
+		require.Equal(t, 1, indexed)
+
+		requireIndexingStatus(t, store, 0)
+		requireQueryResults(t, store, testDocID3, 0)
+	})
+	t.Run("Put is still indexed synchronously", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100, WithAsyncIndexing(1))
+		store := createVaultWithDocuments(t, provider)
+
+		requireIndexingStatus(t, store, 0)
+
+		docs, err := store.Query(&models.Query{Has: testIndexName2})
+		require.NoError(t, err)
+		require.Len(t, docs, 2)
+	})
+	t.Run("Documents that fail to be indexed are kept for the next call", func(t *testing.T) {
+		coreProvider := &newKeyProvider{Provider: mem.NewProvider()}
+
+		provider := NewProvider(coreProvider, 100, WithAsyncIndexing(1))
+		store := createVaultWithDocuments(t, provider)
+
+		require.NoError(t, store.UpsertBulk(createTestDocuments(t, testDocID3)))
+
+		coreProvider.errBatch = errors.New("write failure")
+
+		indexed, err := provider.ProcessIndexingQueues()
+		require.EqualError(t, err, "failed to process indexing queue of vault "+testVaultID+": failed to delete "+
+			"indexing queue entries of document "+testDocID3+": write failure")
+		require.Zero(t, indexed)
+
+		coreProvider.errBatch = nil
+
+		requireIndexingStatus(t, store, 1)
+
+		indexed, err = provider.ProcessIndexingQueues()
+		require.NoError(t, err)
+		require.Equal(t, 1, indexed)
+	})
+	t.Run("A vault whose queue fails to be processed doesn't hold up the others", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100, WithAsyncIndexing(1))
+		poisonedStore := createVaultWithDocuments(t, provider)
+
+		require.NoError(t, poisonedStore.UpsertBulk(createTestDocuments(t, testDocID3)))
+		require.NoError(t, poisonedStore.coreStore.Put(indexingQueueKeyPrefix+"poisoned", []byte("{"),
+			storage.Tag{Name: IndexingQueueTagName}))
+
+		const otherVaultID = "otherVaultID"
+
+		require.NoError(t, provider.CreateVaultStore(otherVaultID))
+
+		configStore, err := provider.OpenStore(VaultConfigurationStoreName)
+		require.NoError(t, err)
+		require.NoError(t, configStore.StoreDataVaultConfiguration(
+			&models.DataVaultConfiguration{ReferenceID: "otherReferenceID"}, otherVaultID))
+
+		otherStore, err := provider.OpenStore(otherVaultID)
+		require.NoError(t, err)
+		require.NoError(t, otherStore.UpsertBulk(createTestDocuments(t, testDocID1, testDocID3)))
+
+		indexed, err := provider.ProcessIndexingQueues()
+		require.EqualError(t, err, "failed to process indexing queue of vault "+testVaultID+": failed to "+
+			"unmarshal indexing queue entry "+indexingQueueKeyPrefix+"poisoned: unexpected end of JSON input")
+		require.Equal(t, 2, indexed)
+
+		requireIndexingStatus(t, otherStore, 0)
+		requireQueryResults(t, otherStore, testDocID3, 1)
+	})
+	t.Run("Errors of every vault are returned", func(t *testing.T) {
+		err := joinedError{errors.New("first failure"), fmt.Errorf("second failure: %w", storage.ErrDataNotFound)}
+		require.EqualError(t, err, "first failure; second failure: data not found")
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+
+		var joined joinedError
+
+		require.True(t, errors.As(fmt.Errorf("wrapped: %w", err), &joined))
+		require.Len(t, joined, 2)
+	})
+	t.Run("Deleting the vault deletes its indexing queue", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100, WithAsyncIndexing(1))
+		store := createVaultWithDocuments(t, provider)
+
+		require.NoError(t, store.UpsertBulk(createTestDocuments(t, testDocID3)))
+		require.NoError(t, store.deleteAll())
+
+		requireIndexingStatus(t, store, 0)
+	})
+	t.Run("Nothing is done if asynchronous indexing isn't enabled", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+		require.False(t, provider.AsyncIndexingEnabled())
+
+		store := createVaultWithDocuments(t, provider)
+
+		require.NoError(t, store.UpsertBulk(createTestDocuments(t, testDocID3)))
+		requireIndexingStatus(t, store, 0)
+		requireQueryResults(t, store, testDocID3, 1)
+
+		indexed, err := provider.ProcessIndexingQueues()
+		require.NoError(t, err)
+		require.Zero(t, indexed)
+	})
+}
+
+func requireIndexingStatus(t *testing.T, store *Store, pendingDocuments int) {
+	t.Helper()
+
+	status, err := store.IndexingStatus()
+	require.NoError(t, err)
+	require.Equal(t, pendingDocuments, status.PendingDocuments)
+	require.Equal(t, pendingDocuments == 0, status.Consistent)
+}
+
+// requireQueryResults requires the given number of documents to be found by the attribute value that
+// createTestDocuments gives the document with the given ID.
+func requireQueryResults(t *testing.T, store *Store, documentID string, results int) {
+	t.Helper()
+
+	docs, err := store.Query(&models.Query{Name: testAttributeName, Value: documentID})
+	require.NoError(t, err)
+	require.Len(t, docs, results)
+}
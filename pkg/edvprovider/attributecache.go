@@ -0,0 +1,238 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"fmt"
+	"sync"
+)
+
+// attributeLockPrefix is prepended to attribute names to get the keys of their locks in documentLocks. Document IDs
+// are base58-encoded, so they never contain the separator.
+const attributeLockPrefix = "attribute/"
+
+// AttributeCache caches the IDs of the documents that have each indexed attribute name, so that queries and the
+// uniqueness validation done for every new document don't have to scan the mapping documents in the underlying
+// store every time. Keys come from VaultNamespace.Key. Implementations must be safe for concurrent use.
+//
+// The cache is kept up to date by the writes done through Stores opened from the same Provider, using locks that are
+// local to this process. Writes done by other EDV instances sharing the database aren't seen, so a cache that's
+// shared between instances (for example one backed by Redis) must be used by all of them, and can still briefly
+// miss a write made by another instance while it's caching an attribute.
+type AttributeCache interface {
+	// Get returns the IDs of the documents with the given attribute, or false if the attribute isn't cached.
+	Get(key string) ([]string, bool)
+	// Set caches the IDs of every document with the given attribute.
+	Set(key string, documentIDs []string)
+	// Add adds a document ID to the IDs cached for the given attribute. It does nothing if the attribute isn't cached.
+	Add(key, documentID string)
+	// Remove removes a document ID from the IDs cached for the given attribute.
+	Remove(key, documentID string)
+	// Invalidate removes the given attribute from the cache.
+	Invalidate(key string)
+	// Purge removes every attribute of the given vault from the cache.
+	Purge(namespace VaultNamespace)
+}
+
+// WithAttributeCache makes queries and uniqueness validation look up the documents with an attribute in the given
+// cache, only querying the underlying store when the attribute isn't cached. Queries that continue a partial query
+// or have a deadline always scan the underlying store.
+func WithAttributeCache(cache AttributeCache) Option {
+	return func(p *Provider) {
+		p.attributeCache = cache
+	}
+}
+
+// attributeDocumentIDs returns the IDs of the documents with the given attribute name from the attribute cache,
+// getting them from the mapping documents in the underlying store and caching them if they aren't cached yet.
+// The attribute is locked while doing so, so that a write that happens at the same time can't be missed.
+func (c *Store) attributeDocumentIDs(attributeName string) ([]string, error) {
+	key := c.namespace.Key(attributeName)
+
+	unlock := c.documentLocks.lock(c.namespace.Key(attributeLockPrefix + attributeName))
+	defer unlock()
+
+	documentIDs, cached := c.attributeCache.Get(key)
+	if cached {
+		return documentIDs, nil
+	}
+
+	mappingDocuments, err := c.getMappingDocuments(fmt.Sprintf("%s:%s", MappingDocumentTagName, attributeName))
+	if err != nil {
+		return nil, err
+	}
+
+	documentIDs = getDocumentIDsFromMappingDocumentsWithoutDuplicates(mappingDocuments)
+
+	c.attributeCache.Set(key, documentIDs)
+
+	return documentIDs, nil
+}
+
+// cacheMappingDocuments adds the documents of the given stored mapping documents to the attribute cache.
+func (c *Store) cacheMappingDocuments(mappingDocuments []indexMappingDocument) {
+	if c.attributeCache == nil {
+		return
+	}
+
+	for _, mappingDocument := range mappingDocuments {
+		c.updateAttributeCache(mappingDocument.AttributeName, func(key string) {
+			c.attributeCache.Add(key, mappingDocument.MatchingEncryptedDocID)
+		})
+	}
+}
+
+// uncacheMappingDocument removes the document of the given deleted mapping document from the attribute cache.
+// Only call this once the document has no mapping documents left for the attribute.
+func (c *Store) uncacheMappingDocument(mappingDocument indexMappingDocument) {
+	if c.attributeCache == nil {
+		return
+	}
+
+	c.updateAttributeCache(mappingDocument.AttributeName, func(key string) {
+		c.attributeCache.Remove(key, mappingDocument.MatchingEncryptedDocID)
+	})
+}
+
+// invalidateMappingDocuments removes the attributes of the given mapping documents from the attribute cache.
+// It's used when it's not known which of the mapping documents were written.
+func (c *Store) invalidateMappingDocuments(mappingDocuments []indexMappingDocument) {
+	if c.attributeCache == nil {
+		return
+	}
+
+	for _, mappingDocument := range mappingDocuments {
+		c.updateAttributeCache(mappingDocument.AttributeName, c.attributeCache.Invalidate)
+	}
+}
+
+func (c *Store) updateAttributeCache(attributeName string, update func(key string)) {
+	unlock := c.documentLocks.lock(c.namespace.Key(attributeLockPrefix + attributeName))
+	defer unlock()
+
+	update(c.namespace.Key(attributeName))
+}
+
+// MemAttributeCache is an in-memory AttributeCache. Once it holds the maximum number of attributes, the least
+// recently used attribute is removed to make room for a new one.
+type MemAttributeCache struct {
+	mutex         sync.Mutex
+	maxAttributes int
+	attributes    map[string]*memAttributeCacheEntry
+	uses          uint64
+}
+
+type memAttributeCacheEntry struct {
+	documentIDs map[string]struct{}
+	lastUsed    uint64
+}
+
+// NewMemAttributeCache returns a new MemAttributeCache holding up to maxAttributes attributes.
+// If maxAttributes is 0, then the number of attributes isn't limited.
+func NewMemAttributeCache(maxAttributes int) *MemAttributeCache {
+	return &MemAttributeCache{maxAttributes: maxAttributes, attributes: make(map[string]*memAttributeCacheEntry)}
+}
+
+// Get returns the IDs of the documents with the given attribute, or false if the attribute isn't cached.
+func (m *MemAttributeCache) Get(key string) ([]string, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	entry, cached := m.attributes[key]
+	if !cached {
+		return nil, false
+	}
+
+	m.uses++
+	entry.lastUsed = m.uses
+
+	documentIDs := make([]string, 0, len(entry.documentIDs))
+
+	for documentID := range entry.documentIDs {
+		documentIDs = append(documentIDs, documentID)
+	}
+
+	return documentIDs, true
+}
+
+// Set caches the IDs of every document with the given attribute.
+func (m *MemAttributeCache) Set(key string, documentIDs []string) {
+	entry := &memAttributeCacheEntry{documentIDs: make(map[string]struct{}, len(documentIDs))}
+
+	for _, documentID := range documentIDs {
+		entry.documentIDs[documentID] = struct{}{}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.uses++
+	entry.lastUsed = m.uses
+
+	if _, cached := m.attributes[key]; !cached && m.maxAttributes > 0 && len(m.attributes) >= m.maxAttributes {
+		m.removeLeastRecentlyUsed()
+	}
+
+	m.attributes[key] = entry
+}
+
+// removeLeastRecentlyUsed removes the attribute that was used the longest time ago. Attributes are only set after
+// scanning the underlying store, so going through every attribute here costs little in comparison.
+func (m *MemAttributeCache) removeLeastRecentlyUsed() {
+	var (
+		oldestKey      string
+		oldestLastUsed uint64
+	)
+
+	for key, entry := range m.attributes {
+		if oldestKey == "" || entry.lastUsed < oldestLastUsed {
+			oldestKey, oldestLastUsed = key, entry.lastUsed
+		}
+	}
+
+	delete(m.attributes, oldestKey)
+}
+
+// Add adds a document ID to the IDs cached for the given attribute. It does nothing if the attribute isn't cached.
+func (m *MemAttributeCache) Add(key, documentID string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if entry, cached := m.attributes[key]; cached {
+		entry.documentIDs[documentID] = struct{}{}
+	}
+}
+
+// Remove removes a document ID from the IDs cached for the given attribute.
+func (m *MemAttributeCache) Remove(key, documentID string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if entry, cached := m.attributes[key]; cached {
+		delete(entry.documentIDs, documentID)
+	}
+}
+
+// Invalidate removes the given attribute from the cache.
+func (m *MemAttributeCache) Invalidate(key string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.attributes, key)
+}
+
+// Purge removes every attribute of the given vault from the cache.
+func (m *MemAttributeCache) Purge(namespace VaultNamespace) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for key := range m.attributes {
+		if namespace.Owns(key) {
+			delete(m.attributes, key)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const (
+	testAttributeName  = "CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ"
+	testAttributeName2 = "DUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ"
+)
+
+func TestMemAttributeCache(t *testing.T) {
+	t.Run("Add and remove only change cached attributes", func(t *testing.T) {
+		cache := NewMemAttributeCache(0)
+
+		cache.Add("key", testDocID1)
+
+		_, cached := cache.Get("key")
+		require.False(t, cached)
+
+		cache.Set("key", []string{testDocID1})
+		cache.Add("key", testDocID2)
+		cache.Remove("key", testDocID1)
+
+		documentIDs, cached := cache.Get("key")
+		require.True(t, cached)
+		require.Equal(t, []string{testDocID2}, documentIDs)
+
+		cache.Invalidate("key")
+
+		_, cached = cache.Get("key")
+		require.False(t, cached)
+	})
+	t.Run("The least recently used attribute is removed when full", func(t *testing.T) {
+		cache := NewMemAttributeCache(2)
+
+		cache.Set("key1", nil)
+		cache.Set("key2", nil)
+
+		_, cached := cache.Get("key1")
+		require.True(t, cached)
+
+		cache.Set("key3", nil)
+
+		_, cached = cache.Get("key2")
+		require.False(t, cached)
+
+		_, cached = cache.Get("key1")
+		require.True(t, cached)
+
+		_, cached = cache.Get("key3")
+		require.True(t, cached)
+	})
+	t.Run("Purge removes only the given vault's attributes", func(t *testing.T) {
+		cache := NewMemAttributeCache(0)
+
+		namespace, otherNamespace := newVaultNamespace(testVaultID), newVaultNamespace("otherVault")
+
+		cache.Set(namespace.Key(testAttributeName), []string{testDocID1})
+		cache.Set(otherNamespace.Key(testAttributeName), []string{testDocID1})
+
+		cache.Purge(namespace)
+
+		_, cached := cache.Get(namespace.Key(testAttributeName))
+		require.False(t, cached)
+
+		_, cached = cache.Get(otherNamespace.Key(testAttributeName))
+		require.True(t, cached)
+	})
+}
+
+func TestStore_AttributeCache(t *testing.T) {
+	t.Run("Writes and deletes keep the cache up to date", func(t *testing.T) {
+		cache := NewMemAttributeCache(0)
+		store := newAttributeCacheTestStore(t, cache)
+
+		documents := createTestDocuments(t, testDocID1, testDocID2)
+
+		require.NoError(t, store.Put(documents[0]))
+
+		// The uniqueness validation of the first document cached the attribute while it had no documents.
+		requireCachedDocuments(t, cache, store, testAttributeName, testDocID1)
+
+		require.NoError(t, store.Put(documents[1]))
+		requireCachedDocuments(t, cache, store, testAttributeName, testDocID1, testDocID2)
+
+		requireQueryMatches(t, store, &models.Query{Has: testAttributeName}, testDocID1, testDocID2)
+
+		documents[0].Sequence = 1
+		documents[0].IndexedAttributeCollections[0].IndexedAttributes =
+			documents[0].IndexedAttributeCollections[0].IndexedAttributes[1:]
+		require.NoError(t, store.Update(documents[0]))
+		requireCachedDocuments(t, cache, store, testAttributeName, testDocID2)
+
+		requireQueryMatches(t, store, &models.Query{Has: testAttributeName}, testDocID2)
+
+		require.NoError(t, store.Delete(testDocID2))
+		requireCachedDocuments(t, cache, store, testAttributeName)
+
+		requireQueryMatches(t, store, &models.Query{Has: testAttributeName})
+	})
+	t.Run("Unique attributes are still enforced", func(t *testing.T) {
+		store := newAttributeCacheTestStore(t, NewMemAttributeCache(0))
+
+		documents := createTestDocuments(t, testDocID1, testDocID2)
+		documents[1].IndexedAttributeCollections = documents[0].IndexedAttributeCollections
+
+		require.NoError(t, store.Put(documents[0]))
+		require.ErrorIs(t, store.Put(documents[1]), errIndexNameAndValueAlreadyDeclaredUnique)
+	})
+	t.Run("Documents deleted without the cache knowing are skipped", func(t *testing.T) {
+		cache := NewMemAttributeCache(0)
+		store := newAttributeCacheTestStore(t, cache)
+
+		require.NoError(t, store.Put(createTestDocuments(t, testDocID1)[0]))
+
+		// Cache a document that doesn't exist.
+		cache.Set(store.namespace.Key(testAttributeName2), []string{testDocID1, testDocID2})
+		requireQueryMatches(t, store, &models.Query{Has: testAttributeName2}, testDocID1)
+
+		_, cached := cache.Get(store.namespace.Key(testAttributeName2))
+		require.False(t, cached)
+	})
+	t.Run("Deleting the vault purges its attributes", func(t *testing.T) {
+		cache := NewMemAttributeCache(0)
+		provider := NewProvider(mem.NewProvider(), 100, WithAttributeCache(cache))
+
+		store := createVaultWithDocuments(t, provider)
+
+		requireQueryMatches(t, store, &models.Query{Has: testIndexName2}, testDocID1, testDocID2)
+		requireCachedDocuments(t, cache, store, testIndexName2, testDocID1, testDocID2)
+
+		require.NoError(t, provider.DeleteStore(testVaultID))
+
+		_, cached := cache.Get(store.namespace.Key(testIndexName2))
+		require.False(t, cached)
+	})
+}
+
+func newAttributeCacheTestStore(t *testing.T, cache AttributeCache) *Store {
+	t.Helper()
+
+	store, err := NewProvider(mem.NewProvider(), 100, WithAttributeCache(cache)).OpenStore(testVaultID)
+	require.NoError(t, err)
+
+	return store
+}
+
+func requireCachedDocuments(t *testing.T, cache AttributeCache, store *Store, attributeName string,
+	documentIDs ...string) {
+	t.Helper()
+
+	cachedDocumentIDs, cached := cache.Get(store.namespace.Key(attributeName))
+	require.True(t, cached)
+	require.ElementsMatch(t, documentIDs, cachedDocumentIDs)
+}
+
+func requireQueryMatches(t *testing.T, store *Store, query *models.Query, documentIDs ...string) {
+	t.Helper()
+
+	documents, err := store.Query(query)
+	require.NoError(t, err)
+
+	matchingDocumentIDs := make([]string, len(documents))
+
+	for i := range documents {
+		matchingDocumentIDs[i] = documents[i].ID
+	}
+
+	require.ElementsMatch(t, documentIDs, matchingDocumentIDs)
+}
@@ -0,0 +1,93 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// ErrUnknownBackend is returned when opening a storage backend that hasn't been registered.
+var ErrUnknownBackend = errors.New("unknown storage backend")
+
+// BackendConstructor creates the Aries storage provider of a storage backend. databaseURL is the URL (or connection
+// string) of the database, and prefix is prepended to the names of the underlying databases. If the storage provider
+// can also delete the underlying database of a store, by implementing DeleteStore(name string) error, then that's
+// used when deleting vaults.
+type BackendConstructor func(databaseURL, prefix string) (storage.Provider, error)
+
+// nolint:gochecknoglobals
+var backends = struct {
+	sync.RWMutex
+	constructors map[string]BackendConstructor
+}{constructors: make(map[string]BackendConstructor)}
+
+// RegisterBackend makes a storage backend available under the given name, so that it can be opened with
+// OpenBackend. It panics if the name is empty, if a backend is already registered under the name, or if
+// constructor is nil.
+func RegisterBackend(name string, constructor BackendConstructor) {
+	backends.Lock()
+	defer backends.Unlock()
+
+	if name == "" {
+		panic("edvprovider: storage backend name is empty")
+	}
+
+	if constructor == nil {
+		panic("edvprovider: storage backend constructor for " + name + " is nil")
+	}
+
+	if _, registered := backends.constructors[name]; registered {
+		panic("edvprovider: storage backend " + name + " is already registered")
+	}
+
+	backends.constructors[name] = constructor
+}
+
+// Backends returns the names of the registered storage backends, in alphabetical order.
+func Backends() []string {
+	backends.RLock()
+	defer backends.RUnlock()
+
+	names := make([]string, 0, len(backends.constructors))
+
+	for name := range backends.constructors {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// IsBackendRegistered returns whether a storage backend is registered under the given name.
+func IsBackendRegistered(name string) bool {
+	backends.RLock()
+	defer backends.RUnlock()
+
+	_, registered := backends.constructors[name]
+
+	return registered
+}
+
+// OpenBackend creates the storage provider of the storage backend registered under the given name.
+// An error wrapping ErrUnknownBackend is returned if there's no backend with that name.
+func OpenBackend(name, databaseURL, prefix string) (storage.Provider, error) {
+	backends.RLock()
+	constructor, registered := backends.constructors[name]
+	backends.RUnlock()
+
+	if !registered {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownBackend, name)
+	}
+
+	return constructor(databaseURL, prefix)
+}
@@ -0,0 +1,65 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterBackend(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		var openedURL, openedPrefix string
+
+		RegisterBackend("testbackend", func(databaseURL, prefix string) (storage.Provider, error) {
+			openedURL, openedPrefix = databaseURL, prefix
+
+			return mem.NewProvider(), nil
+		})
+
+		require.True(t, IsBackendRegistered("testbackend"))
+		require.Contains(t, Backends(), "testbackend")
+
+		provider, err := OpenBackend("testbackend", "url", "prefix")
+		require.NoError(t, err)
+		require.NotNil(t, provider)
+		require.Equal(t, "url", openedURL)
+		require.Equal(t, "prefix", openedPrefix)
+	})
+	t.Run("Constructor error is returned", func(t *testing.T) {
+		errConstructor := errors.New("constructor failure")
+
+		RegisterBackend("failingbackend", func(string, string) (storage.Provider, error) {
+			return nil, errConstructor
+		})
+
+		provider, err := OpenBackend("failingbackend", "", "")
+		require.Nil(t, provider)
+		require.ErrorIs(t, err, errConstructor)
+	})
+	t.Run("Unknown backend", func(t *testing.T) {
+		require.False(t, IsBackendRegistered("unknownbackend"))
+
+		provider, err := OpenBackend("unknownbackend", "", "")
+		require.Nil(t, provider)
+		require.ErrorIs(t, err, ErrUnknownBackend)
+		require.EqualError(t, err, "unknown storage backend: unknownbackend")
+	})
+	t.Run("Invalid registrations panic", func(t *testing.T) {
+		constructor := func(string, string) (storage.Provider, error) { return mem.NewProvider(), nil }
+
+		RegisterBackend("duplicatebackend", constructor)
+
+		require.Panics(t, func() { RegisterBackend("", constructor) })
+		require.Panics(t, func() { RegisterBackend("nilbackend", nil) })
+		require.Panics(t, func() { RegisterBackend("duplicatebackend", constructor) })
+	})
+}
@@ -0,0 +1,264 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+
+	"github.com/trustbloc/edv/pkg/logging"
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+)
+
+// BatchError is returned when some of the documents in a write couldn't be stored, even after the write was split
+// into smaller batches and retried (see WithBatchRetry). The other documents in the write were stored.
+type BatchError struct {
+	// DocumentIDs are the IDs of the documents that weren't stored, in the order they were given in.
+	// The mapping documents that were stored for these documents are deleted again.
+	DocumentIDs []string
+	Err         error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("failed to store documents %s: %s", strings.Join(e.DocumentIDs, ", "), e.Err)
+}
+
+// Unwrap returns the error of the last failed write.
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// batchRetry holds the settings for splitting and retrying failed batch writes.
+type batchRetry struct {
+	retries uint
+	backoff time.Duration
+	// isTransient returns whether a failed write may succeed if it's retried. It's the one of the storage retry
+	// settings if they're given (see WithStorageRetry), and IsTransientStorageError otherwise.
+	isTransient func(err error) bool
+}
+
+// WithBatchRetry makes batch writes to the underlying store that fail with a transient error (see
+// IsTransientStorageError) get split in half and written again as two smaller batches, down to single operations,
+// so that the rest of the write isn't failed along with the operations that still fail. A retry waits for backoff
+// first, which doubles with every retry, without holding the locks of the documents being written, so that other
+// requests for them can go ahead in the meantime. Once retries have been used up for a write, its batches are still
+// split but no longer retried on their own. Batches that the database rejects for their size are split without
+// waiting, and writes that fail with any other error aren't retried.
+// Mapping documents that were stored for documents that weren't are deleted again, unless the document was stored
+// with their attributes by another request in the meantime.
+func WithBatchRetry(retries uint, backoff time.Duration) Option {
+	return func(p *Provider) {
+		p.batchRetry = &batchRetry{retries: retries, backoff: backoff, isTransient: IsTransientStorageError}
+	}
+}
+
+// batch writes the given operations to the underlying store. If the write fails and batch retry is enabled, the
+// operations are split and retried as described in WithBatchRetry, letting go of locks while backing off. It returns
+// the keys of the operations that couldn't be written, along with the last error.
+func (c *Store) batch(locks *heldLocks, operations []storage.Operation) ([]string, error) {
+	return c.batchIf(locks, nil, operations)
+}
+
+// batchIf does the same as batch, but only writes the operations for the keys in expected if the keys have the
+// values that they're mapped to (see ConditionalStore). Operations whose conditions don't hold aren't retried, and
+// fail with an error wrapping messages.ErrDocumentSequenceConflict. The conditions are checked again by each retry,
+// since the documents may have been written to while their locks were let go of.
+func (c *Store) batchIf(locks *heldLocks, expected map[string][]byte,
+	operations []storage.Operation) ([]string, error) {
+	c.recordBatchWritten(len(operations))
+
+	err := writeBatch(c.coreStore, expected, operations)
+	if err == nil {
+		return nil, nil
+	}
+
+	if c.batchRetry == nil || len(operations) == 0 || !c.batchRetry.canRetry(err) {
+		return operationKeys(operations), err
+	}
+
+	retrier := &batchRetrier{
+		coreStore: c.coreStore, expected: expected, locks: locks, isTransient: c.batchRetry.isTransient,
+		retriesLeft: c.batchRetry.retries, backoff: c.batchRetry.backoff, logger: c.log(),
+	}
+
+	retrier.retry(operations, err)
+
+	if len(retrier.failedKeys) > 0 {
+		c.log().Warnf("Failed to store %d of %d operations in vault %s after retrying: %s",
+			len(retrier.failedKeys), len(operations), c.name, retrier.err)
+	}
+
+	return retrier.failedKeys, retrier.err
+}
+
+// canRetry returns whether a batch write that failed with err may succeed if it's split up and written again.
+func (r *batchRetry) canRetry(err error) bool {
+	if errors.Is(err, messages.ErrDocumentSequenceConflict) {
+		return false
+	}
+
+	return r.isTransient(err) || isBatchTooLargeError(err)
+}
+
+// batchRetrier keeps track of a batch write that's being retried.
+type batchRetrier struct {
+	coreStore storage.Store
+	// expected holds the conditions of the write (see Store.batchIf).
+	expected map[string][]byte
+	// locks are the locks held by the write, which are let go of while backing off.
+	locks       *heldLocks
+	isTransient func(err error) bool
+	retriesLeft uint
+	backoff     time.Duration
+	failedKeys  []string
+	err         error
+	logger      logging.Logger
+}
+
+// retry writes the given operations again after they failed with err. Operations that failed with a transient error
+// are retried after backing off, and ones in a batch that was too large are split up right away.
+func (r *batchRetrier) retry(operations []storage.Operation, err error) {
+	transient := r.isTransient(err) && !errors.Is(err, messages.ErrDocumentSequenceConflict)
+
+	if len(operations) == 1 && (!transient || r.retriesLeft == 0) ||
+		!transient && !isBatchTooLargeError(err) {
+		r.failedKeys = append(r.failedKeys, operationKeys(operations)...)
+		r.err = err
+
+		return
+	}
+
+	if transient && r.retriesLeft > 0 {
+		r.retriesLeft--
+
+		r.wait()
+	}
+
+	if len(operations) == 1 {
+		r.logger.Debugf("Retrying failed write of %s: %s", operations[0].Key, err)
+
+		r.write(operations)
+
+		return
+	}
+
+	r.logger.Debugf("Retrying failed batch of %d operations as two smaller batches: %s", len(operations), err)
+
+	middle := len(operations) / 2
+
+	r.write(operations[:middle])
+	r.write(operations[middle:])
+}
+
+// wait backs off before the next retry, without holding the write's locks.
+func (r *batchRetrier) wait() {
+	r.locks.unlock()
+	time.Sleep(r.backoff)
+	r.locks.relock()
+
+	r.backoff *= 2
+}
+
+func (r *batchRetrier) write(operations []storage.Operation) {
+	err := writeBatch(r.coreStore, r.expected, operations)
+	if err != nil {
+		r.retry(operations, err)
+	}
+}
+
+// isBatchTooLargeError returns whether err is from the database rejecting a batch for its size, in which case the
+// operations in it may still be written in smaller batches: CouchDB's 413 status code, and MongoDB's error for
+// documents that are too large.
+func isBatchTooLargeError(err error) bool {
+	var statusErr interface{ StatusCode() int }
+	if errors.As(err, &statusErr) && statusErr.StatusCode() == http.StatusRequestEntityTooLarge {
+		return true
+	}
+
+	var codedErr interface{ HasErrorCode(code int) bool }
+
+	return errors.As(err, &codedErr) && codedErr.HasErrorCode(mongoObjectTooLargeCode)
+}
+
+// cleanUpFailedDocuments deletes the mapping documents that a failed write stored for documents that it didn't, which
+// are the ones among mappingDocuments whose keys aren't in failedKeys, unless the documents are stored with their
+// attributes, for example by another request while the write was backing off. If locked is set, then the caller
+// holds the locks of the documents.
+func (c *Store) cleanUpFailedDocuments(failedDocumentIDs []string, mappingDocuments []indexMappingDocument,
+	failedKeys []string, locked bool) {
+	failedDocuments := make(map[string]struct{}, len(failedDocumentIDs))
+
+	for _, documentID := range failedDocumentIDs {
+		failedDocuments[documentID] = struct{}{}
+	}
+
+	unwritten := make(map[string]struct{}, len(failedKeys))
+
+	for _, key := range failedKeys {
+		unwritten[key] = struct{}{}
+	}
+
+	cleanedUp := make(map[[2]string]struct{})
+
+	var deleted int
+
+	for _, mappingDocument := range mappingDocuments {
+		documentAttribute := [2]string{mappingDocument.MatchingEncryptedDocID, mappingDocument.AttributeName}
+
+		if _, failed := failedDocuments[documentAttribute[0]]; !failed {
+			continue
+		}
+
+		if _, notWritten := unwritten[mappingDocument.MappingDocumentName]; notWritten {
+			continue
+		}
+
+		if _, done := cleanedUp[documentAttribute]; done {
+			continue
+		}
+
+		cleanedUp[documentAttribute] = struct{}{}
+
+		var (
+			count int
+			err   error
+		)
+
+		if locked {
+			count, err = c.deleteOrphanedMappingDocuments(documentAttribute[0], documentAttribute[1])
+		} else {
+			count, err = c.repairMappingDocuments(documentAttribute[0], documentAttribute[1])
+		}
+
+		deleted += count
+
+		if err != nil {
+			c.log().Warnf("Failed to delete mapping documents of document %s in vault %s that failed to be stored, "+
+				"which are left to read-repair and consistency checks: %s", documentAttribute[0], c.name, err)
+		}
+	}
+
+	if deleted > 0 {
+		c.log().Infof("Deleted %d mapping documents of documents in vault %s that failed to be stored", deleted,
+			c.name)
+	}
+}
+
+func operationKeys(operations []storage.Operation) []string {
+	keys := make([]string, len(operations))
+
+	for i, operation := range operations {
+		keys[i] = operation.Key
+	}
+
+	return keys
+}
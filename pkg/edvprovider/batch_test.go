@@ -0,0 +1,305 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestStore_UpsertBulk_BatchRetry(t *testing.T) {
+	t.Run("Batches that are too large are split up", func(t *testing.T) {
+		coreStore := &flakyBatchStore{Store: newTestCoreStore(t), maxOperations: 1}
+		store := newBatchRetryTestStore(coreStore, 0)
+
+		documents := createTestDocuments(t, testDocID1, testDocID2)
+
+		require.NoError(t, store.UpsertBulk(documents))
+
+		for _, document := range documents {
+			_, err := store.Get(document.ID)
+			require.NoError(t, err)
+		}
+	})
+	t.Run("Transient errors are retried with backoff", func(t *testing.T) {
+		coreStore := &flakyBatchStore{
+			Store: newTestCoreStore(t), failuresLeft: map[string]int{testDocID2: 2},
+		}
+		store := newBatchRetryTestStore(coreStore, 2)
+
+		require.NoError(t, store.UpsertBulk(createTestDocuments(t, testDocID1, testDocID2)))
+
+		_, err := store.Get(testDocID2)
+		require.NoError(t, err)
+	})
+	t.Run("Only the documents that still fail are reported", func(t *testing.T) {
+		coreStore := &flakyBatchStore{
+			Store: newTestCoreStore(t), failuresLeft: map[string]int{testDocID2: 100},
+		}
+		store := newBatchRetryTestStore(coreStore, 2)
+
+		err := store.UpsertBulk(createTestDocuments(t, testDocID1, testDocID2))
+
+		var batchErr *BatchError
+
+		require.True(t, errors.As(err, &batchErr))
+		require.Equal(t, []string{testDocID2}, batchErr.DocumentIDs)
+		require.True(t, errors.Is(err, errTransient))
+		require.EqualError(t, err, "failed to store encrypted document(s) and their associated mapping "+
+			"document(s): failed to store documents "+testDocID2+": "+errTransient.Error())
+
+		_, err = store.Get(testDocID1)
+		require.NoError(t, err)
+
+		_, err = store.Get(testDocID2)
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+
+		// The mapping documents that were stored for the failed document are deleted again.
+		requireMappingDocumentCount(t, store, testDocID1, 2)
+		requireMappingDocumentCount(t, store, testDocID2, 0)
+	})
+	t.Run("Mapping documents of the stored version of a failed document are kept", func(t *testing.T) {
+		coreStore := &flakyBatchStore{Store: newTestCoreStore(t)}
+		store := newBatchRetryTestStore(coreStore, 1)
+
+		require.NoError(t, store.UpsertBulk(createTestDocuments(t, testDocID1)))
+
+		coreStore.failuresLeft = map[string]int{testDocID1: 100}
+
+		documents := createTestDocuments(t, testDocID1)
+		documents[0].Sequence = 1
+
+		var batchErr *BatchError
+
+		require.True(t, errors.As(store.UpsertBulk(documents), &batchErr))
+		requireStoredSequence(t, store, testDocID1, 0)
+		requireMappingDocumentCount(t, store, testDocID1, 2)
+	})
+	t.Run("Errors that aren't transient aren't retried", func(t *testing.T) {
+		errPermanent := errors.New("document rejected")
+
+		coreStore := &flakyBatchStore{
+			Store: newTestCoreStore(t), failuresLeft: map[string]int{testDocID2: 1}, failureErr: errPermanent,
+		}
+		store := newBatchRetryTestStore(coreStore, 2)
+
+		err := store.UpsertBulk(createTestDocuments(t, testDocID1, testDocID2))
+		require.True(t, errors.Is(err, errPermanent))
+
+		var batchErr *BatchError
+
+		require.True(t, errors.As(err, &batchErr))
+		require.Equal(t, []string{testDocID1, testDocID2}, batchErr.DocumentIDs)
+		require.Equal(t, 1, coreStore.batches)
+
+		_, err = store.Get(testDocID1)
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+	t.Run("The document locks are let go of while backing off", func(t *testing.T) {
+		failed := make(chan struct{})
+
+		coreStore := &flakyBatchStore{
+			Store: newTestCoreStore(t), failuresLeft: map[string]int{testDocID1: 1}, failed: failed,
+		}
+		store := newBatchRetryTestStore(coreStore, 1)
+		store.batchRetry.backoff = 50 * time.Millisecond
+		store.documentLocks = newDocumentLocks()
+
+		documents := createTestDocuments(t, testDocID1)
+		done := make(chan error)
+
+		go func() {
+			done <- store.UpsertBulk(documents)
+		}()
+
+		<-failed
+
+		// The document's lock can be taken while the write backs off, before the write is retried.
+		unlock := store.documentLocks.lock(store.namespace.Key(testDocID1))
+
+		_, err := store.coreStore.Get(testDocID1)
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+
+		unlock()
+
+		require.NoError(t, <-done)
+		requireStoredSequence(t, store, testDocID1, 0)
+	})
+	t.Run("Documents written to while backing off aren't overwritten", func(t *testing.T) {
+		failed := make(chan struct{})
+
+		coreStore := &flakyBatchStore{
+			Store: newTestCoreStore(t), failuresLeft: map[string]int{testDocID1: 1}, failed: failed,
+		}
+		store := newBatchRetryTestStore(coreStore, 1)
+		store.batchRetry.backoff = 50 * time.Millisecond
+		store.documentLocks = newDocumentLocks()
+
+		document := createTestDocuments(t, testDocID1)[0]
+
+		done := make(chan error)
+
+		go func() {
+			done <- store.UpsertBulk([]models.EncryptedDocument{document})
+		}()
+
+		<-failed
+
+		writeFromOtherServer(t, store.coreStore, document, 3)
+
+		err := <-done
+		require.True(t, errors.Is(err, messages.ErrDocumentSequenceConflict))
+		requireStoredSequence(t, store, testDocID1, 3)
+	})
+	t.Run("A failed mapping document fails its document", func(t *testing.T) {
+		documents := createTestDocuments(t, testDocID1, testDocID2)
+		mappingDocuments, err := (&Store{}).createMappingDocuments(documents[1:])
+		require.NoError(t, err)
+
+		mappingDocumentName := mappingDocuments[0].MappingDocumentName
+
+		coreStore := &flakyBatchStore{
+			Store: newTestCoreStore(t), failuresLeft: map[string]int{mappingDocumentName: 100},
+		}
+		store := newBatchRetryTestStore(coreStore, 0)
+
+		var batchErr *BatchError
+
+		require.True(t, errors.As(store.UpsertBulk(documents), &batchErr))
+		require.Equal(t, []string{testDocID2}, batchErr.DocumentIDs)
+	})
+	t.Run("Batch retry disabled", func(t *testing.T) {
+		coreStore := &flakyBatchStore{Store: newTestCoreStore(t), maxOperations: 1}
+		store := newBatchRetryTestStore(coreStore, 0)
+		store.batchRetry = nil
+
+		err := store.UpsertBulk(createTestDocuments(t, testDocID1))
+
+		var batchErr *BatchError
+
+		require.False(t, errors.As(err, &batchErr))
+		require.True(t, errors.Is(err, errBatchTooLarge))
+	})
+}
+
+func TestIsBatchTooLargeError(t *testing.T) {
+	require.True(t, isBatchTooLargeError(fmt.Errorf("bulk docs: %w", statusError(http.StatusRequestEntityTooLarge))))
+	require.True(t, isBatchTooLargeError(codedError(mongoObjectTooLargeCode)))
+	require.False(t, isBatchTooLargeError(statusError(http.StatusServiceUnavailable)))
+	require.False(t, isBatchTooLargeError(errors.New("batch failure")))
+}
+
+func TestWithBatchRetry_StorageRetry(t *testing.T) {
+	isTransient := func(err error) bool { return false }
+
+	provider := NewProvider(mem.NewProvider(), 100, WithBatchRetry(1, time.Millisecond),
+		WithStorageRetry(StorageRetry{IsTransient: isTransient}))
+
+	// The storage retry settings decide which errors are transient for batch retries too.
+	require.False(t, provider.batchRetry.isTransient(errTransient))
+
+	provider = NewProvider(mem.NewProvider(), 100, WithBatchRetry(1, time.Millisecond))
+	require.True(t, provider.batchRetry.isTransient(errTransient))
+}
+
+var (
+	errBatchTooLarge = statusError(http.StatusRequestEntityTooLarge)
+	errTransient     = fmt.Errorf("transient error: %w", syscall.ECONNRESET)
+)
+
+// flakyBatchStore fails batches with more than maxOperations operations (if set), and batches containing a key in
+// failuresLeft, with failureErr or else errTransient, until that key has failed the given number of times. If failed
+// is set, then it's closed after the first failure.
+type flakyBatchStore struct {
+	storage.Store
+	maxOperations int
+	failuresLeft  map[string]int
+	failureErr    error
+	failed        chan struct{}
+	batches       int
+}
+
+func (s *flakyBatchStore) Batch(operations []storage.Operation) error {
+	s.batches++
+
+	if s.maxOperations > 0 && len(operations) > s.maxOperations {
+		return errBatchTooLarge
+	}
+
+	for _, operation := range operations {
+		if s.failuresLeft[operation.Key] > 0 {
+			s.failuresLeft[operation.Key]--
+
+			if s.failed != nil {
+				close(s.failed)
+				s.failed = nil
+			}
+
+			if s.failureErr != nil {
+				return s.failureErr
+			}
+
+			return errTransient
+		}
+	}
+
+	return s.Store.Batch(operations)
+}
+
+func newTestCoreStore(t *testing.T) storage.Store {
+	t.Helper()
+
+	coreStore, err := mem.NewProvider().OpenStore(testVaultID)
+	require.NoError(t, err)
+
+	return coreStore
+}
+
+func newBatchRetryTestStore(coreStore storage.Store, retries uint) *Store {
+	return &Store{
+		coreStore: coreStore, name: testVaultID,
+		batchRetry: &batchRetry{retries: retries, backoff: time.Millisecond, isTransient: IsTransientStorageError},
+	}
+}
+
+func requireMappingDocumentCount(t *testing.T, store *Store, documentID string, count int) {
+	t.Helper()
+
+	mappingDocuments, err := store.getMappingDocuments(documentIDQuery(MappingDocumentMatchingEncryptedDocIDTagName,
+		documentID))
+	require.NoError(t, err)
+	require.Len(t, mappingDocuments, count)
+}
+
+func createTestDocuments(t *testing.T, documentIDs ...string) []models.EncryptedDocument {
+	t.Helper()
+
+	documents := make([]models.EncryptedDocument, len(documentIDs))
+
+	for i, documentID := range documentIDs {
+		err := json.Unmarshal([]byte(testEncryptedDoc), &documents[i])
+		require.NoError(t, err)
+
+		documents[i].ID = documentID
+		// Unique attributes aren't validated by UpsertBulk, but give each document its own attribute value anyway.
+		documents[i].IndexedAttributeCollections[0].IndexedAttributes[0].Value = documentID
+	}
+
+	return documents
+}
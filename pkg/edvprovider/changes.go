@@ -0,0 +1,327 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// ChangeTagName is the tag name used for finding the documents in a vault that changed since a given change stamp
+// (see Store.ChangesSince). The tag value is the change stamp of the document's last write.
+const ChangeTagName = "Change"
+
+// changeTagsKey marks a vault whose documents all have EncryptedDocumentSequenceTagName and ChangeTagName tags.
+// Vaults created before the tags were introduced don't have it until their documents are tagged by
+// Provider.UpgradeVaultStore.
+const changeTagsKey = "change_tags"
+
+// lastChangeStamp is the last change stamp handed out by nextChangeStamp.
+var lastChangeStamp int64 // nolint:gochecknoglobals
+
+// DocumentChange is the last change to a document in a vault, as found by Store.ChangesSince.
+type DocumentChange struct {
+	ID string
+	// Stamp is the time of the change, in Unix nanoseconds. Stamps are unique and increasing within each EDV
+	// server, but not across EDV servers, whose clocks can differ.
+	Stamp int64
+	// Deleted is whether the change was the deletion of the document, in which case the vault has its tombstone.
+	Deleted bool
+}
+
+// nextChangeStamp returns the change stamp for a write that's about to be made: the current time, or one more than
+// the last change stamp if the clock hasn't moved on since.
+func nextChangeStamp() int64 {
+	for {
+		last := atomic.LoadInt64(&lastChangeStamp)
+
+		stamp := time.Now().UnixNano()
+		if stamp <= last {
+			stamp = last + 1
+		}
+
+		if atomic.CompareAndSwapInt64(&lastChangeStamp, last, stamp) {
+			return stamp
+		}
+	}
+}
+
+// documentTags returns the tags of an encrypted document with the given sequence that's about to be written.
+func documentTags(sequence uint64) []storage.Tag {
+	return []storage.Tag{
+		sequenceTag(sequence),
+		{Name: ChangeTagName, Value: strconv.FormatInt(nextChangeStamp(), 10)},
+	}
+}
+
+// UpgradeVaultStore brings the store of a vault created by an earlier version of the EDV server up to date: its
+// store configuration gets the tags that were added since, and its documents are tagged with their sequences and
+// change stamps, so that they can be found by DocumentSequences and ChangesSince. Documents without tags are found
+// through their mapping documents, so documents that were stored without tags or indexed attributes stay unknown.
+// It only does anything the first time it's called for a vault.
+func (c *Provider) UpgradeVaultStore(vaultID string) error {
+	store, err := c.OpenStore(vaultID)
+	if err != nil {
+		return fmt.Errorf("failed to open store for vault: %w", err)
+	}
+
+	unlock := c.documentLocks.lock(store.namespace.Key(changeTagsKey))
+	defer unlock()
+
+	_, err = store.coreStore.Get(changeTagsKey)
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, storage.ErrDataNotFound) {
+		return fmt.Errorf("failed to get change tags marker: %w", err)
+	}
+
+	err = c.SetStoreConfig(vaultID, vaultStoreConfiguration())
+	if err != nil {
+		return fmt.Errorf("failed to set store config: %w", err)
+	}
+
+	tagged, err := store.tagUntaggedDocuments()
+	if err != nil {
+		return fmt.Errorf("failed to tag documents: %w", err)
+	}
+
+	err = store.coreStore.Put(changeTagsKey, []byte("{}"))
+	if err != nil {
+		return fmt.Errorf("failed to store change tags marker: %w", err)
+	}
+
+	c.log().Infof("Upgraded the store of vault %s: tagged %d documents", vaultID, tagged)
+
+	return nil
+}
+
+// tagUntaggedDocuments tags the documents in the store that are missing their sequence or change stamp tags, and
+// returns the number of documents tagged.
+func (c *Store) tagUntaggedDocuments() (int, error) {
+	documentSequences, err := c.DocumentSequences()
+	if err != nil {
+		return 0, err
+	}
+
+	mappingDocuments, err := c.getMappingDocuments(MappingDocumentTagName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get mapping documents: %w", err)
+	}
+
+	documentIDs := getDocumentIDsFromMappingDocumentsWithoutDuplicates(mappingDocuments)
+
+	for documentID := range documentSequences {
+		documentIDs = append(documentIDs, documentID)
+	}
+
+	sort.Strings(documentIDs)
+
+	var tagged int
+
+	for i, documentID := range documentIDs {
+		if i > 0 && documentIDs[i-1] == documentID {
+			continue
+		}
+
+		wasTagged, errTag := c.tagDocument(documentID)
+		if errTag != nil {
+			return tagged, errTag
+		}
+
+		if wasTagged {
+			tagged++
+		}
+	}
+
+	return tagged, nil
+}
+
+// tagDocument tags the given document with its sequence and a change stamp, unless it already has a change stamp.
+// It returns whether the document was tagged. Documents that no longer exist are skipped.
+func (c *Store) tagDocument(documentID string) (bool, error) {
+	unlock := c.documentLocks.lock(c.namespace.Key(documentID))
+	defer unlock()
+
+	tags, err := c.coreStore.GetTags(documentID)
+	if errors.Is(err, storage.ErrDataNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to get tags of document %s: %w", documentID, err)
+	}
+
+	for _, tag := range tags {
+		if tag.Name == ChangeTagName {
+			return false, nil
+		}
+	}
+
+	documentBytes, err := c.coreStore.Get(documentID)
+	if errors.Is(err, storage.ErrDataNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to get document %s: %w", documentID, err)
+	}
+
+	var document models.EncryptedDocument
+
+	err = json.Unmarshal(documentBytes, &document)
+	if err != nil {
+		return false, fmt.Errorf("failed to unmarshal document %s: %w", documentID, err)
+	}
+
+	err = c.coreStore.Put(documentID, documentBytes, documentTags(document.Sequence)...)
+	if err != nil {
+		return false, fmt.Errorf("failed to tag document %s: %w", documentID, err)
+	}
+
+	return true, nil
+}
+
+// ChangesSince returns the last change to each document in the store whose change stamp is greater than since,
+// sorted by change stamp. Deletions are only found through tombstones, so they're only returned if tombstone mode is
+// enabled, and only until the tombstones are purged. Documents without a ChangeTagName tag aren't included (see
+// Provider.UpgradeVaultStore).
+func (c *Store) ChangesSince(since int64) ([]DocumentChange, error) {
+	changes, existing, err := c.documentChangesSince(since)
+	if err != nil {
+		return nil, err
+	}
+
+	deletions, err := c.deletionsSince(since, existing)
+	if err != nil {
+		return nil, err
+	}
+
+	changes = append(changes, deletions...)
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Stamp != changes[j].Stamp {
+			return changes[i].Stamp < changes[j].Stamp
+		}
+
+		return changes[i].ID < changes[j].ID
+	})
+
+	return changes, nil
+}
+
+// documentChangesSince returns the changes to the existing documents since the given change stamp, along with the IDs
+// of all the existing documents with a change stamp.
+func (c *Store) documentChangesSince(since int64) ([]DocumentChange, map[string]struct{}, error) {
+	itr, err := c.coreStore.Query(ChangeTagName, storage.WithPageSize(int(c.retrievalPageSize)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query encrypted documents: %w", err)
+	}
+
+	defer storage.Close(itr, c.log())
+
+	var changes []DocumentChange
+
+	existing := make(map[string]struct{})
+
+	moreEntries, err := itr.Next()
+
+	for ; err == nil && moreEntries; moreEntries, err = itr.Next() {
+		docID, errKey := itr.Key()
+		if errKey != nil {
+			return nil, nil, fmt.Errorf("failed to get key from iterator: %w", errKey)
+		}
+
+		tags, errTags := itr.Tags()
+		if errTags != nil {
+			return nil, nil, fmt.Errorf("failed to get tags from iterator: %w", errTags)
+		}
+
+		existing[docID] = struct{}{}
+
+		for _, tag := range tags {
+			if tag.Name != ChangeTagName {
+				continue
+			}
+
+			stamp, errParse := strconv.ParseInt(tag.Value, 10, 64)
+			if errParse != nil {
+				return nil, nil, fmt.Errorf("invalid change tag on document %s: %w", docID, errParse)
+			}
+
+			if stamp > since {
+				changes = append(changes, DocumentChange{ID: docID, Stamp: stamp})
+			}
+		}
+	}
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get next entry from iterator: %w", err)
+	}
+
+	return changes, existing, nil
+}
+
+// deletionsSince returns the deletions since the given change stamp of the documents that don't exist anymore. The
+// change stamp of a deletion is the time in its tombstone.
+func (c *Store) deletionsSince(since int64, existing map[string]struct{}) ([]DocumentChange, error) {
+	itr, err := c.coreStore.Query(TombstoneTagName, storage.WithPageSize(int(c.retrievalPageSize)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tombstones: %w", err)
+	}
+
+	defer storage.Close(itr, c.log())
+
+	var deletions []DocumentChange
+
+	moreEntries, err := itr.Next()
+
+	for ; err == nil && moreEntries; moreEntries, err = itr.Next() {
+		key, errKey := itr.Key()
+		if errKey != nil {
+			return nil, fmt.Errorf("failed to get key from iterator: %w", errKey)
+		}
+
+		docID := strings.TrimPrefix(key, tombstoneKeyPrefix)
+		if _, ok := existing[docID]; ok {
+			continue
+		}
+
+		value, errValue := itr.Value()
+		if errValue != nil {
+			return nil, fmt.Errorf("failed to get value from iterator: %w", errValue)
+		}
+
+		var record tombstoneRecord
+
+		errUnmarshal := json.Unmarshal(value, &record)
+		if errUnmarshal != nil {
+			return nil, fmt.Errorf("failed to unmarshal tombstone for document %s: %w", docID, errUnmarshal)
+		}
+
+		if stamp := record.Deleted.UnixNano(); stamp > since {
+			deletions = append(deletions, DocumentChange{ID: docID, Stamp: stamp, Deleted: true})
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next entry from iterator: %w", err)
+	}
+
+	return deletions, nil
+}
@@ -0,0 +1,134 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mock"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_ChangesSince(t *testing.T) {
+	t.Run("Changes are returned in the order they were made", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100, WithTombstoneRetention(time.Hour))
+		require.NoError(t, provider.CreateVaultStore(testVaultID))
+
+		store, err := provider.OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		documents := createTestDocuments(t, testDocID1, testDocID2)
+
+		require.NoError(t, store.Put(documents[0]))
+		require.NoError(t, store.Put(documents[1]))
+
+		documents[0].Sequence = 1
+		require.NoError(t, store.Update(documents[0]))
+		require.NoError(t, store.Delete(testDocID2))
+
+		changes, err := store.ChangesSince(0)
+		require.NoError(t, err)
+		require.Len(t, changes, 2)
+		require.Equal(t, testDocID1, changes[0].ID)
+		require.False(t, changes[0].Deleted)
+		require.Equal(t, testDocID2, changes[1].ID)
+		require.True(t, changes[1].Deleted)
+		require.Less(t, changes[0].Stamp, changes[1].Stamp)
+
+		tombstone, err := store.Tombstone(testDocID2)
+		require.NoError(t, err)
+		require.Equal(t, tombstone.Deleted.UnixNano(), changes[1].Stamp)
+
+		changes, err = store.ChangesSince(changes[0].Stamp)
+		require.NoError(t, err)
+		require.Len(t, changes, 1)
+		require.Equal(t, testDocID2, changes[0].ID)
+
+		// A recreated document's tombstone is left out in favour of the document.
+		require.NoError(t, store.Put(documents[1]))
+
+		changes, err = store.ChangesSince(0)
+		require.NoError(t, err)
+		require.Len(t, changes, 2)
+		require.Equal(t, testDocID2, changes[1].ID)
+		require.False(t, changes[1].Deleted)
+	})
+	t.Run("Invalid change tag", func(t *testing.T) {
+		store := newUniqueIndexTestStore(t)
+
+		require.NoError(t, store.coreStore.Put(testDocID1, []byte("{}"), storage.Tag{Name: ChangeTagName, Value: "x"}))
+
+		_, err := store.ChangesSince(0)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid change tag on document "+testDocID1)
+	})
+	t.Run("Invalid tombstone", func(t *testing.T) {
+		store := newUniqueIndexTestStore(t)
+
+		require.NoError(t, store.coreStore.Put(tombstoneKeyPrefix+testDocID1, []byte("NotJSON"),
+			storage.Tag{Name: TombstoneTagName, Value: "1"}))
+
+		_, err := store.ChangesSince(0)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to unmarshal tombstone for document "+testDocID1)
+	})
+}
+
+func TestProvider_UpgradeVaultStore(t *testing.T) {
+	t.Run("Documents stored before change stamps were introduced are tagged", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 1)
+		require.NoError(t, provider.CreateVaultStore(testVaultID))
+
+		store, err := provider.OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		require.NoError(t, store.UpsertBulk(createTestDocuments(t, testDocID1, testDocID2)))
+
+		// Store the documents again without tags, as if they had been stored before the tags were introduced.
+		for _, docID := range []string{testDocID1, testDocID2} {
+			documentBytes, errGet := store.coreStore.Get(docID)
+			require.NoError(t, errGet)
+			require.NoError(t, store.coreStore.Put(docID, documentBytes))
+		}
+
+		require.NoError(t, store.coreStore.Delete(changeTagsKey))
+
+		changes, err := store.ChangesSince(0)
+		require.NoError(t, err)
+		require.Empty(t, changes)
+
+		require.NoError(t, provider.UpgradeVaultStore(testVaultID))
+
+		changes, err = store.ChangesSince(0)
+		require.NoError(t, err)
+		require.Len(t, changes, 2)
+
+		documentSequences, err := store.DocumentSequences()
+		require.NoError(t, err)
+		require.Len(t, documentSequences, 2)
+
+		// Vaults are only upgraded once.
+		require.NoError(t, provider.UpgradeVaultStore(testVaultID))
+
+		changesAfterUpgrade, err := store.ChangesSince(0)
+		require.NoError(t, err)
+		require.Equal(t, changes, changesAfterUpgrade)
+
+		_, err = store.coreStore.Get(changeTagsKey)
+		require.NoError(t, err)
+	})
+	t.Run("Fail to get the marker", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{OpenStoreReturn: &mock.Store{ErrGet: errors.New("get error")}}, 100)
+
+		err := provider.UpgradeVaultStore(testVaultID)
+		require.EqualError(t, err, "failed to get change tags marker: get error")
+	})
+}
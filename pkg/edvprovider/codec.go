@@ -0,0 +1,115 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const (
+	// JSONMappingDocumentCodec stores mapping documents as JSON. It's the default.
+	JSONMappingDocumentCodec = "json"
+	// CBORMappingDocumentCodec stores mapping documents as CBOR, with their fields keyed by small integers instead of
+	// their names. CBOR mapping documents are around half the size of JSON ones and are faster to unmarshal.
+	CBORMappingDocumentCodec = "cbor"
+)
+
+// MappingDocumentCodec encodes the mapping documents that are stored for each indexed attribute of a document, and
+// decodes them when they're read back.
+//
+// Mapping documents stored as JSON can always be read, whatever the codec is, so a vault can switch from JSON to
+// another codec without rewriting its existing mapping documents. Switching back to JSON after mapping documents have
+// been stored with another codec isn't supported, since those mapping documents would no longer be readable.
+// For this to work, codecs must not encode mapping documents into data that starts with '{'.
+type MappingDocumentCodec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type jsonMappingDocumentCodec struct{}
+
+func (jsonMappingDocumentCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonMappingDocumentCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type cborMappingDocumentCodec struct{}
+
+func (cborMappingDocumentCodec) Marshal(v interface{}) ([]byte, error) {
+	return cbor.Marshal(v)
+}
+
+func (cborMappingDocumentCodec) Unmarshal(data []byte, v interface{}) error {
+	return cbor.Unmarshal(data, v)
+}
+
+// MappingDocumentCodecByName returns the MappingDocumentCodec with the given name, which must be one of
+// JSONMappingDocumentCodec or CBORMappingDocumentCodec.
+func MappingDocumentCodecByName(name string) (MappingDocumentCodec, error) {
+	switch name {
+	case JSONMappingDocumentCodec:
+		return jsonMappingDocumentCodec{}, nil
+	case CBORMappingDocumentCodec:
+		return cborMappingDocumentCodec{}, nil
+	default:
+		return nil, fmt.Errorf("invalid mapping document codec %q: must be one of %s, %s", name,
+			JSONMappingDocumentCodec, CBORMappingDocumentCodec)
+	}
+}
+
+// WithMappingDocumentCodec sets the codec that new mapping documents are stored with. Vaults with millions of mapping
+// documents can use a compact binary codec, such as CBOR, to reduce the size of their index and the cost of
+// unmarshalling it during queries. If it isn't set, then mapping documents are stored as JSON.
+func WithMappingDocumentCodec(codec MappingDocumentCodec) Option {
+	return func(p *Provider) {
+		p.mappingDocumentCodec = codec
+	}
+}
+
+// encodeMappingDocument encodes the given mapping document with the store's codec, and encrypts it if encryption at
+// rest is enabled.
+func (c *Store) encodeMappingDocument(mappingDocument *indexMappingDocument) ([]byte, error) {
+	var data []byte
+
+	var err error
+
+	if c.mappingDocumentCodec == nil {
+		data, err = json.Marshal(mappingDocument)
+	} else {
+		data, err = c.mappingDocumentCodec.Marshal(mappingDocument)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c.encryption.seal(c.name, data)
+}
+
+// decodeMappingDocument decrypts the given stored mapping document if it's encrypted, and decodes it. Mapping
+// documents stored as JSON are decoded as JSON whatever the store's codec is, so that the ones stored before the
+// codec was changed can still be read.
+func (c *Store) decodeMappingDocument(data []byte) (indexMappingDocument, error) {
+	var mappingDocument indexMappingDocument
+
+	data, err := c.encryption.open(c.name, data)
+	if err != nil {
+		return mappingDocument, err
+	}
+
+	if c.mappingDocumentCodec == nil || len(data) > 0 && data[0] == '{' {
+		return mappingDocument, json.Unmarshal(data, &mappingDocument)
+	}
+
+	return mappingDocument, c.mappingDocumentCodec.Unmarshal(data, &mappingDocument)
+}
@@ -0,0 +1,121 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const testNonUniqueIndexName = "DUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ"
+
+func TestMappingDocumentCodecByName(t *testing.T) {
+	mappingDocument := indexMappingDocument{
+		AttributeName: testIndexName2, MatchingEncryptedDocID: testDocID1,
+		MappingDocumentName: testDocID1 + "_mapping_1", HMACKeyID: "https://example.com/kms/z7BgF536GaR",
+	}
+
+	for _, name := range []string{JSONMappingDocumentCodec, CBORMappingDocumentCodec} {
+		codec, err := MappingDocumentCodecByName(name)
+		require.NoError(t, err)
+
+		mappingDocumentBytes, err := codec.Marshal(mappingDocument)
+		require.NoError(t, err)
+
+		var readMappingDocument indexMappingDocument
+
+		require.NoError(t, codec.Unmarshal(mappingDocumentBytes, &readMappingDocument), name)
+		require.Equal(t, mappingDocument, readMappingDocument, name)
+	}
+
+	_, err := MappingDocumentCodecByName("msgpack")
+	require.EqualError(t, err, `invalid mapping document codec "msgpack": must be one of json, cbor`)
+}
+
+func TestStore_CBORMappingDocuments(t *testing.T) {
+	coreProvider := mem.NewProvider()
+
+	jsonStore, err := NewProvider(coreProvider, 100).OpenStore(testVaultID)
+	require.NoError(t, err)
+
+	require.NoError(t, jsonStore.Put(createTestDocuments(t, testDocID1)[0]))
+
+	cborStore, err := NewProvider(coreProvider, 100,
+		WithMappingDocumentCodec(cborMappingDocumentCodec{})).OpenStore(testVaultID)
+	require.NoError(t, err)
+
+	require.NoError(t, cborStore.Put(createTestDocuments(t, testDocID2)[0]))
+
+	t.Run("New mapping documents are smaller", func(t *testing.T) {
+		jsonMappingDocumentBytes := getStoredMappingDocuments(t, cborStore, testDocID1)
+		cborMappingDocumentBytes := getStoredMappingDocuments(t, cborStore, testDocID2)
+
+		require.Len(t, cborMappingDocumentBytes, len(jsonMappingDocumentBytes))
+
+		for i := range cborMappingDocumentBytes {
+			require.Less(t, len(cborMappingDocumentBytes[i]), len(jsonMappingDocumentBytes[i]))
+			require.NotEqual(t, byte('{'), cborMappingDocumentBytes[i][0])
+		}
+	})
+	t.Run("Mapping documents stored with either codec are queried", func(t *testing.T) {
+		requireQueryMatches(t, cborStore, &models.Query{Has: testNonUniqueIndexName}, testDocID1, testDocID2)
+	})
+	t.Run("Exported mapping documents are JSON and are re-encoded on import", func(t *testing.T) {
+		replicatedDocument, err := cborStore.ExportDocument(testDocID2)
+		require.NoError(t, err)
+		require.NotEmpty(t, replicatedDocument.MappingDocuments)
+
+		for _, mappingDocumentBytes := range replicatedDocument.MappingDocuments {
+			require.True(t, json.Valid(mappingDocumentBytes))
+		}
+
+		importingStore, err := NewProvider(mem.NewProvider(), 100,
+			WithMappingDocumentCodec(cborMappingDocumentCodec{})).OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		require.NoError(t, importingStore.ImportDocument(replicatedDocument))
+		requireQueryMatches(t, importingStore, &models.Query{Has: testNonUniqueIndexName}, testDocID2)
+
+		for _, mappingDocumentBytes := range getStoredMappingDocuments(t, importingStore, testDocID2) {
+			require.False(t, json.Valid(mappingDocumentBytes))
+		}
+	})
+}
+
+// getStoredMappingDocuments returns the stored mapping documents of the given document as they are in the database.
+func getStoredMappingDocuments(t *testing.T, store *Store, documentID string) [][]byte {
+	t.Helper()
+
+	iterator, err := store.coreStore.Query(documentIDQuery(MappingDocumentMatchingEncryptedDocIDTagName, documentID))
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, iterator.Close())
+	}()
+
+	var mappingDocuments [][]byte
+
+	more, err := iterator.Next()
+	require.NoError(t, err)
+
+	for more {
+		value, err := iterator.Value()
+		require.NoError(t, err)
+
+		mappingDocuments = append(mappingDocuments, value)
+
+		more, err = iterator.Next()
+		require.NoError(t, err)
+	}
+
+	return mappingDocuments
+}
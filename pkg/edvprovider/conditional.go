@@ -0,0 +1,255 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// ConditionalStore can be implemented by the stores of a storage backend that can make a batch write conditional on
+// the values of the entries it replaces, in the same transaction as the write. The sequence checks of document
+// writes (see Store.Update, Store.DeleteIfSequenceMatches and Store.UpsertBulk) then hold across EDV servers that
+// share a database. Without it, they only hold within one EDV server, whose document locks aren't shared.
+type ConditionalStore interface {
+	// BatchIf performs operations like Batch, but only if each key in expected has the value it's mapped to, or has
+	// no value if it's mapped to nil. It returns whether the operations were performed.
+	BatchIf(expected map[string][]byte, operations []storage.Operation) (bool, error)
+}
+
+// batchIf performs operations on store if each key in expected has the value it's mapped to (see ConditionalStore).
+// If store doesn't implement ConditionalStore, then the values are read and compared before the operations are
+// performed, which is only safe while holding the locks of the keys.
+func batchIf(store storage.Store, expected map[string][]byte, operations []storage.Operation) (bool, error) {
+	if conditionalStore, ok := store.(ConditionalStore); ok && len(expected) > 0 {
+		return conditionalStore.BatchIf(expected, operations)
+	}
+
+	return batchIfByGet(store, expected, operations)
+}
+
+// batchIfByGet reads and compares the values of the keys in expected, and performs operations if they match, for
+// stores that don't implement ConditionalStore.
+func batchIfByGet(store storage.Store, expected map[string][]byte, operations []storage.Operation) (bool, error) {
+	if len(expected) > 0 {
+		keys := make([]string, 0, len(expected))
+
+		for key := range expected {
+			keys = append(keys, key)
+		}
+
+		values, err := store.GetBulk(keys...)
+		if err != nil {
+			return false, err
+		}
+
+		if len(values) != len(keys) {
+			return false, fmt.Errorf("got %d values for %d keys", len(values), len(keys))
+		}
+
+		for i, key := range keys {
+			if (values[i] == nil) != (expected[key] == nil) || !bytes.Equal(values[i], expected[key]) {
+				return false, nil
+			}
+		}
+	}
+
+	return true, store.Batch(operations)
+}
+
+// writeIf does the same as write, but only if the document that operation is for is still stored as
+// currentDocument. Otherwise, an error wrapping messages.ErrDocumentSequenceConflict is returned, and nothing is
+// written.
+func (c *Store) writeIf(currentDocument []byte, operation storage.Operation,
+	sideOperations []storage.Operation) error {
+	err := writeBatch(c.coreStore, map[string][]byte{operation.Key: currentDocument},
+		append([]storage.Operation{operation}, sideOperations...))
+	if err != nil {
+		return err
+	}
+
+	c.markOutboxAfter(sideOperations)
+
+	return nil
+}
+
+// writeBatch performs operations on store if the keys of the operations that are in expected have the values that
+// they're mapped to. Otherwise, an error wrapping messages.ErrDocumentSequenceConflict is returned, and nothing is
+// written.
+func writeBatch(store storage.Store, expected map[string][]byte, operations []storage.Operation) error {
+	conditions := conditionsOf(expected, operations)
+
+	written, err := batchIf(store, conditions, operations)
+	if err != nil {
+		return err
+	}
+
+	if !written {
+		keys := make([]string, 0, len(conditions))
+
+		for key := range conditions {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		return fmt.Errorf(messages.DocumentChangedDuringWrite, messages.ErrDocumentSequenceConflict,
+			strings.Join(keys, ", "))
+	}
+
+	return nil
+}
+
+// lockDocuments locks the given documents, in the order of their IDs so that two writes to the same documents can't
+// wait on each other, and returns the held locks.
+func (c *Store) lockDocuments(documents []models.EncryptedDocument) *heldLocks {
+	keys := make([]string, 0, len(documents))
+
+	for i := range documents {
+		keys = append(keys, c.namespace.Key(documents[i].ID))
+	}
+
+	return c.documentLocks.lockAll(keys...)
+}
+
+// heldLocks are the document locks held by a write. A batch retry lets go of them while it backs off (see
+// WithBatchRetry), so that other requests for the documents aren't held up by it. A nil *heldLocks holds no locks.
+type heldLocks struct {
+	documentLocks *documentLocks
+	keys          []string
+	unlocks       []func()
+}
+
+// lockAll locks the given keys, in order so that two writes that lock some of the same keys can't wait on each
+// other, and returns the held locks.
+func (d *documentLocks) lockAll(keys ...string) *heldLocks {
+	sortedKeys := append([]string(nil), keys...)
+	sort.Strings(sortedKeys)
+
+	locks := &heldLocks{documentLocks: d}
+
+	for i, key := range sortedKeys {
+		if i > 0 && sortedKeys[i-1] == key {
+			continue
+		}
+
+		locks.keys = append(locks.keys, key)
+	}
+
+	locks.relock()
+
+	return locks
+}
+
+// unlock releases the locks.
+func (l *heldLocks) unlock() {
+	if l == nil {
+		return
+	}
+
+	for _, unlock := range l.unlocks {
+		unlock()
+	}
+
+	l.unlocks = nil
+}
+
+// relock takes the locks again after unlock.
+func (l *heldLocks) relock() {
+	if l == nil {
+		return
+	}
+
+	for _, key := range l.keys {
+		l.unlocks = append(l.unlocks, l.documentLocks.lock(key))
+	}
+}
+
+// upsertConditions checks the sequences of the given documents against the ones of the stored documents: a document
+// that's already stored, or given earlier in documents, must have a sequence that's one greater. It returns the
+// stored documents, mapped by ID, with nil for the ones that aren't stored, as the conditions of the write.
+func (c *Store) upsertConditions(documents []models.EncryptedDocument) (map[string][]byte, error) {
+	if len(documents) == 0 {
+		return nil, nil
+	}
+
+	expected := make(map[string][]byte, len(documents))
+
+	var documentIDs []string
+
+	for i := range documents {
+		if _, ok := expected[documents[i].ID]; !ok {
+			expected[documents[i].ID] = nil
+			documentIDs = append(documentIDs, documents[i].ID)
+		}
+	}
+
+	storedDocuments, err := c.coreStore.GetBulk(documentIDs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current versions of documents: %w", err)
+	}
+
+	if len(storedDocuments) != len(documentIDs) {
+		return nil, fmt.Errorf("failed to get current versions of documents: got %d values for %d keys",
+			len(storedDocuments), len(documentIDs))
+	}
+
+	sequences := make(map[string]uint64, len(documentIDs))
+
+	for i, documentID := range documentIDs {
+		if storedDocuments[i] == nil {
+			continue
+		}
+
+		var storedDocument models.EncryptedDocument
+
+		err = json.Unmarshal(storedDocuments[i], &storedDocument)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal current version of document %s: %w", documentID, err)
+		}
+
+		expected[documentID] = storedDocuments[i]
+		sequences[documentID] = storedDocument.Sequence
+	}
+
+	for i := range documents {
+		sequence, stored := sequences[documents[i].ID]
+		if stored && documents[i].Sequence != sequence+1 {
+			return nil, fmt.Errorf(messages.UnexpectedUpsertSequence, messages.ErrDocumentSequenceConflict,
+				documents[i].ID, sequence+1, documents[i].Sequence)
+		}
+
+		sequences[documents[i].ID] = documents[i].Sequence
+	}
+
+	return expected, nil
+}
+
+// conditionsOf returns the conditions in expected for the keys of the given operations, or nil if there are none.
+func conditionsOf(expected map[string][]byte, operations []storage.Operation) map[string][]byte {
+	var conditions map[string][]byte
+
+	for _, operation := range operations {
+		if value, ok := expected[operation.Key]; ok {
+			if conditions == nil {
+				conditions = make(map[string][]byte)
+			}
+
+			conditions[operation.Key] = value
+		}
+	}
+
+	return conditions
+}
@@ -0,0 +1,225 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestStore_Update_Conditional(t *testing.T) {
+	t.Run("Backends that can write conditionally are used", func(t *testing.T) {
+		coreStore := &conditionalCoreStore{Store: newTestCoreStore(t)}
+		store := &Store{coreStore: coreStore, name: testVaultID}
+
+		documents := createTestDocuments(t, testDocID1)
+		require.NoError(t, store.Put(documents[0]))
+
+		documents[0].Sequence = 1
+		require.NoError(t, store.Update(documents[0]))
+		require.Equal(t, 1, coreStore.conditionalBatches)
+		requireStoredSequence(t, store, testDocID1, 1)
+	})
+	t.Run("A document written to by another server in between isn't overwritten", func(t *testing.T) {
+		coreStore := &conditionalCoreStore{Store: newTestCoreStore(t)}
+		store := &Store{coreStore: coreStore, name: testVaultID}
+
+		documents := createTestDocuments(t, testDocID1)
+		require.NoError(t, store.Put(documents[0]))
+
+		coreStore.beforeWrite = func() {
+			writeFromOtherServer(t, coreStore.Store, documents[0], 1)
+		}
+
+		documents[0].Sequence = 1
+		err := store.Update(documents[0])
+		require.True(t, errors.Is(err, messages.ErrDocumentSequenceConflict))
+		require.Contains(t, err.Error(), "documents "+testDocID1+" were written to by another request")
+		requireStoredSequence(t, store, testDocID1, 1)
+	})
+	t.Run("Without a conditional backend, the stored document is compared before the write", func(t *testing.T) {
+		coreStore := &interferingCoreStore{Store: newTestCoreStore(t)}
+		store := &Store{coreStore: coreStore, name: testVaultID}
+
+		documents := createTestDocuments(t, testDocID1)
+		require.NoError(t, store.Put(documents[0]))
+
+		coreStore.beforeGetBulk = func() {
+			writeFromOtherServer(t, coreStore.Store, documents[0], 1)
+		}
+
+		documents[0].Sequence = 1
+		err := store.Update(documents[0])
+		require.True(t, errors.Is(err, messages.ErrDocumentSequenceConflict))
+	})
+	t.Run("Deletions are conditional too", func(t *testing.T) {
+		coreStore := &conditionalCoreStore{Store: newTestCoreStore(t)}
+		store := &Store{coreStore: coreStore, name: testVaultID}
+
+		documents := createTestDocuments(t, testDocID1)
+		require.NoError(t, store.Put(documents[0]))
+
+		coreStore.beforeWrite = func() {
+			writeFromOtherServer(t, coreStore.Store, documents[0], 1)
+		}
+
+		err := store.DeleteIfSequenceMatches(testDocID1, 0)
+		require.True(t, errors.Is(err, messages.ErrDocumentSequenceConflict))
+		requireStoredSequence(t, store, testDocID1, 1)
+	})
+}
+
+func TestStore_UpsertBulk_Sequences(t *testing.T) {
+	t.Run("Stored documents must be given with the next sequence", func(t *testing.T) {
+		store := newUniqueIndexTestStore(t)
+
+		documents := createTestDocuments(t, testDocID1)
+		require.NoError(t, store.Put(documents[0]))
+
+		documents = createTestDocuments(t, testDocID1, testDocID2)
+
+		err := store.UpsertBulk(documents)
+		require.True(t, errors.Is(err, messages.ErrDocumentSequenceConflict))
+		require.Contains(t, err.Error(), "expected new sequence of document "+testDocID1+" to be 1 but got 0")
+
+		// None of the documents are stored.
+		_, err = store.Get(testDocID2)
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+
+		documents[0].Sequence = 1
+		require.NoError(t, store.UpsertBulk(documents))
+		requireStoredSequence(t, store, testDocID1, 1)
+	})
+	t.Run("A document given more than once must have increasing sequences", func(t *testing.T) {
+		store := newUniqueIndexTestStore(t)
+
+		documents := createTestDocuments(t, testDocID1, testDocID1)
+
+		err := store.UpsertBulk(documents)
+		require.True(t, errors.Is(err, messages.ErrDocumentSequenceConflict))
+
+		documents[1].Sequence = 1
+		require.NoError(t, store.UpsertBulk(documents))
+		requireStoredSequence(t, store, testDocID1, 1)
+	})
+	t.Run("A document written to by another server in between isn't overwritten", func(t *testing.T) {
+		coreStore := &conditionalCoreStore{Store: newTestCoreStore(t)}
+		store := &Store{coreStore: coreStore, name: testVaultID}
+
+		documents := createTestDocuments(t, testDocID1)
+		require.NoError(t, store.Put(documents[0]))
+
+		coreStore.beforeWrite = func() {
+			writeFromOtherServer(t, coreStore.Store, documents[0], 1)
+		}
+
+		documents[0].Sequence = 1
+		err := store.UpsertBulk(documents)
+		require.True(t, errors.Is(err, messages.ErrDocumentSequenceConflict))
+	})
+	t.Run("Fail to get the stored documents", func(t *testing.T) {
+		coreStore := &interferingCoreStore{Store: newTestCoreStore(t), errGetBulk: errors.New("get bulk error")}
+		store := &Store{coreStore: coreStore, name: testVaultID}
+
+		err := store.UpsertBulk(createTestDocuments(t, testDocID1))
+		require.EqualError(t, err, "failed to get current versions of documents: get bulk error")
+	})
+}
+
+// conditionalCoreStore is a store that implements ConditionalStore. beforeWrite, if set, is called once before the
+// first conditional write, to simulate another EDV server writing in between.
+type conditionalCoreStore struct {
+	storage.Store
+	mutex              sync.Mutex
+	beforeWrite        func()
+	conditionalBatches int
+}
+
+func (s *conditionalCoreStore) BatchIf(expected map[string][]byte, operations []storage.Operation) (bool, error) {
+	if s.beforeWrite != nil {
+		s.beforeWrite()
+		s.beforeWrite = nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.conditionalBatches++
+
+	for key, value := range expected {
+		storedValue, err := s.Store.Get(key)
+		if errors.Is(err, storage.ErrDataNotFound) {
+			storedValue, err = nil, nil
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		if (storedValue == nil) != (value == nil) || !bytes.Equal(storedValue, value) {
+			return false, nil
+		}
+	}
+
+	return true, s.Store.Batch(operations)
+}
+
+// interferingCoreStore is a store that doesn't implement ConditionalStore. beforeGetBulk, if set, is called once
+// before the next GetBulk.
+type interferingCoreStore struct {
+	storage.Store
+	beforeGetBulk func()
+	errGetBulk    error
+}
+
+func (s *interferingCoreStore) GetBulk(keys ...string) ([][]byte, error) {
+	if s.beforeGetBulk != nil {
+		s.beforeGetBulk()
+		s.beforeGetBulk = nil
+	}
+
+	if s.errGetBulk != nil {
+		return nil, s.errGetBulk
+	}
+
+	return s.Store.GetBulk(keys...)
+}
+
+// writeFromOtherServer stores document with the given sequence directly in coreStore, as another EDV server sharing
+// the database would.
+func writeFromOtherServer(t *testing.T, coreStore storage.Store, document models.EncryptedDocument,
+	sequence uint64) {
+	t.Helper()
+
+	document.Sequence = sequence
+
+	documentBytes, err := json.Marshal(document)
+	require.NoError(t, err)
+
+	require.NoError(t, coreStore.Put(document.ID, documentBytes, sequenceTag(sequence)))
+}
+
+func requireStoredSequence(t *testing.T, store *Store, documentID string, sequence uint64) {
+	t.Helper()
+
+	documentBytes, err := store.Get(documentID)
+	require.NoError(t, err)
+
+	var document models.EncryptedDocument
+
+	require.NoError(t, json.Unmarshal(documentBytes, &document))
+	require.Equal(t, sequence, document.Sequence)
+}
@@ -0,0 +1,258 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// CheckConsistency checks that the mapping documents of the given vault match its encrypted documents, and repairs
+// the ones that don't. Mapping documents can drift from the documents if, for example, a batch was only partially
+// stored or the database was edited by hand. messages.ErrVaultNotFound is returned if the vault doesn't exist.
+func (c *Provider) CheckConsistency(vaultID string) (*models.ConsistencyReport, error) {
+	exists, err := c.StoreExists(vaultID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine whether vault exists: %w", err)
+	}
+
+	if !exists {
+		return nil, messages.ErrVaultNotFound
+	}
+
+	store, err := c.OpenStore(vaultID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store for vault: %w", err)
+	}
+
+	return store.CheckConsistency()
+}
+
+// CheckAllVaultsConsistency runs CheckConsistency on every vault, and returns the reports of the vaults that had
+// inconsistencies.
+func (c *Provider) CheckAllVaultsConsistency() ([]models.ConsistencyReport, error) {
+	err := c.background.begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer c.background.end()
+
+	configStore, err := c.coreProvider.OpenStore(VaultConfigurationStoreName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store for vault configurations: %w", err)
+	}
+
+	vaultIDs, err := entryKeys(configStore, VaultConfigReferenceIDTagName, c.retrievalPageSize, c.log())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vaults: %w", err)
+	}
+
+	var reports []models.ConsistencyReport
+
+	for _, vaultID := range vaultIDs {
+		store, errOpen := c.OpenStore(vaultID)
+		if errOpen != nil {
+			return reports, fmt.Errorf("failed to open store for vault %s: %w", vaultID, errOpen)
+		}
+
+		report, errCheck := store.CheckConsistency()
+		if errCheck != nil {
+			return reports, fmt.Errorf("failed to check consistency of vault %s: %w", vaultID, errCheck)
+		}
+
+		if report.OrphanedMappingDocuments+report.MissingMappingDocuments > 0 {
+			reports = append(reports, *report)
+		}
+	}
+
+	return reports, nil
+}
+
+// CheckConsistency scans the store for orphaned mapping documents, which point at documents that don't exist or don't
+// have the mapping document's attribute, and for indexed attributes of documents that don't have a mapping document.
+// Orphaned mapping documents are deleted and missing ones are created, and the repairs are counted towards the
+// vault's index corruption alerts.
+// Each document is rechecked while holding its lock before it's repaired, so documents written during the check are
+// left alone. Documents without an EncryptedDocumentSequenceTagName tag are only checked if they have mapping
+// documents.
+func (c *Store) CheckConsistency() (*models.ConsistencyReport, error) {
+	documentSequences, err := c.DocumentSequences()
+	if err != nil {
+		return nil, err
+	}
+
+	mappingDocuments, err := c.getMappingDocuments(MappingDocumentTagName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mapping documents: %w", err)
+	}
+
+	report := &models.ConsistencyReport{
+		VaultID:                 c.name,
+		DocumentsChecked:        len(documentSequences),
+		MappingDocumentsChecked: len(mappingDocuments),
+	}
+
+	mappedAttributes := make(map[string]map[string]struct{})
+
+	for _, mappingDocument := range mappingDocuments {
+		if mappedAttributes[mappingDocument.MatchingEncryptedDocID] == nil {
+			mappedAttributes[mappingDocument.MatchingEncryptedDocID] = make(map[string]struct{})
+		}
+
+		mappedAttributes[mappingDocument.MatchingEncryptedDocID][mappingDocument.AttributeName] = struct{}{}
+	}
+
+	documentIDs := make([]string, 0, len(documentSequences))
+
+	for documentID := range documentSequences {
+		documentIDs = append(documentIDs, documentID)
+	}
+
+	for documentID := range mappedAttributes {
+		if _, found := documentSequences[documentID]; !found {
+			documentIDs = append(documentIDs, documentID)
+		}
+	}
+
+	sort.Strings(documentIDs)
+
+	for _, documentID := range documentIDs {
+		orphaned, missing, errCheck := c.checkDocumentConsistency(documentID, mappedAttributes[documentID])
+		report.OrphanedMappingDocuments += orphaned
+		report.MissingMappingDocuments += missing
+
+		if errCheck != nil {
+			c.reportIndexInconsistencies(report.OrphanedMappingDocuments, report.MissingMappingDocuments)
+
+			return nil, fmt.Errorf("failed to check consistency of document %s: %w", documentID, errCheck)
+		}
+	}
+
+	if report.OrphanedMappingDocuments+report.MissingMappingDocuments > 0 {
+		c.log().Warnf("Consistency check of vault %s deleted %d orphaned and created %d missing mapping document(s)",
+			c.name, report.OrphanedMappingDocuments, report.MissingMappingDocuments)
+	}
+
+	c.reportIndexInconsistencies(report.OrphanedMappingDocuments, report.MissingMappingDocuments)
+
+	return report, nil
+}
+
+// checkDocumentConsistency repairs the mapping documents of the given document, given the names of the attributes
+// that it has mapping documents for. It returns the numbers of orphaned mapping documents deleted and missing ones
+// created.
+func (c *Store) checkDocumentConsistency(documentID string,
+	mappedAttributes map[string]struct{}) (int, int, error) {
+	attributes, err := c.documentAttributes(documentID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var orphaned, missing int
+
+	for attributeName := range mappedAttributes {
+		if _, found := attributes[attributeName]; found {
+			continue
+		}
+
+		count, errRepair := c.repairMappingDocuments(documentID, attributeName)
+		orphaned += count
+
+		if errRepair != nil {
+			return orphaned, missing, errRepair
+		}
+	}
+
+	for attributeName := range attributes {
+		if _, found := mappedAttributes[attributeName]; found {
+			continue
+		}
+
+		created, errRepair := c.repairMissingMappingDocument(documentID, attributeName)
+		if errRepair != nil {
+			return orphaned, missing, errRepair
+		}
+
+		if created {
+			missing++
+		}
+	}
+
+	return orphaned, missing, nil
+}
+
+// repairMissingMappingDocument stores a mapping document for the given attribute of the given document, if the
+// document still has the attribute and still doesn't have a mapping document for it. It returns whether a mapping
+// document was stored.
+func (c *Store) repairMissingMappingDocument(documentID, attributeName string) (bool, error) {
+	unlock := c.documentLocks.lock(c.namespace.Key(documentID))
+	defer unlock()
+
+	found, err := c.documentHasAttribute(documentID, attributeName)
+	if err != nil || !found {
+		return false, err
+	}
+
+	mappingDocuments, err := c.getMappingDocuments(documentIDQuery(
+		MappingDocumentMatchingEncryptedDocIDTagName, documentID))
+	if err != nil {
+		return false, fmt.Errorf("failed to get mapping documents: %w", err)
+	}
+
+	for _, mappingDocument := range mappingDocuments {
+		if mappingDocument.AttributeName == attributeName {
+			return false, nil
+		}
+	}
+
+	// The attribute may be in more than one indexed attribute collection, so the mapping document isn't tied to the
+	// HMAC key of any of them.
+	err = c.createAndStoreMappingDocument(attributeName, "", documentID)
+	if err != nil {
+		return false, fmt.Errorf("failed to store missing mapping document: %w", err)
+	}
+
+	return true, nil
+}
+
+// documentAttributes returns the names of the indexed attributes of the document with the given ID, or nil if the
+// document doesn't exist.
+func (c *Store) documentAttributes(documentID string) (map[string]struct{}, error) {
+	documentBytes, err := c.coreStore.Get(documentID)
+	if errors.Is(err, storage.ErrDataNotFound) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document: %w", err)
+	}
+
+	var document models.EncryptedDocument
+
+	err = json.Unmarshal(documentBytes, &document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal document: %w", err)
+	}
+
+	attributes := make(map[string]struct{})
+
+	for _, indexedAttributeCollection := range document.IndexedAttributeCollections {
+		for _, indexedAttribute := range indexedAttributeCollection.IndexedAttributes {
+			attributes[indexedAttribute.Name] = struct{}{}
+		}
+	}
+
+	return attributes, nil
+}
@@ -0,0 +1,160 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mock"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestProvider_CheckConsistency(t *testing.T) {
+	t.Run("Orphaned and missing mapping documents are repaired", func(t *testing.T) {
+		alerter := &mockIndexCorruptionAlerter{}
+
+		provider := NewProvider(mem.NewProvider(), 100, WithIndexCorruptionAlerts(0, alerter))
+		store := createVaultWithDocuments(t, provider)
+
+		// The first document is lost, leaving its mapping document orphaned.
+		require.NoError(t, store.coreStore.Delete(testDocID1))
+
+		// The second document loses its mapping document.
+		mappingDocuments, err := store.getMappingDocuments(fmt.Sprintf("%s:%s",
+			MappingDocumentMatchingEncryptedDocIDTagName, testDocID2))
+		require.NoError(t, err)
+		require.Len(t, mappingDocuments, 1)
+		require.NoError(t, store.deleteMappingDocument(mappingDocuments[0]))
+
+		report, err := provider.CheckConsistency(testVaultID)
+		require.NoError(t, err)
+		require.Equal(t, &models.ConsistencyReport{
+			VaultID:                  testVaultID,
+			DocumentsChecked:         1,
+			MappingDocumentsChecked:  1,
+			OrphanedMappingDocuments: 1,
+			MissingMappingDocuments:  1,
+		}, report)
+
+		requireQueryMatches(t, store, &models.Query{Has: testIndexName2}, testDocID2)
+
+		alerts := alerter.getAlerts()
+		require.Len(t, alerts, 1)
+		require.Equal(t, 1, alerts[0].OrphanedMappingDocuments)
+		require.Equal(t, 1, alerts[0].MissingMappingDocuments)
+
+		report, err = provider.CheckConsistency(testVaultID)
+		require.NoError(t, err)
+		require.Equal(t, &models.ConsistencyReport{
+			VaultID:                 testVaultID,
+			DocumentsChecked:        1,
+			MappingDocumentsChecked: 1,
+		}, report)
+		require.Len(t, alerter.getAlerts(), 1)
+	})
+	t.Run("Mapping documents for attributes a document no longer has are deleted", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+		store := createVaultWithDocuments(t, provider)
+
+		require.NoError(t, store.putMappingDocument(indexMappingDocument{
+			AttributeName: testIndexName3, MatchingEncryptedDocID: testDocID1, MappingDocumentName: "stale",
+		}))
+
+		report, err := provider.CheckConsistency(testVaultID)
+		require.NoError(t, err)
+		require.Equal(t, 2, report.DocumentsChecked)
+		require.Equal(t, 3, report.MappingDocumentsChecked)
+		require.Equal(t, 1, report.OrphanedMappingDocuments)
+		require.Zero(t, report.MissingMappingDocuments)
+
+		mappingDocuments, err := store.getMappingDocuments(MappingDocumentTagName)
+		require.NoError(t, err)
+		require.Len(t, mappingDocuments, 2)
+	})
+	t.Run("Vault not found", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+
+		report, err := provider.CheckConsistency(testVaultID)
+		require.True(t, errors.Is(err, messages.ErrVaultNotFound))
+		require.Nil(t, report)
+	})
+	t.Run("Fail to determine whether vault exists", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{ErrGetStoreConfig: errors.New("get store config error")}, 100)
+
+		_, err := provider.CheckConsistency(testVaultID)
+		require.EqualError(t, err, "failed to determine whether vault exists: "+
+			"unexpected error while getting store config: get store config error")
+	})
+	t.Run("Fail to query documents", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{OpenStoreReturn: &mock.Store{ErrQuery: errors.New("query error")}}, 100)
+
+		store, err := provider.OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		report, err := store.CheckConsistency()
+		require.EqualError(t, err, "failed to query encrypted documents: query error")
+		require.Nil(t, report)
+	})
+	t.Run("Fail to get document", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+		store := createVaultWithDocuments(t, provider)
+
+		store.coreStore = &failingGetStore{Store: store.coreStore, errGet: errors.New("get error")}
+
+		report, err := store.CheckConsistency()
+		require.EqualError(t, err, "failed to check consistency of document "+testDocID2+
+			": failed to get document: get error")
+		require.Nil(t, report)
+	})
+}
+
+func TestProvider_CheckAllVaultsConsistency(t *testing.T) {
+	t.Run("Reports of vaults with inconsistencies are returned", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+		store := createVaultWithDocuments(t, provider)
+
+		reports, err := provider.CheckAllVaultsConsistency()
+		require.NoError(t, err)
+		require.Empty(t, reports)
+
+		require.NoError(t, store.coreStore.Delete(testDocID1))
+
+		reports, err = provider.CheckAllVaultsConsistency()
+		require.NoError(t, err)
+		require.Len(t, reports, 1)
+		require.Equal(t, testVaultID, reports[0].VaultID)
+		require.Equal(t, 1, reports[0].OrphanedMappingDocuments)
+	})
+	t.Run("Fail to open config store", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{ErrOpenStore: errors.New("open store error")}, 100)
+
+		_, err := provider.CheckAllVaultsConsistency()
+		require.EqualError(t, err, "failed to open store for vault configurations: open store error")
+	})
+	t.Run("Fail to get vaults", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{OpenStoreReturn: &mock.Store{ErrQuery: errors.New("query error")}}, 100)
+
+		_, err := provider.CheckAllVaultsConsistency()
+		require.EqualError(t, err, "failed to get vaults: query error")
+	})
+}
+
+type failingGetStore struct {
+	storage.Store
+	errGet error
+}
+
+func (s *failingGetStore) Get(string) ([]byte, error) {
+	return nil, s.errGet
+}
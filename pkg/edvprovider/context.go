@@ -0,0 +1,198 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"context"
+	"io"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// OpenStoreWithContext opens a store like OpenStore, and returns it with the given context (see Store.WithContext).
+func (c *Provider) OpenStoreWithContext(ctx context.Context, name string) (*Store, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	store, err := c.OpenStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.WithContext(ctx), nil
+}
+
+// WithContext returns a copy of the store whose reads from the underlying store stop once ctx is done, so that
+// requests that time out or whose clients disconnect don't keep scanning mapping documents, and whose retries of
+// failed operations stop waiting (see WithStorageRetry). The reads return ctx's error.
+// Writes only check ctx before they begin. Once begun, they're finished even if ctx is done, so that documents
+// aren't left without some of their mapping documents, and tenants' usage stays accurate.
+func (c *Store) WithContext(ctx context.Context) *Store {
+	base := c.coreStore
+	if ctxStore, ok := base.(*contextStore); ok {
+		base = ctxStore.base
+	}
+
+	reads := base
+	if retrying, ok := base.(*retryingStore); ok {
+		retryingWithContext := *retrying
+		retryingWithContext.ctx = ctx
+		reads = &retryingWithContext
+	}
+
+	store := *c
+	store.coreStore = &contextStore{Store: reads, base: base, ctx: ctx}
+	store.ctx = ctx
+
+	return &store
+}
+
+// beginWrite returns ctx's error if the store's context is done. Otherwise, it returns a copy of the store without
+// its context, for the write to be done with.
+func (c *Store) beginWrite() (*Store, error) {
+	if c.ctx == nil {
+		return c, nil
+	}
+
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return c.withoutContext(), nil
+}
+
+// withoutContext returns a copy of the store without its context, for work that carries on after the request that
+// the store was opened for, such as read-repairs.
+func (c *Store) withoutContext() *Store {
+	if c.ctx == nil {
+		return c
+	}
+
+	store := *c
+	store.ctx = nil
+
+	if ctxStore, ok := c.coreStore.(*contextStore); ok {
+		store.coreStore = ctxStore.base
+	}
+
+	return &store
+}
+
+// contextStore stops reading from an underlying store once its context is done. It always implements
+// KeyCheckingStore, StreamingStore and ConditionalStore, and falls back to what Store does without them if the
+// underlying store doesn't.
+type contextStore struct {
+	// Store is the store that reads are done with, which stops retrying reads once ctx is done.
+	storage.Store
+	// base is the underlying store that writes are done with.
+	base storage.Store
+	ctx  context.Context
+}
+
+func (s *contextStore) Put(key string, value []byte, tags ...storage.Tag) error {
+	return s.base.Put(key, value, tags...)
+}
+
+func (s *contextStore) Get(key string) ([]byte, error) {
+	if err := s.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return s.Store.Get(key)
+}
+
+func (s *contextStore) GetTags(key string) ([]storage.Tag, error) {
+	if err := s.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return s.Store.GetTags(key)
+}
+
+func (s *contextStore) GetBulk(keys ...string) ([][]byte, error) {
+	if err := s.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return s.Store.GetBulk(keys...)
+}
+
+func (s *contextStore) Query(expression string, options ...storage.QueryOption) (storage.Iterator, error) {
+	if err := s.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	iterator, err := s.Store.Query(expression, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &contextIterator{Iterator: iterator, ctx: s.ctx}, nil
+}
+
+func (s *contextStore) Delete(key string) error {
+	return s.base.Delete(key)
+}
+
+func (s *contextStore) Batch(operations []storage.Operation) error {
+	return s.base.Batch(operations)
+}
+
+func (s *contextStore) Flush() error {
+	return s.base.Flush()
+}
+
+func (s *contextStore) Close() error {
+	return s.base.Close()
+}
+
+// BatchIf implements ConditionalStore.
+func (s *contextStore) BatchIf(expected map[string][]byte, operations []storage.Operation) (bool, error) {
+	return batchIf(s.base, expected, operations)
+}
+
+// Exists implements KeyCheckingStore.
+func (s *contextStore) Exists(key string) (bool, error) {
+	if err := s.ctx.Err(); err != nil {
+		return false, err
+	}
+
+	if keyCheckingStore, ok := s.Store.(KeyCheckingStore); ok {
+		return keyCheckingStore.Exists(key)
+	}
+
+	return existsByTags(s.Store, key)
+}
+
+// GetStream implements StreamingStore.
+func (s *contextStore) GetStream(key string) (io.ReadCloser, error) {
+	if err := s.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if streamingStore, ok := s.Store.(StreamingStore); ok {
+		return streamingStore.GetStream(key)
+	}
+
+	return streamFromValue(s.Store, key)
+}
+
+// contextIterator stops iterating once its context is done, so that loops over the entries of a query, such as the
+// ones over mapping documents, stop with ctx's error.
+type contextIterator struct {
+	storage.Iterator
+	ctx context.Context
+}
+
+func (i *contextIterator) Next() (bool, error) {
+	if err := i.ctx.Err(); err != nil {
+		return false, err
+	}
+
+	return i.Iterator.Next()
+}
@@ -0,0 +1,189 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestProvider_OpenStoreWithContext(t *testing.T) {
+	t.Run("Context already done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := NewProvider(mem.NewProvider(), 100).OpenStoreWithContext(ctx, testVaultID)
+		require.True(t, errors.Is(err, context.Canceled))
+	})
+	t.Run("Reads stop once the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		store, err := NewProvider(mem.NewProvider(), 100).OpenStoreWithContext(ctx, testVaultID)
+		require.NoError(t, err)
+
+		putDocuments(t, store)
+
+		docs, err := store.Query(&models.Query{Has: testIndexName2})
+		require.NoError(t, err)
+		require.Len(t, docs, 2)
+
+		cancel()
+
+		_, err = store.Get(testDocID1)
+		require.True(t, errors.Is(err, context.Canceled))
+
+		_, err = store.Query(&models.Query{Has: testIndexName2})
+		require.True(t, errors.Is(err, context.Canceled))
+
+		_, err = store.Exists(testDocID1)
+		require.True(t, errors.Is(err, context.Canceled))
+
+		_, err = store.GetStream(testDocID1)
+		require.True(t, errors.Is(err, context.Canceled))
+	})
+	t.Run("Iterating over mapping documents stops once the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		coreProvider := &cancelingProvider{Provider: mem.NewProvider(), cancel: cancel}
+
+		store, err := NewProvider(coreProvider, 100).OpenStoreWithContext(ctx, testVaultID)
+		require.NoError(t, err)
+
+		putDocuments(t, store)
+
+		coreProvider.cancelOnNext = true
+
+		_, err = store.QueryWithDeadline(&models.Query{Has: testIndexName2}, "", time.Time{})
+		require.True(t, errors.Is(err, context.Canceled))
+	})
+	t.Run("Writes check the context before they begin", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		provider := NewProvider(mem.NewProvider(), 100)
+
+		store, err := provider.OpenStoreWithContext(ctx, testVaultID)
+		require.NoError(t, err)
+
+		putDocuments(t, store)
+
+		cancel()
+
+		err = store.Put(buildEncryptedDoc(testDocID3, models.IndexedAttributeCollection{}))
+		require.True(t, errors.Is(err, context.Canceled))
+
+		err = store.Delete(testDocID1)
+		require.True(t, errors.Is(err, context.Canceled))
+
+		store, err = provider.OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		exists, err := store.Exists(testDocID1)
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		exists, err = store.Exists(testDocID3)
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+	t.Run("Writes are done without the context", func(t *testing.T) {
+		store, err := NewProvider(mem.NewProvider(), 100).OpenStoreWithContext(context.Background(), testVaultID)
+		require.NoError(t, err)
+
+		writeStore, err := store.beginWrite()
+		require.NoError(t, err)
+		require.Nil(t, writeStore.ctx)
+
+		_, ok := writeStore.coreStore.(*contextStore)
+		require.False(t, ok)
+	})
+	t.Run("Retries stop waiting once the context is done", func(t *testing.T) {
+		coreProvider := &flakyProvider{Provider: mem.NewProvider(), err: syscall.ECONNRESET}
+
+		provider := NewProvider(coreProvider, 100, WithStorageRetry(StorageRetry{
+			Read: StorageRetryPolicy{MaxRetries: 1, Backoff: time.Hour},
+		}))
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		store, err := provider.OpenStoreWithContext(ctx, testVaultID)
+		require.NoError(t, err)
+
+		coreProvider.failures = 2
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+		}()
+
+		_, err = store.Get(testDocID1)
+		require.True(t, errors.Is(err, syscall.ECONNRESET))
+		require.Equal(t, 2, coreProvider.calls)
+	})
+}
+
+func putDocuments(t *testing.T, store *Store) {
+	t.Helper()
+
+	for _, docID := range []string{testDocID1, testDocID2} {
+		err := store.Put(buildEncryptedDoc(docID, models.IndexedAttributeCollection{
+			IndexedAttributes: []models.IndexedAttribute{{Name: testIndexName2, Value: docID}},
+		}))
+		require.NoError(t, err)
+	}
+}
+
+// cancelingProvider cancels a context during the first iteration over the results of a query of its stores, once
+// cancelOnNext is set.
+type cancelingProvider struct {
+	storage.Provider
+	cancel       context.CancelFunc
+	cancelOnNext bool
+}
+
+func (p *cancelingProvider) OpenStore(name string) (storage.Store, error) {
+	store, err := p.Provider.OpenStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cancelingStore{Store: store, provider: p}, nil
+}
+
+type cancelingStore struct {
+	storage.Store
+	provider *cancelingProvider
+}
+
+func (s *cancelingStore) Query(expression string, options ...storage.QueryOption) (storage.Iterator, error) {
+	iterator, err := s.Store.Query(expression, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cancelingIterator{Iterator: iterator, provider: s.provider}, nil
+}
+
+type cancelingIterator struct {
+	storage.Iterator
+	provider *cancelingProvider
+}
+
+func (i *cancelingIterator) Next() (bool, error) {
+	if i.provider.cancelOnNext {
+		i.provider.cancel()
+	}
+
+	return i.Iterator.Next()
+}
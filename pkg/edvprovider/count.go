@@ -0,0 +1,101 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// countedDocument is the part of an encrypted document that's needed to tell whether it matches a query.
+// Its JWE is left out, so that counting doesn't copy it.
+type countedDocument struct {
+	IndexedAttributeCollections []models.IndexedAttributeCollection `json:"indexed"`
+}
+
+// Count returns the number of documents that match the given query, without returning the documents.
+// A "has" query is counted from its mapping documents (or the attribute cache) alone, so none of the encrypted
+// documents are read. Mapping documents only have the names of the attributes they index, though, so the documents
+// found by an "index + equals" or "index + operator" query, or by a query restricted to an HMAC key ID, still have
+// to be read from the database pageSize at a time to check their attributes. Only their indexed attributes are
+// unmarshalled, and none of them are kept in memory.
+// A "has" query counted from mapping documents alone may include documents whose mapping documents are stale, until
+// they're repaired.
+func (c *Store) Count(query *models.Query) (int, error) {
+	matcher, err := ParseQueryOperator(query)
+	if err != nil {
+		return 0, err
+	}
+
+	documentIDs, err := c.queryDocumentIDs(query, queryIndexName(query), c.queryPageSize(query), "")
+	if err != nil {
+		return 0, err
+	}
+
+	if !filtersValues(query) {
+		return len(documentIDs), nil
+	}
+
+	pageSize := int(c.queryPageSize(query))
+
+	if pageSize <= 0 {
+		pageSize = len(documentIDs)
+	}
+
+	var count int
+
+	for start := 0; start < len(documentIDs); start += pageSize {
+		end := start + pageSize
+		if end > len(documentIDs) {
+			end = len(documentIDs)
+		}
+
+		matching, errCount := c.countMatchingDocuments(query, matcher, documentIDs[start:end])
+		if errCount != nil {
+			return 0, errCount
+		}
+
+		count += matching
+	}
+
+	return count, nil
+}
+
+// countMatchingDocuments returns how many of the documents with the given IDs match the given query. Documents that
+// no longer exist aren't counted.
+func (c *Store) countMatchingDocuments(query *models.Query, matcher QueryMatcher, documentIDs []string) (int, error) {
+	documentsBytes, err := c.coreStore.GetBulk(documentIDs...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get encrypted documents containing matching attribute names: %w", err)
+	}
+
+	var count int
+
+	for i, documentBytes := range documentsBytes {
+		if documentBytes == nil {
+			continue
+		}
+
+		var document countedDocument
+
+		err = json.Unmarshal(documentBytes, &document)
+		if err != nil {
+			return 0, fmt.Errorf("failed to unmarshal matching encrypted document with ID %s: %w",
+				documentIDs[i], err)
+		}
+
+		if documentMatchesQuery(models.EncryptedDocument{
+			IndexedAttributeCollections: document.IndexedAttributeCollections,
+		}, query, matcher) {
+			count++
+		}
+	}
+
+	return count, nil
+}
@@ -0,0 +1,82 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestStore_Count(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store := createVaultWithDocuments(t, NewProvider(mem.NewProvider(), 100))
+
+		for _, test := range []struct {
+			query *models.Query
+			count int
+		}{
+			{query: &models.Query{Has: testIndexName2}, count: 2},
+			{query: &models.Query{Has: testIndexName3}, count: 0},
+			{query: &models.Query{Name: testIndexName2, Value: testDocID1}, count: 1},
+			{query: &models.Query{Name: testIndexName2, Value: testDocID1, PageSize: 1}, count: 1},
+			{query: &models.Query{Name: testIndexName2, Value: "value"}, count: 0},
+			{query: &models.Query{Has: testIndexName2, HMACKeyID: "hmacKeyID"}, count: 0},
+		} {
+			count, err := store.Count(test.query)
+			require.NoError(t, err)
+			require.Equal(t, test.count, count)
+		}
+	})
+	t.Run("Has queries don't read the documents", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+		store := createVaultWithDocuments(t, provider)
+
+		store.coreStore = &getBulkFailingStore{Store: store.coreStore}
+
+		count, err := store.Count(&models.Query{Has: testIndexName2})
+		require.NoError(t, err)
+		require.Equal(t, 2, count)
+
+		_, err = store.Count(&models.Query{Name: testIndexName2, Value: testDocID1})
+		require.EqualError(t, err,
+			"failed to get encrypted documents containing matching attribute names: get bulk error")
+	})
+	t.Run("Deleted documents aren't counted", func(t *testing.T) {
+		store := createVaultWithDocuments(t, NewProvider(mem.NewProvider(), 100))
+
+		// Leave the mapping documents of the deleted document behind.
+		require.NoError(t, store.coreStore.Delete(testDocID1))
+
+		count, err := store.Count(&models.Query{Name: testIndexName2, Value: testDocID1})
+		require.NoError(t, err)
+		require.Zero(t, count)
+	})
+	t.Run("Fail to unmarshal document", func(t *testing.T) {
+		store := createVaultWithDocuments(t, NewProvider(mem.NewProvider(), 100))
+
+		require.NoError(t, store.coreStore.Put(testDocID1, []byte("{")))
+
+		_, err := store.Count(&models.Query{Name: testIndexName2, Value: testDocID1})
+		require.EqualError(t, err, "failed to unmarshal matching encrypted document with ID "+testDocID1+
+			": unexpected end of JSON input")
+	})
+}
+
+// getBulkFailingStore is a store that fails to get documents in bulk.
+type getBulkFailingStore struct {
+	storage.Store
+}
+
+func (s *getBulkFailingStore) GetBulk(...string) ([][]byte, error) {
+	return nil, errors.New("get bulk error")
+}
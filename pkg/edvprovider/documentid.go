@@ -0,0 +1,101 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+
+	"github.com/trustbloc/edv/pkg/edvutils"
+)
+
+const (
+	// Base58128BitDocumentIDPolicy only accepts document IDs that are base58-encoded 128-bit values, as required by
+	// the EDV specification. It's the default.
+	Base58128BitDocumentIDPolicy = "base58-128"
+	// UUIDDocumentIDPolicy only accepts document IDs that are UUIDs.
+	UUIDDocumentIDPolicy = "uuid"
+	// DIDURLDocumentIDPolicy only accepts document IDs that are DID URLs, such as did:example:123#document-1.
+	DIDURLDocumentIDPolicy = "did-url"
+
+	// encodedDocumentIDTagValuePrefix marks the tag values that hold an encoded document ID.
+	encodedDocumentIDTagValuePrefix = "b64."
+)
+
+// DocumentIDValidator checks that the ID of an encrypted document is one that the EDV server accepts.
+type DocumentIDValidator interface {
+	// ValidateDocumentID returns an error if the given document ID isn't accepted.
+	ValidateDocumentID(id string) error
+}
+
+// DocumentIDValidatorFunc is a function that implements DocumentIDValidator.
+type DocumentIDValidatorFunc func(id string) error
+
+// ValidateDocumentID calls f.
+func (f DocumentIDValidatorFunc) ValidateDocumentID(id string) error {
+	return f(id)
+}
+
+// DocumentIDPolicyValidator returns the DocumentIDValidator for the given document ID policy, which must be one of
+// Base58128BitDocumentIDPolicy, UUIDDocumentIDPolicy or DIDURLDocumentIDPolicy.
+func DocumentIDPolicyValidator(policy string) (DocumentIDValidator, error) {
+	switch policy {
+	case Base58128BitDocumentIDPolicy:
+		return DocumentIDValidatorFunc(edvutils.CheckIfBase58Encoded128BitValue), nil
+	case UUIDDocumentIDPolicy:
+		return DocumentIDValidatorFunc(edvutils.CheckIfUUID), nil
+	case DIDURLDocumentIDPolicy:
+		return DocumentIDValidatorFunc(edvutils.CheckIfDIDURL), nil
+	default:
+		return nil, fmt.Errorf("invalid document ID policy %q: must be one of %s, %s, %s", policy,
+			Base58128BitDocumentIDPolicy, UUIDDocumentIDPolicy, DIDURLDocumentIDPolicy)
+	}
+}
+
+// WithDocumentIDValidator replaces the check that the IDs of new and updated documents are base58-encoded 128-bit
+// values with the given validator, so that deployments that mint other kinds of document IDs, such as DID URLs,
+// can use them. Vault IDs are still generated by the EDV server and aren't affected.
+func WithDocumentIDValidator(validator DocumentIDValidator) Option {
+	return func(p *Provider) {
+		p.documentIDValidator = validator
+	}
+}
+
+// ValidateDocumentID checks the given document ID with the provider's DocumentIDValidator.
+func (c *Provider) ValidateDocumentID(id string) error {
+	if c.documentIDValidator == nil {
+		return c.checkIfBase58Encoded128BitValue(id)
+	}
+
+	return c.documentIDValidator.ValidateDocumentID(id)
+}
+
+// documentIDTag returns a tag with the given name whose value is the given document ID.
+func documentIDTag(name, documentID string) storage.Tag {
+	return storage.Tag{Name: name, Value: documentIDTagValue(documentID)}
+}
+
+// documentIDQuery returns the query expression for the entries with a tag with the given name whose value is the
+// given document ID.
+func documentIDQuery(tagName, documentID string) string {
+	return fmt.Sprintf("%s:%s", tagName, documentIDTagValue(documentID))
+}
+
+// documentIDTagValue returns the tag value for the given document ID. Tag values can't contain colons, which DID URLs
+// do, so document IDs with a colon are base64url-encoded and prefixed with encodedDocumentIDTagValuePrefix. So are
+// document IDs that already start with the prefix, so that no two document IDs get the same tag value. Base58 and
+// UUID document IDs are used as they are.
+func documentIDTagValue(documentID string) string {
+	if !strings.Contains(documentID, ":") && !strings.HasPrefix(documentID, encodedDocumentIDTagValuePrefix) {
+		return documentID
+	}
+
+	return encodedDocumentIDTagValuePrefix + base64.RawURLEncoding.EncodeToString([]byte(documentID))
+}
@@ -0,0 +1,98 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const testDIDURLDocID = "did:example:123#document-1"
+
+func TestDocumentIDPolicyValidator(t *testing.T) {
+	for policy, expected := range map[string]struct {
+		validID string
+		err     error
+	}{
+		Base58128BitDocumentIDPolicy: {validID: testDocID1, err: messages.ErrNotBase58Encoded},
+		UUIDDocumentIDPolicy:         {validID: "0b4dc4e8-0d9f-4b8a-9b4e-0f0e5b4bd7c6", err: messages.ErrNotUUID},
+		DIDURLDocumentIDPolicy:       {validID: testDIDURLDocID, err: messages.ErrNotDIDURL},
+	} {
+		validator, err := DocumentIDPolicyValidator(policy)
+		require.NoError(t, err)
+		require.NoError(t, validator.ValidateDocumentID(expected.validID), policy)
+		require.Equal(t, expected.err, validator.ValidateDocumentID("not a valid ID!"), policy)
+	}
+
+	_, err := DocumentIDPolicyValidator("ulid")
+	require.EqualError(t, err, `invalid document ID policy "ulid": must be one of base58-128, uuid, did-url`)
+}
+
+func TestProvider_ValidateDocumentID(t *testing.T) {
+	t.Run("Base58-encoded 128-bit IDs are required by default", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+
+		require.NoError(t, provider.ValidateDocumentID(testDocID1))
+		require.Equal(t, messages.ErrNotBase58Encoded, provider.ValidateDocumentID(testDIDURLDocID))
+	})
+	t.Run("Custom validator", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100, WithDocumentIDValidator(DocumentIDValidatorFunc(
+			func(id string) error {
+				if id != testDocID2 {
+					return errors.New("unknown document ID")
+				}
+
+				return nil
+			})))
+
+		require.NoError(t, provider.ValidateDocumentID(testDocID2))
+		require.EqualError(t, provider.ValidateDocumentID(testDocID1), "unknown document ID")
+	})
+}
+
+func TestStore_DIDURLDocumentIDs(t *testing.T) {
+	store, err := NewProvider(mem.NewProvider(), 100).OpenStore(testVaultID)
+	require.NoError(t, err)
+
+	document := createTestDocuments(t, testDIDURLDocID)[0]
+	document.IndexedAttributeCollections[0].IndexedAttributes = []models.IndexedAttribute{
+		{Name: testIndexName2, Value: "value", Unique: true},
+	}
+
+	require.NoError(t, store.Put(document))
+	requireQueryMatches(t, store, &models.Query{Name: testIndexName2, Value: "value"}, testDIDURLDocID)
+
+	document.Sequence++
+	document.IndexedAttributeCollections[0].IndexedAttributes = []models.IndexedAttribute{
+		{Name: testIndexName3, Value: "value", Unique: true},
+	}
+
+	require.NoError(t, store.Update(document))
+	requireQueryMatches(t, store, &models.Query{Has: testIndexName2})
+	requireQueryMatches(t, store, &models.Query{Has: testIndexName3}, testDIDURLDocID)
+
+	require.NoError(t, store.Delete(testDIDURLDocID))
+	requireQueryMatches(t, store, &models.Query{Has: testIndexName3})
+
+	mappingDocuments, err := store.getMappingDocuments(MappingDocumentTagName)
+	require.NoError(t, err)
+	require.Empty(t, mappingDocuments)
+}
+
+func TestDocumentIDTagValue(t *testing.T) {
+	require.Equal(t, testDocID1, documentIDTagValue(testDocID1))
+	require.Equal(t, "0b4dc4e8-0d9f-4b8a-9b4e-0f0e5b4bd7c6", documentIDTagValue("0b4dc4e8-0d9f-4b8a-9b4e-0f0e5b4bd7c6"))
+	require.Equal(t, "b64.ZGlkOmV4YW1wbGU6MTIzI2RvY3VtZW50LTE", documentIDTagValue(testDIDURLDocID))
+	require.NotEqual(t, documentIDTagValue(testDIDURLDocID),
+		documentIDTagValue(documentIDTagValue(testDIDURLDocID)))
+}
@@ -0,0 +1,61 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"sort"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// ListDocuments returns the IDs and sequences of the encrypted documents in the store, sorted by sequence and then
+// by ID. If afterSequence is nil, then the list starts at the first document. Otherwise, only the documents with a
+// greater sequence are listed, along with the documents with the same sequence and a greater ID than afterID if
+// afterID isn't empty, so that the sequence and ID of the last document in a list can be used to continue it.
+// At most limit documents are listed, or all of them if limit is 0.
+// Only the tags of the documents are read, not the documents themselves. Mapping documents and tombstones don't
+// have an EncryptedDocumentSequenceTagName tag, so they're never listed, and neither are documents stored before that
+// tag was introduced until they're next updated.
+func (c *Store) ListDocuments(afterSequence *uint64, afterID string, limit int) (*models.DocumentList, error) {
+	documentSequences, err := c.DocumentSequences()
+	if err != nil {
+		return nil, err
+	}
+
+	list := &models.DocumentList{Documents: []models.DocumentListEntry{}}
+
+	for docID, sequence := range documentSequences {
+		if afterSequence != nil && !documentIsAfter(docID, sequence, *afterSequence, afterID) {
+			continue
+		}
+
+		list.Documents = append(list.Documents, models.DocumentListEntry{ID: docID, Sequence: sequence})
+	}
+
+	sort.Slice(list.Documents, func(i, j int) bool {
+		if list.Documents[i].Sequence != list.Documents[j].Sequence {
+			return list.Documents[i].Sequence < list.Documents[j].Sequence
+		}
+
+		return list.Documents[i].ID < list.Documents[j].ID
+	})
+
+	if limit > 0 && len(list.Documents) > limit {
+		list.Documents = list.Documents[:limit]
+		list.More = true
+	}
+
+	return list, nil
+}
+
+func documentIsAfter(docID string, sequence, afterSequence uint64, afterID string) bool {
+	if sequence != afterSequence {
+		return sequence > afterSequence
+	}
+
+	return afterID != "" && docID > afterID
+}
@@ -0,0 +1,87 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestStore_ListDocuments(t *testing.T) {
+	t.Run("Documents are sorted by sequence and then by ID", func(t *testing.T) {
+		store := createVaultWithDocuments(t, NewProvider(mem.NewProvider(), 100))
+
+		list, err := store.ListDocuments(nil, "", 0)
+		require.NoError(t, err)
+		require.Equal(t, &models.DocumentList{Documents: []models.DocumentListEntry{
+			{ID: testDocID2, Sequence: 0}, {ID: testDocID1, Sequence: 0},
+		}}, list)
+
+		updatedDoc := buildEncryptedDoc(testDocID2, models.IndexedAttributeCollection{
+			IndexedAttributes: []models.IndexedAttribute{{Name: testIndexName2, Value: testDocID2}},
+		})
+		updatedDoc.Sequence = 1
+
+		require.NoError(t, store.Update(updatedDoc))
+
+		list, err = store.ListDocuments(nil, "", 0)
+		require.NoError(t, err)
+		require.Equal(t, &models.DocumentList{Documents: []models.DocumentListEntry{
+			{ID: testDocID1, Sequence: 0}, {ID: testDocID2, Sequence: 1},
+		}}, list)
+	})
+	t.Run("Only documents after the given sequence are listed", func(t *testing.T) {
+		store := createVaultWithDocuments(t, NewProvider(mem.NewProvider(), 100))
+
+		afterSequence := uint64(0)
+
+		list, err := store.ListDocuments(&afterSequence, "", 0)
+		require.NoError(t, err)
+		require.Empty(t, list.Documents)
+		require.False(t, list.More)
+	})
+	t.Run("A limited list is continued from its last document", func(t *testing.T) {
+		store := createVaultWithDocuments(t, NewProvider(mem.NewProvider(), 100))
+
+		list, err := store.ListDocuments(nil, "", 1)
+		require.NoError(t, err)
+		require.Equal(t, &models.DocumentList{
+			Documents: []models.DocumentListEntry{{ID: testDocID2, Sequence: 0}},
+			More:      true,
+		}, list)
+
+		list, err = store.ListDocuments(&list.Documents[0].Sequence, list.Documents[0].ID, 1)
+		require.NoError(t, err)
+		require.Equal(t, &models.DocumentList{
+			Documents: []models.DocumentListEntry{{ID: testDocID1, Sequence: 0}},
+		}, list)
+	})
+	t.Run("Mapping documents and tombstones aren't listed", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100, WithTombstoneRetention(time.Hour))
+		store := createVaultWithDocuments(t, provider)
+
+		require.NoError(t, store.Delete(testDocID1))
+
+		list, err := store.ListDocuments(nil, "", 0)
+		require.NoError(t, err)
+		require.Equal(t, []models.DocumentListEntry{{ID: testDocID2, Sequence: 0}}, list.Documents)
+	})
+	t.Run("Fail to query documents", func(t *testing.T) {
+		store := &Store{coreStore: &mock.Store{ErrQuery: errors.New("query error")}, retrievalPageSize: 100}
+
+		list, err := store.ListDocuments(nil, "", 0)
+		require.EqualError(t, err, "failed to query encrypted documents: query error")
+		require.Nil(t, list)
+	})
+}
@@ -7,15 +7,21 @@ SPDX-License-Identifier: Apache-2.0
 package edvprovider
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/hyperledger/aries-framework-go/spi/storage"
-	"github.com/trustbloc/edge-core/pkg/log"
 
 	"github.com/trustbloc/edv/pkg/edvutils"
+	"github.com/trustbloc/edv/pkg/logging"
 	"github.com/trustbloc/edv/pkg/restapi/messages"
 	"github.com/trustbloc/edv/pkg/restapi/models"
 )
@@ -34,28 +40,53 @@ const (
 	// MappingDocumentMatchingEncryptedDocIDTagName is the tag name used for querying mapping documents
 	// based on what encrypted document they're for.
 	MappingDocumentMatchingEncryptedDocIDTagName = "MatchingEncryptedDocumentID"
+	// EncryptedDocumentSequenceTagName is the tag name used for listing the encrypted documents in a vault.
+	// The tag value is the document's sequence.
+	// Documents stored before this tag was introduced don't have it until they're next updated.
+	EncryptedDocumentSequenceTagName = "Sequence"
+	// TombstoneTagName is the tag name used for listing the tombstones of deleted documents in a vault.
+	// The tag value is the time the document was deleted, in seconds since the Unix epoch.
+	TombstoneTagName = "Tombstone"
+
+	tombstoneKeyPrefix = "tombstone_"
 )
 
-var logger = log.New(logModuleName)
+var logger = logging.New(logModuleName)
 
 // errIndexNameAndValueAlreadyDeclaredUnique is returned when an attempt is made to store a document with an
-// index name and value that are defined as unique in another document already. Note that depending
-// on the provider implementation, it may not be guaranteed that uniqueness can always be maintained.
-var errIndexNameAndValueAlreadyDeclaredUnique = errors.New("unable to store document since it contains an " +
-	"index name and value that are already declared as unique in an existing document")
+// index name and value that are defined as unique in another document already. Note that uniqueness is only
+// guaranteed for concurrent writes if unique constraints are enabled (see WithUniqueConstraints).
+var errIndexNameAndValueAlreadyDeclaredUnique = fmt.Errorf("%w: unable to store document since it contains an "+
+	"index name and value that are already declared as unique in an existing document",
+	messages.ErrUniqueIndexConflict)
 
 // errIndexNameAndValueCannotBeUnique is returned when an attempt is made to store a document with an
 // index name and value that are defined as unique in the new would-be document, but another document already has
 // an identical index name + value pair defined so uniqueness cannot be achieved. Note that depending
 // on the provider implementation, it may not be guaranteed that uniqueness can always be maintained.
-var errIndexNameAndValueCannotBeUnique = errors.New("unable to store document since it contains an " +
-	"index name and value that are declared as unique, but another document already has an " +
-	"identical index name + value pair")
+var errIndexNameAndValueCannotBeUnique = fmt.Errorf("%w: unable to store document since it contains an "+
+	"index name and value that are declared as unique, but another document already has an "+
+	"identical index name + value pair", messages.ErrUniqueIndexConflict)
 
 type indexMappingDocument struct {
-	AttributeName          string `json:"attributeName"`
-	MatchingEncryptedDocID string `json:"matchingEncryptedDocID"`
-	MappingDocumentName    string `json:"mappingDocumentName"`
+	AttributeName          string `json:"attributeName" cbor:"1,keyasint"`
+	MatchingEncryptedDocID string `json:"matchingEncryptedDocID" cbor:"2,keyasint"`
+	MappingDocumentName    string `json:"mappingDocumentName" cbor:"3,keyasint"`
+	// HMACKeyID is the ID of the HMAC key of the indexed attribute collection that the attribute is in.
+	// Mapping documents created before it was recorded, or by repairs, don't have it.
+	HMACKeyID string `json:"hmacKeyID,omitempty" cbor:"4,keyasint,omitempty"`
+}
+
+// tombstoneRecord is what's stored in place of a document deleted in tombstone mode.
+// The deleted document is kept so that it can be restored.
+type tombstoneRecord struct {
+	models.Tombstone
+	Document json.RawMessage `json:"document"`
+}
+
+// storeDeleter is implemented by storage providers that can delete the underlying database of a store.
+type storeDeleter interface {
+	DeleteStore(name string) error
 }
 
 type (
@@ -70,22 +101,76 @@ type Provider struct {
 	retrievalPageSize               uint
 	checkIfBase58Encoded128BitValue checkIfBase58Encoded128BitValueFunc
 	base58Encoded128BitToUUID       base58Encoded128BitToUUIDFunc
+	documentLocks                   *documentLocks
+	tombstoneRetention              time.Duration
+	batchRetry                      *batchRetry
+	storageRetry                    *StorageRetry
+	storageRetrier                  *storageRetrier
+	maxMappingDocuments             uint
+	attributeCache                  AttributeCache
+	readRepairer                    *readRepairer
+	indexCorruptionAlerts           *indexCorruptionAlerts
+	uniqueIndexRegistries           *sync.Map
+	outbox                          *outbox
+	metrics                         Metrics
+	tenancy                         *tenancy
+	vaultLimits                     *vaultLimits
+	encryption                      *encryption
+	documentIDValidator             DocumentIDValidator
+	mappingDocumentCodec            MappingDocumentCodec
+	revisionHistory                 bool
+	uniqueConstraints               bool
+	indexingWorkers                 uint
+	background                      backgroundWork
+	logger                          logging.Logger
+}
+
+// Option configures the provider.
+type Option func(p *Provider)
+
+// WithTombstoneRetention enables tombstone mode. Deleted documents are replaced with tombstones, which can be
+// restored until the given retention window has passed and are then removed by PurgeTombstones.
+// If the retention window is 0, then deleted documents are removed immediately.
+func WithTombstoneRetention(retention time.Duration) Option {
+	return func(p *Provider) {
+		p.tombstoneRetention = retention
+	}
 }
 
 // NewProvider instantiates a new Provider. retrievalPageSize is used by ariesProvider for query paging.
 // It may be ignored if ariesProvider doesn't support paging.
-func NewProvider(ariesProvider storage.Provider, retrievalPageSize uint) *Provider {
-	return &Provider{
+func NewProvider(ariesProvider storage.Provider, retrievalPageSize uint, opts ...Option) *Provider {
+	provider := &Provider{
 		coreProvider:                    ariesProvider,
 		retrievalPageSize:               retrievalPageSize,
 		checkIfBase58Encoded128BitValue: edvutils.CheckIfBase58Encoded128BitValue,
 		base58Encoded128BitToUUID:       edvutils.Base58Encoded128BitToUUID,
+		documentLocks:                   newDocumentLocks(),
+		uniqueIndexRegistries:           &sync.Map{},
+	}
+
+	for _, opt := range opts {
+		opt(provider)
 	}
+
+	provider.retryStorage()
+
+	return provider
 }
 
 // StoreExists returns a boolean indicating whether a given store has ever been created.
 // It checks to see if the underlying database exists via the GetStoreConfig method.
 func (c *Provider) StoreExists(name string) (bool, error) {
+	start := time.Now()
+
+	exists, err := c.storeExists(name)
+
+	c.recordProviderOperation(StoreExistsOperation, start, exists, err)
+
+	return exists, err
+}
+
+func (c *Provider) storeExists(name string) (bool, error) {
 	storeName, err := c.determineStoreNameToUse(name)
 	if err != nil {
 		return false, fmt.Errorf("failed to determine store name to use: %w", err)
@@ -106,7 +191,17 @@ func (c *Provider) StoreExists(name string) (bool, error) {
 // OpenStore opens a store and returns it. The name is converted to a UUID if it is a base58-encoded
 // 128-bit value.
 func (c *Provider) OpenStore(name string) (*Store, error) {
-	storeName, err := c.determineStoreNameToUse(name)
+	start := time.Now()
+
+	store, err := c.openStore(name)
+
+	c.recordProviderOperation(OpenStoreOperation, start, true, err)
+
+	return store, err
+}
+
+func (c *Provider) openStore(name string) (*Store, error) {
+	storeName, tenantID, err := c.storeNameAndTenant(name)
 	if err != nil {
 		return nil, fmt.Errorf("failed to determine store name to use: %w", err)
 	}
@@ -116,542 +211,2237 @@ func (c *Provider) OpenStore(name string) (*Store, error) {
 		return nil, err
 	}
 
-	return &Store{coreStore: coreStore, name: name, retrievalPageSize: c.retrievalPageSize}, nil
+	return &Store{
+		coreStore: coreStore, name: name, coreStoreName: storeName, namespace: newVaultNamespace(storeName),
+		retrievalPageSize: c.retrievalPageSize, documentLocks: c.documentLocks, tombstoneRetention: c.tombstoneRetention,
+		batchRetry: c.batchRetry, maxMappingDocuments: c.maxMappingDocuments, attributeCache: c.attributeCache,
+		readRepairer: c.readRepairer, indexCorruptionAlerts: c.indexCorruptionAlerts,
+		uniqueIndexRegistries: c.uniqueIndexRegistries, outbox: c.outbox, metrics: c.metrics, tenantID: tenantID,
+		tenancy: c.tenancy, vaultLimits: c.vaultLimits, encryption: c.encryption,
+		mappingDocumentCodec: c.mappingDocumentCodec, revisionHistory: c.revisionHistory,
+		uniqueConstraints: c.uniqueConstraints, indexingWorkers: c.indexingWorkers, logger: c.logger,
+	}, nil
 }
 
-// SetStoreConfig sets the store configuration in the underlying core provider.
-func (c *Provider) SetStoreConfig(name string, config storage.StoreConfiguration) error {
-	storeName, err := c.determineStoreNameToUse(name)
+// CreateVaultStore creates the store for a new vault, configured with the tags used for encrypted documents
+// and their mapping documents, along with its empty unique index registry.
+func (c *Provider) CreateVaultStore(vaultID string) error {
+	store, err := c.OpenStore(vaultID)
 	if err != nil {
-		return fmt.Errorf("failed to determine store name to use: %w", err)
+		return fmt.Errorf("failed to open store for vault: %w", err)
 	}
 
-	return c.coreProvider.SetStoreConfig(storeName, config)
-}
+	err = c.SetStoreConfig(vaultID, vaultStoreConfiguration())
+	if err != nil {
+		return fmt.Errorf("failed to set store config: %w", err)
+	}
 
-// Store represents an EDV store.
-// It wraps an Aries store with additional functionality that's needed for EDV operations.
-type Store struct {
-	coreStore         storage.Store
-	name              string
-	retrievalPageSize uint
-}
+	err = store.coreStore.Put(uniqueIndexRegistryKey, []byte("{}"))
+	if err != nil {
+		return fmt.Errorf("failed to store unique index registry marker: %w", err)
+	}
 
-// Put stores the given document.
-// Mapping documents are also created and stored in order to allow for encrypted indices to work.
-func (c *Store) Put(document models.EncryptedDocument) error {
-	err := c.validateNewDocIndexAttribute(document)
+	err = store.coreStore.Put(changeTagsKey, []byte("{}"))
 	if err != nil {
-		return fmt.Errorf("failure during encrypted document validation: %w", err)
+		return fmt.Errorf("failed to store change tags marker: %w", err)
 	}
 
-	return c.UpsertBulk([]models.EncryptedDocument{document})
+	return nil
 }
 
-// UpsertBulk stores the given documents, creating or updating them as needed.
-// TODO (#171): Address encrypted index limitations of this method.
-func (c *Store) UpsertBulk(documents []models.EncryptedDocument) error {
-	mappingDocuments := c.createMappingDocuments(documents)
+// vaultStoreConfiguration returns the configuration of the stores of vaults, with the tags used for encrypted
+// documents, their mapping documents and the other entries in a vault.
+func vaultStoreConfiguration() storage.StoreConfiguration {
+	return storage.StoreConfiguration{TagNames: []string{
+		MappingDocumentTagName,
+		MappingDocumentMatchingEncryptedDocIDTagName,
+		EncryptedDocumentSequenceTagName,
+		ChangeTagName,
+		TombstoneTagName,
+		UniqueIndexTagName,
+		OutboxTagName,
+		RevisionTagName,
+		IndexingQueueTagName,
+	}}
+}
 
-	operations := make([]storage.Operation, len(mappingDocuments)+len(documents))
+// WarmUp queries every tag used by the encrypted documents and mapping documents in the given vault, so that the
+// underlying database builds its indexes and loads them into its caches before the vault is first queried by a
+// client. It returns the number of mapping documents in the vault.
+func (c *Provider) WarmUp(vaultID string) (int, error) {
+	err := c.background.begin()
+	if err != nil {
+		return 0, err
+	}
 
-	for i := 0; i < len(mappingDocuments); i++ {
-		operations[i].Key = mappingDocuments[i].MappingDocumentName
+	defer c.background.end()
 
-		mappingDocumentBytes, errMarshal := json.Marshal(mappingDocuments[i])
-		if errMarshal != nil {
-			return fmt.Errorf("failed to marshal mapping document into bytes: %w", errMarshal)
-		}
+	exists, err := c.StoreExists(vaultID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to determine whether vault exists: %w", err)
+	}
 
-		logger.Debugf(`Creating mapping document in vault %s: Mapping document contents: %s`,
-			c.name, mappingDocumentBytes)
+	if !exists {
+		return 0, messages.ErrVaultNotFound
+	}
 
-		operations[i].Value = mappingDocumentBytes
-		operations[i].Tags = []storage.Tag{
-			{
-				Name:  MappingDocumentTagName,
-				Value: mappingDocuments[i].AttributeName,
-			},
-			{
-				Name:  MappingDocumentMatchingEncryptedDocIDTagName,
-				Value: mappingDocuments[i].MatchingEncryptedDocID,
-			},
-		}
+	store, err := c.OpenStore(vaultID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open store for vault: %w", err)
 	}
 
-	for i := len(mappingDocuments); i < len(mappingDocuments)+len(documents); i++ {
-		operations[i].Key = documents[i-len(mappingDocuments)].ID
+	var mappingDocumentCount int
 
-		documentBytes, errMarshal := json.Marshal(documents[i-len(mappingDocuments)])
-		if errMarshal != nil {
-			return fmt.Errorf("failed to marshal encrypted document %s: %w",
-				documents[i-len(mappingDocuments)].ID, errMarshal)
+	for _, tagName := range []string{
+		MappingDocumentTagName,
+		MappingDocumentMatchingEncryptedDocIDTagName,
+		EncryptedDocumentSequenceTagName,
+	} {
+		count, errCount := store.countEntries(tagName)
+		if errCount != nil {
+			return 0, fmt.Errorf("failed to query %s tag: %w", tagName, errCount)
 		}
 
-		operations[i].Value = documentBytes
-	}
-
-	err := c.coreStore.Batch(operations)
-	if err != nil {
-		return fmt.Errorf("failed to store encrypted document(s) and their "+
-			"associated mapping document(s): %w", err)
+		if tagName == MappingDocumentTagName {
+			mappingDocumentCount = count
+		}
 	}
 
-	return nil
+	return mappingDocumentCount, nil
 }
 
-// Get fetches the document associated with the given key.
-func (c *Store) Get(k string) ([]byte, error) {
-	return c.coreStore.Get(k)
+// SetStoreConfig sets the store configuration in the underlying core provider.
+func (c *Provider) SetStoreConfig(name string, config storage.StoreConfiguration) error {
+	start := time.Now()
+
+	err := c.setStoreConfig(name, config)
+
+	c.recordProviderOperation(SetStoreConfigOperation, start, true, err)
+
+	return err
 }
 
-// Update updates the given document.
-func (c *Store) Update(newDoc models.EncryptedDocument) error {
-	err := c.validateNewDocIndexAttribute(newDoc)
+func (c *Provider) setStoreConfig(name string, config storage.StoreConfiguration) error {
+	storeName, err := c.determineStoreNameToUse(name)
 	if err != nil {
-		return fmt.Errorf("failure during encrypted document validation: %w", err)
+		return fmt.Errorf("failed to determine store name to use: %w", err)
 	}
 
-	err = c.updateMappingDocuments(newDoc.ID, newDoc.IndexedAttributeCollections)
+	return c.coreProvider.SetStoreConfig(storeName, config)
+}
+
+// DeleteStore deletes the store for the given vault along with everything in it, and the vault's configuration.
+// If the underlying storage provider can delete the store's database, then it's deleted. Otherwise, every encrypted
+// document and mapping document in the store is deleted before the store is closed. The vault's data key is deleted
+// as well if encryption at rest is enabled.
+func (c *Provider) DeleteStore(vaultID string) error {
+	store, err := c.OpenStore(vaultID)
 	if err != nil {
-		return fmt.Errorf(messages.UpdateMappingDocumentFailure, newDoc.ID, err)
+		return fmt.Errorf("failed to open store for vault: %w", err)
 	}
 
-	newDocBytes, err := json.Marshal(newDoc)
+	refund, err := store.tenantRefundAll()
 	if err != nil {
 		return err
 	}
 
-	return c.coreStore.Put(newDoc.ID, newDocBytes)
-}
+	deleter, canDeleteStore := c.coreProvider.(storeDeleter)
+	if !canDeleteStore {
+		err = store.deleteAll()
+		if err != nil {
+			return err
+		}
+	}
 
-// Delete deletes the given document and its mapping document(s).
-func (c *Store) Delete(docID string) error {
-	mappingDocs, err := c.getMappingDocuments(fmt.Sprintf("%s:%s",
-		MappingDocumentMatchingEncryptedDocIDTagName, docID))
+	err = store.coreStore.Close()
 	if err != nil {
-		return fmt.Errorf("failed to get mapping documents: %w", err)
+		return fmt.Errorf("failed to close store: %w", err)
 	}
 
-	for _, mappingDoc := range mappingDocs {
-		err := c.deleteMappingDocument(mappingDoc.MappingDocumentName)
+	if canDeleteStore {
+		err = deleter.DeleteStore(store.coreStoreName)
 		if err != nil {
-			return fmt.Errorf(messages.DeleteMappingDocumentFailure, err)
+			return fmt.Errorf("failed to delete store: %w", err)
 		}
 	}
 
-	return c.coreStore.Delete(docID)
-}
+	if c.attributeCache != nil {
+		c.attributeCache.Purge(store.namespace)
+	}
 
-// Query does an EDV encrypted index query.
-// We first get the "mapping document" and then use the ID we get from that to lookup the associated encrypted document.
-// Then we check that encrypted document to see if the value matches what was specified in the query.
-// If query.Has is not blank, then we assume it's a "has" query,
-// and so any documents with an index name matching query.Has will be returned regardless of value.
-// TODO (#168): Add support for pagination (not currently in the spec).
-//  The c.retrievalPageSize parameter is passed in from the startup args and could be used with pagination.
-func (c *Store) Query(query *models.Query) ([]models.EncryptedDocument, error) {
-	// TODO (#169): Use c.retrievalPageSize to do pagination within this method to help control the maximum amount of
-	//  memory used here. Without official pagination support it won't be possible to truly cap memory usage, however.
-	var indexName string
-	if query.Has != "" {
-		indexName = query.Has
-	} else {
-		indexName = query.Name
+	if c.uniqueIndexRegistries != nil {
+		c.uniqueIndexRegistries.Delete(store.namespace)
 	}
 
-	mappingDocuments, err := c.getMappingDocuments(fmt.Sprintf("%s:%s",
-		MappingDocumentTagName, indexName))
+	configStore, err := c.coreProvider.OpenStore(VaultConfigurationStoreName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get mapping documents: %w", err)
+		return fmt.Errorf("failed to open store for vault configurations: %w", err)
 	}
 
-	if len(mappingDocuments) == 0 { // No documents match the query
-		return nil, nil
+	err = configStore.Delete(vaultID)
+	if err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+		return fmt.Errorf("failed to delete vault configuration: %w", err)
 	}
 
-	documentIDs := getDocumentIDsFromMappingDocumentsWithoutDuplicates(mappingDocuments)
-
-	encryptedDocsBytes, err := c.coreStore.GetBulk(documentIDs...)
+	err = c.encryption.deleteDataKey(vaultID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get encrypted documents containing matching attribute names: %w", err)
+		return err
 	}
 
-	matchingEncryptedDocs := make([]models.EncryptedDocument, len(encryptedDocsBytes))
-
-	for i, encryptedDocBytes := range encryptedDocsBytes {
-		var matchingEncryptedDoc models.EncryptedDocument
-
-		err = json.Unmarshal(encryptedDocBytes, &matchingEncryptedDoc)
-		if err != nil {
-			return nil, fmt.Errorf("failed to unmarshal matching encrypted document with ID %s: %w",
-				documentIDs[i], err)
-		}
-
-		matchingEncryptedDocs[i] = matchingEncryptedDoc
-	}
+	refund()
 
-	if query.Value != "" {
-		matchingEncryptedDocs = c.filterDocsByQuery(matchingEncryptedDocs, query)
+	if c.tenancy != nil {
+		c.tenancy.vaultTenants.Delete(vaultID)
 	}
 
-	return matchingEncryptedDocs, nil
+	return nil
 }
 
-// StoreDataVaultConfiguration stores the given DataVaultConfiguration and vaultID
-func (c *Store) StoreDataVaultConfiguration(config *models.DataVaultConfiguration, vaultID string) error {
-	err := c.checkDuplicateReferenceID(config.ReferenceID)
-	if err != nil {
-		return fmt.Errorf(messages.CheckDuplicateRefIDFailure, err)
-	}
+// TombstoneCompactionPolicy decides whether the tombstone of a deleted document can be removed once its retention
+// window has passed. Tombstones are the stubs that deletions are replicated from, so a replicator keeps them until
+// every replica of the vault has received the deletion.
+type TombstoneCompactionPolicy interface {
+	DeletionConfirmed(vaultID, docID string) (bool, error)
+}
 
-	configEntry := models.DataVaultConfigurationMapping{
-		DataVaultConfiguration: *config,
-		VaultID:                vaultID,
+// PurgeTombstones permanently removes the tombstones whose retention window has passed from every vault.
+// If policy isn't nil, then an expired tombstone is only removed once policy confirms the deletion, so tombstones
+// can outlive their retention window.
+// It returns the number of tombstones removed. It does nothing if tombstone mode isn't enabled.
+func (c *Provider) PurgeTombstones(policy TombstoneCompactionPolicy) (int, error) {
+	if c.tombstoneRetention == 0 {
+		return 0, nil
 	}
 
-	configBytes, err := json.Marshal(configEntry)
+	err := c.background.begin()
 	if err != nil {
-		return fmt.Errorf(messages.FailToMarshalConfig, err)
+		return 0, err
 	}
 
-	return c.coreStore.Put(vaultID, configBytes,
-		storage.Tag{Name: VaultConfigReferenceIDTagName, Value: config.ReferenceID})
-}
+	defer c.background.end()
 
-func (c *Store) checkDuplicateReferenceID(referenceID string) error {
-	itr, err := c.coreStore.Query(fmt.Sprintf("%s:%s", VaultConfigReferenceIDTagName, referenceID))
+	configStore, err := c.coreProvider.OpenStore(VaultConfigurationStoreName)
 	if err != nil {
-		return err
+		return 0, fmt.Errorf("failed to open store for vault configurations: %w", err)
 	}
 
-	ok, err := itr.Next()
+	vaultIDs, err := entryKeys(configStore, VaultConfigReferenceIDTagName, c.retrievalPageSize, c.log())
 	if err != nil {
-		return err
+		return 0, fmt.Errorf("failed to get vaults: %w", err)
 	}
 
-	if ok {
-		return messages.ErrDuplicateVault
-	}
+	var purged int
 
-	return nil
-}
+	for _, vaultID := range vaultIDs {
+		store, errOpen := c.OpenStore(vaultID)
+		if errOpen != nil {
+			return purged, fmt.Errorf("failed to open store for vault %s: %w", vaultID, errOpen)
+		}
 
-// createMappingDocuments creates documents with mappings of the encrypted index to the document that has it.
-func (c *Store) createMappingDocuments(documents []models.EncryptedDocument) []indexMappingDocument {
-	var mappingDocuments []indexMappingDocument
+		count, errPurge := store.purgeTombstones(time.Now(), policy)
+		purged += count
 
-	for _, document := range documents {
-		for _, indexedAttributeCollection := range document.IndexedAttributeCollections {
-			for _, indexedAttribute := range indexedAttributeCollection.IndexedAttributes {
-				mappingDocument := c.createMappingDocument(indexedAttribute, document.ID)
-				mappingDocuments = append(mappingDocuments, *mappingDocument)
-			}
+		if errPurge != nil {
+			return purged, fmt.Errorf("failed to purge tombstones in vault %s: %w", vaultID, errPurge)
 		}
 	}
 
-	return mappingDocuments
+	return purged, nil
 }
 
-// validateNewDocIndexAttribute tries to ensure that index name+pairs declared unique are maintained as such. Note that
-// this cannot be guaranteed due to the nature of concurrent requests.
-func (c *Store) validateNewDocIndexAttribute(newDoc models.EncryptedDocument) error {
-	for _, newAttributeCollection := range newDoc.IndexedAttributeCollections {
-		err := c.validateNewAttributeCollection(newAttributeCollection, newDoc.ID)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
+// Store represents an EDV store.
+// It wraps an Aries store with additional functionality that's needed for EDV operations.
+type Store struct {
+	coreStore             storage.Store
+	name                  string
+	coreStoreName         string
+	namespace             VaultNamespace
+	retrievalPageSize     uint
+	documentLocks         *documentLocks
+	tombstoneRetention    time.Duration
+	batchRetry            *batchRetry
+	maxMappingDocuments   uint
+	attributeCache        AttributeCache
+	readRepairer          *readRepairer
+	indexCorruptionAlerts *indexCorruptionAlerts
+	// uniqueIndexRegistries holds the namespaces of the vaults whose unique index registry is known to be built.
+	uniqueIndexRegistries *sync.Map
+	// outbox is nil if the outbox isn't enabled.
+	outbox  *outbox
+	metrics Metrics
+	// tenantID is the tenant that the vault is bound to, whose quotas are enforced on writes. It's empty if the vault
+	// isn't bound to a tenant.
+	tenantID string
+	tenancy  *tenancy
+	// vaultLimits limits the number of vaults that each controller can have. It's only used by the store for vault
+	// configurations, and is nil if vault limits aren't enabled.
+	vaultLimits *vaultLimits
+	// encryption encrypts the vault's mapping documents, or the configurations in the store for vault configurations.
+	// It's nil if encryption at rest isn't enabled.
+	encryption *encryption
+	// mappingDocumentCodec is the codec that mapping documents are stored with. If it's nil, then they're stored as
+	// JSON.
+	mappingDocumentCodec MappingDocumentCodec
+	revisionHistory      bool
+	uniqueConstraints    bool
+	// indexingWorkers is the number of workers that index documents asynchronously. It's 0 if asynchronous indexing
+	// isn't enabled (see WithAsyncIndexing).
+	indexingWorkers uint
+	logger          logging.Logger
+	// ctx is the context of the request that the store was opened for (see WithContext). It's nil if the store
+	// doesn't have one.
+	ctx context.Context
 }
 
-func (c *Store) validateNewAttributeCollection(
-	newAttributeCollection models.IndexedAttributeCollection, docID string) error {
-	for _, newAttribute := range newAttributeCollection.IndexedAttributes {
-		err := c.validateNewAttribute(newAttribute, docID)
-		if err != nil {
-			return err
-		}
+// Put stores the given document.
+// Mapping documents are also created and stored in order to allow for encrypted indices to work.
+func (c *Store) Put(document models.EncryptedDocument) error {
+	store, err := c.beginWrite()
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return store.put(document, models.DocumentCreatedVaultEvent, nil)
 }
 
-func (c *Store) validateNewAttribute(
-	newAttribute models.IndexedAttribute, newDocID string) error {
-	query := models.Query{
-		Name:  newAttribute.Name,
-		Value: newAttribute.Value,
+// put stores the given document. locks are the locks held by the caller, if any.
+func (c *Store) put(document models.EncryptedDocument, eventType string, locks *heldLocks) error {
+	// Checked before validation so that a document with too many indexed attributes doesn't cause a query for each.
+	err := c.checkMappingDocumentLimit(&document)
+	if err != nil {
+		return err
 	}
 
-	existingDocs, err := c.Query(&query)
+	err = c.validateNewDocIndexAttribute(document)
 	if err != nil {
-		return fmt.Errorf("failed to query for documents: %w", err)
+		return fmt.Errorf("failure during encrypted document validation: %w", err)
 	}
 
-	err = c.validateNewAttributeAgainstDocs(existingDocs, newDocID, newAttribute)
+	return c.upsertBulk([]models.EncryptedDocument{document}, eventType, false, nil, locks)
+}
+
+// UpsertBulk stores the given documents, creating or updating them as needed.
+// A document that's already stored is only updated if the new document's sequence is exactly one greater than the
+// sequence of the document currently stored, as with Update. Otherwise, an error wrapping
+// messages.ErrDocumentSequenceConflict is returned and none of the documents are stored. The sequences are checked
+// while holding the locks of the documents, and again by the write if the storage backend implements
+// ConditionalStore.
+// If batch retry is enabled and some of the documents still couldn't be stored after retrying, then a *BatchError
+// with their IDs is returned. The other documents were stored.
+// If any of the documents has more indexed attributes than the mapping document limit allows, then a
+// *MappingDocumentLimitError is returned and none of the documents are stored, and likewise a *TenantQuotaError if
+// the documents would take the vault's tenant over its quotas.
+// The index name+value pairs the documents declare as unique are registered in the same batch, as are the
+// documents' events if the outbox is enabled. If unique constraints are enabled, then the pairs are claimed before
+// the batch (see WithUniqueConstraints). If asynchronous indexing is enabled, then the documents' mapping documents
+// are created afterwards (see WithAsyncIndexing).
+// TODO (#171): Address encrypted index limitations of this method.
+func (c *Store) UpsertBulk(documents []models.EncryptedDocument) error {
+	store, err := c.beginWrite()
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
+	locks := store.lockDocuments(documents)
+	defer locks.unlock()
 
-func (c *Store) validateNewAttributeAgainstDocs(docs []models.EncryptedDocument, newDocID string,
-	newAttribute models.IndexedAttribute) error {
-	for _, doc := range docs {
-		err := c.validateNewAttributeAgainstDoc(newAttribute, doc, newDocID)
-		if err != nil {
-			return err
-		}
+	expected, err := store.upsertConditions(documents)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return store.upsertBulk(documents, models.DocumentUpsertedVaultEvent, store.indexingWorkers > 0, expected, locks)
 }
 
-func (c *Store) validateNewAttributeAgainstDoc(newAttribute models.IndexedAttribute,
-	doc models.EncryptedDocument, newDocID string) error {
-	// Skip validating new attribute against attribute collections of the same document while updating.
-	if doc.ID == newDocID {
-		return nil
-	}
-
-	err := validateNewAttributeAgainstAttributeCollections(newAttribute, doc.IndexedAttributeCollections)
+// upsertBulk stores the given documents. If deferIndexing is set, then their mapping documents are left for
+// ProcessIndexingQueues to create, and an indexing queue entry is stored for each document instead.
+// The documents are only written if the ones in expected are still stored as they're mapped to (see
+// upsertConditions). locks are the locks of the documents held by the caller, if any, which batch retries let go of
+// while backing off.
+func (c *Store) upsertBulk(documents []models.EncryptedDocument, eventType string, deferIndexing bool,
+	expected map[string][]byte, locks *heldLocks) error {
+	mappingDocuments, err := c.createMappingDocuments(documents)
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-func validateNewAttributeAgainstAttributeCollections(newAttribute models.IndexedAttribute,
-	attributeCollections []models.IndexedAttributeCollection) error {
-	for _, attributeCollection := range attributeCollections {
-		err := validateNewAttributeAgainstAttributeCollection(newAttribute, attributeCollection)
-		if err != nil {
-			return err
-		}
+	if deferIndexing {
+		mappingDocuments = nil
 	}
 
-	return nil
-}
+	documentIDs := make(map[string]string, len(mappingDocuments))
 
-func validateNewAttributeAgainstAttributeCollection(newAttribute models.IndexedAttribute,
-	attributeCollection models.IndexedAttributeCollection) error {
-	for _, attribute := range attributeCollection.IndexedAttributes {
-		err := validateNewAttributeAgainstAttribute(newAttribute, attribute)
-		if err != nil {
-			return err
-		}
+	for _, mappingDocument := range mappingDocuments {
+		documentIDs[mappingDocument.MappingDocumentName] = mappingDocument.MatchingEncryptedDocID
 	}
 
-	return nil
-}
+	uniqueIndexOps, claims, err := c.sideOperations(documents, eventType, deferIndexing, documentIDs)
+	if err != nil {
+		return err
+	}
 
-func validateNewAttributeAgainstAttribute(newAttribute, attribute models.IndexedAttribute) error {
-	if newAttribute.Name == attribute.Name && newAttribute.Value == attribute.Value {
-		if attribute.Unique {
+	operations := make([]storage.Operation, len(mappingDocuments)+len(documents))
+
+	for i := 0; i < len(mappingDocuments); i++ {
+		operations[i].Key = mappingDocuments[i].MappingDocumentName
+
+		mappingDocumentBytes, errMarshal := c.encodeMappingDocument(&mappingDocuments[i])
+		if errMarshal != nil {
+			return fmt.Errorf("failed to marshal mapping document into bytes: %w", errMarshal)
+		}
+
+		c.log().Debugf(`Creating mapping document in vault %s: Mapping document contents: %+v`,
+			c.name, mappingDocuments[i])
+
+		operations[i].Value = mappingDocumentBytes
+		operations[i].Tags = []storage.Tag{
+			{
+				Name:  MappingDocumentTagName,
+				Value: mappingDocuments[i].AttributeName,
+			},
+			documentIDTag(MappingDocumentMatchingEncryptedDocIDTagName, mappingDocuments[i].MatchingEncryptedDocID),
+		}
+	}
+
+	for i := len(mappingDocuments); i < len(mappingDocuments)+len(documents); i++ {
+		operations[i].Key = documents[i-len(mappingDocuments)].ID
+
+		documentBytes, errMarshal := json.Marshal(documents[i-len(mappingDocuments)])
+		if errMarshal != nil {
+			return fmt.Errorf("failed to marshal encrypted document %s: %w",
+				documents[i-len(mappingDocuments)].ID, errMarshal)
+		}
+
+		operations[i].Value = documentBytes
+		operations[i].Tags = documentTags(documents[i-len(mappingDocuments)].Sequence)
+
+		revisionOps, errRevision := c.revisionOperations(documents[i-len(mappingDocuments)].ID,
+			documents[i-len(mappingDocuments)].Sequence, documentBytes)
+		if errRevision != nil {
+			return errRevision
+		}
+
+		for _, operation := range revisionOps {
+			documentIDs[operation.Key] = documents[i-len(mappingDocuments)].ID
+		}
+
+		uniqueIndexOps = append(uniqueIndexOps, revisionOps...)
+	}
+
+	release, err := c.claimUniqueIndexes(claims)
+	if err != nil {
+		return err
+	}
+
+	refund, err := c.reserveTenantUsage(operations[len(mappingDocuments):])
+	if err != nil {
+		release()
+
+		return err
+	}
+
+	failedKeys, err := c.batchIf(locks, expected, append(operations, uniqueIndexOps...))
+	if err == nil || c.batchRetry != nil {
+		// With batch retry, some of the events may have been stored even if the write failed.
+		c.markOutboxAfter(uniqueIndexOps)
+	}
+
+	if err != nil && c.batchRetry != nil {
+		// Some of the documents may have been stored, so the tenant isn't refunded. Its usage is counted too high
+		// until the failed documents are written again.
+		failed := failedDocumentIDs(documents, documentIDs, failedKeys)
+
+		c.cleanUpFailedDocuments(failed, mappingDocuments, failedKeys, locks != nil)
+
+		err = &BatchError{DocumentIDs: failed, Err: err}
+	} else if err != nil {
+		refund()
+	}
+
+	if err != nil {
+		release()
+		c.invalidateMappingDocuments(mappingDocuments)
+
+		return fmt.Errorf("failed to store encrypted document(s) and their "+
+			"associated mapping document(s): %w", err)
+	}
+
+	c.cacheMappingDocuments(mappingDocuments)
+	c.recordMappingDocumentsWritten(len(mappingDocuments))
+
+	return nil
+}
+
+// sideOperations returns the operations that are written in the same batch as the given documents: their unique
+// index entries, outbox entries and indexing queue entries. It also returns the unique index entries on their own,
+// for claimUniqueIndexes, and adds the keys of all the operations to documentIDs.
+func (c *Store) sideOperations(documents []models.EncryptedDocument, eventType string, deferIndexing bool,
+	documentIDs map[string]string) ([]storage.Operation, []storage.Operation, error) {
+	var operations, claims []storage.Operation
+
+	for i := range documents {
+		uniqueIndexOps, err := uniqueIndexOperations(&documents[i])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		claims = append(claims, uniqueIndexOps...)
+
+		outboxOps, err := c.outboxOperations(eventType, documents[i].ID, documents[i].Sequence)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		indexingQueueOps, err := indexingQueueOperations(documents[i].ID, deferIndexing)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		documentOperations := append(append(uniqueIndexOps, outboxOps...), indexingQueueOps...)
+
+		for _, operation := range documentOperations {
+			documentIDs[operation.Key] = documents[i].ID
+		}
+
+		operations = append(operations, documentOperations...)
+	}
+
+	return operations, claims, nil
+}
+
+// failedDocumentIDs returns the IDs of the documents that the failed operations of an UpsertBulk write were for,
+// in the order of the documents. documentIDs maps the keys of the mapping documents and unique index entries to the
+// IDs of their documents.
+func failedDocumentIDs(documents []models.EncryptedDocument, documentIDs map[string]string,
+	failedKeys []string) []string {
+	failed := make(map[string]struct{}, len(failedKeys))
+
+	for _, key := range failedKeys {
+		documentID, ok := documentIDs[key]
+		if !ok {
+			documentID = key // Not a mapping document or unique index entry, so it's the document itself.
+		}
+
+		failed[documentID] = struct{}{}
+	}
+
+	var failedIDs []string
+
+	for _, document := range documents {
+		if _, ok := failed[document.ID]; ok {
+			failedIDs = append(failedIDs, document.ID)
+
+			delete(failed, document.ID)
+		}
+	}
+
+	return failedIDs
+}
+
+// Get fetches the document associated with the given key.
+func (c *Store) Get(k string) ([]byte, error) {
+	return c.coreStore.Get(k)
+}
+
+// Update updates the given document.
+// The update is only done if the new document's sequence is exactly one greater than the sequence of the document
+// currently stored. Otherwise, an error wrapping messages.ErrDocumentSequenceConflict is returned.
+// The sequence check and the write are done while holding a lock on the document that's shared by all Stores opened
+// from the same Provider, so two concurrent updates based on the same version of a document can't both succeed.
+// The lock is local to this process, so if the storage backend implements ConditionalStore, then the document is
+// also only written if it's still the version that was checked, so that EDV servers sharing a database can't
+// overwrite each other's updates either.
+func (c *Store) Update(newDoc models.EncryptedDocument) error {
+	store, err := c.beginWrite()
+	if err != nil {
+		return err
+	}
+
+	return store.update(newDoc)
+}
+
+func (c *Store) update(newDoc models.EncryptedDocument) error {
+	err := c.checkMappingDocumentLimit(&newDoc)
+	if err != nil {
+		return err
+	}
+
+	err = c.validateNewDocIndexAttribute(newDoc)
+	if err != nil {
+		return fmt.Errorf("failure during encrypted document validation: %w", err)
+	}
+
+	locks := c.documentLocks.lockAll(c.namespace.Key(newDoc.ID))
+	defer locks.unlock()
+
+	currentDocument, currentSequence, err := c.getCurrentDocument(newDoc.ID)
+	if err != nil {
+		return err
+	}
+
+	if newDoc.Sequence != currentSequence+1 {
+		return fmt.Errorf(messages.UnexpectedUpdateSequence, messages.ErrDocumentSequenceConflict,
+			currentSequence+1, newDoc.Sequence)
+	}
+
+	uniqueIndexOps, err := uniqueIndexOperations(&newDoc)
+	if err != nil {
+		return err
+	}
+
+	release, err := c.claimUniqueIndexes(uniqueIndexOps)
+	if err != nil {
+		return err
+	}
+
+	err = c.replace(newDoc, currentDocument, locks)
+	if err != nil {
+		release()
+
+		return err
+	}
+
+	return nil
+}
+
+// replace replaces currentDocument, the current version of the given document, along with its mapping documents and
+// unique index registry entries. The caller must hold the document's lock, which is passed as locks.
+// The new mapping documents are stored before the document, and the ones that are no longer needed are deleted after
+// it, so that if the document turns out to have been written by another EDV server in the meantime, none of that
+// version's mapping documents are missing. The ones left behind are stale, and removed by read-repair.
+func (c *Store) replace(newDoc models.EncryptedDocument, currentDocument []byte, locks *heldLocks) error {
+	mappingDocuments, err := c.getMappingDocuments(documentIDQuery(
+		MappingDocumentMatchingEncryptedDocIDTagName, newDoc.ID))
+	if err != nil {
+		return fmt.Errorf(messages.UpdateMappingDocumentFailure, newDoc.ID, err)
+	}
+
+	err = c.checkAndCreateNewMappingDocuments(newDoc.ID, newDoc.IndexedAttributeCollections, mappingDocuments)
+	if err != nil {
+		return fmt.Errorf(messages.UpdateMappingDocumentFailure, newDoc.ID, err)
+	}
+
+	err = c.registerUniqueIndexes(&newDoc, locks)
+	if err != nil {
+		return err
+	}
+
+	newDocBytes, err := json.Marshal(newDoc)
+	if err != nil {
+		return err
+	}
+
+	outboxOps, err := c.outboxOperations(models.DocumentUpdatedVaultEvent, newDoc.ID, newDoc.Sequence)
+	if err != nil {
+		return err
+	}
+
+	revisionOps, err := c.revisionOperations(newDoc.ID, newDoc.Sequence, newDocBytes)
+	if err != nil {
+		return err
+	}
+
+	operation := storage.Operation{
+		Key: newDoc.ID, Value: newDocBytes, Tags: documentTags(newDoc.Sequence),
+	}
+
+	refund, err := c.reserveTenantUsage([]storage.Operation{operation})
+	if err != nil {
+		return err
+	}
+
+	err = c.writeIf(currentDocument, operation, append(outboxOps, revisionOps...))
+	if err != nil {
+		refund()
+
+		return err
+	}
+
+	err = c.checkAndCleanUpOldMappingDocuments(newDoc.IndexedAttributeCollections, mappingDocuments)
+	if err != nil {
+		return fmt.Errorf(messages.UpdateMappingDocumentFailure, newDoc.ID, err)
+	}
+
+	return nil
+}
+
+// Delete deletes the given document and its mapping document(s).
+// In tombstone mode, the document is replaced with a tombstone so that it can be restored later.
+func (c *Store) Delete(docID string) error {
+	store, err := c.beginWrite()
+	if err != nil {
+		return err
+	}
+
+	unlock := store.documentLocks.lock(store.namespace.Key(docID))
+	defer unlock()
+
+	return store.remove(docID, nil)
+}
+
+// DeleteIfSequenceMatches deletes the given document and its mapping document(s), but only if the sequence of the
+// document currently stored equals expectedSequence. Otherwise, an error wrapping
+// messages.ErrDocumentSequenceConflict is returned. See Update for the locking guarantees, which also apply to the
+// deletion of the document's mapping documents and its tombstone.
+func (c *Store) DeleteIfSequenceMatches(docID string, expectedSequence uint64) error {
+	store, err := c.beginWrite()
+	if err != nil {
+		return err
+	}
+
+	return store.deleteIfSequenceMatches(docID, expectedSequence)
+}
+
+func (c *Store) deleteIfSequenceMatches(docID string, expectedSequence uint64) error {
+	unlock := c.documentLocks.lock(c.namespace.Key(docID))
+	defer unlock()
+
+	currentDocument, currentSequence, err := c.getCurrentDocument(docID)
+	if err != nil {
+		return err
+	}
+
+	if currentSequence != expectedSequence {
+		return fmt.Errorf(messages.UnexpectedDeleteSequence, messages.ErrDocumentSequenceConflict,
+			currentSequence, expectedSequence)
+	}
+
+	return c.remove(docID, currentDocument)
+}
+
+// Tombstone returns the tombstone of the given deleted document.
+// messages.ErrDocumentNotFound is returned if there's no tombstone for the document.
+func (c *Store) Tombstone(docID string) (*models.Tombstone, error) {
+	record, err := c.getTombstoneRecord(docID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &record.Tombstone, nil
+}
+
+// Restore undeletes the given document from its tombstone, recreating its mapping documents, and returns the
+// restored document's sequence. The document can only be restored within the tombstone retention window, and only if
+// no document with the same ID has been created since it was deleted.
+func (c *Store) Restore(docID string) (uint64, error) {
+	store, err := c.beginWrite()
+	if err != nil {
+		return 0, err
+	}
+
+	return store.restore(docID)
+}
+
+func (c *Store) restore(docID string) (uint64, error) {
+	locks := c.documentLocks.lockAll(c.namespace.Key(docID))
+	defer locks.unlock()
+
+	record, err := c.getTombstoneRecord(docID)
+	if err != nil {
+		return 0, err
+	}
+
+	if time.Since(record.Deleted) > c.tombstoneRetention {
+		return 0, fmt.Errorf("%w: the retention window for document %s has passed", messages.ErrDocumentNotFound, docID)
+	}
+
+	_, err = c.coreStore.Get(docID)
+	if err == nil {
+		return 0, messages.ErrDuplicateDocument
+	}
+
+	if !errors.Is(err, storage.ErrDataNotFound) {
+		return 0, fmt.Errorf("failed to get document %s: %w", docID, err)
+	}
+
+	var document models.EncryptedDocument
+
+	err = json.Unmarshal(record.Document, &document)
+	if err != nil {
+		return 0, fmt.Errorf("failed to unmarshal deleted document %s: %w", docID, err)
+	}
+
+	err = c.put(document, models.DocumentRestoredVaultEvent, locks)
+	if err != nil {
+		return 0, err
+	}
+
+	err = c.coreStore.Delete(tombstoneKeyPrefix + docID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete tombstone for document %s: %w", docID, err)
+	}
+
+	return document.Sequence, nil
+}
+
+// DocumentSequences returns the IDs of the encrypted documents in the store, mapped to their sequences.
+// Documents without an EncryptedDocumentSequenceTagName tag aren't included.
+func (c *Store) DocumentSequences() (map[string]uint64, error) {
+	itr, err := c.coreStore.Query(EncryptedDocumentSequenceTagName, storage.WithPageSize(int(c.retrievalPageSize)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query encrypted documents: %w", err)
+	}
+
+	defer storage.Close(itr, c.log())
+
+	documentSequences := make(map[string]uint64)
+
+	moreEntries, err := itr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next entry from iterator: %w", err)
+	}
+
+	for moreEntries {
+		docID, errKey := itr.Key()
+		if errKey != nil {
+			return nil, fmt.Errorf("failed to get key from iterator: %w", errKey)
+		}
+
+		tags, errTags := itr.Tags()
+		if errTags != nil {
+			return nil, fmt.Errorf("failed to get tags from iterator: %w", errTags)
+		}
+
+		for _, tag := range tags {
+			if tag.Name != EncryptedDocumentSequenceTagName {
+				continue
+			}
+
+			sequence, errParse := strconv.ParseUint(tag.Value, 10, 64)
+			if errParse != nil {
+				return nil, fmt.Errorf("invalid sequence tag on document %s: %w", docID, errParse)
+			}
+
+			documentSequences[docID] = sequence
+		}
+
+		moreEntries, err = itr.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get next entry from iterator: %w", err)
+		}
+	}
+
+	return documentSequences, nil
+}
+
+// ExportDocument returns the stored encrypted document with the given ID along with its mapping documents,
+// in a form that can be passed to ImportDocument in another store.
+func (c *Store) ExportDocument(docID string) (*models.ReplicatedDocument, error) {
+	documentBytes, err := c.coreStore.Get(docID)
+	if err != nil {
+		if errors.Is(err, storage.ErrDataNotFound) {
+			return nil, messages.ErrDocumentNotFound
+		}
+
+		return nil, fmt.Errorf("failed to get document %s: %w", docID, err)
+	}
+
+	mappingDocuments, err := c.getMappingDocuments(documentIDQuery(MappingDocumentMatchingEncryptedDocIDTagName, docID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mapping documents for document %s: %w", docID, err)
+	}
+
+	replicatedDocument := &models.ReplicatedDocument{
+		Document:         documentBytes,
+		MappingDocuments: make([]json.RawMessage, len(mappingDocuments)),
+	}
+
+	for i := range mappingDocuments {
+		replicatedDocument.MappingDocuments[i], err = json.Marshal(mappingDocuments[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal mapping document: %w", err)
+		}
+	}
+
+	return replicatedDocument, nil
+}
+
+// ImportDocument stores a document exported from another store with ExportDocument, replacing the document with the
+// same ID and its mapping documents if it already exists. The document is stored as-is: no uniqueness validation or
+// sequence checks are done. If the document is written to by another request while a failed write of it is backing
+// off (see WithBatchRetry), then the import fails with an error wrapping messages.ErrDocumentSequenceConflict.
+func (c *Store) ImportDocument(replicatedDocument *models.ReplicatedDocument) error {
+	store, err := c.beginWrite()
+	if err != nil {
+		return err
+	}
+
+	return store.importDocument(replicatedDocument)
+}
+
+func (c *Store) importDocument(replicatedDocument *models.ReplicatedDocument) error {
+	var document models.EncryptedDocument
+
+	err := json.Unmarshal(replicatedDocument.Document, &document)
+	if err != nil {
+		return fmt.Errorf("%w: failed to unmarshal document: %s", messages.ErrInvalidReplicatedDocument, err)
+	}
+
+	if document.ID == "" {
+		return fmt.Errorf("%w: document has no ID", messages.ErrInvalidReplicatedDocument)
+	}
+
+	operations := make([]storage.Operation, 0, len(replicatedDocument.MappingDocuments)+1)
+	mappingDocuments := make([]indexMappingDocument, 0, len(replicatedDocument.MappingDocuments))
+
+	for _, mappingDocumentBytes := range replicatedDocument.MappingDocuments {
+		var mappingDocument indexMappingDocument
+
+		err = json.Unmarshal(mappingDocumentBytes, &mappingDocument)
+		if err != nil {
+			return fmt.Errorf("%w: failed to unmarshal mapping document: %s", messages.ErrInvalidReplicatedDocument, err)
+		}
+
+		if mappingDocument.MatchingEncryptedDocID != document.ID ||
+			!strings.HasPrefix(mappingDocument.MappingDocumentName, document.ID+"_mapping_") {
+			return fmt.Errorf("%w: mapping document %s isn't for document %s",
+				messages.ErrInvalidReplicatedDocument, mappingDocument.MappingDocumentName, document.ID)
+		}
+
+		// Replicated mapping documents are always JSON, so they're re-encoded with this store's codec.
+		storedMappingDocumentBytes, errEncode := c.encodeMappingDocument(&mappingDocument)
+		if errEncode != nil {
+			return fmt.Errorf("failed to marshal mapping document into bytes: %w", errEncode)
+		}
+
+		mappingDocuments = append(mappingDocuments, mappingDocument)
+		operations = append(operations, storage.Operation{
+			Key:   mappingDocument.MappingDocumentName,
+			Value: storedMappingDocumentBytes,
+			Tags: []storage.Tag{
+				{Name: MappingDocumentTagName, Value: mappingDocument.AttributeName},
+				documentIDTag(MappingDocumentMatchingEncryptedDocIDTagName, mappingDocument.MatchingEncryptedDocID),
+			},
+		})
+	}
+
+	operations = append(operations, storage.Operation{
+		Key:   document.ID,
+		Value: replicatedDocument.Document,
+		Tags:  documentTags(document.Sequence),
+	})
+
+	uniqueIndexOps, err := uniqueIndexOperations(&document)
+	if err != nil {
+		return err
+	}
+
+	revisionOps, err := c.revisionOperations(document.ID, document.Sequence, replicatedDocument.Document)
+	if err != nil {
+		return err
+	}
+
+	operations = append(append(operations, uniqueIndexOps...), revisionOps...)
+
+	locks := c.documentLocks.lockAll(c.namespace.Key(document.ID))
+	defer locks.unlock()
+
+	err = c.delete(document.ID, nil)
+	if err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+		return fmt.Errorf("failed to delete current version of document %s: %w", document.ID, err)
+	}
+
+	var expected map[string][]byte
+
+	if c.batchRetry != nil {
+		// The document was just deleted, so it must still not exist if the write is retried after letting go of its
+		// lock.
+		expected = map[string][]byte{document.ID: nil}
+	}
+
+	failedKeys, err := c.batchIf(locks, expected, operations)
+	if err != nil {
+		if c.batchRetry != nil {
+			c.cleanUpFailedDocuments([]string{document.ID}, mappingDocuments, failedKeys, true)
+		}
+
+		c.invalidateMappingDocuments(mappingDocuments)
+
+		return fmt.Errorf("failed to store document %s and its mapping documents: %w", document.ID, err)
+	}
+
+	c.cacheMappingDocuments(mappingDocuments)
+	c.recordMappingDocumentsWritten(len(mappingDocuments))
+
+	return nil
+}
+
+// Query does an EDV encrypted index query.
+// We first get the "mapping document" and then use the ID we get from that to lookup the associated encrypted document.
+// Then we check that encrypted document to see if the value matches what was specified in the query.
+// If query.Has is not blank, then we assume it's a "has" query,
+// and so any documents with an index name matching query.Has will be returned regardless of value.
+// If query.Operator is set, then the values are matched by that custom query operator (see RegisterQueryOperator)
+// instead, and an error wrapping ErrUnknownQueryOperator or ErrInvalidQueryOperand is returned if it can't parse
+// the query.
+// The matching documents are returned in the order of their IDs, and each of them only once, even if it has several
+// matching attributes.
+func (c *Store) Query(query *models.Query) ([]models.EncryptedDocument, error) {
+	page, err := c.QueryWithDeadline(query, "", time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	return page.Documents, nil
+}
+
+// QueryPage is the part of the results of a query that were found before the query's deadline.
+type QueryPage struct {
+	Documents []models.EncryptedDocument
+	// Partial is true if the deadline passed before all the documents found by the query were fetched.
+	Partial bool
+	// ContinueAfter is the document ID to pass to QueryWithDeadline to get the rest of the results of a partial query.
+	ContinueAfter string
+}
+
+// QueryWithDeadline does the same query as Query, but stops fetching the documents found by the query once the
+// deadline passes and returns the matches found so far. A zero deadline means there's no deadline. The documents are
+// fetched the query's page size at a time, and at least one page is always fetched, so that continuing a query always
+// makes progress.
+// If after isn't empty, then only the documents whose IDs come after it are returned, which is used to continue a
+// partial query. Since the results are ordered by document ID, continuing a query never returns a document twice or
+// skips one, even if documents are created or deleted in between. Only documents created in between whose IDs come
+// before after are left out.
+func (c *Store) QueryWithDeadline(query *models.Query, after string, deadline time.Time) (*QueryPage, error) {
+	matcher, err := ParseQueryOperator(query)
+	if err != nil {
+		return nil, err
+	}
+
+	indexName := queryIndexName(query)
+	pageSize := c.queryPageSize(query)
+
+	documentIDs, err := c.queryDocumentIDs(query, indexName, pageSize, after)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &QueryPage{}
+
+	var fetchedDocuments int
+
+	for len(documentIDs) > 0 {
+		fetched := documentIDs
+		if pageSize > 0 && uint(len(fetched)) > pageSize {
+			fetched = fetched[:pageSize]
+		}
+
+		documentIDs = documentIDs[len(fetched):]
+		fetchedDocuments += len(fetched)
+
+		matchingEncryptedDocs, err := c.getQueriedDocuments(query, matcher, indexName, fetched)
+		if err != nil {
+			return nil, err
+		}
+
+		page.Documents = append(page.Documents, matchingEncryptedDocs...)
+
+		if len(documentIDs) > 0 && !deadline.IsZero() && time.Now().After(deadline) {
+			page.Partial = true
+			page.ContinueAfter = fetched[len(fetched)-1]
+
+			break
+		}
+	}
+
+	c.recordQueryFannedOut(fetchedDocuments)
+
+	return page, nil
+}
+
+// queryIndexName returns the attribute name that the given query is for.
+func queryIndexName(query *models.Query) string {
+	if query.Has != "" {
+		return query.Has
+	}
+
+	return query.Name
+}
+
+// queryPageSize returns the number of mapping documents, and of documents, to fetch from the database at a time for
+// the given query.
+func (c *Store) queryPageSize(query *models.Query) uint {
+	if query.PageSize > 0 {
+		return query.PageSize
+	}
+
+	return c.retrievalPageSize
+}
+
+// getQueriedDocuments gets the documents with the given IDs that were found by the given query for the given
+// attribute name, and leaves out the ones that don't match the query's value, operator or HMAC key ID. matcher is
+// the query's operator matcher, if it has an operator.
+// If there's an attribute cache or read-repair is enabled, then documents that don't exist or don't have the
+// attribute are left out, since the mapping documents that led to them are stale.
+func (c *Store) getQueriedDocuments(query *models.Query, matcher QueryMatcher, indexName string,
+	documentIDs []string) ([]models.EncryptedDocument, error) {
+	encryptedDocsBytes, err := c.coreStore.GetBulk(documentIDs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get encrypted documents containing matching attribute names: %w", err)
+	}
+
+	skipStale := c.attributeCache != nil || c.readRepairer != nil
+
+	matchingEncryptedDocs := make([]models.EncryptedDocument, 0, len(encryptedDocsBytes))
+
+	for i, encryptedDocBytes := range encryptedDocsBytes {
+		if encryptedDocBytes == nil && skipStale {
+			c.staleMappingDocuments(documentIDs[i], indexName)
+
+			continue
+		}
+
+		var matchingEncryptedDoc models.EncryptedDocument
+
+		err = json.Unmarshal(encryptedDocBytes, &matchingEncryptedDoc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal matching encrypted document with ID %s: %w",
+				documentIDs[i], err)
+		}
+
+		if skipStale && !hasAttribute(&matchingEncryptedDoc, indexName) {
+			c.staleMappingDocuments(documentIDs[i], indexName)
+
+			continue
+		}
+
+		matchingEncryptedDocs = append(matchingEncryptedDocs, matchingEncryptedDoc)
+	}
+
+	if filtersValues(query) {
+		matchingEncryptedDocs = c.filterDocsByQuery(matchingEncryptedDocs, query, matcher)
+	}
+
+	return matchingEncryptedDocs, nil
+}
+
+// queryDocumentIDs returns the sorted IDs of the documents with the given attribute name that come after the given
+// document ID, without duplicates. The attribute cache is used if there's one. Otherwise, all the mapping documents
+// for the attribute are scanned, pageSize at a time, since databases don't return them in the same order. Mapping
+// documents for attributes indexed with a different HMAC key than the one the query is restricted to are left out.
+func (c *Store) queryDocumentIDs(query *models.Query, indexName string, pageSize uint,
+	after string) ([]string, error) {
+	var documentIDs []string
+
+	if c.attributeCache != nil {
+		cachedDocumentIDs, err := c.attributeDocumentIDs(indexName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get mapping documents: %w", err)
+		}
+
+		// The cached slice is shared, so it's sorted in a copy.
+		documentIDs = append(documentIDs, cachedDocumentIDs...)
+	} else {
+		mappingDocuments, err := c.scanMappingDocuments(fmt.Sprintf("%s:%s", MappingDocumentTagName, indexName),
+			pageSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get mapping documents: %w", err)
+		}
+
+		if query.HMACKeyID != "" {
+			mappingDocuments = filterMappingDocumentsByHMACKeyID(mappingDocuments, query.HMACKeyID)
+		}
+
+		documentIDs = getDocumentIDsFromMappingDocumentsWithoutDuplicates(mappingDocuments)
+	}
+
+	sort.Strings(documentIDs)
+
+	if after != "" {
+		documentIDs = documentIDs[sort.Search(len(documentIDs), func(i int) bool {
+			return documentIDs[i] > after
+		}):]
+	}
+
+	return documentIDs, nil
+}
+
+// filterMappingDocumentsByHMACKeyID leaves out the mapping documents that were recorded with a different HMAC key ID
+// than the given one. Mapping documents without an HMAC key ID are kept, since their documents may still match.
+func filterMappingDocumentsByHMACKeyID(mappingDocuments []indexMappingDocument,
+	hmacKeyID string) []indexMappingDocument {
+	var filteredMappingDocuments []indexMappingDocument
+
+	for _, mappingDocument := range mappingDocuments {
+		if mappingDocument.HMACKeyID == "" || mappingDocument.HMACKeyID == hmacKeyID {
+			filteredMappingDocuments = append(filteredMappingDocuments, mappingDocument)
+		}
+	}
+
+	return filteredMappingDocuments
+}
+
+// StoreDataVaultConfiguration stores the given DataVaultConfiguration and vaultID. A *VaultLimitError is returned if
+// the vault's controller already has as many vaults as it's allowed to (see WithMaxVaultsPerController).
+func (c *Store) StoreDataVaultConfiguration(config *models.DataVaultConfiguration, vaultID string) error {
+	store, err := c.beginWrite()
+	if err != nil {
+		return err
+	}
+
+	return store.storeDataVaultConfiguration(config, vaultID, "")
+}
+
+func (c *Store) storeDataVaultConfiguration(config *models.DataVaultConfiguration, vaultID, tenantID string) error {
+	unlockReferenceID := c.lockReferenceID(config.ReferenceID)
+	defer unlockReferenceID()
+
+	err := c.checkDuplicateReferenceID(config.ReferenceID)
+	if err != nil {
+		return fmt.Errorf(messages.CheckDuplicateRefIDFailure, err)
+	}
+
+	unlock := c.lockController(config.Controller)
+	defer unlock()
+
+	err = c.checkVaultLimit(config.Controller)
+	if err != nil {
+		return err
+	}
+
+	configEntry := models.DataVaultConfigurationMapping{
+		DataVaultConfiguration: *config,
+		VaultID:                vaultID,
+		TenantID:               tenantID,
+	}
+
+	configBytes, err := encodeVaultConfiguration(c.encryption, vaultID, &configEntry)
+	if err != nil {
+		return err
+	}
+
+	return c.coreStore.Put(vaultID, configBytes, configurationTags(&configEntry)...)
+}
+
+// VaultIDs returns the IDs of all the vaults, as found through their configurations.
+func (c *Provider) VaultIDs() ([]string, error) {
+	configStore, err := c.coreProvider.OpenStore(VaultConfigurationStoreName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store for vault configurations: %w", err)
+	}
+
+	vaultIDs, err := entryKeys(configStore, VaultConfigReferenceIDTagName, c.retrievalPageSize, c.log())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vaults: %w", err)
+	}
+
+	return vaultIDs, nil
+}
+
+// VaultConfiguration returns the configuration of the given vault, decrypted if encryption at rest is enabled.
+// messages.ErrVaultNotFound is returned if the vault doesn't exist.
+func (c *Provider) VaultConfiguration(vaultID string) (*models.DataVaultConfiguration, error) {
+	configStore, err := c.coreProvider.OpenStore(VaultConfigurationStoreName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store for vault configurations: %w", err)
+	}
+
+	configEntry, err := getVaultConfigurationMapping(configStore, c.encryption, vaultID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &configEntry.DataVaultConfiguration, nil
+}
+
+// UpdateDataVaultConfiguration applies the given update to the configuration of the given vault, increments the
+// configuration's sequence and returns the updated configuration. A reference ID can only be set if the vault doesn't
+// have one yet, in which case it must not be used by another vault (see RotateReferenceID for changing it).
+// messages.ErrVaultNotFound is returned if the vault doesn't exist, and messages.ErrConfigurationSequenceConflict if
+// the update's sequence isn't the next one.
+func (c *Store) UpdateDataVaultConfiguration(vaultID string,
+	update *models.DataVaultConfigurationUpdate) (*models.DataVaultConfiguration, error) {
+	store, err := c.beginWrite()
+	if err != nil {
+		return nil, err
+	}
+
+	return store.updateDataVaultConfiguration(vaultID, update)
+}
+
+func (c *Store) updateDataVaultConfiguration(vaultID string,
+	update *models.DataVaultConfigurationUpdate) (*models.DataVaultConfiguration, error) {
+	unlock := c.documentLocks.lock(c.namespace.Key(vaultID))
+	defer unlock()
+
+	configEntry, err := getVaultConfigurationMapping(c.coreStore, c.encryption, vaultID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.applyConfigurationUpdate(configEntry, update)
+	if err != nil {
+		return nil, err
+	}
+
+	configBytes, err := encodeVaultConfiguration(c.encryption, vaultID, configEntry)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.coreStore.Put(vaultID, configBytes, configurationTags(configEntry)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store configuration of vault %s: %w", vaultID, err)
+	}
+
+	return &configEntry.DataVaultConfiguration, nil
+}
+
+func (c *Store) applyConfigurationUpdate(configEntry *models.DataVaultConfigurationMapping,
+	update *models.DataVaultConfigurationUpdate) error {
+	config := &configEntry.DataVaultConfiguration
+
+	if update.Sequence != nil && *update.Sequence != config.Sequence+1 {
+		return fmt.Errorf(messages.UnexpectedUpdateSequence, messages.ErrConfigurationSequenceConflict,
+			config.Sequence+1, *update.Sequence)
+	}
+
+	if update.ReferenceID != nil && *update.ReferenceID != config.ReferenceID {
+		if config.ReferenceID != "" {
+			return messages.ErrReferenceIDImmutable
+		}
+
+		unlockReferenceID := c.lockReferenceID(*update.ReferenceID)
+		defer unlockReferenceID()
+
+		err := c.checkDuplicateReferenceID(*update.ReferenceID)
+		if err != nil {
+			if errors.Is(err, messages.ErrDuplicateVault) {
+				return err
+			}
+
+			return fmt.Errorf(messages.CheckDuplicateRefIDFailure, err)
+		}
+
+		config.ReferenceID = *update.ReferenceID
+	}
+
+	if update.Controller != nil {
+		config.Controller = *update.Controller
+	}
+
+	if update.Invoker != nil {
+		config.Invoker = *update.Invoker
+	}
+
+	if update.Delegator != nil {
+		config.Delegator = *update.Delegator
+	}
+
+	if update.InvocationMethod != nil {
+		config.InvocationMethod = *update.InvocationMethod
+	}
+
+	if update.Webhooks != nil {
+		configEntry.Webhooks = update.Webhooks
+
+		if len(update.Webhooks.Endpoints) == 0 {
+			configEntry.Webhooks = nil
+		}
+	}
+
+	if update.RetrievalPageSize != nil {
+		configEntry.RetrievalPageSize = *update.RetrievalPageSize
+	}
+
+	config.Sequence++
+
+	return nil
+}
+
+// configurationTags returns the tags of the given vault configuration. The reference ID tag is what duplicate reference
+// IDs are detected with, so it must always match the configuration.
+func configurationTags(configEntry *models.DataVaultConfigurationMapping) []storage.Tag {
+	tags := []storage.Tag{
+		{Name: VaultConfigReferenceIDTagName, Value: configEntry.DataVaultConfiguration.ReferenceID},
+	}
+
+	if configEntry.TenantID != "" {
+		tags = append(tags, storage.Tag{Name: VaultConfigTenantTagName, Value: configEntry.TenantID})
+	}
+
+	if controller := configEntry.DataVaultConfiguration.Controller; controller != "" {
+		tags = append(tags, storage.Tag{Name: VaultConfigControllerTagName, Value: controllerHash(controller)})
+	}
+
+	return tags
+}
+
+// encodeVaultConfiguration marshals the given configuration entry of the given vault, and encrypts it with the vault's
+// data key if encryption at rest is enabled.
+func encodeVaultConfiguration(encryption *encryption, vaultID string,
+	configEntry *models.DataVaultConfigurationMapping) ([]byte, error) {
+	configBytes, err := json.Marshal(configEntry)
+	if err != nil {
+		return nil, fmt.Errorf(messages.FailToMarshalConfig, err)
+	}
+
+	configBytes, err = encryption.seal(vaultID, configBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt configuration of vault %s: %w", vaultID, err)
+	}
+
+	return configBytes, nil
+}
+
+// decodeVaultConfiguration decrypts the given stored configuration entry of the given vault if it's encrypted, and
+// unmarshals it.
+func decodeVaultConfiguration(encryption *encryption, vaultID string,
+	configBytes []byte) (*models.DataVaultConfigurationMapping, error) {
+	configBytes, err := encryption.open(vaultID, configBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt configuration of vault %s: %w", vaultID, err)
+	}
+
+	var configEntry models.DataVaultConfigurationMapping
+
+	err = json.Unmarshal(configBytes, &configEntry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal configuration of vault %s: %w", vaultID, err)
+	}
+
+	return &configEntry, nil
+}
+
+func (c *Store) checkDuplicateReferenceID(referenceID string) error {
+	itr, err := c.coreStore.Query(fmt.Sprintf("%s:%s", VaultConfigReferenceIDTagName, referenceID))
+	if err != nil {
+		return err
+	}
+
+	ok, err := itr.Next()
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		return messages.ErrDuplicateVault
+	}
+
+	return nil
+}
+
+// createMappingDocuments creates documents with mappings of the encrypted index to the document that has it.
+// A *MappingDocumentLimitError is returned if a document needs more mapping documents than the limit allows.
+func (c *Store) createMappingDocuments(documents []models.EncryptedDocument) ([]indexMappingDocument, error) {
+	var mappingDocuments []indexMappingDocument
+
+	for i := range documents {
+		err := c.checkMappingDocumentLimit(&documents[i])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, indexedAttributeCollection := range documents[i].IndexedAttributeCollections {
+			for _, indexedAttribute := range indexedAttributeCollection.IndexedAttributes {
+				mappingDocument := c.createMappingDocument(indexedAttribute, indexedAttributeCollection.HMAC.ID,
+					documents[i].ID)
+				mappingDocuments = append(mappingDocuments, *mappingDocument)
+			}
+		}
+	}
+
+	return mappingDocuments, nil
+}
+
+// validateNewDocIndexAttribute tries to ensure that index name+pairs declared unique are maintained as such. Note that
+// this cannot be guaranteed due to the nature of concurrent requests.
+func (c *Store) validateNewDocIndexAttribute(newDoc models.EncryptedDocument) error {
+	for _, newAttributeCollection := range newDoc.IndexedAttributeCollections {
+		err := c.validateNewAttributeCollection(newAttributeCollection, newDoc.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Store) validateNewAttributeCollection(
+	newAttributeCollection models.IndexedAttributeCollection, docID string) error {
+	for _, newAttribute := range newAttributeCollection.IndexedAttributes {
+		err := c.validateNewAttribute(newAttribute, docID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateNewAttribute looks up the document that declares the new attribute's name+value pair as unique in the
+// unique index registry. Only if the new attribute is itself declared unique are the other documents with the same
+// name+value pair fetched, to check that none of them have it.
+func (c *Store) validateNewAttribute(
+	newAttribute models.IndexedAttribute, newDocID string) error {
+	err := c.ensureUniqueIndexRegistry()
+	if err != nil {
+		return err
+	}
+
+	owner, err := c.uniqueIndexOwner(newAttribute)
+	if err != nil {
+		return err
+	}
+
+	if owner != "" && owner != newDocID {
+		return errIndexNameAndValueAlreadyDeclaredUnique
+	}
+
+	if !newAttribute.Unique {
+		return nil
+	}
+
+	query := models.Query{
+		Name:  newAttribute.Name,
+		Value: newAttribute.Value,
+	}
+
+	existingDocs, err := c.Query(&query)
+	if err != nil {
+		return fmt.Errorf("failed to query for documents: %w", err)
+	}
+
+	err = c.validateNewAttributeAgainstDocs(existingDocs, newDocID, newAttribute)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *Store) validateNewAttributeAgainstDocs(docs []models.EncryptedDocument, newDocID string,
+	newAttribute models.IndexedAttribute) error {
+	for _, doc := range docs {
+		err := c.validateNewAttributeAgainstDoc(newAttribute, doc, newDocID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Store) validateNewAttributeAgainstDoc(newAttribute models.IndexedAttribute,
+	doc models.EncryptedDocument, newDocID string) error {
+	// Skip validating new attribute against attribute collections of the same document while updating.
+	if doc.ID == newDocID {
+		return nil
+	}
+
+	err := validateNewAttributeAgainstAttributeCollections(newAttribute, doc.IndexedAttributeCollections)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func validateNewAttributeAgainstAttributeCollections(newAttribute models.IndexedAttribute,
+	attributeCollections []models.IndexedAttributeCollection) error {
+	for _, attributeCollection := range attributeCollections {
+		err := validateNewAttributeAgainstAttributeCollection(newAttribute, attributeCollection)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateNewAttributeAgainstAttributeCollection(newAttribute models.IndexedAttribute,
+	attributeCollection models.IndexedAttributeCollection) error {
+	for _, attribute := range attributeCollection.IndexedAttributes {
+		err := validateNewAttributeAgainstAttribute(newAttribute, attribute)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateNewAttributeAgainstAttribute(newAttribute, attribute models.IndexedAttribute) error {
+	if newAttribute.Name == attribute.Name && newAttribute.Value == attribute.Value {
+		if attribute.Unique {
 			return errIndexNameAndValueAlreadyDeclaredUnique
 		}
 
-		if newAttribute.Unique {
-			return errIndexNameAndValueCannotBeUnique
+		if newAttribute.Unique {
+			return errIndexNameAndValueCannotBeUnique
+		}
+	}
+
+	return nil
+}
+
+// createMappingDocument creates a document with a mapping of the encrypted index to the document that has it.
+func (c *Store) createMappingDocument(indexedAttribute models.IndexedAttribute, hmacKeyID,
+	encryptedDocID string) *indexMappingDocument {
+	mappingDocumentName := encryptedDocID + "_mapping_" + indexedAttribute.Name + "-" + indexedAttribute.Value
+
+	mapDocument := indexMappingDocument{
+		AttributeName:          indexedAttribute.Name,
+		MatchingEncryptedDocID: encryptedDocID,
+		MappingDocumentName:    mappingDocumentName,
+		HMACKeyID:              hmacKeyID,
+	}
+
+	return &mapDocument
+}
+
+// createMappingDocument creates a document with a mapping of the encrypted index to the document that has it.
+// The HMAC key ID is left empty if it isn't known.
+func (c *Store) createAndStoreMappingDocument(indexedAttributeName, hmacKeyID, encryptedDocID string) error {
+	mappingDocumentName := encryptedDocID + "_mapping_" + uuid.New().String()
+
+	mapDocument := indexMappingDocument{
+		AttributeName:          indexedAttributeName,
+		MatchingEncryptedDocID: encryptedDocID,
+		MappingDocumentName:    mappingDocumentName,
+		HMACKeyID:              hmacKeyID,
+	}
+
+	return c.putMappingDocument(mapDocument)
+}
+
+// putMappingDocument stores the given mapping document and adds it to the attribute cache.
+func (c *Store) putMappingDocument(mapDocument indexMappingDocument) error {
+	documentBytes, err := c.encodeMappingDocument(&mapDocument)
+	if err != nil {
+		return err
+	}
+
+	c.log().Debugf(`Creating mapping document in EDV "%s":
+Name: %s,
+Contents: %+v`, c.name, mapDocument.MappingDocumentName, mapDocument)
+
+	err = c.coreStore.Put(mapDocument.MappingDocumentName, documentBytes, storage.Tag{
+		Name:  MappingDocumentTagName,
+		Value: mapDocument.AttributeName,
+	}, documentIDTag(MappingDocumentMatchingEncryptedDocIDTagName, mapDocument.MatchingEncryptedDocID))
+	if err != nil {
+		return err
+	}
+
+	c.cacheMappingDocuments([]indexMappingDocument{mapDocument})
+	c.recordMappingDocumentsWritten(1)
+
+	return nil
+}
+
+// updateMappingDocuments first queries mapping document names and indexNames with matching encrypted document ID.
+// Then we delete the mapping documents belonging to indexNames that are removed from the update
+// and create the mapping documents belonging to indexNames that are newly added.
+func (c *Store) updateMappingDocuments(encryptedDocID string,
+	newIndexedAttributeCollections []models.IndexedAttributeCollection) error {
+	mappingDocuments, err := c.getMappingDocuments(documentIDQuery(
+		MappingDocumentMatchingEncryptedDocIDTagName, encryptedDocID))
+	if err != nil {
+		return err
+	}
+
+	if err := c.checkAndCleanUpOldMappingDocuments(newIndexedAttributeCollections,
+		mappingDocuments); err != nil {
+		return err
+	}
+
+	return c.checkAndCreateNewMappingDocuments(encryptedDocID, newIndexedAttributeCollections, mappingDocuments)
+}
+
+// checkAndCreateNewMappingDocuments checks if an indexName from the new indexedAttributeCollections already exists
+// before the update, if not, create a mapping document for it.
+func (c *Store) checkAndCreateNewMappingDocuments(encryptedDocID string,
+	newIndexedAttributeCollections []models.IndexedAttributeCollection, mappingDocs []indexMappingDocument) error {
+	for _, newIndexedAttributeCollection := range newIndexedAttributeCollections {
+		for _, newIndexAttribute := range newIndexedAttributeCollection.IndexedAttributes {
+			indexNameFound := false
+
+			for _, mappingDoc := range mappingDocs {
+				if mappingDoc.AttributeName == newIndexAttribute.Name {
+					indexNameFound = true
+					break
+				}
+			}
+
+			if !indexNameFound {
+				if err := c.createAndStoreMappingDocument(newIndexAttribute.Name,
+					newIndexedAttributeCollection.HMAC.ID, encryptedDocID); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkAndCleanUpOldMappingDocuments checks if the existing indexNames still exist after the update and
+// deletes mapping documents of those that should no longer exist.
+func (c *Store) checkAndCleanUpOldMappingDocuments(
+	newIndexedAttributeCollections []models.IndexedAttributeCollection, mappingDocs []indexMappingDocument) error {
+	// for mappingDocName, oldIndexName := range mappingDocs {
+	for _, mappingDoc := range mappingDocs {
+		indexNameFound := false
+
+		for _, newIndexedAttributeCollection := range newIndexedAttributeCollections {
+			for _, newIndexedAttribute := range newIndexedAttributeCollection.IndexedAttributes {
+				if mappingDoc.AttributeName == newIndexedAttribute.Name {
+					indexNameFound = true
+					break
+				}
+			}
+		}
+
+		if !indexNameFound {
+			err := c.deleteMappingDocument(mappingDoc)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Store) deleteMappingDocument(mappingDoc indexMappingDocument) error {
+	err := c.coreStore.Delete(mappingDoc.MappingDocumentName)
+	if err != nil {
+		return err
+	}
+
+	c.uncacheMappingDocument(mappingDoc)
+
+	return nil
+}
+
+func (c *Store) getMappingDocuments(query string) ([]indexMappingDocument, error) {
+	return c.scanMappingDocuments(query, c.retrievalPageSize)
+}
+
+// scanMappingDocuments returns the mapping documents matching query. They're fetched from the database pageSize at a
+// time.
+func (c *Store) scanMappingDocuments(query string, pageSize uint) ([]indexMappingDocument, error) {
+	itr, err := c.coreStore.Query(query, storage.WithPageSize(int(pageSize)))
+	if err != nil {
+		return nil, err
+	}
+
+	moreEntries, err := itr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next entry from iterator: %w", err)
+	}
+
+	defer storage.Close(itr, c.log())
+
+	var mappingDocuments []indexMappingDocument
+
+	for moreEntries {
+		mappingDocumentBytes, valueErr := itr.Value()
+		if valueErr != nil {
+			return nil, valueErr
+		}
+
+		mappingDocument, errDecode := c.decodeMappingDocument(mappingDocumentBytes)
+		if errDecode != nil {
+			return nil, fmt.Errorf("failed to unmarshal mapping document bytes: %w", errDecode)
+		}
+
+		mappingDocuments = append(mappingDocuments, mappingDocument)
+
+		moreEntries, err = itr.Next()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return mappingDocuments, nil
+}
+
+func (c *Store) filterDocsByQuery(documentsToFilter []models.EncryptedDocument,
+	query *models.Query, matcher QueryMatcher) []models.EncryptedDocument {
+	var fullyMatchingDocuments []models.EncryptedDocument
+
+	for _, document := range documentsToFilter {
+		if documentMatchesQuery(document, query, matcher) {
+			fullyMatchingDocuments = append(fullyMatchingDocuments, document)
+		}
+	}
+
+	return fullyMatchingDocuments
+}
+
+// remove deletes the given document, or replaces it with a tombstone in tombstone mode. Tombstones don't count
+// towards the quotas of the vault's tenant. If currentDocument isn't nil, then the document is only deleted if it's
+// still stored as currentDocument (see deleteIf).
+func (c *Store) remove(docID string, currentDocument []byte) error {
+	refund, err := c.tenantRefund([]string{docID})
+	if err != nil {
+		return err
+	}
+
+	err = c.removeDocument(docID, currentDocument)
+	if err != nil {
+		return err
+	}
+
+	refund()
+
+	return nil
+}
+
+func (c *Store) removeDocument(docID string, currentDocument []byte) error {
+	if c.tombstoneRetention == 0 {
+		var outboxOps []storage.Operation
+
+		if c.outbox != nil {
+			sequence, err := c.getCurrentSequence(docID)
+			if err != nil {
+				return err
+			}
+
+			outboxOps, err = c.outboxOperations(models.DocumentDeletedVaultEvent, docID, sequence)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := c.deleteIf(docID, currentDocument, outboxOps)
+		if err != nil {
+			return err
+		}
+
+		return c.deleteRevisions(docID)
+	}
+
+	documentBytes, err := c.coreStore.Get(docID)
+	if err != nil {
+		return err
+	}
+
+	var document models.EncryptedDocument
+
+	err = json.Unmarshal(documentBytes, &document)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal document %s: %w", docID, err)
+	}
+
+	// The deletion time is the change stamp of the deletion (see ChangesSince).
+	deleted := time.Unix(0, nextChangeStamp()).UTC()
+
+	record := tombstoneRecord{
+		Tombstone: models.Tombstone{ID: docID, Sequence: document.Sequence, Deleted: deleted},
+		Document:  documentBytes,
+	}
+
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tombstone: %w", err)
+	}
+
+	tombstoneOp := storage.Operation{
+		Key: tombstoneKeyPrefix + docID, Value: recordBytes,
+		Tags: []storage.Tag{{Name: TombstoneTagName, Value: strconv.FormatInt(record.Deleted.Unix(), 10)}},
+	}
+
+	if currentDocument == nil {
+		// The tombstone is stored first, so that a failure part way through never loses the document.
+		err = c.coreStore.Put(tombstoneOp.Key, tombstoneOp.Value, tombstoneOp.Tags...)
+		if err != nil {
+			return fmt.Errorf("failed to store tombstone: %w", err)
+		}
+	}
+
+	outboxOps, err := c.outboxOperations(models.DocumentDeletedVaultEvent, docID, document.Sequence)
+	if err != nil {
+		return err
+	}
+
+	if currentDocument != nil {
+		// The tombstone is stored along with the deletion, so that it's only stored if the deletion is.
+		outboxOps = append([]storage.Operation{tombstoneOp}, outboxOps...)
+	}
+
+	return c.deleteIf(docID, currentDocument, outboxOps)
+}
+
+func (c *Store) getTombstoneRecord(docID string) (*tombstoneRecord, error) {
+	recordBytes, err := c.coreStore.Get(tombstoneKeyPrefix + docID)
+	if err != nil {
+		if errors.Is(err, storage.ErrDataNotFound) {
+			return nil, messages.ErrDocumentNotFound
+		}
+
+		return nil, fmt.Errorf("failed to get tombstone for document %s: %w", docID, err)
+	}
+
+	var record tombstoneRecord
+
+	err = json.Unmarshal(recordBytes, &record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal tombstone for document %s: %w", docID, err)
+	}
+
+	return &record, nil
+}
+
+// purgeTombstones deletes the tombstones whose retention window had passed at the given time, and whose deletions
+// are confirmed by policy if it isn't nil.
+func (c *Store) purgeTombstones(now time.Time, policy TombstoneCompactionPolicy) (int, error) {
+	itr, err := c.coreStore.Query(TombstoneTagName, storage.WithPageSize(int(c.retrievalPageSize)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to query tombstones: %w", err)
+	}
+
+	defer storage.Close(itr, c.log())
+
+	var expiredKeys []string
+
+	moreEntries, err := itr.Next()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get next entry from iterator: %w", err)
+	}
+
+	for moreEntries {
+		key, errKey := itr.Key()
+		if errKey != nil {
+			return 0, fmt.Errorf("failed to get key from iterator: %w", errKey)
+		}
+
+		tags, errTags := itr.Tags()
+		if errTags != nil {
+			return 0, fmt.Errorf("failed to get tags from iterator: %w", errTags)
+		}
+
+		expired, errExpired := c.tombstoneExpired(key, tags, now, policy)
+		if errExpired != nil {
+			return 0, errExpired
+		}
+
+		if expired {
+			expiredKeys = append(expiredKeys, key)
+		}
+
+		moreEntries, err = itr.Next()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get next entry from iterator: %w", err)
 		}
 	}
 
-	return nil
+	for i, key := range expiredKeys {
+		err = c.coreStore.Delete(key)
+		if err != nil {
+			return i, fmt.Errorf("failed to delete tombstone %s: %w", key, err)
+		}
+
+		err = c.deleteRevisions(strings.TrimPrefix(key, tombstoneKeyPrefix))
+		if err != nil {
+			return i + 1, err
+		}
+	}
+
+	return len(expiredKeys), nil
 }
 
-// createMappingDocument creates a document with a mapping of the encrypted index to the document that has it.
-func (c *Store) createMappingDocument(indexedAttribute models.IndexedAttribute,
-	encryptedDocID string) *indexMappingDocument {
-	mappingDocumentName := encryptedDocID + "_mapping_" + indexedAttribute.Name + "-" + indexedAttribute.Value
+// tombstoneExpired returns whether the tombstone with the given key and tags had expired at the given time.
+func (c *Store) tombstoneExpired(key string, tags []storage.Tag, now time.Time,
+	policy TombstoneCompactionPolicy) (bool, error) {
+	for _, tag := range tags {
+		if tag.Name != TombstoneTagName {
+			continue
+		}
 
-	mapDocument := indexMappingDocument{
-		AttributeName:          indexedAttribute.Name,
-		MatchingEncryptedDocID: encryptedDocID,
-		MappingDocumentName:    mappingDocumentName,
+		deleted, err := strconv.ParseInt(tag.Value, 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid tombstone tag on %s: %w", key, err)
+		}
+
+		if now.Sub(time.Unix(deleted, 0)) <= c.tombstoneRetention {
+			return false, nil
+		}
+
+		return deletionConfirmed(policy, c.name, strings.TrimPrefix(key, tombstoneKeyPrefix))
 	}
 
-	return &mapDocument
+	return false, nil
 }
 
-// createMappingDocument creates a document with a mapping of the encrypted index to the document that has it.
-func (c *Store) createAndStoreMappingDocument(indexedAttributeName, encryptedDocID string) error {
-	mappingDocumentName := encryptedDocID + "_mapping_" + uuid.New().String()
-
-	mapDocument := indexMappingDocument{
-		AttributeName:          indexedAttributeName,
-		MatchingEncryptedDocID: encryptedDocID,
-		MappingDocumentName:    mappingDocumentName,
+func deletionConfirmed(policy TombstoneCompactionPolicy, vaultID, docID string) (bool, error) {
+	if policy == nil {
+		return true, nil
 	}
 
-	documentBytes, err := json.Marshal(mapDocument)
+	confirmed, err := policy.DeletionConfirmed(vaultID, docID)
 	if err != nil {
-		return err
+		return false, fmt.Errorf("failed to determine whether deletion of document %s is confirmed: %w", docID, err)
 	}
 
-	logger.Debugf(`Creating mapping document in EDV "%s":
-Name: %s,
-Contents: %s`, c.name, mappingDocumentName, documentBytes)
-
-	return c.coreStore.Put(mappingDocumentName, documentBytes, storage.Tag{
-		Name:  MappingDocumentTagName,
-		Value: mapDocument.AttributeName,
-	}, storage.Tag{
-		Name:  MappingDocumentMatchingEncryptedDocIDTagName,
-		Value: mapDocument.MatchingEncryptedDocID,
-	})
+	return confirmed, nil
 }
 
-// updateMappingDocuments first queries mapping document names and indexNames with matching encrypted document ID.
-// Then we delete the mapping documents belonging to indexNames that are removed from the update
-// and create the mapping documents belonging to indexNames that are newly added.
-func (c *Store) updateMappingDocuments(encryptedDocID string,
-	newIndexedAttributeCollections []models.IndexedAttributeCollection) error {
-	mappingDocuments, err := c.getMappingDocuments(fmt.Sprintf("%s:%s",
-		MappingDocumentMatchingEncryptedDocIDTagName, encryptedDocID))
+// deleteIf deletes the given document and its mapping documents, like delete. If currentDocument isn't nil, then the
+// document is only deleted if it's still stored as currentDocument (see writeIf), and its mapping documents are only
+// deleted once it has been, so that they're never missing for a version of the document written by another EDV
+// server in the meantime.
+func (c *Store) deleteIf(docID string, currentDocument []byte, outboxOps []storage.Operation) error {
+	if currentDocument == nil {
+		return c.delete(docID, outboxOps)
+	}
+
+	err := c.writeIf(currentDocument, storage.Operation{Key: docID}, outboxOps)
 	if err != nil {
 		return err
 	}
 
-	if err := c.checkAndCleanUpOldMappingDocuments(newIndexedAttributeCollections,
-		mappingDocuments); err != nil {
+	return c.deleteMappingDocumentsAndUniqueIndexes(docID)
+}
+
+// delete deletes the given document and its mapping documents. The document is deleted in the same batch as the
+// given outbox operations.
+func (c *Store) delete(docID string, outboxOps []storage.Operation) error {
+	err := c.deleteMappingDocumentsAndUniqueIndexes(docID)
+	if err != nil {
 		return err
 	}
 
-	return c.checkAndCreateNewMappingDocuments(encryptedDocID, newIndexedAttributeCollections, mappingDocuments)
+	return c.write(storage.Operation{Key: docID}, outboxOps)
 }
 
-// checkAndCreateNewMappingDocuments checks if an indexName from the new indexedAttributeCollections already exists
-// before the update, if not, create a mapping document for it.
-func (c *Store) checkAndCreateNewMappingDocuments(encryptedDocID string,
-	newIndexedAttributeCollections []models.IndexedAttributeCollection, mappingDocs []indexMappingDocument) error {
-	for _, newIndexedAttributeCollection := range newIndexedAttributeCollections {
-		for _, newIndexAttribute := range newIndexedAttributeCollection.IndexedAttributes {
-			indexNameFound := false
-
-			for _, mappingDoc := range mappingDocs {
-				if mappingDoc.AttributeName == newIndexAttribute.Name {
-					indexNameFound = true
-					break
-				}
-			}
+// deleteMappingDocumentsAndUniqueIndexes deletes the mapping documents and unique index registry entries of the
+// given document.
+func (c *Store) deleteMappingDocumentsAndUniqueIndexes(docID string) error {
+	mappingDocs, err := c.getMappingDocuments(documentIDQuery(MappingDocumentMatchingEncryptedDocIDTagName, docID))
+	if err != nil {
+		return fmt.Errorf("failed to get mapping documents: %w", err)
+	}
 
-			if !indexNameFound {
-				if err := c.createAndStoreMappingDocument(newIndexAttribute.Name, encryptedDocID); err != nil {
-					return err
-				}
-			}
+	for _, mappingDoc := range mappingDocs {
+		err := c.deleteMappingDocument(mappingDoc)
+		if err != nil {
+			return fmt.Errorf(messages.DeleteMappingDocumentFailure, err)
 		}
 	}
 
-	return nil
+	return c.deleteUniqueIndexes(docID)
 }
 
-// checkAndCleanUpOldMappingDocuments checks if the existing indexNames still exist after the update and
-// deletes mapping documents of those that should no longer exist.
-func (c *Store) checkAndCleanUpOldMappingDocuments(
-	newIndexedAttributeCollections []models.IndexedAttributeCollection, mappingDocs []indexMappingDocument) error {
-	// for mappingDocName, oldIndexName := range mappingDocs {
-	for _, mappingDoc := range mappingDocs {
-		indexNameFound := false
+// deleteAll deletes every encrypted document in the store along with the mapping documents, tombstones, unique
+// index registry and outbox.
+// Documents without an EncryptedDocumentSequenceTagName tag are found through their mapping documents.
+func (c *Store) deleteAll() error {
+	documentSequences, err := c.DocumentSequences()
+	if err != nil {
+		return fmt.Errorf("failed to get documents in vault: %w", err)
+	}
 
-		for _, newIndexedAttributeCollection := range newIndexedAttributeCollections {
-			for _, newIndexedAttribute := range newIndexedAttributeCollection.IndexedAttributes {
-				if mappingDoc.AttributeName == newIndexedAttribute.Name {
-					indexNameFound = true
-					break
-				}
-			}
-		}
+	mappingDocuments, err := c.getMappingDocuments(MappingDocumentTagName)
+	if err != nil {
+		return fmt.Errorf("failed to get mapping documents: %w", err)
+	}
 
-		if !indexNameFound {
-			err := c.deleteMappingDocument(mappingDoc.MappingDocumentName)
-			if err != nil {
-				return err
-			}
+	keys := make(map[string]struct{}, len(documentSequences)+len(mappingDocuments))
+
+	for docID := range documentSequences {
+		keys[docID] = struct{}{}
+	}
+
+	for _, mappingDocument := range mappingDocuments {
+		keys[mappingDocument.MappingDocumentName] = struct{}{}
+		keys[mappingDocument.MatchingEncryptedDocID] = struct{}{}
+	}
+
+	tombstoneKeys, err := entryKeys(c.coreStore, TombstoneTagName, c.retrievalPageSize, c.log())
+	if err != nil {
+		return fmt.Errorf("failed to get tombstones: %w", err)
+	}
+
+	for _, key := range tombstoneKeys {
+		keys[key] = struct{}{}
+	}
+
+	sideEntryKeys, err := c.sideEntryKeys()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range sideEntryKeys {
+		keys[key] = struct{}{}
+	}
+
+	keys[uniqueIndexRegistryKey] = struct{}{}
+	keys[changeTagsKey] = struct{}{}
+
+	for key := range keys {
+		err = c.coreStore.Delete(key)
+		if err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+			return fmt.Errorf("failed to delete %s: %w", key, err)
 		}
 	}
 
+	c.log().Infof("Deleted %d entries in vault %s", len(keys), c.name)
+
 	return nil
 }
 
-func (c *Store) deleteMappingDocument(mappingDocName string) error {
-	return c.coreStore.Delete(mappingDocName)
+// sideEntryKeys returns the keys of the entries that are stored alongside the vault's documents: its unique index
+// entries, outbox entries, revisions and indexing queue entries.
+func (c *Store) sideEntryKeys() ([]string, error) {
+	uniqueIndexKeys, err := entryKeys(c.coreStore, UniqueIndexTagName, c.retrievalPageSize, c.log())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unique index entries: %w", err)
+	}
+
+	outboxKeys, err := entryKeys(c.coreStore, OutboxTagName, c.retrievalPageSize, c.log())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get outbox entries: %w", err)
+	}
+
+	revisionKeys, err := entryKeys(c.coreStore, RevisionTagName, c.retrievalPageSize, c.log())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revisions: %w", err)
+	}
+
+	indexingQueueKeys, err := entryKeys(c.coreStore, IndexingQueueTagName, c.retrievalPageSize, c.log())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get indexing queue entries: %w", err)
+	}
+
+	return append(append(append(uniqueIndexKeys, outboxKeys...), revisionKeys...), indexingQueueKeys...), nil
 }
 
-func (c *Store) getMappingDocuments(query string) ([]indexMappingDocument, error) {
-	itr, err := c.coreStore.Query(query, storage.WithPageSize(int(c.retrievalPageSize)))
+// countEntries returns the number of entries in the store with the given tag, without getting their values.
+func (c *Store) countEntries(tagName string) (int, error) {
+	itr, err := c.coreStore.Query(tagName, storage.WithPageSize(int(c.retrievalPageSize)))
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
+	defer storage.Close(itr, c.log())
+
+	var count int
+
 	moreEntries, err := itr.Next()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get next entry from iterator: %w", err)
+		return 0, fmt.Errorf("failed to get next entry from iterator: %w", err)
 	}
 
-	defer storage.Close(itr, logger)
+	for moreEntries {
+		count++
 
-	var mappingDocuments []indexMappingDocument
+		moreEntries, err = itr.Next()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get next entry from iterator: %w", err)
+		}
+	}
 
-	for moreEntries {
-		mappingDocumentBytes, valueErr := itr.Value()
-		if valueErr != nil {
-			return nil, valueErr
+	return count, nil
+}
+
+func (c *Store) getCurrentSequence(docID string) (uint64, error) {
+	_, sequence, err := c.getCurrentDocument(docID)
+
+	return sequence, err
+}
+
+// getCurrentDocument returns the stored version of the given document, along with its sequence.
+func (c *Store) getCurrentDocument(docID string) ([]byte, uint64, error) {
+	currentDocBytes, err := c.coreStore.Get(docID)
+	if err != nil {
+		if errors.Is(err, storage.ErrDataNotFound) {
+			return nil, 0, messages.ErrDocumentNotFound
 		}
 
-		var mappingDocument indexMappingDocument
+		return nil, 0, fmt.Errorf("failed to get current version of document %s: %w", docID, err)
+	}
 
-		err = json.Unmarshal(mappingDocumentBytes, &mappingDocument)
-		if err != nil {
-			return nil, fmt.Errorf("failed to unmarshal mapping document bytes: %w", err)
+	var currentDoc models.EncryptedDocument
+
+	err = json.Unmarshal(currentDocBytes, &currentDoc)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to unmarshal current version of document %s: %w", docID, err)
+	}
+
+	return currentDocBytes, currentDoc.Sequence, nil
+}
+
+// entryKeys returns the keys of the entries in store with the given tag, without getting their values.
+func entryKeys(store storage.Store, tagName string, pageSize uint, logger logging.Logger) ([]string, error) {
+	itr, err := store.Query(tagName, storage.WithPageSize(int(pageSize)))
+	if err != nil {
+		return nil, err
+	}
+
+	defer storage.Close(itr, logger)
+
+	var keys []string
+
+	moreEntries, err := itr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next entry from iterator: %w", err)
+	}
+
+	for moreEntries {
+		key, errKey := itr.Key()
+		if errKey != nil {
+			return nil, fmt.Errorf("failed to get key from iterator: %w", errKey)
 		}
 
-		mappingDocuments = append(mappingDocuments, mappingDocument)
+		keys = append(keys, key)
 
 		moreEntries, err = itr.Next()
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("failed to get next entry from iterator: %w", err)
 		}
 	}
 
-	return mappingDocuments, nil
+	return keys, nil
 }
 
-func (c *Store) filterDocsByQuery(documentsToFilter []models.EncryptedDocument,
-	query *models.Query) []models.EncryptedDocument {
-	var fullyMatchingDocuments []models.EncryptedDocument
+func sequenceTag(sequence uint64) storage.Tag {
+	return storage.Tag{Name: EncryptedDocumentSequenceTagName, Value: strconv.FormatUint(sequence, 10)}
+}
 
-	for _, document := range documentsToFilter {
-		if documentMatchesQuery(document, query) {
-			fullyMatchingDocuments = append(fullyMatchingDocuments, document)
-		}
-	}
+func (c *Provider) determineStoreNameToUse(name string) (string, error) {
+	storeName, _, err := c.storeNameAndTenant(name)
 
-	return fullyMatchingDocuments
+	return storeName, err
 }
 
-func (c *Provider) determineStoreNameToUse(name string) (string, error) {
+// storeNameAndTenant returns the name of the underlying store for the given store, along with the tenant that it's
+// bound to if it's a vault in multi-tenant mode. The stores of a tenant's vaults are prefixed with the tenant's ID.
+func (c *Provider) storeNameAndTenant(name string) (string, string, error) {
 	storeName := name
 
 	if c.checkIfBase58Encoded128BitValue(name) == nil {
 		storeNameString, err := c.base58Encoded128BitToUUID(name)
 		if err != nil {
-			return "", fmt.Errorf("failed to generate UUID from base 58 encoded 128 bit name: %w", err)
+			return "", "", fmt.Errorf("failed to generate UUID from base 58 encoded 128 bit name: %w", err)
 		}
 
 		storeName = storeNameString
 	}
 
-	return storeName, nil
+	tenantID, err := c.vaultTenant(name)
+	if err != nil {
+		return "", "", err
+	}
+
+	if tenantID != "" {
+		storeName = tenantID + "_" + storeName
+	}
+
+	return storeName, tenantID, nil
 }
 
-func documentMatchesQuery(document models.EncryptedDocument, query *models.Query) bool {
+// documentMatchesQuery returns whether one of the document's indexed attribute collections satisfies the query.
+// Only the collections whose HMAC key has the query's HMAC key ID are checked if the query has one.
+func documentMatchesQuery(document models.EncryptedDocument, query *models.Query, matcher QueryMatcher) bool {
 	for _, indexedAttributeCollection := range document.IndexedAttributeCollections {
-		if attributeCollectionSatisfiesQuery(indexedAttributeCollection, query) {
+		if query.HMACKeyID != "" && indexedAttributeCollection.HMAC.ID != query.HMACKeyID {
+			continue
+		}
+
+		if attributeCollectionSatisfiesQuery(indexedAttributeCollection, query, matcher) {
 			return true
 		}
 	}
@@ -659,12 +2449,33 @@ func documentMatchesQuery(document models.EncryptedDocument, query *models.Query
 	return false
 }
 
-func attributeCollectionSatisfiesQuery(attrCollection models.IndexedAttributeCollection, query *models.Query) bool {
+// attributeCollectionSatisfiesQuery returns whether one of the attributes in the collection satisfies the query. The
+// values of the query's attribute are matched with matcher if the query has an operator.
+func attributeCollectionSatisfiesQuery(attrCollection models.IndexedAttributeCollection, query *models.Query,
+	matcher QueryMatcher) bool {
 	for _, indexedAttribute := range attrCollection.IndexedAttributes {
-		if indexedAttribute.Name == query.Name {
-			if indexedAttribute.Value == query.Value {
+		if query.Has != "" {
+			if indexedAttribute.Name == query.Has {
 				return true
 			}
+
+			continue
+		}
+
+		if indexedAttribute.Name != query.Name {
+			continue
+		}
+
+		if matcher != nil {
+			if matcher.Matches(indexedAttribute.Value) {
+				return true
+			}
+
+			continue
+		}
+
+		if indexedAttribute.Value == query.Value {
+			return true
 		}
 	}
 
@@ -689,3 +2500,54 @@ func getDocumentIDsFromMappingDocumentsWithoutDuplicates(mappingDocuments []inde
 
 	return documentIDs
 }
+
+// documentLocks hands out per-key mutexes. Entries are reference counted and removed once no longer in use, so the
+// map only holds keys that are currently locked or waited on. The locks are shared by all vaults, so keys must come
+// from VaultNamespace.Key. A nil *documentLocks does no locking.
+type documentLocks struct {
+	mutex sync.Mutex
+	locks map[string]*documentLock
+}
+
+type documentLock struct {
+	sync.Mutex
+	references int
+}
+
+func newDocumentLocks() *documentLocks {
+	return &documentLocks{locks: make(map[string]*documentLock)}
+}
+
+// lock blocks until the lock for key is held and returns the function that releases it.
+func (d *documentLocks) lock(key string) func() {
+	if d == nil {
+		return func() {}
+	}
+
+	d.mutex.Lock()
+
+	keyLock, exists := d.locks[key]
+	if !exists {
+		keyLock = &documentLock{}
+		d.locks[key] = keyLock
+	}
+
+	keyLock.references++
+
+	d.mutex.Unlock()
+
+	keyLock.Lock()
+
+	return func() {
+		keyLock.Unlock()
+
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+
+		keyLock.references--
+
+		if keyLock.references == 0 {
+			delete(d.locks, key)
+		}
+	}
+}
@@ -10,7 +10,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
 	"github.com/hyperledger/aries-framework-go/component/storageutil/mock"
@@ -24,6 +26,7 @@ import (
 
 const (
 	testDocID1       = "VJYHHJx4C8J9Fsgz7rZqSp"
+	testDocID2       = "AJYHHJx4C8J9Fsgz7rZqSp"
 	testEncryptedDoc = `{
     "id": "` + testDocID1 + `",
     "sequence": 0,
@@ -392,6 +395,25 @@ func TestCouchDBEDVStore_Get(t *testing.T) {
 	require.Nil(t, value)
 }
 
+func TestCouchDBEDVStore_PutAndGetWithExtensions(t *testing.T) {
+	store, err := NewProvider(mem.NewProvider(), 100).OpenStore(testVaultID)
+	require.NoError(t, err)
+
+	document := createTestDocuments(t, testDocID1)[0]
+	document.Extensions = models.Extensions{"expires": json.RawMessage(`"2030-01-01T00:00:00Z"`)}
+
+	require.NoError(t, store.Put(document))
+
+	documentBytes, err := store.Get(testDocID1)
+	require.NoError(t, err)
+
+	var readDocument models.EncryptedDocument
+
+	require.NoError(t, json.Unmarshal(documentBytes, &readDocument))
+	require.Equal(t, document.ID, readDocument.ID)
+	require.Equal(t, document.Extensions, readDocument.Extensions)
+}
+
 func TestCouchDBEDVStore_Query(t *testing.T) {
 	t.Run("Success: no documents match query", func(t *testing.T) {
 		mockCoreStore := mock.Store{
@@ -575,6 +597,121 @@ func TestCouchDBEDVStore_Query(t *testing.T) {
 	})
 }
 
+func TestCouchDBEDVStore_QueryWithDeadline(t *testing.T) {
+	store, err := NewProvider(mem.NewProvider(), 100).OpenStore(testVaultID)
+	require.NoError(t, err)
+
+	for _, docID := range []string{testDocID1, testDocID2, testDocID3} {
+		err = store.Put(buildEncryptedDoc(docID, models.IndexedAttributeCollection{
+			IndexedAttributes: []models.IndexedAttribute{
+				{Name: testIndexName2, Value: docID},
+				{Name: testIndexName2, Value: "another value"},
+			},
+		}))
+		require.NoError(t, err)
+	}
+
+	query := models.Query{Has: testIndexName2, PageSize: 1}
+
+	t.Run("Deadline not reached: documents are ordered by ID, without duplicates", func(t *testing.T) {
+		page, err := store.QueryWithDeadline(&query, "", time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		require.False(t, page.Partial)
+		require.Equal(t, []string{testDocID2, testDocID3, testDocID1}, documentIDs(page.Documents))
+	})
+	t.Run("Deadline passed: partial results are returned", func(t *testing.T) {
+		page, err := store.QueryWithDeadline(&query, "", time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+		require.True(t, page.Partial)
+		require.Equal(t, testDocID2, page.ContinueAfter)
+		require.Equal(t, []string{testDocID2}, documentIDs(page.Documents))
+	})
+	t.Run("Continue after a document, while documents are created and deleted", func(t *testing.T) {
+		require.NoError(t, store.Delete(testDocID2))
+
+		// Created before the document to continue after, so it's left out.
+		err = store.Put(buildEncryptedDoc("1JYHHJx4C8J9Fsgz7rZqSp", models.IndexedAttributeCollection{
+			IndexedAttributes: []models.IndexedAttribute{{Name: testIndexName2, Value: "value"}},
+		}))
+		require.NoError(t, err)
+
+		page, err := store.QueryWithDeadline(&query, testDocID2, time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+		require.True(t, page.Partial)
+		require.Equal(t, testDocID3, page.ContinueAfter)
+		require.Equal(t, []string{testDocID3}, documentIDs(page.Documents))
+
+		page, err = store.QueryWithDeadline(&query, page.ContinueAfter, time.Time{})
+		require.NoError(t, err)
+		require.False(t, page.Partial)
+		require.Equal(t, []string{testDocID1}, documentIDs(page.Documents))
+	})
+	t.Run("Continue after the last document", func(t *testing.T) {
+		page, err := store.QueryWithDeadline(&query, testDocID1, time.Time{})
+		require.NoError(t, err)
+		require.False(t, page.Partial)
+		require.Empty(t, page.Documents)
+	})
+}
+
+func documentIDs(documents []models.EncryptedDocument) []string {
+	ids := make([]string, len(documents))
+
+	for i := range documents {
+		ids[i] = documents[i].ID
+	}
+
+	return ids
+}
+
+func TestCouchDBEDVStore_QueryWithHMACKeyID(t *testing.T) {
+	const (
+		oldHMACKeyID = "https://example.com/kms/old"
+		newHMACKeyID = "https://example.com/kms/new"
+	)
+
+	for _, withAttributeCache := range []bool{false, true} {
+		withAttributeCache := withAttributeCache
+
+		t.Run(fmt.Sprintf("with attribute cache: %t", withAttributeCache), func(t *testing.T) {
+			var options []Option
+			if withAttributeCache {
+				options = append(options, WithAttributeCache(NewMemAttributeCache(100)))
+			}
+
+			store, err := NewProvider(mem.NewProvider(), 100, options...).OpenStore(testVaultID)
+			require.NoError(t, err)
+
+			documents := createTestDocuments(t, testDocID1, testDocID2)
+
+			// The first document is indexed with both keys and the second one with the old key only, and the same
+			// attribute name and value are in the old key's collection of the first document and the new key's
+			// collection of the second one.
+			documents[0].IndexedAttributeCollections = []models.IndexedAttributeCollection{
+				{HMAC: models.IDTypePair{ID: oldHMACKeyID}, IndexedAttributes: []models.IndexedAttribute{
+					{Name: testIndexName2, Value: "value"},
+				}},
+				{HMAC: models.IDTypePair{ID: newHMACKeyID}, IndexedAttributes: []models.IndexedAttribute{
+					{Name: testIndexName3, Value: "value"},
+				}},
+			}
+			documents[1].IndexedAttributeCollections = []models.IndexedAttributeCollection{
+				{HMAC: models.IDTypePair{ID: oldHMACKeyID}, IndexedAttributes: []models.IndexedAttribute{
+					{Name: testIndexName3, Value: "value"},
+				}},
+			}
+
+			require.NoError(t, store.UpsertBulk(documents))
+
+			requireQueryMatches(t, store, &models.Query{Name: testIndexName3, Value: "value"}, testDocID1, testDocID2)
+			requireQueryMatches(t, store, &models.Query{Name: testIndexName3, Value: "value", HMACKeyID: newHMACKeyID},
+				testDocID1)
+			requireQueryMatches(t, store, &models.Query{Has: testIndexName3, HMACKeyID: oldHMACKeyID}, testDocID2)
+			requireQueryMatches(t, store, &models.Query{Has: testIndexName2, HMACKeyID: newHMACKeyID})
+		})
+	}
+}
+
 func TestCouchDBEDVStore_StoreDataVaultConfiguration(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		memCoreStore, err := mem.NewProvider().OpenStore("corestore")
@@ -634,12 +771,137 @@ func TestCouchDBEDVStore_StoreDataVaultConfiguration(t *testing.T) {
 	})
 }
 
+func TestProvider_VaultIDs(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+
+		configStore, err := provider.OpenStore(VaultConfigurationStoreName)
+		require.NoError(t, err)
+
+		vaultIDs, err := provider.VaultIDs()
+		require.NoError(t, err)
+		require.Empty(t, vaultIDs)
+
+		require.NoError(t, configStore.StoreDataVaultConfiguration(&models.DataVaultConfiguration{}, testVaultID))
+
+		vaultIDs, err = provider.VaultIDs()
+		require.NoError(t, err)
+		require.Equal(t, []string{testVaultID}, vaultIDs)
+	})
+	t.Run("Failure: error during query in config store", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{OpenStoreReturn: &mock.Store{ErrQuery: errors.New("query error")}}, 100)
+
+		_, err := provider.VaultIDs()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to get vaults")
+	})
+}
+
+func TestStore_UpdateDataVaultConfiguration(t *testing.T) {
+	createConfigStore := func(t *testing.T, referenceID string) *Store {
+		t.Helper()
+
+		configStore, err := NewProvider(mem.NewProvider(), 100).OpenStore(VaultConfigurationStoreName)
+		require.NoError(t, err)
+
+		err = configStore.StoreDataVaultConfiguration(&models.DataVaultConfiguration{
+			Controller: "did:example:controller", Invoker: []string{"did:example:invoker"}, ReferenceID: referenceID,
+		}, testVaultID)
+		require.NoError(t, err)
+
+		return configStore
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		configStore := createConfigStore(t, testReferenceID)
+
+		controller, invokers, delegators := "did:example:newcontroller", []string{}, []string{"did:example:delegator"}
+		sequence := uint64(1)
+
+		config, err := configStore.UpdateDataVaultConfiguration(testVaultID, &models.DataVaultConfigurationUpdate{
+			Sequence: &sequence, Controller: &controller, Invoker: &invokers, Delegator: &delegators,
+		})
+		require.NoError(t, err)
+		require.Equal(t, &models.DataVaultConfiguration{
+			Sequence: 1, Controller: controller, Invoker: invokers, Delegator: delegators, ReferenceID: testReferenceID,
+		}, config)
+
+		// Fields that are left out aren't changed, but the sequence is still incremented.
+		config, err = configStore.UpdateDataVaultConfiguration(testVaultID, &models.DataVaultConfigurationUpdate{})
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), config.Sequence)
+		require.Equal(t, controller, config.Controller)
+		require.Equal(t, delegators, config.Delegator)
+	})
+	t.Run("Reference ID can be set if the vault doesn't have one", func(t *testing.T) {
+		configStore := createConfigStore(t, "")
+
+		referenceID := "newReferenceID"
+
+		config, err := configStore.UpdateDataVaultConfiguration(testVaultID,
+			&models.DataVaultConfigurationUpdate{ReferenceID: &referenceID})
+		require.NoError(t, err)
+		require.Equal(t, referenceID, config.ReferenceID)
+
+		// The reference ID is now taken.
+		err = configStore.StoreDataVaultConfiguration(&models.DataVaultConfiguration{ReferenceID: referenceID},
+			"AnotherVault")
+		require.EqualError(t, err, fmt.Errorf(messages.CheckDuplicateRefIDFailure, messages.ErrDuplicateVault).Error())
+
+		// Sending the same reference ID again isn't a change.
+		_, err = configStore.UpdateDataVaultConfiguration(testVaultID,
+			&models.DataVaultConfigurationUpdate{ReferenceID: &referenceID})
+		require.NoError(t, err)
+	})
+	t.Run("Reference ID can't be changed", func(t *testing.T) {
+		configStore := createConfigStore(t, testReferenceID)
+
+		referenceID := "newReferenceID"
+
+		_, err := configStore.UpdateDataVaultConfiguration(testVaultID,
+			&models.DataVaultConfigurationUpdate{ReferenceID: &referenceID})
+		require.True(t, errors.Is(err, messages.ErrReferenceIDImmutable))
+	})
+	t.Run("Reference ID is used by another vault", func(t *testing.T) {
+		configStore := createConfigStore(t, "")
+
+		err := configStore.StoreDataVaultConfiguration(&models.DataVaultConfiguration{ReferenceID: testReferenceID},
+			"AnotherVault")
+		require.NoError(t, err)
+
+		referenceID := testReferenceID
+
+		_, err = configStore.UpdateDataVaultConfiguration(testVaultID,
+			&models.DataVaultConfigurationUpdate{ReferenceID: &referenceID})
+		require.True(t, errors.Is(err, messages.ErrDuplicateVault))
+	})
+	t.Run("Sequence conflict", func(t *testing.T) {
+		configStore := createConfigStore(t, testReferenceID)
+
+		sequence := uint64(2)
+
+		_, err := configStore.UpdateDataVaultConfiguration(testVaultID,
+			&models.DataVaultConfigurationUpdate{Sequence: &sequence})
+		require.True(t, errors.Is(err, messages.ErrConfigurationSequenceConflict))
+		require.EqualError(t, err, fmt.Sprintf("%s: expected new sequence 1 but got 2",
+			messages.ErrConfigurationSequenceConflict))
+	})
+	t.Run("Vault not found", func(t *testing.T) {
+		configStore, err := NewProvider(mem.NewProvider(), 100).OpenStore(VaultConfigurationStoreName)
+		require.NoError(t, err)
+
+		_, err = configStore.UpdateDataVaultConfiguration(testVaultID, &models.DataVaultConfigurationUpdate{})
+		require.True(t, errors.Is(err, messages.ErrVaultNotFound))
+	})
+}
+
 func TestCouchDBEDVStore_Update(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
-		memCoreStore, err := mem.NewProvider().OpenStore("corestore")
+		store, err := NewProvider(mem.NewProvider(), 100).OpenStore(testVaultID)
 		require.NoError(t, err)
 
-		store := Store{coreStore: memCoreStore, retrievalPageSize: 100}
+		err = store.Put(buildEncryptedDoc(testDocID1, models.IndexedAttributeCollection{}))
+		require.NoError(t, err)
 
 		documentIndexedAttribute2 := buildIndexedAttribute(testIndexName2)
 		documentIndexedAttribute3 := buildIndexedAttribute(testIndexName3)
@@ -650,12 +912,101 @@ func TestCouchDBEDVStore_Update(t *testing.T) {
 		}
 
 		newDoc := buildEncryptedDoc(testDocID1, indexedAttributeCollection2)
+		newDoc.Sequence = 1
 
 		err = store.Update(newDoc)
 		require.NoError(t, err)
 	})
+	t.Run("Failure - document does not exist", func(t *testing.T) {
+		store, err := NewProvider(mem.NewProvider(), 100).OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		err = store.Update(buildEncryptedDoc(testDocID1, models.IndexedAttributeCollection{}))
+		require.Equal(t, messages.ErrDocumentNotFound, err)
+	})
+	t.Run("Failure - sequence is not one greater than the current sequence", func(t *testing.T) {
+		store, err := NewProvider(mem.NewProvider(), 100).OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		err = store.Put(buildEncryptedDoc(testDocID1, models.IndexedAttributeCollection{}))
+		require.NoError(t, err)
+
+		newDoc := buildEncryptedDoc(testDocID1, models.IndexedAttributeCollection{})
+		newDoc.Sequence = 2
+
+		err = store.Update(newDoc)
+		require.True(t, errors.Is(err, messages.ErrDocumentSequenceConflict))
+		require.EqualError(t, err, "document has been modified by another request: expected new sequence 1 but got 2")
+	})
+	t.Run("Failure - error while getting current document", func(t *testing.T) {
+		store := &Store{coreStore: &mock.Store{QueryReturn: &mockIterator{}, ErrGet: errors.New("get failure")}}
+
+		err := store.Update(buildEncryptedDoc(testDocID1, models.IndexedAttributeCollection{}))
+		require.EqualError(t, err, "failed to get current version of document VJYHHJx4C8J9Fsgz7rZqSp: get failure")
+	})
+	t.Run("Failure - current document is invalid", func(t *testing.T) {
+		store := &Store{coreStore: &mock.Store{QueryReturn: &mockIterator{}, GetReturn: []byte("notAnEncryptedDocument")}}
+
+		err := store.Update(buildEncryptedDoc(testDocID1, models.IndexedAttributeCollection{}))
+		require.EqualError(t, err, "failed to unmarshal current version of document VJYHHJx4C8J9Fsgz7rZqSp: "+
+			"invalid character 'o' in literal null (expecting 'u')")
+	})
+	t.Run("Concurrent updates based on the same sequence", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+
+		store, err := provider.OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		err = store.Put(buildEncryptedDoc(testDocID1, models.IndexedAttributeCollection{}))
+		require.NoError(t, err)
+
+		const numUpdates = 10
+
+		errs := make(chan error, numUpdates)
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < numUpdates; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				// Each update goes through its own Store to mirror how the REST handlers open a store per request.
+				updateStore, errOpen := provider.OpenStore(testVaultID)
+				if errOpen != nil {
+					errs <- errOpen
+					return
+				}
+
+				newDoc := buildEncryptedDoc(testDocID1, models.IndexedAttributeCollection{})
+				newDoc.Sequence = 1
+
+				errs <- updateStore.Update(newDoc)
+			}()
+		}
+
+		wg.Wait()
+		close(errs)
+
+		var numSucceeded, numConflicted int
+
+		for errUpdate := range errs {
+			switch {
+			case errUpdate == nil:
+				numSucceeded++
+			case errors.Is(errUpdate, messages.ErrDocumentSequenceConflict):
+				numConflicted++
+			default:
+				require.NoError(t, errUpdate)
+			}
+		}
+
+		require.Equal(t, 1, numSucceeded)
+		require.Equal(t, numUpdates-1, numConflicted)
+	})
 	t.Run("Failure during encrypted document validation", func(t *testing.T) {
-		store := &Store{coreStore: &mock.Store{ErrQuery: errors.New("query failure")}}
+		store := &Store{coreStore: &mock.Store{ErrGet: storage.ErrDataNotFound, ErrQuery: errors.New("query failure")}}
 
 		err := store.Update(models.EncryptedDocument{
 			IndexedAttributeCollections: []models.IndexedAttributeCollection{
@@ -665,7 +1016,7 @@ func TestCouchDBEDVStore_Update(t *testing.T) {
 			},
 		})
 		require.EqualError(t, err, "failure during encrypted document validation: "+
-			"failed to query for documents: failed to get mapping documents: query failure")
+			"failed to build unique index registry: query failure")
 	})
 	t.Run("Fail to update mapping documents", func(t *testing.T) {
 		mockCoreStore := &mock.Store{
@@ -673,7 +1024,9 @@ func TestCouchDBEDVStore_Update(t *testing.T) {
 				maxTimesNextCanBeCalled: 1,
 				valueReturn:             []byte(testMappingDocument),
 			},
-			ErrDelete: errors.New("delete failure"),
+			GetReturn:     []byte(`{"id":"` + testDocID1 + `","sequence":0}`),
+			GetBulkReturn: [][]byte{[]byte(`{"id":"` + testDocID1 + `","sequence":0}`)},
+			ErrDelete:     errors.New("delete failure"),
 		}
 
 		store := &Store{coreStore: mockCoreStore}
@@ -687,6 +1040,7 @@ func TestCouchDBEDVStore_Update(t *testing.T) {
 		}
 
 		newDoc := buildEncryptedDoc(testDocID1, indexedAttributeCollection2)
+		newDoc.Sequence = 1
 
 		err := store.Update(newDoc)
 		require.EqualError(t, err, "failed to update mapping document for document VJYHHJx4C8J9Fsgz7rZqSp: "+
@@ -728,13 +1082,599 @@ func TestCouchDBEDVStore_Delete(t *testing.T) {
 	})
 }
 
+func TestCouchDBEDVStore_DeleteIfSequenceMatches(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store, err := NewProvider(mem.NewProvider(), 100).OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		err = store.Put(buildEncryptedDoc(testDocID1, models.IndexedAttributeCollection{}))
+		require.NoError(t, err)
+
+		err = store.DeleteIfSequenceMatches(testDocID1, 0)
+		require.NoError(t, err)
+
+		_, err = store.Get(testDocID1)
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+	t.Run("Failure - document does not exist", func(t *testing.T) {
+		store, err := NewProvider(mem.NewProvider(), 100).OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		err = store.DeleteIfSequenceMatches(testDocID1, 0)
+		require.Equal(t, messages.ErrDocumentNotFound, err)
+	})
+	t.Run("Failure - sequence doesn't match", func(t *testing.T) {
+		store, err := NewProvider(mem.NewProvider(), 100).OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		err = store.Put(buildEncryptedDoc(testDocID1, models.IndexedAttributeCollection{}))
+		require.NoError(t, err)
+
+		err = store.DeleteIfSequenceMatches(testDocID1, 1)
+		require.True(t, errors.Is(err, messages.ErrDocumentSequenceConflict))
+		require.EqualError(t, err, "document has been modified by another request: "+
+			"current sequence is 0 but the request expected 1")
+
+		_, err = store.Get(testDocID1)
+		require.NoError(t, err)
+	})
+}
+
+func TestCouchDBEDVStore_Tombstones(t *testing.T) {
+	t.Run("Deleted document is replaced with a tombstone", func(t *testing.T) {
+		store := createVaultWithDocuments(t, NewProvider(mem.NewProvider(), 100,
+			WithTombstoneRetention(time.Hour)))
+
+		err := store.Delete(testDocID1)
+		require.NoError(t, err)
+
+		_, err = store.Get(testDocID1)
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+
+		tombstone, err := store.Tombstone(testDocID1)
+		require.NoError(t, err)
+		require.Equal(t, testDocID1, tombstone.ID)
+		require.Equal(t, uint64(0), tombstone.Sequence)
+		require.WithinDuration(t, time.Now(), tombstone.Deleted, time.Minute)
+
+		documents, err := store.Query(&models.Query{Has: testIndexName2})
+		require.NoError(t, err)
+		require.Len(t, documents, 1)
+		require.Equal(t, testDocID2, documents[0].ID)
+
+		documentSequences, err := store.DocumentSequences()
+		require.NoError(t, err)
+		require.NotContains(t, documentSequences, testDocID1)
+	})
+	t.Run("No tombstone outside of tombstone mode", func(t *testing.T) {
+		store := createVaultWithDocuments(t, NewProvider(mem.NewProvider(), 100))
+
+		err := store.Delete(testDocID1)
+		require.NoError(t, err)
+
+		_, err = store.Tombstone(testDocID1)
+		require.Equal(t, messages.ErrDocumentNotFound, err)
+	})
+	t.Run("Delete with matching sequence also leaves a tombstone", func(t *testing.T) {
+		store := createVaultWithDocuments(t, NewProvider(mem.NewProvider(), 100,
+			WithTombstoneRetention(time.Hour)))
+
+		err := store.DeleteIfSequenceMatches(testDocID1, 0)
+		require.NoError(t, err)
+
+		_, err = store.Tombstone(testDocID1)
+		require.NoError(t, err)
+	})
+	t.Run("Fail to store tombstone", func(t *testing.T) {
+		mockCoreStore := mock.Store{
+			GetReturn: []byte(testEncryptedDoc),
+			ErrPut:    errors.New("put failure"),
+		}
+		store := Store{coreStore: &mockCoreStore, retrievalPageSize: 100, tombstoneRetention: time.Hour}
+
+		err := store.Delete(testDocID1)
+		require.EqualError(t, err, "failed to store tombstone: put failure")
+	})
+}
+
+func TestCouchDBEDVStore_Restore(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store := createVaultWithDocuments(t, NewProvider(mem.NewProvider(), 100,
+			WithTombstoneRetention(time.Hour)))
+
+		err := store.Delete(testDocID1)
+		require.NoError(t, err)
+
+		sequence, err := store.Restore(testDocID1)
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), sequence)
+
+		_, err = store.Get(testDocID1)
+		require.NoError(t, err)
+
+		documents, err := store.Query(&models.Query{Name: testIndexName2, Value: testDocID1})
+		require.NoError(t, err)
+		require.Len(t, documents, 1)
+
+		_, err = store.Tombstone(testDocID1)
+		require.Equal(t, messages.ErrDocumentNotFound, err)
+	})
+	t.Run("Failure - no tombstone", func(t *testing.T) {
+		store := createVaultWithDocuments(t, NewProvider(mem.NewProvider(), 100,
+			WithTombstoneRetention(time.Hour)))
+
+		_, err := store.Restore(testDocID1)
+		require.Equal(t, messages.ErrDocumentNotFound, err)
+	})
+	t.Run("Failure - retention window has passed", func(t *testing.T) {
+		store := createVaultWithDocuments(t, NewProvider(mem.NewProvider(), 100,
+			WithTombstoneRetention(time.Millisecond)))
+
+		err := store.Delete(testDocID1)
+		require.NoError(t, err)
+
+		time.Sleep(2 * time.Millisecond)
+
+		_, err = store.Restore(testDocID1)
+		require.True(t, errors.Is(err, messages.ErrDocumentNotFound))
+		require.Contains(t, err.Error(), "retention window")
+	})
+	t.Run("Failure - document was recreated", func(t *testing.T) {
+		store := createVaultWithDocuments(t, NewProvider(mem.NewProvider(), 100,
+			WithTombstoneRetention(time.Hour)))
+
+		err := store.Delete(testDocID1)
+		require.NoError(t, err)
+
+		err = store.Put(buildEncryptedDoc(testDocID1, models.IndexedAttributeCollection{}))
+		require.NoError(t, err)
+
+		_, err = store.Restore(testDocID1)
+		require.Equal(t, messages.ErrDuplicateDocument, err)
+	})
+	t.Run("Failure - invalid tombstone", func(t *testing.T) {
+		mockCoreStore := mock.Store{GetReturn: []byte("not JSON")}
+		store := Store{coreStore: &mockCoreStore, retrievalPageSize: 100, tombstoneRetention: time.Hour}
+
+		_, err := store.Restore(testDocID1)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to unmarshal tombstone for document")
+	})
+}
+
+func TestCouchDBEDVProvider_PurgeTombstones(t *testing.T) {
+	t.Run("Expired tombstones are removed", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100, WithTombstoneRetention(time.Millisecond))
+		store := createVaultWithDocuments(t, provider)
+
+		err := store.Delete(testDocID1)
+		require.NoError(t, err)
+
+		time.Sleep(2 * time.Millisecond)
+
+		purged, err := provider.PurgeTombstones(nil)
+		require.NoError(t, err)
+		require.Equal(t, 1, purged)
+
+		_, err = store.Tombstone(testDocID1)
+		require.Equal(t, messages.ErrDocumentNotFound, err)
+	})
+	t.Run("Tombstones within the retention window are kept", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100, WithTombstoneRetention(time.Hour))
+		store := createVaultWithDocuments(t, provider)
+
+		err := store.Delete(testDocID1)
+		require.NoError(t, err)
+
+		purged, err := provider.PurgeTombstones(nil)
+		require.NoError(t, err)
+		require.Equal(t, 0, purged)
+
+		_, err = store.Tombstone(testDocID1)
+		require.NoError(t, err)
+
+		purged, err = store.purgeTombstones(time.Now().Add(2*time.Hour), nil)
+		require.NoError(t, err)
+		require.Equal(t, 1, purged)
+	})
+	t.Run("Expired tombstones are kept until the compaction policy confirms their deletions", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100, WithTombstoneRetention(time.Hour))
+		store := createVaultWithDocuments(t, provider)
+
+		require.NoError(t, store.Delete(testDocID1))
+
+		policy := &mockCompactionPolicy{confirmed: map[string]bool{}}
+
+		purged, err := store.purgeTombstones(time.Now().Add(2*time.Hour), policy)
+		require.NoError(t, err)
+		require.Equal(t, 0, purged)
+		require.Equal(t, []string{store.name + " " + testDocID1}, policy.asked)
+
+		policy.confirmed[testDocID1] = true
+
+		purged, err = store.purgeTombstones(time.Now().Add(2*time.Hour), policy)
+		require.NoError(t, err)
+		require.Equal(t, 1, purged)
+	})
+	t.Run("Tombstones within the retention window aren't checked with the compaction policy", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100, WithTombstoneRetention(time.Hour))
+		store := createVaultWithDocuments(t, provider)
+
+		require.NoError(t, store.Delete(testDocID1))
+
+		policy := &mockCompactionPolicy{}
+
+		purged, err := provider.PurgeTombstones(policy)
+		require.NoError(t, err)
+		require.Equal(t, 0, purged)
+		require.Empty(t, policy.asked)
+	})
+	t.Run("Compaction policy fails", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100, WithTombstoneRetention(time.Hour))
+		store := createVaultWithDocuments(t, provider)
+
+		require.NoError(t, store.Delete(testDocID1))
+
+		_, err := store.purgeTombstones(time.Now().Add(2*time.Hour),
+			&mockCompactionPolicy{err: errors.New("checkpoint failure")})
+		require.EqualError(t, err, "failed to determine whether deletion of document "+testDocID1+
+			" is confirmed: checkpoint failure")
+	})
+	t.Run("Tombstone mode not enabled", func(t *testing.T) {
+		purged, err := NewProvider(&mock.Provider{ErrOpenStore: errors.New("open store failure")}, 100).
+			PurgeTombstones(nil)
+		require.NoError(t, err)
+		require.Equal(t, 0, purged)
+	})
+	t.Run("Fail to open store for vault configurations", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{ErrOpenStore: errors.New("open store failure")}, 100,
+			WithTombstoneRetention(time.Hour))
+
+		_, err := provider.PurgeTombstones(nil)
+		require.EqualError(t, err, "failed to open store for vault configurations: open store failure")
+	})
+	t.Run("Fail to query tombstones", func(t *testing.T) {
+		store := Store{coreStore: &mock.Store{ErrQuery: errors.New("query failure")}, retrievalPageSize: 100}
+
+		_, err := store.purgeTombstones(time.Now(), nil)
+		require.EqualError(t, err, "failed to query tombstones: query failure")
+	})
+}
+
+func TestCouchDBEDVProvider_CreateVaultStore(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+
+		err := provider.CreateVaultStore(testVaultID)
+		require.NoError(t, err)
+
+		exists, err := provider.StoreExists(testVaultID)
+		require.NoError(t, err)
+		require.True(t, exists)
+	})
+	t.Run("Fail to open store", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{ErrOpenStore: errors.New("open store failure")}, 100)
+
+		err := provider.CreateVaultStore(testVaultID)
+		require.EqualError(t, err, "failed to open store for vault: open store failure")
+	})
+	t.Run("Fail to set store config", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{
+			OpenStoreReturn:   &mock.Store{},
+			ErrSetStoreConfig: errors.New("set store config failure"),
+		}, 100)
+
+		err := provider.CreateVaultStore(testVaultID)
+		require.EqualError(t, err, "failed to set store config: set store config failure")
+	})
+}
+
+func TestCouchDBEDVProvider_DeleteStore(t *testing.T) {
+	t.Run("Success: every entry is deleted", func(t *testing.T) {
+		memProvider := mem.NewProvider()
+		provider := NewProvider(memProvider, 100)
+
+		store := createVaultWithDocuments(t, provider)
+
+		coreStore, err := memProvider.OpenStore(store.coreStoreName)
+		require.NoError(t, err)
+
+		err = provider.DeleteStore(testVaultID)
+		require.NoError(t, err)
+
+		exists, err := provider.StoreExists(testVaultID)
+		require.NoError(t, err)
+		require.False(t, exists)
+
+		_, err = coreStore.Get(testDocID1)
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+
+		itr, err := coreStore.Query(MappingDocumentTagName)
+		require.NoError(t, err)
+
+		moreEntries, err := itr.Next()
+		require.NoError(t, err)
+		require.False(t, moreEntries)
+
+		configStore, err := memProvider.OpenStore(VaultConfigurationStoreName)
+		require.NoError(t, err)
+
+		_, err = configStore.Get(testVaultID)
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+	t.Run("Success: the underlying database is deleted", func(t *testing.T) {
+		deletingProvider := &storeDeletingProvider{Provider: mem.NewProvider()}
+		provider := NewProvider(deletingProvider, 100)
+
+		store := createVaultWithDocuments(t, provider)
+
+		err := provider.DeleteStore(testVaultID)
+		require.NoError(t, err)
+		require.Equal(t, []string{store.coreStoreName}, deletingProvider.deletedStores)
+	})
+	t.Run("Fail to open store", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{ErrOpenStore: errors.New("open failure")}, 100)
+
+		err := provider.DeleteStore(testVaultID)
+		require.EqualError(t, err, "failed to open store for vault: open failure")
+	})
+	t.Run("Fail to get documents", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{
+			OpenStoreReturn: &mock.Store{ErrQuery: errors.New("query failure")},
+		}, 100)
+
+		err := provider.DeleteStore(testVaultID)
+		require.EqualError(t, err, "failed to get documents in vault: failed to query encrypted documents: "+
+			"query failure")
+	})
+	t.Run("Fail to close store", func(t *testing.T) {
+		provider := NewProvider(&storeDeletingProvider{Provider: &mock.Provider{
+			OpenStoreReturn: &mock.Store{ErrClose: errors.New("close failure")},
+		}}, 100)
+
+		err := provider.DeleteStore(testVaultID)
+		require.EqualError(t, err, "failed to close store: close failure")
+	})
+	t.Run("Fail to delete underlying database", func(t *testing.T) {
+		provider := NewProvider(&storeDeletingProvider{
+			Provider: mem.NewProvider(), errDeleteStore: errors.New("delete failure"),
+		}, 100)
+
+		err := provider.DeleteStore(testVaultID)
+		require.EqualError(t, err, "failed to delete store: delete failure")
+	})
+}
+
+func TestCouchDBEDVProvider_WarmUp(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+
+		createVaultWithDocuments(t, provider)
+
+		mappingDocumentCount, err := provider.WarmUp(testVaultID)
+		require.NoError(t, err)
+		require.Equal(t, 2, mappingDocumentCount)
+	})
+	t.Run("Vault not found", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+
+		_, err := provider.WarmUp(testVaultID)
+		require.Equal(t, messages.ErrVaultNotFound, err)
+
+		// Warming up a vault that doesn't exist mustn't create it.
+		exists, err := provider.StoreExists(testVaultID)
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+	t.Run("Fail to determine whether vault exists", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{ErrGetStoreConfig: errors.New("get store config failure")}, 100)
+
+		_, err := provider.WarmUp(testVaultID)
+		require.EqualError(t, err, "failed to determine whether vault exists: "+
+			"unexpected error while getting store config: get store config failure")
+	})
+	t.Run("Fail to query mapping documents", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{
+			OpenStoreReturn: &mock.Store{ErrQuery: errors.New("query failure")},
+		}, 100)
+
+		_, err := provider.WarmUp(testVaultID)
+		require.EqualError(t, err, "failed to query "+MappingDocumentTagName+" tag: query failure")
+	})
+	t.Run("Fail to get next entry", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{
+			OpenStoreReturn: &mock.Store{QueryReturn: &mockIterator{errNext: errors.New("next failure")}},
+		}, 100)
+
+		_, err := provider.WarmUp(testVaultID)
+		require.EqualError(t, err, "failed to query "+MappingDocumentTagName+" tag: "+
+			"failed to get next entry from iterator: next failure")
+	})
+}
+
+func TestCouchDBEDVStore_DocumentSequences(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store, err := NewProvider(mem.NewProvider(), 100).OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		err = store.Put(buildEncryptedDoc(testDocID1, models.IndexedAttributeCollection{}))
+		require.NoError(t, err)
+
+		updatedDoc := buildEncryptedDoc(testDocID1, models.IndexedAttributeCollection{})
+		updatedDoc.Sequence = 1
+
+		err = store.Update(updatedDoc)
+		require.NoError(t, err)
+
+		err = store.Put(buildEncryptedDoc("AJYHHJx4C8J9Fsgz7rZqSp", models.IndexedAttributeCollection{}))
+		require.NoError(t, err)
+
+		documentSequences, err := store.DocumentSequences()
+		require.NoError(t, err)
+		require.Equal(t, map[string]uint64{testDocID1: 1, "AJYHHJx4C8J9Fsgz7rZqSp": 0}, documentSequences)
+	})
+	t.Run("Invalid sequence tag", func(t *testing.T) {
+		memCoreStore, err := mem.NewProvider().OpenStore("corestore")
+		require.NoError(t, err)
+
+		err = memCoreStore.Put(testDocID1, []byte(testEncryptedDoc),
+			storage.Tag{Name: EncryptedDocumentSequenceTagName, Value: "not a number"})
+		require.NoError(t, err)
+
+		store := Store{coreStore: memCoreStore, retrievalPageSize: 100}
+
+		documentSequences, err := store.DocumentSequences()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid sequence tag on document "+testDocID1)
+		require.Nil(t, documentSequences)
+	})
+	t.Run("Fail to query", func(t *testing.T) {
+		store := Store{coreStore: &mock.Store{ErrQuery: errors.New("query failure")}, retrievalPageSize: 100}
+
+		documentSequences, err := store.DocumentSequences()
+		require.EqualError(t, err, "failed to query encrypted documents: query failure")
+		require.Nil(t, documentSequences)
+	})
+	t.Run("Fail to get next entry", func(t *testing.T) {
+		store := Store{
+			coreStore:         &mock.Store{QueryReturn: &mockIterator{errNext: errors.New("next failure")}},
+			retrievalPageSize: 100,
+		}
+
+		documentSequences, err := store.DocumentSequences()
+		require.EqualError(t, err, "failed to get next entry from iterator: next failure")
+		require.Nil(t, documentSequences)
+	})
+}
+
+func TestCouchDBEDVStore_ExportDocument(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store, err := NewProvider(mem.NewProvider(), 100).OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		err = store.Put(buildEncryptedDoc(testDocID1, models.IndexedAttributeCollection{
+			IndexedAttributes: []models.IndexedAttribute{buildIndexedAttribute(testIndexName2)},
+		}))
+		require.NoError(t, err)
+
+		replicatedDocument, err := store.ExportDocument(testDocID1)
+		require.NoError(t, err)
+		require.Len(t, replicatedDocument.MappingDocuments, 1)
+
+		storedDocument, err := store.Get(testDocID1)
+		require.NoError(t, err)
+		require.Equal(t, json.RawMessage(storedDocument), replicatedDocument.Document)
+	})
+	t.Run("Document not found", func(t *testing.T) {
+		store, err := NewProvider(mem.NewProvider(), 100).OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		replicatedDocument, err := store.ExportDocument(testDocID1)
+		require.Equal(t, messages.ErrDocumentNotFound, err)
+		require.Nil(t, replicatedDocument)
+	})
+	t.Run("Fail to get document", func(t *testing.T) {
+		store := Store{coreStore: &mock.Store{ErrGet: errors.New("get failure")}, retrievalPageSize: 100}
+
+		replicatedDocument, err := store.ExportDocument(testDocID1)
+		require.EqualError(t, err, "failed to get document "+testDocID1+": get failure")
+		require.Nil(t, replicatedDocument)
+	})
+	t.Run("Fail to get mapping documents", func(t *testing.T) {
+		store := Store{coreStore: &mock.Store{
+			GetReturn: []byte(testEncryptedDoc),
+			ErrQuery:  errors.New("query failure"),
+		}, retrievalPageSize: 100}
+
+		replicatedDocument, err := store.ExportDocument(testDocID1)
+		require.EqualError(t, err, "failed to get mapping documents for document "+testDocID1+": query failure")
+		require.Nil(t, replicatedDocument)
+	})
+}
+
+func TestCouchDBEDVStore_ImportDocument(t *testing.T) {
+	t.Run("Success - replaces the current version and its mapping documents", func(t *testing.T) {
+		sourceStore, err := NewProvider(mem.NewProvider(), 100).OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		err = sourceStore.Put(buildEncryptedDoc(testDocID1, models.IndexedAttributeCollection{
+			IndexedAttributes: []models.IndexedAttribute{buildIndexedAttribute(testIndexName2)},
+		}))
+		require.NoError(t, err)
+
+		replicatedDocument, err := sourceStore.ExportDocument(testDocID1)
+		require.NoError(t, err)
+
+		targetStore, err := NewProvider(mem.NewProvider(), 100).OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		err = targetStore.Put(buildEncryptedDoc(testDocID1, models.IndexedAttributeCollection{
+			IndexedAttributes: []models.IndexedAttribute{buildIndexedAttribute(testIndexName3)},
+		}))
+		require.NoError(t, err)
+
+		err = targetStore.ImportDocument(replicatedDocument)
+		require.NoError(t, err)
+
+		importedDocument, err := targetStore.ExportDocument(testDocID1)
+		require.NoError(t, err)
+		require.Equal(t, replicatedDocument, importedDocument)
+
+		documents, err := targetStore.Query(&models.Query{Name: testIndexName3})
+		require.NoError(t, err)
+		require.Empty(t, documents)
+	})
+	t.Run("Invalid document", func(t *testing.T) {
+		store, err := NewProvider(mem.NewProvider(), 100).OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		for _, replicatedDocument := range []models.ReplicatedDocument{
+			{Document: []byte("not json")},
+			{Document: []byte(`{}`)},
+			{Document: []byte(testEncryptedDoc), MappingDocuments: []json.RawMessage{[]byte("not json")}},
+			{Document: []byte(testEncryptedDoc), MappingDocuments: []json.RawMessage{
+				[]byte(`{"MatchingEncryptedDocID":"AnotherDoc","MappingDocumentName":"AnotherDoc_mapping_1"}`),
+			}},
+			{Document: []byte(testEncryptedDoc), MappingDocuments: []json.RawMessage{
+				[]byte(`{"MatchingEncryptedDocID":"` + testDocID1 + `","MappingDocumentName":"AnotherDoc"}`),
+			}},
+		} {
+			replicatedDocument := replicatedDocument
+
+			err = store.ImportDocument(&replicatedDocument)
+			require.True(t, errors.Is(err, messages.ErrInvalidReplicatedDocument))
+		}
+	})
+	t.Run("Fail to delete current version", func(t *testing.T) {
+		store := Store{
+			coreStore:         &mock.Store{ErrQuery: errors.New("query failure")},
+			retrievalPageSize: 100,
+			documentLocks:     newDocumentLocks(),
+		}
+
+		err := store.ImportDocument(&models.ReplicatedDocument{Document: []byte(testEncryptedDoc)})
+		require.EqualError(t, err, "failed to delete current version of document "+testDocID1+
+			": failed to get mapping documents: query failure")
+	})
+	t.Run("Fail to store document", func(t *testing.T) {
+		store := Store{
+			coreStore:         &mock.Store{QueryReturn: &mockIterator{}, ErrBatch: errors.New("batch failure")},
+			retrievalPageSize: 100,
+			documentLocks:     newDocumentLocks(),
+		}
+
+		err := store.ImportDocument(&models.ReplicatedDocument{Document: []byte(testEncryptedDoc)})
+		require.EqualError(t, err, "failed to store document "+testDocID1+" and its mapping documents: batch failure")
+	})
+}
+
 func TestCouchDBEDVStore_createAndStoreMappingDocument(t *testing.T) {
 	memCoreStore, err := mem.NewProvider().OpenStore("corestore")
 	require.NoError(t, err)
 
 	store := Store{coreStore: memCoreStore, retrievalPageSize: 100}
 
-	err = store.createAndStoreMappingDocument("", "")
+	err = store.createAndStoreMappingDocument("", "", "")
 	require.NoError(t, err)
 }
 
@@ -742,8 +1682,8 @@ func storeDocumentsWithEncryptedIndices(t *testing.T,
 	firstDocumentIndexedAttribute, secondDocumentIndexedAttribute models.IndexedAttribute) error {
 	t.Helper()
 
-	mockCoreStore := mock.Store{QueryReturn: &mockIterator{}}
-	store := Store{coreStore: &mockCoreStore, retrievalPageSize: 100}
+	store, err := NewProvider(mem.NewProvider(), 100).OpenStore(testVaultID)
+	require.NoError(t, err)
 
 	indexedAttributeCollection1 := models.IndexedAttributeCollection{
 		Sequence:          0,
@@ -756,24 +1696,10 @@ func storeDocumentsWithEncryptedIndices(t *testing.T,
 		IndexedAttributeCollections: []models.IndexedAttributeCollection{indexedAttributeCollection1},
 	}
 
-	testDoc1Bytes, err := json.Marshal(testDoc1)
+	// Stored without validation, since only the second document is being tested.
+	err = store.UpsertBulk([]models.EncryptedDocument{testDoc1})
 	require.NoError(t, err)
 
-	mockCoreStore.GetBulkReturn = [][]byte{testDoc1Bytes}
-
-	mappingDoc := indexMappingDocument{
-		AttributeName:          "indexName1",
-		MatchingEncryptedDocID: "someID1",
-	}
-
-	marshalledMappingDoc, err := json.Marshal(mappingDoc)
-	require.NoError(t, err)
-
-	mockCoreStore.QueryReturn = &mockIterator{
-		maxTimesNextCanBeCalled: 1,
-		valueReturn:             marshalledMappingDoc,
-	}
-
 	indexedAttributeCollection2 := models.IndexedAttributeCollection{
 		Sequence:          0,
 		HMAC:              models.IDTypePair{},
@@ -808,3 +1734,57 @@ func buildEncryptedDoc(id string, indexedAttributeCol models.IndexedAttributeCol
 
 	return doc
 }
+
+func createVaultWithDocuments(t *testing.T, provider *Provider) *Store {
+	t.Helper()
+
+	err := provider.CreateVaultStore(testVaultID)
+	require.NoError(t, err)
+
+	configStore, err := provider.OpenStore(VaultConfigurationStoreName)
+	require.NoError(t, err)
+
+	err = configStore.StoreDataVaultConfiguration(&models.DataVaultConfiguration{ReferenceID: testReferenceID},
+		testVaultID)
+	require.NoError(t, err)
+
+	store, err := provider.OpenStore(testVaultID)
+	require.NoError(t, err)
+
+	for _, docID := range []string{testDocID1, testDocID2} {
+		err = store.Put(buildEncryptedDoc(docID, models.IndexedAttributeCollection{
+			IndexedAttributes: []models.IndexedAttribute{{Name: testIndexName2, Value: docID}},
+		}))
+		require.NoError(t, err)
+	}
+
+	return store
+}
+
+type storeDeletingProvider struct {
+	storage.Provider
+	deletedStores  []string
+	errDeleteStore error
+}
+
+func (p *storeDeletingProvider) DeleteStore(name string) error {
+	if p.errDeleteStore != nil {
+		return p.errDeleteStore
+	}
+
+	p.deletedStores = append(p.deletedStores, name)
+
+	return nil
+}
+
+type mockCompactionPolicy struct {
+	confirmed map[string]bool
+	err       error
+	asked     []string
+}
+
+func (m *mockCompactionPolicy) DeletionConfirmed(vaultID, docID string) (bool, error) {
+	m.asked = append(m.asked, vaultID+" "+docID)
+
+	return m.confirmed[docID], m.err
+}
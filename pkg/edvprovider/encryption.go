@@ -0,0 +1,436 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/hyperledger/aries-framework-go/pkg/crypto"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const (
+	// DataKeyStoreName is the name of the store that holds the data keys of vaults, wrapped with the server's key
+	// encryption key (see WithEncryptionAtRest).
+	DataKeyStoreName = "data_keys"
+	// keyEncryptionKeyRecordKey is the key of the record of the current key encryption key in the data key store.
+	// Vault IDs are base58-encoded, so they never contain underscores.
+	keyEncryptionKeyRecordKey = "_key_encryption_key"
+	dataKeySize               = 32
+)
+
+// sealedPrefix starts every value that is encrypted with the data key of a vault. JSON values start with '{' and
+// CBOR mapping documents with a map header, so the values stored before encryption was enabled never start with it.
+var sealedPrefix = []byte("edv-sealed:") // nolint:gochecknoglobals
+
+var (
+	// errEncryptionNotEnabled is returned when the key encryption key is rotated on a provider that doesn't encrypt
+	// anything.
+	errEncryptionNotEnabled = errors.New("encryption at rest is not enabled")
+	// errSealedValue is returned when a provider without encryption at rest reads a value that was encrypted.
+	errSealedValue = errors.New("value is encrypted, but encryption at rest is not enabled")
+)
+
+// keyEncryptionKeyRecord holds the ID of the key in the KMS that new data keys are wrapped with.
+type keyEncryptionKeyRecord struct {
+	KeyID string `json:"keyId"`
+}
+
+// dataKeyRecord is stored for each vault that has a data key. The data key is encrypted with the key encryption key
+// that has the given ID, along with the vault's ID as additional data.
+type dataKeyRecord struct {
+	KeyEncryptionKeyID string `json:"keyEncryptionKeyId"`
+	WrappedKey         []byte `json:"wrappedKey"`
+	Nonce              []byte `json:"nonce"`
+}
+
+type encryption struct {
+	coreProvider storage.Provider
+	keyManager   kms.KeyManager
+	crypto       crypto.Crypto
+	// dataKeys caches the AEADs of the vaults' data keys by vault ID, so that the KMS is only used the first time that
+	// a vault's data key is needed.
+	dataKeys *sync.Map
+	// locks serializes the creation and rewrapping of each vault's data key, so that concurrent writes to a vault
+	// can't each create one. Like the document locks, they're local to this process.
+	locks *documentLocks
+}
+
+// WithEncryptionAtRest has the mapping documents and configurations of vaults encrypted before they're stored, so
+// that the HMAC values of their attribute names, the IDs of their documents and their controllers can't be read by
+// anyone with access to the database. Each vault gets a random data key the first time something of it is stored,
+// and its values are encrypted with AES-GCM. The data key is kept in the DataKeyStoreName store, wrapped with a key
+// encryption key that is created in keyManager and used with crypto. Values are decrypted transparently when they're
+// read, and the ones that were stored before encryption was enabled can still be read as they are.
+// The tags that mapping documents and configurations are looked up by aren't encrypted, since the database has to
+// match them.
+func WithEncryptionAtRest(keyManager kms.KeyManager, crypto crypto.Crypto) Option {
+	return func(p *Provider) {
+		p.encryption = &encryption{
+			coreProvider: p.coreProvider, keyManager: keyManager, crypto: crypto, dataKeys: &sync.Map{},
+			locks: newDocumentLocks(),
+		}
+	}
+}
+
+// EncryptionAtRestEnabled returns whether mapping documents and vault configurations are encrypted before they're
+// stored.
+func (c *Provider) EncryptionAtRestEnabled() bool {
+	return c.encryption != nil
+}
+
+// RotateEncryptionKey creates a new key encryption key in the KMS and rewraps the data key of every vault with it.
+// Data keys that are created from then on are wrapped with the new key. The stored values don't need to be encrypted
+// again, since the data keys themselves don't change. The previous key encryption key stays in the KMS, so that data
+// keys that couldn't be rewrapped can still be used, and the rotation can be repeated if it fails partway through.
+func (c *Provider) RotateEncryptionKey() (*models.EncryptionKeyRotation, error) {
+	if c.encryption == nil {
+		return nil, errEncryptionNotEnabled
+	}
+
+	err := c.background.begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer c.background.end()
+
+	keyID, err := c.encryption.createKeyEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+
+	configStore, err := c.coreProvider.OpenStore(VaultConfigurationStoreName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store for vault configurations: %w", err)
+	}
+
+	vaultIDs, err := entryKeys(configStore, VaultConfigReferenceIDTagName, c.retrievalPageSize, c.log())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vaults: %w", err)
+	}
+
+	rotation := &models.EncryptionKeyRotation{KeyID: keyID}
+
+	for _, vaultID := range vaultIDs {
+		rewrapped, errRewrap := c.encryption.rewrapDataKey(vaultID, keyID)
+		if errRewrap != nil {
+			return nil, fmt.Errorf("failed to rewrap data key of vault %s: %w", vaultID, errRewrap)
+		}
+
+		if rewrapped {
+			rotation.DataKeysRewrapped++
+		}
+	}
+
+	c.log().Infof("Rotated the key encryption key to %s and rewrapped %d data keys", keyID,
+		rotation.DataKeysRewrapped)
+
+	return rotation, nil
+}
+
+// seal encrypts the given value with the data key of the given vault, which is created if the vault doesn't have one
+// yet. The value is returned as it is if encryption at rest isn't enabled.
+func (e *encryption) seal(vaultID string, value []byte) ([]byte, error) {
+	if e == nil {
+		return value, nil
+	}
+
+	aead, err := e.dataKey(vaultID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := append(append(make([]byte, 0, len(sealedPrefix)+len(nonce)+len(value)+aead.Overhead()),
+		sealedPrefix...), nonce...)
+
+	return aead.Seal(sealed, nonce, value, []byte(vaultID)), nil
+}
+
+// open decrypts the given value of the given vault if it was encrypted by seal, and returns it as it is otherwise.
+func (e *encryption) open(vaultID string, value []byte) ([]byte, error) {
+	if !bytes.HasPrefix(value, sealedPrefix) {
+		return value, nil
+	}
+
+	if e == nil {
+		return nil, errSealedValue
+	}
+
+	aead, err := e.dataKey(vaultID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := value[len(sealedPrefix):]
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("encrypted value is too short")
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(vaultID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt value: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// dataKey returns the AEAD of the given vault's data key. If the vault doesn't have a data key, then one is created
+// if create is true, and an error is returned otherwise.
+func (e *encryption) dataKey(vaultID string, create bool) (cipher.AEAD, error) {
+	if aead, ok := e.dataKeys.Load(vaultID); ok {
+		return aead.(cipher.AEAD), nil
+	}
+
+	unlock := e.locks.lock(vaultID)
+	defer unlock()
+
+	// Another write may have created the data key while this one was waiting for the lock.
+	if aead, ok := e.dataKeys.Load(vaultID); ok {
+		return aead.(cipher.AEAD), nil
+	}
+
+	keyStore, err := e.coreProvider.OpenStore(DataKeyStoreName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store for data keys: %w", err)
+	}
+
+	var key []byte
+
+	recordBytes, err := keyStore.Get(vaultID)
+
+	switch {
+	case err == nil:
+		key, err = e.unwrapDataKey(vaultID, recordBytes)
+	case errors.Is(err, storage.ErrDataNotFound) && create:
+		key, err = e.createDataKey(keyStore, vaultID)
+	case errors.Is(err, storage.ErrDataNotFound):
+		return nil, fmt.Errorf("vault %s doesn't have a data key", vaultID)
+	default:
+		return nil, fmt.Errorf("failed to get data key of vault %s: %w", vaultID, err)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AEAD: %w", err)
+	}
+
+	e.dataKeys.Store(vaultID, aead)
+
+	return aead, nil
+}
+
+func (e *encryption) createDataKey(keyStore storage.Store, vaultID string) ([]byte, error) {
+	keyEncryptionKeyID, err := e.keyEncryptionKeyID(keyStore)
+	if err != nil {
+		return nil, err
+	}
+
+	key := make([]byte, dataKeySize)
+
+	_, err = io.ReadFull(rand.Reader, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	err = e.storeDataKey(keyStore, vaultID, key, keyEncryptionKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// rewrapDataKey wraps the data key of the given vault with the given key encryption key, and returns whether it was
+// rewrapped. Vaults that don't have a data key are skipped.
+func (e *encryption) rewrapDataKey(vaultID, keyEncryptionKeyID string) (bool, error) {
+	unlock := e.locks.lock(vaultID)
+	defer unlock()
+
+	keyStore, err := e.coreProvider.OpenStore(DataKeyStoreName)
+	if err != nil {
+		return false, fmt.Errorf("failed to open store for data keys: %w", err)
+	}
+
+	recordBytes, err := keyStore.Get(vaultID)
+	if err != nil {
+		if errors.Is(err, storage.ErrDataNotFound) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("failed to get data key of vault %s: %w", vaultID, err)
+	}
+
+	key, err := e.unwrapDataKey(vaultID, recordBytes)
+	if err != nil {
+		return false, err
+	}
+
+	err = e.storeDataKey(keyStore, vaultID, key, keyEncryptionKeyID)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// deleteDataKey deletes the data key of the given vault, so that its values can't be decrypted any more, even from
+// backups of the database that were made before the vault was deleted.
+func (e *encryption) deleteDataKey(vaultID string) error {
+	if e == nil {
+		return nil
+	}
+
+	unlock := e.locks.lock(vaultID)
+	defer unlock()
+
+	keyStore, err := e.coreProvider.OpenStore(DataKeyStoreName)
+	if err != nil {
+		return fmt.Errorf("failed to open store for data keys: %w", err)
+	}
+
+	err = keyStore.Delete(vaultID)
+	if err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+		return fmt.Errorf("failed to delete data key of vault %s: %w", vaultID, err)
+	}
+
+	e.dataKeys.Delete(vaultID)
+
+	return nil
+}
+
+func (e *encryption) storeDataKey(keyStore storage.Store, vaultID string, key []byte,
+	keyEncryptionKeyID string) error {
+	keyEncryptionKey, err := e.keyManager.Get(keyEncryptionKeyID)
+	if err != nil {
+		return fmt.Errorf("failed to get key encryption key %s: %w", keyEncryptionKeyID, err)
+	}
+
+	wrappedKey, nonce, err := e.crypto.Encrypt(key, []byte(vaultID), keyEncryptionKey)
+	if err != nil {
+		return fmt.Errorf("failed to wrap data key of vault %s: %w", vaultID, err)
+	}
+
+	recordBytes, err := json.Marshal(dataKeyRecord{
+		KeyEncryptionKeyID: keyEncryptionKeyID, WrappedKey: wrappedKey, Nonce: nonce,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal data key of vault %s: %w", vaultID, err)
+	}
+
+	err = keyStore.Put(vaultID, recordBytes)
+	if err != nil {
+		return fmt.Errorf("failed to store data key of vault %s: %w", vaultID, err)
+	}
+
+	return nil
+}
+
+func (e *encryption) unwrapDataKey(vaultID string, recordBytes []byte) ([]byte, error) {
+	var record dataKeyRecord
+
+	err := json.Unmarshal(recordBytes, &record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal data key of vault %s: %w", vaultID, err)
+	}
+
+	keyEncryptionKey, err := e.keyManager.Get(record.KeyEncryptionKeyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key encryption key %s: %w", record.KeyEncryptionKeyID, err)
+	}
+
+	key, err := e.crypto.Decrypt(record.WrappedKey, []byte(vaultID), record.Nonce, keyEncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key of vault %s: %w", vaultID, err)
+	}
+
+	return key, nil
+}
+
+// keyEncryptionKeyID returns the ID of the current key encryption key, which is created if there isn't one yet.
+func (e *encryption) keyEncryptionKeyID(keyStore storage.Store) (string, error) {
+	unlock := e.locks.lock(keyEncryptionKeyRecordKey)
+	defer unlock()
+
+	recordBytes, err := keyStore.Get(keyEncryptionKeyRecordKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrDataNotFound) {
+			return e.storeKeyEncryptionKey(keyStore)
+		}
+
+		return "", fmt.Errorf("failed to get key encryption key: %w", err)
+	}
+
+	var record keyEncryptionKeyRecord
+
+	err = json.Unmarshal(recordBytes, &record)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal key encryption key: %w", err)
+	}
+
+	return record.KeyID, nil
+}
+
+// createKeyEncryptionKey creates a key encryption key and makes it the current one.
+func (e *encryption) createKeyEncryptionKey() (string, error) {
+	unlock := e.locks.lock(keyEncryptionKeyRecordKey)
+	defer unlock()
+
+	keyStore, err := e.coreProvider.OpenStore(DataKeyStoreName)
+	if err != nil {
+		return "", fmt.Errorf("failed to open store for data keys: %w", err)
+	}
+
+	return e.storeKeyEncryptionKey(keyStore)
+}
+
+func (e *encryption) storeKeyEncryptionKey(keyStore storage.Store) (string, error) {
+	keyID, _, err := e.keyManager.Create(kms.AES256GCMType)
+	if err != nil {
+		return "", fmt.Errorf("failed to create key encryption key: %w", err)
+	}
+
+	recordBytes, err := json.Marshal(keyEncryptionKeyRecord{KeyID: keyID})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal key encryption key: %w", err)
+	}
+
+	err = keyStore.Put(keyEncryptionKeyRecordKey, recordBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to store key encryption key: %w", err)
+	}
+
+	return keyID, nil
+}
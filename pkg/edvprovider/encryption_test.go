@@ -0,0 +1,208 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/pkg/crypto/tinkcrypto"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	"github.com/hyperledger/aries-framework-go/pkg/kms/localkms"
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock"
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock/noop"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+type testKMSProvider struct {
+	storageProvider storage.Provider
+}
+
+func (p *testKMSProvider) StorageProvider() storage.Provider {
+	return p.storageProvider
+}
+
+func (p *testKMSProvider) SecretLock() secretlock.Service {
+	return &noop.NoLock{}
+}
+
+func TestProvider_EncryptionAtRest(t *testing.T) {
+	keyManager, err := localkms.New("local-lock://test/primary/key/", &testKMSProvider{mem.NewProvider()})
+	require.NoError(t, err)
+
+	crypto, err := tinkcrypto.New()
+	require.NoError(t, err)
+
+	// newStores stores a vault configuration and a document with the given provider options, and returns the stores
+	// for vault configurations and for the vault.
+	newStores := func(t *testing.T, coreProvider storage.Provider, opts ...Option) (*Store, *Store) {
+		t.Helper()
+
+		provider := NewProvider(coreProvider, 100, opts...)
+
+		configStore, errOpen := provider.OpenStore(VaultConfigurationStoreName)
+		require.NoError(t, errOpen)
+
+		vaultStore, errOpen := provider.OpenStore(testVaultID)
+		require.NoError(t, errOpen)
+
+		return configStore, vaultStore
+	}
+
+	t.Run("Mapping documents and configurations are encrypted", func(t *testing.T) {
+		coreProvider := mem.NewProvider()
+
+		configStore, vaultStore := newStores(t, coreProvider, WithEncryptionAtRest(keyManager, crypto))
+
+		require.NoError(t, configStore.StoreDataVaultConfiguration(&models.DataVaultConfiguration{
+			Controller: "did:example:controller", ReferenceID: testReferenceID,
+		}, testVaultID))
+		require.NoError(t, vaultStore.Put(createTestDocuments(t, testDocID1)[0]))
+
+		configBytes, err := configStore.coreStore.Get(testVaultID)
+		require.NoError(t, err)
+		require.True(t, bytes.HasPrefix(configBytes, sealedPrefix))
+		require.NotContains(t, string(configBytes), "did:example:controller")
+
+		mappingDocuments := getStoredMappingDocuments(t, vaultStore, testDocID1)
+		require.NotEmpty(t, mappingDocuments)
+
+		for _, mappingDocumentBytes := range mappingDocuments {
+			require.True(t, bytes.HasPrefix(mappingDocumentBytes, sealedPrefix))
+			require.NotContains(t, string(mappingDocumentBytes), testNonUniqueIndexName)
+		}
+
+		// Both are decrypted transparently.
+		requireQueryMatches(t, vaultStore, &models.Query{Has: testNonUniqueIndexName}, testDocID1)
+
+		config, err := configStore.UpdateDataVaultConfiguration(testVaultID, &models.DataVaultConfigurationUpdate{})
+		require.NoError(t, err)
+		require.Equal(t, "did:example:controller", config.Controller)
+		require.Equal(t, uint64(1), config.Sequence)
+
+		// The stored values can't be read without encryption at rest.
+		configStore, _ = newStores(t, coreProvider)
+
+		_, err = configStore.UpdateDataVaultConfiguration(testVaultID, &models.DataVaultConfigurationUpdate{})
+		require.True(t, errors.Is(err, errSealedValue))
+	})
+	t.Run("Values stored before encryption was enabled can still be read", func(t *testing.T) {
+		coreProvider := mem.NewProvider()
+
+		configStore, vaultStore := newStores(t, coreProvider)
+
+		require.NoError(t, configStore.StoreDataVaultConfiguration(&models.DataVaultConfiguration{
+			Controller: "did:example:controller", ReferenceID: testReferenceID,
+		}, testVaultID))
+		require.NoError(t, vaultStore.Put(createTestDocuments(t, testDocID1)[0]))
+
+		provider := NewProvider(coreProvider, 100, WithEncryptionAtRest(keyManager, crypto))
+
+		vaultStore, err := provider.OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		require.NoError(t, vaultStore.Put(createTestDocuments(t, testDocID2)[0]))
+		requireQueryMatches(t, vaultStore, &models.Query{Has: testNonUniqueIndexName}, testDocID1, testDocID2)
+
+		config, err := provider.VaultConfiguration(testVaultID)
+		require.NoError(t, err)
+		require.Equal(t, "did:example:controller", config.Controller)
+	})
+	t.Run("Rotating the encryption key rewraps the data keys", func(t *testing.T) {
+		coreProvider := mem.NewProvider()
+
+		configStore, _ := newStores(t, coreProvider, WithEncryptionAtRest(keyManager, crypto))
+
+		require.NoError(t, configStore.StoreDataVaultConfiguration(&models.DataVaultConfiguration{
+			Controller: "did:example:controller", ReferenceID: testReferenceID,
+		}, testVaultID))
+
+		provider := NewProvider(coreProvider, 100, WithEncryptionAtRest(keyManager, crypto))
+		require.True(t, provider.EncryptionAtRestEnabled())
+
+		previousKeyID, err := provider.encryption.keyEncryptionKeyID(getDataKeyStore(t, coreProvider))
+		require.NoError(t, err)
+
+		rotation, err := provider.RotateEncryptionKey()
+		require.NoError(t, err)
+		require.NotEqual(t, previousKeyID, rotation.KeyID)
+		require.Equal(t, 1, rotation.DataKeysRewrapped)
+
+		recordBytes, err := getDataKeyStore(t, coreProvider).Get(testVaultID)
+		require.NoError(t, err)
+		require.Contains(t, string(recordBytes), rotation.KeyID)
+
+		// A provider that hasn't cached the data key unwraps it with the new key.
+		config, err := NewProvider(coreProvider, 100, WithEncryptionAtRest(keyManager, crypto)).
+			VaultConfiguration(testVaultID)
+		require.NoError(t, err)
+		require.Equal(t, "did:example:controller", config.Controller)
+
+		_, err = NewProvider(coreProvider, 100).RotateEncryptionKey()
+		require.True(t, errors.Is(err, errEncryptionNotEnabled))
+	})
+	t.Run("Deleting a vault deletes its data key", func(t *testing.T) {
+		coreProvider := mem.NewProvider()
+
+		provider := NewProvider(coreProvider, 100, WithEncryptionAtRest(keyManager, crypto))
+
+		configStore, err := provider.OpenStore(VaultConfigurationStoreName)
+		require.NoError(t, err)
+
+		require.NoError(t, configStore.StoreDataVaultConfiguration(&models.DataVaultConfiguration{
+			Controller: "did:example:controller", ReferenceID: testReferenceID,
+		}, testVaultID))
+		require.NoError(t, provider.CreateVaultStore(testVaultID))
+
+		_, err = getDataKeyStore(t, coreProvider).Get(testVaultID)
+		require.NoError(t, err)
+
+		require.NoError(t, provider.DeleteStore(testVaultID))
+
+		_, err = getDataKeyStore(t, coreProvider).Get(testVaultID)
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+
+		_, err = provider.VaultConfiguration(testVaultID)
+		require.True(t, errors.Is(err, messages.ErrVaultNotFound))
+	})
+	t.Run("Fail to get key encryption key", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100, WithEncryptionAtRest(&failingKeyManager{keyManager}, crypto))
+
+		configStore, err := provider.OpenStore(VaultConfigurationStoreName)
+		require.NoError(t, err)
+
+		err = configStore.StoreDataVaultConfiguration(&models.DataVaultConfiguration{
+			Controller: "did:example:controller", ReferenceID: testReferenceID,
+		}, testVaultID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to get key encryption key")
+	})
+}
+
+// failingKeyManager creates keys that it then fails to get.
+type failingKeyManager struct {
+	kms.KeyManager
+}
+
+func (m *failingKeyManager) Get(string) (interface{}, error) {
+	return nil, errors.New("get error")
+}
+
+func getDataKeyStore(t *testing.T, coreProvider storage.Provider) storage.Store {
+	t.Helper()
+
+	keyStore, err := coreProvider.OpenStore(DataKeyStoreName)
+	require.NoError(t, err)
+
+	return keyStore
+}
@@ -0,0 +1,56 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// KeyCheckingStore can be implemented by the stores of a storage backend that can check whether a key exists without
+// reading its value or tags. Store.Exists uses it when the backend's stores implement it.
+type KeyCheckingStore interface {
+	// Exists returns whether the given key exists.
+	Exists(key string) (bool, error)
+}
+
+// Exists returns whether the document with the given ID exists, without reading or unmarshalling the document.
+// If the storage backend doesn't implement KeyCheckingStore, then only the document's tags are read.
+func (c *Store) Exists(docID string) (bool, error) {
+	if keyCheckingStore, ok := c.coreStore.(KeyCheckingStore); ok {
+		exists, err := keyCheckingStore.Exists(docID)
+		if err != nil {
+			return false, fmt.Errorf("failed to determine whether document %s exists: %w", docID, err)
+		}
+
+		return exists, nil
+	}
+
+	_, err := c.coreStore.GetTags(docID)
+	if errors.Is(err, storage.ErrDataNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to get tags of document %s: %w", docID, err)
+	}
+
+	return true, nil
+}
+
+// existsByTags returns whether the given key exists in store by reading its tags, for stores that don't implement
+// KeyCheckingStore.
+func existsByTags(store storage.Store, key string) (bool, error) {
+	_, err := store.GetTags(key)
+	if errors.Is(err, storage.ErrDataNotFound) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
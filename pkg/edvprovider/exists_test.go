@@ -0,0 +1,72 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mock"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Exists(t *testing.T) {
+	t.Run("The document's tags are checked if the backend can't check keys", func(t *testing.T) {
+		store := newStreamTestStore(t)
+
+		exists, err := store.Exists(testDocID1)
+		require.NoError(t, err)
+		require.False(t, exists)
+
+		require.NoError(t, store.Put(createTestDocuments(t, testDocID1)[0]))
+
+		exists, err = store.Exists(testDocID1)
+		require.NoError(t, err)
+		require.True(t, exists)
+	})
+	t.Run("Backends that can check keys are used", func(t *testing.T) {
+		coreStore := &keyCheckingCoreStore{Store: newTestCoreStore(t), keys: map[string]bool{testDocID1: true}}
+		store := &Store{coreStore: coreStore, name: testVaultID}
+
+		exists, err := store.Exists(testDocID1)
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		exists, err = store.Exists(testDocID2)
+		require.NoError(t, err)
+		require.False(t, exists)
+		require.Equal(t, []string{testDocID1, testDocID2}, coreStore.checked)
+	})
+	t.Run("Fail to check key", func(t *testing.T) {
+		coreStore := &keyCheckingCoreStore{Store: newTestCoreStore(t), err: errors.New("exists error")}
+		store := &Store{coreStore: coreStore, name: testVaultID}
+
+		_, err := store.Exists(testDocID1)
+		require.EqualError(t, err, "failed to determine whether document "+testDocID1+" exists: exists error")
+	})
+	t.Run("Fail to get tags", func(t *testing.T) {
+		store := &Store{coreStore: &mock.Store{ErrGetTags: errors.New("get tags error")}, name: testVaultID}
+
+		_, err := store.Exists(testDocID1)
+		require.EqualError(t, err, "failed to get tags of document "+testDocID1+": get tags error")
+	})
+}
+
+// keyCheckingCoreStore is a store that implements KeyCheckingStore, recording the keys that were checked.
+type keyCheckingCoreStore struct {
+	storage.Store
+	keys    map[string]bool
+	err     error
+	checked []string
+}
+
+func (s *keyCheckingCoreStore) Exists(key string) (bool, error) {
+	s.checked = append(s.checked, key)
+
+	return s.keys[key], s.err
+}
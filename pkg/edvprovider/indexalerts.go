@@ -0,0 +1,137 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"sync"
+	"time"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// IndexCorruptionAlerter is told about vaults whose encrypted indices were found to be inconsistent with their
+// documents, so that operators can be paged before users notice missing query results. Its method is called
+// concurrently, and must not block for long.
+type IndexCorruptionAlerter interface {
+	IndexCorruptionDetected(alert *models.IndexCorruptionAlert)
+}
+
+// indexCorruptionCountTTL is how long the inconsistencies found in a vault are counted towards its next alert. A vault
+// in which none were found for that long starts over, so that vaults that had a few inconsistencies once don't stay
+// in memory for good.
+const indexCorruptionCountTTL = 24 * time.Hour
+
+// WithIndexCorruptionAlerts has the provider raise an alert for a vault once more than threshold of its mapping
+// documents have been found to be inconsistent with its documents since its last alert, unless none were found for a
+// day, in which case the vault's counts start over. Inconsistencies are found by read-repair and by consistency
+// checks. Each alert is logged, recorded with the provider's metrics if it has any, and passed to alerter if it
+// isn't nil.
+func WithIndexCorruptionAlerts(threshold uint, alerter IndexCorruptionAlerter) Option {
+	return func(p *Provider) {
+		p.indexCorruptionAlerts = newIndexCorruptionAlerts(threshold, alerter)
+	}
+}
+
+// indexCorruptionAlerts counts the inconsistent mapping documents found in each vault since its last alert.
+type indexCorruptionAlerts struct {
+	threshold uint
+	alerter   IndexCorruptionAlerter
+	ttl       time.Duration
+	now       func() time.Time
+	mutex     sync.Mutex
+	counts    map[string]*indexCorruptionCount
+	lastSweep time.Time
+}
+
+// indexCorruptionCount is the alert being counted up for a vault, and when an inconsistency was last found in it.
+type indexCorruptionCount struct {
+	alert     *models.IndexCorruptionAlert
+	lastFound time.Time
+}
+
+func newIndexCorruptionAlerts(threshold uint, alerter IndexCorruptionAlerter) *indexCorruptionAlerts {
+	return &indexCorruptionAlerts{
+		threshold: threshold,
+		alerter:   alerter,
+		ttl:       indexCorruptionCountTTL,
+		now:       time.Now,
+		counts:    make(map[string]*indexCorruptionCount),
+	}
+}
+
+// add counts the given inconsistencies found in the given vault, and returns the alert to raise if that takes the
+// vault over the threshold, or nil otherwise. The vault's counts start over once an alert is returned, or if they
+// weren't added to for longer than the TTL.
+func (a *indexCorruptionAlerts) add(vaultID string, orphaned, missing int) *models.IndexCorruptionAlert {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := a.now()
+
+	a.evictIdle(now)
+
+	count, found := a.counts[vaultID]
+	if !found || now.Sub(count.lastFound) > a.ttl {
+		count = &indexCorruptionCount{alert: &models.IndexCorruptionAlert{VaultID: vaultID}}
+		a.counts[vaultID] = count
+	}
+
+	count.lastFound = now
+	count.alert.OrphanedMappingDocuments += orphaned
+	count.alert.MissingMappingDocuments += missing
+
+	if uint(count.alert.OrphanedMappingDocuments+count.alert.MissingMappingDocuments) <= a.threshold {
+		return nil
+	}
+
+	delete(a.counts, vaultID)
+
+	count.alert.Timestamp = now.UTC()
+
+	return count.alert
+}
+
+// evictIdle removes the counts of the vaults that weren't added to for longer than the TTL. It only looks through
+// the counts once per TTL, so a count is kept for at most twice the TTL.
+func (a *indexCorruptionAlerts) evictIdle(now time.Time) {
+	if now.Sub(a.lastSweep) < a.ttl {
+		return
+	}
+
+	for vaultID, count := range a.counts {
+		if now.Sub(count.lastFound) > a.ttl {
+			delete(a.counts, vaultID)
+		}
+	}
+
+	a.lastSweep = now
+}
+
+// reportIndexInconsistencies counts the given numbers of orphaned and missing mapping documents found in the store,
+// and raises an alert if they take the vault over the alert threshold.
+func (c *Store) reportIndexInconsistencies(orphaned, missing int) {
+	if c.indexCorruptionAlerts == nil || orphaned+missing == 0 {
+		return
+	}
+
+	alert := c.indexCorruptionAlerts.add(c.name, orphaned, missing)
+	if alert == nil {
+		return
+	}
+
+	c.log().Errorf("Encrypted indices of vault %s may be corrupt: found %d orphaned and %d missing mapping "+
+		"document(s) since its last alert", alert.VaultID, alert.OrphanedMappingDocuments,
+		alert.MissingMappingDocuments)
+
+	if c.metrics != nil {
+		c.metrics.IndexCorruptionDetected(alert.VaultID, alert.OrphanedMappingDocuments, alert.MissingMappingDocuments)
+	}
+
+	if c.indexCorruptionAlerts.alerter != nil {
+		c.indexCorruptionAlerts.alerter.IndexCorruptionDetected(alert)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+type mockIndexCorruptionAlerter struct {
+	mutex  sync.Mutex
+	alerts []*models.IndexCorruptionAlert
+}
+
+func (m *mockIndexCorruptionAlerter) IndexCorruptionDetected(alert *models.IndexCorruptionAlert) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.alerts = append(m.alerts, alert)
+}
+
+func (m *mockIndexCorruptionAlerter) getAlerts() []*models.IndexCorruptionAlert {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return append([]*models.IndexCorruptionAlert(nil), m.alerts...)
+}
+
+func TestWithIndexCorruptionAlerts(t *testing.T) {
+	t.Run("An alert is raised once a vault goes over the threshold", func(t *testing.T) {
+		alerter := &mockIndexCorruptionAlerter{}
+		metrics := &mockMetrics{}
+
+		provider := NewProvider(mem.NewProvider(), 100, WithIndexCorruptionAlerts(2, alerter), WithMetrics(metrics))
+		store := createVaultWithDocuments(t, provider)
+
+		store.reportIndexInconsistencies(1, 0)
+		store.reportIndexInconsistencies(0, 1)
+		require.Empty(t, alerter.getAlerts())
+
+		store.reportIndexInconsistencies(1, 0)
+
+		alerts := alerter.getAlerts()
+		require.Len(t, alerts, 1)
+		require.Equal(t, testVaultID, alerts[0].VaultID)
+		require.Equal(t, 2, alerts[0].OrphanedMappingDocuments)
+		require.Equal(t, 1, alerts[0].MissingMappingDocuments)
+		require.False(t, alerts[0].Timestamp.IsZero())
+		require.Equal(t, [][2]int{{2, 1}}, metrics.indexCorruption)
+		require.Equal(t, []string{testVaultID}, metrics.indexCorruptionVaults)
+
+		// The counts start over after an alert.
+		store.reportIndexInconsistencies(2, 0)
+		require.Len(t, alerter.getAlerts(), 1)
+	})
+	t.Run("Vaults are counted separately", func(t *testing.T) {
+		alerts := newIndexCorruptionAlerts(1, nil)
+
+		require.Nil(t, alerts.add("vault1", 1, 0))
+		require.Nil(t, alerts.add("vault2", 1, 0))
+		require.NotNil(t, alerts.add("vault1", 1, 0))
+	})
+	t.Run("Counts of vaults without inconsistencies for longer than the TTL are evicted", func(t *testing.T) {
+		alerts := newIndexCorruptionAlerts(1, nil)
+
+		now := time.Now()
+		alerts.now = func() time.Time { return now }
+
+		require.Nil(t, alerts.add("vault1", 1, 0))
+		require.Nil(t, alerts.add("vault2", 1, 0))
+
+		now = now.Add(indexCorruptionCountTTL / 2)
+
+		require.Nil(t, alerts.add("vault2", 0, 0))
+		require.Len(t, alerts.counts, 2)
+
+		now = now.Add(indexCorruptionCountTTL/2 + time.Second)
+
+		// vault1's count is evicted, and starts over rather than going over the threshold.
+		require.Nil(t, alerts.add("vault1", 1, 0))
+		require.Len(t, alerts.counts, 2)
+
+		now = now.Add(indexCorruptionCountTTL + time.Second)
+
+		require.Nil(t, alerts.add("vault3", 1, 0))
+		require.Len(t, alerts.counts, 1)
+		require.Contains(t, alerts.counts, "vault3")
+
+		// A vault whose count wasn't evicted yet still starts over once it's idle for longer than the TTL.
+		now = now.Add(indexCorruptionCountTTL / 2)
+
+		require.Nil(t, alerts.add("vault4", 1, 0))
+
+		now = now.Add(indexCorruptionCountTTL/2 + time.Second)
+
+		require.Nil(t, alerts.add("vault5", 1, 0))
+		require.Contains(t, alerts.counts, "vault4")
+
+		now = now.Add(indexCorruptionCountTTL/2 + time.Second)
+
+		require.Nil(t, alerts.add("vault4", 1, 0))
+		require.NotNil(t, alerts.add("vault4", 1, 0))
+	})
+	t.Run("Alerts are raised without an alerter", func(t *testing.T) {
+		metrics := &mockMetrics{}
+
+		provider := NewProvider(mem.NewProvider(), 100, WithIndexCorruptionAlerts(0, nil), WithMetrics(metrics))
+		store := createVaultWithDocuments(t, provider)
+
+		store.reportIndexInconsistencies(0, 0)
+		require.Empty(t, metrics.indexCorruption)
+
+		store.reportIndexInconsistencies(1, 0)
+		require.Equal(t, [][2]int{{1, 0}}, metrics.indexCorruption)
+	})
+	t.Run("Stale mapping documents deleted by read-repair are reported", func(t *testing.T) {
+		alerter := &mockIndexCorruptionAlerter{}
+
+		provider := NewProvider(mem.NewProvider(), 100, WithReadRepair(10), WithIndexCorruptionAlerts(0, alerter))
+		store := createVaultWithDocuments(t, provider)
+
+		require.NoError(t, store.coreStore.Delete(testDocID1))
+
+		documents, err := store.Query(&models.Query{Has: testIndexName2})
+		require.NoError(t, err)
+		require.Len(t, documents, 1)
+
+		require.Eventually(t, func() bool {
+			return len(alerter.getAlerts()) == 1
+		}, time.Second, 10*time.Millisecond)
+
+		alerts := alerter.getAlerts()
+		require.Equal(t, testVaultID, alerts[0].VaultID)
+		require.Equal(t, 1, alerts[0].OrphanedMappingDocuments)
+		require.Equal(t, 0, alerts[0].MissingMappingDocuments)
+	})
+}
@@ -0,0 +1,48 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"github.com/trustbloc/edv/pkg/logging"
+)
+
+// WithLogger has the provider and the stores it opens log with the given logger instead of the edge-core logger for
+// the edvprovider module.
+func WithLogger(logger logging.Logger) Option {
+	return func(p *Provider) {
+		p.logger = logger
+	}
+}
+
+// WithCorrelationID returns a copy of the store that includes the given correlation ID in the lines it logs, so that
+// they can be traced back to the request that the store was opened for. Stores are opened for each request, so the
+// copy isn't shared with other requests. Repairs that the copy schedules in the background log with the ID too.
+func (c *Store) WithCorrelationID(correlationID string) *Store {
+	store := *c
+	store.logger = logging.WithCorrelationID(c.log(), correlationID)
+
+	return &store
+}
+
+// log returns the provider's logger, or the edge-core logger if none was given.
+func (c *Provider) log() logging.Logger {
+	if c.logger == nil {
+		return logger
+	}
+
+	return c.logger
+}
+
+// log returns the store's logger, which is the logger of the provider that opened it, or the edge-core logger if
+// none was given.
+func (c *Store) log() logging.Logger {
+	if c.logger == nil {
+		return logger
+	}
+
+	return c.logger
+}
@@ -0,0 +1,64 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestWithLogger(t *testing.T) {
+	logger := &recordingLogger{}
+
+	provider := NewProvider(mem.NewProvider(), 100, WithLogger(logger))
+	store := createVaultWithDocuments(t, provider)
+
+	require.NotEmpty(t, logger.lines)
+
+	logger.lines = nil
+
+	document := buildEncryptedDoc(testDocID3, models.IndexedAttributeCollection{
+		IndexedAttributes: []models.IndexedAttribute{{Name: testIndexName2, Value: testDocID3}},
+	})
+
+	require.NoError(t, store.WithCorrelationID("correlationID").Put(document))
+	require.NotEmpty(t, logger.lines)
+
+	for _, line := range logger.lines {
+		require.Regexp(t, `^\[correlationID=correlationID\] `, line)
+	}
+
+	// The store that the copy was made from doesn't log with the correlation ID.
+	logger.lines = nil
+
+	require.NoError(t, store.Delete(testDocID3))
+
+	for _, line := range logger.lines {
+		require.NotContains(t, line, "correlationID")
+	}
+}
+
+// recordingLogger records the lines that it logs.
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) log(msg string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(msg, args...))
+}
+
+func (l *recordingLogger) Panicf(msg string, args ...interface{}) { l.log(msg, args...) }
+func (l *recordingLogger) Fatalf(msg string, args ...interface{}) { l.log(msg, args...) }
+func (l *recordingLogger) Errorf(msg string, args ...interface{}) { l.log(msg, args...) }
+func (l *recordingLogger) Warnf(msg string, args ...interface{})  { l.log(msg, args...) }
+func (l *recordingLogger) Infof(msg string, args ...interface{})  { l.log(msg, args...) }
+func (l *recordingLogger) Debugf(msg string, args ...interface{}) { l.log(msg, args...) }
@@ -0,0 +1,59 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"fmt"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// MappingDocumentLimitError is returned when a document declares more indexed attributes than the maximum number of
+// mapping documents allowed per document (see WithMaxMappingDocuments). Nothing is stored when this happens.
+type MappingDocumentLimitError struct {
+	DocumentID string
+	// MappingDocuments is the number of mapping documents that the document would need, one per indexed attribute.
+	MappingDocuments int
+	Max              uint
+}
+
+func (e *MappingDocumentLimitError) Error() string {
+	return fmt.Sprintf("document %s declares %d indexed attributes, but at most %d are allowed per document",
+		e.DocumentID, e.MappingDocuments, e.Max)
+}
+
+// WithMaxMappingDocuments limits the number of mapping documents that a single encrypted document can have.
+// Since every indexed attribute gets its own mapping document, this caps the number of indexed attributes that a
+// client can declare per document. Writes of documents that go over the limit fail with a *MappingDocumentLimitError.
+// If max is 0, then there's no limit.
+func WithMaxMappingDocuments(max uint) Option {
+	return func(p *Provider) {
+		p.maxMappingDocuments = max
+	}
+}
+
+// checkMappingDocumentLimit returns a *MappingDocumentLimitError if the given document has more indexed attributes
+// than the mapping document limit allows.
+func (c *Store) checkMappingDocumentLimit(document *models.EncryptedDocument) error {
+	if c.maxMappingDocuments == 0 {
+		return nil
+	}
+
+	var mappingDocuments int
+
+	for _, indexedAttributeCollection := range document.IndexedAttributeCollections {
+		mappingDocuments += len(indexedAttributeCollection.IndexedAttributes)
+	}
+
+	if mappingDocuments > int(c.maxMappingDocuments) {
+		return &MappingDocumentLimitError{
+			DocumentID: document.ID, MappingDocuments: mappingDocuments, Max: c.maxMappingDocuments,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_MaxMappingDocuments(t *testing.T) {
+	t.Run("Documents within the limit are stored", func(t *testing.T) {
+		store := newMaxMappingDocumentsTestStore(t, 2)
+
+		documents := createTestDocuments(t, testDocID1, testDocID2)
+
+		require.NoError(t, store.Put(documents[0]))
+		require.NoError(t, store.UpsertBulk(documents[1:]))
+
+		documents[0].Sequence = 1
+		require.NoError(t, store.Update(documents[0]))
+	})
+	t.Run("Put fails if the document is over the limit", func(t *testing.T) {
+		store := newMaxMappingDocumentsTestStore(t, 1)
+
+		err := store.Put(createTestDocuments(t, testDocID1)[0])
+
+		var limitErr *MappingDocumentLimitError
+
+		require.True(t, errors.As(err, &limitErr))
+		require.Equal(t, &MappingDocumentLimitError{DocumentID: testDocID1, MappingDocuments: 2, Max: 1}, limitErr)
+		require.EqualError(t, err, "document "+testDocID1+" declares 2 indexed attributes, but at most 1 are "+
+			"allowed per document")
+
+		_, err = store.Get(testDocID1)
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+	t.Run("UpsertBulk stores nothing if a document is over the limit", func(t *testing.T) {
+		store := newMaxMappingDocumentsTestStore(t, 1)
+
+		documents := createTestDocuments(t, testDocID1, testDocID2)
+		documents[0].IndexedAttributeCollections[0].IndexedAttributes =
+			documents[0].IndexedAttributeCollections[0].IndexedAttributes[:1]
+
+		var limitErr *MappingDocumentLimitError
+
+		require.True(t, errors.As(store.UpsertBulk(documents), &limitErr))
+		require.Equal(t, testDocID2, limitErr.DocumentID)
+
+		_, err := store.Get(testDocID1)
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+	t.Run("Update fails if the new document is over the limit", func(t *testing.T) {
+		store := newMaxMappingDocumentsTestStore(t, 2)
+
+		document := createTestDocuments(t, testDocID1)[0]
+		require.NoError(t, store.Put(document))
+
+		document.Sequence = 1
+		document.IndexedAttributeCollections = append(document.IndexedAttributeCollections,
+			document.IndexedAttributeCollections[0])
+
+		var limitErr *MappingDocumentLimitError
+
+		require.True(t, errors.As(store.Update(document), &limitErr))
+		require.Equal(t, 4, limitErr.MappingDocuments)
+	})
+	t.Run("No limit by default", func(t *testing.T) {
+		store, err := NewProvider(mem.NewProvider(), 100).OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		require.NoError(t, store.Put(createTestDocuments(t, testDocID1)[0]))
+	})
+}
+
+func newMaxMappingDocumentsTestStore(t *testing.T, max uint) *Store {
+	t.Helper()
+
+	store, err := NewProvider(mem.NewProvider(), 100, WithMaxMappingDocuments(max)).OpenStore(testVaultID)
+	require.NoError(t, err)
+
+	return store
+}
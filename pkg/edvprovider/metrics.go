@@ -0,0 +1,91 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// The provider operations whose count and latency are recorded with Metrics.ProviderOperationDone.
+const (
+	OpenStoreOperation      = "open-store"
+	SetStoreConfigOperation = "set-store-config"
+	StoreExistsOperation    = "store-exists"
+)
+
+// The outcomes of provider operations. OutcomeNotFound is for stores that don't exist, so that lookups of unknown
+// vaults aren't mistaken for errors from the underlying storage provider, such as when it's misconfigured.
+const (
+	OutcomeSuccess  = "success"
+	OutcomeNotFound = "not-found"
+	OutcomeError    = "error"
+)
+
+// Metrics records measurements of the work done by the provider's stores. Its methods are called concurrently.
+type Metrics interface {
+	// MappingDocumentsWritten is called with the number of mapping documents stored by each successful write.
+	MappingDocumentsWritten(count int)
+	// BatchWritten is called with the number of operations in each batch written to the underlying store.
+	BatchWritten(operations int)
+	// QueryFannedOut is called with the number of documents that each query fetched from the underlying store.
+	QueryFannedOut(documents int)
+	// IndexCorruptionDetected is called with the counts of each index corruption alert raised for a vault.
+	IndexCorruptionDetected(vaultID string, orphanedMappingDocuments, missingMappingDocuments int)
+	// ProviderOperationDone is called with the outcome and duration of each call to the provider's OpenStore,
+	// SetStoreConfig and StoreExists methods, which are named by OpenStoreOperation, SetStoreConfigOperation and
+	// StoreExistsOperation.
+	ProviderOperationDone(operation, outcome string, duration time.Duration)
+}
+
+// WithMetrics has the provider's stores record their work with the given metrics.
+func WithMetrics(metrics Metrics) Option {
+	return func(p *Provider) {
+		p.metrics = metrics
+	}
+}
+
+func (c *Store) recordMappingDocumentsWritten(count int) {
+	if c.metrics != nil && count > 0 {
+		c.metrics.MappingDocumentsWritten(count)
+	}
+}
+
+func (c *Store) recordBatchWritten(operations int) {
+	if c.metrics != nil {
+		c.metrics.BatchWritten(operations)
+	}
+}
+
+func (c *Store) recordQueryFannedOut(documents int) {
+	if c.metrics != nil {
+		c.metrics.QueryFannedOut(documents)
+	}
+}
+
+// recordProviderOperation records a call to one of the provider's store operations that started at start and
+// returned err. A store operation that found no store has the OutcomeNotFound outcome rather than OutcomeError.
+func (c *Provider) recordProviderOperation(operation string, start time.Time, found bool, err error) {
+	if c.metrics == nil {
+		return
+	}
+
+	outcome := OutcomeSuccess
+
+	switch {
+	case errors.Is(err, storage.ErrStoreNotFound):
+		outcome = OutcomeNotFound
+	case err != nil:
+		outcome = OutcomeError
+	case !found:
+		outcome = OutcomeNotFound
+	}
+
+	c.metrics.ProviderOperationDone(operation, outcome, time.Since(start))
+}
@@ -0,0 +1,135 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mock"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestWithMetrics(t *testing.T) {
+	metrics := &mockMetrics{}
+
+	provider := NewProvider(mem.NewProvider(), 100, WithMetrics(metrics))
+	store := createVaultWithDocuments(t, provider)
+
+	require.Equal(t, 2, metrics.mappingDocuments)
+	require.Equal(t, []int{2, 2}, metrics.batchSizes)
+
+	documents, err := store.Query(&models.Query{Has: testIndexName2})
+	require.NoError(t, err)
+	require.Len(t, documents, 2)
+
+	_, err = store.Query(&models.Query{Has: "unknown"})
+	require.NoError(t, err)
+
+	require.Equal(t, []int{2, 0}, metrics.queryFanOut)
+}
+
+func TestWithMetrics_ProviderOperations(t *testing.T) {
+	t.Run("Outcomes are recorded by operation", func(t *testing.T) {
+		metrics := &mockMetrics{}
+
+		provider := NewProvider(mem.NewProvider(), 100, WithMetrics(metrics))
+
+		exists, err := provider.StoreExists(testVaultID)
+		require.NoError(t, err)
+		require.False(t, exists)
+
+		require.NoError(t, provider.CreateVaultStore(testVaultID))
+
+		exists, err = provider.StoreExists(testVaultID)
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		require.Equal(t, []string{
+			StoreExistsOperation + " " + OutcomeNotFound,
+			OpenStoreOperation + " " + OutcomeSuccess,
+			SetStoreConfigOperation + " " + OutcomeSuccess,
+			StoreExistsOperation + " " + OutcomeSuccess,
+		}, metrics.providerOperations)
+	})
+	t.Run("Errors from the underlying provider", func(t *testing.T) {
+		metrics := &mockMetrics{}
+
+		provider := NewProvider(&mock.Provider{
+			ErrOpenStore: errors.New("connection refused"), ErrSetStoreConfig: storage.ErrStoreNotFound,
+			ErrGetStoreConfig: errors.New("connection refused"),
+		}, 100, WithMetrics(metrics))
+
+		_, err := provider.OpenStore(testVaultID)
+		require.Error(t, err)
+
+		require.Error(t, provider.SetStoreConfig(testVaultID, storage.StoreConfiguration{}))
+
+		_, err = provider.StoreExists(testVaultID)
+		require.Error(t, err)
+
+		require.Equal(t, []string{
+			OpenStoreOperation + " " + OutcomeError,
+			SetStoreConfigOperation + " " + OutcomeNotFound,
+			StoreExistsOperation + " " + OutcomeError,
+		}, metrics.providerOperations)
+	})
+}
+
+type mockMetrics struct {
+	mutex            sync.Mutex
+	mappingDocuments int
+	batchSizes       []int
+	queryFanOut      []int
+	indexCorruption  [][2]int
+	// indexCorruptionVaults holds the vault of each index corruption alert.
+	indexCorruptionVaults []string
+	// providerOperations holds the operation and outcome of each provider operation, separated by a space.
+	providerOperations []string
+}
+
+func (m *mockMetrics) MappingDocumentsWritten(count int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.mappingDocuments += count
+}
+
+func (m *mockMetrics) BatchWritten(operations int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.batchSizes = append(m.batchSizes, operations)
+}
+
+func (m *mockMetrics) QueryFannedOut(documents int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.queryFanOut = append(m.queryFanOut, documents)
+}
+
+func (m *mockMetrics) IndexCorruptionDetected(vaultID string, orphanedMappingDocuments, missingMappingDocuments int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.indexCorruptionVaults = append(m.indexCorruptionVaults, vaultID)
+	m.indexCorruption = append(m.indexCorruption, [2]int{orphanedMappingDocuments, missingMappingDocuments})
+}
+
+func (m *mockMetrics) ProviderOperationDone(operation, outcome string, _ time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.providerOperations = append(m.providerOperations, operation+" "+outcome)
+}
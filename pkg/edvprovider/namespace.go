@@ -0,0 +1,75 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// vaultLabelLength is the number of hex characters of the vault ID hash used in labels.
+const vaultLabelLength = 16
+
+// VaultNamespace separates the data of one vault from that of every other vault wherever state is shared between
+// vaults, such as in caches, locks and metrics. Anything keyed with a VaultNamespace must use Key or Label instead
+// of building its own keys from vault IDs, so that entries for one vault can never be read as another vault's.
+//
+// A vault is identified by the name of its underlying store, so a vault ID and the UUID that it's converted to
+// (see Provider.OpenStore) share a namespace.
+type VaultNamespace struct {
+	storeName string
+	prefix    string
+	label     string
+}
+
+// VaultNamespace returns the namespace of the given vault.
+func (c *Provider) VaultNamespace(vaultID string) (VaultNamespace, error) {
+	storeName, err := c.determineStoreNameToUse(vaultID)
+	if err != nil {
+		return VaultNamespace{}, fmt.Errorf("failed to determine store name to use: %w", err)
+	}
+
+	return newVaultNamespace(storeName), nil
+}
+
+// Namespace returns the namespace of the store's vault.
+func (c *Store) Namespace() VaultNamespace {
+	return c.namespace
+}
+
+func newVaultNamespace(storeName string) VaultNamespace {
+	hash := sha256.Sum256([]byte(storeName))
+
+	return VaultNamespace{
+		storeName: storeName,
+		// The store name is length-prefixed, so no store name and key can produce the same prefix as a different
+		// store name, even if store names contain the separator.
+		prefix: strconv.Itoa(len(storeName)) + ":" + storeName + "/",
+		label:  hex.EncodeToString(hash[:])[:vaultLabelLength],
+	}
+}
+
+// Key returns the key to use for the given key of this vault in a cache or map shared between vaults.
+// The keys of different vaults never collide.
+func (n VaultNamespace) Key(key string) string {
+	return n.prefix + key
+}
+
+// Owns returns whether the given key was returned by Key for this vault. It can be used to find every entry of
+// a vault in a shared cache, for example to remove them when the vault is deleted.
+func (n VaultNamespace) Owns(key string) bool {
+	return n.prefix != "" && strings.HasPrefix(key, n.prefix)
+}
+
+// Label returns the value to use for this vault in metrics labels and logs that shouldn't reveal vault IDs.
+// It's a truncated SHA-256 hash of the vault's store name, so it's the same across restarts and EDV instances.
+func (n VaultNamespace) Label() string {
+	return n.label
+}
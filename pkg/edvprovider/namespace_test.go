@@ -0,0 +1,60 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVaultNamespace(t *testing.T) {
+	t.Run("Store and provider agree on the namespace of a vault", func(t *testing.T) {
+		prov := NewProvider(mem.NewProvider(), 100)
+
+		store, err := prov.OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		namespace, err := prov.VaultNamespace(testVaultID)
+		require.NoError(t, err)
+		require.Equal(t, namespace, store.Namespace())
+
+		// The base58-encoded vault ID and the UUID it's converted to are the same vault.
+		namespaceFromUUID, err := prov.VaultNamespace(store.coreStoreName)
+		require.NoError(t, err)
+		require.Equal(t, namespace, namespaceFromUUID)
+	})
+	t.Run("Keys of different vaults never collide", func(t *testing.T) {
+		namespace1 := newVaultNamespace("a")
+		namespace2 := newVaultNamespace("a/b")
+
+		require.NotEqual(t, namespace1.Key("b/c"), namespace2.Key("c"))
+		require.True(t, namespace1.Owns(namespace1.Key("b/c")))
+		require.False(t, namespace1.Owns(namespace2.Key("c")))
+		require.False(t, namespace2.Owns(namespace1.Key("b/c")))
+		require.False(t, VaultNamespace{}.Owns(namespace1.Key("b/c")))
+	})
+	t.Run("Label doesn't reveal the vault ID", func(t *testing.T) {
+		namespace := newVaultNamespace(testVaultID)
+
+		require.Len(t, namespace.Label(), vaultLabelLength)
+		require.NotContains(t, namespace.Label(), testVaultID)
+		require.Equal(t, namespace.Label(), newVaultNamespace(testVaultID).Label())
+		require.NotEqual(t, namespace.Label(), newVaultNamespace(testDocID1).Label())
+	})
+	t.Run("Invalid vault ID", func(t *testing.T) {
+		prov := NewProvider(mem.NewProvider(), 100)
+		prov.checkIfBase58Encoded128BitValue = func(string) error { return nil }
+		prov.base58Encoded128BitToUUID = func(string) (string, error) { return "", errors.New("test error") }
+
+		_, err := prov.VaultNamespace(testVaultID)
+		require.EqualError(t, err, "failed to determine store name to use: failed to generate UUID "+
+			"from base 58 encoded 128 bit name: test error")
+	})
+}
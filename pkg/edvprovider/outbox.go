@@ -0,0 +1,513 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+
+	"github.com/trustbloc/edv/pkg/logging"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// OutboxTagName is the tag name used for the outbox entries of a vault, which hold the events of document changes
+// that haven't been published yet. The tag value is the time at which the event was recorded, in Unix nanoseconds.
+// In the outbox index, it's used for the marks of the vaults whose outboxes have events, with the vault ID as the
+// tag value.
+const OutboxTagName = "Outbox"
+
+// OutboxIndexStoreName is the name of the store that indexes the vaults whose outboxes have events to publish, so that
+// RelayOutbox doesn't have to go through every vault. It also holds the leases that EDV servers take on the outboxes
+// they're relaying.
+const OutboxIndexStoreName = "outbox_index"
+
+const (
+	outboxKeyPrefix      = "outbox_"
+	outboxMarkKeyPrefix  = "mark_"
+	outboxLeaseKeyPrefix = "lease_"
+
+	// outboxLeaseDuration is how long an EDV server holds the lease on a vault's outbox. It stops publishing the
+	// vault's events once half of it has passed, so that it's done before another EDV server can take over.
+	outboxLeaseDuration = 30 * time.Second
+)
+
+// outbox relays the events in the outboxes of vaults (see WithOutbox).
+type outbox struct {
+	coreProvider storage.Provider
+	// relayerID identifies this EDV server in the leases it takes on vault outboxes.
+	relayerID     string
+	leaseDuration time.Duration
+}
+
+// outboxLease is held by the EDV server that's relaying a vault's outbox, so that other EDV servers sharing the
+// database don't publish the same events at the same time.
+type outboxLease struct {
+	Relayer string    `json:"relayer"`
+	Expires time.Time `json:"expires"`
+}
+
+// outboxMark records that a vault's outbox has events to publish. Its value changes whenever events are added, so
+// that it's only removed if no events were added since the outbox was found to be empty.
+type outboxMark struct {
+	vaultID string
+	value   []byte
+}
+
+// WithOutbox enables the outbox. The event of each change to a document is stored in the document's vault, in the
+// same batch as the write that completes the change, and is then published by RelayOutbox. An event is therefore
+// never lost if the EDV server stops after changing a document but before publishing the event.
+func WithOutbox() Option {
+	return func(p *Provider) {
+		p.outbox = &outbox{
+			coreProvider: p.coreProvider, relayerID: uuid.New().String(), leaseDuration: outboxLeaseDuration,
+		}
+	}
+}
+
+// OutboxEnabled returns whether the outbox is enabled, in which case vault events are published by RelayOutbox
+// instead of by the code that changes documents.
+func (c *Provider) OutboxEnabled() bool {
+	return c.outbox != nil
+}
+
+// CreateOutboxIndexStore creates the outbox index, configured with the tag used for finding the vaults whose
+// outboxes have events to publish.
+func (c *Provider) CreateOutboxIndexStore() error {
+	_, err := c.coreProvider.OpenStore(OutboxIndexStoreName)
+	if err != nil {
+		return fmt.Errorf("failed to open outbox index: %w", err)
+	}
+
+	err = c.coreProvider.SetStoreConfig(OutboxIndexStoreName,
+		storage.StoreConfiguration{TagNames: []string{OutboxTagName}})
+	if err != nil {
+		return fmt.Errorf("failed to set store config for outbox index: %w", err)
+	}
+
+	return nil
+}
+
+// RelayOutbox publishes the events in the outbox of every vault that the outbox index has marked as having events,
+// oldest first, and deletes each event from the outbox once it has been published. Each vault's outbox is only
+// relayed while holding a lease on it, so EDV servers sharing a database don't publish the same events at the same
+// time. If an event can't be published, then the rest of that vault's events are left in the outbox for the next
+// call, so that every event is published at least once and in order. The other vaults are still relayed, and the
+// first error is returned along with the number of events published. It does nothing if the outbox isn't enabled.
+func (c *Provider) RelayOutbox(publish func(event *models.VaultEvent) error) (int, error) {
+	if c.outbox == nil {
+		return 0, nil
+	}
+
+	err := c.background.begin()
+	if err != nil {
+		return 0, err
+	}
+
+	defer c.background.end()
+
+	indexStore, err := c.coreProvider.OpenStore(OutboxIndexStoreName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open outbox index: %w", err)
+	}
+
+	marks, err := outboxMarks(indexStore, c.retrievalPageSize, c.log())
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		published int
+		firstErr  error
+	)
+
+	for _, mark := range marks {
+		count, errRelay := c.relayVaultOutbox(indexStore, mark, publish)
+		published += count
+
+		if errRelay != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to relay outbox of vault %s: %w", mark.vaultID, errRelay)
+		}
+	}
+
+	return published, firstErr
+}
+
+// IndexOutboxes marks every vault whose outbox has events in the outbox index, and returns the number of vaults
+// marked. Vaults are marked after their events are written, so this finds the events of vaults whose mark couldn't
+// be written, for example because the EDV server stopped in between, and of vaults written to by versions of the
+// EDV server that didn't have the outbox index. It does nothing if the outbox isn't enabled.
+func (c *Provider) IndexOutboxes() (int, error) {
+	if c.outbox == nil {
+		return 0, nil
+	}
+
+	err := c.background.begin()
+	if err != nil {
+		return 0, err
+	}
+
+	defer c.background.end()
+
+	vaultIDs, err := c.VaultIDs()
+	if err != nil {
+		return 0, err
+	}
+
+	var marked int
+
+	for _, vaultID := range vaultIDs {
+		store, errOpen := c.OpenStore(vaultID)
+		if errOpen != nil {
+			return marked, fmt.Errorf("failed to open store for vault %s: %w", vaultID, errOpen)
+		}
+
+		hasEvents, errCheck := store.outboxHasEntries()
+		if errCheck != nil {
+			return marked, fmt.Errorf("failed to check outbox of vault %s: %w", vaultID, errCheck)
+		}
+
+		if !hasEvents {
+			continue
+		}
+
+		errMark := store.markOutbox()
+		if errMark != nil {
+			return marked, errMark
+		}
+
+		marked++
+	}
+
+	return marked, nil
+}
+
+// relayVaultOutbox relays the outbox of the vault with the given mark if it can take the lease on it, and removes the
+// mark once the outbox is empty.
+func (c *Provider) relayVaultOutbox(indexStore storage.Store, mark outboxMark,
+	publish func(event *models.VaultEvent) error) (int, error) {
+	lease, claimed, err := c.outbox.claim(indexStore, mark.vaultID)
+	if err != nil || !claimed {
+		return 0, err
+	}
+
+	defer c.outbox.release(indexStore, mark.vaultID, lease, c.log())
+
+	store, err := c.OpenStore(mark.vaultID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open store: %w", err)
+	}
+
+	published, drained, err := store.relayOutbox(publish, time.Now().Add(c.outbox.leaseDuration/2))
+	if err != nil || !drained {
+		return published, err
+	}
+
+	// If events were added since the mark was read, then the mark has changed and is left for the next relay.
+	_, err = batchIf(indexStore, map[string][]byte{outboxMarkKeyPrefix + mark.vaultID: mark.value},
+		[]storage.Operation{{Key: outboxMarkKeyPrefix + mark.vaultID}})
+	if err != nil {
+		return published, fmt.Errorf("failed to remove outbox mark: %w", err)
+	}
+
+	return published, nil
+}
+
+// claim takes the lease on the outbox of the given vault, unless another EDV server holds it. It returns the stored
+// lease and whether it was taken.
+func (o *outbox) claim(indexStore storage.Store, vaultID string) ([]byte, bool, error) {
+	key := outboxLeaseKeyPrefix + vaultID
+
+	currentLease, err := indexStore.Get(key)
+	if errors.Is(err, storage.ErrDataNotFound) {
+		currentLease, err = nil, nil
+	}
+
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get outbox lease: %w", err)
+	}
+
+	if currentLease != nil {
+		var lease outboxLease
+
+		err = json.Unmarshal(currentLease, &lease)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to unmarshal outbox lease: %w", err)
+		}
+
+		if lease.Relayer != o.relayerID && time.Now().Before(lease.Expires) {
+			return nil, false, nil
+		}
+	}
+
+	leaseBytes, err := json.Marshal(outboxLease{Relayer: o.relayerID, Expires: time.Now().Add(o.leaseDuration)})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal outbox lease: %w", err)
+	}
+
+	claimed, err := batchIf(indexStore, map[string][]byte{key: currentLease},
+		[]storage.Operation{{Key: key, Value: leaseBytes}})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to store outbox lease: %w", err)
+	}
+
+	return leaseBytes, claimed, nil
+}
+
+// release gives up the lease on the outbox of the given vault, if it's still the given one. A lease that can't be
+// released expires.
+func (o *outbox) release(indexStore storage.Store, vaultID string, lease []byte, logger logging.Logger) {
+	_, err := batchIf(indexStore, map[string][]byte{outboxLeaseKeyPrefix + vaultID: lease},
+		[]storage.Operation{{Key: outboxLeaseKeyPrefix + vaultID}})
+	if err != nil {
+		logger.Warnf("Failed to release the lease on the outbox of vault %s: %s", vaultID, err)
+	}
+}
+
+// outboxMarks returns the marks in the outbox index.
+func outboxMarks(indexStore storage.Store, pageSize uint, logger logging.Logger) ([]outboxMark, error) {
+	itr, err := indexStore.Query(OutboxTagName, storage.WithPageSize(int(pageSize)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outbox index: %w", err)
+	}
+
+	defer storage.Close(itr, logger)
+
+	var marks []outboxMark
+
+	moreEntries, err := itr.Next()
+
+	for ; err == nil && moreEntries; moreEntries, err = itr.Next() {
+		key, errKey := itr.Key()
+		if errKey != nil {
+			return nil, fmt.Errorf("failed to get key from iterator: %w", errKey)
+		}
+
+		value, errValue := itr.Value()
+		if errValue != nil {
+			return nil, fmt.Errorf("failed to get value from iterator: %w", errValue)
+		}
+
+		marks = append(marks, outboxMark{vaultID: strings.TrimPrefix(key, outboxMarkKeyPrefix), value: value})
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next entry from iterator: %w", err)
+	}
+
+	return marks, nil
+}
+
+type outboxEntry struct {
+	key      string
+	recorded int64
+	event    models.VaultEvent
+}
+
+// outboxOperations returns the operations that store the event of a change to the given document in the outbox.
+// There are none if the outbox isn't enabled.
+func (c *Store) outboxOperations(eventType, documentID string, sequence uint64) ([]storage.Operation, error) {
+	if c.outbox == nil {
+		return nil, nil
+	}
+
+	event := models.VaultEvent{
+		VaultID:    c.name,
+		DocumentID: documentID,
+		Sequence:   sequence,
+		Type:       eventType,
+		Timestamp:  time.Now().UTC(),
+	}
+
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s event for document %s: %w", eventType, documentID, err)
+	}
+
+	return []storage.Operation{{
+		Key:   outboxKeyPrefix + uuid.New().String(),
+		Value: eventBytes,
+		Tags:  []storage.Tag{{Name: OutboxTagName, Value: strconv.FormatInt(event.Timestamp.UnixNano(), 10)}},
+	}}, nil
+}
+
+// write stores the given operation along with the given outbox operations, in a single batch if there are any.
+func (c *Store) write(operation storage.Operation, outboxOperations []storage.Operation) error {
+	if len(outboxOperations) == 0 {
+		if operation.Value == nil {
+			return c.coreStore.Delete(operation.Key)
+		}
+
+		return c.coreStore.Put(operation.Key, operation.Value, operation.Tags...)
+	}
+
+	err := c.coreStore.Batch(append([]storage.Operation{operation}, outboxOperations...))
+	if err != nil {
+		return err
+	}
+
+	c.markOutboxAfter(outboxOperations)
+
+	return nil
+}
+
+// markOutboxAfter marks the store's outbox in the outbox index if any of the given operations, which have been
+// written, stored an event. A mark that can't be written is only logged, since the change it's for has been made.
+// Its events are found by the next IndexOutboxes instead.
+func (c *Store) markOutboxAfter(operations []storage.Operation) {
+	for _, operation := range operations {
+		if strings.HasPrefix(operation.Key, outboxKeyPrefix) && operation.Value != nil {
+			err := c.markOutbox()
+			if err != nil {
+				c.log().Warnf("%s. Its events are published once the outbox index is next rebuilt.", err)
+			}
+
+			return
+		}
+	}
+}
+
+// markOutbox marks the store's outbox in the outbox index as having events to publish.
+func (c *Store) markOutbox() error {
+	indexStore, err := c.outbox.coreProvider.OpenStore(OutboxIndexStoreName)
+	if err != nil {
+		return fmt.Errorf("failed to open outbox index to mark the outbox of vault %s: %w", c.name, err)
+	}
+
+	err = indexStore.Put(outboxMarkKeyPrefix+c.name, []byte(uuid.New().String()),
+		storage.Tag{Name: OutboxTagName, Value: c.name})
+	if err != nil {
+		return fmt.Errorf("failed to mark the outbox of vault %s: %w", c.name, err)
+	}
+
+	return nil
+}
+
+// relayOutbox publishes the events in the store's outbox, oldest first, deleting each one once published.
+// It stops at the first event that can't be published, and doesn't start publishing events after the given deadline.
+// It returns the number of events published and whether the outbox was emptied.
+func (c *Store) relayOutbox(publish func(event *models.VaultEvent) error, deadline time.Time) (int, bool, error) {
+	entries, err := c.outboxEntries()
+	if err != nil {
+		return 0, false, err
+	}
+
+	for i := range entries {
+		if time.Now().After(deadline) {
+			return i, false, nil
+		}
+
+		err = publish(&entries[i].event)
+		if err != nil {
+			return i, false, fmt.Errorf("failed to publish %s event for document %s: %w",
+				entries[i].event.Type, entries[i].event.DocumentID, err)
+		}
+
+		err = c.coreStore.Delete(entries[i].key)
+		if err != nil {
+			return i + 1, false, fmt.Errorf("failed to delete outbox entry %s: %w", entries[i].key, err)
+		}
+	}
+
+	return len(entries), true, nil
+}
+
+// outboxHasEntries returns whether the store's outbox has any events.
+func (c *Store) outboxHasEntries() (bool, error) {
+	itr, err := c.coreStore.Query(OutboxTagName, storage.WithPageSize(1))
+	if err != nil {
+		return false, fmt.Errorf("failed to query outbox: %w", err)
+	}
+
+	defer storage.Close(itr, c.log())
+
+	moreEntries, err := itr.Next()
+	if err != nil {
+		return false, fmt.Errorf("failed to get next entry from iterator: %w", err)
+	}
+
+	return moreEntries, nil
+}
+
+// outboxEntries returns the entries in the store's outbox, in the order in which they were recorded.
+func (c *Store) outboxEntries() ([]outboxEntry, error) {
+	itr, err := c.coreStore.Query(OutboxTagName, storage.WithPageSize(int(c.retrievalPageSize)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outbox: %w", err)
+	}
+
+	defer storage.Close(itr, c.log())
+
+	var entries []outboxEntry
+
+	moreEntries, err := itr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next entry from iterator: %w", err)
+	}
+
+	for moreEntries {
+		entry, errEntry := outboxEntryFromIterator(itr)
+		if errEntry != nil {
+			return nil, errEntry
+		}
+
+		entries = append(entries, *entry)
+
+		moreEntries, err = itr.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get next entry from iterator: %w", err)
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].recorded < entries[j].recorded
+	})
+
+	return entries, nil
+}
+
+func outboxEntryFromIterator(itr storage.Iterator) (*outboxEntry, error) {
+	key, err := itr.Key()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key from iterator: %w", err)
+	}
+
+	value, err := itr.Value()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get value from iterator: %w", err)
+	}
+
+	tags, err := itr.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tags from iterator: %w", err)
+	}
+
+	entry := outboxEntry{key: key}
+
+	for _, tag := range tags {
+		if tag.Name == OutboxTagName {
+			entry.recorded, err = strconv.ParseInt(tag.Value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid outbox tag on %s: %w", key, err)
+			}
+		}
+	}
+
+	err = json.Unmarshal(value, &entry.event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal outbox entry %s: %w", key, err)
+	}
+
+	return &entry, nil
+}
@@ -0,0 +1,261 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestProvider_RelayOutbox(t *testing.T) {
+	t.Run("Events of document changes are relayed in order", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100, WithOutbox())
+		require.True(t, provider.OutboxEnabled())
+
+		store := createVaultWithDocuments(t, provider)
+
+		document := buildEncryptedDoc(testDocID1, models.IndexedAttributeCollection{
+			IndexedAttributes: []models.IndexedAttribute{{Name: testIndexName2, Value: testDocID1}},
+		})
+		document.Sequence = 1
+
+		require.NoError(t, store.Update(document))
+		require.NoError(t, store.Delete(testDocID2))
+		require.NoError(t, store.UpsertBulk(createTestDocuments(t, testDocID2)))
+
+		events := relayOutboxEvents(t, provider, 5)
+		requireEvent(t, &events[0], testDocID1, 0, models.DocumentCreatedVaultEvent)
+		requireEvent(t, &events[1], testDocID2, 0, models.DocumentCreatedVaultEvent)
+		requireEvent(t, &events[2], testDocID1, 1, models.DocumentUpdatedVaultEvent)
+		requireEvent(t, &events[3], testDocID2, 0, models.DocumentDeletedVaultEvent)
+		requireEvent(t, &events[4], testDocID2, 0, models.DocumentUpsertedVaultEvent)
+
+		// Relayed events are removed from the outbox.
+		relayOutboxEvents(t, provider, 0)
+	})
+	t.Run("Events of deleted and restored documents are relayed in tombstone mode", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100, WithOutbox(), WithTombstoneRetention(time.Hour))
+		store := createVaultWithDocuments(t, provider)
+
+		relayOutboxEvents(t, provider, 2)
+
+		require.NoError(t, store.Delete(testDocID1))
+
+		_, err := store.Restore(testDocID1)
+		require.NoError(t, err)
+
+		events := relayOutboxEvents(t, provider, 2)
+		requireEvent(t, &events[0], testDocID1, 0, models.DocumentDeletedVaultEvent)
+		requireEvent(t, &events[1], testDocID1, 0, models.DocumentRestoredVaultEvent)
+	})
+	t.Run("Events that fail to be published are kept for the next relay", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100, WithOutbox())
+		createVaultWithDocuments(t, provider)
+
+		published, err := provider.RelayOutbox(func(*models.VaultEvent) error {
+			return errors.New("publish failure")
+		})
+		require.EqualError(t, err, "failed to relay outbox of vault "+testVaultID+": failed to publish created "+
+			"event for document "+testDocID1+": publish failure")
+		require.Zero(t, published)
+
+		relayOutboxEvents(t, provider, 2)
+	})
+	t.Run("Deleting the vault deletes its outbox", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100, WithOutbox())
+		createVaultWithDocuments(t, provider)
+
+		require.NoError(t, provider.DeleteStore(testVaultID))
+
+		store, err := provider.OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		entries, err := store.outboxEntries()
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	})
+	t.Run("Outbox not enabled", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+		require.False(t, provider.OutboxEnabled())
+
+		store := createVaultWithDocuments(t, provider)
+
+		entries, err := store.outboxEntries()
+		require.NoError(t, err)
+		require.Empty(t, entries)
+
+		relayOutboxEvents(t, provider, 0)
+	})
+	t.Run("Vaults are relayed once the outbox index has marked them", func(t *testing.T) {
+		coreProvider := mem.NewProvider()
+		provider := NewProvider(coreProvider, 100, WithOutbox())
+		require.NoError(t, provider.CreateOutboxIndexStore())
+
+		createVaultWithDocuments(t, provider)
+
+		// Remove the mark, as if the EDV server had stopped before writing it.
+		indexStore, err := coreProvider.OpenStore(OutboxIndexStoreName)
+		require.NoError(t, err)
+		require.NoError(t, indexStore.Delete(outboxMarkKeyPrefix+testVaultID))
+
+		relayOutboxEvents(t, provider, 0)
+
+		marked, err := provider.IndexOutboxes()
+		require.NoError(t, err)
+		require.Equal(t, 1, marked)
+
+		relayOutboxEvents(t, provider, 2)
+
+		// The mark is removed once the outbox is empty.
+		marks, err := outboxMarks(indexStore, 100, provider.log())
+		require.NoError(t, err)
+		require.Empty(t, marks)
+
+		marked, err = provider.IndexOutboxes()
+		require.NoError(t, err)
+		require.Zero(t, marked)
+	})
+	t.Run("Events added during a relay are relayed by the next one", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100, WithOutbox())
+		store := createVaultWithDocuments(t, provider)
+
+		var events []models.VaultEvent
+
+		published, err := provider.RelayOutbox(func(event *models.VaultEvent) error {
+			if len(events) == 0 {
+				require.NoError(t, store.Delete(testDocID1))
+			}
+
+			events = append(events, *event)
+
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 2, published)
+
+		events = relayOutboxEvents(t, provider, 1)
+		requireEvent(t, &events[0], testDocID1, 0, models.DocumentDeletedVaultEvent)
+	})
+	t.Run("A vault's outbox is only relayed by the EDV server holding its lease", func(t *testing.T) {
+		coreProvider := mem.NewProvider()
+		provider := NewProvider(coreProvider, 100, WithOutbox())
+		otherProvider := NewProvider(coreProvider, 100, WithOutbox())
+
+		createVaultWithDocuments(t, provider)
+
+		indexStore, err := coreProvider.OpenStore(OutboxIndexStoreName)
+		require.NoError(t, err)
+
+		lease, claimed, err := otherProvider.outbox.claim(indexStore, testVaultID)
+		require.NoError(t, err)
+		require.True(t, claimed)
+
+		relayOutboxEvents(t, provider, 0)
+
+		// The EDV server holding the lease can claim it again.
+		_, claimed, err = otherProvider.outbox.claim(indexStore, testVaultID)
+		require.NoError(t, err)
+		require.True(t, claimed)
+
+		// A released lease can be taken by another EDV server, and so can an expired one.
+		otherProvider.outbox.release(indexStore, testVaultID, lease, otherProvider.log())
+		relayOutboxEvents(t, provider, 0)
+
+		otherProvider.outbox.leaseDuration = -time.Second
+
+		_, claimed, err = otherProvider.outbox.claim(indexStore, testVaultID)
+		require.NoError(t, err)
+		require.True(t, claimed)
+
+		relayOutboxEvents(t, provider, 2)
+	})
+	t.Run("Relaying stops once half of the lease has passed", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100, WithOutbox())
+		createVaultWithDocuments(t, provider)
+
+		provider.outbox.leaseDuration = 0
+
+		relayOutboxEvents(t, provider, 0)
+
+		provider.outbox.leaseDuration = outboxLeaseDuration
+
+		relayOutboxEvents(t, provider, 2)
+	})
+	t.Run("Fail to open outbox index", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{ErrOpenStore: errors.New("open store failure")}, 100, WithOutbox())
+
+		_, err := provider.RelayOutbox(func(*models.VaultEvent) error { return nil })
+		require.EqualError(t, err, "failed to open outbox index: open store failure")
+
+		_, err = provider.IndexOutboxes()
+		require.EqualError(t, err, "failed to open store for vault configurations: open store failure")
+
+		require.EqualError(t, provider.CreateOutboxIndexStore(), "failed to open outbox index: open store failure")
+	})
+	t.Run("Fail to query outbox index", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{OpenStoreReturn: &mock.Store{ErrQuery: errors.New("query failure")}},
+			100, WithOutbox())
+
+		_, err := provider.RelayOutbox(func(*models.VaultEvent) error { return nil })
+		require.EqualError(t, err, "failed to query outbox index: query failure")
+	})
+	t.Run("Invalid outbox lease", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100, WithOutbox())
+		createVaultWithDocuments(t, provider)
+
+		indexStore, err := provider.coreProvider.OpenStore(OutboxIndexStoreName)
+		require.NoError(t, err)
+		require.NoError(t, indexStore.Put(outboxLeaseKeyPrefix+testVaultID, []byte("NotJSON")))
+
+		_, err = provider.RelayOutbox(func(*models.VaultEvent) error { return nil })
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to relay outbox of vault "+testVaultID+
+			": failed to unmarshal outbox lease")
+	})
+	t.Run("Fail to query outbox", func(t *testing.T) {
+		store := Store{coreStore: &mock.Store{ErrQuery: errors.New("query failure")}, retrievalPageSize: 100}
+
+		_, _, err := store.relayOutbox(func(*models.VaultEvent) error { return nil }, time.Now().Add(time.Minute))
+		require.EqualError(t, err, "failed to query outbox: query failure")
+
+		_, err = store.outboxHasEntries()
+		require.EqualError(t, err, "failed to query outbox: query failure")
+	})
+}
+
+func relayOutboxEvents(t *testing.T, provider *Provider, count int) []models.VaultEvent {
+	t.Helper()
+
+	var events []models.VaultEvent
+
+	published, err := provider.RelayOutbox(func(event *models.VaultEvent) error {
+		events = append(events, *event)
+
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, count, published)
+	require.Len(t, events, count)
+
+	return events
+}
+
+func requireEvent(t *testing.T, event *models.VaultEvent, documentID string, sequence uint64, eventType string) {
+	t.Helper()
+
+	require.Equal(t, testVaultID, event.VaultID)
+	require.Equal(t, documentID, event.DocumentID)
+	require.Equal(t, sequence, event.Sequence)
+	require.Equal(t, eventType, event.Type)
+}
@@ -0,0 +1,28 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"fmt"
+)
+
+// VaultRetrievalPageSize returns the retrieval page size of the given vault, which is kept in its configuration and
+// overrides the provider's for queries on the vault (see models.Query.PageSize). It returns 0 if the vault doesn't
+// have one, and messages.ErrVaultNotFound if the vault doesn't exist.
+func (c *Provider) VaultRetrievalPageSize(vaultID string) (uint, error) {
+	configStore, err := c.coreProvider.OpenStore(VaultConfigurationStoreName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open store for vault configurations: %w", err)
+	}
+
+	configEntry, err := getVaultConfigurationMapping(configStore, c.encryption, vaultID)
+	if err != nil {
+		return 0, err
+	}
+
+	return configEntry.RetrievalPageSize, nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mock"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestProvider_VaultRetrievalPageSize(t *testing.T) {
+	t.Run("Page size is kept in the vault configuration", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+		createVaultWithDocuments(t, provider)
+
+		pageSize, err := provider.VaultRetrievalPageSize(testVaultID)
+		require.NoError(t, err)
+		require.Zero(t, pageSize)
+
+		configStore, err := provider.OpenStore(VaultConfigurationStoreName)
+		require.NoError(t, err)
+
+		updatedPageSize := uint(500)
+
+		config, err := configStore.UpdateDataVaultConfiguration(testVaultID,
+			&models.DataVaultConfigurationUpdate{RetrievalPageSize: &updatedPageSize})
+		require.NoError(t, err)
+		require.Equal(t, testReferenceID, config.ReferenceID)
+
+		pageSize, err = provider.VaultRetrievalPageSize(testVaultID)
+		require.NoError(t, err)
+		require.Equal(t, updatedPageSize, pageSize)
+
+		// Other updates leave it as it is.
+		controller := "did:example:controller"
+
+		_, err = configStore.UpdateDataVaultConfiguration(testVaultID,
+			&models.DataVaultConfigurationUpdate{Controller: &controller})
+		require.NoError(t, err)
+
+		pageSize, err = provider.VaultRetrievalPageSize(testVaultID)
+		require.NoError(t, err)
+		require.Equal(t, updatedPageSize, pageSize)
+
+		updatedPageSize = 0
+
+		_, err = configStore.UpdateDataVaultConfiguration(testVaultID,
+			&models.DataVaultConfigurationUpdate{RetrievalPageSize: &updatedPageSize})
+		require.NoError(t, err)
+
+		pageSize, err = provider.VaultRetrievalPageSize(testVaultID)
+		require.NoError(t, err)
+		require.Zero(t, pageSize)
+	})
+	t.Run("Vault not found", func(t *testing.T) {
+		_, err := NewProvider(mem.NewProvider(), 100).VaultRetrievalPageSize(testVaultID)
+		require.True(t, errors.Is(err, messages.ErrVaultNotFound))
+	})
+	t.Run("Fail to open config store", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{ErrOpenStore: errors.New("open store error")}, 100)
+
+		_, err := provider.VaultRetrievalPageSize(testVaultID)
+		require.EqualError(t, err, "failed to open store for vault configurations: open store error")
+	})
+}
+
+func TestStore_QueryWithPageSize(t *testing.T) {
+	coreStore := &pageSizeRecordingStore{Store: newTestCoreStore(t)}
+	store := &Store{coreStore: coreStore, name: testVaultID, retrievalPageSize: 100}
+
+	require.NoError(t, store.UpsertBulk(createTestDocuments(t, testDocID1)))
+
+	coreStore.pageSizes = nil
+
+	requireQueryMatches(t, store, &models.Query{Name: testAttributeName, Value: testDocID1}, testDocID1)
+	requireQueryMatches(t, store, &models.Query{Name: testAttributeName, Value: testDocID1, PageSize: 5},
+		testDocID1)
+	require.Equal(t, []int{100, 5}, coreStore.pageSizes)
+}
+
+// pageSizeRecordingStore is a store that records the page size of each query.
+type pageSizeRecordingStore struct {
+	storage.Store
+	pageSizes []int
+}
+
+func (s *pageSizeRecordingStore) Query(expression string, options ...storage.QueryOption) (storage.Iterator, error) {
+	queryOptions := &storage.QueryOptions{}
+
+	for _, option := range options {
+		option(queryOptions)
+	}
+
+	s.pageSizes = append(s.pageSizes, queryOptions.PageSize)
+
+	return s.Store.Query(expression, options...)
+}
@@ -0,0 +1,63 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+
+	"github.com/trustbloc/edv/pkg/edvutils"
+)
+
+// PingStoreName is the name of the store that PingStorage writes its canary records to.
+const PingStoreName = "edvping"
+
+// PingStorage checks that the given storage provider can be written to and read from, by writing a canary record to
+// the PingStoreName store, reading it back and deleting it. Each ping uses a canary record of its own, so EDV servers
+// that share a database can ping it at the same time.
+func PingStorage(provider storage.Provider) error {
+	store, err := provider.OpenStore(PingStoreName)
+	if err != nil {
+		return fmt.Errorf("failed to open ping store: %w", err)
+	}
+
+	key, err := edvutils.GenerateEDVCompatibleID()
+	if err != nil {
+		return fmt.Errorf("failed to generate canary key: %w", err)
+	}
+
+	value := []byte(key)
+
+	err = store.Put(key, value)
+	if err != nil {
+		return fmt.Errorf("failed to write canary record: %w", err)
+	}
+
+	readValue, err := store.Get(key)
+	if err != nil {
+		return fmt.Errorf("failed to read canary record: %w", err)
+	}
+
+	if !bytes.Equal(readValue, value) {
+		return errors.New("canary record read back doesn't match the one written")
+	}
+
+	err = store.Delete(key)
+	if err != nil {
+		return fmt.Errorf("failed to delete canary record: %w", err)
+	}
+
+	return nil
+}
+
+// Ping checks that the database of the provider can be written to and read from (see PingStorage).
+func (c *Provider) Ping() error {
+	return PingStorage(c.coreProvider)
+}
@@ -0,0 +1,44 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mock"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPingStorage(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		require.NoError(t, NewProvider(mem.NewProvider(), 100).Ping())
+	})
+	for _, tc := range []struct {
+		name     string
+		provider storage.Provider
+		expected string
+	}{
+		{name: "Fail to open ping store", provider: &mock.Provider{ErrOpenStore: errors.New("open error")},
+			expected: "failed to open ping store: open error"},
+		{name: "Fail to write canary record", provider: &mock.Provider{OpenStoreReturn: &mock.Store{
+			ErrPut: errors.New("put error"),
+		}}, expected: "failed to write canary record: put error"},
+		{name: "Fail to read canary record", provider: &mock.Provider{OpenStoreReturn: &mock.Store{
+			ErrGet: errors.New("get error"),
+		}}, expected: "failed to read canary record: get error"},
+		{name: "Canary record doesn't match", provider: &mock.Provider{OpenStoreReturn: &mock.Store{
+			GetReturn: []byte("other"),
+		}}, expected: "canary record read back doesn't match the one written"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.EqualError(t, PingStorage(tc.provider), tc.expected)
+		})
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// ErrUnknownQueryOperator is returned when parsing a query with an operator that hasn't been registered.
+var ErrUnknownQueryOperator = errors.New("unknown query operator")
+
+// ErrInvalidQueryOperand is returned when a query operator rejects the operand of a query.
+var ErrInvalidQueryOperand = errors.New("invalid query operand")
+
+// QueryOperator is a custom query operator, which matches the values of the attribute named by an
+// "index + operator" query (see models.Query) in a deployment-specific way. The values of indexed attributes are
+// blinded by clients, so operators can only compare them in ways the clients' blinding preserves, such as range
+// queries on the buckets that a client puts values in before blinding them.
+// The documents that a query can match are still found by the mapping documents for the query's attribute name, and
+// then filtered by the operator, so an operator's queries can be counted and paged like "index + equals" queries.
+type QueryOperator interface {
+	// Parse parses the operand of a query, and returns the matcher for its attribute values. It's called once for
+	// each query, both when the query is received and when it's executed. An error is returned to the client as an
+	// invalid query.
+	Parse(operand json.RawMessage) (QueryMatcher, error)
+}
+
+// QueryMatcher matches the values of the attribute that a query is for. Its method may be called concurrently.
+type QueryMatcher interface {
+	// Matches returns whether an indexed attribute with the given value satisfies the query.
+	Matches(value string) bool
+}
+
+// nolint:gochecknoglobals
+var queryOperators = struct {
+	sync.RWMutex
+	operators map[string]QueryOperator
+}{operators: make(map[string]QueryOperator)}
+
+// RegisterQueryOperator makes a custom query operator available under the given name, so that "index + operator"
+// queries can use it. It panics if the name is empty, if an operator is already registered under the name, or if
+// operator is nil.
+func RegisterQueryOperator(name string, operator QueryOperator) {
+	queryOperators.Lock()
+	defer queryOperators.Unlock()
+
+	if name == "" {
+		panic("edvprovider: query operator name is empty")
+	}
+
+	if operator == nil {
+		panic("edvprovider: query operator " + name + " is nil")
+	}
+
+	if _, registered := queryOperators.operators[name]; registered {
+		panic("edvprovider: query operator " + name + " is already registered")
+	}
+
+	queryOperators.operators[name] = operator
+}
+
+// QueryOperators returns the names of the registered query operators, in alphabetical order.
+func QueryOperators() []string {
+	queryOperators.RLock()
+	defer queryOperators.RUnlock()
+
+	names := make([]string, 0, len(queryOperators.operators))
+
+	for name := range queryOperators.operators {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// ParseQueryOperator parses the operand of the given query with the query's operator, and returns the matcher for
+// the query's attribute values. It returns nil if the query doesn't have an operator. An error wrapping
+// ErrUnknownQueryOperator is returned if the operator isn't registered, and one wrapping ErrInvalidQueryOperand if
+// the operator rejects the operand.
+func ParseQueryOperator(query *models.Query) (QueryMatcher, error) {
+	if query.Operator == "" {
+		return nil, nil
+	}
+
+	queryOperators.RLock()
+	operator, registered := queryOperators.operators[query.Operator]
+	queryOperators.RUnlock()
+
+	if !registered {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownQueryOperator, query.Operator)
+	}
+
+	matcher, err := operator.Parse(query.Operand)
+	if err != nil {
+		return nil, fmt.Errorf("%w for operator %s: %s", ErrInvalidQueryOperand, query.Operator, err)
+	}
+
+	return matcher, nil
+}
+
+// filtersValues returns whether the documents found by the mapping documents for the given query's attribute name
+// still have to be read to check their attribute values or HMAC keys.
+func filtersValues(query *models.Query) bool {
+	return query.Value != "" || query.Operator != "" || query.HMACKeyID != ""
+}
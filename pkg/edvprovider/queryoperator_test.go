@@ -0,0 +1,111 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// inOperator matches attributes whose value is one of the strings in its operand.
+type inOperator struct{}
+
+func (inOperator) Parse(operand json.RawMessage) (QueryMatcher, error) {
+	var values []string
+
+	err := json.Unmarshal(operand, &values)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(values) == 0 {
+		return nil, errors.New("no values")
+	}
+
+	matcher := make(inMatcher, len(values))
+
+	for _, value := range values {
+		matcher[value] = struct{}{}
+	}
+
+	return matcher, nil
+}
+
+type inMatcher map[string]struct{}
+
+func (m inMatcher) Matches(value string) bool {
+	_, matches := m[value]
+
+	return matches
+}
+
+func TestRegisterQueryOperator(t *testing.T) {
+	RegisterQueryOperator("testin", inOperator{})
+
+	require.Contains(t, QueryOperators(), "testin")
+
+	t.Run("Query with an operator", func(t *testing.T) {
+		store := createVaultWithDocuments(t, NewProvider(mem.NewProvider(), 100))
+
+		query := &models.Query{
+			Name:     testIndexName2,
+			Operator: "testin",
+			Operand:  json.RawMessage(`["` + testDocID2 + `", "otherValue"]`),
+		}
+
+		docs, err := store.Query(query)
+		require.NoError(t, err)
+		require.Len(t, docs, 1)
+		require.Equal(t, testDocID2, docs[0].ID)
+
+		count, err := store.Count(query)
+		require.NoError(t, err)
+		require.Equal(t, 1, count)
+
+		query.Operand = json.RawMessage(`["otherValue"]`)
+
+		docs, err = store.Query(query)
+		require.NoError(t, err)
+		require.Empty(t, docs)
+	})
+	t.Run("Unknown operator", func(t *testing.T) {
+		store := createVaultWithDocuments(t, NewProvider(mem.NewProvider(), 100))
+
+		docs, err := store.Query(&models.Query{Name: testIndexName2, Operator: "unknown"})
+		require.Nil(t, docs)
+		require.ErrorIs(t, err, ErrUnknownQueryOperator)
+		require.EqualError(t, err, "unknown query operator: unknown")
+
+		count, err := store.Count(&models.Query{Name: testIndexName2, Operator: "unknown"})
+		require.Zero(t, count)
+		require.ErrorIs(t, err, ErrUnknownQueryOperator)
+	})
+	t.Run("Invalid operand", func(t *testing.T) {
+		matcher, err := ParseQueryOperator(&models.Query{
+			Name: testIndexName2, Operator: "testin", Operand: json.RawMessage(`[]`),
+		})
+		require.Nil(t, matcher)
+		require.ErrorIs(t, err, ErrInvalidQueryOperand)
+		require.EqualError(t, err, "invalid query operand for operator testin: no values")
+	})
+	t.Run("Query without an operator", func(t *testing.T) {
+		matcher, err := ParseQueryOperator(&models.Query{Name: testIndexName2, Value: testDocID1})
+		require.NoError(t, err)
+		require.Nil(t, matcher)
+	})
+	t.Run("Invalid registrations panic", func(t *testing.T) {
+		require.Panics(t, func() { RegisterQueryOperator("", inOperator{}) })
+		require.Panics(t, func() { RegisterQueryOperator("niloperator", nil) })
+		require.Panics(t, func() { RegisterQueryOperator("testin", inOperator{}) })
+	})
+}
@@ -0,0 +1,221 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// WithReadRepair enables read-repair. When a query finds a mapping document pointing at an encrypted document that
+// doesn't exist or doesn't have the queried attribute, the document is left out of the results and the stale mapping
+// documents are deleted in the background. Up to queueSize repairs can be waiting at a time. Any more are dropped,
+// since a later query will find the same stale mapping documents again.
+func WithReadRepair(queueSize uint) Option {
+	return func(p *Provider) {
+		p.readRepairer = &readRepairer{
+			jobs:    make(chan readRepairJob, queueSize),
+			pending: make(map[readRepairJob]struct{}),
+			stopped: make(chan struct{}),
+		}
+	}
+}
+
+// readRepairer deletes stale mapping documents found by queries, one at a time in a background goroutine.
+type readRepairer struct {
+	jobs    chan readRepairJob
+	once    sync.Once
+	mutex   sync.Mutex
+	pending map[readRepairJob]struct{}
+	closed  bool
+	stopped chan struct{}
+}
+
+type readRepairJob struct {
+	store         *Store
+	documentID    string
+	attributeName string
+}
+
+// schedule queues the repair of the mapping documents for the given attribute of the given document, unless it's
+// already queued. The background goroutine is started the first time this is called.
+func (r *readRepairer) schedule(job readRepairJob) {
+	r.once.Do(func() {
+		go r.run()
+	})
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, isPending := r.pending[job]; isPending || r.closed {
+		return
+	}
+
+	select {
+	case r.jobs <- job:
+		r.pending[job] = struct{}{}
+	default:
+		job.store.log().Debugf("Read-repair queue is full, so stale mapping documents for document %s in vault %s "+
+			"weren't scheduled for deletion", job.documentID, job.store.name)
+	}
+}
+
+// stop has the background goroutine finish the repairs already queued and exit. Repairs scheduled afterwards are
+// dropped. It returns a channel that's closed once the goroutine has exited.
+func (r *readRepairer) stop() <-chan struct{} {
+	r.mutex.Lock()
+
+	if !r.closed {
+		r.closed = true
+		close(r.jobs)
+	}
+
+	r.mutex.Unlock()
+
+	r.once.Do(func() {
+		go r.run()
+	})
+
+	return r.stopped
+}
+
+func (r *readRepairer) run() {
+	defer close(r.stopped)
+
+	for job := range r.jobs {
+		r.mutex.Lock()
+		delete(r.pending, job)
+		r.mutex.Unlock()
+
+		count, err := job.store.repairMappingDocuments(job.documentID, job.attributeName)
+		if err != nil {
+			job.store.log().Warnf("Failed to repair stale mapping documents for document %s in vault %s: %s",
+				job.documentID, job.store.name, err)
+
+			continue
+		}
+
+		if count > 0 {
+			job.store.log().Infof("Read-repair deleted %d stale mapping document(s) for document %s in vault %s",
+				count, job.documentID, job.store.name)
+
+			job.store.reportIndexInconsistencies(count, 0)
+		}
+	}
+}
+
+// staleMappingDocuments is called when a query finds that the document with the given ID doesn't exist or doesn't
+// have the queried attribute, even though a mapping document (or the attribute cache) says it does.
+func (c *Store) staleMappingDocuments(documentID, attributeName string) {
+	if c.attributeCache != nil {
+		c.updateAttributeCache(attributeName, c.attributeCache.Invalidate)
+	}
+
+	if c.readRepairer != nil {
+		c.readRepairer.schedule(readRepairJob{
+			store:         c.withoutContext(),
+			documentID:    documentID,
+			attributeName: attributeName,
+		})
+	}
+}
+
+// repairMappingDocuments deletes the mapping documents for the given attribute of the given document, if the
+// document still doesn't exist or doesn't have the attribute. It returns the number of mapping documents deleted.
+// Documents can be created without holding the document lock, so if one turns out to have been stored while the
+// mapping documents were being deleted, then they're stored again.
+func (c *Store) repairMappingDocuments(documentID, attributeName string) (int, error) {
+	unlock := c.documentLocks.lock(c.namespace.Key(documentID))
+	defer unlock()
+
+	return c.deleteOrphanedMappingDocuments(documentID, attributeName)
+}
+
+// deleteOrphanedMappingDocuments does the same as repairMappingDocuments, for callers that already hold the document's
+// lock.
+func (c *Store) deleteOrphanedMappingDocuments(documentID, attributeName string) (int, error) {
+	found, err := c.documentHasAttribute(documentID, attributeName)
+	if err != nil || found {
+		return 0, err
+	}
+
+	mappingDocuments, err := c.getMappingDocuments(documentIDQuery(
+		MappingDocumentMatchingEncryptedDocIDTagName, documentID))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get mapping documents: %w", err)
+	}
+
+	var deleted []indexMappingDocument
+
+	for _, mappingDocument := range mappingDocuments {
+		if mappingDocument.AttributeName != attributeName {
+			continue
+		}
+
+		err = c.deleteMappingDocument(mappingDocument)
+		if err != nil {
+			return len(deleted), fmt.Errorf(messages.DeleteMappingDocumentFailure, err)
+		}
+
+		deleted = append(deleted, mappingDocument)
+	}
+
+	found, err = c.documentHasAttribute(documentID, attributeName)
+	if err != nil || !found {
+		return len(deleted), err
+	}
+
+	for _, mappingDocument := range deleted {
+		err = c.putMappingDocument(mappingDocument)
+		if err != nil {
+			return 0, fmt.Errorf("failed to restore mapping document of a document stored during repair: %w", err)
+		}
+	}
+
+	return 0, nil
+}
+
+// documentHasAttribute returns whether the document with the given ID exists and has the given attribute.
+func (c *Store) documentHasAttribute(documentID, attributeName string) (bool, error) {
+	documentBytes, err := c.coreStore.Get(documentID)
+	if errors.Is(err, storage.ErrDataNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to get document: %w", err)
+	}
+
+	var document models.EncryptedDocument
+
+	err = json.Unmarshal(documentBytes, &document)
+	if err != nil {
+		return false, fmt.Errorf("failed to unmarshal document: %w", err)
+	}
+
+	return hasAttribute(&document, attributeName), nil
+}
+
+// hasAttribute returns whether the given document has an indexed attribute with the given name.
+func hasAttribute(document *models.EncryptedDocument, attributeName string) bool {
+	for _, indexedAttributeCollection := range document.IndexedAttributeCollections {
+		for _, indexedAttribute := range indexedAttributeCollection.IndexedAttributes {
+			if indexedAttribute.Name == attributeName {
+				return true
+			}
+		}
+	}
+
+	return false
+}
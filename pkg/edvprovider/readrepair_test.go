@@ -0,0 +1,91 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestStore_ReadRepair(t *testing.T) {
+	t.Run("Mapping documents for a missing document are deleted", func(t *testing.T) {
+		store := newReadRepairTestStore(t)
+
+		require.NoError(t, store.Put(createTestDocuments(t, testDocID1)[0]))
+		require.NoError(t, store.putMappingDocument(indexMappingDocument{
+			AttributeName: testAttributeName, MatchingEncryptedDocID: testDocID2, MappingDocumentName: "stale",
+		}))
+
+		requireQueryMatches(t, store, &models.Query{Has: testAttributeName}, testDocID1)
+		requireMappingDocumentsEventually(t, store, testDocID2, 0)
+	})
+	t.Run("Mapping documents for a document without the attribute are deleted", func(t *testing.T) {
+		store := newReadRepairTestStore(t)
+
+		documents := createTestDocuments(t, testDocID1, testDocID2)
+		documents[1].IndexedAttributeCollections[0].IndexedAttributes =
+			documents[1].IndexedAttributeCollections[0].IndexedAttributes[1:]
+
+		require.NoError(t, store.UpsertBulk(documents))
+		require.NoError(t, store.putMappingDocument(indexMappingDocument{
+			AttributeName: testAttributeName, MatchingEncryptedDocID: testDocID2, MappingDocumentName: "stale",
+		}))
+
+		requireQueryMatches(t, store, &models.Query{Has: testAttributeName}, testDocID1)
+		// The mapping document for the attribute the document still has is kept.
+		requireMappingDocumentsEventually(t, store, testDocID2, 1)
+	})
+	t.Run("Mapping documents of a document that has the attribute are kept", func(t *testing.T) {
+		store := newReadRepairTestStore(t)
+
+		require.NoError(t, store.Put(createTestDocuments(t, testDocID1)[0]))
+
+		count, err := store.repairMappingDocuments(testDocID1, testAttributeName)
+		require.NoError(t, err)
+		require.Zero(t, count)
+
+		requireQueryMatches(t, store, &models.Query{Has: testAttributeName}, testDocID1)
+	})
+	t.Run("Queries fail on missing documents without read-repair", func(t *testing.T) {
+		store, err := NewProvider(mem.NewProvider(), 100).OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		require.NoError(t, store.putMappingDocument(indexMappingDocument{
+			AttributeName: testAttributeName, MatchingEncryptedDocID: testDocID2, MappingDocumentName: "stale",
+		}))
+
+		_, err = store.Query(&models.Query{Has: testAttributeName})
+		require.Error(t, err)
+	})
+}
+
+func newReadRepairTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	store, err := NewProvider(mem.NewProvider(), 100, WithReadRepair(10)).OpenStore(testVaultID)
+	require.NoError(t, err)
+
+	return store
+}
+
+func requireMappingDocumentsEventually(t *testing.T, store *Store, documentID string, count int) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		mappingDocuments, err := store.getMappingDocuments(fmt.Sprintf("%s:%s",
+			MappingDocumentMatchingEncryptedDocIDTagName, documentID))
+		require.NoError(t, err)
+
+		return len(mappingDocuments) == count
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,89 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// referenceIDLockPrefix is prepended to reference IDs to get the keys of their locks in documentLocks. Vault IDs are
+// base58-encoded, so they never contain the separator.
+const referenceIDLockPrefix = "referenceId/"
+
+// RotateReferenceID changes the reference ID of the given vault to the one in the given rotation, increments the
+// sequence of the vault's configuration and returns the updated configuration. Unlike UpdateDataVaultConfiguration,
+// it replaces the vault's reference ID if it has one, so that a leaked reference ID can be retired. The new reference
+// ID must not be used by any vault, including this one. The configuration is stored along with the tag that reference
+// IDs are looked up by in a single write, so the vault is never found by both or neither of its reference IDs.
+// messages.ErrVaultNotFound is returned if the vault doesn't exist, messages.ErrDuplicateVault if the reference ID is
+// in use, and messages.ErrConfigurationSequenceConflict if the rotation's sequence isn't the next one.
+func (c *Store) RotateReferenceID(vaultID string,
+	rotation *models.ReferenceIDRotation) (*models.DataVaultConfiguration, error) {
+	store, err := c.beginWrite()
+	if err != nil {
+		return nil, err
+	}
+
+	return store.rotateReferenceID(vaultID, rotation)
+}
+
+func (c *Store) rotateReferenceID(vaultID string,
+	rotation *models.ReferenceIDRotation) (*models.DataVaultConfiguration, error) {
+	unlock := c.documentLocks.lock(c.namespace.Key(vaultID))
+	defer unlock()
+
+	unlockReferenceID := c.lockReferenceID(rotation.ReferenceID)
+	defer unlockReferenceID()
+
+	configEntry, err := getVaultConfigurationMapping(c.coreStore, c.encryption, vaultID)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &configEntry.DataVaultConfiguration
+
+	if rotation.Sequence != nil && *rotation.Sequence != config.Sequence+1 {
+		return nil, fmt.Errorf(messages.UnexpectedUpdateSequence, messages.ErrConfigurationSequenceConflict,
+			config.Sequence+1, *rotation.Sequence)
+	}
+
+	err = c.checkDuplicateReferenceID(rotation.ReferenceID)
+	if err != nil {
+		if errors.Is(err, messages.ErrDuplicateVault) {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf(messages.CheckDuplicateRefIDFailure, err)
+	}
+
+	config.ReferenceID = rotation.ReferenceID
+	config.Sequence++
+
+	configBytes, err := encodeVaultConfiguration(c.encryption, vaultID, configEntry)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.coreStore.Put(vaultID, configBytes, configurationTags(configEntry)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store configuration of vault %s: %w", vaultID, err)
+	}
+
+	c.log().Infof("Rotated the reference ID of vault %s", vaultID)
+
+	return config, nil
+}
+
+// lockReferenceID locks the given reference ID, so that it can be checked for duplicates and then given to a vault
+// without another vault being given it in between. It returns the function that unlocks it.
+func (c *Store) lockReferenceID(referenceID string) func() {
+	return c.documentLocks.lock(c.namespace.Key(referenceIDLockPrefix + referenceID))
+}
@@ -0,0 +1,91 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestStore_RotateReferenceID(t *testing.T) {
+	createConfigStore := func(t *testing.T) *Store {
+		t.Helper()
+
+		configStore, err := NewProvider(mem.NewProvider(), 100).OpenStore(VaultConfigurationStoreName)
+		require.NoError(t, err)
+
+		err = configStore.StoreDataVaultConfiguration(&models.DataVaultConfiguration{
+			Controller: "did:example:controller", ReferenceID: testReferenceID,
+		}, testVaultID)
+		require.NoError(t, err)
+
+		return configStore
+	}
+
+	t.Run("Success: the old reference ID is freed", func(t *testing.T) {
+		configStore := createConfigStore(t)
+
+		sequence := uint64(1)
+
+		config, err := configStore.RotateReferenceID(testVaultID,
+			&models.ReferenceIDRotation{ReferenceID: "newReferenceID", Sequence: &sequence})
+		require.NoError(t, err)
+		require.Equal(t, &models.DataVaultConfiguration{
+			Sequence: 1, Controller: "did:example:controller", ReferenceID: "newReferenceID",
+		}, config)
+
+		stored, err := getVaultConfigurationMapping(configStore.coreStore, nil, testVaultID)
+		require.NoError(t, err)
+		require.Equal(t, "newReferenceID", stored.DataVaultConfiguration.ReferenceID)
+
+		err = configStore.StoreDataVaultConfiguration(&models.DataVaultConfiguration{ReferenceID: "newReferenceID"},
+			"AnotherVault")
+		require.EqualError(t, err, fmt.Errorf(messages.CheckDuplicateRefIDFailure, messages.ErrDuplicateVault).Error())
+
+		err = configStore.StoreDataVaultConfiguration(&models.DataVaultConfiguration{ReferenceID: testReferenceID},
+			"AnotherVault")
+		require.NoError(t, err)
+	})
+	t.Run("Reference ID is used by another vault", func(t *testing.T) {
+		configStore := createConfigStore(t)
+
+		err := configStore.StoreDataVaultConfiguration(&models.DataVaultConfiguration{ReferenceID: "takenReferenceID"},
+			"AnotherVault")
+		require.NoError(t, err)
+
+		_, err = configStore.RotateReferenceID(testVaultID,
+			&models.ReferenceIDRotation{ReferenceID: "takenReferenceID"})
+		require.True(t, errors.Is(err, messages.ErrDuplicateVault))
+
+		// The vault's own reference ID is taken too.
+		_, err = configStore.RotateReferenceID(testVaultID, &models.ReferenceIDRotation{ReferenceID: testReferenceID})
+		require.True(t, errors.Is(err, messages.ErrDuplicateVault))
+	})
+	t.Run("Sequence conflict", func(t *testing.T) {
+		configStore := createConfigStore(t)
+
+		sequence := uint64(2)
+
+		_, err := configStore.RotateReferenceID(testVaultID,
+			&models.ReferenceIDRotation{ReferenceID: "newReferenceID", Sequence: &sequence})
+		require.True(t, errors.Is(err, messages.ErrConfigurationSequenceConflict))
+	})
+	t.Run("Vault not found", func(t *testing.T) {
+		configStore, err := NewProvider(mem.NewProvider(), 100).OpenStore(VaultConfigurationStoreName)
+		require.NoError(t, err)
+
+		_, err = configStore.RotateReferenceID(testVaultID, &models.ReferenceIDRotation{ReferenceID: "newReferenceID"})
+		require.True(t, errors.Is(err, messages.ErrVaultNotFound))
+	})
+}
@@ -0,0 +1,192 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+)
+
+// RevisionTagName is the tag name used for listing the revisions of a document. Its value is the document's ID.
+const RevisionTagName = "Revision"
+
+// revisionKeyInfix separates the document ID from the sequence in the keys of revisions.
+const revisionKeyInfix = "_revision_"
+
+// revisionRecord is a revision of a document: the document as it was written with a given sequence.
+type revisionRecord struct {
+	// Written is when the revision was written, which is when it became the current version of the document.
+	Written  time.Time       `json:"written"`
+	Document json.RawMessage `json:"document"`
+}
+
+// WithRevisionHistory keeps every revision of each document that's written, so that documents can be read as they
+// were with a given sequence (see Revision) or at a given time (see RevisionAsOf). Each revision is stored in the
+// same batch as the write that creates it. A document's revisions are deleted along with it, or in tombstone mode
+// along with its tombstone.
+// Without revision history, only the current version of each document is kept.
+func WithRevisionHistory() Option {
+	return func(p *Provider) {
+		p.revisionHistory = true
+	}
+}
+
+// Revision returns the revision of the given document that was written with the given sequence. An error wrapping
+// messages.ErrDocumentNotFound is returned if there's no such revision, and messages.ErrRevisionHistoryNotEnabled if
+// revisions aren't kept.
+func (c *Store) Revision(docID string, sequence uint64) ([]byte, error) {
+	if !c.revisionHistory {
+		return nil, messages.ErrRevisionHistoryNotEnabled
+	}
+
+	recordBytes, err := c.coreStore.Get(revisionKey(docID, sequence))
+	if err != nil {
+		if errors.Is(err, storage.ErrDataNotFound) {
+			return nil, fmt.Errorf("%w: there's no revision of document %s with sequence %d",
+				messages.ErrDocumentNotFound, docID, sequence)
+		}
+
+		return nil, fmt.Errorf("failed to get revision %d of document %s: %w", sequence, docID, err)
+	}
+
+	var record revisionRecord
+
+	err = json.Unmarshal(recordBytes, &record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal revision %d of document %s: %w", sequence, docID, err)
+	}
+
+	return record.Document, nil
+}
+
+// RevisionAsOf returns the revision of the given document that was the current one at the given time: the last one
+// written at or before it. An error wrapping messages.ErrDocumentNotFound is returned if the document didn't exist
+// yet at that time, or had been deleted by then, and messages.ErrRevisionHistoryNotEnabled if revisions aren't kept.
+func (c *Store) RevisionAsOf(docID string, asOf time.Time) ([]byte, error) {
+	if !c.revisionHistory {
+		return nil, messages.ErrRevisionHistoryNotEnabled
+	}
+
+	records, err := c.revisionRecords(docID)
+	if err != nil {
+		return nil, err
+	}
+
+	var effective *revisionRecord
+
+	for i := range records {
+		if !records[i].Written.After(asOf) && (effective == nil || records[i].Written.After(effective.Written)) {
+			effective = &records[i]
+		}
+	}
+
+	if effective == nil {
+		return nil, fmt.Errorf("%w: document %s didn't exist yet at %s", messages.ErrDocumentNotFound, docID,
+			asOf.Format(time.RFC3339))
+	}
+
+	tombstone, err := c.getTombstoneRecord(docID)
+	if err != nil && !errors.Is(err, messages.ErrDocumentNotFound) {
+		return nil, err
+	}
+
+	if tombstone != nil && tombstone.Deleted.After(effective.Written) && !tombstone.Deleted.After(asOf) {
+		return nil, fmt.Errorf("%w: document %s had been deleted by %s", messages.ErrDocumentNotFound, docID,
+			asOf.Format(time.RFC3339))
+	}
+
+	return effective.Document, nil
+}
+
+// revisionOperations returns the operation that stores the given document bytes as the revision of the document with
+// the given ID and sequence, or no operations if revisions aren't kept.
+func (c *Store) revisionOperations(docID string, sequence uint64, documentBytes []byte) ([]storage.Operation, error) {
+	if !c.revisionHistory {
+		return nil, nil
+	}
+
+	recordBytes, err := json.Marshal(revisionRecord{Written: time.Now().UTC(), Document: documentBytes})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal revision %d of document %s: %w", sequence, docID, err)
+	}
+
+	return []storage.Operation{{
+		Key: revisionKey(docID, sequence), Value: recordBytes, Tags: []storage.Tag{documentIDTag(RevisionTagName, docID)},
+	}}, nil
+}
+
+// revisionRecords returns the revisions of the given document, in no particular order.
+func (c *Store) revisionRecords(docID string) ([]revisionRecord, error) {
+	itr, err := c.coreStore.Query(documentIDQuery(RevisionTagName, docID),
+		storage.WithPageSize(int(c.retrievalPageSize)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query revisions of document %s: %w", docID, err)
+	}
+
+	defer storage.Close(itr, c.log())
+
+	var records []revisionRecord
+
+	moreEntries, err := itr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next entry from iterator: %w", err)
+	}
+
+	for moreEntries {
+		recordBytes, errValue := itr.Value()
+		if errValue != nil {
+			return nil, fmt.Errorf("failed to get value from iterator: %w", errValue)
+		}
+
+		var record revisionRecord
+
+		err = json.Unmarshal(recordBytes, &record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal revision of document %s: %w", docID, err)
+		}
+
+		records = append(records, record)
+
+		moreEntries, err = itr.Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get next entry from iterator: %w", err)
+		}
+	}
+
+	return records, nil
+}
+
+// deleteRevisions deletes the revisions of the given document. It does nothing if revisions aren't kept.
+func (c *Store) deleteRevisions(docID string) error {
+	if !c.revisionHistory {
+		return nil
+	}
+
+	keys, err := entryKeys(c.coreStore, documentIDQuery(RevisionTagName, docID), c.retrievalPageSize, c.log())
+	if err != nil {
+		return fmt.Errorf("failed to get revisions of document %s: %w", docID, err)
+	}
+
+	for _, key := range keys {
+		err = c.coreStore.Delete(key)
+		if err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+			return fmt.Errorf("failed to delete revision %s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+func revisionKey(docID string, sequence uint64) string {
+	return fmt.Sprintf("%s%s%d", docID, revisionKeyInfix, sequence)
+}
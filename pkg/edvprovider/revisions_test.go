@@ -0,0 +1,141 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestStore_Revisions(t *testing.T) {
+	t.Run("Every revision of a document can be read", func(t *testing.T) {
+		store := newRevisionTestStore(t)
+
+		beforeCreate := time.Now()
+		document := createTestDocuments(t, testDocID1)[0]
+
+		require.NoError(t, store.Put(document))
+
+		afterCreate := time.Now()
+		document.Sequence++
+
+		require.NoError(t, store.Update(document))
+
+		requireRevision(t, store, testDocID1, 0)
+		requireRevision(t, store, testDocID1, 1)
+
+		_, err := store.Revision(testDocID1, 2)
+		require.True(t, errors.Is(err, messages.ErrDocumentNotFound))
+
+		_, err = store.RevisionAsOf(testDocID1, beforeCreate)
+		require.True(t, errors.Is(err, messages.ErrDocumentNotFound))
+
+		requireRevisionAsOf(t, store, testDocID1, afterCreate, 0)
+		requireRevisionAsOf(t, store, testDocID1, time.Now(), 1)
+
+		// Revisions aren't documents.
+		documentSequences, err := store.DocumentSequences()
+		require.NoError(t, err)
+		require.Equal(t, map[string]uint64{testDocID1: 1}, documentSequences)
+
+		require.NoError(t, store.Delete(testDocID1))
+
+		_, err = store.Revision(testDocID1, 0)
+		require.True(t, errors.Is(err, messages.ErrDocumentNotFound))
+	})
+	t.Run("Upserted and imported documents have revisions", func(t *testing.T) {
+		store := newRevisionTestStore(t)
+
+		require.NoError(t, store.UpsertBulk(createTestDocuments(t, testDocID1, testDocID2)))
+		requireRevision(t, store, testDocID1, 0)
+		requireRevision(t, store, testDocID2, 0)
+
+		replicatedDocument, err := store.ExportDocument(testDocID1)
+		require.NoError(t, err)
+
+		importingStore := newRevisionTestStore(t)
+
+		require.NoError(t, importingStore.ImportDocument(replicatedDocument))
+		requireRevision(t, importingStore, testDocID1, 0)
+	})
+	t.Run("Deleted documents have no revision after their deletion", func(t *testing.T) {
+		store, err := NewProvider(mem.NewProvider(), 100, WithRevisionHistory(),
+			WithTombstoneRetention(time.Hour)).OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		require.NoError(t, store.Put(createTestDocuments(t, testDocID1)[0]))
+
+		beforeDelete := time.Now()
+
+		require.NoError(t, store.Delete(testDocID1))
+		requireRevisionAsOf(t, store, testDocID1, beforeDelete, 0)
+
+		_, err = store.RevisionAsOf(testDocID1, time.Now())
+		require.True(t, errors.Is(err, messages.ErrDocumentNotFound))
+
+		purged, err := store.purgeTombstones(time.Now().Add(2*time.Hour), nil)
+		require.NoError(t, err)
+		require.Equal(t, 1, purged)
+
+		_, err = store.Revision(testDocID1, 0)
+		require.True(t, errors.Is(err, messages.ErrDocumentNotFound))
+	})
+	t.Run("Revision history isn't enabled", func(t *testing.T) {
+		store := newStreamTestStore(t)
+
+		require.NoError(t, store.Put(createTestDocuments(t, testDocID1)[0]))
+
+		_, err := store.Revision(testDocID1, 0)
+		require.Equal(t, messages.ErrRevisionHistoryNotEnabled, err)
+
+		_, err = store.RevisionAsOf(testDocID1, time.Now())
+		require.Equal(t, messages.ErrRevisionHistoryNotEnabled, err)
+	})
+}
+
+func newRevisionTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	store, err := NewProvider(mem.NewProvider(), 100, WithRevisionHistory()).OpenStore(testVaultID)
+	require.NoError(t, err)
+
+	return store
+}
+
+func requireRevision(t *testing.T, store *Store, docID string, sequence uint64) {
+	t.Helper()
+
+	revisionBytes, err := store.Revision(docID, sequence)
+	require.NoError(t, err)
+	requireDocumentSequence(t, revisionBytes, docID, sequence)
+}
+
+func requireRevisionAsOf(t *testing.T, store *Store, docID string, asOf time.Time, sequence uint64) {
+	t.Helper()
+
+	revisionBytes, err := store.RevisionAsOf(docID, asOf)
+	require.NoError(t, err)
+	requireDocumentSequence(t, revisionBytes, docID, sequence)
+}
+
+func requireDocumentSequence(t *testing.T, documentBytes []byte, docID string, sequence uint64) {
+	t.Helper()
+
+	var document models.EncryptedDocument
+
+	require.NoError(t, json.Unmarshal(documentBytes, &document))
+	require.Equal(t, docID, document.ID)
+	require.Equal(t, sequence, document.Sequence)
+}
@@ -0,0 +1,116 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+)
+
+// Shutdown shuts the provider down for good, so that programs embedding the EDV server can exit cleanly. Warm-ups,
+// tombstone compaction, consistency checks and outbox relays that haven't started yet fail with
+// messages.ErrProviderShutDown, the ones in progress and the queued read-repairs are waited for, and then the
+// provider's open stores are flushed, so that writes that the database batches up aren't lost, and the database is
+// closed. Failed storage operations aren't retried any more (see WithStorageRetry). If ctx is done first, its error
+// is returned and the database is left open.
+func (c *Provider) Shutdown(ctx context.Context) error {
+	stopped := c.background.stop()
+
+	if c.storageRetrier != nil {
+		c.storageRetrier.stop()
+	}
+
+	if c.readRepairer != nil {
+		readRepairsStopped := c.readRepairer.stop()
+
+		select {
+		case <-readRepairsStopped:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for _, store := range c.coreProvider.GetOpenStores() {
+		err := store.Flush()
+		if err != nil {
+			return fmt.Errorf("failed to flush store: %w", err)
+		}
+	}
+
+	err := c.coreProvider.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close database: %w", err)
+	}
+
+	return nil
+}
+
+// DoBackgroundWork runs work, which isn't tied to a request, as part of the provider's background work, so that
+// Shutdown waits for it to finish before closing the database. If the provider has been shut down, work isn't run and
+// messages.ErrProviderShutDown is returned.
+func (c *Provider) DoBackgroundWork(work func() error) error {
+	err := c.background.begin()
+	if err != nil {
+		return err
+	}
+
+	defer c.background.end()
+
+	return work()
+}
+
+// backgroundWork keeps track of the work that the provider does across all vaults, such as tombstone compaction,
+// so that Shutdown can wait for it to finish.
+type backgroundWork struct {
+	mutex    sync.Mutex
+	stopped  bool
+	inFlight sync.WaitGroup
+}
+
+// begin returns messages.ErrProviderShutDown if the provider has been shut down. Otherwise, end has to be called once
+// the work is done.
+func (b *backgroundWork) begin() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.stopped {
+		return messages.ErrProviderShutDown
+	}
+
+	b.inFlight.Add(1)
+
+	return nil
+}
+
+func (b *backgroundWork) end() {
+	b.inFlight.Done()
+}
+
+// stop refuses any further work, and returns a channel that's closed once the work in progress is done.
+func (b *backgroundWork) stop() <-chan struct{} {
+	b.mutex.Lock()
+	b.stopped = true
+	b.mutex.Unlock()
+
+	stopped := make(chan struct{})
+
+	go func() {
+		b.inFlight.Wait()
+		close(stopped)
+	}()
+
+	return stopped
+}
@@ -0,0 +1,120 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mock"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestProvider_Shutdown(t *testing.T) {
+	t.Run("Background work is refused and the database is closed", func(t *testing.T) {
+		coreProvider := &closeRecordingProvider{Provider: mem.NewProvider()}
+		provider := NewProvider(coreProvider, 100, WithTombstoneRetention(time.Hour), WithOutbox(),
+			WithReadRepair(10), WithAsyncIndexing(1))
+		createVaultWithDocuments(t, provider)
+
+		require.NoError(t, provider.Shutdown(context.Background()))
+		require.True(t, coreProvider.closed)
+
+		_, err := provider.WarmUp(testVaultID)
+		require.True(t, errors.Is(err, messages.ErrProviderShutDown))
+
+		_, err = provider.PurgeTombstones(nil)
+		require.True(t, errors.Is(err, messages.ErrProviderShutDown))
+
+		_, err = provider.CheckAllVaultsConsistency()
+		require.True(t, errors.Is(err, messages.ErrProviderShutDown))
+
+		_, err = provider.RelayOutbox(func(*models.VaultEvent) error { return nil })
+		require.True(t, errors.Is(err, messages.ErrProviderShutDown))
+
+		_, err = provider.ProcessIndexingQueues()
+		require.True(t, errors.Is(err, messages.ErrProviderShutDown))
+
+		err = provider.DoBackgroundWork(func() error {
+			t.Fatal("background work was run after shutdown")
+
+			return nil
+		})
+		require.True(t, errors.Is(err, messages.ErrProviderShutDown))
+
+		// Read-repairs scheduled once the provider is shut down are dropped.
+		provider.readRepairer.schedule(readRepairJob{documentID: testDocID1})
+		require.Empty(t, provider.readRepairer.pending)
+	})
+	t.Run("Background work in progress is waited for", func(t *testing.T) {
+		coreProvider := &closeRecordingProvider{Provider: mem.NewProvider()}
+		provider := NewProvider(coreProvider, 100)
+
+		require.NoError(t, provider.background.begin())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		require.Equal(t, context.Canceled, provider.Shutdown(ctx))
+		require.False(t, coreProvider.closed)
+
+		provider.background.end()
+
+		require.NoError(t, provider.Shutdown(context.Background()))
+		require.True(t, coreProvider.closed)
+	})
+	t.Run("Background work is run until the provider is shut down", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+
+		errWork := errors.New("work error")
+
+		require.Equal(t, errWork, provider.DoBackgroundWork(func() error { return errWork }))
+		require.NoError(t, provider.Shutdown(context.Background()))
+	})
+	t.Run("Fail to flush store", func(t *testing.T) {
+		provider := NewProvider(&openStoresProvider{
+			Provider:   mem.NewProvider(),
+			openStores: []storage.Store{&mock.Store{ErrFlush: errors.New("flush error")}},
+		}, 100)
+
+		require.EqualError(t, provider.Shutdown(context.Background()), "failed to flush store: flush error")
+	})
+	t.Run("Fail to close database", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{ErrClose: errors.New("close error")}, 100)
+
+		require.EqualError(t, provider.Shutdown(context.Background()), "failed to close database: close error")
+	})
+}
+
+// openStoresProvider is a storage provider with the given open stores.
+type openStoresProvider struct {
+	storage.Provider
+	openStores []storage.Store
+}
+
+func (p *openStoresProvider) GetOpenStores() []storage.Store {
+	return p.openStores
+}
+
+// closeRecordingProvider is a storage provider that records whether it has been closed.
+type closeRecordingProvider struct {
+	storage.Provider
+	closed bool
+}
+
+func (p *closeRecordingProvider) Close() error {
+	p.closed = true
+
+	return p.Provider.Close()
+}
@@ -0,0 +1,465 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+
+	"github.com/trustbloc/edv/pkg/logging"
+)
+
+// The error labels and codes that MongoDB (and Cosmos DB's API for MongoDB) give to errors that are safe to retry.
+const (
+	mongoRetryableWriteErrorLabel       = "RetryableWriteError"
+	mongoTransientTransactionErrorLabel = "TransientTransactionError"
+	mongoNetworkErrorLabel              = "NetworkError"
+	mongoShutdownInProgressCode         = 91
+	mongoPrimarySteppedDownCode         = 189
+	mongoNotWritablePrimaryCode         = 10107
+	mongoInterruptedAtShutdownCode      = 11600
+	cosmosTooManyRequestsCode           = 16500
+)
+
+// mongoObjectTooLargeCode is the code of the error that MongoDB gives to a write with a document that's too large.
+const mongoObjectTooLargeCode = 10334
+
+// StorageRetryPolicy is how the operations of one type on the underlying storage are retried when they fail with a
+// transient error.
+type StorageRetryPolicy struct {
+	// MaxRetries is the number of times that a failed operation is retried. If it's 0, then it isn't retried.
+	MaxRetries uint
+	// Backoff is how long the first retry waits for. The wait doubles with every retry, up to MaxBackoff.
+	Backoff time.Duration
+	// MaxBackoff is the longest that a retry waits for. If it's 0, then the wait isn't capped.
+	MaxBackoff time.Duration
+	// Jitter is the share of each wait, from 0 to 1, that is randomized, so that the EDV servers that share a
+	// database don't all retry at once. If it's 0, then retries wait for exactly their backoff.
+	Jitter float64
+}
+
+// StorageRetry configures the retrying of operations on the underlying storage (see WithStorageRetry).
+type StorageRetry struct {
+	// Read is the policy for reads: getting values and tags, queries, and getting store configurations.
+	Read StorageRetryPolicy
+	// Write is the policy for writes: puts, deletes, batches, flushes, setting store configurations, and opening and
+	// deleting stores, which create and delete databases on some storage backends.
+	Write StorageRetryPolicy
+	// IsTransient returns whether a failed operation may succeed if it's retried. Defaults to IsTransientStorageError.
+	IsTransient func(err error) bool
+}
+
+// WithStorageRetry has operations on the underlying storage that fail with transient errors, such as reset
+// connections and rate limiting by the database, retried with exponential backoff, instead of failing the request
+// that they're for. Every operation on the underlying storage is idempotent, so retrying one that may have been
+// applied before it failed is safe. Retries stop waiting once the provider is shut down.
+// Only opening a query is retried, not fetching its later pages. Failed batch writes are retried as a whole before
+// they're split (see WithBatchRetry), and the function that decides which errors are transient is used for both.
+func WithStorageRetry(retry StorageRetry) Option {
+	return func(p *Provider) {
+		if retry.IsTransient == nil {
+			retry.IsTransient = IsTransientStorageError
+		}
+
+		p.storageRetry = &retry
+	}
+}
+
+// IsTransientStorageError returns whether err is a transient error from the underlying storage, which may not happen
+// again if the operation that it's from is retried: network timeouts, reset or refused connections, connections
+// closed partway through a response, CouchDB's 429, 502, 503 and 504 status codes, and the MongoDB errors that its
+// driver labels as retryable, along with Cosmos DB's rate limiting. Errors that are wrapped with %w are unwrapped.
+func IsTransientStorageError(err error) bool {
+	if err == nil || errors.Is(err, storage.ErrDataNotFound) || errors.Is(err, storage.ErrDuplicateKey) ||
+		errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	return isTransientNetworkError(err) || isTransientCouchDBError(err) || isTransientMongoDBError(err)
+}
+
+func isTransientNetworkError(err error) bool {
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// isTransientCouchDBError checks the status code of the errors of CouchDB's client.
+func isTransientCouchDBError(err error) bool {
+	var statusErr interface{ StatusCode() int }
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+
+	switch statusErr.StatusCode() {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// isTransientMongoDBError checks the labels and codes of the server and network errors of MongoDB's driver.
+func isTransientMongoDBError(err error) bool {
+	var labeledErr interface{ HasErrorLabel(label string) bool }
+	if errors.As(err, &labeledErr) {
+		for _, label := range []string{
+			mongoRetryableWriteErrorLabel, mongoTransientTransactionErrorLabel, mongoNetworkErrorLabel,
+		} {
+			if labeledErr.HasErrorLabel(label) {
+				return true
+			}
+		}
+	}
+
+	var codedErr interface{ HasErrorCode(code int) bool }
+	if errors.As(err, &codedErr) {
+		for _, code := range []int{
+			mongoShutdownInProgressCode, mongoPrimarySteppedDownCode, mongoNotWritablePrimaryCode,
+			mongoInterruptedAtShutdownCode, cosmosTooManyRequestsCode,
+		} {
+			if codedErr.HasErrorCode(code) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// retryStorage wraps the underlying storage provider in one that retries its operations, if storage retry is enabled.
+// It's called once all the options have been applied, so that it doesn't matter which order they're given in.
+func (c *Provider) retryStorage() {
+	if c.storageRetry == nil {
+		return
+	}
+
+	if c.batchRetry != nil {
+		c.batchRetry.isTransient = c.storageRetry.IsTransient
+	}
+
+	c.storageRetrier = newStorageRetrier(c.storageRetry, c.log())
+	c.coreProvider = newRetryingProvider(c.coreProvider, c.storageRetrier)
+
+	// The options that keep the underlying storage provider were applied before it was wrapped.
+	if c.tenancy != nil {
+		c.tenancy.coreProvider = c.coreProvider
+	}
+
+	if c.vaultLimits != nil {
+		c.vaultLimits.coreProvider = c.coreProvider
+	}
+
+	if c.encryption != nil {
+		c.encryption.coreProvider = c.coreProvider
+	}
+
+	if c.outbox != nil {
+		c.outbox.coreProvider = c.coreProvider
+	}
+}
+
+// storageRetrier retries the operations of the retrying providers and stores of a provider.
+type storageRetrier struct {
+	retry  StorageRetry
+	logger logging.Logger
+	// ctx is canceled when the provider is shut down, so that retries stop waiting.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newStorageRetrier(retry *StorageRetry, logger logging.Logger) *storageRetrier {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &storageRetrier{retry: *retry, logger: logger, ctx: ctx, cancel: cancel}
+}
+
+// do calls operation until it succeeds, fails with an error that isn't transient, or has been retried as many times
+// as the policy allows. It returns the last error. Retries stop waiting once ctx is done, or the provider is shut
+// down.
+func (r *storageRetrier) do(ctx context.Context, policy *StorageRetryPolicy, name string,
+	operation func() error) error {
+	err := operation()
+
+	for retries := uint(0); err != nil && retries < policy.MaxRetries && r.retry.IsTransient(err); retries++ {
+		wait := policy.wait(retries)
+
+		r.logger.Debugf("Retrying %s in %s after transient storage error: %s", name, wait, err)
+
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-timer.C:
+		case <-r.ctx.Done():
+			timer.Stop()
+
+			return err
+		case <-ctx.Done():
+			timer.Stop()
+
+			return err
+		}
+
+		err = operation()
+	}
+
+	return err
+}
+
+// stop stops retries from waiting, so that they return the error they're retrying straight away.
+func (r *storageRetrier) stop() {
+	r.cancel()
+}
+
+// wait returns how long to wait before the given retry, counting from 0.
+func (p *StorageRetryPolicy) wait(retry uint) time.Duration {
+	wait := p.Backoff
+
+	for i := uint(0); i < retry && (p.MaxBackoff == 0 || wait < p.MaxBackoff); i++ {
+		wait *= 2
+	}
+
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+
+	if p.Jitter <= 0 || wait <= 0 {
+		return wait
+	}
+
+	jitter := time.Duration(p.Jitter * float64(wait))
+
+	// The jitter only spreads retries out, so it doesn't need a cryptographically secure source of randomness.
+	return wait - jitter + time.Duration(rand.Int63n(int64(jitter)+1)) // nolint:gosec
+}
+
+// retryingProvider retries the operations of the underlying storage provider and of the stores that it opens.
+type retryingProvider struct {
+	storage.Provider
+	retrier *storageRetrier
+}
+
+// retryingStoreDeleter is a retryingProvider for storage providers that can delete the databases of stores.
+type retryingStoreDeleter struct {
+	*retryingProvider
+	deleter storeDeleter
+}
+
+func newRetryingProvider(provider storage.Provider, retrier *storageRetrier) storage.Provider {
+	retrying := &retryingProvider{Provider: provider, retrier: retrier}
+
+	if deleter, ok := provider.(storeDeleter); ok {
+		return &retryingStoreDeleter{retryingProvider: retrying, deleter: deleter}
+	}
+
+	return retrying
+}
+
+func (p *retryingProvider) OpenStore(name string) (storage.Store, error) {
+	var store storage.Store
+
+	err := p.retrier.do(context.Background(), &p.retrier.retry.Write, "opening store "+name, func() error {
+		var err error
+
+		store, err = p.Provider.OpenStore(name)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &retryingStore{Store: store, retrier: p.retrier, ctx: context.Background()}, nil
+}
+
+func (p *retryingProvider) SetStoreConfig(name string, config storage.StoreConfiguration) error {
+	return p.retrier.do(context.Background(), &p.retrier.retry.Write, "setting configuration of store "+name,
+		func() error {
+			return p.Provider.SetStoreConfig(name, config)
+		})
+}
+
+func (p *retryingProvider) GetStoreConfig(name string) (storage.StoreConfiguration, error) {
+	var config storage.StoreConfiguration
+
+	err := p.retrier.do(context.Background(), &p.retrier.retry.Read, "getting configuration of store "+name, func() error {
+		var err error
+
+		config, err = p.Provider.GetStoreConfig(name)
+
+		return err
+	})
+
+	return config, err
+}
+
+func (p *retryingStoreDeleter) DeleteStore(name string) error {
+	return p.retrier.do(context.Background(), &p.retrier.retry.Write, "deleting store "+name, func() error {
+		return p.deleter.DeleteStore(name)
+	})
+}
+
+// retryingStore retries the operations of an underlying store. It always implements KeyCheckingStore,
+// StreamingStore and ConditionalStore, and falls back to what Store does without them if the underlying store doesn't.
+type retryingStore struct {
+	storage.Store
+	retrier *storageRetrier
+	// ctx is the context of the store that the retrying store belongs to (see Store.WithContext).
+	ctx context.Context
+}
+
+func (s *retryingStore) Put(key string, value []byte, tags ...storage.Tag) error {
+	return s.retrier.do(s.ctx, &s.retrier.retry.Write, "put of "+key, func() error {
+		return s.Store.Put(key, value, tags...)
+	})
+}
+
+func (s *retryingStore) Get(key string) ([]byte, error) {
+	var value []byte
+
+	err := s.retrier.do(s.ctx, &s.retrier.retry.Read, "get of "+key, func() error {
+		var err error
+
+		value, err = s.Store.Get(key)
+
+		return err
+	})
+
+	return value, err
+}
+
+func (s *retryingStore) GetTags(key string) ([]storage.Tag, error) {
+	var tags []storage.Tag
+
+	err := s.retrier.do(s.ctx, &s.retrier.retry.Read, "get of tags of "+key, func() error {
+		var err error
+
+		tags, err = s.Store.GetTags(key)
+
+		return err
+	})
+
+	return tags, err
+}
+
+func (s *retryingStore) GetBulk(keys ...string) ([][]byte, error) {
+	var values [][]byte
+
+	err := s.retrier.do(s.ctx, &s.retrier.retry.Read, "bulk get", func() error {
+		var err error
+
+		values, err = s.Store.GetBulk(keys...)
+
+		return err
+	})
+
+	return values, err
+}
+
+func (s *retryingStore) Query(expression string, options ...storage.QueryOption) (storage.Iterator, error) {
+	var iterator storage.Iterator
+
+	err := s.retrier.do(s.ctx, &s.retrier.retry.Read, "query "+expression, func() error {
+		var err error
+
+		iterator, err = s.Store.Query(expression, options...)
+
+		return err
+	})
+
+	return iterator, err
+}
+
+func (s *retryingStore) Delete(key string) error {
+	return s.retrier.do(s.ctx, &s.retrier.retry.Write, "delete of "+key, func() error {
+		return s.Store.Delete(key)
+	})
+}
+
+func (s *retryingStore) Batch(operations []storage.Operation) error {
+	return s.retrier.do(s.ctx, &s.retrier.retry.Write, "batch", func() error {
+		return s.Store.Batch(operations)
+	})
+}
+
+func (s *retryingStore) Flush() error {
+	return s.retrier.do(s.ctx, &s.retrier.retry.Write, "flush", s.Store.Flush)
+}
+
+// Exists implements KeyCheckingStore.
+func (s *retryingStore) Exists(key string) (bool, error) {
+	keyCheckingStore, ok := s.Store.(KeyCheckingStore)
+	if !ok {
+		return existsByTags(s, key)
+	}
+
+	var exists bool
+
+	err := s.retrier.do(s.ctx, &s.retrier.retry.Read, "existence check of "+key, func() error {
+		var err error
+
+		exists, err = keyCheckingStore.Exists(key)
+
+		return err
+	})
+
+	return exists, err
+}
+
+// BatchIf implements ConditionalStore. A conditional write that's retried after it was done, but its result was
+// lost, reports that it wasn't done.
+func (s *retryingStore) BatchIf(expected map[string][]byte, operations []storage.Operation) (bool, error) {
+	conditionalStore, ok := s.Store.(ConditionalStore)
+	if !ok {
+		return batchIfByGet(s, expected, operations)
+	}
+
+	var written bool
+
+	err := s.retrier.do(s.ctx, &s.retrier.retry.Write, "conditional batch", func() error {
+		var err error
+
+		written, err = conditionalStore.BatchIf(expected, operations)
+
+		return err
+	})
+
+	return written, err
+}
+
+// GetStream implements StreamingStore. Only opening the stream is retried, not reading from it.
+func (s *retryingStore) GetStream(key string) (io.ReadCloser, error) {
+	streamingStore, ok := s.Store.(StreamingStore)
+	if !ok {
+		return streamFromValue(s, key)
+	}
+
+	var stream io.ReadCloser
+
+	err := s.retrier.do(s.ctx, &s.retrier.retry.Read, "get of stream of "+key, func() error {
+		var err error
+
+		stream, err = streamingStore.GetStream(key)
+
+		return err
+	})
+
+	return stream, err
+}
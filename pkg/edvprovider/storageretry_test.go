@@ -0,0 +1,385 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsTransientStorageError(t *testing.T) {
+	for _, test := range []struct {
+		err       error
+		transient bool
+	}{
+		{nil, false},
+		{errors.New("invalid query"), false},
+		{fmt.Errorf("failed to get: %w", storage.ErrDataNotFound), false},
+		{storage.ErrDuplicateKey, false},
+		{context.Canceled, false},
+		{fmt.Errorf("failed to put: %w", syscall.ECONNRESET), true},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{io.ErrUnexpectedEOF, true},
+		{&net.DNSError{IsTimeout: true}, true},
+		{&net.DNSError{}, false},
+		{fmt.Errorf("failed to query: %w", statusError(http.StatusTooManyRequests)), true},
+		{statusError(http.StatusServiceUnavailable), true},
+		{statusError(http.StatusNotFound), false},
+		{labeledError("RetryableWriteError"), true},
+		{labeledError("NoWritesPerformed"), false},
+		{codedError(cosmosTooManyRequestsCode), true},
+		{codedError(11000), false},
+	} {
+		require.Equal(t, test.transient, IsTransientStorageError(test.err), fmt.Sprint(test.err))
+	}
+}
+
+func TestProvider_StorageRetry(t *testing.T) {
+	policy := StorageRetryPolicy{MaxRetries: 2, Backoff: time.Millisecond}
+	retry := StorageRetry{Read: policy, Write: policy}
+
+	t.Run("Success after retrying", func(t *testing.T) {
+		coreProvider := &flakyProvider{Provider: mem.NewProvider(), err: syscall.ECONNRESET, failures: 2}
+
+		provider := NewProvider(coreProvider, 100, WithStorageRetry(retry))
+
+		store, err := provider.OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		coreProvider.failures = 2
+
+		require.NoError(t, provider.SetStoreConfig(testVaultID, storage.StoreConfiguration{}))
+
+		coreProvider.failures = 2
+
+		exists, err := provider.StoreExists(testVaultID)
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		coreStore := store.coreStore
+		operations := map[string]func() error{
+			"put": func() error {
+				return coreStore.Put(testDocID1, []byte("{}"), storage.Tag{Name: "tag"})
+			},
+			"get": func() error {
+				_, err := coreStore.Get(testDocID1)
+				return err
+			},
+			"get tags": func() error {
+				_, err := coreStore.GetTags(testDocID1)
+				return err
+			},
+			"get bulk": func() error {
+				_, err := coreStore.GetBulk(testDocID1)
+				return err
+			},
+			"query": func() error {
+				_, err := coreStore.Query("tag")
+				return err
+			},
+			"batch": func() error {
+				return coreStore.Batch([]storage.Operation{{Key: testDocID2, Value: []byte("{}")}})
+			},
+			"flush": coreStore.Flush,
+			"exists": func() error {
+				exists, err := store.Exists(testDocID1)
+				require.True(t, exists)
+
+				return err
+			},
+			"get stream": func() error {
+				stream, err := store.GetStream(testDocID1)
+				if err != nil {
+					return err
+				}
+
+				value, err := ioutil.ReadAll(stream)
+				require.Equal(t, "{}", string(value))
+
+				return err
+			},
+			"delete": func() error {
+				return coreStore.Delete(testDocID1)
+			},
+		}
+
+		for _, name := range []string{
+			"put", "get", "get tags", "get bulk", "query", "batch", "flush", "exists", "get stream", "delete",
+		} {
+			coreProvider.failures = 2
+			require.NoError(t, operations[name](), name)
+		}
+
+		exists, err = store.Exists(testDocID1)
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+	t.Run("Give up after the last retry", func(t *testing.T) {
+		coreProvider := &flakyProvider{Provider: mem.NewProvider(), err: syscall.ECONNRESET}
+
+		provider := NewProvider(coreProvider, 100, WithStorageRetry(retry))
+
+		coreProvider.failures = 3
+
+		_, err := provider.OpenStore(VaultConfigurationStoreName)
+		require.True(t, errors.Is(err, syscall.ECONNRESET))
+		require.Equal(t, 3, coreProvider.calls)
+	})
+	t.Run("Don't retry errors that aren't transient", func(t *testing.T) {
+		coreProvider := &flakyProvider{Provider: mem.NewProvider(), err: errors.New("invalid store name")}
+
+		provider := NewProvider(coreProvider, 100, WithStorageRetry(retry))
+
+		coreProvider.failures = 1
+
+		_, err := provider.OpenStore(VaultConfigurationStoreName)
+		require.EqualError(t, err, "failed to open underlying store: invalid store name")
+		require.Equal(t, 1, coreProvider.calls)
+	})
+	t.Run("Retry with another error classification", func(t *testing.T) {
+		coreProvider := &flakyProvider{Provider: mem.NewProvider(), err: errors.New("try again")}
+
+		provider := NewProvider(coreProvider, 100, WithStorageRetry(StorageRetry{
+			Write:       policy,
+			IsTransient: func(err error) bool { return strings.Contains(err.Error(), "try again") },
+		}))
+
+		coreProvider.failures = 1
+
+		_, err := provider.OpenStore(VaultConfigurationStoreName)
+		require.NoError(t, err)
+		require.Equal(t, 2, coreProvider.calls)
+	})
+	t.Run("Stop waiting once the provider is shut down", func(t *testing.T) {
+		coreProvider := &flakyProvider{Provider: mem.NewProvider(), err: syscall.ECONNRESET}
+
+		provider := NewProvider(coreProvider, 100, WithStorageRetry(StorageRetry{
+			Write: StorageRetryPolicy{MaxRetries: 1, Backoff: time.Hour},
+		}))
+
+		coreProvider.failures = 2
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			require.NoError(t, provider.Shutdown(context.Background()))
+		}()
+
+		_, err := provider.OpenStore(VaultConfigurationStoreName)
+		require.True(t, errors.Is(err, syscall.ECONNRESET))
+	})
+	t.Run("Delete a store with a storage provider that can delete stores", func(t *testing.T) {
+		deleter := &storeDeletingProvider{Provider: mem.NewProvider()}
+		coreProvider := &flakyStoreDeleter{
+			flakyProvider: &flakyProvider{Provider: deleter, err: syscall.ECONNRESET},
+			deleter:       deleter,
+		}
+
+		provider := NewProvider(coreProvider, 100, WithStorageRetry(retry))
+
+		_, err := provider.OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		coreProvider.failures = 2
+
+		require.NoError(t, provider.DeleteStore(testVaultID))
+		require.Len(t, deleter.deletedStores, 1)
+	})
+}
+
+func TestStorageRetryPolicy_Wait(t *testing.T) {
+	policy := StorageRetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	require.Equal(t, 100*time.Millisecond, policy.wait(0))
+	require.Equal(t, 800*time.Millisecond, policy.wait(3))
+	require.Equal(t, time.Second, policy.wait(4))
+	require.Equal(t, time.Second, policy.wait(1000))
+
+	policy = StorageRetryPolicy{Backoff: 100 * time.Millisecond, Jitter: 0.5}
+
+	for i := 0; i < 10; i++ {
+		wait := policy.wait(0)
+		require.GreaterOrEqual(t, wait, 50*time.Millisecond)
+		require.LessOrEqual(t, wait, 100*time.Millisecond)
+	}
+
+	policy = StorageRetryPolicy{Jitter: 1}
+	require.Zero(t, policy.wait(2))
+}
+
+type statusError int
+
+func (e statusError) Error() string {
+	return http.StatusText(int(e))
+}
+
+func (e statusError) StatusCode() int {
+	return int(e)
+}
+
+type labeledError string
+
+func (e labeledError) Error() string {
+	return "server error"
+}
+
+func (e labeledError) HasErrorLabel(label string) bool {
+	return string(e) == label
+}
+
+type codedError int
+
+func (e codedError) Error() string {
+	return "server error"
+}
+
+func (e codedError) HasErrorCode(code int) bool {
+	return int(e) == code
+}
+
+// flakyProvider fails the given number of operations of its stores, and of opening stores, with err.
+type flakyProvider struct {
+	storage.Provider
+	err      error
+	failures int
+	calls    int
+}
+
+func (p *flakyProvider) fail() error {
+	p.calls++
+
+	if p.failures == 0 {
+		return nil
+	}
+
+	p.failures--
+
+	return p.err
+}
+
+func (p *flakyProvider) OpenStore(name string) (storage.Store, error) {
+	if err := p.fail(); err != nil {
+		return nil, fmt.Errorf("failed to open underlying store: %w", err)
+	}
+
+	store, err := p.Provider.OpenStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &flakyStore{Store: store, provider: p}, nil
+}
+
+func (p *flakyProvider) SetStoreConfig(name string, config storage.StoreConfiguration) error {
+	if err := p.fail(); err != nil {
+		return err
+	}
+
+	return p.Provider.SetStoreConfig(name, config)
+}
+
+func (p *flakyProvider) GetStoreConfig(name string) (storage.StoreConfiguration, error) {
+	if err := p.fail(); err != nil {
+		return storage.StoreConfiguration{}, err
+	}
+
+	return p.Provider.GetStoreConfig(name)
+}
+
+type flakyStoreDeleter struct {
+	*flakyProvider
+	deleter storeDeleter
+}
+
+func (p *flakyStoreDeleter) DeleteStore(name string) error {
+	if err := p.fail(); err != nil {
+		return err
+	}
+
+	return p.deleter.DeleteStore(name)
+}
+
+type flakyStore struct {
+	storage.Store
+	provider *flakyProvider
+}
+
+func (s *flakyStore) Put(key string, value []byte, tags ...storage.Tag) error {
+	if err := s.provider.fail(); err != nil {
+		return err
+	}
+
+	return s.Store.Put(key, value, tags...)
+}
+
+func (s *flakyStore) Get(key string) ([]byte, error) {
+	if err := s.provider.fail(); err != nil {
+		return nil, err
+	}
+
+	return s.Store.Get(key)
+}
+
+func (s *flakyStore) GetTags(key string) ([]storage.Tag, error) {
+	if err := s.provider.fail(); err != nil {
+		return nil, err
+	}
+
+	return s.Store.GetTags(key)
+}
+
+func (s *flakyStore) GetBulk(keys ...string) ([][]byte, error) {
+	if err := s.provider.fail(); err != nil {
+		return nil, err
+	}
+
+	return s.Store.GetBulk(keys...)
+}
+
+func (s *flakyStore) Query(expression string, options ...storage.QueryOption) (storage.Iterator, error) {
+	if err := s.provider.fail(); err != nil {
+		return nil, err
+	}
+
+	return s.Store.Query(expression, options...)
+}
+
+func (s *flakyStore) Delete(key string) error {
+	if err := s.provider.fail(); err != nil {
+		return err
+	}
+
+	return s.Store.Delete(key)
+}
+
+func (s *flakyStore) Batch(operations []storage.Operation) error {
+	if err := s.provider.fail(); err != nil {
+		return err
+	}
+
+	return s.Store.Batch(operations)
+}
+
+func (s *flakyStore) Flush() error {
+	if err := s.provider.fail(); err != nil {
+		return err
+	}
+
+	return s.Store.Flush()
+}
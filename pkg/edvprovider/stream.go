@@ -0,0 +1,83 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+)
+
+// StreamingStore can be implemented by the stores of a storage backend that can read a value without loading all of
+// it into memory. Store.GetStream uses it when the backend's stores implement it.
+type StreamingStore interface {
+	// GetStream returns a reader for the value associated with the given key. The caller must close it.
+	// storage.ErrDataNotFound is returned if the key doesn't exist.
+	GetStream(key string) (io.ReadCloser, error)
+}
+
+// GetStream returns a reader for the document associated with the given key, so that the document can be copied to
+// its destination without being held in memory more than once. The caller must close the reader.
+// If the storage backend doesn't implement StreamingStore, then the document is read in full and then streamed from
+// memory.
+func (c *Store) GetStream(k string) (io.ReadCloser, error) {
+	if streamingStore, ok := c.coreStore.(StreamingStore); ok {
+		return streamingStore.GetStream(k)
+	}
+
+	documentBytes, err := c.coreStore.Get(k)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(documentBytes)), nil
+}
+
+// streamFromValue reads the value of the given key in full, and returns a reader for it, for stores that don't
+// implement StreamingStore.
+func streamFromValue(store storage.Store, key string) (io.ReadCloser, error) {
+	value, err := store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(value)), nil
+}
+
+// Sequence returns the sequence of the document with the given ID. The sequence is taken from the document's
+// EncryptedDocumentSequenceTagName tag, so the document itself only has to be read if it was stored without one.
+// messages.ErrDocumentNotFound is returned if the document doesn't exist.
+func (c *Store) Sequence(docID string) (uint64, error) {
+	tags, err := c.coreStore.GetTags(docID)
+	if err != nil {
+		if errors.Is(err, storage.ErrDataNotFound) {
+			return c.getCurrentSequence(docID)
+		}
+
+		return 0, fmt.Errorf("failed to get tags of document %s: %w", docID, err)
+	}
+
+	for _, tag := range tags {
+		if tag.Name != EncryptedDocumentSequenceTagName {
+			continue
+		}
+
+		sequence, errParse := strconv.ParseUint(tag.Value, 10, 64)
+		if errParse != nil {
+			return 0, fmt.Errorf("invalid sequence tag on document %s: %w", docID, errParse)
+		}
+
+		return sequence, nil
+	}
+
+	return c.getCurrentSequence(docID)
+}
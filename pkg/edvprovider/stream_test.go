@@ -0,0 +1,114 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+)
+
+func TestStore_GetStream(t *testing.T) {
+	t.Run("The document is streamed from memory if the backend can't stream", func(t *testing.T) {
+		store := newStreamTestStore(t)
+
+		document := createTestDocuments(t, testDocID1)[0]
+		require.NoError(t, store.Put(document))
+
+		expected, err := store.Get(testDocID1)
+		require.NoError(t, err)
+
+		reader, err := store.GetStream(testDocID1)
+		require.NoError(t, err)
+
+		actual, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		require.Equal(t, expected, actual)
+	})
+	t.Run("Backends that can stream are streamed from", func(t *testing.T) {
+		coreStore := &streamingCoreStore{Store: newTestCoreStore(t)}
+		store := &Store{coreStore: coreStore, name: testVaultID}
+
+		reader, err := store.GetStream(testDocID1)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		require.Equal(t, []string{testDocID1}, coreStore.streamed)
+	})
+	t.Run("Document not found", func(t *testing.T) {
+		_, err := newStreamTestStore(t).GetStream(testDocID1)
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+	})
+}
+
+func TestStore_Sequence(t *testing.T) {
+	t.Run("The sequence is taken from the document's tag", func(t *testing.T) {
+		store := newStreamTestStore(t)
+
+		document := createTestDocuments(t, testDocID1)[0]
+		require.NoError(t, store.Put(document))
+
+		document.Sequence = 1
+		require.NoError(t, store.Update(document))
+
+		sequence, err := store.Sequence(testDocID1)
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), sequence)
+	})
+	t.Run("Documents without a sequence tag are read", func(t *testing.T) {
+		store := newStreamTestStore(t)
+
+		require.NoError(t, store.coreStore.Put(testDocID1, []byte(`{"id":"`+testDocID1+`","sequence":3}`)))
+
+		sequence, err := store.Sequence(testDocID1)
+		require.NoError(t, err)
+		require.Equal(t, uint64(3), sequence)
+	})
+	t.Run("Invalid sequence tag", func(t *testing.T) {
+		store := newStreamTestStore(t)
+
+		require.NoError(t, store.coreStore.Put(testDocID1, []byte(`{}`),
+			storage.Tag{Name: EncryptedDocumentSequenceTagName, Value: "NotANumber"}))
+
+		_, err := store.Sequence(testDocID1)
+		require.EqualError(t, err, "invalid sequence tag on document "+testDocID1+
+			`: strconv.ParseUint: parsing "NotANumber": invalid syntax`)
+	})
+	t.Run("Document not found", func(t *testing.T) {
+		_, err := newStreamTestStore(t).Sequence(testDocID1)
+		require.True(t, errors.Is(err, messages.ErrDocumentNotFound))
+	})
+}
+
+func newStreamTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	store, err := NewProvider(mem.NewProvider(), 100).OpenStore(testVaultID)
+	require.NoError(t, err)
+
+	return store
+}
+
+// streamingCoreStore is a store that implements StreamingStore, recording the keys that were streamed.
+type streamingCoreStore struct {
+	storage.Store
+	streamed []string
+}
+
+func (s *streamingCoreStore) GetStream(key string) (io.ReadCloser, error) {
+	s.streamed = append(s.streamed, key)
+
+	return ioutil.NopCloser(strings.NewReader("{}")), nil
+}
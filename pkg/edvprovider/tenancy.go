@@ -0,0 +1,595 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const (
+	// TenantStoreName is the name of the store that holds the tenants of a multi-tenant EDV server and their usage.
+	TenantStoreName = "tenants"
+	// TenantTokenHashTagName is the tag name used for finding tenants by the SHA-256 hash of their token.
+	TenantTokenHashTagName = "TokenHash"
+	// VaultConfigTenantTagName is the tag name used for querying vault configs based on the tenant they're bound to.
+	VaultConfigTenantTagName = "Tenant"
+
+	tenantUsageKeyPrefix = "usage_"
+	tenantTokenLength    = 32
+	maxTenantIDLength    = 32
+)
+
+// The quotas that a TenantQuotaError can be for.
+const (
+	VaultsQuota    = "vaults"
+	DocumentsQuota = "documents"
+	BytesQuota     = "bytes"
+)
+
+// Tenant IDs can't contain underscores, so that the store name prefix of a tenant is never the start of another's.
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`) // nolint:gochecknoglobals
+
+// TenantQuotaError is returned when a write would take a tenant over one of its quotas. Nothing is stored when this
+// happens.
+type TenantQuotaError struct {
+	TenantID string
+	// Quota is VaultsQuota, DocumentsQuota or BytesQuota.
+	Quota string
+	Max   uint64
+}
+
+func (e *TenantQuotaError) Error() string {
+	return fmt.Sprintf("%s: tenant %s is limited to %d %s", messages.ErrTenantQuotaExceeded, e.TenantID, e.Max, e.Quota)
+}
+
+// Unwrap returns messages.ErrTenantQuotaExceeded.
+func (e *TenantQuotaError) Unwrap() error {
+	return messages.ErrTenantQuotaExceeded
+}
+
+type tenantRecord struct {
+	models.Tenant
+	TokenHash string `json:"tokenHash"`
+}
+
+// tenantUsage is stored for each tenant. The number of vaults isn't, since it's counted from the vault configs.
+type tenantUsage struct {
+	Documents uint64 `json:"documents"`
+	Bytes     uint64 `json:"bytes"`
+}
+
+type tenancy struct {
+	coreProvider storage.Provider
+	// vaultTenants caches the tenant that each vault is bound to, which is empty for vaults that aren't.
+	vaultTenants sync.Map
+	// locks serializes the quota checks and usage updates of each tenant. Like the document locks, they're local to
+	// this process.
+	locks *documentLocks
+}
+
+// WithMultiTenancy enables multi-tenant mode. Vaults can be bound to a tenant when they're created, in which case
+// their stores are named with the tenant's ID as a prefix, and the tenant's quotas are enforced on every write to
+// them. Vaults that aren't bound to a tenant are stored as they were before.
+func WithMultiTenancy() Option {
+	return func(p *Provider) {
+		p.tenancy = &tenancy{coreProvider: p.coreProvider, locks: newDocumentLocks()}
+	}
+}
+
+// MultiTenancyEnabled returns whether multi-tenant mode is enabled.
+func (c *Provider) MultiTenancyEnabled() bool {
+	return c.tenancy != nil
+}
+
+// CreateTenantStore creates the store for tenants, configured with the tag used for finding them by token.
+func (c *Provider) CreateTenantStore() error {
+	_, err := c.coreProvider.OpenStore(TenantStoreName)
+	if err != nil {
+		return fmt.Errorf("failed to open store for tenants: %w", err)
+	}
+
+	err = c.coreProvider.SetStoreConfig(TenantStoreName,
+		storage.StoreConfiguration{TagNames: []string{TenantTokenHashTagName}})
+	if err != nil {
+		return fmt.Errorf("failed to set store config for tenants: %w", err)
+	}
+
+	return nil
+}
+
+// CreateTenant provisions the given tenant and returns the token that its clients use to create vaults for it.
+// Only the token's hash is stored, so it can't be retrieved again.
+func (c *Provider) CreateTenant(tenant *models.Tenant) (string, error) {
+	if len(tenant.ID) > maxTenantIDLength || !tenantIDPattern.MatchString(tenant.ID) {
+		return "", fmt.Errorf("%w: at most %d characters, starting with a letter or digit",
+			messages.ErrInvalidTenantID, maxTenantIDLength)
+	}
+
+	unlock := c.lockTenant(tenant.ID)
+	defer unlock()
+
+	tenantStore, err := c.coreProvider.OpenStore(TenantStoreName)
+	if err != nil {
+		return "", fmt.Errorf("failed to open store for tenants: %w", err)
+	}
+
+	_, err = tenantStore.Get(tenant.ID)
+	if err == nil {
+		return "", messages.ErrDuplicateTenant
+	}
+
+	if !errors.Is(err, storage.ErrDataNotFound) {
+		return "", fmt.Errorf("failed to get tenant %s: %w", tenant.ID, err)
+	}
+
+	tokenBytes := make([]byte, tenantTokenLength)
+
+	_, err = rand.Read(tokenBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate tenant token: %w", err)
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(tokenBytes)
+
+	err = putTenantRecord(tenantStore, &tenantRecord{Tenant: *tenant, TokenHash: tenantTokenHash(token)})
+	if err != nil {
+		return "", err
+	}
+
+	c.log().Infof("Provisioned tenant %s", tenant.ID)
+
+	return token, nil
+}
+
+// TenantForToken returns the tenant that the given token was issued to.
+// messages.ErrTenantNotFound is returned if it wasn't issued to any tenant.
+func (c *Provider) TenantForToken(token string) (*models.Tenant, error) {
+	if token == "" {
+		return nil, messages.ErrTenantNotFound
+	}
+
+	tenantStore, err := c.coreProvider.OpenStore(TenantStoreName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store for tenants: %w", err)
+	}
+
+	itr, err := tenantStore.Query(fmt.Sprintf("%s:%s", TenantTokenHashTagName, tenantTokenHash(token)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tenants: %w", err)
+	}
+
+	defer storage.Close(itr, c.log())
+
+	found, err := itr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get next entry from iterator: %w", err)
+	}
+
+	if !found {
+		return nil, messages.ErrTenantNotFound
+	}
+
+	recordBytes, err := itr.Value()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get value from iterator: %w", err)
+	}
+
+	var record tenantRecord
+
+	err = json.Unmarshal(recordBytes, &record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal tenant: %w", err)
+	}
+
+	return &record.Tenant, nil
+}
+
+// Tenant returns the given tenant along with its current usage.
+// messages.ErrTenantNotFound is returned if there's no such tenant.
+func (c *Provider) Tenant(tenantID string) (*models.TenantStatus, error) {
+	tenantStore, err := c.coreProvider.OpenStore(TenantStoreName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store for tenants: %w", err)
+	}
+
+	record, err := getTenantRecord(tenantStore, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	usage, err := getTenantUsage(tenantStore, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	vaults, err := c.countTenantVaults(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TenantStatus{
+		Tenant: record.Tenant,
+		Usage:  models.TenantUsage{Vaults: vaults, Documents: usage.Documents, Bytes: usage.Bytes},
+	}, nil
+}
+
+// SetTenantQuotas replaces the quotas of the given tenant and returns the updated tenant. Lowering a quota below the
+// tenant's current usage doesn't remove anything, but rejects further writes that would add to it.
+// messages.ErrTenantNotFound is returned if there's no such tenant.
+func (c *Provider) SetTenantQuotas(tenantID string, quotas models.TenantQuotas) (*models.Tenant, error) {
+	unlock := c.lockTenant(tenantID)
+	defer unlock()
+
+	tenantStore, err := c.coreProvider.OpenStore(TenantStoreName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store for tenants: %w", err)
+	}
+
+	record, err := getTenantRecord(tenantStore, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	record.Quotas = quotas
+
+	err = putTenantRecord(tenantStore, record)
+	if err != nil {
+		return nil, err
+	}
+
+	return &record.Tenant, nil
+}
+
+// StoreTenantDataVaultConfiguration stores the given DataVaultConfiguration and vaultID like
+// Store.StoreDataVaultConfiguration, binding the vault to the given tenant. A *TenantQuotaError is returned if the
+// tenant already has as many vaults as its quota allows.
+func (c *Provider) StoreTenantDataVaultConfiguration(config *models.DataVaultConfiguration, vaultID,
+	tenantID string) error {
+	unlock := c.lockTenant(tenantID)
+	defer unlock()
+
+	tenantStore, err := c.coreProvider.OpenStore(TenantStoreName)
+	if err != nil {
+		return fmt.Errorf("failed to open store for tenants: %w", err)
+	}
+
+	record, err := getTenantRecord(tenantStore, tenantID)
+	if err != nil {
+		return err
+	}
+
+	if record.Quotas.MaxVaults > 0 {
+		vaults, errCount := c.countTenantVaults(tenantID)
+		if errCount != nil {
+			return errCount
+		}
+
+		if vaults >= record.Quotas.MaxVaults {
+			return &TenantQuotaError{TenantID: tenantID, Quota: VaultsQuota, Max: record.Quotas.MaxVaults}
+		}
+	}
+
+	configStore, err := c.OpenStore(VaultConfigurationStoreName)
+	if err != nil {
+		return fmt.Errorf("failed to open store for vault configurations: %w", err)
+	}
+
+	err = configStore.storeDataVaultConfiguration(config, vaultID, tenantID)
+	if err != nil {
+		return err
+	}
+
+	c.tenancy.vaultTenants.Store(vaultID, tenantID)
+
+	return nil
+}
+
+// lockTenant blocks until the lock for the given tenant is held and returns the function that releases it.
+func (c *Provider) lockTenant(tenantID string) func() {
+	if c.tenancy == nil {
+		return func() {}
+	}
+
+	return c.tenancy.locks.lock(tenantID)
+}
+
+func (c *Provider) countTenantVaults(tenantID string) (uint64, error) {
+	configStore, err := c.OpenStore(VaultConfigurationStoreName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open store for vault configurations: %w", err)
+	}
+
+	count, err := configStore.countEntries(fmt.Sprintf("%s:%s", VaultConfigTenantTagName, tenantID))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count vaults of tenant %s: %w", tenantID, err)
+	}
+
+	return uint64(count), nil
+}
+
+// VaultTenant returns the ID of the tenant that the given vault is bound to, or an empty string if it isn't bound to
+// one, doesn't exist or multi-tenant mode isn't enabled.
+func (c *Provider) VaultTenant(vaultID string) (string, error) {
+	return c.vaultTenant(vaultID)
+}
+
+// vaultTenant returns the tenant that the given vault is bound to, or an empty string if it isn't bound to one or
+// multi-tenant mode isn't enabled.
+func (c *Provider) vaultTenant(vaultID string) (string, error) {
+	if c.tenancy == nil || vaultID == VaultConfigurationStoreName || vaultID == TenantStoreName {
+		return "", nil
+	}
+
+	if tenantID, ok := c.tenancy.vaultTenants.Load(vaultID); ok {
+		return tenantID.(string), nil
+	}
+
+	configStore, err := c.coreProvider.OpenStore(VaultConfigurationStoreName)
+	if err != nil {
+		return "", fmt.Errorf("failed to open store for vault configurations: %w", err)
+	}
+
+	configBytes, err := configStore.Get(vaultID)
+	if err != nil {
+		// Not cached, since a vault with this ID could still be created.
+		if errors.Is(err, storage.ErrDataNotFound) {
+			return "", nil
+		}
+
+		return "", fmt.Errorf("failed to get configuration of vault %s: %w", vaultID, err)
+	}
+
+	configEntry, err := decodeVaultConfiguration(c.encryption, vaultID, configBytes)
+	if err != nil {
+		return "", err
+	}
+
+	c.tenancy.vaultTenants.Store(vaultID, configEntry.TenantID)
+
+	return configEntry.TenantID, nil
+}
+
+// updateUsage adds the given numbers of documents and bytes to the tenant's usage, which never goes below zero.
+// If enforceQuotas is true and a positive change would take the tenant over one of its quotas, then a
+// *TenantQuotaError is returned and the usage isn't changed.
+func (t *tenancy) updateUsage(tenantID string, documents, bytes int64, enforceQuotas bool) error {
+	unlock := t.locks.lock(tenantID)
+	defer unlock()
+
+	tenantStore, err := t.coreProvider.OpenStore(TenantStoreName)
+	if err != nil {
+		return fmt.Errorf("failed to open store for tenants: %w", err)
+	}
+
+	record, err := getTenantRecord(tenantStore, tenantID)
+	if err != nil {
+		return err
+	}
+
+	usage, err := getTenantUsage(tenantStore, tenantID)
+	if err != nil {
+		return err
+	}
+
+	usage.Documents = addToUsage(usage.Documents, documents)
+	usage.Bytes = addToUsage(usage.Bytes, bytes)
+
+	if enforceQuotas {
+		err = checkUsage(record, usage, documents, bytes)
+		if err != nil {
+			return err
+		}
+	}
+
+	usageBytes, err := json.Marshal(usage)
+	if err != nil {
+		return fmt.Errorf("failed to marshal usage of tenant %s: %w", tenantID, err)
+	}
+
+	err = tenantStore.Put(tenantUsageKeyPrefix+tenantID, usageBytes)
+	if err != nil {
+		return fmt.Errorf("failed to store usage of tenant %s: %w", tenantID, err)
+	}
+
+	return nil
+}
+
+// reserveTenantUsage charges the vault's tenant for the given document writes, taking into account the documents
+// that they replace, and returns a function that refunds the charge if the writes then fail.
+func (c *Store) reserveTenantUsage(documentOperations []storage.Operation) (func(), error) {
+	if c.tenantID == "" {
+		return func() {}, nil
+	}
+
+	documentIDs := make([]string, len(documentOperations))
+
+	for i := range documentOperations {
+		documentIDs[i] = documentOperations[i].Key
+	}
+
+	currentDocuments, err := c.coreStore.GetBulk(documentIDs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current versions of documents: %w", err)
+	}
+
+	var documents, bytes int64
+
+	for i := range documentOperations {
+		bytes += int64(len(documentOperations[i].Value))
+
+		if currentDocuments[i] == nil {
+			documents++
+		} else {
+			bytes -= int64(len(currentDocuments[i]))
+		}
+	}
+
+	err = c.tenancy.updateUsage(c.tenantID, documents, bytes, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() { c.refundTenant(-documents, -bytes) }, nil
+}
+
+// tenantRefund returns a function that gives the vault's tenant back the usage of the given documents, to be called
+// once they've been deleted. Documents that aren't stored are skipped.
+func (c *Store) tenantRefund(documentIDs []string) (func(), error) {
+	if c.tenantID == "" || len(documentIDs) == 0 {
+		return func() {}, nil
+	}
+
+	currentDocuments, err := c.coreStore.GetBulk(documentIDs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get documents: %w", err)
+	}
+
+	var documents, bytes int64
+
+	for _, document := range currentDocuments {
+		if document != nil {
+			documents--
+			bytes -= int64(len(document))
+		}
+	}
+
+	return func() { c.refundTenant(documents, bytes) }, nil
+}
+
+// tenantRefundAll is like tenantRefund for every document in the store.
+func (c *Store) tenantRefundAll() (func(), error) {
+	if c.tenantID == "" {
+		return func() {}, nil
+	}
+
+	documentSequences, err := c.DocumentSequences()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get documents in vault: %w", err)
+	}
+
+	documentIDs := make([]string, 0, len(documentSequences))
+
+	for docID := range documentSequences {
+		documentIDs = append(documentIDs, docID)
+	}
+
+	return c.tenantRefund(documentIDs)
+}
+
+// refundTenant changes the usage of the vault's tenant without enforcing its quotas, since the write that the change
+// is for has already been done or undone. A failure is only logged, since it just leaves the usage inaccurate.
+func (c *Store) refundTenant(documents, bytes int64) {
+	if documents == 0 && bytes == 0 {
+		return
+	}
+
+	err := c.tenancy.updateUsage(c.tenantID, documents, bytes, false)
+	if err != nil {
+		c.log().Warnf("Failed to update usage of tenant %s: %s", c.tenantID, err)
+	}
+}
+
+func getTenantRecord(tenantStore storage.Store, tenantID string) (*tenantRecord, error) {
+	recordBytes, err := tenantStore.Get(tenantID)
+	if err != nil {
+		if errors.Is(err, storage.ErrDataNotFound) {
+			return nil, messages.ErrTenantNotFound
+		}
+
+		return nil, fmt.Errorf("failed to get tenant %s: %w", tenantID, err)
+	}
+
+	var record tenantRecord
+
+	err = json.Unmarshal(recordBytes, &record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal tenant %s: %w", tenantID, err)
+	}
+
+	return &record, nil
+}
+
+func putTenantRecord(tenantStore storage.Store, record *tenantRecord) error {
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tenant %s: %w", record.ID, err)
+	}
+
+	err = tenantStore.Put(record.ID, recordBytes, storage.Tag{Name: TenantTokenHashTagName, Value: record.TokenHash})
+	if err != nil {
+		return fmt.Errorf("failed to store tenant %s: %w", record.ID, err)
+	}
+
+	return nil
+}
+
+func getTenantUsage(tenantStore storage.Store, tenantID string) (*tenantUsage, error) {
+	usageBytes, err := tenantStore.Get(tenantUsageKeyPrefix + tenantID)
+	if err != nil {
+		if errors.Is(err, storage.ErrDataNotFound) {
+			return &tenantUsage{}, nil
+		}
+
+		return nil, fmt.Errorf("failed to get usage of tenant %s: %w", tenantID, err)
+	}
+
+	var usage tenantUsage
+
+	err = json.Unmarshal(usageBytes, &usage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal usage of tenant %s: %w", tenantID, err)
+	}
+
+	return &usage, nil
+}
+
+// checkUsage returns a *TenantQuotaError if the tenant's new usage is over one of its quotas, and the change to that
+// usage added to it.
+func checkUsage(record *tenantRecord, usage *tenantUsage, documents, bytes int64) error {
+	if documents > 0 && record.Quotas.MaxDocuments > 0 && usage.Documents > record.Quotas.MaxDocuments {
+		return &TenantQuotaError{TenantID: record.ID, Quota: DocumentsQuota, Max: record.Quotas.MaxDocuments}
+	}
+
+	if bytes > 0 && record.Quotas.MaxBytes > 0 && usage.Bytes > record.Quotas.MaxBytes {
+		return &TenantQuotaError{TenantID: record.ID, Quota: BytesQuota, Max: record.Quotas.MaxBytes}
+	}
+
+	return nil
+}
+
+func addToUsage(current uint64, change int64) uint64 {
+	if change < 0 && uint64(-change) > current {
+		return 0
+	}
+
+	if change < 0 {
+		return current - uint64(-change)
+	}
+
+	return current + uint64(change)
+}
+
+// tenantTokenHash returns the hex-encoded SHA-256 hash of a tenant token. Hex is used since tag values can't contain
+// colons.
+func tenantTokenHash(token string) string {
+	hash := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,317 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/edvutils"
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const (
+	testTenantID  = "tenant-1"
+	testTenantID2 = "tenant-2"
+	testVaultID2  = "BJYHHJx4C8J9Fsgz7rZqSp"
+	testMaxVaults = 1
+)
+
+func TestProvider_CreateTenant(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		provider := newTenancyTestProvider(t)
+
+		token, err := provider.CreateTenant(&models.Tenant{ID: testTenantID2})
+		require.NoError(t, err)
+		require.NotEmpty(t, token)
+
+		tenant, err := provider.TenantForToken(token)
+		require.NoError(t, err)
+		require.Equal(t, testTenantID2, tenant.ID)
+
+		_, err = provider.TenantForToken(token + "a")
+		require.True(t, errors.Is(err, messages.ErrTenantNotFound))
+
+		_, err = provider.TenantForToken("")
+		require.True(t, errors.Is(err, messages.ErrTenantNotFound))
+	})
+	t.Run("Duplicate tenant", func(t *testing.T) {
+		_, err := newTenancyTestProvider(t).CreateTenant(&models.Tenant{ID: testTenantID})
+		require.True(t, errors.Is(err, messages.ErrDuplicateTenant))
+	})
+	t.Run("Invalid tenant ID", func(t *testing.T) {
+		provider := newTenancyTestProvider(t)
+
+		for _, tenantID := range []string{"", "Tenant", "tenant_1", "-tenant", "tenant-tenant-tenant-tenant-tenant"} {
+			_, err := provider.CreateTenant(&models.Tenant{ID: tenantID})
+			require.True(t, errors.Is(err, messages.ErrInvalidTenantID), tenantID)
+		}
+	})
+}
+
+func TestProvider_SetTenantQuotas(t *testing.T) {
+	provider := newTenancyTestProvider(t)
+
+	quotas := models.TenantQuotas{MaxVaults: 1, MaxDocuments: 2, MaxBytes: 3}
+
+	tenant, err := provider.SetTenantQuotas(testTenantID, quotas)
+	require.NoError(t, err)
+	require.Equal(t, quotas, tenant.Quotas)
+
+	status, err := provider.Tenant(testTenantID)
+	require.NoError(t, err)
+	require.Equal(t, quotas, status.Quotas)
+
+	_, err = provider.SetTenantQuotas(testTenantID2, quotas)
+	require.True(t, errors.Is(err, messages.ErrTenantNotFound))
+
+	_, err = provider.Tenant(testTenantID2)
+	require.True(t, errors.Is(err, messages.ErrTenantNotFound))
+}
+
+func TestProvider_StoreTenantDataVaultConfiguration(t *testing.T) {
+	t.Run("Tenant vaults are stored separately from other vaults", func(t *testing.T) {
+		coreProvider := mem.NewProvider()
+		provider := newTenancyTestProviderWithCore(t, coreProvider)
+
+		createTenantVault(t, provider, testVaultID, testReferenceID)
+
+		vaultUUID, err := edvutils.Base58Encoded128BitToUUID(testVaultID)
+		require.NoError(t, err)
+
+		_, err = coreProvider.GetStoreConfig(testTenantID + "_" + vaultUUID)
+		require.NoError(t, err)
+
+		_, err = coreProvider.GetStoreConfig(vaultUUID)
+		require.True(t, errors.Is(err, storage.ErrStoreNotFound))
+
+		exists, err := provider.StoreExists(testVaultID)
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		// A provider that hasn't cached the vault's tenant finds it from the vault's configuration.
+		uncachedProvider := NewProvider(coreProvider, 100, WithMultiTenancy())
+
+		exists, err = uncachedProvider.StoreExists(testVaultID)
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		tenantID, err := uncachedProvider.VaultTenant(testVaultID)
+		require.NoError(t, err)
+		require.Equal(t, testTenantID, tenantID)
+	})
+	t.Run("Vault quota", func(t *testing.T) {
+		provider := newTenancyTestProvider(t)
+
+		_, err := provider.SetTenantQuotas(testTenantID, models.TenantQuotas{MaxVaults: testMaxVaults})
+		require.NoError(t, err)
+
+		createTenantVault(t, provider, testVaultID, testReferenceID)
+
+		err = provider.StoreTenantDataVaultConfiguration(&models.DataVaultConfiguration{ReferenceID: "referenceID2"},
+			testVaultID2, testTenantID)
+
+		var quotaErr *TenantQuotaError
+
+		require.True(t, errors.As(err, &quotaErr))
+		require.Equal(t, VaultsQuota, quotaErr.Quota)
+		require.Equal(t, uint64(testMaxVaults), quotaErr.Max)
+		require.True(t, errors.Is(err, messages.ErrTenantQuotaExceeded))
+
+		// Deleting a vault makes room for another.
+		require.NoError(t, provider.DeleteStore(testVaultID))
+
+		createTenantVault(t, provider, testVaultID2, "referenceID2")
+
+		status, err := provider.Tenant(testTenantID)
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), status.Usage.Vaults)
+	})
+	t.Run("Tenant not found", func(t *testing.T) {
+		provider := newTenancyTestProvider(t)
+
+		err := provider.StoreTenantDataVaultConfiguration(&models.DataVaultConfiguration{ReferenceID: testReferenceID},
+			testVaultID, testTenantID2)
+		require.True(t, errors.Is(err, messages.ErrTenantNotFound))
+	})
+}
+
+func TestStore_TenantUsage(t *testing.T) {
+	t.Run("Writes and deletions are counted", func(t *testing.T) {
+		provider := newTenancyTestProvider(t)
+		store := createTenantVault(t, provider, testVaultID, testReferenceID)
+
+		documents := createTestDocuments(t, testDocID1, testDocID2)
+
+		require.NoError(t, store.Put(documents[0]))
+
+		documents[0].Sequence = 1
+		require.NoError(t, store.UpsertBulk(documents))
+
+		firstSize := documentSize(t, store, testDocID1)
+		secondSize := documentSize(t, store, testDocID2)
+
+		requireTenantUsage(t, provider, 2, firstSize+secondSize)
+
+		documents[0].Sequence = 2
+		documents[0].JWE = largerJWE
+		require.NoError(t, store.Update(documents[0]))
+
+		firstSize = documentSize(t, store, testDocID1)
+
+		requireTenantUsage(t, provider, 2, firstSize+secondSize)
+
+		require.NoError(t, store.Delete(testDocID2))
+
+		requireTenantUsage(t, provider, 1, firstSize)
+
+		require.NoError(t, provider.DeleteStore(testVaultID))
+
+		requireTenantUsage(t, provider, 0, 0)
+	})
+	t.Run("Document quota", func(t *testing.T) {
+		provider := newTenancyTestProvider(t)
+		store := createTenantVault(t, provider, testVaultID, testReferenceID)
+
+		_, err := provider.SetTenantQuotas(testTenantID, models.TenantQuotas{MaxDocuments: 1})
+		require.NoError(t, err)
+
+		documents := createTestDocuments(t, testDocID1, testDocID2)
+
+		err = store.UpsertBulk(documents)
+
+		var quotaErr *TenantQuotaError
+
+		require.True(t, errors.As(err, &quotaErr))
+		require.Equal(t, DocumentsQuota, quotaErr.Quota)
+
+		_, err = store.Get(testDocID1)
+		require.True(t, errors.Is(err, storage.ErrDataNotFound))
+
+		require.NoError(t, store.Put(documents[0]))
+
+		// Replacing a document doesn't add to the number of documents.
+		documents[0].Sequence = 1
+		require.NoError(t, store.UpsertBulk(documents[:1]))
+
+		err = store.Put(documents[1])
+		require.True(t, errors.As(err, &quotaErr))
+	})
+	t.Run("Byte quota", func(t *testing.T) {
+		provider := newTenancyTestProvider(t)
+		store := createTenantVault(t, provider, testVaultID, testReferenceID)
+
+		documents := createTestDocuments(t, testDocID1)
+		require.NoError(t, store.Put(documents[0]))
+
+		_, err := provider.SetTenantQuotas(testTenantID,
+			models.TenantQuotas{MaxBytes: uint64(documentSize(t, store, testDocID1))})
+		require.NoError(t, err)
+
+		documents[0].Sequence = 1
+		documents[0].JWE = largerJWE
+
+		err = store.Update(documents[0])
+
+		var quotaErr *TenantQuotaError
+
+		require.True(t, errors.As(err, &quotaErr))
+		require.Equal(t, BytesQuota, quotaErr.Quota)
+
+		// Writes that make the tenant's documents smaller are allowed.
+		documents[0].JWE = []byte(`{}`)
+		require.NoError(t, store.Update(documents[0]))
+	})
+	t.Run("Failed writes are refunded", func(t *testing.T) {
+		provider := newTenancyTestProvider(t)
+		store := createTenantVault(t, provider, testVaultID, testReferenceID)
+
+		store.coreStore = &failingBatchStore{Store: store.coreStore}
+
+		require.Error(t, store.Put(createTestDocuments(t, testDocID1)[0]))
+
+		requireTenantUsage(t, provider, 0, 0)
+	})
+	t.Run("Vaults that aren't bound to a tenant aren't counted", func(t *testing.T) {
+		provider := newTenancyTestProvider(t)
+
+		store := createVaultWithDocuments(t, provider)
+		require.Empty(t, store.tenantID)
+
+		requireTenantUsage(t, provider, 0, 0)
+	})
+}
+
+func newTenancyTestProvider(t *testing.T) *Provider {
+	t.Helper()
+
+	return newTenancyTestProviderWithCore(t, mem.NewProvider())
+}
+
+func newTenancyTestProviderWithCore(t *testing.T, coreProvider storage.Provider) *Provider {
+	t.Helper()
+
+	provider := NewProvider(coreProvider, 100, WithMultiTenancy())
+	require.True(t, provider.MultiTenancyEnabled())
+	require.NoError(t, provider.CreateTenantStore())
+
+	_, err := provider.CreateTenant(&models.Tenant{ID: testTenantID})
+	require.NoError(t, err)
+
+	return provider
+}
+
+func createTenantVault(t *testing.T, provider *Provider, vaultID, referenceID string) *Store {
+	t.Helper()
+
+	err := provider.StoreTenantDataVaultConfiguration(&models.DataVaultConfiguration{ReferenceID: referenceID},
+		vaultID, testTenantID)
+	require.NoError(t, err)
+
+	require.NoError(t, provider.CreateVaultStore(vaultID))
+
+	store, err := provider.OpenStore(vaultID)
+	require.NoError(t, err)
+	require.Equal(t, testTenantID, store.tenantID)
+
+	return store
+}
+
+func documentSize(t *testing.T, store *Store, docID string) int {
+	t.Helper()
+
+	document, err := store.Get(docID)
+	require.NoError(t, err)
+
+	return len(document)
+}
+
+func requireTenantUsage(t *testing.T, provider *Provider, documents uint64, bytes int) {
+	t.Helper()
+
+	status, err := provider.Tenant(testTenantID)
+	require.NoError(t, err)
+	require.Equal(t, documents, status.Usage.Documents)
+	require.Equal(t, uint64(bytes), status.Usage.Bytes)
+}
+
+// largerJWE is larger than the JWE of the test documents.
+var largerJWE = []byte(`{"ciphertext":"` + strings.Repeat("a", 1024) + `"}`) // nolint:gochecknoglobals
+
+type failingBatchStore struct {
+	storage.Store
+}
+
+func (f *failingBatchStore) Batch([]storage.Operation) error {
+	return errors.New("batch failure")
+}
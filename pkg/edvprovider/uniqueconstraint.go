@@ -0,0 +1,162 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// WithUniqueConstraints has the database enforce the index name+value pairs that documents declare as unique, for
+// storage providers whose stores honour storage.PutOptions.IsNewKey in batches: a put with it must fail with an
+// error wrapping storage.ErrDuplicateKey if an entry with the key already exists, as the MongoDB provider does with
+// its unique index on keys and the PostgreSQL provider with its tables' primary keys.
+// Before a document is stored, the unique index registry entry of each pair it declares as unique is inserted as a
+// new key, so that of two concurrent writes declaring the same pair, only one can succeed. Without this, the registry
+// is only checked before writing, which doesn't guarantee uniqueness if two EDV instances or requests race.
+// It mustn't be enabled for storage providers that overwrite existing entries instead, such as the in-memory one.
+func WithUniqueConstraints() Option {
+	return func(p *Provider) {
+		p.uniqueConstraints = true
+	}
+}
+
+// claimUniqueIndexes inserts the given unique index registry entries from uniqueIndexOperations as new keys, if
+// unique constraints are enabled. An entry that already exists is only replaced if it's stale: the document it
+// belongs to exists but no longer declares the pair as unique. An entry whose document doesn't exist yet is taken
+// to be claimed by a write in progress, so errIndexNameAndValueAlreadyDeclaredUnique is returned for it.
+// The returned function is for when the documents can't be stored after all. It deletes the entries that were
+// inserted, unless their document was stored anyway, such as by a batch that failed part way through.
+func (c *Store) claimUniqueIndexes(operations []storage.Operation) (func(), error) {
+	var inserted []storage.Operation
+
+	release := func() {
+		for _, operation := range inserted {
+			c.releaseUniqueIndex(operation)
+		}
+	}
+
+	if !c.uniqueConstraints {
+		return release, nil
+	}
+
+	for _, operation := range operations {
+		isNew, err := c.claimUniqueIndex(operation)
+		if err != nil {
+			release()
+
+			return nil, err
+		}
+
+		if isNew {
+			inserted = append(inserted, operation)
+		}
+	}
+
+	return release, nil
+}
+
+// claimUniqueIndex inserts the given unique index registry entry, or replaces it if the existing one belongs to the
+// same document or is stale. It returns whether the entry was inserted as a new key.
+func (c *Store) claimUniqueIndex(operation storage.Operation) (bool, error) {
+	insert := operation
+	insert.PutOptions = &storage.PutOptions{IsNewKey: true}
+
+	err := c.coreStore.Batch([]storage.Operation{insert})
+	if err == nil {
+		return true, nil
+	}
+
+	if !errors.Is(err, storage.ErrDuplicateKey) {
+		return false, fmt.Errorf("failed to insert unique index entry: %w", err)
+	}
+
+	claim, err := unmarshalUniqueIndexEntry(operation.Value)
+	if err != nil {
+		return false, err
+	}
+
+	existingBytes, err := c.coreStore.Get(operation.Key)
+	if errors.Is(err, storage.ErrDataNotFound) {
+		// The entry was deleted after the insert failed, by a write that claimed it and then failed.
+		return false, errIndexNameAndValueAlreadyDeclaredUnique
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to get unique index entry: %w", err)
+	}
+
+	existing, err := unmarshalUniqueIndexEntry(existingBytes)
+	if err != nil {
+		return false, err
+	}
+
+	if existing.DocumentID != "" && existing.DocumentID != claim.DocumentID {
+		exists, declares, errDeclares := c.declaresUniqueIndex(existing.DocumentID, claim.attribute())
+		if errDeclares != nil {
+			return false, errDeclares
+		}
+
+		if !exists || declares {
+			return false, errIndexNameAndValueAlreadyDeclaredUnique
+		}
+	}
+
+	err = c.coreStore.Put(operation.Key, operation.Value, operation.Tags...)
+	if err != nil {
+		return false, fmt.Errorf("failed to store unique index entry: %w", err)
+	}
+
+	return false, nil
+}
+
+// releaseUniqueIndex deletes the given unique index registry entry, unless its document declares the pair as unique.
+// Failures are only logged, since the entry is then left for the document's next write or deletion to clean up.
+func (c *Store) releaseUniqueIndex(operation storage.Operation) {
+	entry, err := unmarshalUniqueIndexEntry(operation.Value)
+	if err != nil {
+		c.log().Warnf("Failed to release unique index entry %s in vault %s: %s", operation.Key, c.name, err)
+
+		return
+	}
+
+	_, declares, err := c.declaresUniqueIndex(entry.DocumentID, entry.attribute())
+	if err != nil {
+		c.log().Warnf("Failed to release unique index entry %s in vault %s: %s", operation.Key, c.name, err)
+
+		return
+	}
+
+	if declares {
+		return
+	}
+
+	err = c.coreStore.Delete(operation.Key)
+	if err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+		c.log().Warnf("Failed to release unique index entry %s in vault %s: %s", operation.Key, c.name, err)
+	}
+}
+
+func unmarshalUniqueIndexEntry(entryBytes []byte) (*uniqueIndexEntry, error) {
+	var entry uniqueIndexEntry
+
+	err := json.Unmarshal(entryBytes, &entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal unique index entry: %w", err)
+	}
+
+	return &entry, nil
+}
+
+func (e *uniqueIndexEntry) attribute() models.IndexedAttribute {
+	return models.IndexedAttribute{Name: e.AttributeName, Value: e.AttributeValue, Unique: true}
+}
@@ -0,0 +1,217 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestStore_UniqueConstraints(t *testing.T) {
+	t.Run("A pair declared unique by another document is rejected by the database", func(t *testing.T) {
+		store, _ := newUniqueConstraintTestStore(t, WithUniqueConstraints())
+
+		// UpsertBulk doesn't check the registry before writing, like two concurrent writes that both passed the check.
+		documents := createUniqueConstraintTestDocuments(t, testDocID1, testDocID2)
+
+		require.NoError(t, store.UpsertBulk(documents[:1]))
+
+		err := store.UpsertBulk(documents[1:])
+		require.ErrorIs(t, err, errIndexNameAndValueAlreadyDeclaredUnique)
+		require.True(t, errors.Is(err, messages.ErrUniqueIndexConflict))
+
+		exists, err := store.Exists(testDocID2)
+		require.NoError(t, err)
+		require.False(t, exists)
+
+		requireUniqueIndexOwner(t, store, testDocID1)
+
+		// The document declaring the pair can still be written again.
+		documents[0].Sequence = 1
+		require.NoError(t, store.UpsertBulk(documents[:1]))
+	})
+	t.Run("Without unique constraints, the database doesn't reject the pair", func(t *testing.T) {
+		store, _ := newUniqueConstraintTestStore(t)
+
+		documents := createUniqueConstraintTestDocuments(t, testDocID1, testDocID2)
+
+		require.NoError(t, store.UpsertBulk(documents[:1]))
+		require.NoError(t, store.UpsertBulk(documents[1:]))
+	})
+	t.Run("Stale entries are replaced", func(t *testing.T) {
+		store, _ := newUniqueConstraintTestStore(t, WithUniqueConstraints())
+
+		documents := createUniqueConstraintTestDocuments(t, testDocID1, testDocID2)
+
+		require.NoError(t, store.UpsertBulk(documents[:1]))
+
+		// Overwriting a document through UpsertBulk leaves its entry behind.
+		documents[0].Sequence = 1
+		documents[0].IndexedAttributeCollections[0].IndexedAttributes[0].Unique = false
+		require.NoError(t, store.UpsertBulk(documents[:1]))
+
+		require.NoError(t, store.UpsertBulk(documents[1:]))
+		requireUniqueIndexOwner(t, store, testDocID2)
+	})
+	t.Run("Entries of documents that aren't stored yet are taken to be claimed", func(t *testing.T) {
+		store, _ := newUniqueConstraintTestStore(t, WithUniqueConstraints())
+
+		documents := createUniqueConstraintTestDocuments(t, testDocID1, testDocID2)
+
+		operations, err := uniqueIndexOperations(&documents[0])
+		require.NoError(t, err)
+		require.NoError(t, store.coreStore.Batch(operations))
+
+		require.ErrorIs(t, store.UpsertBulk(documents[1:]), errIndexNameAndValueAlreadyDeclaredUnique)
+	})
+	t.Run("Entries are released if the document can't be stored", func(t *testing.T) {
+		store, coreProvider := newUniqueConstraintTestStore(t, WithUniqueConstraints())
+
+		documents := createUniqueConstraintTestDocuments(t, testDocID1, testDocID2)
+
+		coreProvider.errBatch = errors.New("write conflict")
+
+		require.EqualError(t, store.UpsertBulk(documents[:1]), "failed to store encrypted document(s) and their "+
+			"associated mapping document(s): write conflict")
+
+		coreProvider.errBatch = nil
+
+		requireUniqueIndexEntries(t, store, 0)
+		require.NoError(t, store.UpsertBulk(documents[1:]))
+	})
+	t.Run("Updates claim the pairs they declare", func(t *testing.T) {
+		store, coreProvider := newUniqueConstraintTestStore(t, WithUniqueConstraints())
+
+		documents := createUniqueConstraintTestDocuments(t, testDocID1, testDocID2)
+		documents[1].IndexedAttributeCollections[0].IndexedAttributes[0].Unique = false
+
+		require.NoError(t, store.Put(documents[0]))
+
+		documents[0].Sequence = 1
+		documents[0].IndexedAttributeCollections[0].IndexedAttributes[0].Value = "other value"
+
+		coreProvider.errBatch = errors.New("write conflict")
+
+		require.Error(t, store.Update(documents[0]))
+
+		coreProvider.errBatch = nil
+
+		// The entry claimed by the failed update was released, while the document's current entry was kept.
+		requireUniqueIndexEntries(t, store, 1)
+		requireUniqueIndexOwner(t, store, testDocID1)
+
+		require.NoError(t, store.Update(documents[0]))
+		requireUniqueIndexEntries(t, store, 1)
+		requireUniqueIndexOwner(t, store, "")
+
+		// The pair the first document no longer declares can be claimed by another one.
+		documents[1].IndexedAttributeCollections[0].IndexedAttributes[0].Unique = true
+		require.NoError(t, store.Put(documents[1]))
+		requireUniqueIndexOwner(t, store, testDocID2)
+	})
+	t.Run("Failure to insert an entry", func(t *testing.T) {
+		store, coreProvider := newUniqueConstraintTestStore(t, WithUniqueConstraints())
+
+		coreProvider.errInsert = errors.New("connection reset")
+
+		err := store.UpsertBulk(createUniqueConstraintTestDocuments(t, testDocID1))
+		require.EqualError(t, err, "failed to insert unique index entry: connection reset")
+	})
+}
+
+func newUniqueConstraintTestStore(t *testing.T, opts ...Option) (*Store, *newKeyProvider) {
+	t.Helper()
+
+	coreProvider := &newKeyProvider{Provider: mem.NewProvider()}
+
+	provider := NewProvider(coreProvider, 100, opts...)
+
+	require.NoError(t, provider.CreateVaultStore(testVaultID))
+
+	store, err := provider.OpenStore(testVaultID)
+	require.NoError(t, err)
+
+	return store, coreProvider
+}
+
+// createUniqueConstraintTestDocuments creates documents that all declare the same index name+value pair as unique.
+func createUniqueConstraintTestDocuments(t *testing.T, documentIDs ...string) []models.EncryptedDocument {
+	t.Helper()
+
+	documents := createTestDocuments(t, documentIDs...)
+	for i := range documents {
+		documents[i].IndexedAttributeCollections[0].IndexedAttributes[0].Value = "value"
+	}
+
+	return documents
+}
+
+func requireUniqueIndexOwner(t *testing.T, store *Store, documentID string) {
+	t.Helper()
+
+	owner, err := store.uniqueIndexOwner(models.IndexedAttribute{Name: testAttributeName, Value: "value"})
+	require.NoError(t, err)
+	require.Equal(t, documentID, owner)
+}
+
+// newKeyProvider wraps a storage provider whose stores ignore storage.PutOptions.IsNewKey, like the in-memory one,
+// with stores that reject puts of existing keys marked as new in batches, like the MongoDB and PostgreSQL ones.
+// Batches without such puts fail with errBatch, and those with them with errInsert, if they're set.
+type newKeyProvider struct {
+	storage.Provider
+	errBatch  error
+	errInsert error
+}
+
+func (p *newKeyProvider) OpenStore(name string) (storage.Store, error) {
+	store, err := p.Provider.OpenStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &newKeyStore{Store: store, provider: p}, nil
+}
+
+type newKeyStore struct {
+	storage.Store
+	provider *newKeyProvider
+}
+
+func (s *newKeyStore) Batch(operations []storage.Operation) error {
+	var inserts bool
+
+	for _, operation := range operations {
+		if operation.PutOptions == nil || !operation.PutOptions.IsNewKey {
+			continue
+		}
+
+		inserts = true
+
+		_, err := s.Store.Get(operation.Key)
+		if err == nil {
+			return fmt.Errorf("failed to insert %s: %w", operation.Key, storage.ErrDuplicateKey)
+		}
+	}
+
+	if inserts && s.provider.errInsert != nil {
+		return s.provider.errInsert
+	}
+
+	if !inserts && s.provider.errBatch != nil {
+		return s.provider.errBatch
+	}
+
+	return s.Store.Batch(operations)
+}
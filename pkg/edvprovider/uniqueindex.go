@@ -0,0 +1,307 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const (
+	// UniqueIndexTagName is the tag name used for finding the unique index registry entries of an encrypted
+	// document. The tag value is the document's ID.
+	UniqueIndexTagName = "UniqueIndex"
+
+	uniqueIndexKeyPrefix = "unique_"
+	// uniqueIndexRegistryKey marks a vault whose unique index registry has been built. Vaults created before the
+	// registry was introduced don't have it until their registry is built from their documents.
+	uniqueIndexRegistryKey = "unique_index_registry"
+)
+
+// uniqueIndexEntry records which document declares an index name+value pair as unique.
+type uniqueIndexEntry struct {
+	AttributeName  string `json:"attributeName"`
+	AttributeValue string `json:"attributeValue"`
+	DocumentID     string `json:"documentID"`
+}
+
+// uniqueIndexKey returns the key of the unique index registry entry for the given index name and value.
+// The name's length is included so that different name+value pairs can't end up with the same key.
+func uniqueIndexKey(name, value string) string {
+	return uniqueIndexKeyPrefix + strconv.Itoa(len(name)) + ":" + name + "/" + value
+}
+
+// uniqueIndexOperations returns the operations that register the index name+value pairs the given document declares
+// as unique.
+func uniqueIndexOperations(document *models.EncryptedDocument) ([]storage.Operation, error) {
+	var operations []storage.Operation
+
+	for _, indexedAttributeCollection := range document.IndexedAttributeCollections {
+		for _, indexedAttribute := range indexedAttributeCollection.IndexedAttributes {
+			if !indexedAttribute.Unique {
+				continue
+			}
+
+			entryBytes, err := json.Marshal(uniqueIndexEntry{
+				AttributeName:  indexedAttribute.Name,
+				AttributeValue: indexedAttribute.Value,
+				DocumentID:     document.ID,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal unique index entry: %w", err)
+			}
+
+			operations = append(operations, storage.Operation{
+				Key:   uniqueIndexKey(indexedAttribute.Name, indexedAttribute.Value),
+				Value: entryBytes,
+				Tags:  []storage.Tag{documentIDTag(UniqueIndexTagName, document.ID)},
+			})
+		}
+	}
+
+	return operations, nil
+}
+
+// uniqueIndexOwner returns the ID of the document that declares the given index name+value pair as unique, or an
+// empty string if no document does. Entries aren't removed when a document is overwritten through UpsertBulk, so the
+// document an entry points at is checked to still declare the pair as unique.
+func (c *Store) uniqueIndexOwner(attribute models.IndexedAttribute) (string, error) {
+	entryBytes, err := c.coreStore.Get(uniqueIndexKey(attribute.Name, attribute.Value))
+	if errors.Is(err, storage.ErrDataNotFound) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to get unique index entry: %w", err)
+	}
+
+	var entry uniqueIndexEntry
+
+	err = json.Unmarshal(entryBytes, &entry)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal unique index entry: %w", err)
+	}
+
+	if entry.DocumentID == "" {
+		return "", nil
+	}
+
+	_, declares, err := c.declaresUniqueIndex(entry.DocumentID, attribute)
+	if err != nil || !declares {
+		return "", err
+	}
+
+	return entry.DocumentID, nil
+}
+
+// declaresUniqueIndex returns whether the document with the given ID exists, and whether it declares the given index
+// name+value pair as unique.
+func (c *Store) declaresUniqueIndex(documentID string, attribute models.IndexedAttribute) (bool, bool, error) {
+	documentBytes, err := c.coreStore.Get(documentID)
+	if errors.Is(err, storage.ErrDataNotFound) {
+		return false, false, nil
+	}
+
+	if err != nil {
+		return false, false, fmt.Errorf("failed to get document %s: %w", documentID, err)
+	}
+
+	var document models.EncryptedDocument
+
+	err = json.Unmarshal(documentBytes, &document)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to unmarshal document %s: %w", documentID, err)
+	}
+
+	for _, indexedAttributeCollection := range document.IndexedAttributeCollections {
+		for _, indexedAttribute := range indexedAttributeCollection.IndexedAttributes {
+			if indexedAttribute.Unique && indexedAttribute.Name == attribute.Name &&
+				indexedAttribute.Value == attribute.Value {
+				return true, true, nil
+			}
+		}
+	}
+
+	return true, false, nil
+}
+
+// registerUniqueIndexes replaces the unique index registry entries of the given document with ones for the index
+// name+value pairs it currently declares as unique. locks are the locks held by the caller.
+func (c *Store) registerUniqueIndexes(document *models.EncryptedDocument, locks *heldLocks) error {
+	operations, err := uniqueIndexOperations(document)
+	if err != nil {
+		return err
+	}
+
+	registered := make(map[string]struct{}, len(operations))
+
+	for _, operation := range operations {
+		registered[operation.Key] = struct{}{}
+	}
+
+	keys, err := entryKeys(c.coreStore, documentIDQuery(UniqueIndexTagName, document.ID), c.retrievalPageSize,
+		c.log())
+	if err != nil {
+		return fmt.Errorf("failed to get unique index entries: %w", err)
+	}
+
+	for _, key := range keys {
+		if _, isRegistered := registered[key]; !isRegistered {
+			operations = append(operations, storage.Operation{Key: key})
+		}
+	}
+
+	if len(operations) == 0 {
+		return nil
+	}
+
+	_, err = c.batch(locks, operations)
+	if err != nil {
+		return fmt.Errorf("failed to store unique index entries: %w", err)
+	}
+
+	return nil
+}
+
+// deleteUniqueIndexes deletes the unique index registry entries of the given document.
+func (c *Store) deleteUniqueIndexes(docID string) error {
+	keys, err := entryKeys(c.coreStore, documentIDQuery(UniqueIndexTagName, docID), c.retrievalPageSize,
+		c.log())
+	if err != nil {
+		return fmt.Errorf("failed to get unique index entries: %w", err)
+	}
+
+	for _, key := range keys {
+		err = c.coreStore.Delete(key)
+		if err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+			return fmt.Errorf("failed to delete unique index entry: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ensureUniqueIndexRegistry builds the unique index registry of the vault from its documents if that hasn't been
+// done yet. Vaults created through CreateVaultStore start with an empty registry, so this only does work once for
+// each vault created before the registry was introduced.
+func (c *Store) ensureUniqueIndexRegistry() error {
+	if c.uniqueIndexRegistries != nil {
+		if _, built := c.uniqueIndexRegistries.Load(c.namespace); built {
+			return nil
+		}
+	}
+
+	locks := c.documentLocks.lockAll(c.namespace.Key(uniqueIndexRegistryKey))
+	defer locks.unlock()
+
+	_, err := c.coreStore.Get(uniqueIndexRegistryKey)
+	if err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+		return fmt.Errorf("failed to get unique index registry marker: %w", err)
+	}
+
+	if err != nil {
+		err = c.buildUniqueIndexRegistry(locks)
+		if err != nil {
+			return fmt.Errorf("failed to build unique index registry: %w", err)
+		}
+	}
+
+	if c.uniqueIndexRegistries != nil {
+		c.uniqueIndexRegistries.Store(c.namespace, struct{}{})
+	}
+
+	return nil
+}
+
+// buildUniqueIndexRegistry registers the unique index name+value pairs of every document with mapping documents,
+// a page at a time, and then marks the registry as built. locks are the locks held by the caller.
+func (c *Store) buildUniqueIndexRegistry(locks *heldLocks) error {
+	mappingDocuments, err := c.getMappingDocuments(MappingDocumentTagName)
+	if err != nil {
+		return err
+	}
+
+	documentIDs := getDocumentIDsFromMappingDocumentsWithoutDuplicates(mappingDocuments)
+
+	pageSize := int(c.retrievalPageSize)
+	if pageSize == 0 {
+		pageSize = len(documentIDs)
+	}
+
+	var entries int
+
+	for start := 0; start < len(documentIDs); start += pageSize {
+		end := start + pageSize
+		if end > len(documentIDs) {
+			end = len(documentIDs)
+		}
+
+		count, errRegister := c.registerUniqueIndexesOfDocuments(documentIDs[start:end], locks)
+		if errRegister != nil {
+			return errRegister
+		}
+
+		entries += count
+	}
+
+	err = c.coreStore.Put(uniqueIndexRegistryKey, []byte("{}"))
+	if err != nil {
+		return fmt.Errorf("failed to store unique index registry marker: %w", err)
+	}
+
+	c.log().Infof("Built unique index registry with %d entries for vault %s", entries, c.name)
+
+	return nil
+}
+
+// registerUniqueIndexesOfDocuments registers the unique index name+value pairs of the given documents and returns
+// the number of entries stored. Documents that no longer exist are skipped. locks are the locks held by the caller.
+func (c *Store) registerUniqueIndexesOfDocuments(documentIDs []string, locks *heldLocks) (int, error) {
+	documentsBytes, err := c.coreStore.GetBulk(documentIDs...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get documents: %w", err)
+	}
+
+	var operations []storage.Operation
+
+	for i, documentBytes := range documentsBytes {
+		if documentBytes == nil {
+			continue
+		}
+
+		var document models.EncryptedDocument
+
+		err = json.Unmarshal(documentBytes, &document)
+		if err != nil {
+			return 0, fmt.Errorf("failed to unmarshal document %s: %w", documentIDs[i], err)
+		}
+
+		documentOperations, errOperations := uniqueIndexOperations(&document)
+		if errOperations != nil {
+			return 0, errOperations
+		}
+
+		operations = append(operations, documentOperations...)
+	}
+
+	if len(operations) == 0 {
+		return 0, nil
+	}
+
+	_, err = c.batch(locks, operations)
+	if err != nil {
+		return 0, fmt.Errorf("failed to store unique index entries: %w", err)
+	}
+
+	return len(operations), nil
+}
@@ -0,0 +1,152 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_UniqueIndexRegistry(t *testing.T) {
+	t.Run("Documents with only non-unique attributes aren't checked against other documents", func(t *testing.T) {
+		cache := NewMemAttributeCache(0)
+		store := newAttributeCacheTestStore(t, cache)
+
+		documents := createTestDocuments(t, testDocID1, testDocID2)
+		documents[1].IndexedAttributeCollections[0].IndexedAttributes[0].Unique = false
+
+		require.NoError(t, store.Put(documents[0]))
+		require.NoError(t, store.Put(documents[1]))
+
+		// Only the unique attribute of the first document needed the documents sharing its attribute name.
+		requireCachedDocuments(t, cache, store, testAttributeName, testDocID1, testDocID2)
+
+		_, cached := cache.Get(store.namespace.Key(testAttributeName2))
+		require.False(t, cached)
+	})
+	t.Run("Unique attributes are looked up in the registry", func(t *testing.T) {
+		store := newUniqueIndexTestStore(t)
+
+		documents := createTestDocuments(t, testDocID1, testDocID2)
+		documents[1].IndexedAttributeCollections[0].IndexedAttributes[0].Value = testDocID1
+		documents[1].IndexedAttributeCollections[0].IndexedAttributes[0].Unique = false
+
+		require.NoError(t, store.Put(documents[0]))
+		require.ErrorIs(t, store.Put(documents[1]), errIndexNameAndValueAlreadyDeclaredUnique)
+
+		// The document declaring the attribute as unique can still be updated.
+		documents[0].Sequence = 1
+		require.NoError(t, store.Update(documents[0]))
+	})
+	t.Run("Updates and deletes release unique attributes", func(t *testing.T) {
+		store := newUniqueIndexTestStore(t)
+
+		documents := createTestDocuments(t, testDocID1, testDocID2, "BJYHHJx4C8J9Fsgz7rZqSp")
+		for i := range documents {
+			documents[i].IndexedAttributeCollections[0].IndexedAttributes[0].Value = "value"
+		}
+
+		require.NoError(t, store.Put(documents[0]))
+		requireUniqueIndexEntries(t, store, 1)
+
+		documents[0].Sequence = 1
+		documents[0].IndexedAttributeCollections[0].IndexedAttributes[0].Unique = false
+		require.NoError(t, store.Update(documents[0]))
+		requireUniqueIndexEntries(t, store, 0)
+
+		require.NoError(t, store.Delete(testDocID1))
+		require.NoError(t, store.Put(documents[1]))
+		require.ErrorIs(t, store.Put(documents[2]), errIndexNameAndValueAlreadyDeclaredUnique)
+
+		require.NoError(t, store.Delete(testDocID2))
+		requireUniqueIndexEntries(t, store, 0)
+		require.NoError(t, store.Put(documents[2]))
+		requireUniqueIndexEntries(t, store, 1)
+	})
+	t.Run("Entries left behind by overwritten documents are ignored", func(t *testing.T) {
+		store := newUniqueIndexTestStore(t)
+
+		documents := createTestDocuments(t, testDocID1, testDocID2)
+		documents[1].IndexedAttributeCollections[0].IndexedAttributes[0].Value = testDocID1
+
+		require.NoError(t, store.Put(documents[0]))
+
+		documents[0].Sequence = 1
+		documents[0].IndexedAttributeCollections[0].IndexedAttributes[0].Unique = false
+		require.NoError(t, store.UpsertBulk(documents[:1]))
+
+		documents[1].IndexedAttributeCollections[0].IndexedAttributes[0].Unique = false
+		require.NoError(t, store.Put(documents[1]))
+	})
+	t.Run("The registry of a vault created without one is built from its documents", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 1)
+
+		store, err := provider.OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		documents := createTestDocuments(t, testDocID1, testDocID2, "BJYHHJx4C8J9Fsgz7rZqSp")
+		documents[2].IndexedAttributeCollections[0].IndexedAttributes[0].Value = testDocID1
+		documents[2].IndexedAttributeCollections[0].IndexedAttributes[0].Unique = false
+
+		require.NoError(t, store.UpsertBulk(documents[:2]))
+
+		// Remove the entries, as if the documents had been stored before the registry was introduced.
+		keys, err := entryKeys(store.coreStore, UniqueIndexTagName, store.retrievalPageSize, logger)
+		require.NoError(t, err)
+		require.Len(t, keys, 2)
+
+		for _, key := range keys {
+			require.NoError(t, store.coreStore.Delete(key))
+		}
+
+		require.ErrorIs(t, store.Put(documents[2]), errIndexNameAndValueAlreadyDeclaredUnique)
+		requireUniqueIndexEntries(t, store, 2)
+
+		_, err = store.coreStore.Get(uniqueIndexRegistryKey)
+		require.NoError(t, err)
+	})
+	t.Run("Deleting the vault deletes its registry", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+
+		store := createVaultWithDocuments(t, provider)
+		require.NoError(t, store.Put(createTestDocuments(t, "BJYHHJx4C8J9Fsgz7rZqSp")[0]))
+		requireUniqueIndexEntries(t, store, 1)
+
+		require.NoError(t, provider.DeleteStore(testVaultID))
+
+		store, err := provider.OpenStore(testVaultID)
+		require.NoError(t, err)
+		requireUniqueIndexEntries(t, store, 0)
+
+		_, err = store.coreStore.Get(uniqueIndexRegistryKey)
+		require.ErrorIs(t, err, storage.ErrDataNotFound)
+	})
+}
+
+func newUniqueIndexTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	provider := NewProvider(mem.NewProvider(), 100)
+
+	require.NoError(t, provider.CreateVaultStore(testVaultID))
+
+	store, err := provider.OpenStore(testVaultID)
+	require.NoError(t, err)
+
+	return store
+}
+
+func requireUniqueIndexEntries(t *testing.T, store *Store, count int) {
+	t.Helper()
+
+	keys, err := entryKeys(store.coreStore, UniqueIndexTagName, store.retrievalPageSize, logger)
+	require.NoError(t, err)
+	require.Len(t, keys, count)
+}
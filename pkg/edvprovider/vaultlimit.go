@@ -0,0 +1,255 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const (
+	// VaultConfigControllerTagName is the tag name used for counting the vaults of each controller. The tag value is
+	// the hex-encoded SHA-256 hash of the controller, since tag values can't contain colons.
+	// Vault configs stored before this tag was introduced don't have it until they're next updated.
+	VaultConfigControllerTagName = "Controller"
+	// VaultLimitStoreName is the name of the store that holds the vault limits set for individual controllers.
+	VaultLimitStoreName = "vault_limits"
+)
+
+// errVaultLimitsNotEnabled is returned when vault limits are read or set on a provider that doesn't enforce them.
+var errVaultLimitsNotEnabled = errors.New("vault limits are not enabled")
+
+// VaultLimitError is returned when a vault would take its controller over the number of vaults that it's allowed to
+// have (see WithMaxVaultsPerController). Nothing is stored when this happens.
+type VaultLimitError struct {
+	Controller string
+	Max        uint64
+}
+
+func (e *VaultLimitError) Error() string {
+	return fmt.Sprintf("%s: controller %s is limited to %d vaults", messages.ErrVaultLimitExceeded, e.Controller,
+		e.Max)
+}
+
+// Unwrap returns messages.ErrVaultLimitExceeded.
+func (e *VaultLimitError) Unwrap() error {
+	return messages.ErrVaultLimitExceeded
+}
+
+// vaultLimitRecord is stored for each controller whose vault limit was set by an admin.
+type vaultLimitRecord struct {
+	Controller string `json:"controller"`
+	MaxVaults  uint64 `json:"maxVaults"`
+}
+
+type vaultLimits struct {
+	coreProvider storage.Provider
+	// defaultMax is the number of vaults that controllers without a limit of their own can have. If it's 0, then
+	// there's no limit.
+	defaultMax uint64
+	// locks serializes the vault creations of each controller, so that concurrent ones can't both fit under the
+	// limit. Like the document locks, they're local to this process.
+	locks *documentLocks
+}
+
+// WithMaxVaultsPerController limits the number of vaults that each controller can have, so that a single client
+// of an EDV server with open vault registration can't create vaults without bound. Storing the configuration of a
+// vault that goes over its controller's limit fails with a *VaultLimitError. Admins can give individual controllers
+// a different limit with SetVaultLimit. If max is 0, then only those controllers are limited.
+func WithMaxVaultsPerController(max uint64) Option {
+	return func(p *Provider) {
+		p.vaultLimits = &vaultLimits{coreProvider: p.coreProvider, defaultMax: max, locks: newDocumentLocks()}
+	}
+}
+
+// VaultLimitsEnabled returns whether the number of vaults that each controller can have is limited.
+func (c *Provider) VaultLimitsEnabled() bool {
+	return c.vaultLimits != nil
+}
+
+// VaultLimit returns the vault limit of the given controller, along with the number of vaults it has.
+func (c *Provider) VaultLimit(controller string) (*models.ControllerVaultLimit, error) {
+	record, err := c.vaultLimits.record(controller)
+	if err != nil {
+		return nil, err
+	}
+
+	configStore, err := c.OpenStore(VaultConfigurationStoreName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store for vault configurations: %w", err)
+	}
+
+	vaults, err := configStore.countControllerVaults(controller)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := &models.ControllerVaultLimit{Controller: controller, MaxVaults: c.vaultLimits.defaultMax, Vaults: vaults}
+
+	if record != nil {
+		limit.MaxVaults = record.MaxVaults
+		limit.Override = true
+	}
+
+	return limit, nil
+}
+
+// SetVaultLimit overrides the vault limit of the given controller, and returns its updated limit. If maxVaults is 0,
+// then the controller isn't limited. Lowering the limit below the number of vaults that the controller already has
+// doesn't delete any of them, but it can't create more.
+func (c *Provider) SetVaultLimit(controller string, maxVaults uint64) (*models.ControllerVaultLimit, error) {
+	err := c.vaultLimits.setRecord(&vaultLimitRecord{Controller: controller, MaxVaults: maxVaults})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.VaultLimit(controller)
+}
+
+// DeleteVaultLimit removes the vault limit set for the given controller with SetVaultLimit, so that it has the
+// server's default limit again, and returns its limit.
+func (c *Provider) DeleteVaultLimit(controller string) (*models.ControllerVaultLimit, error) {
+	if c.vaultLimits == nil {
+		return nil, errVaultLimitsNotEnabled
+	}
+
+	limitStore, err := c.coreProvider.OpenStore(VaultLimitStoreName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store for vault limits: %w", err)
+	}
+
+	err = limitStore.Delete(controllerHash(controller))
+	if err != nil && !errors.Is(err, storage.ErrDataNotFound) {
+		return nil, fmt.Errorf("failed to delete vault limit of controller %s: %w", controller, err)
+	}
+
+	return c.VaultLimit(controller)
+}
+
+// record returns the vault limit set for the given controller, or nil if it has the default limit.
+func (v *vaultLimits) record(controller string) (*vaultLimitRecord, error) {
+	if v == nil {
+		return nil, errVaultLimitsNotEnabled
+	}
+
+	limitStore, err := v.coreProvider.OpenStore(VaultLimitStoreName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store for vault limits: %w", err)
+	}
+
+	recordBytes, err := limitStore.Get(controllerHash(controller))
+	if err != nil {
+		if errors.Is(err, storage.ErrDataNotFound) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to get vault limit of controller %s: %w", controller, err)
+	}
+
+	var record vaultLimitRecord
+
+	err = json.Unmarshal(recordBytes, &record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal vault limit of controller %s: %w", controller, err)
+	}
+
+	return &record, nil
+}
+
+func (v *vaultLimits) setRecord(record *vaultLimitRecord) error {
+	if v == nil {
+		return errVaultLimitsNotEnabled
+	}
+
+	unlock := v.locks.lock(record.Controller)
+	defer unlock()
+
+	limitStore, err := v.coreProvider.OpenStore(VaultLimitStoreName)
+	if err != nil {
+		return fmt.Errorf("failed to open store for vault limits: %w", err)
+	}
+
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal vault limit of controller %s: %w", record.Controller, err)
+	}
+
+	err = limitStore.Put(controllerHash(record.Controller), recordBytes)
+	if err != nil {
+		return fmt.Errorf("failed to store vault limit of controller %s: %w", record.Controller, err)
+	}
+
+	return nil
+}
+
+// lockController blocks until the vault limit lock for the given controller is held and returns the function that
+// releases it.
+func (c *Store) lockController(controller string) func() {
+	if c.vaultLimits == nil {
+		return func() {}
+	}
+
+	return c.vaultLimits.locks.lock(controller)
+}
+
+// checkVaultLimit returns a *VaultLimitError if the given controller already has as many vaults as it's allowed to.
+// It's called on the store for vault configurations, with the controller's lock held.
+func (c *Store) checkVaultLimit(controller string) error {
+	if c.vaultLimits == nil {
+		return nil
+	}
+
+	record, err := c.vaultLimits.record(controller)
+	if err != nil {
+		return err
+	}
+
+	maxVaults := c.vaultLimits.defaultMax
+	if record != nil {
+		maxVaults = record.MaxVaults
+	}
+
+	if maxVaults == 0 {
+		return nil
+	}
+
+	vaults, err := c.countControllerVaults(controller)
+	if err != nil {
+		return err
+	}
+
+	if vaults >= maxVaults {
+		return &VaultLimitError{Controller: controller, Max: maxVaults}
+	}
+
+	return nil
+}
+
+func (c *Store) countControllerVaults(controller string) (uint64, error) {
+	count, err := c.countEntries(fmt.Sprintf("%s:%s", VaultConfigControllerTagName, controllerHash(controller)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to count vaults of controller %s: %w", controller, err)
+	}
+
+	return uint64(count), nil
+}
+
+// controllerHash returns the hex-encoded SHA-256 hash of a controller, which is what its vault configs are tagged
+// with and its vault limit is stored under.
+func controllerHash(controller string) string {
+	hash := sha256.Sum256([]byte(controller))
+
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,115 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const (
+	testController  = "did:example:controller1"
+	testController2 = "did:example:controller2"
+)
+
+func TestProvider_VaultLimits(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100, WithMaxVaultsPerController(1))
+		require.True(t, provider.VaultLimitsEnabled())
+
+		configStore, err := provider.OpenStore(VaultConfigurationStoreName)
+		require.NoError(t, err)
+
+		err = storeControllerVault(configStore, "ref1", testController, testVaultID)
+		require.NoError(t, err)
+
+		err = storeControllerVault(configStore, "ref2", testController, testVaultID2)
+		require.EqualError(t, err, "vault limit exceeded: controller did:example:controller1 is limited to 1 vaults")
+		require.True(t, errors.Is(err, messages.ErrVaultLimitExceeded))
+
+		var limitErr *VaultLimitError
+
+		require.True(t, errors.As(err, &limitErr))
+		require.Equal(t, &VaultLimitError{Controller: testController, Max: 1}, limitErr)
+
+		err = storeControllerVault(configStore, "ref3", testController2, testVaultID2)
+		require.NoError(t, err)
+
+		limit, err := provider.VaultLimit(testController)
+		require.NoError(t, err)
+		require.Equal(t, &models.ControllerVaultLimit{Controller: testController, MaxVaults: 1, Vaults: 1}, limit)
+
+		limit, err = provider.SetVaultLimit(testController, 0)
+		require.NoError(t, err)
+		require.Equal(t, &models.ControllerVaultLimit{Controller: testController, Override: true, Vaults: 1}, limit)
+
+		err = storeControllerVault(configStore, "ref4", testController, "CJYHHJx4C8J9Fsgz7rZqSp")
+		require.NoError(t, err)
+
+		limit, err = provider.DeleteVaultLimit(testController)
+		require.NoError(t, err)
+		require.Equal(t, &models.ControllerVaultLimit{Controller: testController, MaxVaults: 1, Vaults: 2}, limit)
+
+		_, err = provider.DeleteVaultLimit(testController)
+		require.NoError(t, err)
+
+		err = storeControllerVault(configStore, "ref5", testController, "DJYHHJx4C8J9Fsgz7rZqSp")
+		require.True(t, errors.Is(err, messages.ErrVaultLimitExceeded))
+	})
+	t.Run("Vault limits not enabled", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+		require.False(t, provider.VaultLimitsEnabled())
+
+		_, err := provider.VaultLimit(testController)
+		require.Equal(t, errVaultLimitsNotEnabled, err)
+
+		_, err = provider.SetVaultLimit(testController, 1)
+		require.Equal(t, errVaultLimitsNotEnabled, err)
+
+		_, err = provider.DeleteVaultLimit(testController)
+		require.Equal(t, errVaultLimitsNotEnabled, err)
+	})
+	t.Run("Fail to get the vault limit", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{OpenStoreReturn: &mock.Store{ErrGet: errors.New("get error")}}, 100,
+			WithMaxVaultsPerController(1))
+
+		_, err := provider.VaultLimit(testController)
+		require.EqualError(t, err, "failed to get vault limit of controller did:example:controller1: get error")
+
+		configStore, err := provider.OpenStore(VaultConfigurationStoreName)
+		require.NoError(t, err)
+
+		err = configStore.checkVaultLimit(testController)
+		require.EqualError(t, err, "failed to get vault limit of controller did:example:controller1: get error")
+	})
+	t.Run("Fail to store the vault limit", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{OpenStoreReturn: &mock.Store{ErrPut: errors.New("put error")}}, 100,
+			WithMaxVaultsPerController(1))
+
+		_, err := provider.SetVaultLimit(testController, 2)
+		require.EqualError(t, err, "failed to store vault limit of controller did:example:controller1: put error")
+	})
+	t.Run("Fail to delete the vault limit", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{OpenStoreReturn: &mock.Store{ErrDelete: errors.New("delete error")}},
+			100, WithMaxVaultsPerController(1))
+
+		_, err := provider.DeleteVaultLimit(testController)
+		require.EqualError(t, err, "failed to delete vault limit of controller did:example:controller1: delete error")
+	})
+}
+
+func storeControllerVault(configStore *Store, referenceID, controller, vaultID string) error {
+	return configStore.StoreDataVaultConfiguration(
+		&models.DataVaultConfiguration{ReferenceID: referenceID, Controller: controller}, vaultID)
+}
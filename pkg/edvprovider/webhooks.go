@@ -0,0 +1,111 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// VaultWebhooks returns the webhooks of the given vault, which are kept in its configuration.
+// It returns nil if the vault doesn't have any, and messages.ErrVaultNotFound if the vault doesn't exist.
+func (c *Provider) VaultWebhooks(vaultID string) (*models.VaultWebhooks, error) {
+	configStore, err := c.coreProvider.OpenStore(VaultConfigurationStoreName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store for vault configurations: %w", err)
+	}
+
+	configEntry, err := getVaultConfigurationMapping(configStore, c.encryption, vaultID)
+	if err != nil {
+		return nil, err
+	}
+
+	return configEntry.Webhooks, nil
+}
+
+// UpdateVaultWebhooks replaces the webhooks in the configuration of the given vault. If webhooks is nil or has no
+// endpoints, then the vault's webhooks are removed. messages.ErrVaultNotFound is returned if the vault doesn't exist.
+func (c *Provider) UpdateVaultWebhooks(vaultID string, webhooks *models.VaultWebhooks) error {
+	if webhooks == nil {
+		webhooks = &models.VaultWebhooks{}
+	}
+
+	configStore, err := c.OpenStore(VaultConfigurationStoreName)
+	if err != nil {
+		return fmt.Errorf("failed to open store for vault configurations: %w", err)
+	}
+
+	_, err = configStore.UpdateDataVaultConfiguration(vaultID, &models.DataVaultConfigurationUpdate{Webhooks: webhooks})
+
+	return err
+}
+
+// maxWebhookChangeAttempts is how many times ChangeVaultWebhooks tries to change a vault's webhooks before giving up
+// because its configuration keeps being changed by other requests.
+const maxWebhookChangeAttempts = 5
+
+// ChangeVaultWebhooks replaces the webhooks of the given vault with the ones that change returns when given the
+// vault's current webhooks, which are nil if it doesn't have any, and returns the new webhooks. Unlike
+// UpdateVaultWebhooks, changes made to the vault's configuration by other requests in the meantime aren't lost: if
+// the configuration changed after change was called, then it's called again with the vault's new webhooks.
+// messages.ErrConfigurationSequenceConflict is returned if the configuration keeps being changed.
+func (c *Provider) ChangeVaultWebhooks(vaultID string,
+	change func(webhooks *models.VaultWebhooks) (*models.VaultWebhooks, error)) (*models.VaultWebhooks, error) {
+	configStore, err := c.OpenStore(VaultConfigurationStoreName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store for vault configurations: %w", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		configEntry, err := getVaultConfigurationMapping(configStore.coreStore, c.encryption, vaultID)
+		if err != nil {
+			return nil, err
+		}
+
+		webhooks, err := change(configEntry.Webhooks)
+		if err != nil {
+			return nil, err
+		}
+
+		if webhooks == nil {
+			webhooks = &models.VaultWebhooks{}
+		}
+
+		sequence := configEntry.DataVaultConfiguration.Sequence + 1
+
+		_, err = configStore.UpdateDataVaultConfiguration(vaultID, &models.DataVaultConfigurationUpdate{
+			Sequence: &sequence,
+			Webhooks: webhooks,
+		})
+		if err == nil {
+			return webhooks, nil
+		}
+
+		if !errors.Is(err, messages.ErrConfigurationSequenceConflict) || attempt == maxWebhookChangeAttempts {
+			return nil, err
+		}
+	}
+}
+
+func getVaultConfigurationMapping(configStore storage.Store, encryption *encryption,
+	vaultID string) (*models.DataVaultConfigurationMapping, error) {
+	configBytes, err := configStore.Get(vaultID)
+	if err != nil {
+		if errors.Is(err, storage.ErrDataNotFound) {
+			return nil, messages.ErrVaultNotFound
+		}
+
+		return nil, fmt.Errorf("failed to get configuration of vault %s: %w", vaultID, err)
+	}
+
+	return decodeVaultConfiguration(encryption, vaultID, configBytes)
+}
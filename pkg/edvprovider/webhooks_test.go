@@ -0,0 +1,182 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mock"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestProvider_UpdateVaultWebhooks(t *testing.T) {
+	t.Run("Webhooks are kept in the vault configuration", func(t *testing.T) {
+		coreProvider := mem.NewProvider()
+		provider := NewProvider(coreProvider, 100)
+		createVaultWithDocuments(t, provider)
+
+		webhooks, err := provider.VaultWebhooks(testVaultID)
+		require.NoError(t, err)
+		require.Nil(t, webhooks)
+
+		expectedWebhooks := &models.VaultWebhooks{Endpoints: []string{"https://example.com/webhook"}, Secret: "secret"}
+
+		require.NoError(t, provider.UpdateVaultWebhooks(testVaultID, expectedWebhooks))
+
+		webhooks, err = provider.VaultWebhooks(testVaultID)
+		require.NoError(t, err)
+		require.Equal(t, expectedWebhooks, webhooks)
+
+		configStore, err := coreProvider.OpenStore(VaultConfigurationStoreName)
+		require.NoError(t, err)
+
+		configBytes, err := configStore.Get(testVaultID)
+		require.NoError(t, err)
+
+		var configEntry models.DataVaultConfigurationMapping
+
+		require.NoError(t, json.Unmarshal(configBytes, &configEntry))
+		require.Equal(t, testReferenceID, configEntry.DataVaultConfiguration.ReferenceID)
+		require.Equal(t, expectedWebhooks, configEntry.Webhooks)
+
+		// The reference ID tag is kept, so duplicate reference IDs are still detected.
+		tags, err := configStore.GetTags(testVaultID)
+		require.NoError(t, err)
+		require.Equal(t, []storage.Tag{{Name: VaultConfigReferenceIDTagName, Value: testReferenceID}}, tags)
+	})
+	t.Run("Webhooks without endpoints are removed", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+		createVaultWithDocuments(t, provider)
+
+		require.NoError(t, provider.UpdateVaultWebhooks(testVaultID,
+			&models.VaultWebhooks{Endpoints: []string{"https://example.com/webhook"}}))
+		require.NoError(t, provider.UpdateVaultWebhooks(testVaultID, &models.VaultWebhooks{Secret: "secret"}))
+
+		webhooks, err := provider.VaultWebhooks(testVaultID)
+		require.NoError(t, err)
+		require.Nil(t, webhooks)
+	})
+	t.Run("Vault not found", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+
+		err := provider.UpdateVaultWebhooks(testVaultID, &models.VaultWebhooks{})
+		require.True(t, errors.Is(err, messages.ErrVaultNotFound))
+
+		webhooks, err := provider.VaultWebhooks(testVaultID)
+		require.True(t, errors.Is(err, messages.ErrVaultNotFound))
+		require.Nil(t, webhooks)
+	})
+	t.Run("Fail to open config store", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{ErrOpenStore: errors.New("open store error")}, 100)
+
+		err := provider.UpdateVaultWebhooks(testVaultID, &models.VaultWebhooks{})
+		require.EqualError(t, err, "failed to open store for vault configurations: open store error")
+
+		_, err = provider.VaultWebhooks(testVaultID)
+		require.EqualError(t, err, "failed to open store for vault configurations: open store error")
+	})
+	t.Run("Fail to store config", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{OpenStoreReturn: &mock.Store{
+			GetReturn: []byte(`{"vaultId":"` + testVaultID + `"}`), ErrPut: errors.New("put error"),
+		}}, 100)
+
+		err := provider.UpdateVaultWebhooks(testVaultID, &models.VaultWebhooks{})
+		require.EqualError(t, err, "failed to store configuration of vault "+testVaultID+": put error")
+	})
+	t.Run("Fail to unmarshal config", func(t *testing.T) {
+		provider := NewProvider(&mock.Provider{OpenStoreReturn: &mock.Store{GetReturn: []byte("{")}}, 100)
+
+		_, err := provider.VaultWebhooks(testVaultID)
+		require.EqualError(t, err,
+			"failed to unmarshal configuration of vault "+testVaultID+": unexpected end of JSON input")
+	})
+}
+
+func TestProvider_ChangeVaultWebhooks(t *testing.T) {
+	t.Run("Concurrent changes aren't lost", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+		createVaultWithDocuments(t, provider)
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < 3; i++ {
+			endpoint := fmt.Sprintf("https://example.com/webhook%d", i)
+
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				_, err := provider.ChangeVaultWebhooks(testVaultID,
+					func(webhooks *models.VaultWebhooks) (*models.VaultWebhooks, error) {
+						if webhooks == nil {
+							webhooks = &models.VaultWebhooks{}
+						}
+
+						webhooks.Endpoints = append(webhooks.Endpoints, endpoint)
+
+						return webhooks, nil
+					})
+				require.NoError(t, err)
+			}()
+		}
+
+		wg.Wait()
+
+		webhooks, err := provider.VaultWebhooks(testVaultID)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{
+			"https://example.com/webhook0", "https://example.com/webhook1", "https://example.com/webhook2",
+		}, webhooks.Endpoints)
+	})
+	t.Run("Change fails", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+		createVaultWithDocuments(t, provider)
+
+		_, err := provider.ChangeVaultWebhooks(testVaultID,
+			func(*models.VaultWebhooks) (*models.VaultWebhooks, error) {
+				return nil, messages.ErrSubscriptionNotFound
+			})
+		require.True(t, errors.Is(err, messages.ErrSubscriptionNotFound))
+	})
+	t.Run("Configuration keeps changing", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+		createVaultWithDocuments(t, provider)
+
+		calls := 0
+
+		_, err := provider.ChangeVaultWebhooks(testVaultID,
+			func(webhooks *models.VaultWebhooks) (*models.VaultWebhooks, error) {
+				calls++
+
+				// Another request changes the configuration in the meantime.
+				require.NoError(t, provider.UpdateVaultWebhooks(testVaultID, &models.VaultWebhooks{}))
+
+				return webhooks, nil
+			})
+		require.True(t, errors.Is(err, messages.ErrConfigurationSequenceConflict))
+		require.Equal(t, maxWebhookChangeAttempts, calls)
+	})
+	t.Run("Vault not found", func(t *testing.T) {
+		provider := NewProvider(mem.NewProvider(), 100)
+
+		_, err := provider.ChangeVaultWebhooks(testVaultID,
+			func(webhooks *models.VaultWebhooks) (*models.VaultWebhooks, error) {
+				return webhooks, nil
+			})
+		require.True(t, errors.Is(err, messages.ErrVaultNotFound))
+	})
+}
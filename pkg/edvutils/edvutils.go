@@ -13,6 +13,7 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"regexp"
 
 	"github.com/btcsuite/btcutil/base58"
 	"github.com/google/uuid"
@@ -26,6 +27,12 @@ const (
 	none        = "none"
 )
 
+// didURLRegexp matches the DID URL syntax of the DID Core specification: a DID, made of a method name and a
+// method-specific ID, optionally followed by a path, a query and a fragment.
+var didURLRegexp = regexp.MustCompile(
+	`^did:[a-z0-9]+:(?:(?:[A-Za-z0-9._-]|%[0-9A-Fa-f]{2})*:)*(?:[A-Za-z0-9._-]|%[0-9A-Fa-f]{2})+` +
+		`(?:/[^?#\s]*)?(?:\?[^#\s]*)?(?:#[^#\s]*)?$`)
+
 type generateRandomBytesFunc func([]byte) (int, error)
 
 // GenerateEDVCompatibleID generates an EDV compatible ID using a cryptographically secure random number generator.
@@ -77,6 +84,31 @@ func Base58Encoded128BitToUUID(name string) (string, error) {
 	return storeNameUUID.String(), nil
 }
 
+// CheckIfUUID checks if the given ID is a UUID in its canonical, hyphenated form.
+func CheckIfUUID(id string) error {
+	const uuidLength = 36
+
+	if len(id) != uuidLength {
+		return messages.ErrNotUUID
+	}
+
+	if _, err := uuid.Parse(id); err != nil {
+		return messages.ErrNotUUID
+	}
+
+	return nil
+}
+
+// CheckIfDIDURL checks if the given ID is a DID URL, such as did:example:123#document-1. Only the syntax is checked,
+// so the DID doesn't need to be resolvable.
+func CheckIfDIDURL(id string) error {
+	if !didURLRegexp.MatchString(id) {
+		return messages.ErrNotDIDURL
+	}
+
+	return nil
+}
+
 // CheckIfURI checks if the given string is a valid URI.
 func CheckIfURI(str string) error {
 	_, err := url.ParseRequestURI(str)
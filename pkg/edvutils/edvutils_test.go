@@ -91,6 +91,45 @@ func TestCheckIfBase58Encoded128BitValue(t *testing.T) {
 	})
 }
 
+func TestCheckIfUUID(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		err := CheckIfUUID(testConvertedUUIDString)
+		require.NoError(t, err)
+	})
+	t.Run("Failure - not a UUID", func(t *testing.T) {
+		err := CheckIfUUID(testBase58encoded128bitString)
+		require.Equal(t, messages.ErrNotUUID, err)
+	})
+	t.Run("Failure - not in canonical form", func(t *testing.T) {
+		err := CheckIfUUID("urn:uuid:" + testConvertedUUIDString)
+		require.Equal(t, messages.ErrNotUUID, err)
+	})
+}
+
+func TestCheckIfDIDURL(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		for _, id := range []string{
+			"did:example:123",
+			"did:example:123#document-1",
+			"did:web:example.com%3A8080:user:alice/documents?version=1#z6Mkf5rGMoatrSj1f4CyvuHBeXJELe9RPdzo2PKGNCKVtZxP",
+		} {
+			require.NoError(t, CheckIfDIDURL(id), id)
+		}
+	})
+	t.Run("Failure - not a DID URL", func(t *testing.T) {
+		for _, id := range []string{
+			testBase58encoded128bitString,
+			"did:example:",
+			"did:Example:123",
+			"did:example:123#a#b",
+			"did:example:12 3",
+			"https://example.com/documents/123",
+		} {
+			require.Equal(t, messages.ErrNotDIDURL, CheckIfDIDURL(id), id)
+		}
+	})
+}
+
 func TestBase58Encoded128BitToUUID(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		uuidString, err := Base58Encoded128BitToUUID(testBase58encoded128bitString)
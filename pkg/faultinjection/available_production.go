@@ -0,0 +1,13 @@
+//go:build production
+// +build production
+
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package faultinjection
+
+// Available is whether faults can be injected in this build. Builds with the production build tag leave it out.
+const Available = false
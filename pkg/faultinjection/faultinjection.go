@@ -0,0 +1,277 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package faultinjection injects latency and errors into the responses of the EDV server, so that clients such as
+// wallets can be tested against a slow or failing EDV server in integration environments, without putting a custom
+// proxy in front of it. Each rule applies to the requests to an endpoint: they're delayed by the rule's latency, and
+// a share of them fail with the rule's error status code instead of being handled.
+// It must never be enabled in production, so builds with the production build tag leave it out (see Available).
+package faultinjection
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/trustbloc/edv/pkg/logging"
+)
+
+const (
+	logModuleName = "faultinjection"
+
+	// InjectedHeader is set on the responses that an error was injected into, so that clients can tell injected
+	// errors from real ones.
+	InjectedHeader = "EDV-Fault-Injected"
+
+	defaultErrorStatus = http.StatusServiceUnavailable
+	maxErrorStatus     = 599
+
+	// injectedError is the body of the response to requests that an error was injected into.
+	injectedError = "fault injected: %s %s failed with status code %d"
+)
+
+var logger = logging.New(logModuleName)
+
+// ErrNotAvailable is returned when faults are to be injected in a build that leaves fault injection out.
+var ErrNotAvailable = errors.New("fault injection is not available in production builds")
+
+// Rule is the faults to inject into the requests to an endpoint.
+type Rule struct {
+	// Method is the HTTP method of the endpoint. If it's empty, then the rule applies to every method.
+	Method string
+	// Path is the path of the endpoint, in which a path segment in braces, such as {vaultID}, matches any segment.
+	Path string
+	// Latency is how long requests are delayed for before they're handled or fail.
+	Latency time.Duration
+	// LatencyJitter is the most that is randomly added to Latency for each request.
+	LatencyJitter time.Duration
+	// ErrorRate is the share of requests, from 0 to 1, that fail with ErrorStatus instead of being handled.
+	ErrorRate float64
+	// ErrorStatus is the status code of the requests that fail. Defaults to 503 if it's 0.
+	ErrorStatus int
+}
+
+// ruleJSON is how a rule is written in the rules that ParseRules parses, with its durations written as Go durations
+// such as "250ms".
+type ruleJSON struct {
+	Method        string  `json:"method"`
+	Path          string  `json:"path"`
+	Latency       string  `json:"latency"`
+	LatencyJitter string  `json:"latencyJitter"`
+	ErrorRate     float64 `json:"errorRate"`
+	ErrorStatus   int     `json:"errorStatus"`
+}
+
+// ParseRules parses a JSON array of rules, for example
+// [{"method": "GET", "path": "/encrypted-data-vaults/{vaultID}/documents/{docID}", "latency": "250ms",
+// "errorRate": 0.1, "errorStatus": 503}].
+func ParseRules(rulesJSON []byte) ([]Rule, error) {
+	var parsed []ruleJSON
+
+	if err := json.Unmarshal(rulesJSON, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal fault injection rules: %w", err)
+	}
+
+	rules := make([]Rule, len(parsed))
+
+	for i, r := range parsed {
+		latency, err := parseDuration(r.Latency)
+		if err != nil {
+			return nil, fmt.Errorf("invalid latency of fault injection rule %d: %w", i, err)
+		}
+
+		latencyJitter, err := parseDuration(r.LatencyJitter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid latency jitter of fault injection rule %d: %w", i, err)
+		}
+
+		rules[i] = Rule{
+			Method:        r.Method,
+			Path:          r.Path,
+			Latency:       latency,
+			LatencyJitter: latencyJitter,
+			ErrorRate:     r.ErrorRate,
+			ErrorStatus:   r.ErrorStatus,
+		}
+	}
+
+	return rules, nil
+}
+
+// Option configures the Injector.
+type Option func(i *Injector)
+
+// WithLogger has the Injector log with the given logger instead of the edge-core logger for its module.
+func WithLogger(logger logging.Logger) Option {
+	return func(i *Injector) {
+		i.logger = logger
+	}
+}
+
+// Injector injects the faults of its rules into the requests that they apply to.
+type Injector struct {
+	rules  []rule
+	logger logging.Logger
+}
+
+type rule struct {
+	Rule
+	segments []string
+}
+
+// New returns a new Injector with the given rules. If more than one rule applies to a request, then the first one is
+// used.
+func New(rules []Rule, opts ...Option) (*Injector, error) {
+	if !Available {
+		return nil, ErrNotAvailable
+	}
+
+	injector := &Injector{logger: logger}
+
+	for _, opt := range opts {
+		opt(injector)
+	}
+
+	for i, r := range rules {
+		if err := validate(&r); err != nil {
+			return nil, fmt.Errorf("invalid fault injection rule %d: %w", i, err)
+		}
+
+		if r.ErrorStatus == 0 {
+			r.ErrorStatus = defaultErrorStatus
+		}
+
+		injector.rules = append(injector.rules, rule{Rule: r, segments: pathSegments(r.Path)})
+	}
+
+	return injector, nil
+}
+
+// Middleware returns a handler that injects the faults of the rule that applies to each request before passing it
+// on to next. Requests that no rule applies to are passed on as they are.
+func (i *Injector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		matched := i.match(r)
+		if matched == nil {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		if latency := matched.latency(); latency > 0 {
+			timer := time.NewTimer(latency)
+
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				timer.Stop()
+
+				return
+			}
+		}
+
+		// The faults are only for testing, so they don't need a cryptographically secure source of randomness.
+		if matched.ErrorRate > 0 && rand.Float64() < matched.ErrorRate { // nolint:gosec
+			logger := logging.FromContext(r.Context(), i.logger)
+
+			logger.Debugf("Injecting a %d error into %s request to %s", matched.ErrorStatus, r.Method, r.URL.Path)
+
+			w.Header().Set(InjectedHeader, "true")
+			w.WriteHeader(matched.ErrorStatus)
+
+			_, err := w.Write([]byte(fmt.Sprintf(injectedError, r.Method, r.URL.Path, matched.ErrorStatus)))
+			if err != nil {
+				logger.Errorf("Failed to write response: %s", err)
+			}
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (i *Injector) match(r *http.Request) *rule {
+	segments := pathSegments(r.URL.EscapedPath())
+
+	for j := range i.rules {
+		if i.rules[j].matches(r.Method, segments) {
+			return &i.rules[j]
+		}
+	}
+
+	return nil
+}
+
+func (r *rule) matches(method string, segments []string) bool {
+	if r.Method != "" && !strings.EqualFold(r.Method, method) {
+		return false
+	}
+
+	if len(segments) != len(r.segments) {
+		return false
+	}
+
+	for i, segment := range r.segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if segments[i] == "" {
+				return false
+			}
+
+			continue
+		}
+
+		if segment != segments[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *rule) latency() time.Duration {
+	if r.LatencyJitter <= 0 {
+		return r.Latency
+	}
+
+	return r.Latency + time.Duration(rand.Int63n(int64(r.LatencyJitter)+1)) // nolint:gosec
+}
+
+func validate(r *Rule) error {
+	if !strings.HasPrefix(r.Path, "/") {
+		return fmt.Errorf("path %q must start with /", r.Path)
+	}
+
+	if r.Latency < 0 || r.LatencyJitter < 0 {
+		return errors.New("latency can't be negative")
+	}
+
+	if r.ErrorRate < 0 || r.ErrorRate > 1 {
+		return fmt.Errorf("error rate %v must be between 0 and 1", r.ErrorRate)
+	}
+
+	if r.ErrorStatus != 0 && (r.ErrorStatus < http.StatusBadRequest || r.ErrorStatus > maxErrorStatus) {
+		return fmt.Errorf("error status %d must be a 4xx or 5xx status code", r.ErrorStatus)
+	}
+
+	return nil
+}
+
+func parseDuration(duration string) (time.Duration, error) {
+	if duration == "" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(duration)
+}
+
+func pathSegments(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
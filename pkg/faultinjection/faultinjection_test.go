@@ -0,0 +1,132 @@
+//go:build !production
+// +build !production
+
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package faultinjection
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const documentPath = "/encrypted-data-vaults/{vaultID}/documents/{docID}"
+
+func TestParseRules(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		rules, err := ParseRules([]byte(`[{"method":"GET","path":"/encrypted-data-vaults/{vaultID}/documents/{docID}",
+			"latency":"250ms","latencyJitter":"1s","errorRate":0.1,"errorStatus":500},{"path":"/healthcheck"}]`))
+		require.NoError(t, err)
+		require.Equal(t, []Rule{
+			{
+				Method: http.MethodGet, Path: documentPath, Latency: 250 * time.Millisecond, LatencyJitter: time.Second,
+				ErrorRate: 0.1, ErrorStatus: http.StatusInternalServerError,
+			},
+			{Path: "/healthcheck"},
+		}, rules)
+	})
+	t.Run("Invalid rules", func(t *testing.T) {
+		_, err := ParseRules([]byte(`{}`))
+		require.EqualError(t, err, "failed to unmarshal fault injection rules: "+
+			"json: cannot unmarshal object into Go value of type []faultinjection.ruleJSON")
+
+		_, err = ParseRules([]byte(`[{"path":"/","latency":"soon"}]`))
+		require.EqualError(t, err, `invalid latency of fault injection rule 0: time: invalid duration "soon"`)
+
+		_, err = ParseRules([]byte(`[{"path":"/","latencyJitter":"10"}]`))
+		require.EqualError(t, err, `invalid latency jitter of fault injection rule 0: `+
+			`time: missing unit in duration "10"`)
+	})
+}
+
+func TestNew(t *testing.T) {
+	for _, test := range []struct {
+		rule Rule
+		err  string
+	}{
+		{Rule{Path: "healthcheck"}, `invalid fault injection rule 0: path "healthcheck" must start with /`},
+		{Rule{Path: "/", Latency: -time.Second}, "invalid fault injection rule 0: latency can't be negative"},
+		{Rule{Path: "/", ErrorRate: 1.5}, "invalid fault injection rule 0: error rate 1.5 must be between 0 and 1"},
+		{
+			Rule{Path: "/", ErrorRate: 1, ErrorStatus: http.StatusOK},
+			"invalid fault injection rule 0: error status 200 must be a 4xx or 5xx status code",
+		},
+	} {
+		injector, err := New([]Rule{test.rule})
+		require.EqualError(t, err, test.err)
+		require.Nil(t, injector)
+	}
+}
+
+func TestInjector_Middleware(t *testing.T) {
+	injector, err := New([]Rule{
+		{Method: http.MethodGet, Path: documentPath, ErrorRate: 1},
+		{Path: "/encrypted-data-vaults/{vaultID}/query", ErrorRate: 1, ErrorStatus: http.StatusTooManyRequests},
+		{Path: "/encrypted-data-vaults/{vaultID}/documents", Latency: 50 * time.Millisecond},
+		{Path: "/encrypted-data-vaults/{vaultID}/batch", Latency: time.Hour, LatencyJitter: time.Hour},
+	})
+	require.NoError(t, err)
+
+	handled := 0
+
+	handler := injector.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handled++
+	}))
+
+	t.Run("Inject an error", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", nil))
+		require.Equal(t, http.StatusServiceUnavailable, rw.Code)
+		require.Equal(t, "true", rw.Header().Get(InjectedHeader))
+		require.Equal(t, "fault injected: GET /encrypted-data-vaults/vault1/documents/doc1 failed with status code 503",
+			rw.Body.String())
+
+		rw = httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/encrypted-data-vaults/vault1/query", nil))
+		require.Equal(t, http.StatusTooManyRequests, rw.Code)
+
+		require.Zero(t, handled)
+	})
+	t.Run("Inject latency", func(t *testing.T) {
+		start := time.Now()
+
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/encrypted-data-vaults/vault1/documents", nil))
+		require.Equal(t, http.StatusOK, rw.Code)
+		require.Empty(t, rw.Header().Get(InjectedHeader))
+		require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+		require.Equal(t, 1, handled)
+	})
+	t.Run("Stop waiting when the request is canceled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "/encrypted-data-vaults/vault1/batch", nil).
+			WithContext(ctx))
+		require.Equal(t, 1, handled)
+	})
+	t.Run("Requests that no rule applies to", func(t *testing.T) {
+		for _, req := range []*http.Request{
+			httptest.NewRequest(http.MethodPost, "/encrypted-data-vaults/vault1/documents/doc1", nil),
+			httptest.NewRequest(http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1/history", nil),
+			httptest.NewRequest(http.MethodGet, "/encrypted-data-vaults//documents/doc1", nil),
+			httptest.NewRequest(http.MethodGet, "/healthcheck", nil),
+		} {
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+			require.Equal(t, http.StatusOK, rw.Code)
+		}
+
+		require.Equal(t, 5, handled)
+	})
+}
@@ -0,0 +1,142 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package logging defines the logging interface that the EDV server's components accept, and gives each request a
+// correlation ID that's included in the log lines written while handling it. The correlation ID of a request is taken
+// from its X-Correlation-ID header, or generated if it doesn't have one, and is returned in the same header of the
+// response, so that operators can trace a failing request across components.
+package logging
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/trustbloc/edge-core/pkg/log"
+)
+
+// CorrelationIDHeader is the header that carries the correlation ID of requests and their responses.
+const CorrelationIDHeader = "X-Correlation-ID"
+
+// maxCorrelationIDLength is the maximum length of the correlation IDs accepted from clients.
+const maxCorrelationIDLength = 128
+
+// Logger is the logging interface of the EDV server's components. Its methods format their message like fmt.Sprintf.
+// The edge-core loggers returned by New implement it, and are used if no other logger is given.
+type Logger interface {
+	Panicf(msg string, args ...interface{})
+	Fatalf(msg string, args ...interface{})
+	Errorf(msg string, args ...interface{})
+	Warnf(msg string, args ...interface{})
+	Infof(msg string, args ...interface{})
+	Debugf(msg string, args ...interface{})
+}
+
+// New returns the edge-core logger for the given module.
+func New(module string) Logger {
+	return log.New(module)
+}
+
+type correlationIDContextKey struct{}
+
+// NewContext returns a copy of ctx that carries the given correlation ID.
+func NewContext(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDContextKey{}, correlationID)
+}
+
+// CorrelationID returns the correlation ID carried by ctx, or an empty string if it doesn't carry one.
+func CorrelationID(ctx context.Context) string {
+	correlationID, _ := ctx.Value(correlationIDContextKey{}).(string)
+
+	return correlationID
+}
+
+// FromContext returns a logger that includes the correlation ID carried by ctx in each line it logs with logger.
+// If ctx doesn't carry one, then logger is returned as it is.
+func FromContext(ctx context.Context, logger Logger) Logger {
+	return WithCorrelationID(logger, CorrelationID(ctx))
+}
+
+// WithCorrelationID returns a logger that includes the given correlation ID in each line it logs with logger.
+// If the correlation ID is empty, then logger is returned as it is.
+func WithCorrelationID(logger Logger, correlationID string) Logger {
+	if correlationID == "" {
+		return logger
+	}
+
+	if correlatedLogger, ok := logger.(*correlatedLogger); ok {
+		logger = correlatedLogger.logger
+	}
+
+	return &correlatedLogger{logger: logger, prefix: "[correlationID=" + correlationID + "] "}
+}
+
+// Middleware gives each request a correlation ID, which is added to the request's context and set in the
+// X-Correlation-ID header of the response. It's the one in the request's X-Correlation-ID header if it's valid, or a
+// newly generated one otherwise.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		correlationID := req.Header.Get(CorrelationIDHeader)
+		if !validCorrelationID(correlationID) {
+			correlationID = uuid.New().String()
+		}
+
+		rw.Header().Set(CorrelationIDHeader, correlationID)
+
+		next.ServeHTTP(rw, req.WithContext(NewContext(req.Context(), correlationID)))
+	})
+}
+
+// validCorrelationID returns whether the given correlation ID from a client can be used. Only IDs made up of
+// letters, digits and the characters "-", "_", "." and ":" are accepted, so that they can't be used to forge log
+// lines or break format strings.
+func validCorrelationID(correlationID string) bool {
+	if correlationID == "" || len(correlationID) > maxCorrelationIDLength {
+		return false
+	}
+
+	for _, character := range correlationID {
+		switch {
+		case character >= 'a' && character <= 'z', character >= 'A' && character <= 'Z',
+			character >= '0' && character <= '9', character == '-', character == '_', character == '.',
+			character == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// correlatedLogger prefixes each line it logs with a correlation ID.
+type correlatedLogger struct {
+	logger Logger
+	prefix string
+}
+
+func (l *correlatedLogger) Panicf(msg string, args ...interface{}) {
+	l.logger.Panicf(l.prefix+msg, args...)
+}
+
+func (l *correlatedLogger) Fatalf(msg string, args ...interface{}) {
+	l.logger.Fatalf(l.prefix+msg, args...)
+}
+
+func (l *correlatedLogger) Errorf(msg string, args ...interface{}) {
+	l.logger.Errorf(l.prefix+msg, args...)
+}
+
+func (l *correlatedLogger) Warnf(msg string, args ...interface{}) {
+	l.logger.Warnf(l.prefix+msg, args...)
+}
+
+func (l *correlatedLogger) Infof(msg string, args ...interface{}) {
+	l.logger.Infof(l.prefix+msg, args...)
+}
+
+func (l *correlatedLogger) Debugf(msg string, args ...interface{}) {
+	l.logger.Debugf(l.prefix+msg, args...)
+}
@@ -0,0 +1,97 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	var correlationID string
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		correlationID = CorrelationID(r.Context())
+	}))
+
+	t.Run("Correlation ID from the request", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(CorrelationIDHeader, "batch-42:retry.1")
+
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		require.Equal(t, "batch-42:retry.1", correlationID)
+		require.Equal(t, "batch-42:retry.1", rw.Header().Get(CorrelationIDHeader))
+	})
+	t.Run("Correlation ID is generated", func(t *testing.T) {
+		for _, requestCorrelationID := range []string{"", "%s%s", "id\nforged log line", strings.Repeat("a", 129)} {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(CorrelationIDHeader, requestCorrelationID)
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			require.NotEmpty(t, correlationID)
+			require.NotEqual(t, requestCorrelationID, correlationID)
+			require.Equal(t, correlationID, rw.Header().Get(CorrelationIDHeader))
+		}
+	})
+}
+
+func TestFromContext(t *testing.T) {
+	logger := &recordingLogger{}
+
+	require.Equal(t, logger, FromContext(context.Background(), logger))
+
+	ctx := NewContext(context.Background(), "correlationID")
+
+	correlatedLogger := FromContext(ctx, logger)
+	correlatedLogger.Debugf("debug %d", 1)
+	correlatedLogger.Infof("info %d", 2)
+	correlatedLogger.Warnf("warn %d", 3)
+	correlatedLogger.Errorf("error %d", 4)
+	correlatedLogger.Panicf("panic %d", 5)
+	correlatedLogger.Fatalf("fatal %d", 6)
+
+	require.Equal(t, []string{
+		"[correlationID=correlationID] debug 1",
+		"[correlationID=correlationID] info 2",
+		"[correlationID=correlationID] warn 3",
+		"[correlationID=correlationID] error 4",
+		"[correlationID=correlationID] panic 5",
+		"[correlationID=correlationID] fatal 6",
+	}, logger.lines)
+
+	// The correlation ID replaces the one the logger already has.
+	logger.lines = nil
+
+	WithCorrelationID(correlatedLogger, "other").Infof("info")
+	require.Equal(t, []string{"[correlationID=other] info"}, logger.lines)
+}
+
+// recordingLogger records the lines that it logs.
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) log(msg string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(msg, args...))
+}
+
+func (l *recordingLogger) Panicf(msg string, args ...interface{}) { l.log(msg, args...) }
+func (l *recordingLogger) Fatalf(msg string, args ...interface{}) { l.log(msg, args...) }
+func (l *recordingLogger) Errorf(msg string, args ...interface{}) { l.log(msg, args...) }
+func (l *recordingLogger) Warnf(msg string, args ...interface{})  { l.log(msg, args...) }
+func (l *recordingLogger) Infof(msg string, args ...interface{})  { l.log(msg, args...) }
+func (l *recordingLogger) Debugf(msg string, args ...interface{}) { l.log(msg, args...) }
@@ -0,0 +1,318 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package metrics exposes Prometheus metrics for the EDV server: the number, latency and errors of requests to the
+// EDV REST API, per operation, and measurements of the work done by the EDV storage provider.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Path is the path of the endpoint that serves the metrics.
+const Path = "/metrics"
+
+const namespace = "edv"
+
+// The operations whose requests are instrumented. Requests for other operations aren't counted.
+const (
+	CreateVaultOperation = "create-vault"
+	PutOperation         = "put"
+	GetOperation         = "get"
+	QueryOperation       = "query"
+	UpdateOperation      = "update"
+	DeleteOperation      = "delete"
+)
+
+const (
+	operationLabel = "operation"
+	codeLabel      = "code"
+	poolLabel      = "pool"
+	kindLabel      = "kind"
+	limitLabel     = "limit"
+	outcomeLabel   = "outcome"
+	sinkLabel      = "sink"
+	vaultLabel     = "vault"
+
+	orphanedKind = "orphaned"
+	missingKind  = "missing"
+
+	// The buckets of the size histograms go from 1 to 2048.
+	sizeBucketStart  = 1
+	sizeBucketFactor = 2
+	sizeBucketCount  = 12
+
+	// The number of segments in the paths of a vault collection, of a vault's documents or queries, and of a
+	// document.
+	vaultsPathLength   = 1
+	vaultPathLength    = 3
+	documentPathLength = 4
+
+	vaultsPathSegment    = "encrypted-data-vaults"
+	documentsPathSegment = "documents"
+	queryPathSegment     = "query"
+)
+
+// Metrics holds the collectors of the EDV server's metrics, registered in their own registry along with the
+// standard Go runtime and process collectors.
+type Metrics struct {
+	registry         *prometheus.Registry
+	requests         *prometheus.CounterVec
+	requestErrors    *prometheus.CounterVec
+	requestDurations *prometheus.HistogramVec
+	mappingDocuments prometheus.Counter
+	batchSizes       prometheus.Histogram
+	queryFanOut      prometheus.Histogram
+	bulkheadCapacity *prometheus.GaugeVec
+	bulkheadInFlight *prometheus.GaugeVec
+	bulkheadRejected *prometheus.CounterVec
+	rateLimited      *prometheus.CounterVec
+	indexCorruption  *prometheus.CounterVec
+	auditDropped     *prometheus.CounterVec
+	// providerOperations and providerDurations are for the storage provider's store operations (opening stores,
+	// setting their configurations and checking that they exist), which are kept apart from document operations.
+	providerOperations *prometheus.CounterVec
+	providerDurations  *prometheus.HistogramVec
+}
+
+// New returns a new Metrics instance.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_total",
+			Help:      "The number of requests handled, by operation and HTTP status code.",
+		}, []string{operationLabel, codeLabel}),
+		requestErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "request_errors_total",
+			Help:      "The number of requests that failed with a 4xx or 5xx HTTP status code, by operation.",
+		}, []string{operationLabel}),
+		requestDurations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "The time taken to handle requests, including authorization, by operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{operationLabel}),
+		mappingDocuments: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "mapping_documents_written_total",
+			Help:      "The number of mapping documents written to the database.",
+		}),
+		batchSizes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "database_batch_size",
+			Help:      "The number of operations in each batch written to the database.",
+			Buckets:   prometheus.ExponentialBuckets(sizeBucketStart, sizeBucketFactor, sizeBucketCount),
+		}),
+		queryFanOut: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "query_fan_out",
+			Help:      "The number of documents fetched from the database to answer each query.",
+			Buckets:   prometheus.ExponentialBuckets(sizeBucketStart, sizeBucketFactor, sizeBucketCount),
+		}),
+		bulkheadCapacity: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "bulkhead_capacity",
+			Help:      "The maximum number of requests that can be handled at the same time, by bulkhead pool.",
+		}, []string{poolLabel}),
+		bulkheadInFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "bulkhead_in_flight",
+			Help:      "The number of requests being handled, by bulkhead pool.",
+		}, []string{poolLabel}),
+		bulkheadRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bulkhead_rejected_total",
+			Help:      "The number of requests rejected because their bulkhead pool was full, by pool.",
+		}, []string{poolLabel}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limited_total",
+			Help:      "The number of requests rejected because they went over a rate limit, by limit.",
+		}, []string{limitLabel}),
+		indexCorruption: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "index_corruption_mapping_documents_total",
+			Help: "The number of inconsistent mapping documents reported by index corruption alerts, by vault and " +
+				"kind (orphaned or missing).",
+		}, []string{vaultLabel, kindLabel}),
+		auditDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "audit_entries_dropped_total",
+			Help:      "The number of audit entries dropped because the queue of their sink was full, by sink.",
+		}, []string{sinkLabel}),
+		providerOperations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "provider_operations_total",
+			Help: "The number of stores opened, configured and checked for existence by the storage provider, " +
+				"by operation and outcome (success, not-found or error).",
+		}, []string{operationLabel, outcomeLabel}),
+		providerDurations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "provider_operation_duration_seconds",
+			Help:      "The time taken by the storage provider's store operations, by operation and outcome.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{operationLabel, outcomeLabel}),
+	}
+
+	m.registry.MustRegister(m.requests, m.requestErrors, m.requestDurations, m.mappingDocuments, m.batchSizes,
+		m.queryFanOut, m.bulkheadCapacity, m.bulkheadInFlight, m.bulkheadRejected, m.rateLimited,
+		m.indexCorruption, m.auditDropped, m.providerOperations, m.providerDurations,
+		prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+
+	return m
+}
+
+// Handler returns the handler for the metrics endpoint, which serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware returns a handler that records the count, latency and status code of the requests for the
+// instrumented operations before passing them to next. It's meant to wrap every other handler, so that requests
+// rejected while being authorized are counted too.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		operation := Operation(r)
+		if operation == "" {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+
+		next.ServeHTTP(recorder, r)
+
+		m.requestDurations.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+		m.requests.WithLabelValues(operation, strconv.Itoa(recorder.status)).Inc()
+
+		if recorder.status >= http.StatusBadRequest {
+			m.requestErrors.WithLabelValues(operation).Inc()
+		}
+	})
+}
+
+// MappingDocumentsWritten records that the given number of mapping documents were written to the database.
+func (m *Metrics) MappingDocumentsWritten(count int) {
+	m.mappingDocuments.Add(float64(count))
+}
+
+// BatchWritten records a batch of the given number of operations written to the database.
+func (m *Metrics) BatchWritten(operations int) {
+	m.batchSizes.Observe(float64(operations))
+}
+
+// QueryFannedOut records a query that fetched the given number of documents from the database.
+func (m *Metrics) QueryFannedOut(documents int) {
+	m.queryFanOut.Observe(float64(documents))
+}
+
+// BulkheadCapacity records the maximum number of requests that can be handled at the same time in the given pool.
+func (m *Metrics) BulkheadCapacity(pool string, capacity int) {
+	m.bulkheadCapacity.WithLabelValues(pool).Set(float64(capacity))
+}
+
+// BulkheadAcquired records that a request started being handled in the given pool.
+func (m *Metrics) BulkheadAcquired(pool string) {
+	m.bulkheadInFlight.WithLabelValues(pool).Inc()
+}
+
+// BulkheadReleased records that a request is no longer being handled in the given pool.
+func (m *Metrics) BulkheadReleased(pool string) {
+	m.bulkheadInFlight.WithLabelValues(pool).Dec()
+}
+
+// BulkheadRejected records a request rejected because the given pool was full.
+func (m *Metrics) BulkheadRejected(pool string) {
+	m.bulkheadRejected.WithLabelValues(pool).Inc()
+}
+
+// RateLimited records a request rejected because it went over the given rate limit.
+func (m *Metrics) RateLimited(limit string) {
+	m.rateLimited.WithLabelValues(limit).Inc()
+}
+
+// IndexCorruptionDetected records an index corruption alert for a vault with the given numbers of orphaned and
+// missing mapping documents.
+// Only vaults that alerts were raised for are labelled, so the number of series stays small.
+func (m *Metrics) IndexCorruptionDetected(vaultID string, orphanedMappingDocuments, missingMappingDocuments int) {
+	m.indexCorruption.WithLabelValues(vaultID, orphanedKind).Add(float64(orphanedMappingDocuments))
+	m.indexCorruption.WithLabelValues(vaultID, missingKind).Add(float64(missingMappingDocuments))
+}
+
+// AuditEntryDropped records an audit entry dropped because the queue of the given sink was full.
+func (m *Metrics) AuditEntryDropped(sink string) {
+	m.auditDropped.WithLabelValues(sink).Inc()
+}
+
+// ProviderOperationDone records a store operation of the storage provider with the given outcome and duration.
+func (m *Metrics) ProviderOperationDone(operation, outcome string, duration time.Duration) {
+	m.providerOperations.WithLabelValues(operation, outcome).Inc()
+	m.providerDurations.WithLabelValues(operation, outcome).Observe(duration.Seconds())
+}
+
+// Operation returns the instrumented operation that the given request is for, or an empty string if it's for
+// another operation.
+func Operation(r *http.Request) string {
+	segments := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	if segments[0] != vaultsPathSegment {
+		return ""
+	}
+
+	switch {
+	case len(segments) == vaultsPathLength && r.Method == http.MethodPost:
+		return CreateVaultOperation
+	case len(segments) == vaultPathLength && segments[2] == queryPathSegment && r.Method == http.MethodPost:
+		return QueryOperation
+	case len(segments) == vaultPathLength && segments[2] == documentsPathSegment && r.Method == http.MethodPost:
+		return PutOperation
+	case len(segments) == documentPathLength && segments[2] == documentsPathSegment:
+		return documentOperation(r.Method)
+	default:
+		return ""
+	}
+}
+
+func documentOperation(method string) string {
+	switch method {
+	case http.MethodGet:
+		return GetOperation
+	case http.MethodPost:
+		return UpdateOperation
+	case http.MethodDelete:
+		return DeleteOperation
+	default:
+		return ""
+	}
+}
+
+// statusRecorder records the status code written to the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush sends any buffered data to the client, if the underlying response writer supports it.
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics_Middleware(t *testing.T) {
+	t.Run("Requests for instrumented operations are recorded", func(t *testing.T) {
+		m := New()
+
+		handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodDelete {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		handler.ServeHTTP(httptest.NewRecorder(),
+			httptest.NewRequest(http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", nil))
+		handler.ServeHTTP(httptest.NewRecorder(),
+			httptest.NewRequest(http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", nil))
+		handler.ServeHTTP(httptest.NewRecorder(),
+			httptest.NewRequest(http.MethodDelete, "/encrypted-data-vaults/vault1/documents/doc1", nil))
+
+		require.Equal(t, float64(2), testutil.ToFloat64(m.requests.WithLabelValues(GetOperation, "200")))
+		require.Equal(t, float64(1), testutil.ToFloat64(m.requests.WithLabelValues(DeleteOperation, "404")))
+		require.Equal(t, float64(0), testutil.ToFloat64(m.requestErrors.WithLabelValues(GetOperation)))
+		require.Equal(t, float64(1), testutil.ToFloat64(m.requestErrors.WithLabelValues(DeleteOperation)))
+		require.Equal(t, 2, testutil.CollectAndCount(m.requestDurations))
+	})
+	t.Run("Requests for other operations aren't recorded", func(t *testing.T) {
+		m := New()
+
+		var handled bool
+
+		handler := m.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			handled = true
+		}))
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthcheck", nil))
+
+		require.True(t, handled)
+		require.Zero(t, testutil.CollectAndCount(m.requests))
+		require.Zero(t, testutil.CollectAndCount(m.requestDurations))
+	})
+}
+
+func TestMetrics_Handler(t *testing.T) {
+	m := New()
+	m.MappingDocumentsWritten(3)
+	m.BatchWritten(10)
+	m.QueryFannedOut(5)
+	m.BulkheadCapacity("query", 10)
+	m.BulkheadAcquired("query")
+	m.BulkheadAcquired("query")
+	m.BulkheadReleased("query")
+	m.BulkheadRejected("query")
+	m.RateLimited("client")
+	m.IndexCorruptionDetected("vault1", 4, 2)
+	m.AuditEntryDropped("kafka")
+	m.ProviderOperationDone("open-store", "success", 2*time.Second)
+	m.ProviderOperationDone("store-exists", "error", time.Second)
+
+	rw := httptest.NewRecorder()
+
+	m.Handler().ServeHTTP(rw, httptest.NewRequest(http.MethodGet, Path, nil))
+
+	require.Equal(t, http.StatusOK, rw.Code)
+	require.Contains(t, rw.Body.String(), "edv_mapping_documents_written_total 3")
+	require.Contains(t, rw.Body.String(), "edv_database_batch_size_sum 10")
+	require.Contains(t, rw.Body.String(), "edv_query_fan_out_sum 5")
+	require.Contains(t, rw.Body.String(), `edv_bulkhead_capacity{pool="query"} 10`)
+	require.Contains(t, rw.Body.String(), `edv_bulkhead_in_flight{pool="query"} 1`)
+	require.Contains(t, rw.Body.String(), `edv_bulkhead_rejected_total{pool="query"} 1`)
+	require.Contains(t, rw.Body.String(), `edv_rate_limited_total{limit="client"} 1`)
+	require.Contains(t, rw.Body.String(), `edv_index_corruption_mapping_documents_total{kind="orphaned",vault="vault1"} 4`)
+	require.Contains(t, rw.Body.String(), `edv_index_corruption_mapping_documents_total{kind="missing",vault="vault1"} 2`)
+	require.Contains(t, rw.Body.String(), `edv_audit_entries_dropped_total{sink="kafka"} 1`)
+	require.Contains(t, rw.Body.String(), `edv_provider_operations_total{operation="open-store",outcome="success"} 1`)
+	require.Contains(t, rw.Body.String(), `edv_provider_operations_total{operation="store-exists",outcome="error"} 1`)
+	require.Contains(t, rw.Body.String(),
+		`edv_provider_operation_duration_seconds_sum{operation="open-store",outcome="success"} 2`)
+	require.Contains(t, rw.Body.String(), "go_goroutines")
+}
+
+func TestOperation(t *testing.T) {
+	tests := []struct {
+		method    string
+		path      string
+		operation string
+	}{
+		{http.MethodPost, "/encrypted-data-vaults", CreateVaultOperation},
+		{http.MethodPost, "/encrypted-data-vaults/vault1/documents", PutOperation},
+		{http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", GetOperation},
+		{http.MethodPost, "/encrypted-data-vaults/vault1/query", QueryOperation},
+		{http.MethodPost, "/encrypted-data-vaults/vault1/documents/doc1", UpdateOperation},
+		{http.MethodDelete, "/encrypted-data-vaults/vault1/documents/doc1", DeleteOperation},
+		{http.MethodGet, "/encrypted-data-vaults", ""},
+		{http.MethodDelete, "/encrypted-data-vaults/vault1", ""},
+		{http.MethodGet, "/encrypted-data-vaults/vault1/query", ""},
+		{http.MethodPut, "/encrypted-data-vaults/vault1/documents/doc1", ""},
+		{http.MethodPost, "/encrypted-data-vaults/vault1/documents/doc1/restore", ""},
+		{http.MethodPost, "/encrypted-data-vaults/vault1/batch", ""},
+		{http.MethodGet, Path, ""},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.operation, Operation(httptest.NewRequest(test.method, test.path, nil)),
+			"%s %s", test.method, test.path)
+	}
+}
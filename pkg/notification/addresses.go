@@ -0,0 +1,92 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package notification
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	dialTimeout         = 30 * time.Second
+	idleConnTimeout     = 90 * time.Second
+	tlsHandshakeTimeout = 10 * time.Second
+	maxIdleConns        = 100
+)
+
+var errRedirect = errors.New("webhooks must not redirect")
+
+// isPrivateAddress returns true if ip is a loopback, private, link-local or unspecified address, which webhooks
+// mustn't be able to reach unless private addresses are allowed. Otherwise, the owner of a vault could use its
+// webhooks to send requests to services on the EDV server's own network, such as cloud metadata endpoints.
+func isPrivateAddress(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified()
+}
+
+// isPrivateHost returns true if the given host of a webhook URL is localhost or a private address. Other host names
+// aren't resolved here, since they could resolve to something else by the time events are delivered; the addresses
+// they resolve to are checked when connecting instead (see newHTTPClient).
+func isPrivateHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && isPrivateAddress(ip)
+}
+
+// newHTTPClient returns the HTTP client that events and alerts are delivered with. It doesn't follow redirects, and
+// unless allowPrivateAddresses is true, it refuses to connect to private addresses, whatever the host name of the
+// webhook resolves to.
+func newHTTPClient(allowPrivateAddresses bool) *http.Client {
+	dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: dialTimeout}
+
+	if !allowPrivateAddresses {
+		dialer.Control = refusePrivateAddresses
+	}
+
+	return &http.Client{
+		// Webhooks are connected to directly rather than through a proxy from the environment, so that the address
+		// that is checked is the webhook's own.
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          maxIdleConns,
+			IdleConnTimeout:       idleConnTimeout,
+			TLSHandshakeTimeout:   tlsHandshakeTimeout,
+			ExpectContinueTimeout: time.Second,
+		},
+		Timeout: defaultDeliveryTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return errRedirect
+		},
+	}
+}
+
+// refusePrivateAddresses is a net.Dialer Control function that fails connections to private addresses.
+func refusePrivateAddresses(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", address, err)
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || isPrivateAddress(ip) {
+		return fmt.Errorf("refusing to connect to private address %s", host)
+	}
+
+	return nil
+}
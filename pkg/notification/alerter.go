@@ -0,0 +1,73 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// Alerter sends index corruption alerts to an operator's webhook, so that they can be paged.
+// Alerts are sent in the background, at most once, with no retries.
+type Alerter struct {
+	endpoint   string
+	secret     string
+	httpClient httpClient
+	deliveries sync.WaitGroup
+}
+
+// NewAlerter returns a new Alerter that sends alerts to the given endpoint. If secret isn't empty, then each alert is
+// signed with it, and the signature is sent in the SignatureHeader the same way as for vault events. Like webhooks,
+// alerts aren't sent to loopback, private or link-local addresses unless allowPrivateAddresses is true.
+func NewAlerter(endpoint, secret string, allowPrivateAddresses bool) *Alerter {
+	return &Alerter{
+		endpoint:   endpoint,
+		secret:     secret,
+		httpClient: newHTTPClient(allowPrivateAddresses),
+	}
+}
+
+// IndexCorruptionDetected sends the given alert to the alerter's endpoint.
+// It returns immediately; the alert is sent in the background.
+func (a *Alerter) IndexCorruptionDetected(alert *models.IndexCorruptionAlert) {
+	alertBytes, err := json.Marshal(alert)
+	if err != nil {
+		logger.Errorf("Failed to marshal index corruption alert for vault %s: %s", alert.VaultID, err)
+
+		return
+	}
+
+	var signature string
+	if a.secret != "" {
+		signature = sign(a.secret, alertBytes)
+	}
+
+	a.deliveries.Add(1)
+
+	go func() {
+		defer a.deliveries.Done()
+
+		err := post(a.httpClient, logger, a.endpoint, alertBytes, signature)
+		if err != nil {
+			logger.Errorf("Failed to send index corruption alert for vault %s to %s: %s",
+				alert.VaultID, a.endpoint, err)
+		}
+	}()
+}
+
+// Wait blocks until all alerts raised so far have been sent (or have failed to be sent).
+func (a *Alerter) Wait() {
+	a.deliveries.Wait()
+}
+
+// Shutdown is like Wait, but gives up once ctx is done, returning its error.
+func (a *Alerter) Shutdown(ctx context.Context) error {
+	return waitContext(ctx, &a.deliveries)
+}
@@ -0,0 +1,94 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestAlerter_IndexCorruptionDetected(t *testing.T) {
+	alert := &models.IndexCorruptionAlert{
+		VaultID:                  testVaultID,
+		OrphanedMappingDocuments: 3,
+		MissingMappingDocuments:  1,
+		Timestamp:                time.Now().UTC(),
+	}
+
+	t.Run("The alert is sent along with its signature", func(t *testing.T) {
+		var (
+			receivedAlert     models.IndexCorruptionAlert
+			receivedSignature string
+			expectedSignature string
+		)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			require.NoError(t, json.Unmarshal(body, &receivedAlert))
+
+			receivedSignature = r.Header.Get(SignatureHeader)
+			expectedSignature = sign("secret", body)
+		}))
+		defer srv.Close()
+
+		alerter := NewAlerter(srv.URL, "secret", true)
+		alerter.IndexCorruptionDetected(alert)
+		alerter.Wait()
+
+		require.Equal(t, alert.VaultID, receivedAlert.VaultID)
+		require.Equal(t, alert.OrphanedMappingDocuments, receivedAlert.OrphanedMappingDocuments)
+		require.Equal(t, alert.MissingMappingDocuments, receivedAlert.MissingMappingDocuments)
+		require.True(t, alert.Timestamp.Equal(receivedAlert.Timestamp))
+		require.Equal(t, expectedSignature, receivedSignature)
+	})
+	t.Run("Alerts aren't signed without a secret", func(t *testing.T) {
+		signed := true
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			signed = r.Header.Get(SignatureHeader) != ""
+		}))
+		defer srv.Close()
+
+		alerter := NewAlerter(srv.URL, "", true)
+		alerter.IndexCorruptionDetected(alert)
+		alerter.Wait()
+
+		require.False(t, signed)
+	})
+	t.Run("Failed deliveries are only logged", func(t *testing.T) {
+		alerter := NewAlerter("https://example.com/alerts", "", false)
+		alerter.httpClient = &failingHTTPClient{}
+
+		alerter.IndexCorruptionDetected(alert)
+		alerter.Wait()
+	})
+	t.Run("Shutdown waits for alerts to be sent", func(t *testing.T) {
+		var sent int32
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&sent, 1)
+		}))
+		defer srv.Close()
+
+		alerter := NewAlerter(srv.URL, "", true)
+		alerter.IndexCorruptionDetected(alert)
+
+		require.NoError(t, alerter.Shutdown(context.Background()))
+		require.Equal(t, int32(1), atomic.LoadInt32(&sent))
+	})
+}
@@ -0,0 +1,267 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/trustbloc/edv/pkg/logging"
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const (
+	// SignatureHeader is the header that the signature of an event is sent in, if the vault's webhooks have a secret.
+	// The signature is "sha256=" followed by the hex-encoded HMAC-SHA256 of the request body, keyed with the secret.
+	SignatureHeader = "EDV-Signature"
+
+	signaturePrefix = "sha256="
+
+	defaultDeliveryTimeout = 10 * time.Second
+)
+
+var logger = logging.New("edv-notification")
+
+type httpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// WebhookSource looks up the webhooks of a vault. It returns nil if the vault doesn't have any, and an error wrapping
+// messages.ErrVaultNotFound if the vault doesn't exist.
+type WebhookSource interface {
+	VaultWebhooks(vaultID string) (*models.VaultWebhooks, error)
+}
+
+// Option configures the notification service.
+type Option func(svc *Service)
+
+// WithHTTPClient sets the HTTP client used to deliver events to webhooks.
+func WithHTTPClient(client httpClient) Option {
+	return func(svc *Service) {
+		svc.httpClient = client
+	}
+}
+
+// WithLogger has the notification service log with the given logger instead of the edge-core logger for its module.
+func WithLogger(logger logging.Logger) Option {
+	return func(svc *Service) {
+		svc.logger = logger
+	}
+}
+
+// WithPrivateAddresses has the notification service deliver events to webhooks on loopback, private and link-local
+// addresses, which it refuses to connect to by default. It doesn't apply if an HTTP client is set with WithHTTPClient.
+func WithPrivateAddresses() Option {
+	return func(svc *Service) {
+		svc.allowPrivateAddresses = true
+	}
+}
+
+// Service delivers vault events to the webhooks in each vault's configuration.
+// Events are delivered in the background, at most once, with no retries.
+type Service struct {
+	webhooks              WebhookSource
+	httpClient            httpClient
+	allowPrivateAddresses bool
+	logger                logging.Logger
+	deliveries            sync.WaitGroup
+}
+
+// New returns a new notification service that looks up the webhooks of vaults using webhooks.
+func New(webhooks WebhookSource, opts ...Option) *Service {
+	svc := &Service{webhooks: webhooks, logger: logger}
+
+	for _, opt := range opts {
+		opt(svc)
+	}
+
+	if svc.httpClient == nil {
+		svc.httpClient = newHTTPClient(svc.allowPrivateAddresses)
+	}
+
+	return svc
+}
+
+// ValidateWebhooks returns an error wrapping messages.ErrInvalidWebhookURL if any of the given webhook endpoints
+// isn't an absolute http or https URL. Unless allowPrivateAddresses is true, it also returns an error wrapping
+// messages.ErrPrivateWebhookAddress if any of them is on localhost or a loopback, private or link-local IP address.
+func ValidateWebhooks(webhooks *models.VaultWebhooks, allowPrivateAddresses bool) error {
+	for _, endpoint := range webhooks.Endpoints {
+		parsedURL, err := url.Parse(endpoint)
+		if err != nil || !parsedURL.IsAbs() || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+			return fmt.Errorf("%w: %q", messages.ErrInvalidWebhookURL, endpoint)
+		}
+
+		if !allowPrivateAddresses && isPrivateHost(parsedURL.Hostname()) {
+			return fmt.Errorf("%w: %q", messages.ErrPrivateWebhookAddress, endpoint)
+		}
+	}
+
+	return nil
+}
+
+// Publish sends the given event to every webhook of the event's vault.
+// It returns immediately; looking up the webhooks and delivering the event happen in the background.
+func (s *Service) Publish(event *models.VaultEvent) {
+	s.deliveries.Add(1)
+
+	go func() {
+		defer s.deliveries.Done()
+
+		s.publish(event)
+	}()
+}
+
+// Wait blocks until all events published so far have been delivered (or have failed to be delivered).
+func (s *Service) Wait() {
+	s.deliveries.Wait()
+}
+
+// Shutdown is like Wait, but gives up once ctx is done, returning its error. Events shouldn't be published once it's
+// been called.
+func (s *Service) Shutdown(ctx context.Context) error {
+	return waitContext(ctx, &s.deliveries)
+}
+
+func (s *Service) publish(event *models.VaultEvent) {
+	err := s.Deliver(event)
+	if err != nil {
+		s.logger.Errorf("Failed to publish %s event for document %s in vault %s: %s",
+			event.Type, event.DocumentID, event.VaultID, err)
+	}
+}
+
+// Deliver sends the given event to every webhook of the event's vault, and waits for the deliveries to finish.
+// An error is returned if the webhooks couldn't be looked up or if the event couldn't be delivered to one or more of
+// them, in which case it may still have been delivered to the others. Events of vaults that no longer exist are
+// dropped.
+func (s *Service) Deliver(event *models.VaultEvent) error {
+	webhooks, err := s.webhooks.VaultWebhooks(event.VaultID)
+	if err != nil {
+		if errors.Is(err, messages.ErrVaultNotFound) {
+			return nil
+		}
+
+		return fmt.Errorf("failed to get webhooks: %w", err)
+	}
+
+	if webhooks == nil || len(webhooks.Endpoints) == 0 {
+		return nil
+	}
+
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	var (
+		wg     sync.WaitGroup
+		failed int32
+	)
+
+	var signature string
+	if webhooks.Secret != "" {
+		signature = sign(webhooks.Secret, eventBytes)
+	}
+
+	for _, endpoint := range webhooks.Endpoints {
+		wg.Add(1)
+
+		go func(endpoint string) {
+			defer wg.Done()
+
+			err := s.deliver(endpoint, eventBytes, signature)
+			if err != nil {
+				s.logger.Warnf("Failed to deliver %s event for document %s in vault %s to webhook %s: %s",
+					event.Type, event.DocumentID, event.VaultID, endpoint, err)
+
+				atomic.AddInt32(&failed, 1)
+			}
+		}(endpoint)
+	}
+
+	wg.Wait()
+
+	if failed > 0 {
+		return fmt.Errorf("failed to deliver event to %d of %d webhooks", failed, len(webhooks.Endpoints))
+	}
+
+	return nil
+}
+
+// waitContext waits for wg, or for ctx to be done, whichever happens first.
+func waitContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Service) deliver(endpoint string, eventBytes []byte, signature string) error {
+	return post(s.httpClient, s.logger, endpoint, eventBytes, signature)
+}
+
+// post sends the given JSON body to the given webhook, along with its signature if it isn't empty.
+func post(client httpClient, logger logging.Logger, endpoint string, body []byte, signature string) error {
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if signature != "" {
+		req.Header.Set(SignatureHeader, signature)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+
+	defer func() {
+		errClose := resp.Body.Close()
+		if errClose != nil {
+			logger.Errorf("Failed to close response body: %s", errClose)
+		}
+	}()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook returned status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// sign returns the value of the SignatureHeader for the given request body.
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body) //nolint: errcheck
+
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
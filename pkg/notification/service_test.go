@@ -0,0 +1,313 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package notification
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const (
+	testVaultID = "Sr7yHjomhn1aeaFnxREfRN"
+	testDocID   = "VJYHHJx4C8J9Fsgz7rZqSp"
+)
+
+var errTest = errors.New("test error")
+
+type failingHTTPClient struct{}
+
+func (f *failingHTTPClient) Do(*http.Request) (*http.Response, error) {
+	return nil, errTest
+}
+
+type mockWebhookSource struct {
+	webhooks map[string]*models.VaultWebhooks
+	err      error
+}
+
+func (m *mockWebhookSource) VaultWebhooks(vaultID string) (*models.VaultWebhooks, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	webhooks, ok := m.webhooks[vaultID]
+	if !ok {
+		return nil, messages.ErrVaultNotFound
+	}
+
+	return webhooks, nil
+}
+
+func newWebhookSource(vaultID string, webhooks *models.VaultWebhooks) *mockWebhookSource {
+	return &mockWebhookSource{webhooks: map[string]*models.VaultWebhooks{vaultID: webhooks}}
+}
+
+func TestValidateWebhooks(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		require.NoError(t, ValidateWebhooks(&models.VaultWebhooks{
+			Endpoints: []string{"https://example.com/webhook", "http://203.0.113.1:8080/webhook"},
+		}, false))
+		require.NoError(t, ValidateWebhooks(&models.VaultWebhooks{}, false))
+	})
+	t.Run("Invalid URL", func(t *testing.T) {
+		for _, invalidURL := range []string{"", "/webhook", "ftp://example.com/webhook", "%"} {
+			err := ValidateWebhooks(&models.VaultWebhooks{
+				Endpoints: []string{"https://example.com/webhook", invalidURL},
+			}, true)
+			require.True(t, errors.Is(err, messages.ErrInvalidWebhookURL), invalidURL)
+		}
+	})
+	t.Run("Private address", func(t *testing.T) {
+		for _, privateURL := range []string{
+			"http://localhost:8080/webhook", "http://api.localhost./webhook", "http://127.0.0.1/webhook",
+			"http://10.1.2.3/webhook", "http://192.168.0.1/webhook", "http://169.254.169.254/latest/meta-data",
+			"http://[::1]/webhook", "http://[fd00::1]/webhook", "http://0.0.0.0/webhook",
+		} {
+			webhooks := &models.VaultWebhooks{Endpoints: []string{"https://example.com/webhook", privateURL}}
+
+			err := ValidateWebhooks(webhooks, false)
+			require.True(t, errors.Is(err, messages.ErrPrivateWebhookAddress), privateURL)
+
+			require.NoError(t, ValidateWebhooks(webhooks, true), privateURL)
+		}
+	})
+}
+
+func TestService_Publish(t *testing.T) {
+	t.Run("Event is delivered to every webhook of the vault", func(t *testing.T) {
+		receivedEvents := make(chan models.VaultEvent, 2)
+
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			require.Equal(t, http.MethodPost, req.Method)
+			require.Equal(t, "application/json", req.Header.Get("Content-Type"))
+			require.Empty(t, req.Header.Get(SignatureHeader))
+
+			body, err := ioutil.ReadAll(req.Body)
+			require.NoError(t, err)
+
+			var event models.VaultEvent
+
+			require.NoError(t, json.Unmarshal(body, &event))
+
+			receivedEvents <- event
+		}))
+		defer server.Close()
+
+		webhooks := newWebhookSource(testVaultID, &models.VaultWebhooks{
+			Endpoints: []string{server.URL + "/webhook1", server.URL + "/webhook2"},
+		})
+		webhooks.webhooks["AnotherVault"] = &models.VaultWebhooks{Endpoints: []string{server.URL + "/webhook3"}}
+
+		svc := New(webhooks, WithPrivateAddresses())
+
+		timestamp := time.Now().UTC().Truncate(time.Second)
+
+		svc.Publish(&models.VaultEvent{
+			VaultID: testVaultID, DocumentID: testDocID, Sequence: 1,
+			Type: models.DocumentUpdatedVaultEvent, Timestamp: timestamp,
+		})
+		svc.Wait()
+
+		close(receivedEvents)
+
+		var events []models.VaultEvent
+		for event := range receivedEvents {
+			events = append(events, event)
+		}
+
+		require.Len(t, events, 2)
+
+		for _, event := range events {
+			require.Equal(t, testVaultID, event.VaultID)
+			require.Equal(t, testDocID, event.DocumentID)
+			require.Equal(t, uint64(1), event.Sequence)
+			require.Equal(t, models.DocumentUpdatedVaultEvent, event.Type)
+			require.True(t, timestamp.Equal(event.Timestamp))
+		}
+	})
+	t.Run("Events are signed with the secret of the webhooks", func(t *testing.T) {
+		signatures := make(chan string, 1)
+
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			body, err := ioutil.ReadAll(req.Body)
+			require.NoError(t, err)
+
+			mac := hmac.New(sha256.New, []byte("secret"))
+			_, err = mac.Write(body)
+			require.NoError(t, err)
+
+			require.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), req.Header.Get(SignatureHeader))
+
+			signatures <- req.Header.Get(SignatureHeader)
+		}))
+		defer server.Close()
+
+		svc := New(newWebhookSource(testVaultID, &models.VaultWebhooks{
+			Endpoints: []string{server.URL}, Secret: "secret",
+		}), WithPrivateAddresses())
+
+		svc.Publish(&models.VaultEvent{VaultID: testVaultID, DocumentID: testDocID})
+		svc.Wait()
+
+		require.Len(t, signatures, 1)
+	})
+	t.Run("Delivery failures don't affect other webhooks", func(t *testing.T) {
+		receivedEvents := make(chan models.VaultEvent, 1)
+
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/failing" {
+				rw.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			var event models.VaultEvent
+
+			require.NoError(t, json.NewDecoder(req.Body).Decode(&event))
+
+			receivedEvents <- event
+		}))
+		defer server.Close()
+
+		svc := New(newWebhookSource(testVaultID, &models.VaultWebhooks{
+			Endpoints: []string{server.URL + "/failing", server.URL + "/working"},
+		}), WithPrivateAddresses())
+
+		svc.Publish(&models.VaultEvent{
+			VaultID: testVaultID, DocumentID: testDocID, Type: models.DocumentDeletedVaultEvent,
+		})
+		svc.Wait()
+
+		require.Len(t, receivedEvents, 1)
+		require.Equal(t, models.DocumentDeletedVaultEvent, (<-receivedEvents).Type)
+	})
+	t.Run("HTTP client error", func(t *testing.T) {
+		svc := New(newWebhookSource(testVaultID, &models.VaultWebhooks{
+			Endpoints: []string{"https://example.com/webhook"},
+		}), WithHTTPClient(&failingHTTPClient{}))
+
+		svc.Publish(&models.VaultEvent{VaultID: testVaultID, DocumentID: testDocID})
+		svc.Wait()
+	})
+	t.Run("Fail to get webhooks", func(t *testing.T) {
+		svc := New(&mockWebhookSource{err: errTest}, WithHTTPClient(&failingHTTPClient{}))
+
+		svc.Publish(&models.VaultEvent{VaultID: testVaultID, DocumentID: testDocID})
+		svc.Wait()
+	})
+}
+
+func TestService_Shutdown(t *testing.T) {
+	unblock := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		<-unblock
+	}))
+	defer server.Close()
+
+	svc := New(newWebhookSource(testVaultID, &models.VaultWebhooks{Endpoints: []string{server.URL}}),
+		WithPrivateAddresses())
+
+	svc.Publish(&models.VaultEvent{VaultID: testVaultID, DocumentID: testDocID, Type: models.DocumentCreatedVaultEvent})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	require.Equal(t, context.Canceled, svc.Shutdown(ctx))
+
+	close(unblock)
+
+	require.NoError(t, svc.Shutdown(context.Background()))
+}
+
+func TestService_Deliver(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		var received int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			atomic.AddInt32(&received, 1)
+		}))
+		defer server.Close()
+
+		svc := New(newWebhookSource(testVaultID, &models.VaultWebhooks{
+			Endpoints: []string{server.URL + "/webhook1", server.URL + "/webhook2"},
+		}), WithPrivateAddresses())
+
+		require.NoError(t, svc.Deliver(&models.VaultEvent{VaultID: testVaultID, DocumentID: testDocID}))
+		require.Equal(t, int32(2), atomic.LoadInt32(&received))
+	})
+	t.Run("No webhooks", func(t *testing.T) {
+		svc := New(newWebhookSource(testVaultID, nil), WithHTTPClient(&failingHTTPClient{}))
+
+		require.NoError(t, svc.Deliver(&models.VaultEvent{VaultID: testVaultID, DocumentID: testDocID}))
+	})
+	t.Run("Vault no longer exists", func(t *testing.T) {
+		svc := New(&mockWebhookSource{}, WithHTTPClient(&failingHTTPClient{}))
+
+		require.NoError(t, svc.Deliver(&models.VaultEvent{VaultID: testVaultID, DocumentID: testDocID}))
+	})
+	t.Run("Delivery failure", func(t *testing.T) {
+		svc := New(newWebhookSource(testVaultID, &models.VaultWebhooks{
+			Endpoints: []string{"https://example.com/webhook"},
+		}), WithHTTPClient(&failingHTTPClient{}))
+
+		err := svc.Deliver(&models.VaultEvent{VaultID: testVaultID, DocumentID: testDocID})
+		require.EqualError(t, err, "failed to deliver event to 1 of 1 webhooks")
+	})
+	t.Run("Private addresses are refused by default", func(t *testing.T) {
+		var received int32
+
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			atomic.AddInt32(&received, 1)
+		}))
+		defer server.Close()
+
+		svc := New(newWebhookSource(testVaultID, &models.VaultWebhooks{Endpoints: []string{server.URL}}))
+
+		err := svc.Deliver(&models.VaultEvent{VaultID: testVaultID, DocumentID: testDocID})
+		require.EqualError(t, err, "failed to deliver event to 1 of 1 webhooks")
+		require.Zero(t, atomic.LoadInt32(&received))
+	})
+	t.Run("Redirects aren't followed", func(t *testing.T) {
+		var redirected int32
+
+		target := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			atomic.AddInt32(&redirected, 1)
+		}))
+		defer target.Close()
+
+		server := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+		defer server.Close()
+
+		svc := New(newWebhookSource(testVaultID, &models.VaultWebhooks{Endpoints: []string{server.URL}}),
+			WithPrivateAddresses())
+
+		err := svc.Deliver(&models.VaultEvent{VaultID: testVaultID, DocumentID: testDocID})
+		require.EqualError(t, err, "failed to deliver event to 1 of 1 webhooks")
+		require.Zero(t, atomic.LoadInt32(&redirected))
+	})
+	t.Run("Fail to get webhooks", func(t *testing.T) {
+		svc := New(&mockWebhookSource{err: errTest})
+
+		err := svc.Deliver(&models.VaultEvent{VaultID: testVaultID, DocumentID: testDocID})
+		require.EqualError(t, err, "failed to get webhooks: test error")
+	})
+}
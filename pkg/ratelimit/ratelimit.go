@@ -0,0 +1,360 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package ratelimit limits the rate of requests to vaults that the EDV server handles, both per client and per vault.
+// Each client and each vault gets a token bucket: requests take a token from it, tokens are added back at a fixed
+// rate, and requests that find the bucket empty are rejected with a 429 status code. This keeps a single misbehaving
+// client, or a flood of writes to a single vault, from saturating the database.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/bulkhead"
+	"github.com/trustbloc/edv/pkg/logging"
+)
+
+// The limits that requests can be rejected by.
+const (
+	// ClientLimit is the limit on the requests made by each client.
+	ClientLimit = "client"
+	// VaultWriteLimit is the limit on the writes to each vault.
+	VaultWriteLimit = "vault_write"
+)
+
+const (
+	logModuleName = "ratelimit"
+
+	// sweepInterval is how often the buckets that have filled back up are removed, so that the clients and vaults
+	// that stopped making requests don't take up memory.
+	sweepInterval = time.Minute
+
+	// rateLimited is the body of the response to requests that are rejected because their bucket is empty.
+	rateLimited = "too many requests: at most %d %s requests per second are allowed"
+
+	// The headers that tell clients about their quota under the client limit, so that they can pace themselves.
+	// They follow the IETF draft for RateLimit header fields.
+	limitHeader     = "RateLimit-Limit"
+	remainingHeader = "RateLimit-Remaining"
+	resetHeader     = "RateLimit-Reset"
+)
+
+// Limits defines the rates at which requests are allowed. Any rate that is set to 0 is not enforced.
+// A burst is the number of requests that are allowed at once after a quiet period. If it's 0, then it's the same as
+// the rate.
+type Limits struct {
+	// ClientRate is the number of requests to vaults per second allowed for each client. Clients are identified by
+	// the actor of their requests (see auth.Actor), such as the invoker of their capability, or by their IP address
+	// if the request wasn't authorized.
+	ClientRate  uint
+	ClientBurst uint
+	// VaultWriteRate is the number of writes per second allowed to each vault, whichever clients they're from.
+	VaultWriteRate  uint
+	VaultWriteBurst uint
+}
+
+// Metrics records the requests rejected by the rate limiter. Its methods are called concurrently.
+type Metrics interface {
+	// RateLimited is called for each request rejected by the given limit.
+	RateLimited(limit string)
+}
+
+// Option configures the rate limiter.
+type Option func(l *Limiter)
+
+// WithMetrics has the rate limiter record the requests that it rejects with the given metrics.
+func WithMetrics(metrics Metrics) Option {
+	return func(l *Limiter) {
+		l.metrics = metrics
+	}
+}
+
+// WithLogger has the rate limiter log with the given logger instead of the edge-core logger for its module.
+func WithLogger(logger logging.Logger) Option {
+	return func(l *Limiter) {
+		l.logger = logger
+	}
+}
+
+// Limiter limits the rate of requests to vaults.
+type Limiter struct {
+	client     *buckets
+	vaultWrite *buckets
+	metrics    Metrics
+	logger     logging.Logger
+	now        func() time.Time
+}
+
+// New returns a new rate limiter with the given limits.
+func New(limits Limits, opts ...Option) *Limiter {
+	l := &Limiter{now: time.Now}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	if l.logger == nil {
+		l.logger = logging.New(logModuleName)
+	}
+
+	if limits.ClientRate > 0 {
+		l.client = newBuckets(limits.ClientRate, limits.ClientBurst)
+	}
+
+	if limits.VaultWriteRate > 0 {
+		l.vaultWrite = newBuckets(limits.VaultWriteRate, limits.VaultWriteBurst)
+	}
+
+	return l
+}
+
+// Middleware returns a handler that passes requests to next if their client's bucket, and for writes their vault's
+// bucket, have a token left, and otherwise rejects them with a 429 status code and a Retry-After header with the
+// number of seconds until the bucket has a token again.
+// If the client limit is enforced, then the responses to requests to vaults include the client's quota: the
+// RateLimit-Limit header has the client's burst, RateLimit-Remaining the number of requests that it can make right
+// away, and RateLimit-Reset the number of seconds until its bucket is full again.
+// Requests that aren't for a vault aren't limited.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pool := bulkhead.Pool(r)
+		if pool == "" || l.allow(w, r, pool) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// allow takes a token from the buckets of the given request to a vault, and returns whether it's allowed. If it
+// isn't, then it rejects it.
+func (l *Limiter) allow(w http.ResponseWriter, r *http.Request, pool string) bool {
+	now := l.now()
+
+	if l.client != nil {
+		q := l.client.take(clientKey(r), now)
+
+		w.Header().Set(limitHeader, strconv.Itoa(int(l.client.burst)))
+		w.Header().Set(remainingHeader, strconv.Itoa(int(q.remaining)))
+		w.Header().Set(resetHeader, seconds(q.reset))
+
+		if !q.allowed {
+			l.reject(w, r, ClientLimit, l.client, q)
+
+			return false
+		}
+	}
+
+	if vaultID := vaultID(r); l.vaultWrite != nil && pool == bulkhead.WritePool && vaultID != "" {
+		if q := l.vaultWrite.take(vaultID, now); !q.allowed {
+			l.reject(w, r, VaultWriteLimit, l.vaultWrite, q)
+
+			return false
+		}
+	}
+
+	return true
+}
+
+// Rejection returns the body of the response that another request like r, from the same client to the same vault,
+// would be rejected with right now, or an empty string if it would be allowed. No tokens are taken.
+func (l *Limiter) Rejection(r *http.Request) string {
+	pool := bulkhead.Pool(r)
+	if pool == "" {
+		return ""
+	}
+
+	now := l.now()
+
+	if l.client != nil && !l.client.available(clientKey(r), now) {
+		return rejection(ClientLimit, l.client)
+	}
+
+	if vaultID := vaultID(r); l.vaultWrite != nil && pool == bulkhead.WritePool && vaultID != "" &&
+		!l.vaultWrite.available(vaultID, now) {
+		return rejection(VaultWriteLimit, l.vaultWrite)
+	}
+
+	return ""
+}
+
+func (l *Limiter) reject(w http.ResponseWriter, r *http.Request, limit string, b *buckets, q quota) {
+	logger := logging.FromContext(r.Context(), l.logger)
+
+	logger.Warnf("Rejected %s request to %s since it went over the %s rate limit", r.Method, r.URL.Path, limit)
+
+	if l.metrics != nil {
+		l.metrics.RateLimited(limit)
+	}
+
+	w.Header().Set("Retry-After", seconds(q.retryAfter))
+	w.WriteHeader(http.StatusTooManyRequests)
+
+	_, err := w.Write([]byte(rejection(limit, b)))
+	if err != nil {
+		logger.Errorf("Failed to write response: %s", err)
+	}
+}
+
+// rejection returns the body of the response to requests rejected by the given limit.
+func rejection(limit string, b *buckets) string {
+	return fmt.Sprintf(rateLimited, uint(b.rate), strings.ReplaceAll(limit, "_", " "))
+}
+
+// clientKey returns the key of the bucket of the client that made the request: its actor if it was authorized, and
+// otherwise its IP address.
+func clientKey(r *http.Request) string {
+	if actor := auth.Actor(r.Context()); actor != "" {
+		return "actor:" + actor
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+// seconds returns the given duration as a whole number of seconds, rounded up so that clients that wait that long
+// aren't early.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// vaultID returns the ID of the vault that the request is for, or an empty string if it isn't for a specific vault.
+func vaultID(r *http.Request) string {
+	segments := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	if len(segments) < 2 {
+		return ""
+	}
+
+	return segments[1]
+}
+
+// buckets are the token buckets of a limit, by key.
+type buckets struct {
+	// rate is the number of tokens added to each bucket per second.
+	rate float64
+	// burst is the number of tokens that each bucket can hold.
+	burst float64
+
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// quota is the state of a bucket after a request took a token from it, or found it empty.
+type quota struct {
+	// allowed is whether the request got a token.
+	allowed bool
+	// remaining is the number of whole tokens left in the bucket.
+	remaining uint
+	// retryAfter is how long until the bucket has a token again. It's 0 if it has one now.
+	retryAfter time.Duration
+	// reset is how long until the bucket is full again.
+	reset time.Duration
+}
+
+type bucket struct {
+	tokens float64
+	// updated is when tokens was last brought up to date.
+	updated time.Time
+}
+
+func newBuckets(rate, burst uint) *buckets {
+	if burst == 0 {
+		burst = rate
+	}
+
+	return &buckets{rate: float64(rate), burst: float64(burst), buckets: make(map[string]*bucket)}
+}
+
+// take takes a token from the bucket with the given key, creating it full if there isn't one, and returns the
+// bucket's quota. The request isn't allowed if the bucket is empty.
+func (b *buckets) take(key string, now time.Time) quota {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.sweep(now)
+
+	bkt, ok := b.buckets[key]
+	if !ok {
+		bkt = &bucket{tokens: b.burst, updated: now}
+		b.buckets[key] = bkt
+	}
+
+	b.refill(bkt, now)
+
+	allowed := bkt.tokens >= 1
+	if allowed {
+		bkt.tokens--
+	}
+
+	q := quota{
+		allowed:   allowed,
+		remaining: uint(bkt.tokens),
+		reset:     b.duration(b.burst - bkt.tokens),
+	}
+
+	if bkt.tokens < 1 {
+		q.retryAfter = b.duration(1 - bkt.tokens)
+	}
+
+	return q
+}
+
+// available returns whether the bucket with the given key has a token, without taking it. A key without a bucket has
+// a full one.
+func (b *buckets) available(key string, now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	bkt, ok := b.buckets[key]
+	if !ok {
+		return true
+	}
+
+	b.refill(bkt, now)
+
+	return bkt.tokens >= 1
+}
+
+// duration returns how long it takes to add the given number of tokens to a bucket.
+func (b *buckets) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / b.rate * float64(time.Second))
+}
+
+func (b *buckets) refill(bkt *bucket, now time.Time) {
+	if now.After(bkt.updated) {
+		bkt.tokens = math.Min(b.burst, bkt.tokens+now.Sub(bkt.updated).Seconds()*b.rate)
+		bkt.updated = now
+	}
+}
+
+// sweep removes the buckets that have filled back up, at most once per sweepInterval. A full bucket is the same as
+// no bucket, so this doesn't change which requests are allowed.
+func (b *buckets) sweep(now time.Time) {
+	if now.Sub(b.lastSweep) < sweepInterval {
+		return
+	}
+
+	b.lastSweep = now
+
+	for key, bkt := range b.buckets {
+		b.refill(bkt, now)
+
+		if bkt.tokens >= b.burst {
+			delete(b.buckets, key)
+		}
+	}
+}
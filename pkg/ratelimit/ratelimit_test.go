@@ -0,0 +1,284 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/logging"
+)
+
+func TestLimiter_Middleware(t *testing.T) {
+	t.Run("Each client has its own bucket", func(t *testing.T) {
+		metrics := &mockMetrics{}
+		limiter := New(Limits{ClientRate: 1, ClientBurst: 2}, WithMetrics(metrics))
+		clock := &mockClock{now: time.Now()}
+		limiter.now = clock.Now
+
+		handler := limiter.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+		requireCodes(t, handler, newRequest(http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", "alice"),
+			http.StatusOK, http.StatusOK, http.StatusTooManyRequests)
+
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, newRequest(http.MethodPost, "/encrypted-data-vaults/vault1/query", "alice"))
+		require.Equal(t, http.StatusTooManyRequests, rw.Code)
+		require.Equal(t, "1", rw.Header().Get("Retry-After"))
+		require.Equal(t, "too many requests: at most 1 client requests per second are allowed", rw.Body.String())
+
+		// Other clients, including unauthorized ones, aren't affected.
+		requireCodes(t, handler, newRequest(http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", "bob"),
+			http.StatusOK)
+		requireCodes(t, handler, newRequest(http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", ""),
+			http.StatusOK, http.StatusOK, http.StatusTooManyRequests)
+
+		// Requests that aren't for a vault aren't limited.
+		requireCodes(t, handler, newRequest(http.MethodGet, "/healthcheck", "alice"), http.StatusOK)
+
+		clock.now = clock.now.Add(time.Second)
+
+		requireCodes(t, handler, newRequest(http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", "alice"),
+			http.StatusOK, http.StatusTooManyRequests)
+
+		require.Equal(t, map[string]int{ClientLimit: 4}, metrics.rejected)
+	})
+	t.Run("Writes to each vault are throttled", func(t *testing.T) {
+		metrics := &mockMetrics{}
+		limiter := New(Limits{VaultWriteRate: 1}, WithMetrics(metrics))
+		clock := &mockClock{now: time.Now()}
+		limiter.now = clock.Now
+
+		handler := limiter.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+		requireCodes(t, handler, newRequest(http.MethodPost, "/encrypted-data-vaults/vault1/documents", "alice"),
+			http.StatusOK)
+		requireCodes(t, handler, newRequest(http.MethodPost, "/encrypted-data-vaults/vault1/documents", "bob"),
+			http.StatusTooManyRequests)
+
+		// Reads, writes to other vaults and vault creation aren't affected.
+		requireCodes(t, handler, newRequest(http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", "bob"),
+			http.StatusOK)
+		requireCodes(t, handler, newRequest(http.MethodDelete, "/encrypted-data-vaults/vault2/documents/doc1", "bob"),
+			http.StatusOK)
+		requireCodes(t, handler, newRequest(http.MethodPost, "/encrypted-data-vaults", "bob"),
+			http.StatusOK, http.StatusOK)
+
+		clock.now = clock.now.Add(time.Second)
+
+		requireCodes(t, handler, newRequest(http.MethodPost, "/encrypted-data-vaults/vault1/documents", "bob"),
+			http.StatusOK)
+
+		require.Equal(t, map[string]int{VaultWriteLimit: 1}, metrics.rejected)
+	})
+	t.Run("Responses include the client's quota", func(t *testing.T) {
+		limiter := New(Limits{ClientRate: 2, ClientBurst: 4, VaultWriteRate: 1})
+		clock := &mockClock{now: time.Now()}
+		limiter.now = clock.Now
+
+		handler := limiter.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+		req := newRequest(http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", "alice")
+
+		requireQuota(t, handler, req, http.StatusOK, "3", "1")
+
+		requireCodes(t, handler, req, http.StatusOK, http.StatusOK)
+
+		requireQuota(t, handler, req, http.StatusOK, "0", "2")
+
+		rw := requireQuota(t, handler, req, http.StatusTooManyRequests, "0", "2")
+		require.Equal(t, "1", rw.Header().Get("Retry-After"))
+
+		// Half a token has been added back, so the rest of it takes another quarter of a second.
+		clock.now = clock.now.Add(time.Second / 4)
+
+		rw = requireQuota(t, handler, req, http.StatusTooManyRequests, "0", "2")
+		require.Equal(t, "1", rw.Header().Get("Retry-After"))
+
+		clock.now = clock.now.Add(time.Second / 4)
+
+		requireQuota(t, handler, req, http.StatusOK, "0", "2")
+
+		clock.now = clock.now.Add(2 * time.Second)
+
+		requireQuota(t, handler, req, http.StatusOK, "3", "1")
+
+		// Requests rejected by the vault's limit include the client's quota too.
+		req = newRequest(http.MethodPost, "/encrypted-data-vaults/vault1/documents", "alice")
+
+		requireQuota(t, handler, req, http.StatusOK, "2", "1")
+
+		rw = requireQuota(t, handler, req, http.StatusTooManyRequests, "1", "2")
+		require.Equal(t, "1", rw.Header().Get("Retry-After"))
+
+		// Requests that aren't for a vault don't have a quota.
+		rw = httptest.NewRecorder()
+		handler.ServeHTTP(rw, newRequest(http.MethodGet, "/healthcheck", "alice"))
+		require.Empty(t, rw.Header().Get(limitHeader))
+	})
+	t.Run("No limits", func(t *testing.T) {
+		handler := New(Limits{}).Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+		requireCodes(t, handler, newRequest(http.MethodPost, "/encrypted-data-vaults/vault1/documents", "alice"),
+			http.StatusOK, http.StatusOK)
+
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, newRequest(http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", "alice"))
+		require.Empty(t, rw.Header().Get(limitHeader))
+	})
+	t.Run("Rejections are logged with the request's correlation ID", func(t *testing.T) {
+		logger := &recordingLogger{}
+		handler := New(Limits{ClientRate: 1}, WithLogger(logger)).Middleware(
+			http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+		req := newRequest(http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", "alice")
+		req = req.WithContext(logging.NewContext(req.Context(), "correlation-1"))
+
+		requireCodes(t, handler, req, http.StatusOK, http.StatusTooManyRequests)
+		require.Equal(t, []string{"[correlationID=correlation-1] Rejected GET request to " +
+			"/encrypted-data-vaults/vault1/documents/doc1 since it went over the client rate limit"}, logger.lines)
+	})
+}
+
+func TestLimiter_Rejection(t *testing.T) {
+	limiter := New(Limits{ClientRate: 1, ClientBurst: 2, VaultWriteRate: 1})
+	clock := &mockClock{now: time.Now()}
+	limiter.now = clock.Now
+
+	handler := limiter.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	write := newRequest(http.MethodPost, "/encrypted-data-vaults/vault1/batch/capacity", "alice")
+	read := newRequest(http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", "alice")
+
+	require.Empty(t, limiter.Rejection(write))
+	requireCodes(t, handler, write, http.StatusOK)
+
+	require.Equal(t, "too many requests: at most 1 vault write requests per second are allowed",
+		limiter.Rejection(write))
+	require.Empty(t, limiter.Rejection(read))
+
+	// Checking doesn't take a token.
+	require.Empty(t, limiter.Rejection(read))
+	requireCodes(t, handler, read, http.StatusOK)
+
+	require.Equal(t, "too many requests: at most 1 client requests per second are allowed", limiter.Rejection(read))
+	require.Empty(t, limiter.Rejection(newRequest(http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1",
+		"bob")))
+	require.Empty(t, limiter.Rejection(newRequest(http.MethodGet, "/healthcheck", "alice")))
+
+	clock.now = clock.now.Add(time.Second)
+
+	require.Empty(t, limiter.Rejection(write))
+}
+
+func TestBuckets_Take(t *testing.T) {
+	b := newBuckets(4, 8)
+	now := time.Now()
+
+	for i := 0; i < 8; i++ {
+		require.True(t, b.take("alice", now).allowed)
+	}
+
+	q := b.take("alice", now)
+	require.Equal(t, quota{allowed: false, remaining: 0, retryAfter: time.Second / 4, reset: 2 * time.Second}, q)
+
+	q = b.take("alice", now.Add(time.Second/8))
+	require.Equal(t, quota{allowed: false, remaining: 0, retryAfter: time.Second / 8, reset: 15 * time.Second / 8}, q)
+
+	q = b.take("alice", now.Add(time.Second))
+	require.Equal(t, quota{allowed: true, remaining: 3, retryAfter: 0, reset: 5 * time.Second / 4}, q)
+}
+
+func TestBuckets_Sweep(t *testing.T) {
+	b := newBuckets(1, 1)
+	now := time.Now()
+
+	require.True(t, b.take("alice", now).allowed)
+	require.True(t, b.take("bob", now.Add(sweepInterval-time.Second/2)).allowed)
+	require.Len(t, b.buckets, 2)
+
+	// Alice's bucket has filled back up, but Bob's hasn't.
+	require.True(t, b.take("carol", now.Add(sweepInterval)).allowed)
+	require.Len(t, b.buckets, 2)
+	require.Contains(t, b.buckets, "bob")
+	require.Contains(t, b.buckets, "carol")
+}
+
+func newRequest(method, path, actor string) *http.Request {
+	req := httptest.NewRequest(method, path, nil)
+
+	if actor != "" {
+		req = req.WithContext(auth.WithActor(req.Context(), actor))
+	}
+
+	return req
+}
+
+func requireCodes(t *testing.T, handler http.Handler, req *http.Request, codes ...int) {
+	t.Helper()
+
+	for _, code := range codes {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+		require.Equal(t, code, rw.Code, "%s %s", req.Method, req.URL.Path)
+	}
+}
+
+func requireQuota(t *testing.T, handler http.Handler, req *http.Request, code int,
+	remaining, reset string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, req)
+	require.Equal(t, code, rw.Code)
+	require.Equal(t, "4", rw.Header().Get(limitHeader))
+	require.Equal(t, remaining, rw.Header().Get(remainingHeader))
+	require.Equal(t, reset, rw.Header().Get(resetHeader))
+
+	return rw
+}
+
+type mockClock struct {
+	now time.Time
+}
+
+func (c *mockClock) Now() time.Time {
+	return c.now
+}
+
+type mockMetrics struct {
+	rejected map[string]int
+}
+
+func (m *mockMetrics) RateLimited(limit string) {
+	if m.rejected == nil {
+		m.rejected = make(map[string]int)
+	}
+
+	m.rejected[limit]++
+}
+
+// recordingLogger records the lines that it logs.
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) log(msg string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(msg, args...))
+}
+
+func (l *recordingLogger) Panicf(msg string, args ...interface{}) { l.log(msg, args...) }
+func (l *recordingLogger) Fatalf(msg string, args ...interface{}) { l.log(msg, args...) }
+func (l *recordingLogger) Errorf(msg string, args ...interface{}) { l.log(msg, args...) }
+func (l *recordingLogger) Warnf(msg string, args ...interface{})  { l.log(msg, args...) }
+func (l *recordingLogger) Infof(msg string, args ...interface{})  { l.log(msg, args...) }
+func (l *recordingLogger) Debugf(msg string, args ...interface{}) { l.log(msg, args...) }
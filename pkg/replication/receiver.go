@@ -0,0 +1,179 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package replication
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	ariesstorage "github.com/hyperledger/aries-framework-go/spi/storage"
+
+	"github.com/trustbloc/edv/pkg/edvprovider"
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+type capabilityImporter interface {
+	ImportCapabilities(resourceID string, capabilities []json.RawMessage) error
+}
+
+// Receiver applies the replication batches sent by a Replicator on another EDV server.
+type Receiver struct {
+	provider           *edvprovider.Provider
+	capabilityImporter capabilityImporter
+}
+
+// NewReceiver returns a new receiver that stores replicated vaults in provider and replicated zcaps using
+// capabilityImporter. If capabilityImporter is nil, then replicated zcaps are discarded.
+func NewReceiver(provider *edvprovider.Provider, capabilityImporter capabilityImporter) *Receiver {
+	return &Receiver{provider: provider, capabilityImporter: capabilityImporter}
+}
+
+// Apply stores the contents of a replication batch in the given vault. If the vault doesn't exist yet, then it's
+// created using the configuration in the batch. Receiving the same batch more than once has no further effect.
+func (r *Receiver) Apply(vaultID string, batch *models.ReplicationBatch) error {
+	err := r.createVaultIfMissing(vaultID, batch.Configuration)
+	if err != nil {
+		return err
+	}
+
+	if r.capabilityImporter != nil && len(batch.Capabilities) > 0 {
+		err = r.capabilityImporter.ImportCapabilities(vaultID, batch.Capabilities)
+		if err != nil {
+			return fmt.Errorf("failed to import capabilities: %w", err)
+		}
+	}
+
+	store, err := r.provider.OpenStore(vaultID)
+	if err != nil {
+		return fmt.Errorf("failed to open store for vault: %w", err)
+	}
+
+	for i := range batch.Documents {
+		err = store.ImportDocument(&batch.Documents[i])
+		if err != nil {
+			return fmt.Errorf("failed to import document: %w", err)
+		}
+	}
+
+	err = applyDeletions(vaultID, store, batch)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("Applied replication batch to vault %s: %d documents stored, %d documents deleted",
+		vaultID, len(batch.Documents), len(batch.DeletedDocuments)+len(unstubbedDeletions(batch)))
+
+	return nil
+}
+
+// applyDeletions deletes the documents in the batch's deletion stubs, along with the deleted documents that were only
+// sent by ID.
+func applyDeletions(vaultID string, store *edvprovider.Store, batch *models.ReplicationBatch) error {
+	for i := range batch.DeletedDocuments {
+		err := applyDeletionStub(vaultID, store, &batch.DeletedDocuments[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, docID := range unstubbedDeletions(batch) {
+		err := store.Delete(docID)
+		if err != nil && !errors.Is(err, ariesstorage.ErrDataNotFound) {
+			return fmt.Errorf("failed to delete document %s: %w", docID, err)
+		}
+	}
+
+	return nil
+}
+
+// applyDeletionStub deletes the document in a deletion stub, unless the stored document is newer than the one that
+// was deleted.
+func applyDeletionStub(vaultID string, store *edvprovider.Store, stub *models.Tombstone) error {
+	sequence, err := store.Sequence(stub.ID)
+	if errors.Is(err, messages.ErrDocumentNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to get sequence of document %s: %w", stub.ID, err)
+	}
+
+	if sequence > stub.Sequence {
+		logger.Warnf("Not deleting document %s in vault %s: its sequence %d is newer than the deleted sequence %d",
+			stub.ID, vaultID, sequence, stub.Sequence)
+
+		return nil
+	}
+
+	err = store.DeleteIfSequenceMatches(stub.ID, sequence)
+	if err != nil && !errors.Is(err, messages.ErrDocumentNotFound) && !errors.Is(err, ariesstorage.ErrDataNotFound) {
+		return fmt.Errorf("failed to delete document %s: %w", stub.ID, err)
+	}
+
+	return nil
+}
+
+// unstubbedDeletions returns the IDs of the deleted documents in the batch that don't have a deletion stub, as sent by
+// EDV servers that don't send stubs.
+func unstubbedDeletions(batch *models.ReplicationBatch) []string {
+	stubbed := make(map[string]struct{}, len(batch.DeletedDocuments))
+
+	for _, stub := range batch.DeletedDocuments {
+		stubbed[stub.ID] = struct{}{}
+	}
+
+	var docIDs []string
+
+	for _, docID := range batch.DeletedDocumentIDs {
+		if _, ok := stubbed[docID]; !ok {
+			docIDs = append(docIDs, docID)
+		}
+	}
+
+	return docIDs
+}
+
+func (r *Receiver) createVaultIfMissing(vaultID string, config *models.DataVaultConfiguration) error {
+	exists, err := r.provider.StoreExists(vaultID)
+	if err != nil {
+		return fmt.Errorf("failed to determine whether vault exists: %w", err)
+	}
+
+	if exists {
+		return nil
+	}
+
+	if config == nil {
+		return messages.ErrVaultNotFound
+	}
+
+	configStore, err := r.provider.OpenStore(edvprovider.VaultConfigurationStoreName)
+	if err != nil {
+		return fmt.Errorf("failed to open store for vault configurations: %w", err)
+	}
+
+	// The configuration may already be stored if a previous attempt failed to create the vault's store.
+	_, err = configStore.Get(vaultID)
+	if errors.Is(err, ariesstorage.ErrDataNotFound) {
+		err = configStore.StoreDataVaultConfiguration(config, vaultID)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to store data vault configuration: %w", err)
+	}
+
+	err = r.provider.CreateVaultStore(vaultID)
+	if err != nil {
+		return fmt.Errorf("failed to create vault: %w", err)
+	}
+
+	logger.Infof("Created replicated vault %s", vaultID)
+
+	return nil
+}
@@ -0,0 +1,125 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package replication
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/edvprovider"
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestReceiver_Apply(t *testing.T) {
+	t.Run("Creates the vault from the configuration in the batch", func(t *testing.T) {
+		provider := newTestProvider(t)
+		capabilities := &mockCapabilities{}
+
+		err := NewReceiver(provider, capabilities).Apply(testVaultID, &models.ReplicationBatch{
+			Configuration: &models.DataVaultConfiguration{ReferenceID: testReferenceID},
+			Capabilities:  []json.RawMessage{[]byte(`{"id":"zcap"}`)},
+		})
+		require.NoError(t, err)
+
+		exists, err := provider.StoreExists(testVaultID)
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		configStore, err := provider.OpenStore(edvprovider.VaultConfigurationStoreName)
+		require.NoError(t, err)
+
+		configBytes, err := configStore.Get(testVaultID)
+		require.NoError(t, err)
+		require.Contains(t, string(configBytes), testReferenceID)
+
+		require.Len(t, capabilities.imported[testVaultID], 1)
+	})
+	t.Run("Applying the same batch again has no further effect", func(t *testing.T) {
+		source := newTestProvider(t)
+		createTestVault(t, source)
+		putTestDocument(t, source, testDocID1, 0, "attribute1")
+
+		sourceStore, err := source.OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		replicatedDocument, err := sourceStore.ExportDocument(testDocID1)
+		require.NoError(t, err)
+
+		batch := &models.ReplicationBatch{
+			Configuration:      &models.DataVaultConfiguration{ReferenceID: testReferenceID},
+			Documents:          []models.ReplicatedDocument{*replicatedDocument},
+			DeletedDocumentIDs: []string{testDocID2},
+		}
+
+		target := newTestProvider(t)
+		receiver := NewReceiver(target, nil)
+
+		require.NoError(t, receiver.Apply(testVaultID, batch))
+		require.NoError(t, receiver.Apply(testVaultID, batch))
+
+		requireSameDocuments(t, source, target)
+	})
+	t.Run("Deletion stubs delete documents that aren't newer than the deleted ones", func(t *testing.T) {
+		provider := newTestProvider(t)
+		createTestVault(t, provider)
+		putTestDocument(t, provider, testDocID1, 0, "attribute1")
+		putTestDocument(t, provider, testDocID2, 1, "attribute2")
+		putTestDocument(t, provider, testDocID3, 0, "attribute3")
+
+		err := NewReceiver(provider, nil).Apply(testVaultID, &models.ReplicationBatch{
+			DeletedDocuments: []models.Tombstone{
+				{ID: testDocID1, Sequence: 0}, {ID: testDocID2, Sequence: 0}, {ID: "UnknownDocID", Sequence: 0},
+			},
+			DeletedDocumentIDs: []string{testDocID1, testDocID2, testDocID3},
+		})
+		require.NoError(t, err)
+
+		store, err := provider.OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		sequences, err := store.DocumentSequences()
+		require.NoError(t, err)
+		require.Equal(t, map[string]uint64{testDocID2: 1}, sequences)
+	})
+	t.Run("Vault not found and no configuration in the batch", func(t *testing.T) {
+		err := NewReceiver(newTestProvider(t), nil).Apply(testVaultID, &models.ReplicationBatch{})
+		require.True(t, errors.Is(err, messages.ErrVaultNotFound))
+	})
+	t.Run("Invalid replicated document", func(t *testing.T) {
+		provider := newTestProvider(t)
+		createTestVault(t, provider)
+
+		err := NewReceiver(provider, nil).Apply(testVaultID, &models.ReplicationBatch{
+			Documents: []models.ReplicatedDocument{{Document: []byte(`{}`)}},
+		})
+		require.True(t, errors.Is(err, messages.ErrInvalidReplicatedDocument))
+	})
+	t.Run("Fail to import capabilities", func(t *testing.T) {
+		provider := newTestProvider(t)
+		createTestVault(t, provider)
+
+		err := NewReceiver(provider, &mockCapabilities{err: errTest}).Apply(testVaultID, &models.ReplicationBatch{
+			Capabilities: []json.RawMessage{[]byte(`{"id":"zcap"}`)},
+		})
+		require.EqualError(t, err, "failed to import capabilities: test error")
+	})
+	t.Run("Fail to store configuration", func(t *testing.T) {
+		provider := newTestProvider(t)
+		createTestVault(t, provider)
+
+		// Another vault with the same reference ID already exists.
+		err := NewReceiver(provider, nil).Apply("AnotherVault", &models.ReplicationBatch{
+			Configuration: &models.DataVaultConfiguration{ReferenceID: testReferenceID},
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to store data vault configuration")
+	})
+}
@@ -0,0 +1,468 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package replication
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	ariesstorage "github.com/hyperledger/aries-framework-go/spi/storage"
+
+	"github.com/trustbloc/edv/pkg/edvprovider"
+	"github.com/trustbloc/edv/pkg/logging"
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const (
+	checkpointStoreName = "replication_checkpoints"
+	// checkpointVaultTagName tags every checkpoint with the ID of the vault it's for.
+	checkpointVaultTagName = "ReplicationVault"
+
+	// ReplicaEndpointPathFormat is the path, relative to the target server's base URL, that replication batches
+	// for a vault are sent to. The format argument is the path-escaped vault ID.
+	ReplicaEndpointPathFormat = "/admin/vaults/%s/replica"
+
+	defaultBatchSize          = 100
+	defaultRequestTimeout     = time.Minute
+	defaultClockSkewTolerance = time.Minute
+)
+
+var logger = logging.New("edv-replication")
+
+var (
+	// ErrInvalidTarget is returned when the URL of a replication target isn't an absolute http(s) URL.
+	ErrInvalidTarget = errors.New("replication target URL must be an absolute http or https URL")
+	// ErrTargetFailure is returned when a replication target can't be reached or rejects a replication batch.
+	ErrTargetFailure = errors.New("replication target failed to accept the replicated data")
+)
+
+type httpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+type capabilityExporter interface {
+	ExportCapabilities(resourceID string) ([]json.RawMessage, error)
+}
+
+// Option configures the replicator.
+type Option func(r *Replicator)
+
+// WithHTTPClient sets the HTTP client used to send replication batches to targets.
+func WithHTTPClient(client httpClient) Option {
+	return func(r *Replicator) {
+		r.httpClient = client
+	}
+}
+
+// WithBatchSize sets the maximum number of documents (or deleted document IDs) sent to a target in one request.
+// Values less than 1 are ignored.
+func WithBatchSize(batchSize int) Option {
+	return func(r *Replicator) {
+		r.batchSize = batchSize
+	}
+}
+
+// WithCapabilityExporter sets the source of the zcaps that are replicated along with each vault.
+// If it isn't set, then no zcaps are replicated.
+func WithCapabilityExporter(exporter capabilityExporter) Option {
+	return func(r *Replicator) {
+		r.capabilityExporter = exporter
+	}
+}
+
+// WithClockSkewTolerance sets how far back before a checkpoint the changes to a vault are sent again (see Replicator).
+// It defaults to a minute.
+func WithClockSkewTolerance(tolerance time.Duration) Option {
+	return func(r *Replicator) {
+		r.clockSkewTolerance = tolerance
+	}
+}
+
+// WithLogger has the replicator log with the given logger instead of the edge-core logger for its module.
+func WithLogger(logger logging.Logger) Option {
+	return func(r *Replicator) {
+		r.logger = logger
+	}
+}
+
+// Target is an EDV server that vaults are replicated to.
+type Target struct {
+	// URL is the base URL of the target server.
+	URL string
+	// Token is the admin token of the target server.
+	Token string
+}
+
+// Replicator copies vaults to other EDV servers. Everything in a vault is already encrypted, so the stored documents
+// and their mapping documents are copied as-is.
+//
+// Changes are found by their change stamps (see edvprovider.Store.ChangesSince), and sent in the order of their
+// stamps. The checkpoint of a vault's replication to a target is the stamp of the last change sent, so replicating
+// the same vault to the same target again only sends the documents that changed since. The changes made within the
+// clock skew tolerance before the checkpoint are sent again, so that changes made by EDV servers whose clocks are
+// behind, or that took a while to be written, aren't missed. Sending a change twice does no harm.
+//
+// Deletions are sent as stubs that carry the sequence the document had when it was deleted, taken from its tombstone.
+// They're only found through tombstones, so they're only replicated from vaults in tombstone mode. Replicator is an
+// edvprovider.TombstoneCompactionPolicy that keeps a tombstone until every target that the vault is replicated to has
+// received the deletion.
+type Replicator struct {
+	provider           *edvprovider.Provider
+	checkpoints        ariesstorage.Store
+	httpClient         httpClient
+	batchSize          int
+	clockSkewTolerance time.Duration
+	capabilityExporter capabilityExporter
+	logger             logging.Logger
+	// Replications are serialized so that concurrent replications to the same target can't interleave their
+	// checkpoint updates.
+	mutex sync.Mutex
+}
+
+// New returns a new replicator for the vaults in provider, which keeps its checkpoints in checkpointStoreProv.
+func New(provider *edvprovider.Provider, checkpointStoreProv ariesstorage.Provider, opts ...Option) (*Replicator,
+	error) {
+	checkpoints, err := checkpointStoreProv.OpenStore(checkpointStoreName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store %s: %w", checkpointStoreName, err)
+	}
+
+	err = checkpointStoreProv.SetStoreConfig(checkpointStoreName,
+		ariesstorage.StoreConfiguration{TagNames: []string{checkpointVaultTagName}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set store configuration for %s: %w", checkpointStoreName, err)
+	}
+
+	r := &Replicator{
+		provider:           provider,
+		checkpoints:        checkpoints,
+		httpClient:         &http.Client{Timeout: defaultRequestTimeout},
+		batchSize:          defaultBatchSize,
+		clockSkewTolerance: defaultClockSkewTolerance,
+		logger:             logger,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.batchSize < 1 {
+		r.batchSize = defaultBatchSize
+	}
+
+	return r, nil
+}
+
+// Replicate sends the configuration, zcaps and documents of the given vault to target, creating the vault there if
+// it doesn't exist yet. Only the changes since the previous replication of the vault to the same target are sent.
+// The checkpoint is saved after every batch that the target accepts, so a failed replication resumes from where it
+// stopped the next time. Vaults created by earlier versions of the EDV server are upgraded first (see
+// edvprovider.Provider.UpgradeVaultStore), so that their documents can be found by their change stamps.
+func (r *Replicator) Replicate(vaultID string, target *Target) (*models.ReplicationResult, error) {
+	replicaEndpoint, err := replicaEndpoint(target.URL, vaultID)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	batch, err := r.vaultDetails(vaultID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.provider.UpgradeVaultStore(vaultID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upgrade store for vault: %w", err)
+	}
+
+	store, err := r.provider.OpenStore(vaultID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store for vault: %w", err)
+	}
+
+	checkpointKey := vaultID + " " + target.URL
+
+	checkpoint, err := r.getCheckpoint(checkpointKey)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := store.ChangesSince(checkpoint.HighWaterMark - r.clockSkewTolerance.Nanoseconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get changes to vault: %w", err)
+	}
+
+	r.logger.Infof("Replicating vault %s to %s: %d changes", vaultID, target.URL, len(changes))
+
+	result := &models.ReplicationResult{}
+
+	// The first batch is sent even if nothing changed, so that the vault and its zcaps are created on the target.
+	for first := true; first || len(changes) > 0; first = false {
+		var sentChanges []edvprovider.DocumentChange
+
+		sentChanges, changes = split(changes, r.batchSize)
+
+		err = addChanges(store, batch, sentChanges)
+		if err != nil {
+			return nil, err
+		}
+
+		err = r.send(replicaEndpoint, target.Token, batch)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(sentChanges) > 0 && sentChanges[len(sentChanges)-1].Stamp > checkpoint.HighWaterMark {
+			checkpoint.HighWaterMark = sentChanges[len(sentChanges)-1].Stamp
+		}
+
+		err = r.putCheckpoint(checkpointKey, vaultID, checkpoint)
+		if err != nil {
+			return nil, err
+		}
+
+		result.DocumentsReplicated += len(batch.Documents)
+		result.DocumentsDeleted += len(batch.DeletedDocuments)
+
+		batch = &models.ReplicationBatch{}
+	}
+
+	return result, nil
+}
+
+// addChanges adds the given changes to batch: the documents that were created or updated, and the stubs of the ones
+// that were deleted. Documents that were deleted since their changes were found, and deletions whose tombstones
+// are gone, are left out, since their next changes will be sent instead.
+func addChanges(store *edvprovider.Store, batch *models.ReplicationBatch, changes []edvprovider.DocumentChange) error {
+	for _, change := range changes {
+		if change.Deleted {
+			tombstone, err := store.Tombstone(change.ID)
+			if errors.Is(err, messages.ErrDocumentNotFound) {
+				continue
+			}
+
+			if err != nil {
+				return fmt.Errorf("failed to get tombstone for document %s: %w", change.ID, err)
+			}
+
+			batch.DeletedDocuments = append(batch.DeletedDocuments, *tombstone)
+			// The IDs are sent as well, for targets that don't know about deletion stubs yet.
+			batch.DeletedDocumentIDs = append(batch.DeletedDocumentIDs, change.ID)
+
+			continue
+		}
+
+		replicatedDocument, err := store.ExportDocument(change.ID)
+		if errors.Is(err, messages.ErrDocumentNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to export document %s: %w", change.ID, err)
+		}
+
+		batch.Documents = append(batch.Documents, *replicatedDocument)
+	}
+
+	return nil
+}
+
+// vaultDetails returns a batch with the configuration and zcaps of the given vault.
+func (r *Replicator) vaultDetails(vaultID string) (*models.ReplicationBatch, error) {
+	exists, err := r.provider.StoreExists(vaultID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine whether vault exists: %w", err)
+	}
+
+	if !exists {
+		return nil, messages.ErrVaultNotFound
+	}
+
+	config, err := r.provider.VaultConfiguration(vaultID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vault configuration: %w", err)
+	}
+
+	batch := &models.ReplicationBatch{Configuration: config}
+
+	if r.capabilityExporter != nil {
+		batch.Capabilities, err = r.capabilityExporter.ExportCapabilities(vaultID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export capabilities: %w", err)
+		}
+	}
+
+	return batch, nil
+}
+
+func (r *Replicator) send(endpoint, token string, batch *models.ReplicationBatch) error {
+	batchBytes, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal replication batch: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(batchBytes))
+	if err != nil {
+		return fmt.Errorf("failed to create replication request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrTargetFailure, err)
+	}
+
+	defer func() {
+		errClose := resp.Body.Close()
+		if errClose != nil {
+			r.logger.Warnf("Failed to close response body from %s: %s", endpoint, errClose)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		body, errRead := ioutil.ReadAll(resp.Body)
+		if errRead != nil {
+			r.logger.Warnf("Failed to read response body from %s: %s", endpoint, errRead)
+		}
+
+		return fmt.Errorf("%w: %s responded with status code %d: %s", ErrTargetFailure, endpoint,
+			resp.StatusCode, body)
+	}
+
+	return nil
+}
+
+// checkpoint is how far a vault has been replicated to a target.
+type checkpoint struct {
+	// HighWaterMark is the change stamp of the last change sent to the target. The changes before it have been sent
+	// too. Checkpoints saved before checkpoints had a high-water mark don't have one, so the vault is replicated in
+	// full again.
+	HighWaterMark int64 `json:"highWaterMark"`
+}
+
+func (r *Replicator) getCheckpoint(key string) (*checkpoint, error) {
+	checkpointBytes, err := r.checkpoints.Get(key)
+	if err != nil {
+		if errors.Is(err, ariesstorage.ErrDataNotFound) {
+			return &checkpoint{}, nil
+		}
+
+		return nil, fmt.Errorf("failed to get replication checkpoint: %w", err)
+	}
+
+	return unmarshalCheckpoint(checkpointBytes)
+}
+
+func unmarshalCheckpoint(checkpointBytes []byte) (*checkpoint, error) {
+	var replicationCheckpoint checkpoint
+
+	err := json.Unmarshal(checkpointBytes, &replicationCheckpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal replication checkpoint: %w", err)
+	}
+
+	return &replicationCheckpoint, nil
+}
+
+func (r *Replicator) putCheckpoint(key, vaultID string, replicationCheckpoint *checkpoint) error {
+	checkpointBytes, err := json.Marshal(replicationCheckpoint)
+	if err != nil {
+		return fmt.Errorf("failed to marshal replication checkpoint: %w", err)
+	}
+
+	err = r.checkpoints.Put(key, checkpointBytes, ariesstorage.Tag{Name: checkpointVaultTagName, Value: vaultID})
+	if err != nil {
+		return fmt.Errorf("failed to store replication checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// DeletionConfirmed returns whether every target that the given vault has been replicated to has received the
+// deletion of the given document, which is the case once the checkpoint of every target is at or past the time in
+// the document's tombstone. Deletions of documents without a tombstone are confirmed.
+// Checkpoints saved before checkpoints were tagged with their vault's ID are only found once the vault has been
+// replicated again.
+func (r *Replicator) DeletionConfirmed(vaultID, docID string) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	store, err := r.provider.OpenStore(vaultID)
+	if err != nil {
+		return false, fmt.Errorf("failed to open store for vault: %w", err)
+	}
+
+	tombstone, err := store.Tombstone(docID)
+	if errors.Is(err, messages.ErrDocumentNotFound) {
+		return true, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to get tombstone for document %s: %w", docID, err)
+	}
+
+	itr, err := r.checkpoints.Query(checkpointVaultTagName + ":" + vaultID)
+	if err != nil {
+		return false, fmt.Errorf("failed to query replication checkpoints: %w", err)
+	}
+
+	defer ariesstorage.Close(itr, r.logger)
+
+	more, err := itr.Next()
+
+	for ; err == nil && more; more, err = itr.Next() {
+		checkpointBytes, errValue := itr.Value()
+		if errValue != nil {
+			return false, fmt.Errorf("failed to get replication checkpoint: %w", errValue)
+		}
+
+		replicationCheckpoint, errUnmarshal := unmarshalCheckpoint(checkpointBytes)
+		if errUnmarshal != nil {
+			return false, errUnmarshal
+		}
+
+		if replicationCheckpoint.HighWaterMark < tombstone.Deleted.UnixNano() {
+			return false, nil
+		}
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to iterate over replication checkpoints: %w", err)
+	}
+
+	return true, nil
+}
+
+func replicaEndpoint(targetURL, vaultID string) (string, error) {
+	parsedURL, err := url.Parse(targetURL)
+	if err != nil || !parsedURL.IsAbs() || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+		return "", ErrInvalidTarget
+	}
+
+	return strings.TrimSuffix(targetURL, "/") + fmt.Sprintf(ReplicaEndpointPathFormat, url.PathEscape(vaultID)), nil
+}
+
+func split(changes []edvprovider.DocumentChange, n int) (head, tail []edvprovider.DocumentChange) {
+	if n > len(changes) {
+		n = len(changes)
+	}
+
+	return changes[:n], changes[n:]
+}
@@ -0,0 +1,614 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package replication
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mock"
+	ariesstorage "github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/edvprovider"
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const (
+	testVaultID     = "Sr7yHjomhn1aeaFnxREfRN"
+	testDocID1      = "VJYHHJx4C8J9Fsgz7rZqSp"
+	testDocID2      = "AJYHHJx4C8J9Fsgz7rZqSp"
+	testDocID3      = "BJYHHJx4C8J9Fsgz7rZqSp"
+	testReferenceID = "referenceID"
+	testToken       = "testToken"
+	testRetrieval   = 100
+)
+
+var errTest = errors.New("test error")
+
+type failingHTTPClient struct{}
+
+func (f *failingHTTPClient) Do(*http.Request) (*http.Response, error) {
+	return nil, errTest
+}
+
+type mockCapabilities struct {
+	capabilities []json.RawMessage
+	imported     map[string][]json.RawMessage
+	err          error
+}
+
+func (m *mockCapabilities) ExportCapabilities(string) ([]json.RawMessage, error) {
+	return m.capabilities, m.err
+}
+
+func (m *mockCapabilities) ImportCapabilities(resourceID string, capabilities []json.RawMessage) error {
+	if m.err != nil {
+		return m.err
+	}
+
+	if m.imported == nil {
+		m.imported = make(map[string][]json.RawMessage)
+	}
+
+	m.imported[resourceID] = append(m.imported[resourceID], capabilities...)
+
+	return nil
+}
+
+// testTarget is an EDV server that applies the replication batches it receives with a Receiver.
+type testTarget struct {
+	*httptest.Server
+	provider *edvprovider.Provider
+	batches  []models.ReplicationBatch
+}
+
+func newTestTarget(t *testing.T, importer capabilityImporter) *testTarget {
+	t.Helper()
+
+	target := &testTarget{provider: newTestProvider(t)}
+	receiver := NewReceiver(target.provider, importer)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/admin/vaults/{vaultID}/replica", func(rw http.ResponseWriter, req *http.Request) {
+		require.Equal(t, "Bearer "+testToken, req.Header.Get("Authorization"))
+
+		var batch models.ReplicationBatch
+
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&batch))
+
+		target.batches = append(target.batches, batch)
+
+		err := receiver.Apply(mux.Vars(req)["vaultID"], &batch)
+		require.NoError(t, err)
+	}).Methods(http.MethodPost)
+
+	target.Server = httptest.NewServer(router)
+
+	return target
+}
+
+func TestNew(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		replicator, err := New(newTestProvider(t), mem.NewProvider(), WithBatchSize(0))
+		require.NoError(t, err)
+		require.Equal(t, defaultBatchSize, replicator.batchSize)
+	})
+	t.Run("Fail to open checkpoint store", func(t *testing.T) {
+		replicator, err := New(newTestProvider(t), &mock.Provider{ErrOpenStore: errTest})
+		require.EqualError(t, err, "failed to open store replication_checkpoints: test error")
+		require.Nil(t, replicator)
+	})
+	t.Run("Fail to set checkpoint store configuration", func(t *testing.T) {
+		replicator, err := New(newTestProvider(t), &mock.Provider{
+			OpenStoreReturn: &mock.Store{}, ErrSetStoreConfig: errTest,
+		})
+		require.EqualError(t, err, "failed to set store configuration for replication_checkpoints: test error")
+		require.Nil(t, replicator)
+	})
+}
+
+func TestReplicator_Replicate(t *testing.T) {
+	t.Run("Initial replication creates the vault on the target", func(t *testing.T) {
+		source := newTestProvider(t)
+		createTestVault(t, source)
+		putTestDocument(t, source, testDocID1, 0, "attribute1")
+		putTestDocument(t, source, testDocID2, 0, "attribute2")
+
+		capabilities := &mockCapabilities{capabilities: []json.RawMessage{[]byte(`{"id":"zcap"}`)}}
+		importedCapabilities := &mockCapabilities{}
+
+		target := newTestTarget(t, importedCapabilities)
+		defer target.Close()
+
+		replicator, err := New(source, mem.NewProvider(), WithCapabilityExporter(capabilities))
+		require.NoError(t, err)
+
+		result, err := replicator.Replicate(testVaultID, &Target{URL: target.URL + "/", Token: testToken})
+		require.NoError(t, err)
+		require.Equal(t, &models.ReplicationResult{DocumentsReplicated: 2}, result)
+
+		require.Len(t, target.batches, 1)
+		require.Equal(t, testReferenceID, target.batches[0].Configuration.ReferenceID)
+		require.Equal(t, capabilities.capabilities, importedCapabilities.imported[testVaultID])
+
+		requireSameDocuments(t, source, target.provider)
+	})
+	t.Run("Later replications only send the changes", func(t *testing.T) {
+		source := newTombstoneTestProvider(t)
+		createTestVault(t, source)
+		putTestDocument(t, source, testDocID1, 0, "attribute1")
+		putTestDocument(t, source, testDocID2, 0, "attribute2")
+
+		target := newTestTarget(t, nil)
+		defer target.Close()
+
+		replicator, err := New(source, mem.NewProvider(), WithClockSkewTolerance(0))
+		require.NoError(t, err)
+
+		_, err = replicator.Replicate(testVaultID, &Target{URL: target.URL, Token: testToken})
+		require.NoError(t, err)
+
+		result, err := replicator.Replicate(testVaultID, &Target{URL: target.URL, Token: testToken})
+		require.NoError(t, err)
+		require.Equal(t, &models.ReplicationResult{}, result)
+
+		store, err := source.OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		require.NoError(t, store.Update(models.EncryptedDocument{
+			ID: testDocID1, Sequence: 1, JWE: []byte(`{"updated":true}`),
+		}))
+		require.NoError(t, store.Delete(testDocID2))
+		putTestDocument(t, source, testDocID3, 0, "attribute3")
+
+		result, err = replicator.Replicate(testVaultID, &Target{URL: target.URL, Token: testToken})
+		require.NoError(t, err)
+		require.Equal(t, &models.ReplicationResult{DocumentsReplicated: 2, DocumentsDeleted: 1}, result)
+
+		lastBatch := target.batches[len(target.batches)-1]
+		require.Len(t, lastBatch.Documents, 2)
+		require.Equal(t, []string{testDocID2}, lastBatch.DeletedDocumentIDs)
+		require.Len(t, lastBatch.DeletedDocuments, 1)
+		require.Equal(t, testDocID2, lastBatch.DeletedDocuments[0].ID)
+		require.Equal(t, uint64(0), lastBatch.DeletedDocuments[0].Sequence)
+
+		requireSameDocuments(t, source, target.provider)
+	})
+	t.Run("Changes within the clock skew tolerance are sent again", func(t *testing.T) {
+		source := newTestProvider(t)
+		createTestVault(t, source)
+		putTestDocument(t, source, testDocID1, 0, "attribute1")
+
+		target := newTestTarget(t, nil)
+		defer target.Close()
+
+		replicator, err := New(source, mem.NewProvider(), WithClockSkewTolerance(time.Hour))
+		require.NoError(t, err)
+
+		_, err = replicator.Replicate(testVaultID, &Target{URL: target.URL, Token: testToken})
+		require.NoError(t, err)
+
+		result, err := replicator.Replicate(testVaultID, &Target{URL: target.URL, Token: testToken})
+		require.NoError(t, err)
+		require.Equal(t, &models.ReplicationResult{DocumentsReplicated: 1}, result)
+
+		requireSameDocuments(t, source, target.provider)
+	})
+	t.Run("Checkpoints of earlier versions replicate the vault in full again", func(t *testing.T) {
+		source := newTestProvider(t)
+		createTestVault(t, source)
+		putTestDocument(t, source, testDocID1, 0, "attribute1")
+		putTestDocument(t, source, testDocID2, 0, "attribute2")
+
+		target := newTestTarget(t, nil)
+		defer target.Close()
+
+		checkpointProvider := mem.NewProvider()
+
+		replicator, err := New(source, checkpointProvider, WithClockSkewTolerance(0))
+		require.NoError(t, err)
+
+		checkpoints, err := checkpointProvider.OpenStore(checkpointStoreName)
+		require.NoError(t, err)
+
+		// Earlier versions kept the sequence of every replicated document.
+		require.NoError(t, checkpoints.Put(testVaultID+" "+target.URL, []byte(`{"`+testDocID1+`":0}`),
+			ariesstorage.Tag{Name: checkpointVaultTagName, Value: testVaultID}))
+
+		result, err := replicator.Replicate(testVaultID, &Target{URL: target.URL, Token: testToken})
+		require.NoError(t, err)
+		require.Equal(t, &models.ReplicationResult{DocumentsReplicated: 2}, result)
+
+		result, err = replicator.Replicate(testVaultID, &Target{URL: target.URL, Token: testToken})
+		require.NoError(t, err)
+		require.Equal(t, &models.ReplicationResult{}, result)
+	})
+	t.Run("Deletion stubs are taken from tombstones", func(t *testing.T) {
+		source := newTombstoneTestProvider(t)
+		createTestVault(t, source)
+		putTestDocument(t, source, testDocID1, 0, "attribute1")
+
+		target := newTestTarget(t, nil)
+		defer target.Close()
+
+		replicator, err := New(source, mem.NewProvider())
+		require.NoError(t, err)
+
+		_, err = replicator.Replicate(testVaultID, &Target{URL: target.URL, Token: testToken})
+		require.NoError(t, err)
+
+		store, err := source.OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		require.NoError(t, store.Update(models.EncryptedDocument{ID: testDocID1, Sequence: 1, JWE: []byte(`{}`)}))
+		require.NoError(t, store.Delete(testDocID1))
+
+		tombstone, err := store.Tombstone(testDocID1)
+		require.NoError(t, err)
+
+		// The update is never replicated, so only the tombstone knows the sequence that was deleted.
+		result, err := replicator.Replicate(testVaultID, &Target{URL: target.URL, Token: testToken})
+		require.NoError(t, err)
+		require.Equal(t, &models.ReplicationResult{DocumentsDeleted: 1}, result)
+
+		lastBatch := target.batches[len(target.batches)-1]
+		require.Len(t, lastBatch.DeletedDocuments, 1)
+		require.Equal(t, tombstone.Sequence, lastBatch.DeletedDocuments[0].Sequence)
+		require.True(t, tombstone.Deleted.Equal(lastBatch.DeletedDocuments[0].Deleted))
+
+		requireSameDocuments(t, source, target.provider)
+	})
+	t.Run("Documents are sent in batches", func(t *testing.T) {
+		source := newTestProvider(t)
+		createTestVault(t, source)
+		putTestDocument(t, source, testDocID1, 0, "attribute1")
+		putTestDocument(t, source, testDocID2, 0, "attribute2")
+		putTestDocument(t, source, testDocID3, 0, "attribute3")
+
+		target := newTestTarget(t, nil)
+		defer target.Close()
+
+		replicator, err := New(source, mem.NewProvider(), WithBatchSize(2))
+		require.NoError(t, err)
+
+		result, err := replicator.Replicate(testVaultID, &Target{URL: target.URL, Token: testToken})
+		require.NoError(t, err)
+		require.Equal(t, 3, result.DocumentsReplicated)
+
+		require.Len(t, target.batches, 2)
+		require.NotNil(t, target.batches[0].Configuration)
+		require.Len(t, target.batches[0].Documents, 2)
+		require.Nil(t, target.batches[1].Configuration)
+		require.Len(t, target.batches[1].Documents, 1)
+
+		requireSameDocuments(t, source, target.provider)
+	})
+	t.Run("Failed replication resumes from the last accepted batch", func(t *testing.T) {
+		source := newTestProvider(t)
+		createTestVault(t, source)
+		putTestDocument(t, source, testDocID1, 0, "attribute1")
+		putTestDocument(t, source, testDocID2, 0, "attribute2")
+
+		target := newTestTarget(t, nil)
+		defer target.Close()
+
+		requests, failAfter := 0, 1
+
+		flakyTarget := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			requests++
+			if requests > failAfter {
+				rw.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			target.Config.Handler.ServeHTTP(rw, req)
+		}))
+		defer flakyTarget.Close()
+
+		replicator, err := New(source, mem.NewProvider(), WithBatchSize(1), WithClockSkewTolerance(0))
+		require.NoError(t, err)
+
+		result, err := replicator.Replicate(testVaultID, &Target{URL: flakyTarget.URL, Token: testToken})
+		require.True(t, errors.Is(err, ErrTargetFailure))
+		require.Contains(t, err.Error(), "responded with status code 500")
+		require.Nil(t, result)
+
+		failAfter = requests + 1
+
+		// Only the document that the target didn't accept is sent again.
+		result, err = replicator.Replicate(testVaultID, &Target{URL: flakyTarget.URL, Token: testToken})
+		require.NoError(t, err)
+		require.Equal(t, &models.ReplicationResult{DocumentsReplicated: 1}, result)
+
+		requireSameDocuments(t, source, target.provider)
+	})
+	t.Run("Invalid target URL", func(t *testing.T) {
+		replicator, err := New(newTestProvider(t), mem.NewProvider())
+		require.NoError(t, err)
+
+		for _, targetURL := range []string{"", "/edv", "ftp://example.com", "%"} {
+			result, errReplicate := replicator.Replicate(testVaultID, &Target{URL: targetURL})
+			require.True(t, errors.Is(errReplicate, ErrInvalidTarget), targetURL)
+			require.Nil(t, result)
+		}
+	})
+	t.Run("Vault not found", func(t *testing.T) {
+		replicator, err := New(newTestProvider(t), mem.NewProvider())
+		require.NoError(t, err)
+
+		result, err := replicator.Replicate(testVaultID, &Target{URL: "https://example.com"})
+		require.True(t, errors.Is(err, messages.ErrVaultNotFound))
+		require.Nil(t, result)
+	})
+	t.Run("Target can't be reached", func(t *testing.T) {
+		source := newTestProvider(t)
+		createTestVault(t, source)
+
+		replicator, err := New(source, mem.NewProvider(), WithHTTPClient(&failingHTTPClient{}))
+		require.NoError(t, err)
+
+		result, err := replicator.Replicate(testVaultID, &Target{URL: "https://example.com"})
+		require.True(t, errors.Is(err, ErrTargetFailure))
+		require.Nil(t, result)
+	})
+	t.Run("Fail to export capabilities", func(t *testing.T) {
+		source := newTestProvider(t)
+		createTestVault(t, source)
+
+		replicator, err := New(source, mem.NewProvider(),
+			WithCapabilityExporter(&mockCapabilities{err: errTest}))
+		require.NoError(t, err)
+
+		result, err := replicator.Replicate(testVaultID, &Target{URL: "https://example.com"})
+		require.EqualError(t, err, "failed to export capabilities: test error")
+		require.Nil(t, result)
+	})
+	t.Run("Vault configuration missing", func(t *testing.T) {
+		source := newTestProvider(t)
+		require.NoError(t, source.CreateVaultStore(testVaultID))
+
+		_, err := source.OpenStore(edvprovider.VaultConfigurationStoreName)
+		require.NoError(t, err)
+
+		replicator, err := New(source, mem.NewProvider())
+		require.NoError(t, err)
+
+		result, err := replicator.Replicate(testVaultID, &Target{URL: "https://example.com"})
+		require.Error(t, err)
+		require.True(t, strings.HasPrefix(err.Error(), "failed to get vault configuration"))
+		require.Nil(t, result)
+	})
+	t.Run("Fail to get checkpoint", func(t *testing.T) {
+		source := newTestProvider(t)
+		createTestVault(t, source)
+
+		replicator, err := New(source, &mock.Provider{OpenStoreReturn: &mock.Store{ErrGet: errTest}})
+		require.NoError(t, err)
+
+		result, err := replicator.Replicate(testVaultID, &Target{URL: "https://example.com"})
+		require.EqualError(t, err, "failed to get replication checkpoint: test error")
+		require.Nil(t, result)
+	})
+	t.Run("Fail to store checkpoint", func(t *testing.T) {
+		source := newTestProvider(t)
+		createTestVault(t, source)
+
+		target := newTestTarget(t, nil)
+		defer target.Close()
+
+		replicator, err := New(source, &mock.Provider{OpenStoreReturn: &mock.Store{
+			ErrGet: ariesstorage.ErrDataNotFound, ErrPut: errTest,
+		}})
+		require.NoError(t, err)
+
+		result, err := replicator.Replicate(testVaultID, &Target{URL: target.URL, Token: testToken})
+		require.EqualError(t, err, "failed to store replication checkpoint: test error")
+		require.Nil(t, result)
+	})
+}
+
+func TestReplicator_DeletionConfirmed(t *testing.T) {
+	t.Run("Deletions are confirmed once every target has received them", func(t *testing.T) {
+		source := newTombstoneTestProvider(t)
+		createTestVault(t, source)
+		putTestDocument(t, source, testDocID1, 0, "attribute1")
+
+		target1 := newTestTarget(t, nil)
+		defer target1.Close()
+
+		target2 := newTestTarget(t, nil)
+		defer target2.Close()
+
+		replicator, err := New(source, mem.NewProvider())
+		require.NoError(t, err)
+
+		for _, target := range []*testTarget{target1, target2} {
+			_, err = replicator.Replicate(testVaultID, &Target{URL: target.URL, Token: testToken})
+			require.NoError(t, err)
+		}
+
+		store, err := source.OpenStore(testVaultID)
+		require.NoError(t, err)
+
+		require.NoError(t, store.Delete(testDocID1))
+
+		confirmed, err := replicator.DeletionConfirmed(testVaultID, testDocID1)
+		require.NoError(t, err)
+		require.False(t, confirmed)
+
+		_, err = replicator.Replicate(testVaultID, &Target{URL: target1.URL, Token: testToken})
+		require.NoError(t, err)
+
+		confirmed, err = replicator.DeletionConfirmed(testVaultID, testDocID1)
+		require.NoError(t, err)
+		require.False(t, confirmed)
+
+		_, err = replicator.Replicate(testVaultID, &Target{URL: target2.URL, Token: testToken})
+		require.NoError(t, err)
+
+		confirmed, err = replicator.DeletionConfirmed(testVaultID, testDocID1)
+		require.NoError(t, err)
+		require.True(t, confirmed)
+
+		// The replicator is the compaction policy for the tombstones of the vaults that it replicates.
+		_, err = source.PurgeTombstones(replicator)
+		require.NoError(t, err)
+	})
+	t.Run("Vaults that were never replicated are confirmed", func(t *testing.T) {
+		replicator, err := New(newTestProvider(t), mem.NewProvider())
+		require.NoError(t, err)
+
+		confirmed, err := replicator.DeletionConfirmed(testVaultID, testDocID1)
+		require.NoError(t, err)
+		require.True(t, confirmed)
+	})
+	t.Run("Documents without a tombstone are confirmed", func(t *testing.T) {
+		source := newTestProvider(t)
+		createTestVault(t, source)
+
+		replicator, err := New(source, &mock.Provider{OpenStoreReturn: &mock.Store{ErrQuery: errTest}})
+		require.NoError(t, err)
+
+		confirmed, err := replicator.DeletionConfirmed(testVaultID, testDocID1)
+		require.NoError(t, err)
+		require.True(t, confirmed)
+	})
+	t.Run("Fail to query checkpoints", func(t *testing.T) {
+		replicator, err := New(newDeletedDocumentTestProvider(t),
+			&mock.Provider{OpenStoreReturn: &mock.Store{ErrQuery: errTest}})
+		require.NoError(t, err)
+
+		_, err = replicator.DeletionConfirmed(testVaultID, testDocID1)
+		require.EqualError(t, err, "failed to query replication checkpoints: test error")
+	})
+	t.Run("Invalid checkpoint", func(t *testing.T) {
+		checkpointProvider := mem.NewProvider()
+
+		replicator, err := New(newDeletedDocumentTestProvider(t), checkpointProvider)
+		require.NoError(t, err)
+
+		checkpoints, err := checkpointProvider.OpenStore(checkpointStoreName)
+		require.NoError(t, err)
+
+		require.NoError(t, checkpoints.Put("checkpoint", []byte("NotJSON"),
+			ariesstorage.Tag{Name: checkpointVaultTagName, Value: testVaultID}))
+
+		_, err = replicator.DeletionConfirmed(testVaultID, testDocID1)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to unmarshal replication checkpoint")
+	})
+}
+
+func newTestProvider(t *testing.T) *edvprovider.Provider {
+	t.Helper()
+
+	return setUpTestProvider(t, edvprovider.NewProvider(mem.NewProvider(), testRetrieval))
+}
+
+func newTombstoneTestProvider(t *testing.T) *edvprovider.Provider {
+	t.Helper()
+
+	return setUpTestProvider(t, edvprovider.NewProvider(mem.NewProvider(), testRetrieval,
+		edvprovider.WithTombstoneRetention(time.Hour)))
+}
+
+// newDeletedDocumentTestProvider returns a provider with the test vault, which has a tombstone for testDocID1.
+func newDeletedDocumentTestProvider(t *testing.T) *edvprovider.Provider {
+	t.Helper()
+
+	provider := newTombstoneTestProvider(t)
+	createTestVault(t, provider)
+	putTestDocument(t, provider, testDocID1, 0, "attribute1")
+
+	store, err := provider.OpenStore(testVaultID)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Delete(testDocID1))
+
+	return provider
+}
+
+func setUpTestProvider(t *testing.T, provider *edvprovider.Provider) *edvprovider.Provider {
+	t.Helper()
+
+	_, err := provider.OpenStore(edvprovider.VaultConfigurationStoreName)
+	require.NoError(t, err)
+
+	err = provider.SetStoreConfig(edvprovider.VaultConfigurationStoreName,
+		ariesstorage.StoreConfiguration{TagNames: []string{edvprovider.VaultConfigReferenceIDTagName}})
+	require.NoError(t, err)
+
+	return provider
+}
+
+func createTestVault(t *testing.T, provider *edvprovider.Provider) {
+	t.Helper()
+
+	configStore, err := provider.OpenStore(edvprovider.VaultConfigurationStoreName)
+	require.NoError(t, err)
+
+	err = configStore.StoreDataVaultConfiguration(&models.DataVaultConfiguration{ReferenceID: testReferenceID},
+		testVaultID)
+	require.NoError(t, err)
+
+	require.NoError(t, provider.CreateVaultStore(testVaultID))
+}
+
+func putTestDocument(t *testing.T, provider *edvprovider.Provider, docID string, sequence uint64,
+	attributeName string) {
+	t.Helper()
+
+	store, err := provider.OpenStore(testVaultID)
+	require.NoError(t, err)
+
+	err = store.Put(models.EncryptedDocument{
+		ID:       docID,
+		Sequence: sequence,
+		IndexedAttributeCollections: []models.IndexedAttributeCollection{{
+			IndexedAttributes: []models.IndexedAttribute{{Name: attributeName, Value: "value"}},
+		}},
+		JWE: []byte(`{}`),
+	})
+	require.NoError(t, err)
+}
+
+func requireSameDocuments(t *testing.T, source, target *edvprovider.Provider) {
+	t.Helper()
+
+	sourceStore, err := source.OpenStore(testVaultID)
+	require.NoError(t, err)
+
+	targetStore, err := target.OpenStore(testVaultID)
+	require.NoError(t, err)
+
+	sourceSequences, err := sourceStore.DocumentSequences()
+	require.NoError(t, err)
+
+	targetSequences, err := targetStore.DocumentSequences()
+	require.NoError(t, err)
+	require.Equal(t, sourceSequences, targetSequences)
+
+	for docID := range sourceSequences {
+		sourceDocument, errExport := sourceStore.ExportDocument(docID)
+		require.NoError(t, errExport)
+
+		targetDocument, errExport := targetStore.ExportDocument(docID)
+		require.NoError(t, errExport)
+
+		require.JSONEq(t, string(sourceDocument.Document), string(targetDocument.Document))
+		require.ElementsMatch(t, sourceDocument.MappingDocuments, targetDocument.MappingDocuments)
+	}
+}
@@ -0,0 +1,33 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package admin
+
+import (
+	"github.com/trustbloc/edv/pkg/restapi/admin/operation"
+)
+
+// New returns new controller instance.
+func New(config *operation.Config) *Controller {
+	var allHandlers []operation.Handler
+
+	adminService := operation.New(config)
+
+	handlers := adminService.GetRESTHandlers()
+
+	allHandlers = append(allHandlers, handlers...)
+
+	return &Controller{handlers: allHandlers}
+}
+
+// Controller contains handlers for controller.
+type Controller struct {
+	handlers []operation.Handler
+}
+
+// GetOperations returns all controller endpoints.
+func (c *Controller) GetOperations() []operation.Handler {
+	return c.handlers
+}
@@ -0,0 +1,718 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/trustbloc/edv/pkg/audit"
+	"github.com/trustbloc/edv/pkg/auth/zcapld"
+	"github.com/trustbloc/edv/pkg/internal/common/support"
+	"github.com/trustbloc/edv/pkg/logging"
+	"github.com/trustbloc/edv/pkg/replication"
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// API endpoints.
+const (
+	logModuleName = "edv-admin-restapi"
+
+	// PathPrefix is the prefix of every admin endpoint.
+	PathPrefix = "/admin"
+
+	resourceIDPathVariable = "resourceID"
+	vaultIDPathVariable    = "vaultID"
+	tenantIDPathVariable   = "tenantID"
+	resourceQueryParameter = "resource"
+	// The query parameter of the vault limit endpoint.
+	controllerQueryParameter = "controller"
+
+	// Query parameters of the audit endpoint.
+	vaultQueryParameter     = "vault"
+	actorQueryParameter     = "actor"
+	operationQueryParameter = "operation"
+	sinceQueryParameter     = "since"
+	untilQueryParameter     = "until"
+	limitQueryParameter     = "limit"
+
+	capabilitiesEndpoint         = PathPrefix + "/capabilities"
+	orphanedCapabilitiesEndpoint = capabilitiesEndpoint + "/orphaned"
+	resourceCapabilitiesEndpoint = capabilitiesEndpoint + "/{" + resourceIDPathVariable + "}"
+	vaultEndpoint                = PathPrefix + "/vaults/{" + vaultIDPathVariable + "}"
+	replicateEndpoint            = vaultEndpoint + "/replicate"
+	consistencyCheckEndpoint     = vaultEndpoint + "/consistency-check"
+	auditEndpoint                = PathPrefix + "/audit"
+	tenantsEndpoint              = PathPrefix + "/tenants"
+	tenantEndpoint               = tenantsEndpoint + "/{" + tenantIDPathVariable + "}"
+	tenantQuotasEndpoint         = tenantEndpoint + "/quotas"
+	vaultLimitEndpoint           = PathPrefix + "/vault-limits"
+	encryptionKeyRotateEndpoint  = PathPrefix + "/encryption-key/rotate"
+	// The path that the replicator sends batches to, see replication.ReplicaEndpointPathFormat.
+	replicaEndpoint = vaultEndpoint + "/replica"
+
+	bearerAuthPrefix = "Bearer "
+)
+
+var logger = logging.New(logModuleName)
+
+var errUnauthorized = errors.New("missing or invalid admin token")
+
+// Handler http handler for each controller API endpoint.
+type Handler interface {
+	Path() string
+	Method() string
+	Handle() http.HandlerFunc
+}
+
+type capabilityStore interface {
+	RootCapabilities(resourceID string) ([]zcapld.RootCapability, error)
+	OrphanedRootCapabilities(resourceExists func(resourceID string) (bool, error)) ([]zcapld.RootCapability, error)
+	DeleteCapabilities(resourceID string) error
+}
+
+type vaultProvider interface {
+	StoreExists(name string) (bool, error)
+}
+
+type replicator interface {
+	Replicate(vaultID string, target *replication.Target) (*models.ReplicationResult, error)
+}
+
+type replicaReceiver interface {
+	Apply(vaultID string, batch *models.ReplicationBatch) error
+}
+
+type consistencyChecker interface {
+	CheckConsistency(vaultID string) (*models.ConsistencyReport, error)
+}
+
+type auditLog interface {
+	Query(query *audit.Query) ([]audit.Entry, error)
+}
+
+type tenantRegistry interface {
+	CreateTenant(tenant *models.Tenant) (string, error)
+	Tenant(tenantID string) (*models.TenantStatus, error)
+	SetTenantQuotas(tenantID string, quotas models.TenantQuotas) (*models.Tenant, error)
+}
+
+type vaultLimitRegistry interface {
+	VaultLimit(controller string) (*models.ControllerVaultLimit, error)
+	SetVaultLimit(controller string, maxVaults uint64) (*models.ControllerVaultLimit, error)
+	DeleteVaultLimit(controller string) (*models.ControllerVaultLimit, error)
+}
+
+type encryptionKeyRotator interface {
+	RotateEncryptionKey() (*models.EncryptionKeyRotation, error)
+}
+
+// Config defines configuration for admin operations.
+type Config struct {
+	CapabilityStore capabilityStore
+	VaultProvider   vaultProvider
+	// Replicator replicates vaults to other EDV servers. If it's nil, then the replicate endpoint isn't available.
+	Replicator replicator
+	// ReplicaReceiver applies vaults replicated from other EDV servers. If it's nil, then the replica endpoint
+	// isn't available.
+	ReplicaReceiver replicaReceiver
+	// ConsistencyChecker checks and repairs the encrypted indices of vaults. If it's nil, then the consistency check
+	// endpoint isn't available.
+	ConsistencyChecker consistencyChecker
+	// AuditLog is queried for the audit entries of vault operations. If it's nil, then the audit endpoint isn't
+	// available.
+	AuditLog auditLog
+	// TenantRegistry provisions the tenants of a multi-tenant EDV server and manages their quotas. If it's nil, then
+	// the tenant endpoints aren't available.
+	TenantRegistry tenantRegistry
+	// VaultLimits manages the number of vaults that each controller can have. If it's nil, then the vault limit
+	// endpoints aren't available.
+	VaultLimits vaultLimitRegistry
+	// EncryptionKeyRotator rotates the key that the data keys of vaults are wrapped with. If it's nil, then the
+	// encryption key rotation endpoint isn't available.
+	EncryptionKeyRotator encryptionKeyRotator
+	// Token is the bearer token that requests to the admin endpoints must include in their Authorization header.
+	// If it's empty, then all requests are rejected.
+	Token string
+	// Logger is used instead of the edge-core logger for the admin module. The lines logged while handling a request
+	// include its correlation ID (see logging.Middleware).
+	Logger logging.Logger
+}
+
+// New returns a new admin operations instance.
+func New(config *Config) *Operation {
+	o := &Operation{
+		capabilityStore:    config.CapabilityStore,
+		vaultProvider:      config.VaultProvider,
+		replicator:         config.Replicator,
+		replicaReceiver:    config.ReplicaReceiver,
+		consistencyChecker: config.ConsistencyChecker,
+		auditLog:           config.AuditLog,
+		tenantRegistry:     config.TenantRegistry,
+		vaultLimits:        config.VaultLimits,
+		encryptionKeys:     config.EncryptionKeyRotator,
+		token:              config.Token,
+		logger:             config.Logger,
+	}
+
+	if o.logger == nil {
+		o.logger = logger
+	}
+
+	return o
+}
+
+// Operation defines handlers for admin operations.
+type Operation struct {
+	capabilityStore    capabilityStore
+	vaultProvider      vaultProvider
+	replicator         replicator
+	replicaReceiver    replicaReceiver
+	consistencyChecker consistencyChecker
+	auditLog           auditLog
+	tenantRegistry     tenantRegistry
+	vaultLimits        vaultLimitRegistry
+	encryptionKeys     encryptionKeyRotator
+	token              string
+	logger             logging.Logger
+}
+
+// GetRESTHandlers get all controller API handler available for this service.
+// The orphaned capabilities endpoint is registered before the per-resource one so that it takes precedence.
+func (o *Operation) GetRESTHandlers() []Handler {
+	handlers := []Handler{
+		support.NewHTTPHandler(capabilitiesEndpoint, http.MethodGet, o.authorize(o.readRootCapabilitiesHandler)),
+		support.NewHTTPHandler(orphanedCapabilitiesEndpoint, http.MethodGet,
+			o.authorize(o.readOrphanedRootCapabilitiesHandler)),
+		support.NewHTTPHandler(orphanedCapabilitiesEndpoint, http.MethodDelete,
+			o.authorize(o.deleteOrphanedCapabilitiesHandler)),
+		support.NewHTTPHandler(resourceCapabilitiesEndpoint, http.MethodDelete,
+			o.authorize(o.deleteResourceCapabilitiesHandler)),
+	}
+
+	if o.replicator != nil {
+		handlers = append(handlers,
+			support.NewHTTPHandler(replicateEndpoint, http.MethodPost, o.authorize(o.replicateHandler)))
+	}
+
+	if o.replicaReceiver != nil {
+		handlers = append(handlers,
+			support.NewHTTPHandler(replicaEndpoint, http.MethodPost, o.authorize(o.receiveReplicaHandler)))
+	}
+
+	if o.consistencyChecker != nil {
+		handlers = append(handlers, support.NewHTTPHandler(consistencyCheckEndpoint, http.MethodPost,
+			o.authorize(o.checkConsistencyHandler)))
+	}
+
+	if o.auditLog != nil {
+		handlers = append(handlers,
+			support.NewHTTPHandler(auditEndpoint, http.MethodGet, o.authorize(o.readAuditEntriesHandler)))
+	}
+
+	if o.tenantRegistry != nil {
+		handlers = append(handlers,
+			support.NewHTTPHandler(tenantsEndpoint, http.MethodPost, o.authorize(o.createTenantHandler)),
+			support.NewHTTPHandler(tenantEndpoint, http.MethodGet, o.authorize(o.readTenantHandler)),
+			support.NewHTTPHandler(tenantQuotasEndpoint, http.MethodPut, o.authorize(o.setTenantQuotasHandler)))
+	}
+
+	if o.vaultLimits != nil {
+		handlers = append(handlers,
+			support.NewHTTPHandler(vaultLimitEndpoint, http.MethodGet, o.authorize(o.readVaultLimitHandler)),
+			support.NewHTTPHandler(vaultLimitEndpoint, http.MethodPut, o.authorize(o.setVaultLimitHandler)),
+			support.NewHTTPHandler(vaultLimitEndpoint, http.MethodDelete, o.authorize(o.deleteVaultLimitHandler)))
+	}
+
+	if o.encryptionKeys != nil {
+		handlers = append(handlers, support.NewHTTPHandler(encryptionKeyRotateEndpoint, http.MethodPost,
+			o.authorize(o.rotateEncryptionKeyHandler)))
+	}
+
+	return handlers
+}
+
+func (o *Operation) authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		authHeader := req.Header.Get("Authorization")
+
+		if o.token == "" || !strings.HasPrefix(authHeader, bearerAuthPrefix) ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(authHeader, bearerAuthPrefix)),
+				[]byte(o.token)) != 1 {
+			o.writeError(rw, req, http.StatusUnauthorized, errUnauthorized)
+
+			return
+		}
+
+		next(rw, req)
+	}
+}
+
+func (o *Operation) readRootCapabilitiesHandler(rw http.ResponseWriter, req *http.Request) {
+	rootCapabilities, err := o.capabilityStore.RootCapabilities(req.URL.Query().Get(resourceQueryParameter))
+	if err != nil {
+		o.writeError(rw, req, http.StatusInternalServerError, fmt.Errorf("failed to read root capabilities: %w", err))
+
+		return
+	}
+
+	o.writeJSON(rw, req, rootCapabilities)
+}
+
+func (o *Operation) readOrphanedRootCapabilitiesHandler(rw http.ResponseWriter, req *http.Request) {
+	orphanedRootCapabilities, err := o.capabilityStore.OrphanedRootCapabilities(o.vaultProvider.StoreExists)
+	if err != nil {
+		o.writeError(rw, req, http.StatusInternalServerError,
+			fmt.Errorf("failed to read orphaned root capabilities: %w", err))
+
+		return
+	}
+
+	o.writeJSON(rw, req, orphanedRootCapabilities)
+}
+
+// deleteOrphanedCapabilitiesHandler deletes the capabilities of every resource that no longer exists,
+// and responds with the root capabilities that were deleted.
+func (o *Operation) deleteOrphanedCapabilitiesHandler(rw http.ResponseWriter, req *http.Request) {
+	orphanedRootCapabilities, err := o.capabilityStore.OrphanedRootCapabilities(o.vaultProvider.StoreExists)
+	if err != nil {
+		o.writeError(rw, req, http.StatusInternalServerError,
+			fmt.Errorf("failed to read orphaned root capabilities: %w", err))
+
+		return
+	}
+
+	for _, rootCapability := range orphanedRootCapabilities {
+		err = o.capabilityStore.DeleteCapabilities(rootCapability.Resource)
+		if err != nil && !errors.Is(err, zcapld.ErrCapabilityNotFound) {
+			o.writeError(rw, req, http.StatusInternalServerError,
+				fmt.Errorf("failed to delete capabilities for resource %s: %w", rootCapability.Resource, err))
+
+			return
+		}
+	}
+
+	o.requestLogger(req).Infof("Deleted the capabilities of %d resources that no longer exist",
+		len(orphanedRootCapabilities))
+
+	o.writeJSON(rw, req, orphanedRootCapabilities)
+}
+
+func (o *Operation) deleteResourceCapabilitiesHandler(rw http.ResponseWriter, req *http.Request) {
+	resourceID, err := url.PathUnescape(mux.Vars(req)[resourceIDPathVariable])
+	if err != nil {
+		o.writeError(rw, req, http.StatusBadRequest, fmt.Errorf("unable to escape %s path variable: %w",
+			resourceIDPathVariable, err))
+
+		return
+	}
+
+	exists, err := o.vaultProvider.StoreExists(resourceID)
+	if err != nil {
+		o.writeError(rw, req, http.StatusInternalServerError,
+			fmt.Errorf("failed to determine whether resource %s exists: %w", resourceID, err))
+
+		return
+	}
+
+	if exists {
+		o.writeError(rw, req, http.StatusConflict,
+			fmt.Errorf("resource %s still exists, so its capabilities can't be deleted", resourceID))
+
+		return
+	}
+
+	err = o.capabilityStore.DeleteCapabilities(resourceID)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, zcapld.ErrCapabilityNotFound) {
+			statusCode = http.StatusNotFound
+		}
+
+		o.writeError(rw, req, statusCode, fmt.Errorf("failed to delete capabilities for resource %s: %w", resourceID, err))
+	}
+}
+
+// replicateHandler replicates a vault to the EDV server in the request, and responds with what was replicated.
+func (o *Operation) replicateHandler(rw http.ResponseWriter, req *http.Request) {
+	vaultID, err := url.PathUnescape(mux.Vars(req)[vaultIDPathVariable])
+	if err != nil {
+		o.writeError(rw, req, http.StatusBadRequest, fmt.Errorf("unable to escape %s path variable: %w",
+			vaultIDPathVariable, err))
+
+		return
+	}
+
+	var replicationRequest models.ReplicationRequest
+
+	err = json.NewDecoder(req.Body).Decode(&replicationRequest)
+	if err != nil {
+		o.writeError(rw, req, http.StatusBadRequest, fmt.Errorf("invalid replication request: %w", err))
+
+		return
+	}
+
+	result, err := o.replicator.Replicate(vaultID, &replication.Target{
+		URL:   replicationRequest.TargetURL,
+		Token: replicationRequest.TargetToken,
+	})
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+
+		switch {
+		case errors.Is(err, replication.ErrInvalidTarget):
+			statusCode = http.StatusBadRequest
+		case errors.Is(err, messages.ErrVaultNotFound):
+			statusCode = http.StatusNotFound
+		case errors.Is(err, replication.ErrTargetFailure):
+			statusCode = http.StatusBadGateway
+		}
+
+		o.writeError(rw, req, statusCode, fmt.Errorf("failed to replicate vault %s: %w", vaultID, err))
+
+		return
+	}
+
+	o.writeJSON(rw, req, result)
+}
+
+// receiveReplicaHandler applies a replication batch sent by another EDV server.
+func (o *Operation) receiveReplicaHandler(rw http.ResponseWriter, req *http.Request) {
+	vaultID, err := url.PathUnescape(mux.Vars(req)[vaultIDPathVariable])
+	if err != nil {
+		o.writeError(rw, req, http.StatusBadRequest, fmt.Errorf("unable to escape %s path variable: %w",
+			vaultIDPathVariable, err))
+
+		return
+	}
+
+	var batch models.ReplicationBatch
+
+	err = json.NewDecoder(req.Body).Decode(&batch)
+	if err != nil {
+		o.writeError(rw, req, http.StatusBadRequest, fmt.Errorf("invalid replication batch: %w", err))
+
+		return
+	}
+
+	err = o.replicaReceiver.Apply(vaultID, &batch)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+
+		switch {
+		case errors.Is(err, messages.ErrInvalidReplicatedDocument), errors.Is(err, zcapld.ErrInvocationInvalid):
+			statusCode = http.StatusBadRequest
+		case errors.Is(err, messages.ErrVaultNotFound):
+			statusCode = http.StatusNotFound
+		}
+
+		o.writeError(rw, req, statusCode, fmt.Errorf("failed to apply replication batch to vault %s: %w", vaultID, err))
+	}
+}
+
+// checkConsistencyHandler checks a vault's mapping documents against its documents, repairs the ones that are
+// inconsistent, and responds with a summary of the check.
+func (o *Operation) checkConsistencyHandler(rw http.ResponseWriter, req *http.Request) {
+	vaultID, err := url.PathUnescape(mux.Vars(req)[vaultIDPathVariable])
+	if err != nil {
+		o.writeError(rw, req, http.StatusBadRequest, fmt.Errorf("unable to escape %s path variable: %w",
+			vaultIDPathVariable, err))
+
+		return
+	}
+
+	report, err := o.consistencyChecker.CheckConsistency(vaultID)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, messages.ErrVaultNotFound) {
+			statusCode = http.StatusNotFound
+		}
+
+		o.writeError(rw, req, statusCode, fmt.Errorf("failed to check consistency of vault %s: %w", vaultID, err))
+
+		return
+	}
+
+	o.writeJSON(rw, req, report)
+}
+
+// readAuditEntriesHandler responds with the audit entries selected by the request's query parameters, newest first.
+func (o *Operation) readAuditEntriesHandler(rw http.ResponseWriter, req *http.Request) {
+	query, err := auditQuery(req.URL.Query())
+	if err != nil {
+		o.writeError(rw, req, http.StatusBadRequest, fmt.Errorf("invalid audit query: %w", err))
+
+		return
+	}
+
+	entries, err := o.auditLog.Query(query)
+	if err != nil {
+		o.writeError(rw, req, http.StatusInternalServerError, fmt.Errorf("failed to query audit entries: %w", err))
+
+		return
+	}
+
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+
+	o.writeJSON(rw, req, entries)
+}
+
+// createTenantHandler provisions the tenant in the request, and responds with it along with its token.
+func (o *Operation) createTenantHandler(rw http.ResponseWriter, req *http.Request) {
+	var tenant models.Tenant
+
+	err := json.NewDecoder(req.Body).Decode(&tenant)
+	if err != nil {
+		o.writeError(rw, req, http.StatusBadRequest, fmt.Errorf("invalid tenant: %w", err))
+
+		return
+	}
+
+	token, err := o.tenantRegistry.CreateTenant(&tenant)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+
+		switch {
+		case errors.Is(err, messages.ErrInvalidTenantID):
+			statusCode = http.StatusBadRequest
+		case errors.Is(err, messages.ErrDuplicateTenant):
+			statusCode = http.StatusConflict
+		}
+
+		o.writeError(rw, req, statusCode, fmt.Errorf("failed to create tenant %s: %w", tenant.ID, err))
+
+		return
+	}
+
+	rw.Header().Set("Location", tenantsEndpoint+"/"+url.PathEscape(tenant.ID))
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusCreated)
+
+	o.writeJSON(rw, req, models.ProvisionedTenant{Tenant: tenant, Token: token})
+}
+
+// readTenantHandler responds with a tenant's quotas and how much of them it's using.
+func (o *Operation) readTenantHandler(rw http.ResponseWriter, req *http.Request) {
+	tenantID, err := url.PathUnescape(mux.Vars(req)[tenantIDPathVariable])
+	if err != nil {
+		o.writeError(rw, req, http.StatusBadRequest, fmt.Errorf("unable to escape %s path variable: %w",
+			tenantIDPathVariable, err))
+
+		return
+	}
+
+	status, err := o.tenantRegistry.Tenant(tenantID)
+	if err != nil {
+		o.writeError(rw, req, tenantErrorStatusCode(err), fmt.Errorf("failed to read tenant %s: %w", tenantID, err))
+
+		return
+	}
+
+	o.writeJSON(rw, req, status)
+}
+
+// setTenantQuotasHandler replaces a tenant's quotas with the ones in the request, and responds with the tenant.
+func (o *Operation) setTenantQuotasHandler(rw http.ResponseWriter, req *http.Request) {
+	tenantID, err := url.PathUnescape(mux.Vars(req)[tenantIDPathVariable])
+	if err != nil {
+		o.writeError(rw, req, http.StatusBadRequest, fmt.Errorf("unable to escape %s path variable: %w",
+			tenantIDPathVariable, err))
+
+		return
+	}
+
+	var quotas models.TenantQuotas
+
+	err = json.NewDecoder(req.Body).Decode(&quotas)
+	if err != nil {
+		o.writeError(rw, req, http.StatusBadRequest, fmt.Errorf("invalid tenant quotas: %w", err))
+
+		return
+	}
+
+	tenant, err := o.tenantRegistry.SetTenantQuotas(tenantID, quotas)
+	if err != nil {
+		o.writeError(rw, req, tenantErrorStatusCode(err), fmt.Errorf("failed to set quotas of tenant %s: %w", tenantID, err))
+
+		return
+	}
+
+	o.writeJSON(rw, req, tenant)
+}
+
+// readVaultLimitHandler responds with the vault limit of the controller in the request's query, along with the number
+// of vaults it has.
+func (o *Operation) readVaultLimitHandler(rw http.ResponseWriter, req *http.Request) {
+	controller, ok := o.controllerQuery(rw, req)
+	if !ok {
+		return
+	}
+
+	limit, err := o.vaultLimits.VaultLimit(controller)
+	if err != nil {
+		o.writeError(rw, req, http.StatusInternalServerError,
+			fmt.Errorf("failed to read vault limit of controller %s: %w", controller, err))
+
+		return
+	}
+
+	o.writeJSON(rw, req, limit)
+}
+
+// setVaultLimitHandler overrides the vault limit of the controller in the request's query with the one in the
+// request's body, and responds with the controller's limit.
+func (o *Operation) setVaultLimitHandler(rw http.ResponseWriter, req *http.Request) {
+	controller, ok := o.controllerQuery(rw, req)
+	if !ok {
+		return
+	}
+
+	var vaultLimit models.VaultLimit
+
+	err := json.NewDecoder(req.Body).Decode(&vaultLimit)
+	if err != nil {
+		o.writeError(rw, req, http.StatusBadRequest, fmt.Errorf("invalid vault limit: %w", err))
+
+		return
+	}
+
+	limit, err := o.vaultLimits.SetVaultLimit(controller, vaultLimit.MaxVaults)
+	if err != nil {
+		o.writeError(rw, req, http.StatusInternalServerError,
+			fmt.Errorf("failed to set vault limit of controller %s: %w", controller, err))
+
+		return
+	}
+
+	o.writeJSON(rw, req, limit)
+}
+
+// deleteVaultLimitHandler removes the override of the vault limit of the controller in the request's query, and
+// responds with the controller's limit.
+func (o *Operation) deleteVaultLimitHandler(rw http.ResponseWriter, req *http.Request) {
+	controller, ok := o.controllerQuery(rw, req)
+	if !ok {
+		return
+	}
+
+	limit, err := o.vaultLimits.DeleteVaultLimit(controller)
+	if err != nil {
+		o.writeError(rw, req, http.StatusInternalServerError,
+			fmt.Errorf("failed to delete vault limit of controller %s: %w", controller, err))
+
+		return
+	}
+
+	o.writeJSON(rw, req, limit)
+}
+
+// controllerQuery returns the controller in the request's query, or writes a 400 response if there isn't one.
+func (o *Operation) controllerQuery(rw http.ResponseWriter, req *http.Request) (string, bool) {
+	controller := req.URL.Query().Get(controllerQueryParameter)
+	if controller == "" {
+		o.writeError(rw, req, http.StatusBadRequest, fmt.Errorf("the %s query parameter is required",
+			controllerQueryParameter))
+
+		return "", false
+	}
+
+	return controller, true
+}
+
+func tenantErrorStatusCode(err error) int {
+	if errors.Is(err, messages.ErrTenantNotFound) {
+		return http.StatusNotFound
+	}
+
+	return http.StatusInternalServerError
+}
+
+func auditQuery(values url.Values) (*audit.Query, error) {
+	query := &audit.Query{
+		VaultID:   values.Get(vaultQueryParameter),
+		Actor:     values.Get(actorQueryParameter),
+		Operation: values.Get(operationQueryParameter),
+	}
+
+	for parameter, bound := range map[string]*time.Time{
+		sinceQueryParameter: &query.Since,
+		untilQueryParameter: &query.Until,
+	} {
+		if value := values.Get(parameter); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be an RFC 3339 time: %w", parameter, err)
+			}
+
+			*bound = parsed
+		}
+	}
+
+	if value := values.Get(limitQueryParameter); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("%s must be a positive integer", limitQueryParameter)
+		}
+
+		query.Limit = limit
+	}
+
+	return query, nil
+}
+
+// rotateEncryptionKeyHandler rotates the key that the data keys of vaults are wrapped with, and responds with the ID
+// of the new key and the number of data keys that were rewrapped.
+func (o *Operation) rotateEncryptionKeyHandler(rw http.ResponseWriter, req *http.Request) {
+	rotation, err := o.encryptionKeys.RotateEncryptionKey()
+	if err != nil {
+		o.writeError(rw, req, http.StatusInternalServerError, fmt.Errorf("failed to rotate encryption key: %w", err))
+
+		return
+	}
+
+	o.requestLogger(req).Infof("Rotated the encryption key to %s", rotation.KeyID)
+
+	o.writeJSON(rw, req, rotation)
+}
+
+// requestLogger returns the logger for the given request, which includes the request's correlation ID in each line.
+func (o *Operation) requestLogger(req *http.Request) logging.Logger {
+	return logging.FromContext(req.Context(), o.logger)
+}
+
+func (o *Operation) writeJSON(rw http.ResponseWriter, req *http.Request, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(rw).Encode(v)
+	if err != nil {
+		o.requestLogger(req).Errorf("admin response failure, %s", err)
+	}
+}
+
+func (o *Operation) writeError(rw http.ResponseWriter, req *http.Request, statusCode int, err error) {
+	logger := o.requestLogger(req)
+
+	logger.Infof("Admin request failed with status code %d: %s", statusCode, err)
+
+	rw.WriteHeader(statusCode)
+
+	_, errWrite := rw.Write([]byte(err.Error()))
+	if errWrite != nil {
+		logger.Errorf("admin response failure, %s", errWrite)
+	}
+}
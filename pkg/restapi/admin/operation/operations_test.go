@@ -0,0 +1,845 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/audit"
+	"github.com/trustbloc/edv/pkg/auth/zcapld"
+	"github.com/trustbloc/edv/pkg/replication"
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const testToken = "testToken"
+
+func TestGetRESTHandlers(t *testing.T) {
+	c := New(&Config{})
+	require.Equal(t, 4, len(c.GetRESTHandlers()))
+
+	c = New(&Config{Replicator: &mockReplicator{}, ReplicaReceiver: &mockReplicaReceiver{}})
+	require.Equal(t, 6, len(c.GetRESTHandlers()))
+
+	c = New(&Config{ConsistencyChecker: &mockConsistencyChecker{}})
+	require.Equal(t, 5, len(c.GetRESTHandlers()))
+
+	c = New(&Config{AuditLog: &mockAuditLog{}})
+	require.Equal(t, 5, len(c.GetRESTHandlers()))
+
+	c = New(&Config{TenantRegistry: &mockTenantRegistry{}})
+	require.Equal(t, 7, len(c.GetRESTHandlers()))
+
+	c = New(&Config{VaultLimits: &mockVaultLimitRegistry{}})
+	require.Equal(t, 7, len(c.GetRESTHandlers()))
+
+	c = New(&Config{EncryptionKeyRotator: &mockEncryptionKeyRotator{}})
+	require.Equal(t, 5, len(c.GetRESTHandlers()))
+}
+
+func TestAuthorize(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		token      string
+		authHeader string
+	}{
+		{name: "no Authorization header", token: testToken},
+		{name: "wrong token", token: testToken, authHeader: "Bearer wrongToken"},
+		{name: "not a bearer token", token: testToken, authHeader: testToken},
+		{name: "no token configured", authHeader: "Bearer "},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := New(&Config{CapabilityStore: &mockCapabilityStore{}, Token: tc.token})
+
+			rr := doAdminCall(t, c, capabilitiesEndpoint, http.MethodGet, tc.authHeader, nil)
+			require.Equal(t, http.StatusUnauthorized, rr.Code)
+			require.Equal(t, errUnauthorized.Error(), rr.Body.String())
+		})
+	}
+}
+
+func TestReadRootCapabilities(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		capabilityStore := &mockCapabilityStore{rootCapabilities: []zcapld.RootCapability{
+			{ID: "urn:uuid:1", Resource: "vault1"},
+			{ID: "urn:uuid:2", Resource: "vault2"},
+		}}
+		c := New(&Config{CapabilityStore: capabilityStore, Token: testToken})
+
+		rr := doAdminCall(t, c, capabilitiesEndpoint+"?resource=vault1", http.MethodGet, "Bearer "+testToken, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		require.Equal(t, "vault1", capabilityStore.requestedResourceID)
+
+		var rootCapabilities []zcapld.RootCapability
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &rootCapabilities))
+		require.Equal(t, capabilityStore.rootCapabilities, rootCapabilities)
+	})
+	t.Run("error", func(t *testing.T) {
+		c := New(&Config{
+			CapabilityStore: &mockCapabilityStore{rootCapabilitiesErr: errors.New("read error")},
+			Token:           testToken,
+		})
+
+		rr := doAdminCall(t, c, capabilitiesEndpoint, http.MethodGet, "Bearer "+testToken, nil)
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Equal(t, "failed to read root capabilities: read error", rr.Body.String())
+	})
+}
+
+func TestReadOrphanedRootCapabilities(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		c := New(&Config{
+			CapabilityStore: &mockCapabilityStore{rootCapabilities: []zcapld.RootCapability{
+				{ID: "urn:uuid:1", Resource: "vault1"},
+				{ID: "urn:uuid:2", Resource: "vault2"},
+			}},
+			VaultProvider: &mockVaultProvider{existingVaults: map[string]bool{"vault1": true}},
+			Token:         testToken,
+		})
+
+		rr := doAdminCall(t, c, orphanedCapabilitiesEndpoint, http.MethodGet, "Bearer "+testToken, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var rootCapabilities []zcapld.RootCapability
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &rootCapabilities))
+		require.Equal(t, []zcapld.RootCapability{{ID: "urn:uuid:2", Resource: "vault2"}}, rootCapabilities)
+	})
+	t.Run("error", func(t *testing.T) {
+		c := New(&Config{
+			CapabilityStore: &mockCapabilityStore{rootCapabilities: []zcapld.RootCapability{{Resource: "vault1"}}},
+			VaultProvider:   &mockVaultProvider{storeExistsErr: errors.New("exists error")},
+			Token:           testToken,
+		})
+
+		rr := doAdminCall(t, c, orphanedCapabilitiesEndpoint, http.MethodGet, "Bearer "+testToken, nil)
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Equal(t, "failed to read orphaned root capabilities: exists error", rr.Body.String())
+	})
+}
+
+func TestDeleteOrphanedCapabilities(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		capabilityStore := &mockCapabilityStore{rootCapabilities: []zcapld.RootCapability{
+			{ID: "urn:uuid:1", Resource: "vault1"},
+			{ID: "urn:uuid:2", Resource: "vault2"},
+			{ID: "urn:uuid:3", Resource: "vault3"},
+		}}
+		c := New(&Config{
+			CapabilityStore: capabilityStore,
+			VaultProvider:   &mockVaultProvider{existingVaults: map[string]bool{"vault1": true}},
+			Token:           testToken,
+		})
+
+		rr := doAdminCall(t, c, orphanedCapabilitiesEndpoint, http.MethodDelete, "Bearer "+testToken, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, []string{"vault2", "vault3"}, capabilityStore.deletedResourceIDs)
+
+		var rootCapabilities []zcapld.RootCapability
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &rootCapabilities))
+		require.Len(t, rootCapabilities, 2)
+	})
+	t.Run("error while finding orphaned root capabilities", func(t *testing.T) {
+		c := New(&Config{
+			CapabilityStore: &mockCapabilityStore{rootCapabilitiesErr: errors.New("read error")},
+			VaultProvider:   &mockVaultProvider{},
+			Token:           testToken,
+		})
+
+		rr := doAdminCall(t, c, orphanedCapabilitiesEndpoint, http.MethodDelete, "Bearer "+testToken, nil)
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Equal(t, "failed to read orphaned root capabilities: read error", rr.Body.String())
+	})
+	t.Run("error while deleting", func(t *testing.T) {
+		c := New(&Config{
+			CapabilityStore: &mockCapabilityStore{
+				rootCapabilities: []zcapld.RootCapability{{ID: "urn:uuid:1", Resource: "vault1"}},
+				deleteErr:        errors.New("delete error"),
+			},
+			VaultProvider: &mockVaultProvider{},
+			Token:         testToken,
+		})
+
+		rr := doAdminCall(t, c, orphanedCapabilitiesEndpoint, http.MethodDelete, "Bearer "+testToken, nil)
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Equal(t, "failed to delete capabilities for resource vault1: delete error", rr.Body.String())
+	})
+}
+
+func TestDeleteResourceCapabilities(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		capabilityStore := &mockCapabilityStore{}
+		c := New(&Config{CapabilityStore: capabilityStore, VaultProvider: &mockVaultProvider{}, Token: testToken})
+
+		rr := doAdminCall(t, c, resourceCapabilitiesEndpoint, http.MethodDelete, "Bearer "+testToken,
+			map[string]string{resourceIDPathVariable: "vault1"})
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, []string{"vault1"}, capabilityStore.deletedResourceIDs)
+	})
+	t.Run("vault still exists", func(t *testing.T) {
+		capabilityStore := &mockCapabilityStore{}
+		c := New(&Config{
+			CapabilityStore: capabilityStore,
+			VaultProvider:   &mockVaultProvider{existingVaults: map[string]bool{"vault1": true}},
+			Token:           testToken,
+		})
+
+		rr := doAdminCall(t, c, resourceCapabilitiesEndpoint, http.MethodDelete, "Bearer "+testToken,
+			map[string]string{resourceIDPathVariable: "vault1"})
+		require.Equal(t, http.StatusConflict, rr.Code)
+		require.Empty(t, capabilityStore.deletedResourceIDs)
+	})
+	t.Run("no capabilities for resource", func(t *testing.T) {
+		c := New(&Config{
+			CapabilityStore: &mockCapabilityStore{deleteErr: fmt.Errorf("%w: vault1", zcapld.ErrCapabilityNotFound)},
+			VaultProvider:   &mockVaultProvider{},
+			Token:           testToken,
+		})
+
+		rr := doAdminCall(t, c, resourceCapabilitiesEndpoint, http.MethodDelete, "Bearer "+testToken,
+			map[string]string{resourceIDPathVariable: "vault1"})
+		require.Equal(t, http.StatusNotFound, rr.Code)
+	})
+	t.Run("error while deleting", func(t *testing.T) {
+		c := New(&Config{
+			CapabilityStore: &mockCapabilityStore{deleteErr: errors.New("delete error")},
+			VaultProvider:   &mockVaultProvider{},
+			Token:           testToken,
+		})
+
+		rr := doAdminCall(t, c, resourceCapabilitiesEndpoint, http.MethodDelete, "Bearer "+testToken,
+			map[string]string{resourceIDPathVariable: "vault1"})
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Equal(t, "failed to delete capabilities for resource vault1: delete error", rr.Body.String())
+	})
+	t.Run("error while checking whether vault exists", func(t *testing.T) {
+		c := New(&Config{
+			CapabilityStore: &mockCapabilityStore{},
+			VaultProvider:   &mockVaultProvider{storeExistsErr: errors.New("exists error")},
+			Token:           testToken,
+		})
+
+		rr := doAdminCall(t, c, resourceCapabilitiesEndpoint, http.MethodDelete, "Bearer "+testToken,
+			map[string]string{resourceIDPathVariable: "vault1"})
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Equal(t, "failed to determine whether resource vault1 exists: exists error", rr.Body.String())
+	})
+	t.Run("unable to escape resource ID", func(t *testing.T) {
+		c := New(&Config{CapabilityStore: &mockCapabilityStore{}, VaultProvider: &mockVaultProvider{}, Token: testToken})
+
+		rr := doAdminCall(t, c, resourceCapabilitiesEndpoint, http.MethodDelete, "Bearer "+testToken,
+			map[string]string{resourceIDPathVariable: "%"})
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestReplicate(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		replicator := &mockReplicator{result: &models.ReplicationResult{DocumentsReplicated: 2, DocumentsDeleted: 1}}
+		c := New(&Config{Replicator: replicator, Token: testToken})
+
+		rr := doAdminCallWithBody(t, c, replicateEndpoint, http.MethodPost, "Bearer "+testToken,
+			map[string]string{vaultIDPathVariable: "vault1"},
+			[]byte(`{"targetUrl":"https://example.com","targetToken":"targetToken"}`))
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "vault1", replicator.vaultID)
+		require.Equal(t, &replication.Target{URL: "https://example.com", Token: "targetToken"}, replicator.target)
+
+		var result models.ReplicationResult
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+		require.Equal(t, replicator.result, &result)
+	})
+	t.Run("error", func(t *testing.T) {
+		for _, tc := range []struct {
+			err        error
+			statusCode int
+		}{
+			{err: replication.ErrInvalidTarget, statusCode: http.StatusBadRequest},
+			{err: messages.ErrVaultNotFound, statusCode: http.StatusNotFound},
+			{err: fmt.Errorf("%w: unreachable", replication.ErrTargetFailure), statusCode: http.StatusBadGateway},
+			{err: errors.New("replicate error"), statusCode: http.StatusInternalServerError},
+		} {
+			c := New(&Config{Replicator: &mockReplicator{err: tc.err}, Token: testToken})
+
+			rr := doAdminCallWithBody(t, c, replicateEndpoint, http.MethodPost, "Bearer "+testToken,
+				map[string]string{vaultIDPathVariable: "vault1"}, []byte(`{}`))
+			require.Equal(t, tc.statusCode, rr.Code, tc.err.Error())
+			require.Equal(t, "failed to replicate vault vault1: "+tc.err.Error(), rr.Body.String())
+		}
+	})
+	t.Run("invalid request", func(t *testing.T) {
+		c := New(&Config{Replicator: &mockReplicator{}, Token: testToken})
+
+		rr := doAdminCallWithBody(t, c, replicateEndpoint, http.MethodPost, "Bearer "+testToken,
+			map[string]string{vaultIDPathVariable: "vault1"}, []byte("not json"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "invalid replication request")
+	})
+	t.Run("unable to escape vault ID", func(t *testing.T) {
+		c := New(&Config{Replicator: &mockReplicator{}, Token: testToken})
+
+		rr := doAdminCall(t, c, replicateEndpoint, http.MethodPost, "Bearer "+testToken,
+			map[string]string{vaultIDPathVariable: "%"})
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestReceiveReplica(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		receiver := &mockReplicaReceiver{}
+		c := New(&Config{ReplicaReceiver: receiver, Token: testToken})
+
+		rr := doAdminCallWithBody(t, c, replicaEndpoint, http.MethodPost, "Bearer "+testToken,
+			map[string]string{vaultIDPathVariable: "vault1"}, []byte(`{"deletedDocumentIds":["doc1"]}`))
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "vault1", receiver.vaultID)
+		require.Equal(t, &models.ReplicationBatch{DeletedDocumentIDs: []string{"doc1"}}, receiver.batch)
+	})
+	t.Run("error", func(t *testing.T) {
+		for _, tc := range []struct {
+			err        error
+			statusCode int
+		}{
+			{err: messages.ErrInvalidReplicatedDocument, statusCode: http.StatusBadRequest},
+			{err: zcapld.ErrInvocationInvalid, statusCode: http.StatusBadRequest},
+			{err: messages.ErrVaultNotFound, statusCode: http.StatusNotFound},
+			{err: errors.New("apply error"), statusCode: http.StatusInternalServerError},
+		} {
+			c := New(&Config{ReplicaReceiver: &mockReplicaReceiver{err: tc.err}, Token: testToken})
+
+			rr := doAdminCallWithBody(t, c, replicaEndpoint, http.MethodPost, "Bearer "+testToken,
+				map[string]string{vaultIDPathVariable: "vault1"}, []byte(`{}`))
+			require.Equal(t, tc.statusCode, rr.Code, tc.err.Error())
+			require.Equal(t, "failed to apply replication batch to vault vault1: "+tc.err.Error(), rr.Body.String())
+		}
+	})
+	t.Run("invalid batch", func(t *testing.T) {
+		c := New(&Config{ReplicaReceiver: &mockReplicaReceiver{}, Token: testToken})
+
+		rr := doAdminCallWithBody(t, c, replicaEndpoint, http.MethodPost, "Bearer "+testToken,
+			map[string]string{vaultIDPathVariable: "vault1"}, []byte("not json"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "invalid replication batch")
+	})
+	t.Run("unable to escape vault ID", func(t *testing.T) {
+		c := New(&Config{ReplicaReceiver: &mockReplicaReceiver{}, Token: testToken})
+
+		rr := doAdminCall(t, c, replicaEndpoint, http.MethodPost, "Bearer "+testToken,
+			map[string]string{vaultIDPathVariable: "%"})
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestCheckConsistency(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		checker := &mockConsistencyChecker{report: &models.ConsistencyReport{
+			VaultID: "vault1", DocumentsChecked: 2, MappingDocumentsChecked: 3, OrphanedMappingDocuments: 1,
+		}}
+		c := New(&Config{ConsistencyChecker: checker, Token: testToken})
+
+		rr := doAdminCall(t, c, consistencyCheckEndpoint, http.MethodPost, "Bearer "+testToken,
+			map[string]string{vaultIDPathVariable: "vault1"})
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "vault1", checker.vaultID)
+
+		var report models.ConsistencyReport
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+		require.Equal(t, checker.report, &report)
+	})
+	t.Run("error", func(t *testing.T) {
+		for _, tc := range []struct {
+			err        error
+			statusCode int
+		}{
+			{err: messages.ErrVaultNotFound, statusCode: http.StatusNotFound},
+			{err: errors.New("check error"), statusCode: http.StatusInternalServerError},
+		} {
+			c := New(&Config{ConsistencyChecker: &mockConsistencyChecker{err: tc.err}, Token: testToken})
+
+			rr := doAdminCall(t, c, consistencyCheckEndpoint, http.MethodPost, "Bearer "+testToken,
+				map[string]string{vaultIDPathVariable: "vault1"})
+			require.Equal(t, tc.statusCode, rr.Code, tc.err.Error())
+			require.Equal(t, "failed to check consistency of vault vault1: "+tc.err.Error(), rr.Body.String())
+		}
+	})
+	t.Run("unable to escape vault ID", func(t *testing.T) {
+		c := New(&Config{ConsistencyChecker: &mockConsistencyChecker{}, Token: testToken})
+
+		rr := doAdminCall(t, c, consistencyCheckEndpoint, http.MethodPost, "Bearer "+testToken,
+			map[string]string{vaultIDPathVariable: "%"})
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestRotateEncryptionKey(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		rotator := &mockEncryptionKeyRotator{
+			rotation: &models.EncryptionKeyRotation{KeyID: "key2", DataKeysRewrapped: 3},
+		}
+		c := New(&Config{EncryptionKeyRotator: rotator, Token: testToken})
+
+		rr := doAdminCall(t, c, encryptionKeyRotateEndpoint, http.MethodPost, "Bearer "+testToken, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var rotation models.EncryptionKeyRotation
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &rotation))
+		require.Equal(t, rotator.rotation, &rotation)
+	})
+	t.Run("error", func(t *testing.T) {
+		c := New(&Config{
+			EncryptionKeyRotator: &mockEncryptionKeyRotator{err: errors.New("rotate error")}, Token: testToken,
+		})
+
+		rr := doAdminCall(t, c, encryptionKeyRotateEndpoint, http.MethodPost, "Bearer "+testToken, nil)
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Equal(t, "failed to rotate encryption key: rotate error", rr.Body.String())
+	})
+}
+
+func TestReadAuditEntries(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		auditLog := &mockAuditLog{entries: []audit.Entry{{ID: "entry1", Operation: audit.ReadDocumentOperation}}}
+		c := New(&Config{AuditLog: auditLog, Token: testToken})
+
+		rr := doAdminCall(t, c, auditEndpoint+"?vault=vault1&actor=did:example:alice&operation=read-document"+
+			"&since=2021-06-01T00:00:00Z&until=2021-06-02T00:00:00Z&limit=10", http.MethodGet, "Bearer "+testToken, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, &audit.Query{
+			VaultID:   "vault1",
+			Actor:     "did:example:alice",
+			Operation: audit.ReadDocumentOperation,
+			Since:     time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+			Until:     time.Date(2021, 6, 2, 0, 0, 0, 0, time.UTC),
+			Limit:     10,
+		}, auditLog.query)
+
+		var entries []audit.Entry
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &entries))
+		require.Equal(t, auditLog.entries, entries)
+	})
+	t.Run("no entries", func(t *testing.T) {
+		c := New(&Config{AuditLog: &mockAuditLog{}, Token: testToken})
+
+		rr := doAdminCall(t, c, auditEndpoint, http.MethodGet, "Bearer "+testToken, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "[]\n", rr.Body.String())
+	})
+	t.Run("invalid query", func(t *testing.T) {
+		c := New(&Config{AuditLog: &mockAuditLog{}, Token: testToken})
+
+		for _, query := range []string{"?since=yesterday", "?until=2021-06-01", "?limit=0", "?limit=ten"} {
+			rr := doAdminCall(t, c, auditEndpoint+query, http.MethodGet, "Bearer "+testToken, nil)
+			require.Equal(t, http.StatusBadRequest, rr.Code, query)
+			require.Contains(t, rr.Body.String(), "invalid audit query", query)
+		}
+	})
+	t.Run("query error", func(t *testing.T) {
+		c := New(&Config{AuditLog: &mockAuditLog{err: errors.New("query error")}, Token: testToken})
+
+		rr := doAdminCall(t, c, auditEndpoint, http.MethodGet, "Bearer "+testToken, nil)
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Equal(t, "failed to query audit entries: query error", rr.Body.String())
+	})
+}
+
+func doAdminCall(t *testing.T, c *Operation, endpoint, method, authHeader string,
+	urlVars map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	return doAdminCallWithBody(t, c, endpoint, method, authHeader, urlVars, nil)
+}
+
+func doAdminCallWithBody(t *testing.T, c *Operation, endpoint, method, authHeader string,
+	urlVars map[string]string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, endpoint, bytes.NewReader(body))
+
+	if authHeader != "" {
+		req.Header.Set("Authorization", authHeader)
+	}
+
+	if urlVars != nil {
+		req = mux.SetURLVars(req, urlVars)
+	}
+
+	rr := httptest.NewRecorder()
+
+	for _, handler := range c.GetRESTHandlers() {
+		if handler.Method() == method && handler.Path() == strings.SplitN(endpoint, "?", 2)[0] {
+			handler.Handle().ServeHTTP(rr, req)
+
+			return rr
+		}
+	}
+
+	require.FailNow(t, "no handler found for "+method+" "+endpoint)
+
+	return nil
+}
+
+func TestCreateTenant(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		registry := &mockTenantRegistry{token: "tenantToken"}
+		c := New(&Config{TenantRegistry: registry, Token: testToken})
+
+		rr := doAdminCallWithBody(t, c, tenantsEndpoint, http.MethodPost, "Bearer "+testToken, nil,
+			[]byte(`{"id":"tenant-1","quotas":{"maxVaults":2}}`))
+		require.Equal(t, http.StatusCreated, rr.Code)
+		require.Equal(t, "/admin/tenants/tenant-1", rr.Header().Get("Location"))
+		require.Equal(t, &models.Tenant{ID: "tenant-1", Quotas: models.TenantQuotas{MaxVaults: 2}}, registry.tenant)
+
+		var provisioned models.ProvisionedTenant
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &provisioned))
+		require.Equal(t, "tenantToken", provisioned.Token)
+		require.Equal(t, *registry.tenant, provisioned.Tenant)
+	})
+	t.Run("error", func(t *testing.T) {
+		for _, tc := range []struct {
+			err        error
+			statusCode int
+		}{
+			{err: messages.ErrInvalidTenantID, statusCode: http.StatusBadRequest},
+			{err: messages.ErrDuplicateTenant, statusCode: http.StatusConflict},
+			{err: errors.New("create error"), statusCode: http.StatusInternalServerError},
+		} {
+			c := New(&Config{TenantRegistry: &mockTenantRegistry{err: tc.err}, Token: testToken})
+
+			rr := doAdminCallWithBody(t, c, tenantsEndpoint, http.MethodPost, "Bearer "+testToken, nil,
+				[]byte(`{"id":"tenant-1"}`))
+			require.Equal(t, tc.statusCode, rr.Code, tc.err.Error())
+			require.Equal(t, "failed to create tenant tenant-1: "+tc.err.Error(), rr.Body.String())
+		}
+	})
+	t.Run("invalid request", func(t *testing.T) {
+		c := New(&Config{TenantRegistry: &mockTenantRegistry{}, Token: testToken})
+
+		rr := doAdminCallWithBody(t, c, tenantsEndpoint, http.MethodPost, "Bearer "+testToken, nil,
+			[]byte("not json"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "invalid tenant")
+	})
+}
+
+func TestReadTenant(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		registry := &mockTenantRegistry{status: &models.TenantStatus{
+			Tenant: models.Tenant{ID: "tenant-1"},
+			Usage:  models.TenantUsage{Vaults: 1, Documents: 2, Bytes: 3},
+		}}
+		c := New(&Config{TenantRegistry: registry, Token: testToken})
+
+		rr := doAdminCall(t, c, tenantEndpoint, http.MethodGet, "Bearer "+testToken,
+			map[string]string{tenantIDPathVariable: "tenant-1"})
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "tenant-1", registry.tenantID)
+
+		var status models.TenantStatus
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &status))
+		require.Equal(t, registry.status, &status)
+	})
+	t.Run("error", func(t *testing.T) {
+		for _, tc := range []struct {
+			err        error
+			statusCode int
+		}{
+			{err: messages.ErrTenantNotFound, statusCode: http.StatusNotFound},
+			{err: errors.New("read error"), statusCode: http.StatusInternalServerError},
+		} {
+			c := New(&Config{TenantRegistry: &mockTenantRegistry{err: tc.err}, Token: testToken})
+
+			rr := doAdminCall(t, c, tenantEndpoint, http.MethodGet, "Bearer "+testToken,
+				map[string]string{tenantIDPathVariable: "tenant-1"})
+			require.Equal(t, tc.statusCode, rr.Code, tc.err.Error())
+			require.Equal(t, "failed to read tenant tenant-1: "+tc.err.Error(), rr.Body.String())
+		}
+	})
+	t.Run("unable to escape tenant ID", func(t *testing.T) {
+		c := New(&Config{TenantRegistry: &mockTenantRegistry{}, Token: testToken})
+
+		rr := doAdminCall(t, c, tenantEndpoint, http.MethodGet, "Bearer "+testToken,
+			map[string]string{tenantIDPathVariable: "%"})
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestSetTenantQuotas(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		registry := &mockTenantRegistry{}
+		c := New(&Config{TenantRegistry: registry, Token: testToken})
+
+		rr := doAdminCallWithBody(t, c, tenantQuotasEndpoint, http.MethodPut, "Bearer "+testToken,
+			map[string]string{tenantIDPathVariable: "tenant-1"}, []byte(`{"maxDocuments":10,"maxBytes":1024}`))
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "tenant-1", registry.tenantID)
+
+		var tenant models.Tenant
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &tenant))
+		require.Equal(t, models.Tenant{ID: "tenant-1", Quotas: models.TenantQuotas{MaxDocuments: 10, MaxBytes: 1024}},
+			tenant)
+	})
+	t.Run("error", func(t *testing.T) {
+		c := New(&Config{TenantRegistry: &mockTenantRegistry{err: messages.ErrTenantNotFound}, Token: testToken})
+
+		rr := doAdminCallWithBody(t, c, tenantQuotasEndpoint, http.MethodPut, "Bearer "+testToken,
+			map[string]string{tenantIDPathVariable: "tenant-1"}, []byte(`{}`))
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Equal(t, "failed to set quotas of tenant tenant-1: specified tenant does not exist", rr.Body.String())
+	})
+	t.Run("invalid request", func(t *testing.T) {
+		c := New(&Config{TenantRegistry: &mockTenantRegistry{}, Token: testToken})
+
+		rr := doAdminCallWithBody(t, c, tenantQuotasEndpoint, http.MethodPut, "Bearer "+testToken,
+			map[string]string{tenantIDPathVariable: "tenant-1"}, []byte("not json"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "invalid tenant quotas")
+	})
+	t.Run("unable to escape tenant ID", func(t *testing.T) {
+		c := New(&Config{TenantRegistry: &mockTenantRegistry{}, Token: testToken})
+
+		rr := doAdminCall(t, c, tenantQuotasEndpoint, http.MethodPut, "Bearer "+testToken,
+			map[string]string{tenantIDPathVariable: "%"})
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestVaultLimits(t *testing.T) {
+	const controller = "did:example:controller"
+
+	endpoint := vaultLimitEndpoint + "?" + url.Values{controllerQueryParameter: {controller}}.Encode()
+
+	t.Run("success", func(t *testing.T) {
+		registry := &mockVaultLimitRegistry{}
+		c := New(&Config{VaultLimits: registry, Token: testToken})
+
+		rr := doAdminCallWithBody(t, c, endpoint, http.MethodPut, "Bearer "+testToken, nil, []byte(`{"maxVaults":5}`))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var limit models.ControllerVaultLimit
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &limit))
+		require.Equal(t, models.ControllerVaultLimit{Controller: controller, MaxVaults: 5, Override: true}, limit)
+
+		rr = doAdminCall(t, c, endpoint, http.MethodGet, "Bearer "+testToken, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, controller, registry.controller)
+
+		rr = doAdminCall(t, c, endpoint, http.MethodDelete, "Bearer "+testToken, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &limit))
+		require.Equal(t, models.ControllerVaultLimit{Controller: controller}, limit)
+	})
+	t.Run("error", func(t *testing.T) {
+		c := New(&Config{VaultLimits: &mockVaultLimitRegistry{err: errors.New("store error")}, Token: testToken})
+
+		for method, body := range map[string][]byte{
+			http.MethodGet:    nil,
+			http.MethodPut:    []byte(`{"maxVaults":5}`),
+			http.MethodDelete: nil,
+		} {
+			rr := doAdminCallWithBody(t, c, endpoint, method, "Bearer "+testToken, nil, body)
+			require.Equal(t, http.StatusInternalServerError, rr.Code, method)
+			require.Contains(t, rr.Body.String(), "vault limit of controller did:example:controller: store error")
+		}
+	})
+	t.Run("invalid request", func(t *testing.T) {
+		c := New(&Config{VaultLimits: &mockVaultLimitRegistry{}, Token: testToken})
+
+		rr := doAdminCallWithBody(t, c, endpoint, http.MethodPut, "Bearer "+testToken, nil, []byte("not json"))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "invalid vault limit")
+
+		for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+			rr = doAdminCall(t, c, vaultLimitEndpoint, method, "Bearer "+testToken, nil)
+			require.Equal(t, http.StatusBadRequest, rr.Code)
+			require.Equal(t, "the controller query parameter is required", rr.Body.String())
+		}
+	})
+}
+
+type mockCapabilityStore struct {
+	rootCapabilities    []zcapld.RootCapability
+	rootCapabilitiesErr error
+	deleteErr           error
+	requestedResourceID string
+	deletedResourceIDs  []string
+}
+
+func (m *mockCapabilityStore) RootCapabilities(resourceID string) ([]zcapld.RootCapability, error) {
+	m.requestedResourceID = resourceID
+
+	return m.rootCapabilities, m.rootCapabilitiesErr
+}
+
+func (m *mockCapabilityStore) OrphanedRootCapabilities(
+	resourceExists func(resourceID string) (bool, error)) ([]zcapld.RootCapability, error) {
+	if m.rootCapabilitiesErr != nil {
+		return nil, m.rootCapabilitiesErr
+	}
+
+	orphanedRootCapabilities := []zcapld.RootCapability{}
+
+	for _, rootCapability := range m.rootCapabilities {
+		exists, err := resourceExists(rootCapability.Resource)
+		if err != nil {
+			return nil, err
+		}
+
+		if !exists {
+			orphanedRootCapabilities = append(orphanedRootCapabilities, rootCapability)
+		}
+	}
+
+	return orphanedRootCapabilities, nil
+}
+
+func (m *mockCapabilityStore) DeleteCapabilities(resourceID string) error {
+	if m.deleteErr != nil {
+		return m.deleteErr
+	}
+
+	m.deletedResourceIDs = append(m.deletedResourceIDs, resourceID)
+
+	return nil
+}
+
+type mockVaultProvider struct {
+	existingVaults map[string]bool
+	storeExistsErr error
+}
+
+func (m *mockVaultProvider) StoreExists(name string) (bool, error) {
+	return m.existingVaults[name], m.storeExistsErr
+}
+
+type mockReplicator struct {
+	result  *models.ReplicationResult
+	err     error
+	vaultID string
+	target  *replication.Target
+}
+
+func (m *mockReplicator) Replicate(vaultID string, target *replication.Target) (*models.ReplicationResult, error) {
+	m.vaultID = vaultID
+	m.target = target
+
+	return m.result, m.err
+}
+
+type mockReplicaReceiver struct {
+	err     error
+	vaultID string
+	batch   *models.ReplicationBatch
+}
+
+func (m *mockReplicaReceiver) Apply(vaultID string, batch *models.ReplicationBatch) error {
+	m.vaultID = vaultID
+	m.batch = batch
+
+	return m.err
+}
+
+type mockConsistencyChecker struct {
+	report  *models.ConsistencyReport
+	err     error
+	vaultID string
+}
+
+func (m *mockConsistencyChecker) CheckConsistency(vaultID string) (*models.ConsistencyReport, error) {
+	m.vaultID = vaultID
+
+	return m.report, m.err
+}
+
+type mockAuditLog struct {
+	entries []audit.Entry
+	err     error
+	query   *audit.Query
+}
+
+func (m *mockAuditLog) Query(query *audit.Query) ([]audit.Entry, error) {
+	m.query = query
+
+	return m.entries, m.err
+}
+
+type mockTenantRegistry struct {
+	token    string
+	status   *models.TenantStatus
+	err      error
+	tenant   *models.Tenant
+	tenantID string
+}
+
+func (m *mockTenantRegistry) CreateTenant(tenant *models.Tenant) (string, error) {
+	m.tenant = tenant
+
+	return m.token, m.err
+}
+
+func (m *mockTenantRegistry) Tenant(tenantID string) (*models.TenantStatus, error) {
+	m.tenantID = tenantID
+
+	return m.status, m.err
+}
+
+func (m *mockTenantRegistry) SetTenantQuotas(tenantID string, quotas models.TenantQuotas) (*models.Tenant, error) {
+	m.tenantID = tenantID
+
+	return &models.Tenant{ID: tenantID, Quotas: quotas}, m.err
+}
+
+type mockVaultLimitRegistry struct {
+	err        error
+	controller string
+}
+
+func (m *mockVaultLimitRegistry) VaultLimit(controller string) (*models.ControllerVaultLimit, error) {
+	m.controller = controller
+
+	return &models.ControllerVaultLimit{Controller: controller}, m.err
+}
+
+func (m *mockVaultLimitRegistry) SetVaultLimit(controller string,
+	maxVaults uint64) (*models.ControllerVaultLimit, error) {
+	return &models.ControllerVaultLimit{Controller: controller, MaxVaults: maxVaults, Override: true}, m.err
+}
+
+func (m *mockVaultLimitRegistry) DeleteVaultLimit(controller string) (*models.ControllerVaultLimit, error) {
+	return &models.ControllerVaultLimit{Controller: controller}, m.err
+}
+
+type mockEncryptionKeyRotator struct {
+	rotation *models.EncryptionKeyRotation
+	err      error
+}
+
+func (m *mockEncryptionKeyRotator) RotateEncryptionKey() (*models.EncryptionKeyRotation, error) {
+	return m.rotation, m.err
+}
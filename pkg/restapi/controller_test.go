@@ -35,7 +35,7 @@ func TestController_GetOperations(t *testing.T) {
 
 	ops := controller.GetOperations()
 
-	require.Equal(t, 6, len(ops))
+	require.Equal(t, 16, len(ops))
 
 	// Create vault
 	require.Equal(t, "/encrypted-data-vaults", ops[0].Path())
@@ -66,4 +66,34 @@ func TestController_GetOperations(t *testing.T) {
 	require.Equal(t, "/encrypted-data-vaults/{vaultID}/documents/{docID}", ops[5].Path())
 	require.Equal(t, http.MethodDelete, ops[5].Method())
 	require.NotNil(t, ops[5].Handle())
+
+	// Delete vault
+	require.Equal(t, "/encrypted-data-vaults/{vaultID}", ops[6].Path())
+	require.Equal(t, http.MethodDelete, ops[6].Method())
+	require.NotNil(t, ops[6].Handle())
+
+	// Restore document
+	require.Equal(t, "/encrypted-data-vaults/{vaultID}/documents/{docID}/restore", ops[7].Path())
+	require.Equal(t, http.MethodPost, ops[7].Method())
+	require.NotNil(t, ops[7].Handle())
+
+	// Update vault configuration
+	require.Equal(t, "/encrypted-data-vaults/{vaultID}/configuration", ops[8].Path())
+	require.Equal(t, http.MethodPatch, ops[8].Method())
+	require.NotNil(t, ops[8].Handle())
+
+	// List documents
+	require.Equal(t, "/encrypted-data-vaults/{vaultID}/documents", ops[9].Path())
+	require.Equal(t, http.MethodGet, ops[9].Method())
+	require.NotNil(t, ops[9].Handle())
+
+	// Check document
+	require.Equal(t, "/encrypted-data-vaults/{vaultID}/documents/{docID}", ops[10].Path())
+	require.Equal(t, http.MethodHead, ops[10].Method())
+	require.NotNil(t, ops[10].Handle())
+
+	// Count query
+	require.Equal(t, "/encrypted-data-vaults/{vaultID}/query", ops[13].Path())
+	require.Equal(t, http.MethodHead, ops[13].Method())
+	require.NotNil(t, ops[13].Handle())
 }
@@ -9,6 +9,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/healthcheck/operation"
 )
 
 func TestController_New(t *testing.T) {
@@ -17,6 +19,10 @@ func TestController_New(t *testing.T) {
 		require.NotNil(t, controller)
 		ops := controller.GetOperations()
 
-		require.Equal(t, 1, len(ops))
+		require.Equal(t, 2, len(ops))
+	})
+	t.Run("test success with build info", func(t *testing.T) {
+		controller := New(operation.WithBuildInfo(&operation.BuildInfo{}))
+		require.Equal(t, 3, len(controller.GetOperations()))
 	})
 }
@@ -7,27 +7,103 @@ package operation
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"sort"
+	"sync"
 	"time"
 
-	"github.com/trustbloc/edge-core/pkg/log"
-
+	"github.com/trustbloc/edv/pkg/auth"
 	"github.com/trustbloc/edv/pkg/internal/common/support"
+	"github.com/trustbloc/edv/pkg/logging"
 )
 
 // API endpoints.
 const (
 	logModuleName       = "edv-healthcheck-restapi"
 	healthCheckEndpoint = "/healthcheck"
+	versionEndpoint     = "/version"
+	readyEndpoint       = "/ready"
+
+	// DefaultReadinessTimeout is how long each readiness check has to pass before its dependency is reported as down.
+	DefaultReadinessTimeout = 5 * time.Second
 )
 
-var logger = log.New(logModuleName)
+var logger = logging.New(logModuleName)
 
 type healthCheckResp struct {
 	Status      string    `json:"status"`
 	CurrentTime time.Time `json:"currentTime"`
 }
 
+type readinessResp struct {
+	Status       string                       `json:"status"`
+	CurrentTime  time.Time                    `json:"currentTime"`
+	Dependencies map[string]*dependencyStatus `json:"dependencies"`
+}
+
+type dependencyStatus struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ReadinessCheck checks that a dependency of the EDV server, such as its database, can be used. It returns an error
+// if it can't.
+type ReadinessCheck func() error
+
+// BuildInfo identifies the build of the EDV server that's running and how it's deployed.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	// Extensions are the names of the enabled extensions.
+	Extensions     []string `json:"extensions"`
+	StorageBackend string   `json:"storageBackend"`
+}
+
+// Option configures an Operation.
+type Option func(o *Operation)
+
+// WithBuildInfo adds a GET /version endpoint that responds with the given build info.
+func WithBuildInfo(buildInfo *BuildInfo) Option {
+	return func(o *Operation) {
+		o.buildInfo = buildInfo
+	}
+}
+
+// WithProtectedResourceMetadata adds a GET endpoint at auth.ProtectedResourceMetadataPath that responds with the given
+// metadata. If the metadata has no resource, then the URL that it's requested at is used.
+func WithProtectedResourceMetadata(metadata *auth.ProtectedResourceMetadata) Option {
+	return func(o *Operation) {
+		o.resourceMetadata = metadata
+	}
+}
+
+// WithReadinessCheck adds a check of the named dependency to the GET /ready endpoint. The EDV server is only ready
+// if all of its dependencies pass their checks.
+func WithReadinessCheck(name string, check ReadinessCheck) Option {
+	return func(o *Operation) {
+		o.readinessChecks[name] = check
+	}
+}
+
+// WithReadinessTimeout sets how long each readiness check has to pass before its dependency is reported as down.
+// Defaults to DefaultReadinessTimeout.
+func WithReadinessTimeout(timeout time.Duration) Option {
+	return func(o *Operation) {
+		o.readinessTimeout = timeout
+	}
+}
+
+// WithLogger has the handlers log with the given logger instead of the edge-core logger for the healthcheck module.
+// The lines logged while handling a request include its correlation ID (see logging.Middleware).
+func WithLogger(logger logging.Logger) Option {
+	return func(o *Operation) {
+		o.logger = logger
+	}
+}
+
 // Handler http handler for each controller API endpoint.
 type Handler interface {
 	Path() string
@@ -36,19 +112,49 @@ type Handler interface {
 }
 
 // New returns CreateCredential instance.
-func New() *Operation {
-	return &Operation{}
+func New(opts ...Option) *Operation {
+	o := &Operation{
+		readinessChecks: make(map[string]ReadinessCheck), readinessTimeout: DefaultReadinessTimeout, logger: logger,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
 }
 
 // Operation defines handlers for rp operations.
 type Operation struct {
+	buildInfo        *BuildInfo
+	resourceMetadata *auth.ProtectedResourceMetadata
+	readinessChecks  map[string]ReadinessCheck
+	readinessTimeout time.Duration
+	logger           logging.Logger
 }
 
 // GetRESTHandlers get all controller API handler available for this service.
 func (o *Operation) GetRESTHandlers() []Handler {
-	return []Handler{
+	handlers := []Handler{
 		support.NewHTTPHandler(healthCheckEndpoint, http.MethodGet, o.healthCheckHandler),
+		support.NewHTTPHandler(readyEndpoint, http.MethodGet, o.readyHandler),
+	}
+
+	if o.buildInfo != nil {
+		handlers = append(handlers, support.NewHTTPHandler(versionEndpoint, http.MethodGet, o.versionHandler))
+	}
+
+	if o.resourceMetadata != nil {
+		handlers = append(handlers, support.NewHTTPHandler(auth.ProtectedResourceMetadataPath, http.MethodGet,
+			o.resourceMetadataHandler))
 	}
+
+	return handlers
+}
+
+// requestLogger returns the logger for the given request, which includes the request's correlation ID in each line.
+func (o *Operation) requestLogger(r *http.Request) logging.Logger {
+	return logging.FromContext(r.Context(), o.logger)
 }
 
 func (o *Operation) healthCheckHandler(rw http.ResponseWriter, r *http.Request) {
@@ -59,6 +165,120 @@ func (o *Operation) healthCheckHandler(rw http.ResponseWriter, r *http.Request)
 		CurrentTime: time.Now(),
 	})
 	if err != nil {
-		logger.Errorf("healthcheck response failure, %s", err)
+		o.requestLogger(r).Errorf("healthcheck response failure, %s", err)
+	}
+}
+
+func (o *Operation) versionHandler(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+
+	err := json.NewEncoder(rw).Encode(o.buildInfo)
+	if err != nil {
+		o.requestLogger(r).Errorf("version response failure, %s", err)
+	}
+}
+
+func (o *Operation) resourceMetadataHandler(rw http.ResponseWriter, r *http.Request) {
+	metadata := *o.resourceMetadata
+
+	if metadata.Resource == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+
+		metadata.Resource = scheme + "://" + r.Host
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+
+	err := json.NewEncoder(rw).Encode(&metadata)
+	if err != nil {
+		o.requestLogger(r).Errorf("protected resource metadata response failure, %s", err)
+	}
+}
+
+// readyHandler runs the readiness checks of all of the dependencies at once, responding with a 200 status code if
+// they all pass and a 503 status code if any of them fail, along with the status of each dependency.
+func (o *Operation) readyHandler(rw http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(o.readinessChecks))
+	for name := range o.readinessChecks {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	statuses := make([]*dependencyStatus, len(names))
+
+	var wg sync.WaitGroup
+
+	for i, name := range names {
+		wg.Add(1)
+
+		go func(i int, check ReadinessCheck) {
+			defer wg.Done()
+
+			statuses[i] = o.runReadinessCheck(check)
+		}(i, o.readinessChecks[name])
+	}
+
+	wg.Wait()
+
+	resp := &readinessResp{
+		Status:       "ready",
+		CurrentTime:  time.Now(),
+		Dependencies: make(map[string]*dependencyStatus, len(names)),
 	}
+
+	status := http.StatusOK
+
+	for i, name := range names {
+		resp.Dependencies[name] = statuses[i]
+
+		if statuses[i].Error != "" {
+			o.requestLogger(r).Warnf("Readiness check of %s failed: %s", name, statuses[i].Error)
+
+			resp.Status = "not ready"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+
+	err := json.NewEncoder(rw).Encode(resp)
+	if err != nil {
+		o.requestLogger(r).Errorf("ready response failure, %s", err)
+	}
+}
+
+// runReadinessCheck runs the check, giving up on it once the readiness timeout has passed. A check that times out is
+// left to finish in the background.
+func (o *Operation) runReadinessCheck(check ReadinessCheck) *dependencyStatus {
+	start := time.Now()
+
+	result := make(chan error, 1)
+
+	go func() {
+		result <- check()
+	}()
+
+	var err error
+
+	select {
+	case err = <-result:
+	case <-time.After(o.readinessTimeout):
+		err = fmt.Errorf("timed out after %s", o.readinessTimeout)
+	}
+
+	status := &dependencyStatus{Status: "up", Latency: time.Since(start).String()}
+
+	if err != nil {
+		status.Status = "down"
+		status.Error = err.Error()
+	}
+
+	return status
 }
@@ -6,16 +6,27 @@ SPDX-License-Identifier: Apache-2.0
 package operation
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/auth"
 )
 
 func TestGetRESTHandlers(t *testing.T) {
 	c := New()
-	require.Equal(t, 1, len(c.GetRESTHandlers()))
+	require.Equal(t, 2, len(c.GetRESTHandlers()))
+
+	c = New(WithBuildInfo(&BuildInfo{}))
+	require.Equal(t, 3, len(c.GetRESTHandlers()))
+
+	c = New(WithBuildInfo(&BuildInfo{}), WithProtectedResourceMetadata(&auth.ProtectedResourceMetadata{}))
+	require.Equal(t, 4, len(c.GetRESTHandlers()))
 }
 
 func TestHealthCheck(t *testing.T) {
@@ -26,3 +37,117 @@ func TestHealthCheck(t *testing.T) {
 
 	require.Equal(t, http.StatusOK, b.Code)
 }
+
+func TestVersion(t *testing.T) {
+	c := New(WithBuildInfo(&BuildInfo{
+		Version: "v0.1.8", Commit: "4cc999f", BuildDate: "2021-06-01T10:00:00Z",
+		Extensions: []string{"Batch"}, StorageBackend: "couchdb",
+	}))
+
+	rr := httptest.NewRecorder()
+	c.versionHandler(rr, nil)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.JSONEq(t, `{"version":"v0.1.8","commit":"4cc999f","buildDate":"2021-06-01T10:00:00Z",`+
+		`"extensions":["Batch"],"storageBackend":"couchdb"}`, rr.Body.String())
+}
+
+func TestProtectedResourceMetadata(t *testing.T) {
+	t.Run("Resource is set", func(t *testing.T) {
+		c := New(WithProtectedResourceMetadata(auth.NewProtectedResourceMetadata("https://edv.example.com",
+			auth.ModeZCAP, map[string]auth.Mode{auth.RouteDocuments: auth.ModeBearer}, "https://as.example.com",
+			"edv:read", "edv:write")))
+
+		rr := httptest.NewRecorder()
+		c.resourceMetadataHandler(rr, httptest.NewRequest(http.MethodGet, auth.ProtectedResourceMetadataPath, nil))
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		require.JSONEq(t, `{"resource":"https://edv.example.com","authorization_servers":["https://as.example.com"],`+
+			`"bearer_methods_supported":["header"],"scopes_supported":["edv:read","edv:write"],`+
+			`"authorization_schemes_supported":["Bearer","GNAP"],`+
+			`"edv_auth_modes":{"default":"zcap","documents":"bearer"}}`, rr.Body.String())
+	})
+	t.Run("Resource is taken from the request", func(t *testing.T) {
+		metadata := auth.NewProtectedResourceMetadata("", auth.ModeZCAP, nil, "")
+		c := New(WithProtectedResourceMetadata(metadata))
+
+		rr := httptest.NewRecorder()
+		c.resourceMetadataHandler(rr, httptest.NewRequest(http.MethodGet,
+			"https://edv.example.com:8443"+auth.ProtectedResourceMetadataPath, nil))
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.JSONEq(t, `{"resource":"https://edv.example.com:8443","edv_auth_modes":{"default":"zcap"}}`,
+			rr.Body.String())
+
+		rr = httptest.NewRecorder()
+		c.resourceMetadataHandler(rr, httptest.NewRequest(http.MethodGet,
+			"http://localhost:8080"+auth.ProtectedResourceMetadataPath, nil))
+
+		require.JSONEq(t, `{"resource":"http://localhost:8080","edv_auth_modes":{"default":"zcap"}}`, rr.Body.String())
+
+		// The configured metadata isn't changed.
+		require.Empty(t, metadata.Resource)
+	})
+}
+
+func TestReady(t *testing.T) {
+	t.Run("Ready without dependencies", func(t *testing.T) {
+		resp := requireReady(t, New(), http.StatusOK)
+		require.Equal(t, "ready", resp.Status)
+		require.Empty(t, resp.Dependencies)
+	})
+	t.Run("All dependencies are up", func(t *testing.T) {
+		resp := requireReady(t, New(
+			WithReadinessCheck("database", func() error { return nil }),
+			WithReadinessCheck("capabilityDatabase", func() error { return nil }),
+		), http.StatusOK)
+		require.Equal(t, "ready", resp.Status)
+		require.Len(t, resp.Dependencies, 2)
+		require.Equal(t, "up", resp.Dependencies["database"].Status)
+		require.Empty(t, resp.Dependencies["database"].Error)
+		require.NotEmpty(t, resp.Dependencies["database"].Latency)
+		require.Equal(t, "up", resp.Dependencies["capabilityDatabase"].Status)
+	})
+	t.Run("A dependency is down", func(t *testing.T) {
+		resp := requireReady(t, New(
+			WithReadinessCheck("database", func() error { return errors.New("connection refused") }),
+			WithReadinessCheck("capabilityDatabase", func() error { return nil }),
+		), http.StatusServiceUnavailable)
+		require.Equal(t, "not ready", resp.Status)
+		require.Equal(t, "down", resp.Dependencies["database"].Status)
+		require.Equal(t, "connection refused", resp.Dependencies["database"].Error)
+		require.Equal(t, "up", resp.Dependencies["capabilityDatabase"].Status)
+	})
+	t.Run("A dependency times out", func(t *testing.T) {
+		blocked := make(chan struct{})
+		defer close(blocked)
+
+		resp := requireReady(t, New(
+			WithReadinessCheck("database", func() error {
+				<-blocked
+
+				return nil
+			}),
+			WithReadinessTimeout(time.Millisecond),
+		), http.StatusServiceUnavailable)
+		require.Equal(t, "not ready", resp.Status)
+		require.Equal(t, "down", resp.Dependencies["database"].Status)
+		require.Equal(t, "timed out after 1ms", resp.Dependencies["database"].Error)
+	})
+}
+
+func requireReady(t *testing.T, o *Operation, expectedStatus int) *readinessResp {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	o.readyHandler(rr, httptest.NewRequest(http.MethodGet, readyEndpoint, nil))
+
+	require.Equal(t, expectedStatus, rr.Code)
+
+	var resp readinessResp
+
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+
+	return &resp
+}
@@ -22,6 +22,62 @@ const (
 	// to create a document with an ID that is base58-encoded, but the original value was not 128 bits long
 	// (which is required by the EDV spec).
 	ErrNot128BitValue = edvError("document ID is base58-encoded, but original value before encoding was not 128 bits long")
+	// ErrNotUUID is the error returned by the EDV server when an attempt is made to create a document with an ID that
+	// isn't a UUID, if the server only accepts UUID document IDs.
+	ErrNotUUID = edvError("document ID must be a UUID")
+	// ErrNotDIDURL is the error returned by the EDV server when an attempt is made to create a document with an ID
+	// that isn't a DID URL, if the server only accepts DID URL document IDs.
+	ErrNotDIDURL = edvError("document ID must be a DID URL")
+	// ErrDocumentSequenceConflict is used when a write to a document is rejected because it was based on a version
+	// of the document that is no longer the current one.
+	ErrDocumentSequenceConflict = edvError("document has been modified by another request")
+	// ErrUniqueIndexConflict is used when a document is rejected because an index name+value pair it has is declared
+	// as unique by another document, or because it declares a pair as unique that another document has.
+	ErrUniqueIndexConflict = edvError("unique index conflict")
+	// ErrReferenceIDImmutable is used when an attempt is made to change the reference ID of a vault that has one.
+	ErrReferenceIDImmutable = edvError("reference ID of a vault can't be changed")
+	// ErrConfigurationSequenceConflict is used when an update to a vault configuration is rejected because it was
+	// based on a version of the configuration that is no longer the current one.
+	ErrConfigurationSequenceConflict = edvError("vault configuration has been modified by another request")
+	// ErrWebhooksNotEnabled is used when an attempt is made to configure webhooks while the Notifications extension
+	// is disabled.
+	ErrWebhooksNotEnabled = edvError("webhooks can only be configured if the Notifications extension is enabled")
+	// ErrInvalidWebhookURL is used when an attempt is made to configure a webhook with a URL that isn't
+	// an absolute http or https URL.
+	ErrInvalidWebhookURL = edvError("webhook URL must be an absolute http or https URL")
+	// ErrPrivateWebhookAddress is used when an attempt is made to configure a webhook on a loopback, private or
+	// link-local address while they aren't allowed.
+	ErrPrivateWebhookAddress = edvError("webhook URL must not be on a loopback, private or link-local address")
+	// ErrSubscriptionNotFound is used when a subscription could not be found in a vault.
+	ErrSubscriptionNotFound = edvError("specified subscription does not exist")
+	// ErrInvalidReplicatedDocument is used when a document received from another EDV server during replication
+	// can't be stored.
+	ErrInvalidReplicatedDocument = edvError("replicated document is invalid")
+	// ErrTenantNotFound is used when a tenant could not be found, including when a request's tenant token doesn't
+	// belong to any tenant.
+	ErrTenantNotFound = edvError("specified tenant does not exist")
+	// ErrDuplicateTenant is used when an attempt is made to provision a tenant with an ID that is already being used.
+	ErrDuplicateTenant = edvError("tenant already exists")
+	// ErrInvalidTenantID is used when an attempt is made to provision a tenant with an invalid ID.
+	ErrInvalidTenantID = edvError("tenant ID must consist of lowercase letters, digits and hyphens")
+	// ErrTenantQuotaExceeded is used when a write is rejected because it would take a tenant over one of its quotas.
+	ErrTenantQuotaExceeded = edvError("tenant quota exceeded")
+	// ErrVaultLimitExceeded is used when a vault is rejected because its controller already has as many vaults as it's
+	// allowed to.
+	ErrVaultLimitExceeded = edvError("vault limit exceeded")
+	// ErrRevisionHistoryNotEnabled is used when a past revision of a document is requested from an EDV server that
+	// only keeps the current version of each document.
+	ErrRevisionHistoryNotEnabled = edvError("past revisions of documents are only kept if revision history is enabled")
+	// ErrInvalidVaultArchive is used when a vault archive that's being imported is malformed or incomplete.
+	ErrInvalidVaultArchive = edvError("invalid vault archive")
+	// ErrBackupCheckpointNotFound is used when an incremental archive of a vault is requested since a checkpoint
+	// that isn't the vault's last one.
+	ErrBackupCheckpointNotFound = edvError("backup checkpoint not found")
+	// ErrProviderShutDown is used when work is started on a provider that has been shut down.
+	ErrProviderShutDown = edvError("provider has been shut down")
+	// ErrOperationRestricted is used when the restrictions of a request's authorization, such as the caveats of its
+	// capability, don't allow what it asks for.
+	ErrOperationRestricted = edvError("operation not allowed by the restrictions of the request's authorization")
 
 	// FailWriteResponse is logged when a ResponseWriter fails to write.
 	FailWriteResponse = " Failed to write response back to sender: %s."
@@ -74,9 +130,15 @@ Received data: %s`
 	// InvalidDelegatorStringArray is the message returned by the EDV server when a attempt is made to create a vault
 	// with invalid delegator values.
 	InvalidDelegatorStringArray = "invalid delegator value: %w"
+	// InvalidInvocationMethodString is the message returned by the EDV server when a attempt is made to create or
+	// update a vault with an invalid invocation method value.
+	InvalidInvocationMethodString = "invalid invocation method value: %w"
 	// InvalidKEKIDString is the message returned by the EDV server when a attempt is made to create a vault
 	// with an invalid key agreement key ID value.
 	InvalidKEKIDString = "invalid key agreement key ID: %w"
+	// InvalidTenantToken is used when a request to create a vault on a multi-tenant EDV server doesn't have a valid
+	// tenant token.
+	InvalidTenantToken = "missing or invalid %s header: %w"
 	// VaultCreationFailure is used when an error prevents a new data vault from being created.
 	VaultCreationFailure = "Failed to create a new data vault: %s."
 	// MarshalVaultConfigForLogFailure is used when the log level is set to debug and a data vault configuration
@@ -99,8 +161,22 @@ Received data: %s`
 	InvalidBatch = `Received invalid batch operation for data vault %s: %s.`
 	// QueryFailure is used when an error occurs while querying a vault.
 	QueryFailure = `Failure while querying vault %s: %s.`
+	// InvalidLatencyBudgetHeader is used when the latency budget header of a query request isn't a number of
+	// milliseconds.
+	InvalidLatencyBudgetHeader = `Received a query for data vault %s, but the latency budget header is invalid: %s.`
+	// InvalidContinuationToken is used when the continuation token of a query request can't be used to continue
+	// the query.
+	InvalidContinuationToken = `Received a query for data vault %s, but the continuation token is invalid: %s.`
+	// QueryPartialResults is used when a query runs out of its latency budget before all matching documents are fetched.
+	QueryPartialResults = `Query for data vault %s exceeded its latency budget. Returning partial results, ` +
+		"continuing after document %s."
 	// QuerySuccess is used when a vault is successfully queried.
 	QuerySuccess = `Successfully queried data vault %s.`
+	// CountQuerySuccess is used when the documents matching a query are successfully counted.
+	CountQuerySuccess = `Successfully counted %d documents matching a query in data vault %s.`
+	// FailToMarshalQueryCount is used when the number of documents matching a query can't be marshalled.
+	// This should not happen during normal operation.
+	FailToMarshalQueryCount = QuerySuccess + " Failed to marshal the number of matching documents into bytes: %s."
 	// FailToMarshalDocIDs is used when the document IDs returned from a query can't be marshalled.
 	// This should not happen during normal operation.
 	FailToMarshalDocIDs = QuerySuccess + " Failed to marshal the matching document IDs into bytes: %s."
@@ -142,6 +218,55 @@ Received data: %s`
 	// fails to marshal back into bytes for logging purposes.
 	MarshalDocumentForLogFailure = "Failed to marshal document back into bytes for logging purposes: %s."
 
+	// ListDocumentsReceiveRequest is used for logging list documents requests.
+	ListDocumentsReceiveRequest = "Received request to list the documents in data vault %s."
+	// InvalidListDocumentsParameter is used when a list documents request has an invalid query parameter.
+	InvalidListDocumentsParameter = `Received invalid request to list the documents in data vault %s: %s.`
+	// ListDocumentsFailure is used when an error occurs while listing the documents in a vault.
+	ListDocumentsFailure = `Failure while listing the documents in vault %s: %s.`
+	// ListDocumentsSuccess is used when the documents in a vault are successfully listed.
+	ListDocumentsSuccess = "Successfully listed %d documents in vault %s."
+	// ExportVaultReceiveRequest is used for logging export vault requests.
+	ExportVaultReceiveRequest = "Received request to export data vault %s."
+	// ExportVaultFailure is used when an error occurs while exporting a vault.
+	ExportVaultFailure = `Failure while exporting vault %s: %s.`
+	// ExportVaultSuccess is used when a vault is successfully exported.
+	ExportVaultSuccess = "Successfully exported vault %s as a %d-byte archive."
+	// ImportVaultReceiveRequest is used for logging import vault requests.
+	ImportVaultReceiveRequest = "Received request to import a data vault."
+	// ImportVaultFailure is used when an error prevents a vault archive from being imported.
+	ImportVaultFailure = "Failed to import a data vault: %s."
+	// ImportVaultSuccess is used when a vault archive is successfully imported into a new vault.
+	ImportVaultSuccess = "Successfully imported %d documents into new data vault %s."
+
+	// ExportAuditLogReceiveRequest is used for logging export audit log requests.
+	ExportAuditLogReceiveRequest = "Received request to export the audit log of data vault %s."
+	// ExportAuditLogFailure is used when an error occurs while exporting the audit log of a vault.
+	ExportAuditLogFailure = `Failure while exporting the audit log of vault %s: %s.`
+	// ExportAuditLogSuccess is used when the audit log of a vault is successfully exported.
+	ExportAuditLogSuccess = "Successfully exported %d audit entries of vault %s."
+
+	// IndexingStatusReceiveRequest is used for logging indexing status requests.
+	IndexingStatusReceiveRequest = "Received request to get the indexing status of data vault %s."
+	// IndexingStatusFailure is used when an error occurs while getting the indexing status of a vault.
+	IndexingStatusFailure = `Failure while getting the indexing status of vault %s: %s.`
+	// IndexingStatusSuccess is used when the indexing status of a vault is successfully returned.
+	IndexingStatusSuccess = "Successfully got the indexing status of vault %s: %d documents pending."
+
+	// OperationRestricted is used when the restrictions of a request's authorization don't allow it.
+	OperationRestricted = "Received a request in vault %s that its authorization doesn't allow: %s."
+	// DocumentOperationRestricted is used when the restrictions of a request's authorization don't allow it to
+	// create, read, update or delete a document.
+	DocumentOperationRestricted = "Received a request for document %s in vault %s that its authorization " +
+		"doesn't allow: %s."
+	// CheckRestrictionsFailure is used when an error occurs while checking that a document is within the
+	// restrictions of a request's authorization.
+	CheckRestrictionsFailure = "Failure while checking the restrictions of a request for document %s in vault %s: %s."
+
+	// FailToMarshalDocumentList is used when the list of documents in a vault fails to marshal.
+	// This should not happen during normal operation.
+	FailToMarshalDocumentList = "Failed to marshal the list of documents in vault %s: %s."
+
 	// ReadAllDocumentsReceiveRequest is used for logging read all documents requests.
 	ReadAllDocumentsReceiveRequest = "Received request to read all documents from data vault %s."
 	// ReadAllDocumentsFailure is used when an error occurs while reading all documents.
@@ -158,6 +283,8 @@ Received data: %s`
 
 	// ReadDocumentReceiveRequest is used for logging read document requests.
 	ReadDocumentReceiveRequest = "Received request to read document %s from data vault %s."
+	// InvalidReadDocumentParameter is used when a read document request has an invalid query parameter.
+	InvalidReadDocumentParameter = `Received invalid request to read document %s in data vault %s: %s.`
 	// ReadDocumentFailure is used when an error occurs while reading a document.
 	ReadDocumentFailure = `Failed to read document %s in vault %s: %s.`
 	// ReadDocumentSuccess is used when a request document is successfully read.
@@ -165,12 +292,21 @@ Received data: %s`
 	// ReadDocumentSuccessWithRetrievedDoc is used when a request document is successfully read.
 	// Includes the retrieved document contents.
 	ReadDocumentSuccessWithRetrievedDoc = "Successfully retrieved document %s in vault %s. Retrieved doc: %s"
+	// ReadDeletedDocument is used when a requested document has been deleted, but its tombstone is still kept.
+	ReadDeletedDocument = "Document %s in vault %s has been deleted."
+
+	// CheckDocumentReceiveRequest is used for logging requests to check whether a document exists.
+	CheckDocumentReceiveRequest = "Received request to check whether document %s exists in data vault %s."
+	// CheckDocumentFailure is used when an error occurs while checking whether a document exists.
+	CheckDocumentFailure = `Failed to check whether document %s exists in vault %s: %s.`
 
 	// UpdateDocumentReceiveRequest is used for logging update document requests.
 	UpdateDocumentReceiveRequest = "Received request to update document %s from data vault %s."
 	// UpdateDocumentFailReadRequestBody is used when the incoming request body can't be read.
 	// This should not happen during normal operation.
 	UpdateDocumentFailReadRequestBody = UpdateDocumentReceiveRequest + ` Failed to read request body: %s.`
+	// DocumentTooLarge is used when a document in a request to create or update it is larger than the server allows.
+	DocumentTooLarge = "document exceeds the maximum of %d bytes"
 	// MismatchedDocIDs is used when docIDs obtained from the path variable and the request body are different.
 	MismatchedDocIDs = "document IDs from the path variable and the request body have to be the same"
 	// InvalidDocumentForDocUpdate is used when an invalid document is received while updating a document.
@@ -181,21 +317,160 @@ Received data: %s`
 	UpdateMappingDocumentFailure = "failed to update mapping document for document %s: %s"
 	// UpdateDocumentFailure is used when an error occurs while updating a document.
 	UpdateDocumentFailure = `Failed to update document %s in vault %s: %s.`
+	// FailToMarshalMappingDocumentLimitError is used when the response for a document with too many indexed
+	// attributes can't be marshalled. This should not happen during normal operation.
+	FailToMarshalMappingDocumentLimitError = "Failed to marshal mapping document limit error: %s."
 	// UpdateDocumentSuccess is used when a request document is successfully updated.
 	UpdateDocumentSuccess = "Successfully updated document %s in vault %s."
+	// UnexpectedUpdateSequence is used when an updated document's sequence isn't one greater than
+	// the sequence of the currently stored document.
+	UnexpectedUpdateSequence = "%w: expected new sequence %d but got %d"
+	// UnexpectedUpsertSequence is used when an upserted document that's already stored doesn't have a sequence
+	// that's one greater than the sequence of the currently stored document.
+	UnexpectedUpsertSequence = "%w: expected new sequence of document %s to be %d but got %d"
+	// DocumentChangedDuringWrite is used when documents are written to by another request, possibly on another EDV
+	// server, in between the check of their sequences and the write that the check was for.
+	DocumentChangedDuringWrite = "%w: documents %s were written to by another request during the write"
+	// StaleIfMatchOnUpdate is used when an updated document's sequence doesn't follow on from the sequence
+	// given in the If-Match header.
+	StaleIfMatchOnUpdate = "%w: If-Match header refers to sequence %d but the new document has sequence %d"
+	// InvalidIfMatchHeader is used when the If-Match header of a document update or delete request
+	// can't be parsed into a document sequence.
+	InvalidIfMatchHeader = `Received a request to modify document %s in vault %s, ` +
+		"but the If-Match header is invalid: %s."
+
+	// DeleteVaultReceiveRequest is used for logging delete vault requests.
+	DeleteVaultReceiveRequest = "Received request to delete data vault %s."
+	// DeleteVaultFailure is used when an error occurs while deleting a vault.
+	DeleteVaultFailure = `Failed to delete data vault %s: %s.`
+	// DeleteVaultSuccess is used when a vault is successfully deleted.
+	DeleteVaultSuccess = `Successfully deleted data vault %s.`
+	// DeleteVaultCapabilitiesFailure is used when the capabilities of a deleted vault can't be deleted.
+	DeleteVaultCapabilitiesFailure = `Deleted data vault %s, but failed to delete its capabilities, which are ` +
+		`left to the cleanup of orphaned capabilities: %s.`
 
 	// DeleteDocumentReceiveRequest is used for logging delete document requests.
 	DeleteDocumentReceiveRequest = "Received request to delete document %s from data vault %s."
 	// DeleteDocumentFailure is used when an error occurs while deleting a document.
 	DeleteDocumentFailure = `Failed to delete document %s in vault %s: %s.`
+	// RestoreDocumentReceiveRequest is used for logging restore document requests.
+	RestoreDocumentReceiveRequest = "Received request to restore document %s in data vault %s."
+	// RestoreDocumentFailure is used when an error occurs while restoring a deleted document.
+	RestoreDocumentFailure = `Failed to restore document %s in vault %s: %s.`
+	// RestoreDocumentSuccess is used when a deleted document is successfully restored.
+	RestoreDocumentSuccess = "Successfully restored document %s in vault %s."
 	// DeleteMappingDocumentFailure is used when an error occurs while deleting a mapping document for the document.
 	DeleteMappingDocumentFailure = "failed to delete mapping document: %s"
+	// UnexpectedDeleteSequence is used when the sequence given for a conditional delete doesn't match the
+	// sequence of the currently stored document.
+	UnexpectedDeleteSequence = "%w: current sequence is %d but the request expected %d"
 
 	// BatchResponseSuccess is used when all operations within a batch request execute successfully.
 	BatchResponseSuccess = `Successfully performed batch operation. Vault ID: %s, Request: %s, Response: %s`
 	// BatchResponseFailure is used when one or more operations within a batch request fail.
 	BatchResponseFailure = `Failure during batch operation. Vault ID: %s, Request: %s, Response: %s`
 
+	// BatchCapacityCheckReceiveRequest is used for logging new batch capacity check requests.
+	BatchCapacityCheckReceiveRequest = "Received request to check batch capacity for data vault %s."
+	// BatchCapacityCheckFailReadRequestBody is used when the incoming request body can't be read.
+	// This should not happen during normal operation.
+	BatchCapacityCheckFailReadRequestBody = BatchCapacityCheckReceiveRequest + " Failed to read the request body: %s."
+	// InvalidBatchCapacityCheck is used when an invalid batch capacity check is received.
+	InvalidBatchCapacityCheck = `Received invalid batch capacity check for data vault %s: %s.`
+	// BatchCapacityCheckFailure is used when an error occurs while checking batch capacity.
+	BatchCapacityCheckFailure = `Failure while checking batch capacity for vault %s: %s.`
+	// BatchCapacityCheckSuccess is used when a batch capacity check is completed successfully.
+	BatchCapacityCheckSuccess = "Successfully checked batch capacity for data vault %s."
+	// FailToMarshalBatchCapacityCheckResult is used when a batch capacity check result can't be marshalled.
+	// This should not happen during normal operation.
+	FailToMarshalBatchCapacityCheckResult = "Failed to marshal the batch capacity check result for vault %s: %s."
+	// BatchRejected is used when an incoming batch operation exceeds one of the server's batch limits.
+	BatchRejected = `Batch operation for data vault %s was rejected: %s.`
+	// BatchTooManyOperations is used when a batch contains more operations than the server allows.
+	BatchTooManyOperations = "batch contains %d operations, which exceeds the maximum of %d"
+	// BatchTooLarge is used when a batch is larger than the server allows.
+	BatchTooLarge = "batch is %d bytes, which exceeds the maximum of %d bytes"
+	// BatchTooLargeUnknownSize is used when a batch is larger than the server allows, but the full size of it
+	// isn't known since the server stopped reading it once the limit was exceeded.
+	BatchTooLargeUnknownSize = "batch exceeds the maximum of %d bytes"
+	// ServerAtBatchCapacity is used when the server is already processing the maximum number of concurrent batches.
+	ServerAtBatchCapacity = "server is currently processing %d batches, which is the maximum allowed"
+	// BatchDocumentTooLarge is used when an upsert in a batch has a document that's larger than the server allows.
+	BatchDocumentTooLarge = "operation %d has a document of %d bytes, which exceeds the maximum of %d bytes"
+	// BatchCheckDocumentTooLarge is used when the largest document of a planned batch is larger than the server
+	// allows.
+	BatchCheckDocumentTooLarge = "batch contains a document of %d bytes, which exceeds the maximum of %d bytes"
+	// BatchOverTenantDocumentQuota is used when a planned batch could take its vault's tenant over its document quota.
+	BatchOverTenantDocumentQuota = "batch could store %d new documents, but tenant %s can only store %d more"
+	// BatchOverTenantByteQuota is used when a planned batch could take its vault's tenant over its byte quota.
+	BatchOverTenantByteQuota = "batch could store %d more bytes, but tenant %s can only store %d more"
+
+	// UpdateConfigurationReceiveRequest is used for logging update vault configuration requests.
+	UpdateConfigurationReceiveRequest = "Received request to update the configuration of data vault %s."
+	// UpdateConfigurationFailReadRequestBody is used when the incoming request body can't be read.
+	// This should not happen during normal operation.
+	UpdateConfigurationFailReadRequestBody = UpdateConfigurationReceiveRequest + " Failed to read the request body: %s."
+	// InvalidConfigurationUpdate is used when an invalid vault configuration update is received.
+	InvalidConfigurationUpdate = `Received invalid configuration update for data vault %s: %s.`
+	// UpdateConfigurationFailure is used when an error occurs while updating the configuration of a vault.
+	UpdateConfigurationFailure = `Failure while updating the configuration of vault %s: %s.`
+	// UpdateConfigurationSuccess is used when the configuration of a vault is successfully updated.
+	UpdateConfigurationSuccess = `Successfully updated the configuration of data vault %s.`
+
+	// CreateSubscriptionReceiveRequest is used for logging create subscription requests.
+	CreateSubscriptionReceiveRequest = "Received request to create a new subscription in data vault %s."
+	// CreateSubscriptionFailReadRequestBody is used when the incoming request body can't be read.
+	// This should not happen during normal operation.
+	CreateSubscriptionFailReadRequestBody = CreateSubscriptionReceiveRequest + " Failed to read the request body: %s."
+	// InvalidSubscription is used when an invalid subscription is received.
+	InvalidSubscription = `Received invalid subscription for data vault %s: %s.`
+	// CreateSubscriptionFailure is used when an error occurs while creating a subscription.
+	CreateSubscriptionFailure = `Failure while creating subscription in vault %s: %s.`
+	// CreateSubscriptionSuccess is used when a subscription is successfully created.
+	CreateSubscriptionSuccess = `Successfully created a subscription in data vault %s.`
+	// ReadSubscriptionsReceiveRequest is used for logging read subscriptions requests.
+	ReadSubscriptionsReceiveRequest = "Received request to read all subscriptions in data vault %s."
+	// ReadSubscriptionsFailure is used when an error occurs while reading the subscriptions of a vault.
+	ReadSubscriptionsFailure = `Failure while reading subscriptions in vault %s: %s.`
+	// ReadSubscriptionsSuccess is used when the subscriptions of a vault are successfully read.
+	ReadSubscriptionsSuccess = `Successfully read the subscriptions of data vault %s.`
+	// DeleteSubscriptionReceiveRequest is used for logging delete subscription requests.
+	DeleteSubscriptionReceiveRequest = "Received request to delete subscription %s from data vault %s."
+	// DeleteSubscriptionFailure is used when an error occurs while deleting a subscription.
+	DeleteSubscriptionFailure = `Failed to delete subscription %s in vault %s: %s.`
+	// FailToMarshalUpdatedConfiguration is used when the updated configuration of a vault can't be marshalled.
+	FailToMarshalUpdatedConfiguration = "Updated the configuration of data vault %s, but failed to marshal it: %s."
+
+	// RotateReferenceIDReceiveRequest is used for logging reference ID rotation requests.
+	RotateReferenceIDReceiveRequest = "Received request to rotate the reference ID of data vault %s."
+	// RotateReferenceIDFailReadRequestBody is used when the incoming request body can't be read.
+	// This should not happen during normal operation.
+	RotateReferenceIDFailReadRequestBody = RotateReferenceIDReceiveRequest + " Failed to read the request body: %s."
+	// InvalidReferenceIDRotation is used when an invalid reference ID rotation is received.
+	InvalidReferenceIDRotation = `Received invalid reference ID rotation for data vault %s: %s.`
+	// RotateReferenceIDFailure is used when an error occurs while rotating the reference ID of a vault.
+	RotateReferenceIDFailure = `Failure while rotating the reference ID of vault %s: %s.`
+	// RotateReferenceIDSuccess is used when the reference ID of a vault is successfully rotated.
+	RotateReferenceIDSuccess = `Successfully rotated the reference ID of data vault %s.`
+	// BlankReferenceID is used when a reference ID rotation doesn't have a reference ID.
+	BlankReferenceID = "referenceId can't be blank"
+
+	// DelegateCapabilityReceiveRequest is used for logging delegate capability requests.
+	DelegateCapabilityReceiveRequest = "Received request to delegate a capability in data vault %s."
+	// DelegateCapabilityFailReadRequestBody is used when the incoming request body can't be read.
+	// This should not happen during normal operation.
+	DelegateCapabilityFailReadRequestBody = DelegateCapabilityReceiveRequest + " Failed to read the request body: %s."
+	// InvalidCapabilityDelegation is used when an invalid capability delegation is received.
+	InvalidCapabilityDelegation = `Received invalid capability delegation for data vault %s: %s.`
+	// DelegateCapabilityFailure is used when an error occurs while delegating a capability.
+	DelegateCapabilityFailure = `Failure while delegating capability in vault %s: %s.`
+	// RevokeCapabilityReceiveRequest is used for logging revoke capability requests.
+	RevokeCapabilityReceiveRequest = "Received request to revoke capability %s in data vault %s."
+	// RevokeCapabilityFailure is used when an error occurs while revoking a capability.
+	RevokeCapabilityFailure = `Failed to revoke capability %s in vault %s: %s.`
+	// RevokeCapabilitySuccess is used when a capability is successfully revoked.
+	RevokeCapabilitySuccess = "Successfully revoked capability %s in vault %s."
+
 	// PutLogSpecFailReadRequestBody is used when the incoming request body can't be read.
 	// This should not happen during normal operation.
 	PutLogSpecFailReadRequestBody = "Received request to change the log spec, " +
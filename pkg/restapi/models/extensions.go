@@ -0,0 +1,199 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Extensions are the members of a JSON object that aren't fields of the model that it was unmarshalled into, such
+// as ones added by extensions to the EDV specification that this server doesn't know about. They're kept as the raw
+// JSON that was received and are written back out when the model is marshalled, so that they aren't dropped when
+// the model is stored and read back.
+type Extensions map[string]json.RawMessage
+
+// MarshalJSON marshals the configuration along with its extensions.
+func (c DataVaultConfiguration) MarshalJSON() ([]byte, error) {
+	type dataVaultConfiguration DataVaultConfiguration
+
+	return marshalWithExtensions(dataVaultConfiguration(c), c.Extensions)
+}
+
+// UnmarshalJSON unmarshals the configuration, keeping the members that aren't fields of it as its extensions.
+func (c *DataVaultConfiguration) UnmarshalJSON(data []byte) error {
+	type dataVaultConfiguration DataVaultConfiguration
+
+	if string(data) == "null" {
+		return nil
+	}
+
+	var configuration dataVaultConfiguration
+
+	extensions, err := unmarshalWithExtensions(data, &configuration)
+	if err != nil {
+		return err
+	}
+
+	*c = DataVaultConfiguration(configuration)
+	c.Extensions = extensions
+
+	return nil
+}
+
+// MarshalJSON marshals the document along with its extensions.
+func (d EncryptedDocument) MarshalJSON() ([]byte, error) {
+	type encryptedDocument EncryptedDocument
+
+	return marshalWithExtensions(encryptedDocument(d), d.Extensions)
+}
+
+// UnmarshalJSON unmarshals the document, keeping the members that aren't fields of it as its extensions.
+func (d *EncryptedDocument) UnmarshalJSON(data []byte) error {
+	type encryptedDocument EncryptedDocument
+
+	if string(data) == "null" {
+		return nil
+	}
+
+	var document encryptedDocument
+
+	extensions, err := unmarshalWithExtensions(data, &document)
+	if err != nil {
+		return err
+	}
+
+	*d = EncryptedDocument(document)
+	d.Extensions = extensions
+
+	return nil
+}
+
+// marshalWithExtensions marshals the given struct and adds the given extensions to it, sorted by name.
+// Extensions that aren't valid JSON or that have the same name as one of the struct's fields are rejected.
+func marshalWithExtensions(v interface{}, extensions Extensions) ([]byte, error) {
+	objectBytes, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(extensions) == 0 {
+		return objectBytes, nil
+	}
+
+	fieldNames := jsonFieldNames(reflect.TypeOf(v))
+
+	names := make([]string, 0, len(extensions))
+
+	for name := range extensions {
+		if isFieldName(name, fieldNames) {
+			return nil, fmt.Errorf("extension %s has the same name as a field", name)
+		}
+
+		if !json.Valid(extensions[name]) {
+			return nil, fmt.Errorf("extension %s isn't valid JSON", name)
+		}
+
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var buffer bytes.Buffer
+
+	buffer.Write(objectBytes[:len(objectBytes)-1])
+
+	for i, name := range names {
+		if i > 0 || len(objectBytes) > len("{}") {
+			buffer.WriteByte(',')
+		}
+
+		nameBytes, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+
+		buffer.Write(nameBytes)
+		buffer.WriteByte(':')
+		buffer.Write(extensions[name])
+	}
+
+	buffer.WriteByte('}')
+
+	return buffer.Bytes(), nil
+}
+
+// unmarshalWithExtensions unmarshals the given JSON object into the given struct, and returns the members of the
+// object that aren't fields of the struct. Field names are matched case-insensitively, as they are by json.Unmarshal.
+func unmarshalWithExtensions(data []byte, v interface{}) (Extensions, error) {
+	err := json.Unmarshal(data, v)
+	if err != nil {
+		return nil, err
+	}
+
+	var members map[string]json.RawMessage
+
+	err = json.Unmarshal(data, &members)
+	if err != nil {
+		return nil, err
+	}
+
+	fieldNames := jsonFieldNames(reflect.TypeOf(v).Elem())
+
+	var extensions Extensions
+
+	for name, value := range members {
+		if isFieldName(name, fieldNames) {
+			continue
+		}
+
+		if extensions == nil {
+			extensions = make(Extensions)
+		}
+
+		extensions[name] = value
+	}
+
+	return extensions, nil
+}
+
+// jsonFieldNames returns the names of the JSON object members that the fields of the given struct type are marshalled
+// to.
+func jsonFieldNames(structType reflect.Type) []string {
+	var names []string
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		names = append(names, name)
+	}
+
+	return names
+}
+
+func isFieldName(name string, fieldNames []string) bool {
+	for _, fieldName := range fieldNames {
+		if strings.EqualFold(name, fieldName) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,84 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testDocumentWithExtensions = `{"id":"VJYHHJx4C8J9Fsgz7rZqSp","sequence":0,"indexed":null,` +
+	`"jwe":{"protected":"eyJlbmMiOiJDMjBQIn0"},"expires":"2030-01-01T00:00:00Z","meta":{"tags":["a","b"]}}`
+
+func TestEncryptedDocument_Extensions(t *testing.T) {
+	t.Run("Extensions are preserved", func(t *testing.T) {
+		var document EncryptedDocument
+
+		require.NoError(t, json.Unmarshal([]byte(testDocumentWithExtensions), &document))
+		require.Equal(t, "VJYHHJx4C8J9Fsgz7rZqSp", document.ID)
+		require.Equal(t, Extensions{
+			"expires": json.RawMessage(`"2030-01-01T00:00:00Z"`),
+			"meta":    json.RawMessage(`{"tags":["a","b"]}`),
+		}, document.Extensions)
+
+		documentBytes, err := json.Marshal(document)
+		require.NoError(t, err)
+		require.Equal(t, testDocumentWithExtensions, string(documentBytes))
+	})
+	t.Run("Documents without extensions are unchanged", func(t *testing.T) {
+		var document EncryptedDocument
+
+		require.NoError(t, json.Unmarshal([]byte(`{"id":"VJYHHJx4C8J9Fsgz7rZqSp","Sequence":1}`), &document))
+		require.Equal(t, uint64(1), document.Sequence)
+		require.Nil(t, document.Extensions)
+
+		documentBytes, err := json.Marshal(document)
+		require.NoError(t, err)
+		require.Equal(t, `{"id":"VJYHHJx4C8J9Fsgz7rZqSp","sequence":1,"indexed":null,"jwe":null}`, string(documentBytes))
+	})
+	t.Run("Null leaves the document unchanged", func(t *testing.T) {
+		document := EncryptedDocument{ID: "VJYHHJx4C8J9Fsgz7rZqSp"}
+
+		require.NoError(t, json.Unmarshal([]byte("null"), &document))
+		require.Equal(t, "VJYHHJx4C8J9Fsgz7rZqSp", document.ID)
+	})
+	t.Run("Not an object", func(t *testing.T) {
+		var document EncryptedDocument
+
+		require.Error(t, json.Unmarshal([]byte(`["VJYHHJx4C8J9Fsgz7rZqSp"]`), &document))
+	})
+	t.Run("Extension has the same name as a field", func(t *testing.T) {
+		_, err := json.Marshal(EncryptedDocument{Extensions: Extensions{"JWE": json.RawMessage(`{}`)}})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "extension JWE has the same name as a field")
+	})
+	t.Run("Extension isn't valid JSON", func(t *testing.T) {
+		_, err := json.Marshal(EncryptedDocument{Extensions: Extensions{"expires": json.RawMessage(`{`)}})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "extension expires isn't valid JSON")
+	})
+}
+
+func TestDataVaultConfiguration_Extensions(t *testing.T) {
+	mapping := DataVaultConfigurationMapping{VaultID: "Sr7yHjomhn1aeaFnxREfRN"}
+
+	err := json.Unmarshal([]byte(`{"controller":"did:example:123","retention":{"days":30}}`),
+		&mapping.DataVaultConfiguration)
+	require.NoError(t, err)
+	require.Equal(t, "did:example:123", mapping.DataVaultConfiguration.Controller)
+
+	mappingBytes, err := json.Marshal(mapping)
+	require.NoError(t, err)
+
+	var readMapping DataVaultConfigurationMapping
+
+	require.NoError(t, json.Unmarshal(mappingBytes, &readMapping))
+	require.Equal(t, mapping, readMapping)
+	require.Equal(t, json.RawMessage(`{"days":30}`), readMapping.DataVaultConfiguration.Extensions["retention"])
+}
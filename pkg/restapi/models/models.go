@@ -6,7 +6,10 @@ SPDX-License-Identifier: Apache-2.0
 
 package models
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 // DataVaultConfiguration represents a Data Vault Configuration.
 type DataVaultConfiguration struct {
@@ -17,6 +20,10 @@ type DataVaultConfiguration struct {
 	ReferenceID string     `json:"referenceId"`
 	KEK         IDTypePair `json:"kek"`
 	HMAC        IDTypePair `json:"hmac"`
+	// InvocationMethod is the verification method that the controller invokes capabilities for the vault with.
+	InvocationMethod string `json:"invocationMethod,omitempty"`
+	// Extensions are the members of the configuration that this server doesn't know about.
+	Extensions Extensions `json:"-"`
 }
 
 // DataVaultConfigurationMapping represents an entry in the data vault config store that maps a DataVaultConfiguration
@@ -24,6 +31,50 @@ type DataVaultConfiguration struct {
 type DataVaultConfigurationMapping struct {
 	DataVaultConfiguration DataVaultConfiguration `json:"dataVaultConfiguration"`
 	VaultID                string                 `json:"vaultId"`
+	// TenantID is the tenant that the vault is bound to on a multi-tenant EDV server.
+	TenantID string `json:"tenantId,omitempty"`
+	// Webhooks are the webhooks that the vault's events are sent to if the Notifications extension is enabled.
+	Webhooks *VaultWebhooks `json:"webhooks,omitempty"`
+	// RetrievalPageSize, if set, overrides the server's retrieval page size for queries on the vault.
+	RetrievalPageSize uint `json:"retrievalPageSize,omitempty"`
+}
+
+// DataVaultConfigurationUpdate is a change to the configuration of a vault. Fields that are left out aren't changed.
+// The KEK and HMAC of a vault can't be changed, and neither can its reference ID once it has one.
+type DataVaultConfigurationUpdate struct {
+	// Sequence, if set, must be the sequence that the configuration will have after the update, which is one more
+	// than its current sequence. The update is rejected otherwise, so that updates based on a configuration that
+	// has since changed aren't made.
+	Sequence         *uint64   `json:"sequence,omitempty"`
+	Controller       *string   `json:"controller,omitempty"`
+	Invoker          *[]string `json:"invoker,omitempty"`
+	Delegator        *[]string `json:"delegator,omitempty"`
+	InvocationMethod *string   `json:"invocationMethod,omitempty"`
+	ReferenceID      *string   `json:"referenceId,omitempty"`
+	// Webhooks replaces the vault's webhooks. An empty list of endpoints removes them.
+	Webhooks *VaultWebhooks `json:"webhooks,omitempty"`
+	// RetrievalPageSize replaces the vault's retrieval page size. 0 removes it, so that the server's is used.
+	RetrievalPageSize *uint `json:"retrievalPageSize,omitempty"`
+}
+
+// ReferenceIDRotation replaces the reference ID of a vault, which can't be changed with a
+// DataVaultConfigurationUpdate once it's set.
+type ReferenceIDRotation struct {
+	// ReferenceID is the new reference ID of the vault. It must not be used by any vault.
+	ReferenceID string `json:"referenceId"`
+	// Sequence, if set, must be the sequence that the configuration will have after the rotation, as for
+	// DataVaultConfigurationUpdate.
+	Sequence *uint64 `json:"sequence,omitempty"`
+}
+
+// DataVaultConfigurationUpdateResult is the response to a DataVaultConfigurationUpdate.
+type DataVaultConfigurationUpdateResult struct {
+	Configuration DataVaultConfiguration `json:"configuration"`
+	// Capability is the capability that was delegated to the new controller of the vault, if the controller was
+	// changed and requests are authorized with ZCAP-LD. Capabilities of the previous controller aren't revoked.
+	Capability json.RawMessage `json:"capability,omitempty"`
+	// Webhooks are the vault's webhooks, if they were changed and not removed.
+	Webhooks *VaultWebhooksStatus `json:"webhooks,omitempty"`
 }
 
 // StructuredDocument represents a Structured Document.
@@ -39,6 +90,22 @@ type EncryptedDocument struct {
 	Sequence                    uint64                       `json:"sequence"`
 	IndexedAttributeCollections []IndexedAttributeCollection `json:"indexed"`
 	JWE                         json.RawMessage              `json:"jwe"`
+	// Extensions are the members of the document that this server doesn't know about.
+	Extensions Extensions `json:"-"`
+}
+
+// DocumentListEntry identifies a document in a DocumentList.
+type DocumentListEntry struct {
+	ID       string `json:"id"`
+	Sequence uint64 `json:"sequence"`
+}
+
+// DocumentList lists the documents in a vault, sorted by sequence and then by ID.
+// If More is true, then there are more documents after the last one in the list, which can be listed by asking
+// for the documents after its sequence and ID.
+type DocumentList struct {
+	Documents []DocumentListEntry `json:"documents"`
+	More      bool                `json:"more"`
 }
 
 // IndexedAttributeCollection represents a collection of indexed attributes,
@@ -63,16 +130,34 @@ type IDTypePair struct {
 }
 
 // Query represents an incoming vault query.
-// Two types of queries are supported:
+// Three types of queries are supported:
 // 1. "index + equals": Matches any documents that have index attributes matching both Name and Value.
 // 2. has: Matches any documents that contain that have index attributes matching Has, regardless of the Value.
-// It's invalid for an incoming query to mix both query formats.
+// 3. "index + operator": Matches any documents that have index attributes matching Name whose values are matched by
+// the custom query operator registered under Operator (see edvprovider.RegisterQueryOperator), given Operand.
+// It's invalid for an incoming query to mix query formats.
 // ReturnFullDocuments is optional and can only be used if the "ReturnFullDocumentsOnQuery" extension is enabled.
+// HMACKeyID is optional and restricts any type of query to the indexed attribute collections whose HMAC key has
+// that ID, so that attributes indexed with other keys don't match.
+// PageSize is optional and sets the number of mapping documents, and of matching documents, fetched from the
+// database at a time for the query, overriding the vault's and the server's retrieval page sizes.
 type Query struct {
 	ReturnFullDocuments bool   `json:"returnFullDocuments"`
 	Name                string `json:"index"`
 	Value               string `json:"equals"`
 	Has                 string `json:"has"`
+	// Operator and Operand are only set for "index + operator" queries. Operand is parsed by the operator.
+	Operator  string          `json:"operator,omitempty"`
+	Operand   json.RawMessage `json:"operand,omitempty"`
+	HMACKeyID string          `json:"hmacKeyId,omitempty"`
+	PageSize  uint            `json:"pageSize,omitempty"`
+	// Count is set to get only the number of matching documents (see QueryCount).
+	Count bool `json:"count,omitempty"`
+}
+
+// QueryCount is the response to a query with Count set.
+type QueryCount struct {
+	Count int `json:"count"`
 }
 
 // HasQuery represents a simpler version of Query above that matches all documents that are tagged with the index name
@@ -99,6 +184,150 @@ type VaultOperation struct {
 	EncryptedDocument EncryptedDocument `json:"document,omitempty"` // Only used if Operation=createOrUpdate
 }
 
+// BatchCapacityCheck represents a planned batch operation that a client wants to check against the server's
+// limits and current load before actually sending it.
+type BatchCapacityCheck struct {
+	NumOperations uint   `json:"operations"`
+	TotalBytes    uint64 `json:"totalBytes"`
+	// LargestDocumentBytes is the size of the largest encrypted document in the batch, if it's known.
+	LargestDocumentBytes uint64 `json:"largestDocumentBytes,omitempty"`
+}
+
+// BatchCapacityCheckResult indicates whether a planned batch operation would be accepted by the server.
+// If Accepted is false, then Reasons will contain a human-readable explanation for each limit that would be exceeded.
+// Limits that are set to 0 are not enforced by the server.
+type BatchCapacityCheckResult struct {
+	Accepted             bool     `json:"accepted"`
+	Reasons              []string `json:"reasons,omitempty"`
+	MaxOperations        uint     `json:"maxOperations"`
+	MaxBytes             uint64   `json:"maxBytes"`
+	MaxConcurrentBatches uint     `json:"maxConcurrentBatches"`
+	CurrentBatches       uint     `json:"currentBatches"`
+}
+
+// IndexingStatus indicates whether queries in a vault are consistent with its documents. If asynchronous indexing is
+// enabled, then the documents stored by batch upserts are only found by their encrypted indices once they've been
+// indexed in the background. PendingDocuments is the number of documents still waiting to be indexed.
+type IndexingStatus struct {
+	PendingDocuments int  `json:"pendingDocuments"`
+	Consistent       bool `json:"consistent"`
+}
+
+// MappingDocumentLimitErrorCode is the error code used in MappingDocumentLimitError responses.
+const MappingDocumentLimitErrorCode = "too_many_indexed_attributes"
+
+// MappingDocumentLimitError is the body of the response sent when a document is rejected because it declares more
+// indexed attributes than the server allows per document. Each indexed attribute is stored as a mapping document.
+type MappingDocumentLimitError struct {
+	Error               string `json:"error"`
+	Message             string `json:"message"`
+	DocumentID          string `json:"documentId"`
+	MappingDocuments    int    `json:"mappingDocuments"`
+	MaxMappingDocuments uint   `json:"maxMappingDocuments"`
+	// CorrelationID is the correlation ID of the request, so that the failure can be found in the server's logs.
+	CorrelationID string `json:"correlationID,omitempty"`
+}
+
+// CapabilityDelegation is a request to delegate a new capability for a vault from an existing capability.
+// Only ParentCapability and Invoker aren't restrictions: leaving the other fields empty delegates everything
+// the parent capability grants.
+type CapabilityDelegation struct {
+	// ParentCapability is the ID of the capability to delegate from. Defaults to the capability invoked by the
+	// request, or to the root capability of the vault if the request doesn't invoke one.
+	ParentCapability string `json:"parentCapability,omitempty"`
+	// Invoker is the verification method allowed to invoke the delegated capability.
+	Invoker string `json:"invoker"`
+	// AllowedActions restricts the delegated capability to these actions (read, write).
+	AllowedActions []string `json:"allowedAction,omitempty"`
+	// DocumentID restricts the delegated capability to the document with this ID.
+	DocumentID string `json:"documentId,omitempty"`
+	// Expires is the time after which the delegated capability can no longer be invoked.
+	Expires *time.Time `json:"expires,omitempty"`
+	// Operations restricts the delegated capability to these operations (read, query, write). Unlike AllowedActions,
+	// they tell queries apart from other writes, so that a capability can be restricted to reads and queries.
+	Operations []string `json:"operations,omitempty"`
+	// Attribute restricts the delegated capability to the documents indexed with this attribute, and to queries for
+	// it. Its Unique flag is ignored.
+	Attribute *IndexedAttribute `json:"attribute,omitempty"`
+}
+
+// Subscription is a webhook endpoint of a vault, as managed with the deprecated subscription endpoints. Its ID is
+// derived from its URL.
+type Subscription struct {
+	ID      string `json:"id"`
+	VaultID string `json:"vaultId"`
+	URL     string `json:"url"`
+}
+
+// VaultWebhooks are the webhooks of a vault. A VaultEvent is sent to each of the endpoints each time a document in
+// the vault is changed. If Secret is set, then each event is signed with it, and the signature is sent along with
+// the event so that the endpoints can check that it came from the EDV server.
+type VaultWebhooks struct {
+	Endpoints []string `json:"endpoints"`
+	Secret    string   `json:"secret,omitempty"`
+}
+
+// VaultWebhooksStatus describes the webhooks of a vault in responses. Their secret is never sent back, only whether
+// one is set.
+type VaultWebhooksStatus struct {
+	Endpoints []string `json:"endpoints"`
+	SecretSet bool     `json:"secretSet"`
+}
+
+const (
+	// DocumentCreatedVaultEvent is the type of VaultEvent sent when a document is created.
+	DocumentCreatedVaultEvent = "created"
+	// DocumentUpdatedVaultEvent is the type of VaultEvent sent when a document is updated.
+	DocumentUpdatedVaultEvent = "updated"
+	// DocumentUpsertedVaultEvent is the type of VaultEvent sent when a document is upserted as part of a batch,
+	// in which case no distinction is made between document creation and document updates.
+	DocumentUpsertedVaultEvent = "upserted"
+	// DocumentDeletedVaultEvent is the type of VaultEvent sent when a document is deleted.
+	DocumentDeletedVaultEvent = "deleted"
+	// DocumentRestoredVaultEvent is the type of VaultEvent sent when a deleted document is restored.
+	DocumentRestoredVaultEvent = "restored"
+)
+
+// Tombstone describes a document that was deleted from a vault that keeps deleted documents for a retention window.
+// The document can be restored until the retention window has passed.
+type Tombstone struct {
+	ID       string    `json:"id"`
+	Sequence uint64    `json:"sequence"`
+	Deleted  time.Time `json:"deleted"`
+}
+
+// VaultEvent describes a change made to a document in a vault.
+// It never includes any document contents, encrypted or otherwise.
+type VaultEvent struct {
+	VaultID    string    `json:"vaultId"`
+	DocumentID string    `json:"documentId"`
+	Sequence   uint64    `json:"sequence"`
+	Type       string    `json:"type"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// IndexCorruptionAlert is raised when more mapping documents than the alert threshold were found to be inconsistent
+// with the encrypted documents in a vault since the vault's last alert. Orphaned mapping documents point at documents
+// that don't exist or don't have the mapping document's attribute, and missing mapping documents are the ones that
+// documents should have but don't. The counts are of the inconsistencies found since the vault's last alert, which
+// may have been repaired already.
+type IndexCorruptionAlert struct {
+	VaultID                  string    `json:"vaultId"`
+	OrphanedMappingDocuments int       `json:"orphanedMappingDocuments"`
+	MissingMappingDocuments  int       `json:"missingMappingDocuments"`
+	Timestamp                time.Time `json:"timestamp"`
+}
+
+// ConsistencyReport summarizes a consistency check of a vault's encrypted indices. The orphaned and missing mapping
+// documents counted are the ones that were repaired by the check, as described in IndexCorruptionAlert.
+type ConsistencyReport struct {
+	VaultID                  string `json:"vaultId"`
+	DocumentsChecked         int    `json:"documentsChecked"`
+	MappingDocumentsChecked  int    `json:"mappingDocumentsChecked"`
+	OrphanedMappingDocuments int    `json:"orphanedMappingDocuments"`
+	MissingMappingDocuments  int    `json:"missingMappingDocuments"`
+}
+
 // JSONWebEncryption represents a JWE
 type JSONWebEncryption struct {
 	B64ProtectedHeaders      string                 `json:"protected,omitempty"`
@@ -128,3 +357,125 @@ type RecipientHeaders struct {
 	EPK json.RawMessage `json:"epk,omitempty"`
 	SPK json.RawMessage `json:"spk,omitempty"`
 }
+
+// TenantQuotas are the limits on what a tenant's vaults can hold. A quota that is set to 0 is not enforced.
+type TenantQuotas struct {
+	MaxVaults    uint64 `json:"maxVaults"`
+	MaxDocuments uint64 `json:"maxDocuments"`
+	// MaxBytes limits the total size of the tenant's encrypted documents, as stored.
+	MaxBytes uint64 `json:"maxBytes"`
+}
+
+// Tenant is an isolated group of vaults on a multi-tenant EDV server, subject to its own quotas.
+type Tenant struct {
+	ID     string       `json:"id"`
+	Quotas TenantQuotas `json:"quotas"`
+}
+
+// TenantUsage is how much of its quotas a tenant is using.
+type TenantUsage struct {
+	Vaults    uint64 `json:"vaults"`
+	Documents uint64 `json:"documents"`
+	Bytes     uint64 `json:"bytes"`
+}
+
+// TenantStatus is a tenant along with its current usage.
+type TenantStatus struct {
+	Tenant
+	Usage TenantUsage `json:"usage"`
+}
+
+// ControllerVaultLimit is the number of vaults that a controller can have, along with the number of vaults it has.
+type ControllerVaultLimit struct {
+	Controller string `json:"controller"`
+	// MaxVaults is the number of vaults that the controller can have. If it's 0, then the controller isn't limited.
+	MaxVaults uint64 `json:"maxVaults"`
+	// Override is whether MaxVaults was set for this controller by an admin, instead of being the server's default.
+	Override bool `json:"override"`
+	// Vaults is the number of vaults that the controller has. Vaults whose configuration hasn't been stored or
+	// updated since vault limits were introduced aren't counted.
+	Vaults uint64 `json:"vaults"`
+}
+
+// VaultLimit is the vault limit that an admin sets for a controller.
+type VaultLimit struct {
+	MaxVaults uint64 `json:"maxVaults"`
+}
+
+// ProvisionedTenant is a newly provisioned tenant along with the token that its clients send in the EDV-Tenant-Token
+// header to create vaults for it. The token is only ever returned when the tenant is provisioned.
+type ProvisionedTenant struct {
+	Tenant
+	Token string `json:"token"`
+}
+
+// ReplicationRequest asks an EDV server to replicate one of its vaults to another EDV server.
+// TargetToken is the admin token of the target server.
+type ReplicationRequest struct {
+	TargetURL   string `json:"targetUrl"`
+	TargetToken string `json:"targetToken"`
+}
+
+// ReplicationResult summarizes a completed replication. Only the documents that changed since the previous
+// replication to the same target are counted.
+type ReplicationResult struct {
+	DocumentsReplicated int `json:"documentsReplicated"`
+	DocumentsDeleted    int `json:"documentsDeleted"`
+}
+
+// EncryptionKeyRotation summarizes a rotation of the key that wraps the data keys of vaults. The data keys of the
+// vaults that haven't stored anything encrypted yet aren't counted, since they don't have one.
+type EncryptionKeyRotation struct {
+	KeyID             string `json:"keyId"`
+	DataKeysRewrapped int    `json:"dataKeysRewrapped"`
+}
+
+// ReplicationBatch is a part of a vault sent from one EDV server to another during replication.
+// Configuration and Capabilities are used to create the vault on the receiving server if it doesn't exist there yet.
+type ReplicationBatch struct {
+	Configuration *DataVaultConfiguration `json:"configuration,omitempty"`
+	Capabilities  []json.RawMessage       `json:"capabilities,omitempty"`
+	Documents     []ReplicatedDocument    `json:"documents,omitempty"`
+	// DeletedDocuments are the stubs of the documents deleted since the previous replication, with the sequences
+	// that the documents had when they were deleted.
+	DeletedDocuments []Tombstone `json:"deletedDocuments,omitempty"`
+	// DeletedDocumentIDs are the IDs of deleted documents, as sent by EDV servers that don't send deletion stubs.
+	DeletedDocumentIDs []string `json:"deletedDocumentIds,omitempty"`
+}
+
+// VaultArchiveEntry is a line of a vault archive, which holds a vault's configuration and encrypted documents as JSON
+// lines so that the vault can be backed up or moved to another EDV server. Each entry has exactly one of its fields
+// set. The first entry of a full archive has the configuration and the last one marks its end, with the documents in
+// between. An incremental archive starts with an increment entry instead, and only has the documents that changed
+// since the checkpoint of the previous archive, followed by the IDs of the ones that were deleted.
+type VaultArchiveEntry struct {
+	Configuration *DataVaultConfiguration `json:"configuration,omitempty"`
+	Increment     *VaultArchiveIncrement  `json:"increment,omitempty"`
+	Document      json.RawMessage         `json:"document,omitempty"`
+	Deleted       string                  `json:"deleted,omitempty"`
+	End           *VaultArchiveEnd        `json:"end,omitempty"`
+}
+
+// VaultArchiveIncrement starts an incremental vault archive.
+type VaultArchiveIncrement struct {
+	// Since is the checkpoint of the archive that this one is an increment of.
+	Since string `json:"since"`
+}
+
+// VaultArchiveEnd marks the end of a vault archive, so that archives that were cut short can be detected.
+type VaultArchiveEnd struct {
+	// Documents is the number of documents in the archive.
+	Documents int `json:"documents"`
+	// Deleted is the number of deleted documents in an incremental archive.
+	Deleted int `json:"deleted,omitempty"`
+	// Checkpoint identifies the state of the vault that the archive captured, so that the next archive can be an
+	// increment of this one.
+	Checkpoint string `json:"checkpoint,omitempty"`
+}
+
+// ReplicatedDocument is a stored encrypted document along with the mapping documents for its encrypted indices,
+// copied as-is from the source server.
+type ReplicatedDocument struct {
+	Document         json.RawMessage   `json:"document"`
+	MappingDocuments []json.RawMessage `json:"mappingDocuments,omitempty"`
+}
@@ -0,0 +1,393 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/trustbloc/edv/pkg/audit"
+	"github.com/trustbloc/edv/pkg/edvprovider"
+	"github.com/trustbloc/edv/pkg/edvutils"
+	"github.com/trustbloc/edv/pkg/logging"
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const (
+	exportVaultEndpoint = edvCommonEndpointPathRoot + "/{" + vaultIDPathVariable + "}/export"
+	importVaultEndpoint = edvCommonEndpointPathRoot + "/import"
+
+	// vaultArchiveContentType is the content type of vault archives, which are JSON lines.
+	vaultArchiveContentType = "application/x-ndjson"
+
+	// sinceQueryParameter is the checkpoint that an incremental archive is exported since.
+	sinceQueryParameter = "since"
+
+	// importBatchSize is the number of documents from an imported archive that are stored at a time.
+	importBatchSize = 100
+)
+
+// Export Vault swagger:route GET /encrypted-data-vaults/{vaultID}/export exportVaultReq
+//
+// Exports a data vault as an archive of its configuration and all of its encrypted documents, streamed as JSON lines.
+// If the since query parameter is given, then the archive is an increment of the archive that ended at that
+// checkpoint, and only has the documents that changed since.
+//
+// Responses:
+//    default: genericError
+//        200: exportVaultRes
+//        404: genericError
+func (c *Operation) exportVaultHandler(rw http.ResponseWriter, req *http.Request) {
+	logger := c.requestLogger(req)
+
+	vaultID, success := unescapePathVar(logger, vaultIDPathVariable, mux.Vars(req), rw)
+	if !success {
+		return
+	}
+
+	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.ExportVaultReceiveRequest, vaultID))
+
+	var (
+		archive *edvprovider.VaultArchive
+		err     error
+	)
+
+	if since := req.URL.Query().Get(sinceQueryParameter); since != "" {
+		archive, err = c.vaultCollection.provider.OpenVaultArchiveIncrement(vaultID, since)
+	} else {
+		archive, err = c.vaultCollection.provider.OpenVaultArchive(vaultID)
+	}
+
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, messages.ErrVaultNotFound) || errors.Is(err, messages.ErrBackupCheckpointNotFound) {
+			statusCode = http.StatusNotFound
+		}
+
+		writeErrorWithVaultID(logger, rw, statusCode, messages.ExportVaultFailure, err, vaultID)
+
+		return
+	}
+
+	rw.Header().Set("Content-Type", vaultArchiveContentType)
+
+	// The status has been sent by the time the documents are being written, so a failure to write one can only be
+	// logged. Clients can tell that the archive was cut short since it has no end entry.
+	written, err := archive.WriteTo(rw)
+	if err != nil {
+		logger.Errorf(messages.ExportVaultFailure, vaultID, err)
+		return
+	}
+
+	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.ExportVaultSuccess, vaultID, written))
+}
+
+// Import Vault swagger:route POST /encrypted-data-vaults/import importVaultReq
+//
+// Creates a new data vault from an archive made by the export endpoint, optionally followed by incremental archives
+// that are applied in order. The documents in the archives are stored in batches, and their indexed attributes are
+// mapped again. If the archives can't be imported, then the new vault is deleted.
+//
+// Responses:
+//    default: genericError
+//        201: createVaultRes
+//        400: genericError
+//        409: genericError
+//        413: genericError
+func (c *Operation) importVaultHandler(rw http.ResponseWriter, req *http.Request) {
+	logger := c.requestLogger(req)
+
+	logger.Debugf(messages.DebugLogEvent, messages.ImportVaultReceiveRequest)
+
+	recorder := &readErrorRecorder{reader: req.Body}
+	archive := json.NewDecoder(recorder)
+
+	config, err := readVaultArchiveConfiguration(archive)
+	if err != nil {
+		c.writeImportVaultFailure(logger, rw, recorder, err)
+		return
+	}
+
+	// Like vaults that are created, imported vaults have no capability yet, so their controller is the one that
+	// imports them.
+	audit.SetActor(req.Context(), config.Controller)
+
+	err = validateDataVaultConfiguration(config)
+	if err != nil {
+		c.writeImportVaultFailure(logger, rw, recorder, fmt.Errorf("%w: %s", messages.ErrInvalidVaultArchive, err))
+		return
+	}
+
+	tenantID, err := c.vaultTenant(req)
+	if err != nil {
+		writeCreateDataVaultFailure(logger, rw, err, nil)
+		return
+	}
+
+	vaultID, err := edvutils.GenerateEDVCompatibleID()
+	if err != nil {
+		writeCreateDataVaultFailure(logger, rw, err, nil)
+		return
+	}
+
+	capability, err := c.newDataVault(vaultID, config, tenantID)
+	if err != nil {
+		writeCreateDataVaultFailure(logger, rw, err, nil)
+		return
+	}
+
+	documents, err := c.importVaultArchives(archive, vaultID)
+	if err != nil {
+		c.deleteImportedVault(logger, vaultID)
+		c.writeImportVaultFailure(logger, rw, recorder, err)
+
+		return
+	}
+
+	logger.Infof(messages.ImportVaultSuccess, documents, vaultID)
+
+	writeCreateDataVaultSuccess(logger, rw, vaultID, req.Host, nil, capability)
+}
+
+// readVaultArchiveConfiguration reads the vault configuration that an archive starts with.
+func readVaultArchiveConfiguration(archive *json.Decoder) (*models.DataVaultConfiguration, error) {
+	var entry models.VaultArchiveEntry
+
+	err := archive.Decode(&entry)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read configuration: %s", messages.ErrInvalidVaultArchive, err)
+	}
+
+	if entry.Configuration == nil {
+		return nil, fmt.Errorf("%w: archive doesn't start with a configuration", messages.ErrInvalidVaultArchive)
+	}
+
+	return entry.Configuration, nil
+}
+
+// importVaultArchives stores the documents of the full archive whose configuration was read, and then those of the
+// incremental archives that follow it, in the given vault. It returns the number of documents stored.
+func (c *Operation) importVaultArchives(archive *json.Decoder, vaultID string) (int, error) {
+	store, err := c.vaultCollection.provider.OpenStore(vaultID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open store for vault: %w", err)
+	}
+
+	imported, end, err := c.importVaultArchiveEntries(archive, store, false)
+	if err != nil {
+		return imported, err
+	}
+
+	for archive.More() {
+		err = readVaultArchiveIncrement(archive, end.Checkpoint)
+		if err != nil {
+			return imported, err
+		}
+
+		var incrementImported int
+
+		incrementImported, end, err = c.importVaultArchiveEntries(archive, store, true)
+		imported += incrementImported
+
+		if err != nil {
+			return imported, err
+		}
+	}
+
+	if _, err = archive.Token(); !errors.Is(err, io.EOF) {
+		return imported, fmt.Errorf("%w: unexpected data after the end of the archive", messages.ErrInvalidVaultArchive)
+	}
+
+	return imported, nil
+}
+
+// readVaultArchiveIncrement reads the start of an incremental archive, which must be an increment of the checkpoint
+// of the archive before it.
+func readVaultArchiveIncrement(archive *json.Decoder, checkpoint string) error {
+	var entry models.VaultArchiveEntry
+
+	err := archive.Decode(&entry)
+	if err != nil {
+		return fmt.Errorf("%w: failed to read increment: %s", messages.ErrInvalidVaultArchive, err)
+	}
+
+	if entry.Increment == nil {
+		return fmt.Errorf("%w: only incremental archives can follow the end of an archive",
+			messages.ErrInvalidVaultArchive)
+	}
+
+	if checkpoint == "" || entry.Increment.Since != checkpoint {
+		return fmt.Errorf("%w: increment since checkpoint %q doesn't follow the archive before it, which ends at "+
+			"checkpoint %q", messages.ErrInvalidVaultArchive, entry.Increment.Since, checkpoint)
+	}
+
+	return nil
+}
+
+// importVaultArchiveEntries stores the documents in the rest of an archive in the given store, and deletes the ones
+// an incremental archive lists as deleted. It checks that the archive ends where it says it does, and returns the
+// number of documents stored along with the end of the archive.
+func (c *Operation) importVaultArchiveEntries(archive *json.Decoder, store *edvprovider.Store,
+	increment bool) (int, *models.VaultArchiveEnd, error) {
+	var documents []models.EncryptedDocument
+
+	imported, deleted := 0, 0
+
+	for {
+		var entry models.VaultArchiveEntry
+
+		err := archive.Decode(&entry)
+		if err != nil {
+			return imported, nil, fmt.Errorf("%w: failed to read entry after %d documents: %s",
+				messages.ErrInvalidVaultArchive, imported+len(documents), err)
+		}
+
+		switch {
+		case entry.End != nil:
+			imported, err = storeImportedDocuments(store, documents, imported, increment)
+			if err != nil {
+				return imported, nil, err
+			}
+
+			return imported, entry.End, checkVaultArchiveEnd(entry.End, imported, deleted)
+		case entry.Deleted != "" && increment:
+			err = store.Delete(entry.Deleted)
+			if err != nil {
+				return imported, nil, fmt.Errorf("failed to delete document %s: %w", entry.Deleted, err)
+			}
+
+			deleted++
+		default:
+			document, errDecode := c.decodeArchivedDocument(entry)
+			if errDecode != nil {
+				return imported, nil, errDecode
+			}
+
+			documents = append(documents, document)
+
+			if len(documents) == importBatchSize {
+				imported, err = storeImportedDocuments(store, documents, imported, increment)
+				if err != nil {
+					return imported, nil, err
+				}
+
+				documents = documents[:0]
+			}
+		}
+	}
+}
+
+// decodeArchivedDocument decodes and validates the document in an archive entry.
+func (c *Operation) decodeArchivedDocument(entry models.VaultArchiveEntry) (models.EncryptedDocument, error) {
+	if entry.Document == nil {
+		return models.EncryptedDocument{}, fmt.Errorf("%w: unexpected entry where a document or the end was expected",
+			messages.ErrInvalidVaultArchive)
+	}
+
+	if c.maxDocumentSize > 0 && uint64(len(entry.Document)) > c.maxDocumentSize {
+		return models.EncryptedDocument{}, errDocumentTooLarge
+	}
+
+	var document models.EncryptedDocument
+
+	err := json.Unmarshal(entry.Document, &document)
+	if err != nil {
+		return models.EncryptedDocument{}, fmt.Errorf("%w: %s", messages.ErrInvalidVaultArchive, err)
+	}
+
+	err = c.validateEncryptedDocument(document)
+	if err != nil {
+		return models.EncryptedDocument{}, fmt.Errorf("%w: document %s: %s", messages.ErrInvalidVaultArchive,
+			document.ID, err)
+	}
+
+	return document, nil
+}
+
+// storeImportedDocuments stores a batch of imported documents, which regenerates their mapping documents, and returns
+// the number of documents imported so far. Documents in incremental archives may already be stored, so they're
+// restored instead (see edvprovider.Store.RestoreDocuments).
+func storeImportedDocuments(store *edvprovider.Store, documents []models.EncryptedDocument, imported int,
+	increment bool) (int, error) {
+	if len(documents) == 0 {
+		return imported, nil
+	}
+
+	storeDocuments := store.UpsertBulk
+	if increment {
+		storeDocuments = store.RestoreDocuments
+	}
+
+	err := storeDocuments(documents)
+	if err != nil {
+		return imported, fmt.Errorf("failed to store documents: %w", err)
+	}
+
+	return imported + len(documents), nil
+}
+
+// checkVaultArchiveEnd checks that the end of an archive has the number of documents that were imported and deleted.
+func checkVaultArchiveEnd(end *models.VaultArchiveEnd, imported, deleted int) error {
+	if end.Documents != imported || end.Deleted != deleted {
+		return fmt.Errorf("%w: archive ends after %d documents and %d deletions but has %d and %d",
+			messages.ErrInvalidVaultArchive, end.Documents, end.Deleted, imported, deleted)
+	}
+
+	return nil
+}
+
+// deleteImportedVault deletes a vault whose archive couldn't be imported. The import has already failed, so a
+// failure to delete the vault is only logged.
+func (c *Operation) deleteImportedVault(logger logging.Logger, vaultID string) {
+	err := c.vaultCollection.provider.DeleteStore(vaultID)
+	if err != nil {
+		logger.Errorf(messages.DeleteVaultFailure, vaultID, err)
+		return
+	}
+
+	c.cleanUpDeletedVault(logger, vaultID)
+}
+
+func (c *Operation) writeImportVaultFailure(logger logging.Logger, rw http.ResponseWriter, recorder *readErrorRecorder,
+	errImport error) {
+	var (
+		limitErr *edvprovider.MappingDocumentLimitError
+		quotaErr *edvprovider.TenantQuotaError
+	)
+
+	statusCode := http.StatusInternalServerError
+
+	switch {
+	case recorder.err != nil:
+		errImport = recorder.err
+	case errors.Is(errImport, errDocumentTooLarge):
+		statusCode = http.StatusRequestEntityTooLarge
+		errImport = fmt.Errorf(messages.DocumentTooLarge, c.maxDocumentSize)
+	case errors.As(errImport, &limitErr):
+		writeMappingDocumentLimitFailure(logger, rw, limitErr, fmt.Sprintf(messages.ImportVaultFailure, errImport))
+		return
+	case errors.As(errImport, &quotaErr):
+		statusCode = tenantQuotaStatusCode(quotaErr)
+	case errors.Is(errImport, messages.ErrInvalidVaultArchive):
+		statusCode = http.StatusBadRequest
+	}
+
+	logger.Infof(messages.ImportVaultFailure, errImport)
+
+	rw.WriteHeader(statusCode)
+
+	_, errWrite := rw.Write([]byte(fmt.Sprintf(messages.ImportVaultFailure, errImport)))
+	if errWrite != nil {
+		logger.Errorf(messages.ImportVaultFailure+messages.FailWriteResponse, errImport, errWrite)
+	}
+}
@@ -0,0 +1,314 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/edvprovider"
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestExportAndImportVault(t *testing.T) {
+	t.Run("Imported vault has the exported configuration and documents", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID, indexedTestDocument(t), vaultID)
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID2, testEncryptedDocument2, vaultID)
+
+		rr := doExportVaultCall(t, op, vaultID, "")
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, vaultArchiveContentType, rr.Header().Get("Content-Type"))
+
+		archive := rr.Body.String()
+		require.Len(t, strings.Split(strings.TrimSpace(archive), "\n"), 4)
+
+		// The archive is imported into another server.
+		importOp := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+
+		rr = doImportVaultCall(t, importOp, strings.NewReader(archive))
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+		importedVaultID := getVaultIDFromURL(rr.Header().Get("Location"))
+
+		rr = doListDocumentsCall(t, importOp, importedVaultID, "")
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, `{"documents":[{"id":"`+testDocID2+`","sequence":0},{"id":"`+testDocID+`","sequence":0}],`+
+			`"more":false}`, rr.Body.String())
+
+		// The mapping documents of the imported documents were regenerated, so they can be queried.
+		req, err := http.NewRequest(http.MethodPost, "", bytes.NewBufferString(testQuery))
+		require.NoError(t, err)
+
+		req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: importedVaultID})
+		rr = httptest.NewRecorder()
+
+		getHandler(t, importOp, queryVaultEndpoint, http.MethodPost).Handle().ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, `["/encrypted-data-vaults/`+importedVaultID+`/documents/`+testDocID+`"]`, rr.Body.String())
+
+		// The archive of the imported vault is the same as the original one, apart from its checkpoint.
+		rr = doExportVaultCall(t, importOp, importedVaultID, "")
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, archive[:strings.LastIndex(archive, `"checkpoint"`)],
+			rr.Body.String()[:strings.LastIndex(rr.Body.String(), `"checkpoint"`)])
+	})
+	t.Run("Imported vault has the changes of incremental archives", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID2, testEncryptedDocument2, vaultID)
+
+		rr := doExportVaultCall(t, op, vaultID, "")
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		archives := rr.Body.String()
+
+		store, err := op.vaultCollection.provider.OpenStore(vaultID)
+		require.NoError(t, err)
+
+		var updatedDocument models.EncryptedDocument
+
+		require.NoError(t, json.Unmarshal([]byte(indexedTestDocument(t)), &updatedDocument))
+
+		updatedDocument.Sequence = 1
+
+		require.NoError(t, store.UpsertBulk([]models.EncryptedDocument{updatedDocument}))
+
+		rr = doExportVaultCall(t, op, vaultID, archiveCheckpoint(t, archives))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		archives += rr.Body.String()
+
+		require.NoError(t, store.Delete(testDocID2))
+
+		rr = doExportVaultCall(t, op, vaultID, archiveCheckpoint(t, archives))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		archives += rr.Body.String()
+
+		importOp := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+
+		rr = doImportVaultCall(t, importOp, strings.NewReader(archives))
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+		importedVaultID := getVaultIDFromURL(rr.Header().Get("Location"))
+
+		rr = doListDocumentsCall(t, importOp, importedVaultID, "")
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, `{"documents":[{"id":"`+testDocID+`","sequence":1}],"more":false}`, rr.Body.String())
+
+		importedStore, err := importOp.vaultCollection.provider.OpenStore(importedVaultID)
+		require.NoError(t, err)
+
+		importedDocument, err := importedStore.Get(testDocID)
+		require.NoError(t, err)
+
+		storedDocument, err := store.Get(testDocID)
+		require.NoError(t, err)
+		require.Equal(t, storedDocument, importedDocument)
+	})
+	t.Run("Export increment since a checkpoint that isn't the vault's last one", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		rr := doExportVaultCall(t, op, vaultID, "checkpoint")
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Contains(t, rr.Body.String(), messages.ErrBackupCheckpointNotFound.Error())
+	})
+	t.Run("Export vault that does not exist", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		createConfigStoreExpectSuccess(t, op)
+
+		rr := doExportVaultCall(t, op, testVaultID, "")
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.ExportVaultFailure, testVaultID, messages.ErrVaultNotFound),
+			rr.Body.String())
+	})
+	t.Run("Import vault with a reference ID that's already taken", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		rr := doExportVaultCall(t, op, vaultID, "")
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rr = doImportVaultCall(t, op, rr.Body)
+		require.Equal(t, http.StatusConflict, rr.Code)
+		require.Contains(t, rr.Body.String(), messages.ErrDuplicateVault.Error())
+	})
+	t.Run("Invalid archives", func(t *testing.T) {
+		configuration := `{"configuration":` + testDataVaultConfiguration + "}\n"
+		document := `{"document":` + testEncryptedDocument + "}\n"
+
+		for name, tc := range map[string]struct {
+			archive       string
+			expectedError string
+		}{
+			"Empty archive": {
+				expectedError: "failed to read configuration: EOF",
+			},
+			"Archive that doesn't start with a configuration": {
+				archive:       document,
+				expectedError: "archive doesn't start with a configuration",
+			},
+			"Invalid configuration": {
+				archive:       `{"configuration":{}}`,
+				expectedError: messages.BlankController,
+			},
+			"Invalid document": {
+				archive:       configuration + `{"document":{"id":"0OIl"}}`,
+				expectedError: "document 0OIl: " + messages.ErrNotBase58Encoded.Error(),
+			},
+			"Archive without an end": {
+				archive:       configuration + document,
+				expectedError: "failed to read entry after 1 documents: EOF",
+			},
+			"Second configuration": {
+				archive:       configuration + configuration,
+				expectedError: "unexpected entry where a document or the end was expected",
+			},
+			"Wrong number of documents at the end": {
+				archive:       configuration + document + `{"end":{"documents":2}}`,
+				expectedError: "archive ends after 2 documents and 0 deletions but has 1 and 0",
+			},
+			"Data after the end": {
+				archive:       configuration + `{"end":{"documents":0,"checkpoint":"1"}}` + "\n" + document,
+				expectedError: "only incremental archives can follow the end of an archive",
+			},
+			"Increment of another checkpoint": {
+				archive: configuration + `{"end":{"documents":0,"checkpoint":"1"}}` + "\n" +
+					`{"increment":{"since":"2"}}` + "\n" + `{"end":{"documents":0}}`,
+				expectedError: `increment since checkpoint "2" doesn't follow the archive before it, which ends ` +
+					`at checkpoint "1"`,
+			},
+			"Deletion in a full archive": {
+				archive:       configuration + `{"deleted":"` + testDocID + `"}`,
+				expectedError: "unexpected entry where a document or the end was expected",
+			},
+			"Wrong number of deletions at the end of an increment": {
+				archive: configuration + `{"end":{"documents":0,"checkpoint":"1"}}` + "\n" +
+					`{"increment":{"since":"1"}}` + "\n" + `{"end":{"documents":0,"deleted":1}}`,
+				expectedError: "archive ends after 0 documents and 1 deletions but has 0 and 0",
+			},
+			"Closing bracket after the end": {
+				archive:       configuration + `{"end":{"documents":0}}]`,
+				expectedError: "unexpected data after the end of the archive",
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+
+				rr := doImportVaultCall(t, op, strings.NewReader(tc.archive))
+				require.Equal(t, http.StatusBadRequest, rr.Code)
+				require.Contains(t, rr.Body.String(), messages.ErrInvalidVaultArchive.Error())
+				require.Contains(t, rr.Body.String(), tc.expectedError)
+
+				// The vault of a failed import is deleted, so its reference ID can still be used.
+				createDataVaultExpectSuccess(t, op)
+			})
+		}
+	})
+	t.Run("Document too large", func(t *testing.T) {
+		op := New(&Config{
+			Provider:        edvprovider.NewProvider(mem.NewProvider(), 100),
+			MaxDocumentSize: uint64(len(testEncryptedDocument)) - 1,
+		})
+
+		rr := doImportVaultCall(t, op, strings.NewReader(`{"configuration":`+testDataVaultConfiguration+"}\n"+
+			`{"document":`+testEncryptedDocument+"}\n"+`{"end":{"documents":1}}`))
+		require.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.ImportVaultFailure,
+			fmt.Sprintf(messages.DocumentTooLarge, len(testEncryptedDocument)-1)), rr.Body.String())
+	})
+	t.Run("Fail to read archive", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+
+		rr := doImportVaultCall(t, op, failingReadCloser{})
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.ImportVaultFailure, errFailingReadCloser), rr.Body.String())
+	})
+}
+
+// indexedTestDocument returns testEncryptedDocument with the indexed attribute that testQuery matches.
+func indexedTestDocument(t *testing.T) string {
+	t.Helper()
+
+	var document models.EncryptedDocument
+
+	require.NoError(t, json.Unmarshal([]byte(testEncryptedDocument), &document))
+
+	document.IndexedAttributeCollections = []models.IndexedAttributeCollection{{
+		HMAC: models.IDTypePair{ID: "https://example.com/kms/z7BgF536GaR", Type: "Sha256HmacKey2019"},
+		IndexedAttributes: []models.IndexedAttribute{{
+			Name:  "CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ",
+			Value: "RV58Va4904K-18_L5g_vfARXRWEB00knFSGPpukUBro",
+		}},
+	}}
+
+	documentBytes, err := json.Marshal(document)
+	require.NoError(t, err)
+
+	return string(documentBytes)
+}
+
+// archiveCheckpoint returns the checkpoint that the last of the given archives ends at.
+func archiveCheckpoint(t *testing.T, archives string) string {
+	t.Helper()
+
+	lines := strings.Split(strings.TrimSpace(archives), "\n")
+
+	var entry models.VaultArchiveEntry
+
+	require.NoError(t, json.Unmarshal([]byte(lines[len(lines)-1]), &entry))
+	require.NotNil(t, entry.End)
+
+	return entry.End.Checkpoint
+}
+
+// doExportVaultCall exports the given vault, as an incremental archive if since isn't empty.
+func doExportVaultCall(t *testing.T, op *Operation, vaultID, since string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, "?"+url.Values{sinceQueryParameter: {since}}.Encode(), nil)
+	require.NoError(t, err)
+
+	req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID})
+
+	rr := httptest.NewRecorder()
+
+	getHandler(t, op, exportVaultEndpoint, http.MethodGet).Handle().ServeHTTP(rr, req)
+
+	return rr
+}
+
+func doImportVaultCall(t *testing.T, op *Operation, archive io.Reader) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, "", archive)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+
+	getHandler(t, op, importVaultEndpoint, http.MethodPost).Handle().ServeHTTP(rr, req)
+
+	return rr
+}
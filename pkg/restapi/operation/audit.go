@@ -0,0 +1,198 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/trustbloc/edv/pkg/audit"
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/internal/common/support"
+	"github.com/trustbloc/edv/pkg/logging"
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+)
+
+const (
+	locationHeader = "Location"
+
+	documentsPathSegment = "documents"
+	// The number of path segments after /encrypted-data-vaults/ in the location of a document.
+	documentLocationLength = 3
+)
+
+type auditor interface {
+	Record(entry *audit.Entry)
+}
+
+type auditExporter interface {
+	Export(w io.Writer, vaultID string) (int, error)
+}
+
+// auditedHandler returns the handler for an endpoint, which records an audit entry for the operation and enforces
+// the restrictions of the requests for it.
+func (c *Operation) auditedHandler(path, method, operation string, handler http.HandlerFunc) Handler {
+	return support.NewHTTPHandler(path, method, c.audited(operation, c.restricted(operation, handler)))
+}
+
+// audited returns a handler that records an audit entry for the operation once handler has responded, if an auditor
+// is configured. Only the identifiers in the request's path and Location response header are recorded, never the
+// request or response bodies.
+func (c *Operation) audited(operation string, handler http.HandlerFunc) http.HandlerFunc {
+	if c.auditor == nil {
+		return handler
+	}
+
+	return func(rw http.ResponseWriter, req *http.Request) {
+		vars := mux.Vars(req)
+
+		entry := &audit.Entry{
+			Actor:         auth.Actor(req.Context()),
+			Operation:     operation,
+			VaultID:       unescapedPathVar(vars, vaultIDPathVariable),
+			DocumentID:    unescapedPathVar(vars, docIDPathVariable),
+			CorrelationID: logging.CorrelationID(req.Context()),
+		}
+
+		recorder := &statusRecorder{ResponseWriter: rw, statusCode: http.StatusOK}
+
+		handler(recorder, req.WithContext(audit.NewContext(req.Context(), entry)))
+
+		entry.StatusCode = recorder.statusCode
+
+		// The IDs of created vaults and documents are only known once they've been created.
+		if entry.VaultID == "" || entry.DocumentID == "" {
+			vaultID, documentID := locationIDs(rw.Header().Get(locationHeader))
+
+			if entry.VaultID == "" {
+				entry.VaultID = vaultID
+			}
+
+			if entry.DocumentID == "" && operation == audit.CreateDocumentOperation {
+				entry.DocumentID = documentID
+			}
+		}
+
+		c.auditor.Record(entry)
+	}
+}
+
+// Export Audit Log swagger:route GET /encrypted-data-vaults/{vaultID}/audit exportAuditLogReq
+//
+// Exports the audit log of a data vault as JSON lines: its audit entries, oldest first, each chained to the ones
+// before it by its hash, followed by the server's signature over the hash of the last one.
+//
+// Responses:
+//    default: genericError
+//        200: exportAuditLogRes
+//        404: genericError
+func (c *Operation) exportAuditLogHandler(rw http.ResponseWriter, req *http.Request) {
+	logger := c.requestLogger(req)
+
+	vaultID, success := unescapePathVar(logger, vaultIDPathVariable, mux.Vars(req), rw)
+	if !success {
+		return
+	}
+
+	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.ExportAuditLogReceiveRequest, vaultID))
+
+	if !c.vaultExists(logger, rw, messages.ExportAuditLogFailure, vaultID) {
+		return
+	}
+
+	export := &exportWriter{ResponseWriter: rw}
+
+	written, err := c.auditExporter.Export(export, vaultID)
+	if err != nil {
+		// Once the export has started, the status has been sent, so a failure can only be logged. Clients can tell
+		// that the export was cut short since it isn't signed.
+		if export.started {
+			logger.Errorf(messages.ExportAuditLogFailure, vaultID, err)
+			return
+		}
+
+		writeErrorWithVaultID(logger, rw, http.StatusInternalServerError, messages.ExportAuditLogFailure, err, vaultID)
+
+		return
+	}
+
+	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.ExportAuditLogSuccess, written, vaultID))
+}
+
+// exportWriter sets the content type of an export when it starts being written, and records that it has, so that
+// failures before then can still be responded to with an error.
+type exportWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (w *exportWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+
+		w.Header().Set("Content-Type", vaultArchiveContentType)
+	}
+
+	return w.ResponseWriter.Write(p)
+}
+
+func unescapedPathVar(vars map[string]string, pathVar string) string {
+	value, err := url.PathUnescape(vars[pathVar])
+	if err != nil {
+		return vars[pathVar]
+	}
+
+	return value
+}
+
+// locationIDs returns the vault ID and document ID in the location of a vault or document.
+func locationIDs(location string) (string, string) {
+	index := strings.Index(location, edvCommonEndpointPathRoot+"/")
+	if index < 0 {
+		return "", ""
+	}
+
+	segments := strings.Split(location[index+len(edvCommonEndpointPathRoot)+1:], "/")
+
+	vaultID, err := url.PathUnescape(segments[0])
+	if err != nil {
+		return "", ""
+	}
+
+	if len(segments) < documentLocationLength || segments[1] != documentsPathSegment {
+		return vaultID, ""
+	}
+
+	documentID, err := url.PathUnescape(segments[2])
+	if err != nil {
+		return vaultID, ""
+	}
+
+	return vaultID, documentID
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (s *statusRecorder) WriteHeader(statusCode int) {
+	s.statusCode = statusCode
+	s.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Flush sends any buffered data to the client, if the underlying response writer supports it.
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
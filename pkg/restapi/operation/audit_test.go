@@ -0,0 +1,185 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/audit"
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/edvprovider"
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+)
+
+func TestOperation_Audit(t *testing.T) {
+	auditor := &mockAuditor{}
+
+	op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100), Auditor: auditor})
+
+	createConfigStoreExpectSuccess(t, op)
+
+	vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+	storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
+
+	for _, docID := range []string{testDocID, "unknownDocID"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = req.WithContext(auth.WithActor(req.Context(), "did:example:reader#key1"))
+		req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID, docIDPathVariable: docID})
+
+		getHandler(t, op, readDocumentEndpoint, http.MethodGet).Handle().ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	require.Equal(t, []audit.Entry{
+		{Actor: testValidURI, Operation: audit.CreateVaultOperation, VaultID: vaultID, StatusCode: http.StatusCreated},
+		{Operation: audit.CreateDocumentOperation, VaultID: vaultID, DocumentID: testDocID,
+			StatusCode: http.StatusCreated},
+		{Actor: "did:example:reader#key1", Operation: audit.ReadDocumentOperation, VaultID: vaultID,
+			DocumentID: testDocID, StatusCode: http.StatusOK},
+		{Actor: "did:example:reader#key1", Operation: audit.ReadDocumentOperation, VaultID: vaultID,
+			DocumentID: "unknownDocID", StatusCode: http.StatusNotFound},
+	}, auditor.entries)
+}
+
+func TestOperation_ExportAuditLog(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	auditStore, err := audit.NewStore(mem.NewProvider())
+	require.NoError(t, err)
+
+	exporter := audit.NewExporter(auditStore, privateKey)
+
+	op := New(&Config{
+		Provider: edvprovider.NewProvider(mem.NewProvider(), 100), Auditor: audit.New(auditStore),
+		AuditExporter: exporter,
+	})
+
+	createConfigStoreExpectSuccess(t, op)
+
+	vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+	storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
+
+	exportAuditLog := func(t *testing.T, op *Operation, vaultID string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID})
+
+		rr := httptest.NewRecorder()
+
+		getHandler(t, op, auditLogEndpoint, http.MethodGet).Handle().ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		rr := exportAuditLog(t, op, vaultID)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, vaultArchiveContentType, rr.Header().Get("Content-Type"))
+
+		head, err := audit.VerifyExport(rr.Body)
+		require.NoError(t, err)
+		require.Equal(t, vaultID, head.VaultID)
+		require.Equal(t, 2, head.Entries)
+		require.Equal(t, exporter.KeyID(), head.KeyID)
+
+		// The export itself is audited too.
+		rr = exportAuditLog(t, op, vaultID)
+
+		head, err = audit.VerifyExport(rr.Body)
+		require.NoError(t, err)
+		require.Equal(t, 3, head.Entries)
+	})
+	t.Run("Vault not found", func(t *testing.T) {
+		rr := exportAuditLog(t, op, testVaultID)
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Contains(t, rr.Body.String(), messages.ErrVaultNotFound.Error())
+	})
+	t.Run("Fail to export", func(t *testing.T) {
+		op := New(&Config{
+			Provider:      edvprovider.NewProvider(mem.NewProvider(), 100),
+			AuditExporter: &failingAuditExporter{err: errors.New("export error")},
+		})
+
+		createConfigStoreExpectSuccess(t, op)
+
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		rr := exportAuditLog(t, op, vaultID)
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Contains(t, rr.Body.String(), "export error")
+
+		// Once the export has started, it's only cut short.
+		op.auditExporter = &failingAuditExporter{written: `{"entry":{},"hash":"abc"}` + "\n", err: errors.New("export error")}
+
+		rr = exportAuditLog(t, op, vaultID)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, `{"entry":{},"hash":"abc"}`+"\n", rr.Body.String())
+	})
+	t.Run("Not available without an exporter", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+
+		for _, handler := range op.GetRESTHandlers() {
+			require.NotEqual(t, auditLogEndpoint, handler.Path())
+		}
+	})
+}
+
+func TestLocationIDs(t *testing.T) {
+	tests := []struct {
+		location   string
+		vaultID    string
+		documentID string
+	}{
+		{"localhost:8080/encrypted-data-vaults/vault1", "vault1", ""},
+		{"/encrypted-data-vaults/vault%201/documents/doc1", "vault 1", "doc1"},
+		{"/encrypted-data-vaults/vault1/configuration", "vault1", ""},
+		{"/encrypted-data-vaults/%zz", "", ""},
+		{"/encrypted-data-vaults/vault1/documents/%zz", "vault1", ""},
+		{"", "", ""},
+	}
+
+	for _, test := range tests {
+		vaultID, documentID := locationIDs(test.location)
+		require.Equal(t, test.vaultID, vaultID, test.location)
+		require.Equal(t, test.documentID, documentID, test.location)
+	}
+}
+
+type mockAuditor struct {
+	entries []audit.Entry
+}
+
+func (m *mockAuditor) Record(entry *audit.Entry) {
+	m.entries = append(m.entries, *entry)
+}
+
+type failingAuditExporter struct {
+	written string
+	err     error
+}
+
+func (e *failingAuditExporter) Export(w io.Writer, _ string) (int, error) {
+	if e.written != "" {
+		if _, err := io.WriteString(w, e.written); err != nil {
+			return 0, err
+		}
+	}
+
+	return 0, e.err
+}
@@ -0,0 +1,72 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+)
+
+const indexingStatusEndpoint = edvCommonEndpointPathRoot + "/{" + vaultIDPathVariable + "}/indexing"
+
+// Get Indexing Status swagger:route GET /encrypted-data-vaults/{vaultID}/indexing indexingStatusReq
+//
+// Gets the indexing status of a data vault. If asynchronous indexing is enabled, then the documents stored by batch
+// upserts are indexed in the background, and until they are, queries may not find them. Queries are consistent with
+// the vault's documents once no documents are pending.
+//
+// Responses:
+//    default: genericError
+//        200: indexingStatusRes
+//        404: genericError
+func (c *Operation) indexingStatusHandler(rw http.ResponseWriter, req *http.Request) {
+	logger := c.requestLogger(req)
+
+	vaultID, success := unescapePathVar(logger, vaultIDPathVariable, mux.Vars(req), rw)
+	if !success {
+		return
+	}
+
+	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.IndexingStatusReceiveRequest, vaultID))
+
+	if !c.vaultExists(logger, rw, messages.IndexingStatusFailure, vaultID) {
+		return
+	}
+
+	store, err := c.vaultCollection.openStore(req.Context(), vaultID)
+	if err != nil {
+		writeErrorWithVaultID(logger, rw, http.StatusInternalServerError, messages.IndexingStatusFailure, err, vaultID)
+		return
+	}
+
+	status, err := store.IndexingStatus()
+	if err != nil {
+		writeErrorWithVaultID(logger, rw, http.StatusInternalServerError, messages.IndexingStatusFailure, err, vaultID)
+		return
+	}
+
+	statusBytes, err := json.Marshal(status)
+	if err != nil {
+		writeErrorWithVaultID(logger, rw, http.StatusInternalServerError, messages.IndexingStatusFailure, err, vaultID)
+		return
+	}
+
+	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.IndexingStatusSuccess, vaultID,
+		status.PendingDocuments))
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	_, err = rw.Write(statusBytes)
+	if err != nil {
+		logger.Errorf(messages.IndexingStatusSuccess+messages.FailWriteResponse, vaultID, status.PendingDocuments, err)
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/edvprovider"
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestIndexingStatus(t *testing.T) {
+	t.Run("Documents pending until their queue is processed", func(t *testing.T) {
+		provider := edvprovider.NewProvider(mem.NewProvider(), 100, edvprovider.WithAsyncIndexing(1))
+
+		op := New(&Config{Provider: provider})
+		createConfigStoreExpectSuccess(t, op)
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		rr := doIndexingStatusCall(t, op, vaultID)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		require.Equal(t, `{"pendingDocuments":0,"consistent":true}`, rr.Body.String())
+
+		var document models.EncryptedDocument
+
+		require.NoError(t, json.Unmarshal([]byte(testEncryptedDocument), &document))
+
+		store, err := provider.OpenStore(vaultID)
+		require.NoError(t, err)
+		require.NoError(t, store.UpsertBulk([]models.EncryptedDocument{document}))
+
+		rr = doIndexingStatusCall(t, op, vaultID)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, `{"pendingDocuments":1,"consistent":false}`, rr.Body.String())
+
+		indexed, err := provider.ProcessIndexingQueues()
+		require.NoError(t, err)
+		require.Equal(t, 1, indexed)
+
+		rr = doIndexingStatusCall(t, op, vaultID)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, `{"pendingDocuments":0,"consistent":true}`, rr.Body.String())
+	})
+	t.Run("Vault does not exist", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		createConfigStoreExpectSuccess(t, op)
+
+		rr := doIndexingStatusCall(t, op, testVaultID)
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.IndexingStatusFailure, testVaultID, messages.ErrVaultNotFound),
+			rr.Body.String())
+	})
+	t.Run("Fail to query indexing queue", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(&mock.Provider{
+			OpenStoreReturn: &mock.Store{ErrQuery: errors.New("query error")},
+		}, 100)})
+
+		rr := doIndexingStatusCall(t, op, testVaultID)
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.IndexingStatusFailure, testVaultID,
+			"failed to query indexing queue: query error"), rr.Body.String())
+	})
+}
+
+func doIndexingStatusCall(t *testing.T, op *Operation, vaultID string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, "", nil)
+	require.NoError(t, err)
+
+	req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID})
+
+	rr := httptest.NewRecorder()
+
+	getHandler(t, op, indexingStatusEndpoint, http.MethodGet).Handle().ServeHTTP(rr, req)
+
+	return rr
+}
@@ -0,0 +1,153 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/edvprovider"
+	"github.com/trustbloc/edv/pkg/logging"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestOperation_CorrelationID(t *testing.T) {
+	operationLogger := &recordingLogger{}
+	providerLogger := &recordingLogger{}
+	auditor := &mockAuditor{}
+
+	op := New(&Config{
+		Provider: edvprovider.NewProvider(mem.NewProvider(), 100, edvprovider.WithLogger(providerLogger)),
+		Auditor:  auditor,
+		Logger:   operationLogger,
+	})
+
+	createConfigStoreExpectSuccess(t, op)
+
+	vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+	operationLogger.lines = nil
+	providerLogger.lines = nil
+
+	indexedDocument := `{"id":"` + testDocID + `","sequence":0,` +
+		`"indexed":[{"sequence":0,"hmac":{"id":"https://example.com/kms/z7BgF536GaR","type":"Sha256HmacKey2019"},` +
+		`"attributes":[{"name":"indexName1","value":"testVal1"}]}],"jwe":` + testJWE1 + `}`
+
+	for _, encryptedDocument := range []string{indexedDocument, "{"} {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(encryptedDocument))
+		req.Header.Set(logging.CorrelationIDHeader, "request-1")
+		req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID})
+
+		rr := httptest.NewRecorder()
+
+		logging.Middleware(getHandler(t, op, createDocumentEndpoint, http.MethodPost).Handle()).ServeHTTP(rr, req)
+
+		require.Equal(t, "request-1", rr.Header().Get(logging.CorrelationIDHeader))
+	}
+
+	require.NotEmpty(t, operationLogger.lines)
+	require.NotEmpty(t, providerLogger.lines)
+
+	for _, line := range append(operationLogger.lines, providerLogger.lines...) {
+		require.Regexp(t, `^\[correlationID=request-1\] `, line)
+	}
+
+	require.Len(t, auditor.entries, 3)
+	require.Empty(t, auditor.entries[0].CorrelationID)
+	require.Equal(t, "request-1", auditor.entries[1].CorrelationID)
+	require.Equal(t, http.StatusCreated, auditor.entries[1].StatusCode)
+	require.Equal(t, "request-1", auditor.entries[2].CorrelationID)
+	require.Equal(t, http.StatusBadRequest, auditor.entries[2].StatusCode)
+}
+
+func TestOperation_WebhookSecretRedaction(t *testing.T) {
+	const secret = "webhook-signing-secret"
+
+	logger := &recordingLogger{}
+
+	op := New(&Config{
+		Provider:          edvprovider.NewProvider(mem.NewProvider(), 100),
+		EnabledExtensions: &EnabledExtensions{Notifications: true},
+		Notifier:          &mockNotifier{},
+		Logger:            logger,
+	})
+
+	createConfigStoreExpectSuccess(t, op)
+
+	// Webhooks can't be set when a vault is created, so they're kept as an extension of its configuration.
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"controller":"`+testValidURI+`",`+
+		`"referenceId":"`+testReferenceID+`","kek":{"id":"https://example.com/kms/12345",`+
+		`"type":"AesKeyWrappingKey2019"},"hmac":{"id":"https://example.com/kms/67891","type":"Sha256HmacKey2019"},`+
+		`"webhooks":{"endpoints":["https://example.com/webhook"],"secret":"`+secret+`"}}`))
+	rr := httptest.NewRecorder()
+
+	getHandler(t, op, createVaultEndpoint, http.MethodPost).Handle().ServeHTTP(rr, req)
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	vaultID := getVaultIDFromURL(rr.Header().Get("Location"))
+
+	rr = doUpdateConfigurationCall(t, op, vaultID,
+		`{"webhooks":{"endpoints":["https://example.com/webhook"],"secret":"`+secret+`"}}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.NotContains(t, rr.Body.String(), secret)
+
+	var result models.DataVaultConfigurationUpdateResult
+
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	require.Equal(t, &models.VaultWebhooksStatus{Endpoints: []string{"https://example.com/webhook"}, SecretSet: true},
+		result.Webhooks)
+	require.JSONEq(t, `{"endpoints":["https://example.com/webhook"],"secret":"`+redactedSecret+`"}`,
+		string(result.Configuration.Extensions["webhooks"]))
+
+	// The secret is still used to sign events.
+	webhooks, err := op.vaultCollection.provider.VaultWebhooks(vaultID)
+	require.NoError(t, err)
+	require.Equal(t, secret, webhooks.Secret)
+
+	for _, requestBody := range []string{
+		`{"webhooks":{"endpoints":["/webhook"],"secret":"` + secret + `"}}`,
+		`{"webhooks":{"secret":"` + secret + `"`,
+	} {
+		rr = doUpdateConfigurationCall(t, op, vaultID, requestBody)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.NotContains(t, rr.Body.String(), secret)
+	}
+
+	rr = doRotateReferenceIDCall(t, op, vaultID, `{"referenceId":"newReferenceID"}`)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.NotContains(t, rr.Body.String(), secret)
+
+	require.NotEmpty(t, logger.lines)
+
+	for _, line := range logger.lines {
+		require.NotContains(t, line, secret)
+	}
+}
+
+// recordingLogger records the lines that it logs.
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) log(msg string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(msg, args...))
+}
+
+func (l *recordingLogger) Panicf(msg string, args ...interface{}) { l.log(msg, args...) }
+func (l *recordingLogger) Fatalf(msg string, args ...interface{}) { l.log(msg, args...) }
+func (l *recordingLogger) Errorf(msg string, args ...interface{}) { l.log(msg, args...) }
+func (l *recordingLogger) Warnf(msg string, args ...interface{})  { l.log(msg, args...) }
+func (l *recordingLogger) Infof(msg string, args ...interface{})  { l.log(msg, args...) }
+func (l *recordingLogger) Debugf(msg string, args ...interface{}) { l.log(msg, args...) }
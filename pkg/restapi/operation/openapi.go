@@ -6,7 +6,12 @@ SPDX-License-Identifier: Apache-2.0
 
 package operation
 
-import "github.com/trustbloc/edv/pkg/restapi/models"
+import (
+	"encoding/json"
+
+	"github.com/trustbloc/edv/pkg/audit"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
 
 // TODO: Swagger UI doesn't show location header in response: #89
 // TODO: Standardize response body messages to always be in JSON format: #90
@@ -41,6 +46,13 @@ type queryVaultReq struct { // nolint: unused,deadcode
 	// in: path
 	// required: true
 	VaultID string `json:"vaultID"`
+	// The maximum time in milliseconds to spend fetching matching documents before returning partial results. It can
+	// only lower the latency budget configured on the server.
+	// in: header
+	LatencyBudget string `json:"EDV-Query-Latency-Budget"`
+	// The continuation token received with the previous partial results of the same query.
+	// in: header
+	ContinuationToken string `json:"EDV-Query-Continuation-Token"`
 	// in: body
 	QueryRequest models.Query
 }
@@ -55,6 +67,41 @@ type queryVaultRes struct { // nolint: unused,deadcode
 	QueryResults string
 }
 
+// countQueryReq model
+//
+// swagger:parameters countQueryReq
+type countQueryReq struct { // nolint: unused,deadcode
+	// in: path
+	// required: true
+	VaultID string `json:"vaultID"`
+	// The name of the index for an "index + equals" or "index + operator" query.
+	// in: query
+	Index string `json:"index"`
+	// The value of the index for an "index + equals" query.
+	// in: query
+	Equals string `json:"equals"`
+	// The name of the index for a "has" query.
+	// in: query
+	Has string `json:"has"`
+	// The name of the custom operator for an "index + operator" query.
+	// in: query
+	Operator string `json:"operator"`
+	// The operand of an "index + operator" query, as JSON.
+	// in: query
+	Operand string `json:"operand"`
+	// in: query
+	HMACKeyID string `json:"hmacKeyId"`
+}
+
+// countQueryRes model
+//
+// swagger:response countQueryRes
+type countQueryRes struct { // nolint: unused,deadcode
+	// The number of documents that match the query.
+	// in: header
+	Count int `json:"EDV-Query-Count"`
+}
+
 // createDocumentReq model
 //
 // swagger:parameters createDocumentReq
@@ -83,6 +130,12 @@ type readDocumentReq struct { // nolint: unused,deadcode
 	// in: path
 	// required: true
 	DocID string `json:"docID"`
+	// The sequence of the revision to read, if revision history is enabled.
+	// in: query
+	Version uint64 `json:"version"`
+	// Read the revision that was current at this RFC 3339 time, if revision history is enabled.
+	// in: query
+	AsOf string `json:"asOf"`
 }
 
 // readDocumentRes model
@@ -93,6 +146,49 @@ type readDocumentRes struct { // nolint: unused,deadcode
 	RetrievedDocument string
 }
 
+// checkDocumentReq model
+//
+// swagger:parameters checkDocumentReq
+type checkDocumentReq struct { // nolint: unused,deadcode
+	// in: path
+	// required: true
+	VaultID string `json:"vaultID"`
+	// in: path
+	// required: true
+	DocID string `json:"docID"`
+}
+
+// listDocumentsReq model
+//
+// swagger:parameters listDocumentsReq
+type listDocumentsReq struct { // nolint: unused,deadcode
+	// in: path
+	// required: true
+	VaultID string `json:"vaultID"`
+	// in: query
+	AfterSequence uint64 `json:"afterSequence"`
+	// in: query
+	AfterID string `json:"afterId"`
+	// in: query
+	Limit uint `json:"limit"`
+}
+
+// listDocumentsRes model
+//
+// swagger:response listDocumentsRes
+type listDocumentsRes struct { // nolint: unused,deadcode
+	// in: body
+	DocumentList models.DocumentList
+}
+
+// deletedDocumentRes model
+//
+// swagger:response deletedDocumentRes
+type deletedDocumentRes struct { // nolint: unused,deadcode
+	// in: body
+	Tombstone models.Tombstone
+}
+
 // updateDocumentReq model
 //
 // swagger:parameters updateDocumentReq
@@ -103,10 +199,22 @@ type updateDocumentReq struct { // nolint: unused,deadcode
 	// in: path
 	// required: true
 	DocID string `json:"docID"`
+	// The ETag of the document version this update is based on.
+	// in: header
+	IfMatch string `json:"If-Match"`
 	// in: body
 	Document models.EncryptedDocument
 }
 
+// deleteVaultReq model
+//
+// swagger:parameters deleteVaultReq
+type deleteVaultReq struct { // nolint: unused,deadcode
+	// in: path
+	// required: true
+	VaultID string `json:"vaultID"`
+}
+
 // deleteDocumentReq model
 //
 // swagger:parameters deleteDocumentReq
@@ -117,6 +225,21 @@ type deleteDocumentReq struct { // nolint: unused,deadcode
 	// in: path
 	// required: true
 	DocID string `json:"docID"`
+	// The ETag of the document version expected to be deleted.
+	// in: header
+	IfMatch string `json:"If-Match"`
+}
+
+// restoreDocumentReq model
+//
+// swagger:parameters restoreDocumentReq
+type restoreDocumentReq struct { // nolint: unused,deadcode
+	// in: path
+	// required: true
+	VaultID string `json:"vaultID"`
+	// in: path
+	// required: true
+	DocID string `json:"docID"`
 }
 
 // emptyRes model
@@ -124,3 +247,238 @@ type deleteDocumentReq struct { // nolint: unused,deadcode
 // swagger:response emptyRes
 type emptyRes struct { // nolint: unused,deadcode
 }
+
+// batchReq model
+//
+// swagger:parameters batchReq
+type batchReq struct { // nolint: unused,deadcode
+	// in: path
+	// required: true
+	VaultID string `json:"vaultID"`
+	// in: body
+	Batch models.Batch
+}
+
+// batchRes model
+//
+// swagger:response batchRes
+type batchRes struct { // nolint: unused,deadcode
+	// The response to each operation of the batch, in order: the location of the document for upserts and an empty
+	// string for deletes, or the reason that the operation wasn't performed.
+	// in: body
+	Responses []string
+}
+
+// batchCapacityReq model
+//
+// swagger:parameters batchCapacityReq
+type batchCapacityReq struct { // nolint: unused,deadcode
+	// in: path
+	// required: true
+	VaultID string `json:"vaultID"`
+	// in: body
+	CapacityCheck models.BatchCapacityCheck
+}
+
+// batchCapacityRes model
+//
+// swagger:response batchCapacityRes
+type batchCapacityRes struct { // nolint: unused,deadcode
+	// in: body
+	Result models.BatchCapacityCheckResult
+}
+
+// updateConfigurationReq model
+//
+// swagger:parameters updateConfigurationReq
+type updateConfigurationReq struct { // nolint: unused,deadcode
+	// in: path
+	// required: true
+	VaultID string `json:"vaultID"`
+	// in: body
+	Update models.DataVaultConfigurationUpdate
+}
+
+// updateConfigurationRes model
+//
+// swagger:response updateConfigurationRes
+type updateConfigurationRes struct { // nolint: unused,deadcode
+	// in: body
+	Result models.DataVaultConfigurationUpdateResult
+}
+
+// createSubscriptionReq model
+//
+// swagger:parameters createSubscriptionReq
+type createSubscriptionReq struct { // nolint: unused,deadcode
+	// in: path
+	// required: true
+	VaultID string `json:"vaultID"`
+	// in: body
+	Subscription models.Subscription
+}
+
+// createSubscriptionRes model
+//
+// swagger:response createSubscriptionRes
+type createSubscriptionRes struct { // nolint: unused,deadcode
+	// in: header
+	Location string
+	// in: header
+	Deprecation string
+	// in: body
+	Subscription models.Subscription
+}
+
+// readSubscriptionsReq model
+//
+// swagger:parameters readSubscriptionsReq
+type readSubscriptionsReq struct { // nolint: unused,deadcode
+	// in: path
+	// required: true
+	VaultID string `json:"vaultID"`
+}
+
+// readSubscriptionsRes model
+//
+// swagger:response readSubscriptionsRes
+type readSubscriptionsRes struct { // nolint: unused,deadcode
+	// in: header
+	Deprecation string
+	// in: body
+	Subscriptions []models.Subscription
+}
+
+// deleteSubscriptionReq model
+//
+// swagger:parameters deleteSubscriptionReq
+type deleteSubscriptionReq struct { // nolint: unused,deadcode
+	// in: path
+	// required: true
+	VaultID string `json:"vaultID"`
+	// in: path
+	// required: true
+	SubscriptionID string `json:"subscriptionID"`
+}
+
+// rotateReferenceIDReq model
+//
+// swagger:parameters rotateReferenceIDReq
+type rotateReferenceIDReq struct { // nolint: unused,deadcode
+	// in: path
+	// required: true
+	VaultID string `json:"vaultID"`
+	// in: body
+	Rotation models.ReferenceIDRotation
+}
+
+// rotateReferenceIDRes model
+//
+// swagger:response rotateReferenceIDRes
+type rotateReferenceIDRes struct { // nolint: unused,deadcode
+	// in: body
+	Configuration models.DataVaultConfiguration
+}
+
+// delegateCapabilityReq model
+//
+// swagger:parameters delegateCapabilityReq
+type delegateCapabilityReq struct { // nolint: unused,deadcode
+	// in: path
+	// required: true
+	VaultID string `json:"vaultID"`
+	// in: body
+	Delegation models.CapabilityDelegation
+}
+
+// delegateCapabilityRes model
+//
+// swagger:response delegateCapabilityRes
+type delegateCapabilityRes struct { // nolint: unused,deadcode
+	// The delegated capability.
+	//
+	// in: body
+	Capability json.RawMessage
+}
+
+// revokeCapabilityReq model
+//
+// swagger:parameters revokeCapabilityReq
+type revokeCapabilityReq struct { // nolint: unused,deadcode
+	// in: path
+	// required: true
+	VaultID string `json:"vaultID"`
+	// in: path
+	// required: true
+	CapabilityID string `json:"capabilityID"`
+}
+
+// exportVaultReq model
+//
+// swagger:parameters exportVaultReq
+type exportVaultReq struct { // nolint: unused,deadcode
+	// in: path
+	// required: true
+	VaultID string `json:"vaultID"`
+	// The checkpoint of the last archive, to export an incremental archive since.
+	//
+	// in: query
+	Since string `json:"since"`
+}
+
+// exportVaultRes model
+//
+// swagger:response exportVaultRes
+type exportVaultRes struct { // nolint: unused,deadcode
+	// The vault archive, with one entry per line.
+	//
+	// in: body
+	Entries []models.VaultArchiveEntry
+}
+
+// exportAuditLogReq model
+//
+// swagger:parameters exportAuditLogReq
+type exportAuditLogReq struct { // nolint: unused,deadcode
+	// in: path
+	// required: true
+	VaultID string `json:"vaultID"`
+}
+
+// exportAuditLogRes model
+//
+// swagger:response exportAuditLogRes
+type exportAuditLogRes struct { // nolint: unused,deadcode
+	// The audit entries of the vault, oldest first, each chained to the ones before it by its hash, with one record
+	// per line. The last line has the server's signature over the hash of the last record.
+	//
+	// in: body
+	Records []audit.ExportRecord
+}
+
+// indexingStatusReq model
+//
+// swagger:parameters indexingStatusReq
+type indexingStatusReq struct { // nolint: unused,deadcode
+	// in: path
+	// required: true
+	VaultID string `json:"vaultID"`
+}
+
+// indexingStatusRes model
+//
+// swagger:response indexingStatusRes
+type indexingStatusRes struct { // nolint: unused,deadcode
+	// in: body
+	Status models.IndexingStatus
+}
+
+// importVaultReq model
+//
+// swagger:parameters importVaultReq
+type importVaultReq struct { // nolint: unused,deadcode
+	// A full vault archive followed by any incremental archives of it, with one entry per line.
+	//
+	// in: body
+	Entries []models.VaultArchiveEntry
+}
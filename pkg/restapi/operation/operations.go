@@ -7,20 +7,32 @@ SPDX-License-Identifier: Apache-2.0
 package operation
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/hyperledger/aries-framework-go/spi/storage"
-	"github.com/trustbloc/edge-core/pkg/log"
 
+	"github.com/trustbloc/edv/pkg/audit"
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/auth/zcapld"
 	"github.com/trustbloc/edv/pkg/edvprovider"
 	"github.com/trustbloc/edv/pkg/edvutils"
-	"github.com/trustbloc/edv/pkg/internal/common/support"
+	"github.com/trustbloc/edv/pkg/logging"
+	"github.com/trustbloc/edv/pkg/notification"
 	"github.com/trustbloc/edv/pkg/restapi/messages"
 	"github.com/trustbloc/edv/pkg/restapi/models"
 )
@@ -31,24 +43,53 @@ const (
 	edvCommonEndpointPathRoot = "/encrypted-data-vaults"
 	vaultIDPathVariable       = "vaultID"
 	docIDPathVariable         = "docID"
+	capabilityIDPathVariable  = "capabilityID"
+
+	eTagHeader    = "ETag"
+	ifMatchHeader = "If-Match"
+
+	// The maximum time in milliseconds that a query may spend fetching matching documents before it returns partial
+	// results. Overrides the configured latency budget.
+	latencyBudgetHeader = "EDV-Query-Latency-Budget"
+	// Set to "true" on responses to queries that returned partial results.
+	partialResultsHeader = "EDV-Query-Partial"
+	// Set on responses with partial results. Sending the same query with this header set to the received value
+	// returns the next part of the results.
+	continuationTokenHeader = "EDV-Query-Continuation-Token"
+	// Set on responses to queries that count the matching documents, to the number of matching documents.
+	queryCountHeader = "EDV-Query-Count"
+	// Identifies the tenant that a vault is created for on a multi-tenant EDV server. The value is the token that the
+	// tenant was issued when it was provisioned.
+	tenantTokenHeader = "EDV-Tenant-Token"
 
 	createVaultEndpoint = edvCommonEndpointPathRoot
+	deleteVaultEndpoint = edvCommonEndpointPathRoot + "/{" + vaultIDPathVariable + "}"
 	// TODO (#126): As of writing, the spec shows multiple, conflicting query endpoints.
 	// See: https://github.com/decentralized-identity/secure-data-store/issues/110.
 	// The endpoint listed below is the correct one (per the comment made by one of the spec contributors).
 	// This also matches the one used by Transmute's EDV implementation.
 	queryVaultEndpoint     = edvCommonEndpointPathRoot + "/{" + vaultIDPathVariable + "}/query"
 	createDocumentEndpoint = edvCommonEndpointPathRoot + "/{" + vaultIDPathVariable + "}/documents"
+	listDocumentsEndpoint  = createDocumentEndpoint
 	batchEndpoint          = edvCommonEndpointPathRoot + "/{" + vaultIDPathVariable + "}/batch"
+	batchCapacityEndpoint  = batchEndpoint + "/capacity"
 	readDocumentEndpoint   = edvCommonEndpointPathRoot + "/{" + vaultIDPathVariable + "}/documents/{" +
 		docIDPathVariable + "}"
 	updateDocumentEndpoint = edvCommonEndpointPathRoot + "/{" + vaultIDPathVariable + "}/documents/{" +
 		docIDPathVariable + "}"
 	deleteDocumentEndpoint = edvCommonEndpointPathRoot + "/{" + vaultIDPathVariable + "}/documents/{" +
 		docIDPathVariable + "}"
+	restoreDocumentEndpoint = readDocumentEndpoint + "/restore"
+
+	configurationEndpoint = edvCommonEndpointPathRoot + "/{" + vaultIDPathVariable + "}/configuration"
+
+	auditLogEndpoint = edvCommonEndpointPathRoot + "/{" + vaultIDPathVariable + "}/audit"
+
+	capabilitiesEndpoint = edvCommonEndpointPathRoot + "/{" + vaultIDPathVariable + "}/capabilities"
+	capabilityEndpoint   = capabilitiesEndpoint + "/{" + capabilityIDPathVariable + "}"
 )
 
-var logger = log.New(logModuleName)
+var logger = logging.New(logModuleName)
 
 // Operation defines handler logic for the EDV service.
 type Operation struct {
@@ -56,11 +97,43 @@ type Operation struct {
 	vaultCollection   VaultCollection
 	authEnable        bool
 	authService       authService
+	notifier          notifier
 	enabledExtensions *EnabledExtensions
+	batchLimits       BatchLimits
+	// queryLatencyBudget is the default latency budget for queries. Zero means there's no limit.
+	queryLatencyBudget time.Duration
+	// The number of batch operations currently being processed. Must only be accessed atomically.
+	currentBatches int32
+	auditor        auditor
+	auditExporter  auditExporter
+	// maxDocumentSize is the maximum size of a document in a create or update request. Zero means there's no limit.
+	maxDocumentSize uint64
+	logger          logging.Logger
+	// rejecters turn requests away before they reach the handlers. Batch capacity checks report what they would
+	// reject a batch for.
+	rejecters []rejecter
+	// allowPrivateWebhookAddresses is whether webhooks may be on loopback, private and link-local addresses.
+	allowPrivateWebhookAddresses bool
 }
 
 type authService interface {
 	Create(resourceID, verificationMethod string) ([]byte, error)
+	DeleteCapabilities(resourceID string) error
+	Delegate(resourceID string, delegation *zcapld.Delegation) ([]byte, error)
+	Revoke(resourceID, capabilityID, revokerID string) error
+	CheckControllerAuthority(resourceID, capabilityID string) error
+}
+
+type notifier interface {
+	Publish(event *models.VaultEvent)
+}
+
+// rejecter turns requests away before they reach the handlers when the server is saturated, like the bulkheads and
+// the rate limiter.
+type rejecter interface {
+	// Rejection returns the body of the response that another request like r would be rejected with right now, or
+	// an empty string if it would be let through.
+	Rejection(r *http.Request) string
 }
 
 // VaultCollection represents EDV storage.
@@ -80,6 +153,15 @@ type EnabledExtensions struct {
 	ReturnFullDocumentsOnQuery bool
 	ReadAllDocumentsEndpoint   bool
 	Batch                      bool
+	Notifications              bool
+}
+
+// BatchLimits defines the limits that are applied to incoming batch operations.
+// Any limit that is set to 0 is not enforced.
+type BatchLimits struct {
+	MaxOperations        uint
+	MaxBytes             uint64
+	MaxConcurrentBatches uint
 }
 
 // Config defines configuration for vcs operations
@@ -88,6 +170,31 @@ type Config struct {
 	AuthService       authService
 	AuthEnable        bool
 	EnabledExtensions *EnabledExtensions
+	BatchLimits       *BatchLimits
+	// Notifier is used to publish vault events to the webhooks in vault configurations if the Notifications extension
+	// is enabled.
+	Notifier notifier
+	// AllowPrivateWebhookAddresses allows webhooks on localhost and on loopback, private and link-local IP addresses.
+	// It should match whether the Notifier delivers events to them (see notification.WithPrivateAddresses).
+	AllowPrivateWebhookAddresses bool
+	// QueryLatencyBudget is the maximum time that a query may spend fetching matching documents before partial
+	// results are returned, unless the request sets a different one. Zero means there's no limit.
+	QueryLatencyBudget time.Duration
+	// Auditor records an audit entry for each operation on a vault. If it's nil, then operations aren't audited.
+	Auditor auditor
+	// MaxDocumentSize is the maximum size in bytes of an encrypted document in a request to create or update one, or
+	// in a batch upsert. Larger documents are rejected with a 413 status code. Zero means there's no limit.
+	MaxDocumentSize uint64
+	// AuditExporter exports the audit entries of vaults as signed, hash-chained JSON lines. If it's nil, then the audit
+	// log export endpoint isn't available.
+	AuditExporter auditExporter
+	// Logger is used instead of the edge-core logger for the restapi module. The lines logged while handling a
+	// request include its correlation ID (see logging.Middleware).
+	Logger logging.Logger
+	// Bulkheads and RateLimiter, if set, are the bulkheads and rate limiter that requests go through before they
+	// reach the handlers, so that batch capacity checks can report whether they'd turn a batch away.
+	Bulkheads   rejecter
+	RateLimiter rejecter
 }
 
 // New returns a new EDV operations instance.
@@ -96,6 +203,27 @@ func New(config *Config) *Operation {
 		vaultCollection: VaultCollection{
 			provider: config.Provider,
 		}, authEnable: config.AuthEnable, authService: config.AuthService, enabledExtensions: config.EnabledExtensions,
+		queryLatencyBudget: config.QueryLatencyBudget, auditor: config.Auditor, maxDocumentSize: config.MaxDocumentSize,
+		auditExporter: config.AuditExporter, logger: config.Logger,
+		allowPrivateWebhookAddresses: config.AllowPrivateWebhookAddresses,
+	}
+
+	if svc.logger == nil {
+		svc.logger = logger
+	}
+
+	if config.BatchLimits != nil {
+		svc.batchLimits = *config.BatchLimits
+	}
+
+	for _, r := range []rejecter{config.Bulkheads, config.RateLimiter} {
+		if r != nil {
+			svc.rejecters = append(svc.rejecters, r)
+		}
+	}
+
+	if config.EnabledExtensions != nil && config.EnabledExtensions.Notifications {
+		svc.notifier = config.Notifier
 	}
 
 	svc.registerHandler()
@@ -107,17 +235,60 @@ func New(config *Config) *Operation {
 func (c *Operation) registerHandler() {
 	// Add more protocol endpoints here to expose them as controller API endpoints
 	c.handlers = []Handler{
-		support.NewHTTPHandler(createVaultEndpoint, http.MethodPost, c.createDataVaultHandler),
-		support.NewHTTPHandler(queryVaultEndpoint, http.MethodPost, c.queryVaultHandler),
-		support.NewHTTPHandler(createDocumentEndpoint, http.MethodPost, c.createDocumentHandler),
-		support.NewHTTPHandler(readDocumentEndpoint, http.MethodGet, c.readDocumentHandler),
-		support.NewHTTPHandler(updateDocumentEndpoint, http.MethodPost, c.updateDocumentHandler),
-		support.NewHTTPHandler(deleteDocumentEndpoint, http.MethodDelete, c.deleteDocumentHandler),
+		c.auditedHandler(createVaultEndpoint, http.MethodPost, audit.CreateVaultOperation, c.createDataVaultHandler),
+		c.auditedHandler(queryVaultEndpoint, http.MethodPost, audit.QueryOperation, c.queryVaultHandler),
+		c.auditedHandler(createDocumentEndpoint, http.MethodPost, audit.CreateDocumentOperation,
+			c.createDocumentHandler),
+		c.auditedHandler(readDocumentEndpoint, http.MethodGet, audit.ReadDocumentOperation, c.readDocumentHandler),
+		c.auditedHandler(updateDocumentEndpoint, http.MethodPost, audit.UpdateDocumentOperation,
+			c.updateDocumentHandler),
+		c.auditedHandler(deleteDocumentEndpoint, http.MethodDelete, audit.DeleteDocumentOperation,
+			c.deleteDocumentHandler),
+		c.auditedHandler(deleteVaultEndpoint, http.MethodDelete, audit.DeleteVaultOperation, c.deleteDataVaultHandler),
+		c.auditedHandler(restoreDocumentEndpoint, http.MethodPost, audit.RestoreDocumentOperation,
+			c.restoreDocumentHandler),
+		c.auditedHandler(configurationEndpoint, http.MethodPatch, audit.UpdateConfigurationOperation,
+			c.updateConfigurationHandler),
+		c.auditedHandler(listDocumentsEndpoint, http.MethodGet, audit.ListDocumentsOperation, c.listDocumentsHandler),
+		c.auditedHandler(readDocumentEndpoint, http.MethodHead, audit.CheckDocumentOperation, c.checkDocumentHandler),
+		c.auditedHandler(exportVaultEndpoint, http.MethodGet, audit.ExportVaultOperation, c.exportVaultHandler),
+		c.auditedHandler(importVaultEndpoint, http.MethodPost, audit.ImportVaultOperation, c.importVaultHandler),
+		c.auditedHandler(queryVaultEndpoint, http.MethodHead, audit.CountQueryOperation, c.countQueryHandler),
+		c.auditedHandler(referenceIDEndpoint, http.MethodPost, audit.RotateReferenceIDOperation,
+			c.rotateReferenceIDHandler),
+		c.auditedHandler(indexingStatusEndpoint, http.MethodGet, audit.IndexingStatusOperation,
+			c.indexingStatusHandler),
+	}
+
+	if c.authEnable {
+		c.handlers = append(c.handlers,
+			c.auditedHandler(capabilitiesEndpoint, http.MethodPost, audit.DelegateCapabilityOperation,
+				c.delegateCapabilityHandler),
+			c.auditedHandler(capabilityEndpoint, http.MethodDelete, audit.RevokeCapabilityOperation,
+				c.revokeCapabilityHandler))
+	}
+
+	if c.notifier != nil {
+		c.handlers = append(c.handlers,
+			c.auditedHandler(subscriptionsEndpoint, http.MethodPost, audit.CreateSubscriptionOperation,
+				c.createSubscriptionHandler),
+			c.auditedHandler(subscriptionsEndpoint, http.MethodGet, audit.ReadSubscriptionsOperation,
+				c.readSubscriptionsHandler),
+			c.auditedHandler(subscriptionEndpoint, http.MethodDelete, audit.DeleteSubscriptionOperation,
+				c.deleteSubscriptionHandler))
+	}
+
+	if c.auditExporter != nil {
+		c.handlers = append(c.handlers,
+			c.auditedHandler(auditLogEndpoint, http.MethodGet, audit.ExportAuditLogOperation, c.exportAuditLogHandler))
 	}
+
 	if c.enabledExtensions != nil {
 		if c.enabledExtensions.Batch {
 			c.handlers = append(c.handlers,
-				support.NewHTTPHandler(batchEndpoint, http.MethodPost, c.batchHandler))
+				c.auditedHandler(batchEndpoint, http.MethodPost, audit.BatchOperation, c.batchHandler),
+				c.auditedHandler(batchCapacityEndpoint, http.MethodPost, audit.BatchCapacityOperation,
+					c.batchCapacityHandler))
 		}
 	}
 }
@@ -127,6 +298,11 @@ func (c *Operation) GetRESTHandlers() []Handler {
 	return c.handlers
 }
 
+// requestLogger returns the logger for the given request, which includes the request's correlation ID in each line.
+func (c *Operation) requestLogger(req *http.Request) logging.Logger {
+	return logging.FromContext(req.Context(), c.logger)
+}
+
 // Create Data Vault swagger:route POST /encrypted-data-vaults createVaultReq
 //
 // Creates a new data vault.
@@ -135,26 +311,40 @@ func (c *Operation) GetRESTHandlers() []Handler {
 //    default: genericError
 //        201: createVaultRes
 func (c *Operation) createDataVaultHandler(rw http.ResponseWriter, req *http.Request) {
+	logger := c.requestLogger(req)
+
 	requestBody, err := ioutil.ReadAll(req.Body)
 	if err != nil {
-		writeCreateDataVaultRequestReadFailure(rw, err)
+		writeCreateDataVaultRequestReadFailure(logger, rw, err)
 		return
 	}
 
+	// Webhooks can't be set when creating a vault, but their secret is still kept out of the logs if it's sent.
+	redactedBody := redactWebhookSecret(requestBody)
+
 	logger.Infof(`Received request to create a new data vault. X-User header: %s,Request body: %s`,
-		req.Header.Get("X-User"), string(requestBody))
+		req.Header.Get("X-User"), string(redactedBody))
 
 	var config models.DataVaultConfiguration
 
 	err = json.Unmarshal(requestBody, &config)
 	if err != nil {
-		writeCreateDataVaultInvalidRequest(rw, err, requestBody)
+		writeCreateDataVaultInvalidRequest(logger, rw, err, redactedBody)
 		return
 	}
 
+	// Vaults are created without a capability, so their controller is the one that creates them.
+	audit.SetActor(req.Context(), config.Controller)
+
 	err = validateDataVaultConfiguration(&config)
 	if err != nil {
-		writeCreateDataVaultInvalidRequest(rw, err, requestBody)
+		writeCreateDataVaultInvalidRequest(logger, rw, err, redactedBody)
+		return
+	}
+
+	tenantID, err := c.vaultTenant(req)
+	if err != nil {
+		writeCreateDataVaultFailure(logger, rw, err, redactedBody)
 		return
 	}
 
@@ -167,63 +357,91 @@ func (c *Operation) createDataVaultHandler(rw http.ResponseWriter, req *http.Req
 		if err != nil {
 			logger.Debugf(messages.DebugLogEventWithReceivedData,
 				fmt.Sprintf(messages.MarshalVaultConfigForLogFailure, err),
-				requestBody)
+				redactedBody)
 		}
+
+		configBytesForLog = redactWebhookSecret(configBytesForLog)
+	}
+
+	c.createDataVault(logger, rw, &config, req.Host, tenantID, configBytesForLog)
+}
+
+// vaultTenant returns the ID of the tenant that the request creates a vault for, which is identified by the
+// request's tenant token in multi-tenant mode. Otherwise, vaults aren't created for a tenant.
+func (c *Operation) vaultTenant(req *http.Request) (string, error) {
+	if !c.vaultCollection.provider.MultiTenancyEnabled() {
+		return "", nil
+	}
+
+	tenant, err := c.vaultCollection.provider.TenantForToken(req.Header.Get(tenantTokenHeader))
+	if err != nil {
+		return "", fmt.Errorf(messages.InvalidTenantToken, tenantTokenHeader, err)
 	}
 
-	c.createDataVault(rw, &config, req.Host, configBytesForLog)
+	return tenant.ID, nil
 }
 
-func (c *Operation) createDataVault(rw http.ResponseWriter, config *models.DataVaultConfiguration, hostURL string,
-	configBytesForLog []byte) {
+func (c *Operation) createDataVault(logger logging.Logger, rw http.ResponseWriter,
+	config *models.DataVaultConfiguration, hostURL, tenantID string, configBytesForLog []byte) {
 	vaultID, err := edvutils.GenerateEDVCompatibleID()
 	if err != nil {
-		writeCreateDataVaultFailure(rw, err, configBytesForLog)
+		writeCreateDataVaultFailure(logger, rw, err, configBytesForLog)
 		return
 	}
 
-	err = c.vaultCollection.storeDataVaultConfiguration(config, vaultID)
+	payload, err := c.newDataVault(vaultID, config, tenantID)
 	if err != nil {
-		writeCreateDataVaultFailure(rw, fmt.Errorf(messages.StoreVaultConfigFailure, err), configBytesForLog)
+		writeCreateDataVaultFailure(logger, rw, err, configBytesForLog)
 		return
 	}
 
-	err = c.vaultCollection.createDataVault(vaultID)
+	writeCreateDataVaultSuccess(logger, rw, vaultID, hostURL, configBytesForLog, payload)
+}
+
+// newDataVault creates a vault with the given ID and configuration. If auth is enabled, then the capability for the
+// vault is returned.
+func (c *Operation) newDataVault(vaultID string, config *models.DataVaultConfiguration,
+	tenantID string) ([]byte, error) {
+	err := c.vaultCollection.storeDataVaultConfiguration(config, vaultID, tenantID)
 	if err != nil {
-		writeCreateDataVaultFailure(rw, err, configBytesForLog)
-		return
+		return nil, fmt.Errorf(messages.StoreVaultConfigFailure, err)
 	}
 
-	// Add auth payload if enabled
-	var payload []byte
+	err = c.vaultCollection.createDataVault(vaultID)
+	if err != nil {
+		return nil, err
+	}
 
-	if c.authEnable {
-		payload, err = c.authService.Create(vaultID, config.Controller)
-		if err != nil {
-			writeCreateDataVaultFailure(rw, err, configBytesForLog)
-			return
-		}
+	if !c.authEnable {
+		return nil, nil
 	}
 
-	writeCreateDataVaultSuccess(rw, vaultID, hostURL, configBytesForLog, payload)
+	return c.authService.Create(vaultID, config.Controller)
 }
 
-// Query Vault swagger:route POST /encrypted-data-vaults/{vaultID}/queries queryVaultReq
+// Query Vault swagger:route POST /encrypted-data-vaults/{vaultID}/query queryVaultReq
 //
 // Queries a data vault using encrypted indices.
+// Matching documents are returned in the order of their IDs, without duplicates. If fetching them takes longer than
+// the latency budget, then the matches found so far are returned with the EDV-Query-Partial header set to "true",
+// along with an EDV-Query-Continuation-Token header to send with the same query to get the rest of them.
+// If the query has count set, then only the number of matching documents is returned, in the body and in the
+// EDV-Query-Count header. Counts aren't limited by the latency budget and can't be continued.
 //
 // Responses:
 //    default: genericError
 //        200: queryVaultRes
 func (c *Operation) queryVaultHandler(rw http.ResponseWriter, req *http.Request) {
-	vaultID, success := unescapePathVar(vaultIDPathVariable, mux.Vars(req), rw)
+	logger := c.requestLogger(req)
+
+	vaultID, success := unescapePathVar(logger, vaultIDPathVariable, mux.Vars(req), rw)
 	if !success {
 		return
 	}
 
 	requestBody, err := ioutil.ReadAll(req.Body)
 	if err != nil {
-		writeErrorWithVaultIDAndReceivedData(rw, http.StatusInternalServerError, messages.QueryFailReadRequestBody,
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusInternalServerError, messages.QueryFailReadRequestBody,
 			err, vaultID, nil)
 		return
 	}
@@ -233,7 +451,14 @@ func (c *Operation) queryVaultHandler(rw http.ResponseWriter, req *http.Request)
 
 	incomingQuery, err := parseQuery(requestBody)
 	if err != nil {
-		writeErrorWithVaultIDAndReceivedData(rw, http.StatusBadRequest, messages.InvalidQuery, err, vaultID, requestBody)
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusBadRequest, messages.InvalidQuery, err, vaultID,
+			requestBody)
+		return
+	}
+
+	if err = checkQueryRestrictions(auth.RestrictionsFrom(req.Context()), &incomingQuery); err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusForbidden, messages.OperationRestricted, err, vaultID,
+			requestBody)
 		return
 	}
 
@@ -250,451 +475,1553 @@ func (c *Operation) queryVaultHandler(rw http.ResponseWriter, req *http.Request)
 		}
 	}
 
-	matchingDocuments, err := c.vaultCollection.queryVault(vaultID, &incomingQuery)
+	if incomingQuery.Count {
+		count, errCount := c.vaultCollection.countQuery(req.Context(), vaultID, &incomingQuery)
+		if errCount != nil {
+			writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusBadRequest, messages.QueryFailure, errCount, vaultID,
+				queryBytesForLog)
+			return
+		}
+
+		writeQueryCountResponse(logger, rw, count, vaultID, queryBytesForLog)
+
+		return
+	}
+
+	deadline, err := c.queryDeadline(req)
+	if err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusBadRequest, messages.InvalidLatencyBudgetHeader, err,
+			vaultID, requestBody)
+		return
+	}
+
+	after, err := parseContinuationToken(req.Header.Get(continuationTokenHeader), vaultID, &incomingQuery)
 	if err != nil {
-		writeErrorWithVaultIDAndReceivedData(rw, http.StatusBadRequest, messages.QueryFailure, err, vaultID, queryBytesForLog)
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusBadRequest, messages.InvalidContinuationToken, err,
+			vaultID, requestBody)
+		return
+	}
+
+	page, err := c.vaultCollection.queryVault(req.Context(), vaultID, &incomingQuery, after, deadline)
+	if err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusBadRequest, messages.QueryFailure, err, vaultID,
+			queryBytesForLog)
 		return
 	}
 
+	matchingDocuments := page.Documents
+
+	if page.Partial {
+		logger.Infof(messages.QueryPartialResults, vaultID, page.ContinueAfter)
+
+		rw.Header().Set(partialResultsHeader, "true")
+		rw.Header().Set(continuationTokenHeader, createContinuationToken(vaultID, &incomingQuery,
+			page.ContinueAfter))
+	}
+
 	if c.enabledExtensions != nil && c.enabledExtensions.ReturnFullDocumentsOnQuery {
-		writeQueryResponse(rw, matchingDocuments, vaultID, queryBytesForLog, incomingQuery.ReturnFullDocuments, req.Host)
+		writeQueryResponse(logger, rw, matchingDocuments, vaultID, queryBytesForLog, incomingQuery.ReturnFullDocuments,
+			req.Host)
 	} else {
-		writeQueryResponse(rw, matchingDocuments, vaultID, queryBytesForLog, false, req.Host)
+		writeQueryResponse(logger, rw, matchingDocuments, vaultID, queryBytesForLog, false, req.Host)
 	}
 }
 
-// Create Document swagger:route POST /encrypted-data-vaults/{vaultID}/documents createDocumentReq
+// Count Query swagger:route HEAD /encrypted-data-vaults/{vaultID}/query countQueryReq
 //
-// Stores an encrypted document.
+// Counts the documents in a data vault that match a query, without returning them. The query is given in the query
+// string instead of the body, and the number of matching documents is returned in the EDV-Query-Count header. The
+// operand of an "index + operator" query is given as JSON in the operand parameter.
 //
 // Responses:
 //    default: genericError
-//        201: createDocumentRes
-func (c *Operation) createDocumentHandler(rw http.ResponseWriter, req *http.Request) {
-	vaultID, success := unescapePathVar(vaultIDPathVariable, mux.Vars(req), rw)
+//        200: countQueryRes
+func (c *Operation) countQueryHandler(rw http.ResponseWriter, req *http.Request) {
+	logger := c.requestLogger(req)
+
+	vaultID, success := unescapePathVar(logger, vaultIDPathVariable, mux.Vars(req), rw)
 	if !success {
 		return
 	}
 
-	requestBody, err := ioutil.ReadAll(req.Body)
+	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.QueryReceiveRequest, vaultID))
+
+	values := req.URL.Query()
+
+	query := models.Query{
+		Name:      values.Get("index"),
+		Value:     values.Get("equals"),
+		Has:       values.Get("has"),
+		Operator:  values.Get("operator"),
+		HMACKeyID: values.Get("hmacKeyId"),
+		Count:     true,
+	}
+
+	if operand := values.Get("operand"); operand != "" {
+		query.Operand = json.RawMessage(operand)
+	}
+
+	err := validateQuery(&query)
 	if err != nil {
-		writeErrorWithVaultIDAndReceivedData(rw, http.StatusInternalServerError,
-			messages.CreateDocumentFailReadRequestBody, err, vaultID, nil)
+		logger.Infof(messages.InvalidQuery, vaultID, err)
+		rw.WriteHeader(http.StatusBadRequest)
+
 		return
 	}
 
-	logger.Debugf(messages.DebugLogEventWithReceivedData,
-		fmt.Sprintf(messages.CreateDocumentReceiveRequest, vaultID),
-		requestBody)
+	err = checkQueryRestrictions(auth.RestrictionsFrom(req.Context()), &query)
+	if err != nil {
+		logger.Infof(messages.OperationRestricted, vaultID, err)
+		rw.WriteHeader(http.StatusForbidden)
 
-	c.createDocument(rw, requestBody, req.Host, vaultID)
+		return
+	}
+
+	count, err := c.vaultCollection.countQuery(req.Context(), vaultID, &query)
+	if err != nil {
+		writeCountQueryFailure(logger, rw, err, vaultID)
+		return
+	}
+
+	logger.Debugf(messages.CountQuerySuccess, count, vaultID)
+
+	rw.Header().Set(queryCountHeader, strconv.Itoa(count))
+}
+
+// Create Document swagger:route POST /encrypted-data-vaults/{vaultID}/documents createDocumentReq
+//
+// Stores an encrypted document.
+// The document is rejected with a 409 status code if it has an encrypted index name+value pair that another document
+// declares as unique, or declares a pair as unique that another document has.
+//
+// Responses:
+//    default: genericError
+//        201: createDocumentRes
+//        409: emptyRes
+func (c *Operation) createDocumentHandler(rw http.ResponseWriter, req *http.Request) {
+	logger := c.requestLogger(req)
+
+	vaultID, success := unescapePathVar(logger, vaultIDPathVariable, mux.Vars(req), rw)
+	if !success {
+		return
+	}
+
+	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.CreateDocumentReceiveRequest, vaultID))
+
+	c.createDocument(req.Context(), logger, rw, limitDocumentSize(req.Body, c.maxDocumentSize), req.Host, vaultID)
 }
 
 // Read Document swagger:route GET /encrypted-data-vaults/{vaultID}/documents/{docID} readDocumentReq
 //
 // Retrieves an encrypted document.
+// If the document was deleted but the server still keeps its tombstone, then the tombstone is returned with a 410
+// status code.
+// If revision history is enabled, then a past revision of the document can be read instead, either by its sequence
+// with the version query parameter or as it was at a given time with the asOf query parameter.
 //
 // Responses:
 //    default: genericError
 //        201: readDocumentRes
+//        410: deletedDocumentRes
 func (c *Operation) readDocumentHandler(rw http.ResponseWriter, req *http.Request) {
-	vaultID, success := unescapePathVar(vaultIDPathVariable, mux.Vars(req), rw)
+	logger := c.requestLogger(req)
+
+	vaultID, success := unescapePathVar(logger, vaultIDPathVariable, mux.Vars(req), rw)
 	if !success {
 		return
 	}
 
-	docID, success := unescapePathVar(docIDPathVariable, mux.Vars(req), rw)
+	docID, success := unescapePathVar(logger, docIDPathVariable, mux.Vars(req), rw)
 	if !success {
 		return
 	}
 
 	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.ReadDocumentReceiveRequest, docID, vaultID))
 
-	documentBytes, err := c.vaultCollection.readDocument(vaultID, docID)
+	revision, err := parseReadDocumentParameters(req.URL.Query())
+	if err != nil {
+		writeErrorWithVaultIDAndDocID(logger, rw, http.StatusBadRequest, messages.InvalidReadDocumentParameter, err,
+			docID, vaultID)
+		return
+	}
+
+	if revision != nil {
+		revisionBytes, errRevision := c.vaultCollection.readDocumentRevision(req.Context(), vaultID, docID, revision)
+		if errRevision != nil {
+			writeReadDocumentFailure(logger, rw, errRevision, docID, vaultID)
+			return
+		}
+
+		writeReadDocumentSuccess(logger, rw, bytes.NewReader(revisionBytes), docID, vaultID)
+
+		return
+	}
+
+	document, sequence, err := c.vaultCollection.readDocument(req.Context(), logger, vaultID, docID)
+	if errors.Is(err, messages.ErrDocumentNotFound) {
+		tombstone, errTombstone := c.vaultCollection.readTombstone(req.Context(), vaultID, docID)
+		if errTombstone == nil {
+			writeReadDeletedDocument(logger, rw, tombstone, docID, vaultID)
+			return
+		}
+
+		if !errors.Is(errTombstone, messages.ErrDocumentNotFound) {
+			logger.Warnf("Failed to get tombstone for document %s in vault %s: %s", docID, vaultID, errTombstone)
+		}
+	}
+
 	if err != nil {
-		writeReadDocumentFailure(rw, err, docID, vaultID)
+		writeReadDocumentFailure(logger, rw, err, docID, vaultID)
 		return
 	}
 
-	writeReadDocumentSuccess(rw, documentBytes, docID, vaultID)
+	defer func() {
+		if errClose := document.Close(); errClose != nil {
+			logger.Warnf("Failed to close document %s in vault %s: %s", docID, vaultID, errClose)
+		}
+	}()
+
+	if sequence != nil {
+		rw.Header().Set(eTagHeader, documentETag(*sequence))
+	}
+
+	writeReadDocumentSuccess(logger, rw, document, docID, vaultID)
 }
 
-// Update Document swagger:route POST /encrypted-data-vaults/{vaultID}/documents/{docID} updateDocumentReq
+// Check Document swagger:route HEAD /encrypted-data-vaults/{vaultID}/documents/{docID} checkDocumentReq
 //
-// Update an encrypted document.
+// Checks whether an encrypted document exists, without reading it.
+// If the document was deleted but the server still keeps its tombstone, then the response has a 410 status code.
 //
 // Responses:
-//		default: genericError
-// 			200: emptyRes
-func (c *Operation) updateDocumentHandler(rw http.ResponseWriter, req *http.Request) {
-	vaultID, success := unescapePathVar(vaultIDPathVariable, mux.Vars(req), rw)
+//    default: genericError
+//        200: emptyRes
+//        410: emptyRes
+func (c *Operation) checkDocumentHandler(rw http.ResponseWriter, req *http.Request) {
+	logger := c.requestLogger(req)
+
+	vaultID, success := unescapePathVar(logger, vaultIDPathVariable, mux.Vars(req), rw)
 	if !success {
 		return
 	}
 
-	docID, success := unescapePathVar(docIDPathVariable, mux.Vars(req), rw)
+	docID, success := unescapePathVar(logger, docIDPathVariable, mux.Vars(req), rw)
 	if !success {
 		return
 	}
 
-	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.UpdateDocumentReceiveRequest, docID, vaultID))
+	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.CheckDocumentReceiveRequest, docID, vaultID))
 
-	requestBody, err := ioutil.ReadAll(req.Body)
+	exists, err := c.vaultCollection.documentExists(req.Context(), vaultID, docID)
 	if err != nil {
-		writeErrorWithVaultIDAndDocID(rw, http.StatusInternalServerError,
-			messages.UpdateDocumentFailReadRequestBody, err, docID, vaultID)
+		writeCheckDocumentFailure(logger, rw, err, docID, vaultID)
+		return
+	}
+
+	if exists {
+		return
+	}
+
+	_, err = c.vaultCollection.readTombstone(req.Context(), vaultID, docID)
+	if err == nil {
+		rw.WriteHeader(http.StatusGone)
 		return
 	}
 
-	c.updateDocument(rw, requestBody, docID, vaultID)
+	if !errors.Is(err, messages.ErrDocumentNotFound) {
+		logger.Warnf("Failed to get tombstone for document %s in vault %s: %s", docID, vaultID, err)
+	}
+
+	rw.WriteHeader(http.StatusNotFound)
 }
 
-// Delete Document swagger:route DELETE /encrypted-data-vaults/{vaultID}/documents/{docID} deleteDocumentReq
+// List Documents swagger:route GET /encrypted-data-vaults/{vaultID}/documents listDocumentsReq
 //
-// Delete an encrypted document.
+// Lists the IDs and sequences of the documents in a data vault, sorted by sequence and then by ID, without
+// the documents themselves. If afterSequence is given, then only the documents after that sequence are listed,
+// or after that sequence and afterId if afterId is given too. At most limit documents are listed if limit is given.
 //
 // Responses:
-//		default: genericError
-// 			200: emptyRes
-//			400: emptyRes
-// 			404: emptyRes
-func (c *Operation) deleteDocumentHandler(rw http.ResponseWriter, req *http.Request) {
-	vaultID, success := unescapePathVar(vaultIDPathVariable, mux.Vars(req), rw)
+//    default: genericError
+//        200: listDocumentsRes
+func (c *Operation) listDocumentsHandler(rw http.ResponseWriter, req *http.Request) {
+	logger := c.requestLogger(req)
+
+	vaultID, success := unescapePathVar(logger, vaultIDPathVariable, mux.Vars(req), rw)
 	if !success {
 		return
 	}
 
-	docID, success := unescapePathVar(docIDPathVariable, mux.Vars(req), rw)
-	if !success {
+	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.ListDocumentsReceiveRequest, vaultID))
+
+	afterSequence, afterID, limit, err := parseListDocumentsParameters(req.URL.Query())
+	if err != nil {
+		writeErrorWithVaultID(logger, rw, http.StatusBadRequest, messages.InvalidListDocumentsParameter, err, vaultID)
 		return
 	}
 
-	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.DeleteDocumentReceiveRequest, docID, vaultID))
-
-	err := c.vaultCollection.deleteDocument(docID, vaultID)
+	list, err := c.vaultCollection.listDocuments(req.Context(), vaultID, afterSequence, afterID, limit)
 	if err != nil {
-		writeDeleteDocumentFailure(rw, err, docID, vaultID)
+		writeListDocumentsFailure(logger, rw, err, vaultID)
+		return
 	}
+
+	writeListDocumentsSuccess(logger, rw, list, vaultID)
 }
 
-// Response body will be an array of responses, one for each vault operation. Response for a successful upsert
-// will be the document location. No distinction is made between document creation and document updates.
-// TODO (#171): Address the limitations of this endpoint. Specifically...
-//  1. Updated documents must have the same encrypted indices (names+values) as the documents they're replacing,
-//  2. For new documents, encrypted indices will be created, but no uniqueness validation will occur.
-//     (No errors will be thrown if either of these limitations are not respected.
-//     The underlying database will just get in a bad state if you ignore them.)
-//  3. Delete operations are slow because they don't batch with other operations. They force any queued operations
-//     to execute early. Delete operations don't batch with other operations (including other deletes).
-func (c *Operation) batchHandler(rw http.ResponseWriter, req *http.Request) {
-	vaultID, success := unescapePathVar(vaultIDPathVariable, mux.Vars(req), rw)
+// Update Document swagger:route POST /encrypted-data-vaults/{vaultID}/documents/{docID} updateDocumentReq
+//
+// Update an encrypted document.
+// The new document's sequence must be one greater than the sequence of the stored document. If an If-Match header
+// is given, the new sequence must also be one greater than the sequence in the ETag. Like on creation, the document
+// is also rejected with a 409 status code if its unique encrypted indices conflict with another document's.
+//
+// Responses:
+//		default: genericError
+// 			200: emptyRes
+// 			409: emptyRes
+func (c *Operation) updateDocumentHandler(rw http.ResponseWriter, req *http.Request) {
+	logger := c.requestLogger(req)
+
+	vaultID, success := unescapePathVar(logger, vaultIDPathVariable, mux.Vars(req), rw)
 	if !success {
 		return
 	}
 
-	requestBody, err := ioutil.ReadAll(req.Body)
+	docID, success := unescapePathVar(logger, docIDPathVariable, mux.Vars(req), rw)
+	if !success {
+		return
+	}
+
+	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.UpdateDocumentReceiveRequest, docID, vaultID))
+
+	ifMatchSequence, err := parseIfMatchHeader(req)
 	if err != nil {
-		writeErrorWithVaultIDAndReceivedData(rw, http.StatusInternalServerError, messages.BatchFailReadRequestBody,
-			err, vaultID, nil)
+		writeErrorWithVaultIDAndDocID(logger, rw, http.StatusBadRequest, messages.InvalidIfMatchHeader, err, docID, vaultID)
 		return
 	}
 
-	logger.Debugf(messages.DebugLogEventWithReceivedData, fmt.Sprintf(messages.BatchReceiveRequest,
-		vaultID), requestBody)
+	c.updateDocument(req.Context(), logger, rw, limitDocumentSize(req.Body, c.maxDocumentSize), docID, vaultID,
+		ifMatchSequence)
+}
 
-	var incomingBatch models.Batch
+// Delete Data Vault swagger:route DELETE /encrypted-data-vaults/{vaultID} deleteVaultReq
+//
+// Deletes a data vault, along with all of its documents, its configuration and its capabilities. If auth is enabled,
+// then the request must invoke the vault's root capability or the capability of the vault's controller delegated
+// from it.
+//
+// Responses:
+//		default: genericError
+// 			200: emptyRes
+// 			404: emptyRes
+func (c *Operation) deleteDataVaultHandler(rw http.ResponseWriter, req *http.Request) {
+	logger := c.requestLogger(req)
 
-	err = json.Unmarshal(requestBody, &incomingBatch)
-	if err != nil {
-		writeErrorWithVaultIDAndReceivedData(rw, http.StatusBadRequest, messages.InvalidBatch, err, vaultID, requestBody)
+	vaultID, success := unescapePathVar(logger, vaultIDPathVariable, mux.Vars(req), rw)
+	if !success {
 		return
 	}
 
-	responses := createInitialResponses(len(incomingBatch))
+	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.DeleteVaultReceiveRequest, vaultID))
 
-	// Validate everything at the start, so we can fail fast if need be
-	err = validateBatch(incomingBatch, responses)
+	err := c.checkVaultDeletionAuthority(vaultID, req)
 	if err != nil {
-		writeBatchResponse(rw, messages.BatchResponseFailure, vaultID, requestBody, responses)
+		writeDeleteVaultFailure(logger, rw, err, vaultID)
 		return
 	}
 
-	c.executeBatchedOperations(rw, req.Host, vaultID, incomingBatch, responses, requestBody)
-}
+	err = c.vaultCollection.deleteDataVault(vaultID)
+	if err != nil {
+		writeDeleteVaultFailure(logger, rw, err, vaultID)
+		return
+	}
 
-func (c *Operation) executeBatchedOperations(rw http.ResponseWriter, host, vaultID string,
-	vaultOperations models.Batch, responses []string, requestBody []byte) {
-	// To improve performance, we gather as many document upsert operations as we can before we hit a
-	// delete operation so that we can insert them into the underlying database in one big bulk operation.
-	var currentUpsertDocumentsBatch []models.EncryptedDocument
+	c.cleanUpDeletedVault(logger, vaultID)
 
-	var numOperationsCompleted int
+	logger.Infof(messages.DeleteVaultSuccess, vaultID)
+}
 
-	for vaultOperationIndex, vaultOperation := range vaultOperations {
-		switch {
-		case strings.EqualFold(vaultOperation.Operation, models.UpsertDocumentVaultOperation):
-			currentUpsertDocumentsBatch = append(currentUpsertDocumentsBatch, vaultOperation.EncryptedDocument)
-		case strings.EqualFold(vaultOperation.Operation, models.DeleteDocumentVaultOperation):
-			if len(currentUpsertDocumentsBatch) > 0 {
-				err := c.vaultCollection.upsertDocuments(vaultID, currentUpsertDocumentsBatch)
-				if err != nil {
-					for i := 0; i < len(currentUpsertDocumentsBatch); i++ {
-						responses[i+numOperationsCompleted] = err.Error()
-					}
+// checkVaultDeletionAuthority returns an error unless the request has the authority of the vault's controller, if
+// auth is enabled. Capabilities delegated further, and bearer tokens, only grant the write action, which isn't enough
+// to delete the whole vault.
+func (c *Operation) checkVaultDeletionAuthority(vaultID string, req *http.Request) error {
+	return c.checkControllerAuthority(vaultID, req, "a vault can only be deleted")
+}
 
-					writeBatchResponse(rw, messages.BatchResponseFailure, vaultID, requestBody, responses)
+// checkControllerAuthority returns an error unless the request invokes a capability with the authority of the
+// vault's controller, if auth is enabled. restriction describes what needs that authority in the error.
+func (c *Operation) checkControllerAuthority(vaultID string, req *http.Request, restriction string) error {
+	if !c.authEnable {
+		return nil
+	}
 
-					return
-				}
+	invokedCapability, err := zcapld.InvokedCapability(req)
+	if err != nil {
+		return err
+	}
 
-				for i := 0; i < len(currentUpsertDocumentsBatch); i++ {
-					responses[i+numOperationsCompleted] =
-						getFullDocumentURL(currentUpsertDocumentsBatch[i].ID, vaultID, host)
-				}
+	if invokedCapability == nil || auth.BearerToken(req) != "" {
+		return fmt.Errorf("%w: %s by invoking a capability of its controller", zcapld.ErrActionNotAllowed,
+			restriction)
+	}
 
-				numOperationsCompleted += len(currentUpsertDocumentsBatch)
+	return c.authService.CheckControllerAuthority(vaultID, invokedCapability.ID)
+}
 
-				currentUpsertDocumentsBatch = nil // Finished with these documents, start a new batch
-			}
+// cleanUpDeletedVault deletes the capabilities of a deleted vault. The vault itself is already gone at this point,
+// so failures don't fail the request. The capabilities are left as orphaned root capabilities, which are deleted by
+// the EDV server's periodic cleanup or through the admin endpoints. The vault's webhooks were in its configuration,
+// so they're already gone too.
+func (c *Operation) cleanUpDeletedVault(logger logging.Logger, vaultID string) {
+	if c.authEnable {
+		err := c.authService.DeleteCapabilities(vaultID)
+		if err != nil {
+			logger.Errorf(messages.DeleteVaultCapabilitiesFailure, vaultID, err)
+		}
+	}
+}
 
-			err := c.vaultCollection.deleteDocument(vaultOperation.DocumentID, vaultID)
-			if err == nil {
-				responses[vaultOperationIndex] = ""
-			} else {
-				responses[vaultOperationIndex] = err.Error()
-				if !errors.Is(err, messages.ErrDocumentNotFound) {
-					writeBatchResponse(rw, messages.BatchResponseFailure, vaultID, requestBody, responses)
+// Delete Document swagger:route DELETE /encrypted-data-vaults/{vaultID}/documents/{docID} deleteDocumentReq
+//
+// Delete an encrypted document.
+// If an If-Match header is given, the document is only deleted if its current sequence matches the ETag.
+//
+// Responses:
+//		default: genericError
+// 			200: emptyRes
+//			400: emptyRes
+// 			404: emptyRes
+// 			409: emptyRes
+func (c *Operation) deleteDocumentHandler(rw http.ResponseWriter, req *http.Request) {
+	logger := c.requestLogger(req)
 
-					return
-				}
-			}
+	vaultID, success := unescapePathVar(logger, vaultIDPathVariable, mux.Vars(req), rw)
+	if !success {
+		return
+	}
 
-			numOperationsCompleted++
-		default: // Validation check should ensure that this can't happen.
-			err := fmt.Errorf("%s is not a valid vault operation", vaultOperation.Operation)
-			responses[vaultOperationIndex] = err.Error()
-			writeBatchResponse(rw, messages.BatchResponseFailure, vaultID, requestBody, responses)
+	docID, success := unescapePathVar(logger, docIDPathVariable, mux.Vars(req), rw)
+	if !success {
+		return
+	}
 
-			return
+	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.DeleteDocumentReceiveRequest, docID, vaultID))
+
+	ifMatchSequence, err := parseIfMatchHeader(req)
+	if err != nil {
+		writeErrorWithVaultIDAndDocID(logger, rw, http.StatusBadRequest, messages.InvalidIfMatchHeader, err, docID, vaultID)
+		return
+	}
+
+	deletedSequence, err := c.vaultCollection.deleteDocument(req.Context(), logger, docID, vaultID, ifMatchSequence)
+	if err != nil {
+		writeDeleteDocumentFailure(logger, rw, err, docID, vaultID)
+		return
+	}
+
+	c.publishEvent(vaultID, docID, deletedSequence, models.DocumentDeletedVaultEvent)
+}
+
+// Restore Document swagger:route POST /encrypted-data-vaults/{vaultID}/documents/{docID}/restore restoreDocumentReq
+//
+// Restores a deleted document from its tombstone. This is only possible if the server keeps tombstones for deleted
+// documents, and only until the tombstone retention window has passed.
+//
+// Responses:
+//		default: genericError
+// 			200: emptyRes
+// 			404: emptyRes
+// 			409: emptyRes
+func (c *Operation) restoreDocumentHandler(rw http.ResponseWriter, req *http.Request) {
+	logger := c.requestLogger(req)
+
+	vaultID, success := unescapePathVar(logger, vaultIDPathVariable, mux.Vars(req), rw)
+	if !success {
+		return
+	}
+
+	docID, success := unescapePathVar(logger, docIDPathVariable, mux.Vars(req), rw)
+	if !success {
+		return
+	}
+
+	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.RestoreDocumentReceiveRequest, docID, vaultID))
+
+	restoredSequence, err := c.vaultCollection.restoreDocument(req.Context(), vaultID, docID)
+	if err != nil {
+		writeRestoreDocumentFailure(logger, rw, err, docID, vaultID)
+		return
+	}
+
+	rw.Header().Set(eTagHeader, documentETag(restoredSequence))
+
+	logger.Infof(messages.RestoreDocumentSuccess, docID, vaultID)
+
+	c.publishEvent(vaultID, docID, restoredSequence, models.DocumentRestoredVaultEvent)
+}
+
+// Batch swagger:route POST /encrypted-data-vaults/{vaultID}/batch batchReq
+//
+// Performs a batch of upserts and deletes on the documents of a data vault. Requires the Batch extension.
+//
+// Responses:
+//    default: genericError
+//        200: batchRes
+//
+// Response body will be an array of responses, one for each vault operation. Response for a successful upsert
+// will be the document location. No distinction is made between document creation and document updates.
+// TODO (#171): Address the limitations of this endpoint. Specifically...
+//  1. Updated documents must have the same encrypted indices (names+values) as the documents they're replacing,
+//  2. For new documents, encrypted indices will be created, but no uniqueness validation will occur.
+//     (No errors will be thrown if either of these limitations are not respected.
+//     The underlying database will just get in a bad state if you ignore them.)
+//  3. Delete operations are slow because they don't batch with other operations. They force any queued operations
+//     to execute early. Delete operations don't batch with other operations (including other deletes).
+func (c *Operation) batchHandler(rw http.ResponseWriter, req *http.Request) {
+	logger := c.requestLogger(req)
+
+	vaultID, success := unescapePathVar(logger, vaultIDPathVariable, mux.Vars(req), rw)
+	if !success {
+		return
+	}
+
+	if !c.acquireBatchSlot() {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusServiceUnavailable, messages.BatchRejected,
+			fmt.Errorf(messages.ServerAtBatchCapacity, c.batchLimits.MaxConcurrentBatches), vaultID, nil)
+		return
+	}
+
+	defer c.releaseBatchSlot()
+
+	requestBody, tooLarge, err := c.readBatchRequestBody(req)
+	if err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusInternalServerError, messages.BatchFailReadRequestBody,
+			err, vaultID, nil)
+		return
+	}
+
+	if tooLarge {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusRequestEntityTooLarge, messages.BatchRejected,
+			fmt.Errorf(messages.BatchTooLargeUnknownSize, c.batchLimits.MaxBytes), vaultID, nil)
+		return
+	}
+
+	logger.Debugf(messages.DebugLogEventWithReceivedData, fmt.Sprintf(messages.BatchReceiveRequest,
+		vaultID), requestBody)
+
+	var incomingBatch models.Batch
+
+	err = json.Unmarshal(requestBody, &incomingBatch)
+	if err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusBadRequest, messages.InvalidBatch, err, vaultID,
+			requestBody)
+		return
+	}
+
+	if c.batchLimits.MaxOperations > 0 && uint(len(incomingBatch)) > c.batchLimits.MaxOperations {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusRequestEntityTooLarge, messages.BatchRejected,
+			fmt.Errorf(messages.BatchTooManyOperations, len(incomingBatch), c.batchLimits.MaxOperations),
+			vaultID, requestBody)
+		return
+	}
+
+	err = c.checkBatchDocumentSizes(incomingBatch)
+	if err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusRequestEntityTooLarge, messages.BatchRejected, err,
+			vaultID, requestBody)
+		return
+	}
+
+	responses := createInitialResponses(len(incomingBatch))
+
+	// Validate everything at the start, so we can fail fast if need be
+	err = c.validateBatch(incomingBatch, responses)
+	if err != nil {
+		writeBatchResponse(logger, rw, messages.BatchResponseFailure, vaultID, requestBody, responses)
+		return
+	}
+
+	c.executeBatchedOperations(req.Context(), logger, rw, req.Host, vaultID, incomingBatch, responses, requestBody)
+}
+
+// Batch Capacity Check swagger:route POST /encrypted-data-vaults/{vaultID}/batch/capacity batchCapacityReq
+//
+// Checks whether a planned batch operation would be accepted by the server given its current limits and load.
+// This allows clients to split up large amounts of work appropriately before sending it.
+//
+// Responses:
+//    default: genericError
+//        200: batchCapacityRes
+func (c *Operation) batchCapacityHandler(rw http.ResponseWriter, req *http.Request) {
+	logger := c.requestLogger(req)
+
+	vaultID, success := unescapePathVar(logger, vaultIDPathVariable, mux.Vars(req), rw)
+	if !success {
+		return
+	}
+
+	requestBody, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusInternalServerError,
+			messages.BatchCapacityCheckFailReadRequestBody, err, vaultID, nil)
+		return
+	}
+
+	logger.Debugf(messages.DebugLogEventWithReceivedData, fmt.Sprintf(messages.BatchCapacityCheckReceiveRequest,
+		vaultID), requestBody)
+
+	var capacityCheck models.BatchCapacityCheck
+
+	err = json.Unmarshal(requestBody, &capacityCheck)
+	if err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusBadRequest, messages.InvalidBatchCapacityCheck, err,
+			vaultID, requestBody)
+		return
+	}
+
+	exists, err := c.vaultCollection.provider.StoreExists(vaultID)
+	if err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusInternalServerError, messages.BatchCapacityCheckFailure,
+			err, vaultID, requestBody)
+		return
+	}
+
+	if !exists {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusNotFound, messages.BatchCapacityCheckFailure,
+			messages.ErrVaultNotFound, vaultID, requestBody)
+		return
+	}
+
+	result, err := c.checkBatchCapacity(req, vaultID, &capacityCheck)
+	if err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusInternalServerError, messages.BatchCapacityCheckFailure,
+			err, vaultID, requestBody)
+		return
+	}
+
+	writeBatchCapacityCheckResult(logger, rw, result, vaultID)
+}
+
+// checkBatchCapacity determines whether a batch with the given characteristics, sent to the given vault by the client
+// that made req, would be accepted right now. Besides the batch limits, it's checked against the server's document
+// size limit, the quotas of the vault's tenant and the load that the bulkheads and rate limiter turn requests away at.
+func (c *Operation) checkBatchCapacity(req *http.Request, vaultID string,
+	capacityCheck *models.BatchCapacityCheck) (*models.BatchCapacityCheckResult, error) {
+	result := &models.BatchCapacityCheckResult{
+		MaxOperations:        c.batchLimits.MaxOperations,
+		MaxBytes:             c.batchLimits.MaxBytes,
+		MaxConcurrentBatches: c.batchLimits.MaxConcurrentBatches,
+		CurrentBatches:       uint(atomic.LoadInt32(&c.currentBatches)),
+	}
+
+	if c.batchLimits.MaxOperations > 0 && capacityCheck.NumOperations > c.batchLimits.MaxOperations {
+		result.Reasons = append(result.Reasons,
+			fmt.Sprintf(messages.BatchTooManyOperations, capacityCheck.NumOperations, c.batchLimits.MaxOperations))
+	}
+
+	if c.batchLimits.MaxBytes > 0 && capacityCheck.TotalBytes > c.batchLimits.MaxBytes {
+		result.Reasons = append(result.Reasons,
+			fmt.Sprintf(messages.BatchTooLarge, capacityCheck.TotalBytes, c.batchLimits.MaxBytes))
+	}
+
+	if c.batchLimits.MaxConcurrentBatches > 0 && result.CurrentBatches >= c.batchLimits.MaxConcurrentBatches {
+		result.Reasons = append(result.Reasons,
+			fmt.Sprintf(messages.ServerAtBatchCapacity, result.CurrentBatches))
+	}
+
+	if c.maxDocumentSize > 0 && capacityCheck.LargestDocumentBytes > c.maxDocumentSize {
+		result.Reasons = append(result.Reasons, fmt.Sprintf(messages.BatchCheckDocumentTooLarge,
+			capacityCheck.LargestDocumentBytes, c.maxDocumentSize))
+	}
+
+	quotaReasons, err := c.tenantQuotaReasons(vaultID, capacityCheck)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Reasons = append(result.Reasons, quotaReasons...)
+
+	for _, r := range c.rejecters {
+		if reason := r.Rejection(req); reason != "" {
+			result.Reasons = append(result.Reasons, reason)
 		}
 	}
 
-	c.upsertRemainingDocuments(rw, host, vaultID, currentUpsertDocumentsBatch, responses, numOperationsCompleted,
-		requestBody)
+	result.Accepted = len(result.Reasons) == 0
+
+	return result, nil
 }
 
-func (c *Operation) upsertRemainingDocuments(rw http.ResponseWriter, host, vaultID string,
-	currentUpsertDocumentsBatch []models.EncryptedDocument, responses []string, numOperationsCompleted int,
-	requestBody []byte) {
-	if len(currentUpsertDocumentsBatch) > 0 {
-		err := c.vaultCollection.upsertDocuments(vaultID, currentUpsertDocumentsBatch)
-		if err != nil {
-			for i := 0; i < len(currentUpsertDocumentsBatch); i++ {
-				responses[i+numOperationsCompleted] = err.Error()
-			}
+// tenantQuotaReasons returns the reasons that the quotas of the vault's tenant, if it has one, could reject a batch
+// with the given characteristics for. Which documents a batch replaces isn't known in advance, so every operation is
+// assumed to store a new document.
+func (c *Operation) tenantQuotaReasons(vaultID string, capacityCheck *models.BatchCapacityCheck) ([]string, error) {
+	tenantID, err := c.vaultCollection.provider.VaultTenant(vaultID)
+	if err != nil || tenantID == "" {
+		return nil, err
+	}
+
+	tenant, err := c.vaultCollection.provider.Tenant(tenantID)
+	if err != nil {
+		return nil, err
+	}
 
-			writeBatchResponse(rw, messages.BatchResponseFailure, vaultID, requestBody, responses)
+	var reasons []string
 
-			return
+	if maxDocuments := tenant.Quotas.MaxDocuments; maxDocuments > 0 &&
+		tenant.Usage.Documents+uint64(capacityCheck.NumOperations) > maxDocuments {
+		reasons = append(reasons, fmt.Sprintf(messages.BatchOverTenantDocumentQuota, capacityCheck.NumOperations,
+			tenantID, remainingQuota(maxDocuments, tenant.Usage.Documents)))
+	}
+
+	if maxBytes := tenant.Quotas.MaxBytes; maxBytes > 0 && tenant.Usage.Bytes+capacityCheck.TotalBytes > maxBytes {
+		reasons = append(reasons, fmt.Sprintf(messages.BatchOverTenantByteQuota, capacityCheck.TotalBytes, tenantID,
+			remainingQuota(maxBytes, tenant.Usage.Bytes)))
+	}
+
+	return reasons, nil
+}
+
+// remainingQuota returns how much of a quota is left. Quotas lowered below their usage have none left.
+func remainingQuota(quota, usage uint64) uint64 {
+	if usage >= quota {
+		return 0
+	}
+
+	return quota - usage
+}
+
+// checkBatchDocumentSizes returns an error if an upsert in the batch has a document larger than the maximum document
+// size, which applies to batches like it does to document creations and updates.
+func (c *Operation) checkBatchDocumentSizes(incomingBatch models.Batch) error {
+	if c.maxDocumentSize == 0 {
+		return nil
+	}
+
+	for i := range incomingBatch {
+		if !strings.EqualFold(incomingBatch[i].Operation, models.UpsertDocumentVaultOperation) {
+			continue
 		}
 
-		for i := 0; i < len(currentUpsertDocumentsBatch); i++ {
-			responses[i+numOperationsCompleted] = getFullDocumentURL(currentUpsertDocumentsBatch[i].ID, vaultID, host)
+		documentBytes, err := json.Marshal(incomingBatch[i].EncryptedDocument)
+		if err != nil {
+			return fmt.Errorf("failed to marshal document of operation %d: %w", i, err)
+		}
+
+		if uint64(len(documentBytes)) > c.maxDocumentSize {
+			return fmt.Errorf(messages.BatchDocumentTooLarge, i, len(documentBytes), c.maxDocumentSize)
 		}
 	}
 
-	writeBatchResponse(rw, messages.BatchResponseSuccess, vaultID, requestBody, responses)
+	return nil
 }
 
-func createInitialResponses(numResponses int) []string {
-	responses := make([]string, numResponses)
-	for i := range responses {
-		responses[i] = "not validated or executed"
+// acquireBatchSlot reserves a slot for a new batch operation.
+// Returns false if the server is already processing the maximum number of concurrent batches.
+func (c *Operation) acquireBatchSlot() bool {
+	currentBatches := atomic.AddInt32(&c.currentBatches, 1)
+
+	if c.batchLimits.MaxConcurrentBatches > 0 && uint(currentBatches) > c.batchLimits.MaxConcurrentBatches {
+		atomic.AddInt32(&c.currentBatches, -1)
+
+		return false
 	}
 
-	return responses
+	return true
 }
 
-func validateBatch(incomingBatch models.Batch, responses []string) error {
-	for i, vaultOperation := range incomingBatch {
+func (c *Operation) releaseBatchSlot() {
+	atomic.AddInt32(&c.currentBatches, -1)
+}
+
+// readBatchRequestBody reads the batch request body. If a maximum batch size is set, then reading stops once
+// that limit has been exceeded and a bool indicating that the batch is too large is returned.
+func (c *Operation) readBatchRequestBody(req *http.Request) ([]byte, bool, error) {
+	if c.batchLimits.MaxBytes == 0 {
+		requestBody, err := ioutil.ReadAll(req.Body)
+
+		return requestBody, false, err
+	}
+
+	requestBody, err := ioutil.ReadAll(io.LimitReader(req.Body, int64(c.batchLimits.MaxBytes)+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	return requestBody, uint64(len(requestBody)) > c.batchLimits.MaxBytes, nil
+}
+
+func (c *Operation) executeBatchedOperations(ctx context.Context, logger logging.Logger, rw http.ResponseWriter, host,
+	vaultID string, vaultOperations models.Batch, responses []string, requestBody []byte) {
+	// To improve performance, we gather as many document upsert operations as we can before we hit a
+	// delete operation so that we can insert them into the underlying database in one big bulk operation.
+	var currentUpsertDocumentsBatch []models.EncryptedDocument
+
+	var numOperationsCompleted int
+
+	for vaultOperationIndex, vaultOperation := range vaultOperations {
 		switch {
 		case strings.EqualFold(vaultOperation.Operation, models.UpsertDocumentVaultOperation):
-			if err := validateEncryptedDocument(vaultOperation.EncryptedDocument); err != nil {
-				responses[i] = err.Error()
-				return err
+			currentUpsertDocumentsBatch = append(currentUpsertDocumentsBatch, vaultOperation.EncryptedDocument)
+		case strings.EqualFold(vaultOperation.Operation, models.DeleteDocumentVaultOperation):
+			if len(currentUpsertDocumentsBatch) > 0 {
+				if !c.upsertBatchedDocuments(ctx, host, vaultID, currentUpsertDocumentsBatch,
+					responses[numOperationsCompleted:]) {
+					writeBatchResponse(logger, rw, messages.BatchResponseFailure, vaultID, requestBody, responses)
+
+					return
+				}
+
+				numOperationsCompleted += len(currentUpsertDocumentsBatch)
+
+				currentUpsertDocumentsBatch = nil // Finished with these documents, start a new batch
 			}
 
-			responses[i] = "validated but not executed"
-		case strings.EqualFold(vaultOperation.Operation, models.DeleteDocumentVaultOperation):
-			if vaultOperation.DocumentID == "" {
-				err := errors.New("document ID cannot be empty for a delete operation")
-				responses[i] = err.Error()
+			deletedSequence, err := c.vaultCollection.deleteDocument(ctx, logger, vaultOperation.DocumentID, vaultID, nil)
+			if err == nil {
+				responses[vaultOperationIndex] = ""
 
-				return err
+				c.publishEvent(vaultID, vaultOperation.DocumentID, deletedSequence, models.DocumentDeletedVaultEvent)
+			} else {
+				responses[vaultOperationIndex] = err.Error()
+				if !errors.Is(err, messages.ErrDocumentNotFound) {
+					writeBatchResponse(logger, rw, messages.BatchResponseFailure, vaultID, requestBody, responses)
+
+					return
+				}
 			}
 
-			responses[i] = "validated but not executed"
-		default:
+			numOperationsCompleted++
+		default: // Validation check should ensure that this can't happen.
 			err := fmt.Errorf("%s is not a valid vault operation", vaultOperation.Operation)
-			responses[i] = err.Error()
+			responses[vaultOperationIndex] = err.Error()
+			writeBatchResponse(logger, rw, messages.BatchResponseFailure, vaultID, requestBody, responses)
+
+			return
+		}
+	}
+
+	c.upsertRemainingDocuments(ctx, logger, rw, host, vaultID, currentUpsertDocumentsBatch, responses,
+		numOperationsCompleted,
+		requestBody)
+}
+
+func (c *Operation) upsertRemainingDocuments(ctx context.Context, logger logging.Logger, rw http.ResponseWriter, host,
+	vaultID string, currentUpsertDocumentsBatch []models.EncryptedDocument, responses []string,
+	numOperationsCompleted int, requestBody []byte) {
+	if len(currentUpsertDocumentsBatch) > 0 &&
+		!c.upsertBatchedDocuments(ctx, host, vaultID, currentUpsertDocumentsBatch, responses[numOperationsCompleted:]) {
+		writeBatchResponse(logger, rw, messages.BatchResponseFailure, vaultID, requestBody, responses)
+
+		return
+	}
+
+	writeBatchResponse(logger, rw, messages.BatchResponseSuccess, vaultID, requestBody, responses)
+}
+
+// upsertBatchedDocuments stores a run of consecutive upsert operations from a batch and sets their responses,
+// which start at the beginning of responses. It returns false if any of the documents couldn't be stored.
+// If the storage provider could tell which documents failed (see edvprovider.BatchError), then the other
+// documents were stored and get their location as their response.
+func (c *Operation) upsertBatchedDocuments(ctx context.Context, host, vaultID string,
+	documents []models.EncryptedDocument, responses []string) bool {
+	err := c.vaultCollection.upsertDocuments(ctx, vaultID, documents)
+	if err == nil {
+		for i := range documents {
+			responses[i] = getFullDocumentURL(documents[i].ID, vaultID, host)
+		}
+
+		c.publishUpsertedEvents(vaultID, documents)
+
+		return true
+	}
+
+	var batchErr *edvprovider.BatchError
+	if !errors.As(err, &batchErr) {
+		for i := range documents {
+			responses[i] = err.Error()
+		}
+
+		return false
+	}
+
+	failed := make(map[string]struct{}, len(batchErr.DocumentIDs))
+	for _, documentID := range batchErr.DocumentIDs {
+		failed[documentID] = struct{}{}
+	}
+
+	var storedDocuments []models.EncryptedDocument
+
+	for i := range documents {
+		if _, ok := failed[documents[i].ID]; ok {
+			responses[i] = err.Error()
+
+			continue
+		}
+
+		responses[i] = getFullDocumentURL(documents[i].ID, vaultID, host)
+		storedDocuments = append(storedDocuments, documents[i])
+	}
+
+	c.publishUpsertedEvents(vaultID, storedDocuments)
+
+	return false
+}
+
+func createInitialResponses(numResponses int) []string {
+	responses := make([]string, numResponses)
+	for i := range responses {
+		responses[i] = "not validated or executed"
+	}
+
+	return responses
+}
+
+func (c *Operation) validateBatch(incomingBatch models.Batch, responses []string) error {
+	for i, vaultOperation := range incomingBatch {
+		switch {
+		case strings.EqualFold(vaultOperation.Operation, models.UpsertDocumentVaultOperation):
+			if err := c.validateEncryptedDocument(vaultOperation.EncryptedDocument); err != nil {
+				responses[i] = err.Error()
+				return err
+			}
+
+			responses[i] = "validated but not executed"
+		case strings.EqualFold(vaultOperation.Operation, models.DeleteDocumentVaultOperation):
+			if vaultOperation.DocumentID == "" {
+				err := errors.New("document ID cannot be empty for a delete operation")
+				responses[i] = err.Error()
+
+				return err
+			}
+
+			responses[i] = "validated but not executed"
+		default:
+			err := fmt.Errorf("%s is not a valid vault operation", vaultOperation.Operation)
+			responses[i] = err.Error()
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (vc *VaultCollection) createDataVault(vaultID string) error {
+	return vc.provider.CreateVaultStore(vaultID)
+}
+
+// storeDataVaultConfiguration stores a given DataVaultConfiguration and vaultID
+func (vc *VaultCollection) deleteDataVault(vaultID string) error {
+	exists, err := vc.provider.StoreExists(vaultID)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return messages.ErrVaultNotFound
+	}
+
+	return vc.provider.DeleteStore(vaultID)
+}
+
+func (vc *VaultCollection) storeDataVaultConfiguration(config *models.DataVaultConfiguration,
+	vaultID, tenantID string) error {
+	if tenantID != "" {
+		err := vc.provider.StoreTenantDataVaultConfiguration(config, vaultID, tenantID)
+		if err != nil {
+			return fmt.Errorf("failed to store data vault configuration for tenant %s: %w", tenantID, err)
+		}
+
+		return nil
+	}
+
+	store, err := vc.provider.OpenStore(edvprovider.VaultConfigurationStoreName)
+	if err != nil {
+		if errors.Is(err, storage.ErrStoreNotFound) {
+			return errors.New(messages.ConfigStoreNotFound)
+		}
+
+		return fmt.Errorf("failed to open store for vault configurations: %w", err)
+	}
+
+	err = store.StoreDataVaultConfiguration(config, vaultID)
+	if err != nil {
+		return fmt.Errorf("failed to store data vault configuration in store: %w", err)
+	}
+
+	return nil
+}
+
+// Update configuration swagger route
+// swagger:route PATCH /encrypted-data-vaults/{vaultID}/configuration configuration updateConfigurationReq
+//
+// Updates the configuration of the vault. The controller, invokers, delegators, invocation method, webhooks and
+// retrieval page size can be changed, and a reference ID can be set if the vault doesn't have one yet. If the
+// controller is set and authorization is enabled, then a capability for the vault is delegated to the controller.
+// Only the vault's controller can change its controller, invokers, delegators and invocation method.
+//
+// Responses:
+//    default: genericError
+//        200: updateConfigurationRes
+func (c *Operation) updateConfigurationHandler(rw http.ResponseWriter, req *http.Request) {
+	logger := c.requestLogger(req)
+
+	vaultID, success := unescapePathVar(logger, vaultIDPathVariable, mux.Vars(req), rw)
+	if !success {
+		return
+	}
+
+	requestBody, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusInternalServerError,
+			messages.UpdateConfigurationFailReadRequestBody, err, vaultID, nil)
+		return
+	}
+
+	// The secret of the vault's webhooks is redacted from everything that's logged or sent back.
+	redactedBody := redactWebhookSecret(requestBody)
+
+	logger.Debugf(messages.DebugLogEventWithReceivedData, fmt.Sprintf(messages.UpdateConfigurationReceiveRequest,
+		vaultID), redactedBody)
+
+	var incomingUpdate models.DataVaultConfigurationUpdate
+
+	err = json.Unmarshal(requestBody, &incomingUpdate)
+	if err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusBadRequest, messages.InvalidConfigurationUpdate, err,
+			vaultID, redactedBody)
+		return
+	}
+
+	err = c.validateConfigurationUpdate(&incomingUpdate)
+	if err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusBadRequest, messages.InvalidConfigurationUpdate, err,
+			vaultID, redactedBody)
+		return
+	}
+
+	result, err := c.updateConfiguration(vaultID, &incomingUpdate, req)
+	if err != nil {
+		writeUpdateConfigurationFailure(logger, rw, err, vaultID, redactedBody)
+		return
+	}
+
+	writeUpdateConfigurationSuccess(logger, rw, vaultID, result)
+}
+
+func (c *Operation) updateConfiguration(vaultID string, update *models.DataVaultConfigurationUpdate,
+	req *http.Request) (*models.DataVaultConfigurationUpdateResult, error) {
+	// Anyone who can write to the vault can update its configuration, but only its controller can decide who
+	// controls it and who can invoke or delegate its capabilities. Otherwise a delegatee could make itself the
+	// controller. The new controller is also delegated a capability from the vault's root capability.
+	if update.Controller != nil || update.Invoker != nil || update.Delegator != nil || update.InvocationMethod != nil {
+		err := c.checkControllerAuthority(vaultID, req,
+			"the controller, invokers, delegators and invocation method can only be changed")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	configStore, err := c.vaultCollection.provider.OpenStore(edvprovider.VaultConfigurationStoreName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store for vault configurations: %w", err)
+	}
+
+	config, err := configStore.UpdateDataVaultConfiguration(vaultID, update)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.DataVaultConfigurationUpdateResult{
+		Configuration: configurationForResponse(config),
+		Webhooks:      webhooksStatus(update.Webhooks),
+	}
+
+	if c.authEnable && update.Controller != nil {
+		result.Capability, err = c.authService.Delegate(vaultID, &zcapld.Delegation{Invoker: *update.Controller})
+		if err != nil {
+			return nil, fmt.Errorf("failed to delegate capability to new controller: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// Delegate capability swagger route
+// swagger:route POST /encrypted-data-vaults/{vaultID}/capabilities capabilities delegateCapabilityReq
+//
+// Delegates a new capability for the vault from an existing one. The delegated capability can be restricted to
+// fewer actions or operations, a single document, the documents indexed with an attribute or a limited lifetime.
+// If the request invokes a capability, then only that capability can be delegated from.
+//
+// Responses:
+//    default: genericError
+//        201: delegateCapabilityRes
+func (c *Operation) delegateCapabilityHandler(rw http.ResponseWriter, req *http.Request) {
+	logger := c.requestLogger(req)
+
+	vaultID, success := unescapePathVar(logger, vaultIDPathVariable, mux.Vars(req), rw)
+	if !success {
+		return
+	}
+
+	requestBody, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusInternalServerError,
+			messages.DelegateCapabilityFailReadRequestBody, err, vaultID, nil)
+		return
+	}
+
+	logger.Debugf(messages.DebugLogEventWithReceivedData, fmt.Sprintf(messages.DelegateCapabilityReceiveRequest,
+		vaultID), requestBody)
+
+	var incomingDelegation models.CapabilityDelegation
+
+	err = json.Unmarshal(requestBody, &incomingDelegation)
+	if err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusBadRequest, messages.InvalidCapabilityDelegation, err,
+			vaultID, requestBody)
+		return
+	}
+
+	if !c.vaultExists(logger, rw, messages.DelegateCapabilityFailure, vaultID) {
+		return
+	}
+
+	capabilityBytes, err := c.delegateCapability(vaultID, &incomingDelegation, req)
+	if err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, zcapld.HTTPStatus(err), messages.DelegateCapabilityFailure, err,
+			vaultID, requestBody)
+		return
+	}
+
+	writeDelegateCapabilitySuccess(logger, rw, vaultID, capabilityBytes)
+}
+
+func (c *Operation) delegateCapability(vaultID string, incomingDelegation *models.CapabilityDelegation,
+	req *http.Request) ([]byte, error) {
+	delegation := &zcapld.Delegation{
+		Parent:         incomingDelegation.ParentCapability,
+		Invoker:        incomingDelegation.Invoker,
+		AllowedActions: incomingDelegation.AllowedActions,
+		DocumentID:     incomingDelegation.DocumentID,
+		Operations:     incomingDelegation.Operations,
+	}
+
+	if incomingDelegation.Expires != nil {
+		delegation.Expires = *incomingDelegation.Expires
+	}
+
+	if incomingDelegation.Attribute != nil {
+		delegation.Attribute = &auth.Attribute{
+			Name: incomingDelegation.Attribute.Name, Value: incomingDelegation.Attribute.Value,
+		}
+	}
+
+	invokedCapability, err := zcapld.InvokedCapability(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Requests authorized with a bearer token don't invoke a capability, in which case any of the vault's
+	// capabilities other than its root capability can be delegated from. Otherwise, a token that's allowed to write
+	// to the vault could be used to hand out capabilities with the full authority of the vault's controller.
+	if invokedCapability == nil {
+		delegation.NotFromRoot = true
+	} else {
+		if delegation.Parent == "" {
+			delegation.Parent = invokedCapability.ID
+		}
+
+		if delegation.Parent != invokedCapability.ID {
+			return nil, fmt.Errorf("%w: capabilities can only be delegated from the invoked capability %s",
+				zcapld.ErrActionNotAllowed, invokedCapability.ID)
+		}
+	}
+
+	return c.authService.Delegate(vaultID, delegation)
+}
+
+// Revoke capability swagger route
+// swagger:route DELETE /encrypted-data-vaults/{vaultID}/capabilities/{capabilityID} capabilities revokeCapabilityReq
+//
+// Revokes a capability for the vault, along with every capability delegated from it. If the request invokes a
+// capability, then it must be the revoked capability or one of the capabilities it was delegated from. Capabilities
+// that the server didn't store can only be revoked by invoking a capability of the vault's controller.
+//
+// Responses:
+//    default: genericError
+//        200: emptyRes
+func (c *Operation) revokeCapabilityHandler(rw http.ResponseWriter, req *http.Request) {
+	logger := c.requestLogger(req)
+
+	vaultID, success := unescapePathVar(logger, vaultIDPathVariable, mux.Vars(req), rw)
+	if !success {
+		return
+	}
+
+	capabilityID, success := unescapePathVar(logger, capabilityIDPathVariable, mux.Vars(req), rw)
+	if !success {
+		return
+	}
+
+	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.RevokeCapabilityReceiveRequest,
+		capabilityID, vaultID))
+
+	err := c.revokeCapability(vaultID, capabilityID, req)
+	if err != nil {
+		writeRevokeCapabilityFailure(logger, rw, err, capabilityID, vaultID)
+		return
+	}
+
+	logger.Infof(messages.RevokeCapabilitySuccess, capabilityID, vaultID)
+}
+
+func (c *Operation) revokeCapability(vaultID, capabilityID string, req *http.Request) error {
+	exists, err := c.vaultCollection.provider.StoreExists(vaultID)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return messages.ErrVaultNotFound
+	}
+
+	invokedCapability, err := zcapld.InvokedCapability(req)
+	if err != nil {
+		return err
+	}
+
+	var revokerID string
+	if invokedCapability != nil {
+		revokerID = invokedCapability.ID
+	}
+
+	return c.authService.Revoke(vaultID, capabilityID, revokerID)
+}
+
+// vaultExists writes an error response using failureMessage and returns false if the vault doesn't exist
+// or its existence couldn't be determined.
+func (c *Operation) vaultExists(logger logging.Logger, rw http.ResponseWriter, failureMessage, vaultID string) bool {
+	exists, err := c.vaultCollection.provider.StoreExists(vaultID)
+	if err != nil {
+		writeErrorWithVaultID(logger, rw, http.StatusInternalServerError, failureMessage, err, vaultID)
+		return false
+	}
+
+	if !exists {
+		writeErrorWithVaultID(logger, rw, http.StatusNotFound, failureMessage, messages.ErrVaultNotFound, vaultID)
+		return false
+	}
+
+	return true
+}
+
+// publishEvent notifies the vault's webhooks of a document change. It does nothing if notifications are disabled,
+// or if the outbox is enabled, in which case the event was stored along with the change and is published from there.
+func (c *Operation) publishEvent(vaultID, docID string, sequence uint64, eventType string) {
+	if c.notifier == nil || c.vaultCollection.provider.OutboxEnabled() {
+		return
+	}
+
+	c.notifier.Publish(&models.VaultEvent{
+		VaultID:    vaultID,
+		DocumentID: docID,
+		Sequence:   sequence,
+		Type:       eventType,
+		Timestamp:  time.Now().UTC(),
+	})
+}
+
+func (c *Operation) publishUpsertedEvents(vaultID string, documents []models.EncryptedDocument) {
+	for i := range documents {
+		c.publishEvent(vaultID, documents[i].ID, documents[i].Sequence, models.DocumentUpsertedVaultEvent)
+	}
+}
+
+func (c *Operation) createDocument(ctx context.Context, logger logging.Logger, rw http.ResponseWriter,
+	requestBody io.Reader, hostURL, vaultID string) {
+	incomingDocument, err := decodeDocument(requestBody)
+	if err != nil {
+		if errors.Is(err, errDocumentTooLarge) {
+			writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusRequestEntityTooLarge,
+				messages.InvalidDocumentForDocCreation, fmt.Errorf(messages.DocumentTooLarge, c.maxDocumentSize),
+				vaultID, nil)
+			return
+		}
+
+		var errRead *readError
+		if errors.As(err, &errRead) {
+			writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusInternalServerError,
+				messages.CreateDocumentFailReadRequestBody, errRead.err, vaultID, nil)
+			return
+		}
+
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusBadRequest, messages.InvalidDocumentForDocCreation, err,
+			vaultID, nil)
+		return
+	}
+
+	var docBytesForLog []byte
+
+	if debugLogLevelEnabled() {
+		var errMarshal error
+		docBytesForLog, errMarshal = json.Marshal(incomingDocument)
+
+		if errMarshal != nil {
+			logger.Errorf(messages.DebugLogEvent, fmt.Sprintf(messages.MarshalDocumentForLogFailure, errMarshal))
+		}
+	}
+
+	if err = c.validateEncryptedDocument(incomingDocument); err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusBadRequest, messages.InvalidDocumentForDocCreation, err,
+			vaultID, docBytesForLog)
+		return
+	}
+
+	if err = checkDocumentRestrictions(auth.RestrictionsFrom(ctx), &incomingDocument); err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusForbidden, messages.OperationRestricted, err,
+			vaultID, docBytesForLog)
+		return
+	}
+
+	err = c.vaultCollection.createDocument(ctx, vaultID, incomingDocument)
+	if err != nil {
+		writeCreateDocumentFailure(logger, rw, err, vaultID, docBytesForLog)
+		return
+	}
+
+	writeCreateDocumentSuccess(logger, rw, hostURL, vaultID, incomingDocument.ID, docBytesForLog)
+
+	c.publishEvent(vaultID, incomingDocument.ID, incomingDocument.Sequence, models.DocumentCreatedVaultEvent)
+}
+
+func (vc *VaultCollection) createDocument(ctx context.Context, vaultID string,
+	document models.EncryptedDocument) error {
+	exists, err := vc.provider.StoreExists(vaultID)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return messages.ErrVaultNotFound
+	}
+
+	store, err := vc.openStore(ctx, vaultID)
+	if err != nil {
+		return err
+	}
+
+	// The Create Document API call should not overwrite an existing document.
+	// So we first check to make sure there is not already a document associated with the id.
+	// If there is, we send back an error.
+	documentExists, err := store.Exists(document.ID)
+	if err != nil {
+		return err
+	}
+
+	if documentExists {
+		return messages.ErrDuplicateDocument
+	}
+
+	return store.Put(document)
+}
+
+func (vc *VaultCollection) upsertDocuments(ctx context.Context, vaultID string,
+	documents []models.EncryptedDocument) error {
+	exists, err := vc.provider.StoreExists(vaultID)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return messages.ErrVaultNotFound
+	}
 
-			return err
-		}
+	store, err := vc.openStore(ctx, vaultID)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return store.UpsertBulk(documents)
 }
 
-func (vc *VaultCollection) createDataVault(vaultID string) error {
-	_, err := vc.provider.OpenStore(vaultID)
+// readDocument returns a reader for a document, which the caller must close, along with the document's sequence.
+// The sequence is nil if it couldn't be determined.
+func (vc *VaultCollection) readDocument(ctx context.Context, logger logging.Logger, vaultID,
+	docID string) (io.ReadCloser, *uint64, error) {
+	exists, err := vc.provider.StoreExists(vaultID)
 	if err != nil {
-		return fmt.Errorf("failed to open store for vault: %w", err)
+		return nil, nil, err
 	}
 
-	err = vc.provider.SetStoreConfig(vaultID, storage.StoreConfiguration{TagNames: []string{
-		edvprovider.MappingDocumentTagName,
-		edvprovider.MappingDocumentMatchingEncryptedDocIDTagName,
-	}})
-	if err != nil {
-		return fmt.Errorf("failed to set store config: %w", err)
+	if !exists {
+		return nil, nil, messages.ErrVaultNotFound
 	}
 
-	return nil
-}
+	store, err := vc.openStore(ctx, vaultID)
+	if err != nil {
+		return nil, nil, err
+	}
 
-// storeDataVaultConfiguration stores a given DataVaultConfiguration and vaultID
-func (vc *VaultCollection) storeDataVaultConfiguration(config *models.DataVaultConfiguration, vaultID string) error {
-	store, err := vc.provider.OpenStore(edvprovider.VaultConfigurationStoreName)
+	document, err := store.GetStream(docID)
 	if err != nil {
-		if errors.Is(err, storage.ErrStoreNotFound) {
-			return errors.New(messages.ConfigStoreNotFound)
+		if errors.Is(err, storage.ErrDataNotFound) {
+			return nil, nil, messages.ErrDocumentNotFound
 		}
 
-		return fmt.Errorf("failed to open store for vault configurations: %w", err)
+		return nil, nil, err
 	}
 
-	err = store.StoreDataVaultConfiguration(config, vaultID)
+	sequence, err := store.Sequence(docID)
 	if err != nil {
-		return fmt.Errorf("failed to store data vault configuration in store: %w", err)
+		logger.Warnf("Failed to get sequence of document %s in vault %s: %s", docID, vaultID, err)
+
+		return document, nil, nil
 	}
 
-	return nil
+	return document, &sequence, nil
 }
 
-func (c *Operation) createDocument(rw http.ResponseWriter, requestBody []byte, hostURL, vaultID string) {
-	var incomingDocument models.EncryptedDocument
-
-	err := json.Unmarshal(requestBody, &incomingDocument)
+// readDocumentRevision returns the given revision of a document.
+func (vc *VaultCollection) readDocumentRevision(ctx context.Context, vaultID, docID string,
+	revision *documentRevision) ([]byte, error) {
+	exists, err := vc.provider.StoreExists(vaultID)
 	if err != nil {
-		writeErrorWithVaultIDAndReceivedData(rw, http.StatusBadRequest, messages.InvalidDocumentForDocCreation, err,
-			vaultID, requestBody)
-		return
+		return nil, err
 	}
 
-	var docBytesForLog []byte
-
-	if debugLogLevelEnabled() {
-		var errMarshal error
-		docBytesForLog, errMarshal = json.Marshal(incomingDocument)
-
-		if errMarshal != nil {
-			logger.Errorf(messages.DebugLogEventWithReceivedData,
-				fmt.Sprintf(messages.MarshalDocumentForLogFailure, errMarshal),
-				requestBody)
-		}
+	if !exists {
+		return nil, messages.ErrVaultNotFound
 	}
 
-	if err = validateEncryptedDocument(incomingDocument); err != nil {
-		writeErrorWithVaultIDAndReceivedData(rw, http.StatusBadRequest, messages.InvalidDocumentForDocCreation, err,
-			vaultID, requestBody)
-		return
+	store, err := vc.openStore(ctx, vaultID)
+	if err != nil {
+		return nil, err
 	}
 
-	err = c.vaultCollection.createDocument(vaultID, incomingDocument)
-	if err != nil {
-		writeCreateDocumentFailure(rw, err, vaultID, docBytesForLog)
-		return
+	if revision.sequence != nil {
+		return store.Revision(docID, *revision.sequence)
 	}
 
-	writeCreateDocumentSuccess(rw, hostURL, vaultID, incomingDocument.ID, docBytesForLog)
+	return store.RevisionAsOf(docID, revision.asOf)
 }
 
-func (vc *VaultCollection) createDocument(vaultID string, document models.EncryptedDocument) error {
+// documentExists returns whether a document exists, without reading it.
+func (vc *VaultCollection) documentExists(ctx context.Context, vaultID, docID string) (bool, error) {
 	exists, err := vc.provider.StoreExists(vaultID)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	if !exists {
-		return messages.ErrVaultNotFound
+		return false, messages.ErrVaultNotFound
 	}
 
-	store, err := vc.provider.OpenStore(vaultID)
+	store, err := vc.openStore(ctx, vaultID)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	// The Create Document API call should not overwrite an existing document.
-	// So we first check to make sure there is not already a document associated with the id.
-	// If there is, we send back an error.
-	_, err = store.Get(document.ID)
-	if err == nil {
-		return messages.ErrDuplicateDocument
-	}
+	return store.Exists(docID)
+}
 
-	if !errors.Is(err, storage.ErrDataNotFound) {
-		return err
+// readTombstone returns the tombstone of a deleted document. messages.ErrDocumentNotFound is returned if the vault
+// doesn't keep a tombstone for the document.
+func (vc *VaultCollection) readTombstone(ctx context.Context, vaultID, docID string) (*models.Tombstone, error) {
+	store, err := vc.openStore(ctx, vaultID)
+	if err != nil {
+		return nil, err
 	}
 
-	return store.Put(document)
+	return store.Tombstone(docID)
 }
 
-func (vc *VaultCollection) upsertDocuments(vaultID string, documents []models.EncryptedDocument) error {
+func (vc *VaultCollection) restoreDocument(ctx context.Context, vaultID, docID string) (uint64, error) {
 	exists, err := vc.provider.StoreExists(vaultID)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	if !exists {
-		return messages.ErrVaultNotFound
+		return 0, messages.ErrVaultNotFound
 	}
 
-	store, err := vc.provider.OpenStore(vaultID)
+	store, err := vc.openStore(ctx, vaultID)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return store.UpsertBulk(documents)
+	return store.Restore(docID)
 }
 
-func (vc *VaultCollection) readDocument(vaultID, docID string) ([]byte, error) {
-	exists, err := vc.provider.StoreExists(vaultID)
+func (vc *VaultCollection) queryVault(ctx context.Context, vaultID string, query *models.Query, after string,
+	deadline time.Time) (*edvprovider.QueryPage, error) {
+	store, query, err := vc.openStoreForQuery(ctx, vaultID, query)
 	if err != nil {
 		return nil, err
 	}
 
-	if !exists {
-		return nil, messages.ErrVaultNotFound
+	return store.QueryWithDeadline(query, after, deadline)
+}
+
+func (vc *VaultCollection) countQuery(ctx context.Context, vaultID string, query *models.Query) (int, error) {
+	store, query, err := vc.openStoreForQuery(ctx, vaultID, query)
+	if err != nil {
+		return 0, err
 	}
 
-	store, err := vc.provider.OpenStore(vaultID)
+	return store.Count(query)
+}
+
+// openStore opens the store of the given vault. The store includes the correlation ID of the request that ctx belongs
+// to in the lines it logs, and stops reading once ctx is done, such as when the request's client disconnects.
+func (vc *VaultCollection) openStore(ctx context.Context, vaultID string) (*edvprovider.Store, error) {
+	store, err := vc.provider.OpenStoreWithContext(ctx, vaultID)
 	if err != nil {
 		return nil, err
 	}
 
-	documentBytes, err := store.Get(docID)
+	return store.WithCorrelationID(logging.CorrelationID(ctx)), nil
+}
+
+// openStoreForQuery opens the store of the given vault, and returns the given query with the vault's retrieval page
+// size if it doesn't have its own.
+func (vc *VaultCollection) openStoreForQuery(ctx context.Context, vaultID string,
+	query *models.Query) (*edvprovider.Store, *models.Query, error) {
+	exists, err := vc.provider.StoreExists(vaultID)
 	if err != nil {
-		if errors.Is(err, storage.ErrDataNotFound) {
-			return nil, messages.ErrDocumentNotFound
+		return nil, nil, err
+	}
+
+	if !exists {
+		return nil, nil, messages.ErrVaultNotFound
+	}
+
+	store, err := vc.openStore(ctx, vaultID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// A page size in the query takes precedence over the vault's.
+	if query.PageSize == 0 {
+		pageSize, errPageSize := vc.provider.VaultRetrievalPageSize(vaultID)
+		if errPageSize != nil {
+			return nil, nil, fmt.Errorf("failed to get retrieval page size of vault: %w", errPageSize)
 		}
 
-		return nil, err
+		queryWithPageSize := *query
+		queryWithPageSize.PageSize = pageSize
+		query = &queryWithPageSize
 	}
 
-	return documentBytes, err
+	return store, query, nil
 }
 
-func (vc *VaultCollection) queryVault(vaultID string, query *models.Query) ([]models.EncryptedDocument, error) {
+func (vc *VaultCollection) listDocuments(ctx context.Context, vaultID string, afterSequence *uint64, afterID string,
+	limit int) (*models.DocumentList, error) {
 	exists, err := vc.provider.StoreExists(vaultID)
 	if err != nil {
 		return nil, err
@@ -704,44 +2031,79 @@ func (vc *VaultCollection) queryVault(vaultID string, query *models.Query) ([]mo
 		return nil, messages.ErrVaultNotFound
 	}
 
-	store, err := vc.provider.OpenStore(vaultID)
+	store, err := vc.openStore(ctx, vaultID)
 	if err != nil {
 		return nil, err
 	}
 
-	return store.Query(query)
+	return store.ListDocuments(afterSequence, afterID, limit)
 }
 
-func (c *Operation) updateDocument(rw http.ResponseWriter, requestBody []byte, docID, vaultID string) {
-	var incomingDocument models.EncryptedDocument
-
-	err := json.Unmarshal(requestBody, &incomingDocument)
+func (c *Operation) updateDocument(ctx context.Context, logger logging.Logger, rw http.ResponseWriter,
+	requestBody io.Reader, docID, vaultID string, ifMatchSequence *uint64) {
+	incomingDocument, err := decodeDocument(requestBody)
 	if err != nil {
-		writeErrorWithVaultIDAndDocID(rw, http.StatusBadRequest, messages.InvalidDocumentForDocUpdate, err, docID, vaultID)
+		if errors.Is(err, errDocumentTooLarge) {
+			writeErrorWithVaultIDAndDocID(logger, rw, http.StatusRequestEntityTooLarge, messages.InvalidDocumentForDocUpdate,
+				fmt.Errorf(messages.DocumentTooLarge, c.maxDocumentSize), docID, vaultID)
+			return
+		}
+
+		var errRead *readError
+		if errors.As(err, &errRead) {
+			writeErrorWithVaultIDAndDocID(logger, rw, http.StatusInternalServerError,
+				messages.UpdateDocumentFailReadRequestBody, errRead.err, docID, vaultID)
+			return
+		}
+
+		writeErrorWithVaultIDAndDocID(logger, rw, http.StatusBadRequest, messages.InvalidDocumentForDocUpdate, err, docID,
+			vaultID)
 		return
 	}
 
 	if incomingDocument.ID != docID {
-		writeErrorWithVaultIDAndDocID(rw, http.StatusBadRequest, messages.InvalidDocumentForDocUpdate,
+		writeErrorWithVaultIDAndDocID(logger, rw, http.StatusBadRequest, messages.InvalidDocumentForDocUpdate,
 			errors.New(messages.MismatchedDocIDs), docID, vaultID)
 		return
 	}
 
-	if err = validateEncryptedDocument(incomingDocument); err != nil {
-		writeErrorWithVaultIDAndDocID(rw, http.StatusBadRequest, messages.InvalidDocumentForDocUpdate, err, docID, vaultID)
+	if err = c.validateEncryptedDocument(incomingDocument); err != nil {
+		writeErrorWithVaultIDAndDocID(logger, rw, http.StatusBadRequest, messages.InvalidDocumentForDocUpdate, err, docID,
+			vaultID)
+		return
+	}
+
+	// The stored document was checked before the request was handled. Checking the new one too keeps the request from
+	// removing the attributes that it's restricted to.
+	if err = checkDocumentRestrictions(auth.RestrictionsFrom(ctx), &incomingDocument); err != nil {
+		writeErrorWithVaultIDAndDocID(logger, rw, http.StatusForbidden, messages.DocumentOperationRestricted, err, docID,
+			vaultID)
+		return
+	}
+
+	// The store only accepts a new sequence that follows on from the stored one, so if the new sequence also
+	// follows on from the If-Match sequence then the If-Match sequence can't be stale.
+	if ifMatchSequence != nil && incomingDocument.Sequence != *ifMatchSequence+1 {
+		writeUpdateDocumentFailure(logger, rw, fmt.Errorf(messages.StaleIfMatchOnUpdate, messages.ErrDocumentSequenceConflict,
+			*ifMatchSequence, incomingDocument.Sequence), docID, vaultID)
 		return
 	}
 
-	err = c.vaultCollection.updateDocument(docID, vaultID, incomingDocument)
+	err = c.vaultCollection.updateDocument(ctx, docID, vaultID, incomingDocument)
 	if err != nil {
-		writeUpdateDocumentFailure(rw, err, docID, vaultID)
+		writeUpdateDocumentFailure(logger, rw, err, docID, vaultID)
 		return
 	}
 
+	rw.Header().Set(eTagHeader, documentETag(incomingDocument.Sequence))
+
+	c.publishEvent(vaultID, docID, incomingDocument.Sequence, models.DocumentUpdatedVaultEvent)
+
 	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.UpdateDocumentSuccess, docID, vaultID))
 }
 
-func (vc *VaultCollection) updateDocument(docID, vaultID string, document models.EncryptedDocument) error {
+func (vc *VaultCollection) updateDocument(ctx context.Context, docID, vaultID string,
+	document models.EncryptedDocument) error {
 	exists, err := vc.provider.StoreExists(vaultID)
 	if err != nil {
 		return err
@@ -751,48 +2113,84 @@ func (vc *VaultCollection) updateDocument(docID, vaultID string, document models
 		return messages.ErrVaultNotFound
 	}
 
-	store, err := vc.provider.OpenStore(vaultID)
-	if err != nil {
-		return err
-	}
-
-	_, err = store.Get(docID)
+	store, err := vc.openStore(ctx, vaultID)
 	if err != nil {
-		if errors.Is(err, storage.ErrDataNotFound) {
-			return messages.ErrDocumentNotFound
-		}
-
 		return err
 	}
 
 	return store.Update(document)
 }
 
-func (vc *VaultCollection) deleteDocument(docID, vaultID string) error {
+// deleteDocument deletes the given document and returns the sequence it had.
+func (vc *VaultCollection) deleteDocument(ctx context.Context, logger logging.Logger, docID, vaultID string,
+	expectedSequence *uint64) (uint64, error) {
 	exists, err := vc.provider.StoreExists(vaultID)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	if !exists {
-		return messages.ErrVaultNotFound
+		return 0, messages.ErrVaultNotFound
 	}
 
-	store, err := vc.provider.OpenStore(vaultID)
+	store, err := vc.openStore(ctx, vaultID)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	_, err = store.Get(docID)
+	documentBytes, err := store.Get(docID)
 	if err != nil {
 		if errors.Is(err, storage.ErrDataNotFound) {
-			return messages.ErrDocumentNotFound
+			return 0, messages.ErrDocumentNotFound
 		}
 
-		return err
+		return 0, err
+	}
+
+	if expectedSequence != nil {
+		return *expectedSequence, store.DeleteIfSequenceMatches(docID, *expectedSequence)
+	}
+
+	err = store.Delete(docID)
+	if err != nil {
+		return 0, err
+	}
+
+	// The sequence is only informational at this point, so a document that can't be parsed doesn't fail the delete.
+	var document models.EncryptedDocument
+
+	err = json.Unmarshal(documentBytes, &document)
+	if err != nil {
+		logger.Warnf("Failed to determine the sequence of deleted document %s in vault %s: %s", docID, vaultID, err)
+	}
+
+	return document.Sequence, nil
+}
+
+// documentETag returns the ETag for a document, which is its sequence in quotes.
+func documentETag(sequence uint64) string {
+	return strconv.Quote(strconv.FormatUint(sequence, 10))
+}
+
+// parseIfMatchHeader returns the document sequence from the request's If-Match header,
+// or nil if the header isn't set or is "*".
+func parseIfMatchHeader(req *http.Request) (*uint64, error) {
+	ifMatch := strings.TrimSpace(req.Header.Get(ifMatchHeader))
+	if ifMatch == "" || ifMatch == "*" {
+		return nil, nil
+	}
+
+	unquoted, err := strconv.Unquote(ifMatch)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a quoted ETag", ifMatch)
+	}
+
+	sequence, err := strconv.ParseUint(unquoted, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("ETag %s is not a document sequence", ifMatch)
 	}
 
-	return store.Delete(docID)
+	return &sequence, nil
 }
 
 func validateDataVaultConfiguration(dataVaultConfig *models.DataVaultConfiguration) error {
@@ -812,6 +2210,10 @@ func validateDataVaultConfiguration(dataVaultConfig *models.DataVaultConfigurati
 		return fmt.Errorf(messages.InvalidDelegatorStringArray, err)
 	}
 
+	if err := checkInvocationMethod(dataVaultConfig.InvocationMethod); err != nil {
+		return err
+	}
+
 	if err := edvutils.CheckIfURI(dataVaultConfig.KEK.ID); err != nil {
 		return fmt.Errorf(messages.InvalidKEKIDString, err)
 	}
@@ -843,6 +2245,60 @@ func checkConfigRequiredFields(config *models.DataVaultConfiguration) error {
 	return nil
 }
 
+// validateConfigurationUpdate checks the fields that the update sets the same way as validateDataVaultConfiguration.
+func (c *Operation) validateConfigurationUpdate(update *models.DataVaultConfigurationUpdate) error {
+	if update.Controller != nil {
+		if *update.Controller == "" {
+			return errors.New(messages.BlankController)
+		}
+
+		if err := edvutils.CheckIfURI(*update.Controller); err != nil {
+			return fmt.Errorf(messages.InvalidControllerString, err)
+		}
+	}
+
+	if update.Invoker != nil {
+		if err := checkFieldsWithURIArray(*update.Invoker); err != nil {
+			return fmt.Errorf(messages.InvalidInvokerStringArray, err)
+		}
+	}
+
+	if update.Delegator != nil {
+		if err := checkFieldsWithURIArray(*update.Delegator); err != nil {
+			return fmt.Errorf(messages.InvalidDelegatorStringArray, err)
+		}
+	}
+
+	if update.InvocationMethod != nil {
+		if err := checkInvocationMethod(*update.InvocationMethod); err != nil {
+			return err
+		}
+	}
+
+	if update.Webhooks != nil {
+		if c.notifier == nil {
+			return messages.ErrWebhooksNotEnabled
+		}
+
+		return notification.ValidateWebhooks(update.Webhooks, c.allowPrivateWebhookAddresses)
+	}
+
+	return nil
+}
+
+// The invocation method is optional, but must be a valid URI if it's set.
+func checkInvocationMethod(invocationMethod string) error {
+	if invocationMethod == "" {
+		return nil
+	}
+
+	if err := edvutils.CheckIfURI(invocationMethod); err != nil {
+		return fmt.Errorf(messages.InvalidInvocationMethodString, err)
+	}
+
+	return nil
+}
+
 // Check if every string in the array is a valid URI.
 func checkFieldsWithURIArray(arr []string) error {
 	if len(arr) == 0 {
@@ -852,9 +2308,10 @@ func checkFieldsWithURIArray(arr []string) error {
 	return edvutils.CheckIfArrayIsURI(arr)
 }
 
-func validateEncryptedDocument(doc models.EncryptedDocument) error {
-	if encodingErr := edvutils.CheckIfBase58Encoded128BitValue(doc.ID); encodingErr != nil {
-		return encodingErr
+// validateEncryptedDocument checks the document's ID with the provider's document ID policy, and its JWE.
+func (c *Operation) validateEncryptedDocument(doc models.EncryptedDocument) error {
+	if err := c.vaultCollection.provider.ValidateDocumentID(doc.ID); err != nil {
+		return err
 	}
 
 	if err := edvutils.ValidateJWE(doc.JWE); err != nil {
@@ -864,6 +2321,153 @@ func validateEncryptedDocument(doc models.EncryptedDocument) error {
 	return nil
 }
 
+// queryDeadline returns the time by which a query must stop fetching matching documents, based on the configured
+// latency budget and the request's latency budget header. The header can only lower the configured latency budget,
+// so a header of 0 or one above the configured latency budget is ignored if there is one. A zero time means there's
+// no deadline.
+func (c *Operation) queryDeadline(req *http.Request) (time.Time, error) {
+	latencyBudget := c.queryLatencyBudget
+
+	if latencyBudgetString := req.Header.Get(latencyBudgetHeader); latencyBudgetString != "" {
+		latencyBudgetMillis, err := strconv.ParseUint(latencyBudgetString, 10, 32)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		requestedLatencyBudget := time.Duration(latencyBudgetMillis) * time.Millisecond
+
+		if latencyBudget <= 0 || (requestedLatencyBudget > 0 && requestedLatencyBudget < latencyBudget) {
+			latencyBudget = requestedLatencyBudget
+		}
+	}
+
+	if latencyBudget <= 0 {
+		return time.Time{}, nil
+	}
+
+	return time.Now().Add(latencyBudget), nil
+}
+
+// queryContinuation is the decoded form of a continuation token for a partial query.
+type queryContinuation struct {
+	// Query is the digest of the vault ID and the query that the token continues (see queryDigest).
+	Query string `json:"query"`
+	// After is the ID of the last document that the query got to.
+	After string `json:"after"`
+}
+
+func createContinuationToken(vaultID string, query *models.Query, after string) string {
+	continuation := queryContinuation{Query: queryDigest(vaultID, query), After: after}
+
+	// Marshalling a struct of strings can't fail.
+	continuationBytes, _ := json.Marshal(continuation) //nolint: errcheck
+
+	return base64.RawURLEncoding.EncodeToString(continuationBytes)
+}
+
+// parseContinuationToken returns the ID of the document after which to continue the given query in the given vault,
+// or an empty string if token is empty. Tokens created for a different vault or query are rejected.
+func parseContinuationToken(token, vaultID string, query *models.Query) (string, error) {
+	if token == "" {
+		return "", nil
+	}
+
+	continuationBytes, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode continuation token: %w", err)
+	}
+
+	var continuation queryContinuation
+
+	err = json.Unmarshal(continuationBytes, &continuation)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal continuation token: %w", err)
+	}
+
+	if continuation.Query != queryDigest(vaultID, query) || continuation.After == "" {
+		return "", errors.New("continuation token isn't for this query")
+	}
+
+	return continuation.After, nil
+}
+
+// queryDigest returns a base64url-encoded SHA-256 digest of the given vault ID and all the fields of the given query.
+func queryDigest(vaultID string, query *models.Query) string {
+	// Marshalling a query can't fail, since its operand is validated when the query is unmarshalled.
+	queryBytes, _ := json.Marshal(query) //nolint: errcheck
+
+	digest := sha256.Sum256(append([]byte(vaultID+"\n"), queryBytes...))
+
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
+
+// parseListDocumentsParameters parses the afterSequence, afterId and limit query parameters of a request to list
+// the documents in a vault. afterSequence is nil if it isn't given, and limit is 0.
+func parseListDocumentsParameters(values url.Values) (*uint64, string, int, error) {
+	var afterSequence *uint64
+
+	if afterSequenceString := values.Get("afterSequence"); afterSequenceString != "" {
+		sequence, err := strconv.ParseUint(afterSequenceString, 10, 64)
+		if err != nil {
+			return nil, "", 0, fmt.Errorf("invalid afterSequence: %w", err)
+		}
+
+		afterSequence = &sequence
+	}
+
+	afterID := values.Get("afterId")
+	if afterID != "" && afterSequence == nil {
+		return nil, "", 0, errors.New("afterId can only be given along with afterSequence")
+	}
+
+	var limit int
+
+	if limitString := values.Get("limit"); limitString != "" {
+		parsedLimit, err := strconv.ParseUint(limitString, 10, 31)
+		if err != nil || parsedLimit == 0 {
+			return nil, "", 0, fmt.Errorf("invalid limit %s: must be a positive integer", limitString)
+		}
+
+		limit = int(parsedLimit)
+	}
+
+	return afterSequence, afterID, limit, nil
+}
+
+// documentRevision selects a past revision of a document, either by its sequence or by the time at which it was the
+// current one.
+type documentRevision struct {
+	sequence *uint64
+	asOf     time.Time
+}
+
+// parseReadDocumentParameters returns the revision selected by the version or asOf query parameter of a read
+// document request, or nil if the current version of the document is to be read.
+func parseReadDocumentParameters(values url.Values) (*documentRevision, error) {
+	versionString, asOfString := values.Get("version"), values.Get("asOf")
+
+	switch {
+	case versionString != "" && asOfString != "":
+		return nil, errors.New("only one of version and asOf can be given")
+	case versionString != "":
+		sequence, err := strconv.ParseUint(versionString, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version: %w", err)
+		}
+
+		return &documentRevision{sequence: &sequence}, nil
+	case asOfString != "":
+		asOf, err := time.Parse(time.RFC3339, asOfString)
+		if err != nil {
+			return nil, fmt.Errorf("invalid asOf: %w", err)
+		}
+
+		return &documentRevision{asOf: asOf}, nil
+	default:
+		return nil, nil
+	}
+}
+
 func parseQuery(requestBody []byte) (models.Query, error) {
 	var incomingQuery models.Query
 
@@ -872,20 +2476,56 @@ func parseQuery(requestBody []byte) (models.Query, error) {
 		return models.Query{}, fmt.Errorf("failed to unmarshal request body: %w", err)
 	}
 
-	if incomingQuery.Has == "" {
+	err = validateQuery(&incomingQuery)
+	if err != nil {
+		return models.Query{}, err
+	}
+
+	return incomingQuery, nil
+}
+
+func validateQuery(query *models.Query) error {
+	if query.Operator != "" {
+		return validateOperatorQuery(query)
+	}
+
+	if len(query.Operand) > 0 {
+		return errors.New("query operand given without an operator")
+	}
+
+	if query.Has == "" {
 		// See if it's an "index + equals" query instead of a "has" query.
-		if incomingQuery.Name == "" || incomingQuery.Value == "" {
-			return models.Query{}, errors.New("invalid query format")
+		if query.Name == "" || query.Value == "" {
+			return errors.New("invalid query format")
 		}
 
 		// This is a valid "index + equals" query.
-		return incomingQuery, nil
+		return nil
 	}
 
-	if incomingQuery.Name != "" || incomingQuery.Value != "" {
-		return models.Query{}, errors.New(`query cannot be a mix of "index + equals" and "has" formats`)
+	if query.Name != "" || query.Value != "" {
+		return errors.New(`query cannot be a mix of "index + equals" and "has" formats`)
 	}
 
 	// This is a valid "has" query.
-	return incomingQuery, nil
+	return nil
+}
+
+func validateOperatorQuery(query *models.Query) error {
+	if query.Value != "" || query.Has != "" {
+		return errors.New(`query cannot be a mix of "index + operator" and other formats`)
+	}
+
+	if query.Name == "" {
+		return errors.New(`"index + operator" query is missing the index`)
+	}
+
+	// Parsing the operand here means that unknown operators and invalid operands are reported as invalid queries.
+	_, err := edvprovider.ParseQueryOperator(query)
+	if err != nil {
+		return err
+	}
+
+	// This is a valid "index + operator" query.
+	return nil
 }
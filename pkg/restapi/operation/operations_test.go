@@ -8,11 +8,15 @@ package operation
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"strings"
 	"testing"
@@ -25,7 +29,10 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/trustbloc/edge-core/pkg/log"
 	"github.com/trustbloc/edge-core/pkg/log/mocklogger"
+	zcapldcore "github.com/trustbloc/edge-core/pkg/zcapld"
 
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/auth/zcapld"
 	"github.com/trustbloc/edv/pkg/edvprovider"
 	"github.com/trustbloc/edv/pkg/edvutils"
 	"github.com/trustbloc/edv/pkg/restapi/messages"
@@ -34,6 +41,7 @@ import (
 
 const (
 	testReferenceID = "testReferenceID"
+	testTenantID    = "tenant-1"
 	testVaultID     = "Sr7yHjomhn1aeaFnxREfRN"
 	testInvalidURI  = "invalidURI"
 	testValidURI    = "did:example:123456789"
@@ -140,7 +148,7 @@ type failingResponseWriter struct {
 }
 
 func (f failingResponseWriter) Header() http.Header {
-	return nil
+	return http.Header{}
 }
 
 func (f failingResponseWriter) Write([]byte) (int, error) {
@@ -164,16 +172,18 @@ type mockContext struct {
 	valueToReturnWhenValueMethodCalled interface{}
 }
 
+// Deadline, Done and Err behave like those of a context that's never done, since the stores of the vaults check
+// the contexts of the requests that they're opened for.
 func (m mockContext) Deadline() (deadline time.Time, ok bool) {
-	panic("implement me")
+	return time.Time{}, false
 }
 
 func (m mockContext) Done() <-chan struct{} {
-	panic("implement me")
+	return nil
 }
 
 func (m mockContext) Err() error {
-	panic("implement me")
+	return nil
 }
 
 func (m mockContext) Value(interface{}) interface{} {
@@ -204,9 +214,10 @@ func (m *mockProvider) OpenStore(string) (storage.Store, error) {
 	}
 
 	return &mock.Store{
-		ErrDelete:   m.errStoreDelete,
-		ErrBatch:    m.errStoreBatch,
-		QueryReturn: &mock.Iterator{ValueReturn: encryptedDoc1Bytes},
+		ErrDelete:     m.errStoreDelete,
+		ErrBatch:      m.errStoreBatch,
+		GetBulkReturn: [][]byte{nil},
+		QueryReturn:   &mock.Iterator{ValueReturn: encryptedDoc1Bytes},
 	}, nil
 }
 
@@ -313,7 +324,7 @@ func TestCreateDataVault(t *testing.T) {
 		createDataVaultExpectSuccess(t, op)
 
 		rr := httptest.NewRecorder()
-		op.createDataVault(rr, &models.DataVaultConfiguration{ReferenceID: testReferenceID}, "",
+		op.createDataVault(logger, rr, &models.DataVaultConfiguration{ReferenceID: testReferenceID}, "", "",
 			nil)
 		require.Equal(t, http.StatusConflict, rr.Code)
 		require.Equal(t, "Failed to create a new data vault: "+
@@ -321,6 +332,21 @@ func TestCreateDataVault(t *testing.T) {
 			"failed to store data vault configuration in store: an error occurred while querying reference IDs: "+
 			"vault already exists.", rr.Body.String())
 	})
+	t.Run("Controller over its vault limit", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100,
+			edvprovider.WithMaxVaultsPerController(1))})
+
+		createConfigStoreExpectSuccess(t, op)
+
+		createDataVaultExpectSuccess(t, op)
+
+		rr := httptest.NewRecorder()
+		op.createDataVault(logger, rr, &models.DataVaultConfiguration{ReferenceID: "ref", Controller: testValidURI},
+			"", "", nil)
+		require.Equal(t, http.StatusForbidden, rr.Code)
+		require.Contains(t, rr.Body.String(), "vault limit exceeded: controller "+testValidURI+
+			" is limited to 1 vaults")
+	})
 	t.Run("Response writer fails while writing duplicate data vault error", func(t *testing.T) {
 		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
 
@@ -328,8 +354,8 @@ func TestCreateDataVault(t *testing.T) {
 
 		createDataVaultExpectSuccess(t, op)
 
-		op.createDataVault(&failingResponseWriter{},
-			&models.DataVaultConfiguration{ReferenceID: testReferenceID}, "", nil)
+		op.createDataVault(logger, &failingResponseWriter{},
+			&models.DataVaultConfiguration{ReferenceID: testReferenceID}, "", "", nil)
 
 		require.Contains(t, mockLoggerProvider.MockLogger.AllLogContents,
 			fmt.Sprintf(messages.VaultCreationFailure+messages.FailWriteResponse,
@@ -902,7 +928,7 @@ func TestQueryVault(t *testing.T) { // nolint:gocognit,gocyclo // test file
 		encryptedDoc1 := models.EncryptedDocument{ID: mockDocID1}
 		encryptedDoc2 := models.EncryptedDocument{ID: mockDocID2}
 
-		writeQueryResponse(failingResponseWriter{}, []models.EncryptedDocument{encryptedDoc1, encryptedDoc2},
+		writeQueryResponse(logger, failingResponseWriter{}, []models.EncryptedDocument{encryptedDoc1, encryptedDoc2},
 			testVaultID, nil, false, "TestHost")
 
 		require.Contains(t, mockLoggerProvider.MockLogger.AllLogContents,
@@ -912,7 +938,7 @@ func TestQueryVault(t *testing.T) { // nolint:gocognit,gocyclo // test file
 		encryptedDoc1 := models.EncryptedDocument{ID: mockDocID1}
 		encryptedDoc2 := models.EncryptedDocument{ID: mockDocID2}
 
-		writeQueryResponse(failingResponseWriter{}, []models.EncryptedDocument{encryptedDoc1, encryptedDoc2},
+		writeQueryResponse(logger, failingResponseWriter{}, []models.EncryptedDocument{encryptedDoc1, encryptedDoc2},
 			testVaultID, nil, true, "TestHost")
 
 		require.Contains(t, mockLoggerProvider.MockLogger.AllLogContents,
@@ -920,6 +946,367 @@ func TestQueryVault(t *testing.T) { // nolint:gocognit,gocyclo // test file
 	})
 }
 
+func TestQueryVault_PageSize(t *testing.T) {
+	memProvider := mem.NewProvider()
+	provider := &pageSizeRecordingProvider{Provider: memProvider}
+
+	op := New(&Config{Provider: edvprovider.NewProvider(provider, 100)})
+
+	vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+	storeTestDataForQueryTests(t, vaultID, memProvider, "SomeArbitraryValue1", "SomeArbitraryValue2")
+
+	doQuery := func(query string) {
+		req, err := http.NewRequest(http.MethodPost, "", bytes.NewBuffer([]byte(query)))
+		require.NoError(t, err)
+
+		req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID})
+
+		rr := httptest.NewRecorder()
+
+		getHandler(t, op, queryVaultEndpoint, http.MethodPost).Handle().ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	doQuery(testHasQuery)
+
+	vaultPageSize := uint(500)
+
+	_, err := op.updateConfiguration(vaultID, &models.DataVaultConfigurationUpdate{RetrievalPageSize: &vaultPageSize},
+		httptest.NewRequest(http.MethodPatch, configurationEndpoint, nil))
+	require.NoError(t, err)
+
+	doQuery(testHasQuery)
+	doQuery(`{"has": "CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ", "pageSize": 5}`)
+
+	require.Equal(t, []int{100, 500, 5}, provider.pageSizes)
+}
+
+// pageSizeRecordingProvider is a storage provider that records the page size of each query for mapping documents.
+type pageSizeRecordingProvider struct {
+	storage.Provider
+	pageSizes []int
+}
+
+func (p *pageSizeRecordingProvider) OpenStore(name string) (storage.Store, error) {
+	store, err := p.Provider.OpenStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pageSizeRecordingStore{Store: store, provider: p}, nil
+}
+
+type pageSizeRecordingStore struct {
+	storage.Store
+	provider *pageSizeRecordingProvider
+}
+
+func (s *pageSizeRecordingStore) Query(expression string, options ...storage.QueryOption) (storage.Iterator, error) {
+	if strings.HasPrefix(expression, edvprovider.MappingDocumentTagName+":") {
+		queryOptions := &storage.QueryOptions{}
+
+		for _, option := range options {
+			option(queryOptions)
+		}
+
+		s.provider.pageSizes = append(s.provider.pageSizes, queryOptions.PageSize)
+	}
+
+	return s.Store.Query(expression, options...)
+}
+
+func TestQueryVault_LatencyBudget(t *testing.T) {
+	provider := mem.NewProvider()
+
+	// The budget is always exceeded once the first page of documents, which has a single document, has been fetched.
+	op := New(&Config{Provider: edvprovider.NewProvider(provider, 1), QueryLatencyBudget: time.Nanosecond})
+
+	vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+	storeTestDataForQueryTests(t, vaultID, provider, "SomeArbitraryValue1", "SomeArbitraryValue2")
+
+	doQuery := func(query string, headers map[string]string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, "", bytes.NewBuffer([]byte(query)))
+		require.NoError(t, err)
+
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+
+		req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID})
+
+		rr := httptest.NewRecorder()
+
+		getHandler(t, op, queryVaultEndpoint, http.MethodPost).Handle().ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("Partial results are returned with a continuation token", func(t *testing.T) {
+		rr := doQuery(testHasQuery, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "true", rr.Header().Get(partialResultsHeader))
+
+		var docURLs []string
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &docURLs))
+		require.Len(t, docURLs, 1)
+
+		continuationToken := rr.Header().Get(continuationTokenHeader)
+		require.NotEmpty(t, continuationToken)
+
+		rr = doQuery(testHasQuery, map[string]string{continuationTokenHeader: continuationToken})
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Empty(t, rr.Header().Get(partialResultsHeader))
+		require.Empty(t, rr.Header().Get(continuationTokenHeader))
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &docURLs))
+		require.Len(t, docURLs, 1)
+	})
+	t.Run("The latency budget header can't raise the configured latency budget", func(t *testing.T) {
+		for _, latencyBudget := range []string{"0", "60000"} {
+			rr := doQuery(testHasQuery, map[string]string{latencyBudgetHeader: latencyBudget})
+			require.Equal(t, http.StatusOK, rr.Code)
+			require.Equal(t, "true", rr.Header().Get(partialResultsHeader))
+		}
+	})
+	t.Run("The latency budget header can lower the configured latency budget", func(t *testing.T) {
+		unlimitedOp := New(&Config{Provider: edvprovider.NewProvider(provider, 1)})
+
+		req, err := http.NewRequest(http.MethodPost, "", nil)
+		require.NoError(t, err)
+
+		deadline, err := unlimitedOp.queryDeadline(req)
+		require.NoError(t, err)
+		require.True(t, deadline.IsZero())
+
+		req.Header.Set(latencyBudgetHeader, "1000")
+
+		deadline, err = unlimitedOp.queryDeadline(req)
+		require.NoError(t, err)
+		require.WithinDuration(t, time.Now().Add(time.Second), deadline, time.Second)
+
+		limitedOp := New(&Config{Provider: edvprovider.NewProvider(provider, 1), QueryLatencyBudget: time.Hour})
+
+		deadline, err = limitedOp.queryDeadline(req)
+		require.NoError(t, err)
+		require.WithinDuration(t, time.Now().Add(time.Second), deadline, time.Second)
+	})
+	t.Run("Invalid latency budget header", func(t *testing.T) {
+		rr := doQuery(testHasQuery, map[string]string{latencyBudgetHeader: "-1"})
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "the latency budget header is invalid")
+	})
+	t.Run("Invalid continuation token", func(t *testing.T) {
+		t.Run("Not base64url", func(t *testing.T) {
+			rr := doQuery(testHasQuery, map[string]string{continuationTokenHeader: "%%%"})
+			require.Equal(t, http.StatusBadRequest, rr.Code)
+			require.Contains(t, rr.Body.String(), "failed to decode continuation token")
+		})
+		t.Run("Not JSON", func(t *testing.T) {
+			rr := doQuery(testHasQuery, map[string]string{
+				continuationTokenHeader: base64.RawURLEncoding.EncodeToString([]byte("offset")),
+			})
+			require.Equal(t, http.StatusBadRequest, rr.Code)
+			require.Contains(t, rr.Body.String(), "failed to unmarshal continuation token")
+		})
+		t.Run("Token for a different query", func(t *testing.T) {
+			var query models.Query
+
+			require.NoError(t, json.Unmarshal([]byte(testHasQuery), &query))
+
+			for _, tokenQuery := range []struct {
+				vaultID string
+				query   models.Query
+			}{
+				{vaultID: vaultID, query: models.Query{Has: "AnotherIndex"}},
+				{vaultID: vaultID, query: models.Query{Has: query.Has, HMACKeyID: "AnotherHMACKey"}},
+				{vaultID: "AnotherVault", query: query},
+			} {
+				rr := doQuery(testHasQuery, map[string]string{
+					continuationTokenHeader: createContinuationToken(tokenQuery.vaultID, &tokenQuery.query, testDocID),
+				})
+				require.Equal(t, http.StatusBadRequest, rr.Code)
+				require.Contains(t, rr.Body.String(), "continuation token isn't for this query")
+			}
+
+			rr := doQuery(testHasQuery, map[string]string{
+				continuationTokenHeader: createContinuationToken(vaultID, &query, testDocID),
+			})
+			require.Equal(t, http.StatusOK, rr.Code)
+		})
+	})
+}
+
+func TestQueryVault_Count(t *testing.T) {
+	provider := mem.NewProvider()
+
+	op := New(&Config{Provider: edvprovider.NewProvider(provider, 100)})
+
+	vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+	storeTestDataForQueryTests(t, vaultID, provider, "RV58Va4904K-18_L5g_vfARXRWEB00knFSGPpukUBro",
+		"SomeArbitraryValue2")
+
+	t.Run("Count in a query", func(t *testing.T) {
+		for query, count := range map[string]string{
+			`{"has": "CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ", "count": true}`: "2",
+			`{"index": "CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ", ` +
+				`"equals": "RV58Va4904K-18_L5g_vfARXRWEB00knFSGPpukUBro", "count": true}`: "1",
+		} {
+			req, err := http.NewRequest(http.MethodPost, "", bytes.NewBuffer([]byte(query)))
+			require.NoError(t, err)
+
+			req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID})
+
+			rr := httptest.NewRecorder()
+
+			getHandler(t, op, queryVaultEndpoint, http.MethodPost).Handle().ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+			require.Equal(t, count, rr.Header().Get(queryCountHeader))
+			require.JSONEq(t, `{"count": `+count+`}`, rr.Body.String())
+		}
+	})
+	t.Run("Count with a HEAD request", func(t *testing.T) {
+		for query, count := range map[string]string{
+			"?has=CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ":                              "2",
+			"?index=CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ&equals=SomeArbitraryValue2": "1",
+			"?index=CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ&equals=SomeArbitraryValue3": "0",
+		} {
+			rr := doCountQueryCall(t, op, vaultID, query)
+			require.Equal(t, http.StatusOK, rr.Code)
+			require.Equal(t, count, rr.Header().Get(queryCountHeader))
+			require.Empty(t, rr.Body.String())
+		}
+	})
+	t.Run("Invalid query", func(t *testing.T) {
+		rr := doCountQueryCall(t, op, vaultID, "?index=CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ")
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Empty(t, rr.Header().Get(queryCountHeader))
+	})
+	t.Run("Vault does not exist", func(t *testing.T) {
+		rr := doCountQueryCall(t, op, testVaultID, "?has=CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ")
+		require.Equal(t, http.StatusNotFound, rr.Code)
+
+		req, err := http.NewRequest(http.MethodPost, "",
+			bytes.NewBuffer([]byte(`{"has": "CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ", "count": true}`)))
+		require.NoError(t, err)
+
+		req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: testVaultID})
+
+		rr = httptest.NewRecorder()
+
+		getHandler(t, op, queryVaultEndpoint, http.MethodPost).Handle().ServeHTTP(rr, req)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), messages.ErrVaultNotFound.Error())
+	})
+	t.Run("Fail to count", func(t *testing.T) {
+		failingOp := New(&Config{Provider: edvprovider.NewProvider(&mock.Provider{
+			OpenStoreReturn: &mock.Store{ErrQuery: errors.New("query error")},
+		}, 100)})
+
+		rr := doCountQueryCall(t, failingOp, testVaultID, "?has=CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ")
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+// prefixOperator matches attributes whose value starts with the string in its operand.
+type prefixOperator struct{}
+
+func (prefixOperator) Parse(operand json.RawMessage) (edvprovider.QueryMatcher, error) {
+	var prefix string
+
+	err := json.Unmarshal(operand, &prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return prefixMatcher(prefix), nil
+}
+
+type prefixMatcher string
+
+func (m prefixMatcher) Matches(value string) bool {
+	return strings.HasPrefix(value, string(m))
+}
+
+func TestQueryVault_Operator(t *testing.T) {
+	edvprovider.RegisterQueryOperator("testprefix", prefixOperator{})
+
+	provider := mem.NewProvider()
+
+	op := New(&Config{Provider: edvprovider.NewProvider(provider, 100)})
+
+	vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+	storeTestDataForQueryTests(t, vaultID, provider, "RV58Va4904K-18_L5g_vfARXRWEB00knFSGPpukUBro",
+		"SomeArbitraryValue2")
+
+	doQuery := func(query string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, "", bytes.NewBuffer([]byte(query)))
+		require.NoError(t, err)
+
+		req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID})
+
+		rr := httptest.NewRecorder()
+
+		getHandler(t, op, queryVaultEndpoint, http.MethodPost).Handle().ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		rr := doQuery(`{"index": "CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ", "operator": "testprefix", ` +
+			`"operand": "SomeArbitrary"}`)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var docURLs []string
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &docURLs))
+		require.Len(t, docURLs, 1)
+
+		rr = doCountQueryCall(t, op, vaultID,
+			"?index=CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ&operator=testprefix&operand=%22RV58%22")
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "1", rr.Header().Get(queryCountHeader))
+	})
+	t.Run("Invalid queries", func(t *testing.T) {
+		for query, errMsg := range map[string]string{
+			`{"index": "CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ", "operator": "unknown"}`: "unknown query " +
+				"operator: unknown",
+			`{"index": "CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ", "operator": "testprefix", "operand": 1}`: "invalid " +
+				"query operand for operator testprefix",
+			`{"operator": "testprefix", "operand": "Some"}`: `"index + operator" query is missing the index`,
+			`{"has": "CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ", "operator": "testprefix", "operand": "Some"}`: "" +
+				`query cannot be a mix of "index + operator" and other formats`,
+			`{"has": "CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ", "operand": "Some"}`: "query operand given " +
+				"without an operator",
+		} {
+			rr := doQuery(query)
+			require.Equal(t, http.StatusBadRequest, rr.Code)
+			require.Contains(t, rr.Body.String(), errMsg)
+		}
+
+		rr := doCountQueryCall(t, op, vaultID, "?index=CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ&operator=unknown")
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func doCountQueryCall(t *testing.T, op *Operation, vaultID, query string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodHead, query, nil)
+	require.NoError(t, err)
+
+	req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID})
+
+	rr := httptest.NewRecorder()
+
+	getHandler(t, op, queryVaultEndpoint, http.MethodHead).Handle().ServeHTTP(rr, req)
+
+	return rr
+}
+
 func TestCreateDocument(t *testing.T) {
 	t.Run("Success: without prefix", func(t *testing.T) {
 		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
@@ -931,6 +1318,45 @@ func TestCreateDocument(t *testing.T) {
 		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
 		storeEncryptedDocumentExpectSuccess(t, op, testDocID2, testEncryptedDocument2, vaultID)
 	})
+	t.Run("Success: DID URL document ID", func(t *testing.T) {
+		validator, err := edvprovider.DocumentIDPolicyValidator(edvprovider.DIDURLDocumentIDPolicy)
+		require.NoError(t, err)
+
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100,
+			edvprovider.WithDocumentIDValidator(validator))})
+
+		createConfigStoreExpectSuccess(t, op)
+
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		const didURLDocID = "did:example:123#document-1"
+
+		req, err := http.NewRequest(http.MethodPost, "",
+			strings.NewReader(strings.Replace(testEncryptedDocument, testDocID, didURLDocID, 1)))
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		createDocumentEndpointHandler := getHandler(t, op, createDocumentEndpoint, http.MethodPost)
+		createDocumentEndpointHandler.Handle().ServeHTTP(rr,
+			mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID}))
+
+		require.Equal(t, http.StatusCreated, rr.Code)
+		require.Equal(t, "/encrypted-data-vaults/"+vaultID+"/documents/did:example:123%23document-1",
+			rr.Header().Get("Location"))
+
+		req, err = http.NewRequest(http.MethodPost, "", strings.NewReader(testEncryptedDocument))
+		require.NoError(t, err)
+
+		rr = httptest.NewRecorder()
+
+		createDocumentEndpointHandler.Handle().ServeHTTP(rr,
+			mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID}))
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.InvalidDocumentForDocCreation, vaultID, messages.ErrNotDIDURL),
+			rr.Body.String())
+	})
 	t.Run("Invalid encrypted document JSON", func(t *testing.T) {
 		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
 
@@ -955,6 +1381,32 @@ func TestCreateDocument(t *testing.T) {
 		require.Equal(t, fmt.Sprintf(messages.InvalidDocumentForDocCreation, testVaultID, "unexpected end of JSON input"),
 			rr.Body.String())
 	})
+	t.Run("Document is larger than the maximum document size", func(t *testing.T) {
+		op := New(&Config{
+			Provider:        edvprovider.NewProvider(mem.NewProvider(), 100),
+			MaxDocumentSize: uint64(len(testEncryptedDocument)),
+		})
+
+		createConfigStoreExpectSuccess(t, op)
+
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
+
+		req, err := http.NewRequest("POST", "", bytes.NewBuffer([]byte(testEncryptedDocument2+
+			strings.Repeat(" ", len(testEncryptedDocument)))))
+		require.NoError(t, err)
+
+		req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID})
+
+		rr := httptest.NewRecorder()
+
+		getHandler(t, op, createDocumentEndpoint, http.MethodPost).Handle().ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.InvalidDocumentForDocCreation, vaultID,
+			fmt.Sprintf(messages.DocumentTooLarge, len(testEncryptedDocument))), rr.Body.String())
+	})
 	t.Run("Document ID is not base58 encoded", func(t *testing.T) {
 		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
 
@@ -1058,6 +1510,30 @@ func TestCreateDocument(t *testing.T) {
 		require.Equal(t, fmt.Sprintf(messages.CreateDocumentFailure, vaultID, messages.ErrDuplicateDocument),
 			rr.Body.String())
 	})
+	t.Run("Index name+value pair already declared unique by another document", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+
+		createConfigStoreExpectSuccess(t, op)
+
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID, `{"id":"`+testDocID+`","sequence":0,"indexed":`+
+			testIndexedAttributeCollections1+`,"jwe":`+testJWE1+`}`, vaultID)
+
+		req, err := http.NewRequest("POST", "", bytes.NewBuffer([]byte(`{"id":"`+testDocID2+`","sequence":0,`+
+			`"indexed":`+testIndexedAttributeCollections2+`,"jwe":`+testJWE2+`}`)))
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID})
+
+		createDocumentEndpointHandler := getHandler(t, op, createDocumentEndpoint, http.MethodPost)
+		createDocumentEndpointHandler.Handle().ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusConflict, rr.Code)
+		require.Contains(t, rr.Body.String(), string(messages.ErrUniqueIndexConflict))
+	})
 	t.Run("Response writer fails while writing duplicate document error", func(t *testing.T) {
 		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
 
@@ -1067,7 +1543,8 @@ func TestCreateDocument(t *testing.T) {
 
 		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
 
-		op.createDocument(&failingResponseWriter{}, []byte(testEncryptedDocument), "", vaultID)
+		op.createDocument(context.Background(), logger, &failingResponseWriter{}, strings.NewReader(testEncryptedDocument),
+			"", vaultID)
 
 		require.Contains(t, mockLoggerProvider.MockLogger.AllLogContents,
 			fmt.Sprintf(messages.CreateDocumentFailure+messages.FailWriteResponse,
@@ -1157,34 +1634,144 @@ func TestCreateDocument(t *testing.T) {
 				messages.CreateDocumentFailReadRequestBody+messages.FailWriteResponse,
 				testVaultID, errFailingReadCloser, errFailingResponseWriter))
 	})
-}
-
-func TestReadDocument(t *testing.T) {
-	t.Run("Success: without prefix", func(t *testing.T) {
-		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
-
-		createConfigStoreExpectSuccess(t, op)
-
-		readDocumentExpectSuccess(t, op)
-	})
-	t.Run("Vault does not exist", func(t *testing.T) {
-		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+	t.Run("Too many indexed attributes", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100,
+			edvprovider.WithMaxMappingDocuments(1))})
 
 		createConfigStoreExpectSuccess(t, op)
-		storeSampleConfigExpectSuccess(t, op)
 
-		readDocumentEndpointHandler := getHandler(t, op, readDocumentEndpoint, http.MethodGet)
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
 
-		req, err := http.NewRequest(http.MethodGet, "", nil)
+		req, err := http.NewRequest("POST", "", bytes.NewBuffer([]byte(`{"id":"`+testDocID+`","sequence":0,`+
+			`"indexed":[{"sequence":0,"hmac":{"id":"https://example.com/kms/z7BgF536GaR","type":"Sha256HmacKey2019"},`+
+			`"attributes":[{"name":"indexName1","value":"testVal1"},{"name":"indexName2","value":"testVal2"}]}],`+
+			`"jwe":`+testJWE1+`}`)))
 		require.NoError(t, err)
 
-		rr := httptest.NewRecorder()
+		req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID})
 
-		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = testVaultID
-		urlVars[docIDPathVariable] = testDocID
+		rr := httptest.NewRecorder()
 
-		req = mux.SetURLVars(req, urlVars)
+		getHandler(t, op, createDocumentEndpoint, http.MethodPost).Handle().ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+		var response models.MappingDocumentLimitError
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		require.Equal(t, models.MappingDocumentLimitError{
+			Error: models.MappingDocumentLimitErrorCode,
+			Message: fmt.Sprintf(messages.CreateDocumentFailure, vaultID, "document "+testDocID+
+				" declares 2 indexed attributes, but at most 1 are allowed per document"),
+			DocumentID:          testDocID,
+			MappingDocuments:    2,
+			MaxMappingDocuments: 1,
+		}, response)
+	})
+}
+
+func TestReadDocumentRevision(t *testing.T) {
+	readRevision := func(t *testing.T, op *Operation, vaultID, query string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, "/?"+query, nil)
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		getHandler(t, op, readDocumentEndpoint, http.MethodGet).Handle().ServeHTTP(rr,
+			mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID, docIDPathVariable: testDocID}))
+
+		return rr
+	}
+
+	op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100, edvprovider.WithRevisionHistory())})
+
+	createConfigStoreExpectSuccess(t, op)
+
+	vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+	storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
+
+	t.Run("Success: by version", func(t *testing.T) {
+		rr := readRevision(t, op, vaultID, "version=0")
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Contains(t, rr.Body.String(), testDocID)
+		require.Empty(t, rr.Header().Get(eTagHeader))
+	})
+	t.Run("Success: as of a time", func(t *testing.T) {
+		rr := readRevision(t, op, vaultID, "asOf="+url.QueryEscape(time.Now().Add(time.Second).Format(time.RFC3339)))
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Contains(t, rr.Body.String(), testDocID)
+	})
+	t.Run("Revision does not exist", func(t *testing.T) {
+		rr := readRevision(t, op, vaultID, "version=1")
+		require.Equal(t, http.StatusNotFound, rr.Code)
+
+		rr = readRevision(t, op, vaultID, "asOf=2000-01-01T00:00:00Z")
+		require.Equal(t, http.StatusNotFound, rr.Code)
+	})
+	t.Run("Invalid parameters", func(t *testing.T) {
+		rr := readRevision(t, op, vaultID, "version=0&asOf=2000-01-01T00:00:00Z")
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.InvalidReadDocumentParameter, testDocID, vaultID,
+			"only one of version and asOf can be given"), rr.Body.String())
+
+		rr = readRevision(t, op, vaultID, "version=latest")
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "invalid version")
+
+		rr = readRevision(t, op, vaultID, "asOf=yesterday")
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "invalid asOf")
+	})
+	t.Run("Vault does not exist", func(t *testing.T) {
+		rr := readRevision(t, op, testVaultID, "version=0")
+		require.Equal(t, http.StatusNotFound, rr.Code)
+	})
+	t.Run("Revision history isn't enabled", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+
+		createConfigStoreExpectSuccess(t, op)
+
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
+
+		rr := readRevision(t, op, vaultID, "version=0")
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.ReadDocumentFailure, testDocID, vaultID,
+			messages.ErrRevisionHistoryNotEnabled), rr.Body.String())
+	})
+}
+
+func TestReadDocument(t *testing.T) {
+	t.Run("Success: without prefix", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+
+		createConfigStoreExpectSuccess(t, op)
+
+		readDocumentExpectSuccess(t, op)
+	})
+	t.Run("Vault does not exist", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+
+		createConfigStoreExpectSuccess(t, op)
+		storeSampleConfigExpectSuccess(t, op)
+
+		readDocumentEndpointHandler := getHandler(t, op, readDocumentEndpoint, http.MethodGet)
+
+		req, err := http.NewRequest(http.MethodGet, "", nil)
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		urlVars := make(map[string]string)
+		urlVars[vaultIDPathVariable] = testVaultID
+		urlVars[docIDPathVariable] = testDocID
+
+		req = mux.SetURLVars(req, urlVars)
 
 		readDocumentEndpointHandler.Handle().ServeHTTP(rr, req)
 
@@ -1285,7 +1872,7 @@ func TestReadDocument(t *testing.T) {
 
 		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
 
-		request := http.Request{}
+		request := http.Request{URL: &url.URL{}}
 
 		op.readDocumentHandler(failingResponseWriter{},
 			request.WithContext(mockContext{valueToReturnWhenValueMethodCalled: getMapWithVaultIDThatCannotBeEscaped()}))
@@ -1303,7 +1890,7 @@ func TestReadDocument(t *testing.T) {
 
 		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
 
-		request := http.Request{}
+		request := http.Request{URL: &url.URL{}}
 
 		op.readDocumentHandler(failingResponseWriter{},
 			request.WithContext(mockContext{valueToReturnWhenValueMethodCalled: getMapWithDocIDThatCannotBeEscaped()}))
@@ -1338,7 +1925,7 @@ func TestReadDocument(t *testing.T) {
 
 		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
 
-		request := http.Request{}
+		request := http.Request{URL: &url.URL{}}
 
 		op.readDocumentHandler(failingResponseWriter{},
 			request.WithContext(mockContext{valueToReturnWhenValueMethodCalled: getMapWithValidVaultIDAndDocID(vaultID)}))
@@ -1349,11 +1936,129 @@ func TestReadDocument(t *testing.T) {
 	})
 }
 
+func TestCheckDocument(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		createConfigStoreExpectSuccess(t, op)
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		rr := sendDocumentRequestWithIfMatch(t, op, http.MethodHead, readDocumentEndpoint, vaultID, "", nil)
+		require.Equal(t, http.StatusNotFound, rr.Code)
+
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
+
+		rr = sendDocumentRequestWithIfMatch(t, op, http.MethodHead, readDocumentEndpoint, vaultID, "", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Empty(t, rr.Body.String())
+	})
+	t.Run("Deleted document", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100,
+			edvprovider.WithTombstoneRetention(time.Hour))})
+		createConfigStoreExpectSuccess(t, op)
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
+
+		rr := sendDocumentRequestWithIfMatch(t, op, http.MethodDelete, deleteDocumentEndpoint, vaultID, "", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rr = sendDocumentRequestWithIfMatch(t, op, http.MethodHead, readDocumentEndpoint, vaultID, "", nil)
+		require.Equal(t, http.StatusGone, rr.Code)
+		require.Empty(t, rr.Body.String())
+	})
+	t.Run("Vault does not exist", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		createConfigStoreExpectSuccess(t, op)
+
+		rr := sendDocumentRequestWithIfMatch(t, op, http.MethodHead, readDocumentEndpoint, testVaultID, "", nil)
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Empty(t, rr.Body.String())
+	})
+	t.Run("Fail to check document", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(&mock.Provider{
+			OpenStoreReturn: &mock.Store{ErrGetTags: errors.New("get tags error")},
+		}, 100)})
+
+		rr := sendDocumentRequestWithIfMatch(t, op, http.MethodHead, readDocumentEndpoint, testVaultID, "", nil)
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Empty(t, rr.Body.String())
+	})
+}
+
+func TestListDocuments(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		createConfigStoreExpectSuccess(t, op)
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID2, testEncryptedDocument2, vaultID)
+
+		rr := doListDocumentsCall(t, op, vaultID, "")
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+		var list models.DocumentList
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &list))
+		require.Equal(t, models.DocumentList{Documents: []models.DocumentListEntry{
+			{ID: testDocID2, Sequence: 0}, {ID: testDocID, Sequence: 0},
+		}}, list)
+
+		rr = doListDocumentsCall(t, op, vaultID, "?limit=1")
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, `{"documents":[{"id":"`+testDocID2+`","sequence":0}],"more":true}`, rr.Body.String())
+
+		rr = doListDocumentsCall(t, op, vaultID, "?afterSequence=0&afterId="+testDocID2+"&limit=1")
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, `{"documents":[{"id":"`+testDocID+`","sequence":0}],"more":false}`, rr.Body.String())
+
+		rr = doListDocumentsCall(t, op, vaultID, "?afterSequence=0")
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, `{"documents":[],"more":false}`, rr.Body.String())
+	})
+	t.Run("Invalid parameters", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		createConfigStoreExpectSuccess(t, op)
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		for query, expectedError := range map[string]string{
+			"?afterSequence=-1":     "invalid afterSequence",
+			"?afterId=" + testDocID: "afterId can only be given along with afterSequence",
+			"?limit=0":              "invalid limit 0: must be a positive integer",
+			"?limit=ten":            "invalid limit ten: must be a positive integer",
+		} {
+			rr := doListDocumentsCall(t, op, vaultID, query)
+			require.Equal(t, http.StatusBadRequest, rr.Code, query)
+			require.Contains(t, rr.Body.String(), expectedError, query)
+		}
+	})
+	t.Run("Vault does not exist", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		createConfigStoreExpectSuccess(t, op)
+
+		rr := doListDocumentsCall(t, op, testVaultID, "")
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.ListDocumentsFailure, testVaultID, messages.ErrVaultNotFound),
+			rr.Body.String())
+	})
+	t.Run("Fail to query documents", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(&mock.Provider{
+			OpenStoreReturn: &mock.Store{ErrQuery: errors.New("query error")},
+		}, 100)})
+
+		rr := doListDocumentsCall(t, op, testVaultID, "")
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.ListDocumentsFailure, testVaultID,
+			"failed to query encrypted documents: query error"), rr.Body.String())
+	})
+}
+
 func Test_writeReadAllDocumentsSuccess(t *testing.T) {
 	t.Run("Fail to marshal all documents", func(t *testing.T) {
 		rr := httptest.NewRecorder()
 
-		writeReadAllDocumentsSuccess(rr, []json.RawMessage{[]byte("NotValid")}, testVaultID)
+		writeReadAllDocumentsSuccess(logger, rr, []json.RawMessage{[]byte("NotValid")}, testVaultID)
 
 		require.Equal(t, http.StatusInternalServerError, rr.Code)
 		require.Equal(t, fmt.Sprintf(messages.FailToMarshalAllDocuments, testVaultID, "json: error calling "+
@@ -1372,7 +2077,7 @@ func TestUpdateDocument(t *testing.T) {
 			`,` + `"jwe":` + testJWE1 + `}`
 		storeEncryptedDocumentExpectSuccess(t, op, testDocID, originalEncryptedDoc, vaultID)
 
-		newEncryptedDoc := `{"id":"` + testDocID + `","sequence":0,"indexed":` + testIndexedAttributeCollections2 +
+		newEncryptedDoc := `{"id":"` + testDocID + `","sequence":1,"indexed":` + testIndexedAttributeCollections2 +
 			`,` + `"jwe":` + testJWE1 + `}`
 		req, err := http.NewRequest("POST", "", bytes.NewBuffer([]byte(newEncryptedDoc)))
 		require.NoError(t, err)
@@ -1389,12 +2094,75 @@ func TestUpdateDocument(t *testing.T) {
 
 		createDocumentEndpointHandler.Handle().ServeHTTP(rr, req)
 		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, `"1"`, rr.Header().Get(eTagHeader))
 
 		getDocumentEndpointHandler := getHandler(t, op, readDocumentEndpoint, http.MethodGet)
 		getDocumentEndpointHandler.Handle().ServeHTTP(rr, req)
 		require.Equal(t, http.StatusOK, rr.Code)
 		require.Equal(t, newEncryptedDoc, rr.Body.String())
 	})
+	t.Run("Document is larger than the maximum document size", func(t *testing.T) {
+		newEncryptedDoc := `{"id":"` + testDocID + `","sequence":1,"jwe":` + testJWE1 + `}`
+
+		op := New(&Config{
+			Provider:        edvprovider.NewProvider(mem.NewProvider(), 100),
+			MaxDocumentSize: uint64(len(newEncryptedDoc)) - 1,
+		})
+		createConfigStoreExpectSuccess(t, op)
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		rr := sendDocumentRequestWithIfMatch(t, op, http.MethodPost, updateDocumentEndpoint, vaultID, "",
+			[]byte(newEncryptedDoc))
+		require.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.InvalidDocumentForDocUpdate, testDocID, vaultID,
+			fmt.Sprintf(messages.DocumentTooLarge, len(newEncryptedDoc)-1)), rr.Body.String())
+	})
+	t.Run("Success - If-Match header matches current sequence", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		createConfigStoreExpectSuccess(t, op)
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
+
+		rr := sendDocumentRequestWithIfMatch(t, op, http.MethodPost, updateDocumentEndpoint, vaultID, `"0"`,
+			[]byte(`{"id":"`+testDocID+`","sequence":1,"jwe":`+testJWE1+`}`))
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, `"1"`, rr.Header().Get(eTagHeader))
+	})
+	t.Run("Failure - sequence is not one greater than the current sequence", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		createConfigStoreExpectSuccess(t, op)
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
+
+		updateDocumentExpectError(t, op, []byte(testEncryptedDocument), vaultID, testDocID,
+			fmt.Sprintf(messages.UpdateDocumentFailure, testDocID, vaultID,
+				fmt.Errorf(messages.UnexpectedUpdateSequence, messages.ErrDocumentSequenceConflict, 1, 0)),
+			http.StatusConflict)
+	})
+	t.Run("Failure - stale If-Match header", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		createConfigStoreExpectSuccess(t, op)
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
+
+		rr := sendDocumentRequestWithIfMatch(t, op, http.MethodPost, updateDocumentEndpoint, vaultID, `"3"`,
+			[]byte(`{"id":"`+testDocID+`","sequence":1,"jwe":`+testJWE1+`}`))
+		require.Equal(t, http.StatusConflict, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.UpdateDocumentFailure, testDocID, vaultID,
+			fmt.Errorf(messages.StaleIfMatchOnUpdate, messages.ErrDocumentSequenceConflict, 3, 1)), rr.Body.String())
+	})
+	t.Run("Failure - invalid If-Match header", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+
+		rr := sendDocumentRequestWithIfMatch(t, op, http.MethodPost, updateDocumentEndpoint, testVaultID, `"abc"`,
+			[]byte(testEncryptedDocument))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.InvalidIfMatchHeader, testDocID, testVaultID,
+			`ETag "abc" is not a document sequence`), rr.Body.String())
+	})
 	t.Run("Failure - error while unmarshalling incoming document", func(t *testing.T) {
 		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
 		createConfigStoreExpectSuccess(t, op)
@@ -1490,90 +2258,283 @@ func TestUpdateDocument(t *testing.T) {
 		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
 		createConfigStoreExpectSuccess(t, op)
 
-		op.updateDocument(&failingResponseWriter{}, []byte(testEncryptedDocument), testDocID, testVaultID)
+		op.updateDocument(context.Background(), logger, &failingResponseWriter{}, strings.NewReader(testEncryptedDocument),
+			testDocID, testVaultID,
+			nil)
 		require.Contains(t, mockLoggerProvider.MockLogger.AllLogContents, "Failed to update document "+
 			testDocID+" in vault "+testVaultID+": specified vault does not exist.")
 		require.Contains(t, mockLoggerProvider.MockLogger.AllLogContents, errFailingResponseWriter.Error())
 	})
 }
 
-func TestDeleteDocument(t *testing.T) {
-	t.Run("Success", func(t *testing.T) {
-		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
-		createConfigStoreExpectSuccess(t, op)
-		vaultID, _ := createDataVaultExpectSuccess(t, op)
+func TestDeleteDataVault(t *testing.T) {
+	doInvokedDelete := func(op *Operation, vaultID string,
+		invokedCapability *zcapldcore.Capability) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodDelete, "", nil)
+		require.NoError(t, err)
 
-		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
+		if invokedCapability != nil {
+			compressedCapability, errCompress := zcapldcore.CompressZCAP(invokedCapability)
+			require.NoError(t, errCompress)
 
-		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = vaultID
-		urlVars[docIDPathVariable] = testDocID
+			req.Header.Set(zcapldcore.CapabilityInvocationHTTPHeader,
+				fmt.Sprintf(`zcap capability="%s",action="write"`, compressedCapability))
+		}
 
-		req, err := http.NewRequest("DELETE", "", nil)
-		require.NoError(t, err)
+		req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID})
 
 		rr := httptest.NewRecorder()
-		req = mux.SetURLVars(req, urlVars)
 
-		deleteDocumentEndpointHandler := getHandler(t, op, deleteDocumentEndpoint, http.MethodDelete)
-		deleteDocumentEndpointHandler.Handle().ServeHTTP(rr, req)
+		getHandler(t, op, deleteVaultEndpoint, http.MethodDelete).Handle().ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	rootCapability := &zcapldcore.Capability{ID: "urn:uuid:root", Controller: "did:example:controller"}
+
+	doDelete := func(op *Operation, vaultID string) *httptest.ResponseRecorder {
+		return doInvokedDelete(op, vaultID, rootCapability)
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		authService := &mockAuthService{}
+		notifier := &mockNotifier{}
+
+		op := New(&Config{
+			Provider: edvprovider.NewProvider(mem.NewProvider(), 100), AuthEnable: true, AuthService: authService,
+			EnabledExtensions: &EnabledExtensions{Notifications: true}, Notifier: notifier,
+		})
+
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		err := op.vaultCollection.provider.UpdateVaultWebhooks(vaultID,
+			&models.VaultWebhooks{Endpoints: []string{"https://example.com/webhook"}})
+		require.NoError(t, err)
+
+		rr := doDelete(op, vaultID)
 		require.Equal(t, http.StatusOK, rr.Code)
 
-		req, err = http.NewRequest("GET", "", nil)
+		exists, err := op.vaultCollection.provider.StoreExists(vaultID)
 		require.NoError(t, err)
+		require.False(t, exists)
 
-		rr = httptest.NewRecorder()
-		req = mux.SetURLVars(req, urlVars)
+		require.Equal(t, []string{vaultID}, authService.deletedResources)
 
-		getDocumentEndpointHandler := getHandler(t, op, readDocumentEndpoint, http.MethodGet)
-		getDocumentEndpointHandler.Handle().ServeHTTP(rr, req)
+		// The webhooks were in the vault's configuration, which was deleted along with the vault.
+		_, err = op.vaultCollection.provider.VaultWebhooks(vaultID)
+		require.True(t, errors.Is(err, messages.ErrVaultNotFound))
+
+		rr = doDelete(op, vaultID)
 		require.Equal(t, http.StatusNotFound, rr.Code)
-		require.Equal(t, fmt.Sprintf(messages.ReadDocumentFailure, testDocID, vaultID, messages.ErrDocumentNotFound),
-			rr.Body.String())
-	})
-	t.Run("Failure - unable to escape vault ID path variable", func(t *testing.T) {
-		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
-		deleteDocumentExpectError(t, op, "%", testDocID, fmt.Sprintf(messages.UnescapeFailure,
-			vaultIDPathVariable, `invalid URL escape "%"`), http.StatusBadRequest)
 	})
-	t.Run("Failure - unable to escape doc ID path variable", func(t *testing.T) {
-		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
-		deleteDocumentExpectError(t, op, testVaultID, "%", fmt.Sprintf(messages.UnescapeFailure,
-			docIDPathVariable, `invalid URL escape "%"`), http.StatusBadRequest)
-	})
-	t.Run("Failure - vault does not exist", func(t *testing.T) {
-		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
-		createConfigStoreExpectSuccess(t, op)
+	t.Run("Failure to delete capabilities is only logged", func(t *testing.T) {
+		op := New(&Config{
+			Provider: edvprovider.NewProvider(mem.NewProvider(), 100), AuthEnable: true,
+			AuthService: &mockAuthService{deleteErr: errors.New("delete capabilities failure")},
+		})
 
-		deleteDocumentExpectError(t, op, testVaultID, testDocID, fmt.Sprintf(messages.DeleteDocumentFailure, testDocID,
-			testVaultID, messages.ErrVaultNotFound), http.StatusNotFound)
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		rr := doDelete(op, vaultID)
+		require.Equal(t, http.StatusOK, rr.Code)
 	})
-	t.Run("Failure - other error while opening store", func(t *testing.T) {
-		provider := &mockProvider{
-			numTimesOpenStoreCalledBeforeErr: 3,
-			errOpenStore:                     errors.New("test error"),
-		}
+	t.Run("Request that doesn't invoke a capability", func(t *testing.T) {
+		authService := &mockAuthService{}
 
-		op := New(&Config{Provider: edvprovider.NewProvider(provider, 100)})
+		op := New(&Config{
+			Provider: edvprovider.NewProvider(mem.NewProvider(), 100), AuthEnable: true, AuthService: authService,
+		})
 
-		createConfigStoreExpectSuccess(t, op)
 		vaultID, _ := createDataVaultExpectSuccess(t, op)
 
-		provider.storeExistsReturn = true
+		rr := doInvokedDelete(op, vaultID, nil)
+		require.Equal(t, http.StatusForbidden, rr.Code)
+		require.Contains(t, rr.Body.String(), "a vault can only be deleted by invoking a capability of its controller")
 
-		deleteDocumentExpectError(t, op, vaultID, testDocID, fmt.Sprintf(messages.DeleteDocumentFailure, testDocID,
-			vaultID, "test error"), http.StatusBadRequest)
+		exists, err := op.vaultCollection.provider.StoreExists(vaultID)
+		require.NoError(t, err)
+		require.True(t, exists)
+		require.Empty(t, authService.deletedResources)
 	})
-	t.Run("Failure - document does not exist", func(t *testing.T) {
-		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
-		createConfigStoreExpectSuccess(t, op)
+	t.Run("Request authorized by a bearer token", func(t *testing.T) {
+		op := New(&Config{
+			Provider: edvprovider.NewProvider(mem.NewProvider(), 100), AuthEnable: true,
+			AuthService: &mockAuthService{},
+		})
+
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		compressedCapability, err := zcapldcore.CompressZCAP(rootCapability)
+		require.NoError(t, err)
+
+		req, err := http.NewRequest(http.MethodDelete, "", nil)
+		require.NoError(t, err)
+
+		req.Header.Set(zcapldcore.CapabilityInvocationHTTPHeader,
+			fmt.Sprintf(`zcap capability="%s",action="write"`, compressedCapability))
+		req.Header.Set("Authorization", "Bearer token")
+
+		req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID})
+
+		rr := httptest.NewRecorder()
+
+		getHandler(t, op, deleteVaultEndpoint, http.MethodDelete).Handle().ServeHTTP(rr, req)
+		require.Equal(t, http.StatusForbidden, rr.Code)
+	})
+	t.Run("Invoked capability isn't the controller's", func(t *testing.T) {
+		op := New(&Config{
+			Provider: edvprovider.NewProvider(mem.NewProvider(), 100), AuthEnable: true,
+			AuthService: &mockAuthService{authorityErr: fmt.Errorf("%w: delegated capability",
+				zcapld.ErrActionNotAllowed)},
+		})
+
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		rr := doDelete(op, vaultID)
+		require.Equal(t, http.StatusForbidden, rr.Code)
+		require.Contains(t, rr.Body.String(), "delegated capability")
+
+		exists, err := op.vaultCollection.provider.StoreExists(vaultID)
+		require.NoError(t, err)
+		require.True(t, exists)
+	})
+	t.Run("Vault not found", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+
+		rr := doDelete(op, testVaultID)
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Contains(t, rr.Body.String(), messages.ErrVaultNotFound.Error())
+	})
+	t.Run("Fail to determine whether vault exists", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(&mock.Provider{
+			ErrGetStoreConfig: errors.New("get store config failure"),
+		}, 100)})
+
+		rr := doDelete(op, testVaultID)
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Contains(t, rr.Body.String(), "get store config failure")
+	})
+	t.Run("Vault ID can't be unescaped", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+
+		rr := doDelete(op, "%")
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestDeleteDocument(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		createConfigStoreExpectSuccess(t, op)
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
+
+		urlVars := make(map[string]string)
+		urlVars[vaultIDPathVariable] = vaultID
+		urlVars[docIDPathVariable] = testDocID
+
+		req, err := http.NewRequest("DELETE", "", nil)
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		req = mux.SetURLVars(req, urlVars)
+
+		deleteDocumentEndpointHandler := getHandler(t, op, deleteDocumentEndpoint, http.MethodDelete)
+		deleteDocumentEndpointHandler.Handle().ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		req, err = http.NewRequest("GET", "", nil)
+		require.NoError(t, err)
+
+		rr = httptest.NewRecorder()
+		req = mux.SetURLVars(req, urlVars)
+
+		getDocumentEndpointHandler := getHandler(t, op, readDocumentEndpoint, http.MethodGet)
+		getDocumentEndpointHandler.Handle().ServeHTTP(rr, req)
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.ReadDocumentFailure, testDocID, vaultID, messages.ErrDocumentNotFound),
+			rr.Body.String())
+	})
+	t.Run("Success - If-Match header matches current sequence", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		createConfigStoreExpectSuccess(t, op)
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
+
+		rr := sendDocumentRequestWithIfMatch(t, op, http.MethodDelete, deleteDocumentEndpoint, vaultID, `"0"`, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rr = sendDocumentRequestWithIfMatch(t, op, http.MethodGet, readDocumentEndpoint, vaultID, "", nil)
+		require.Equal(t, http.StatusNotFound, rr.Code)
+	})
+	t.Run("Failure - stale If-Match header", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		createConfigStoreExpectSuccess(t, op)
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
+
+		rr := sendDocumentRequestWithIfMatch(t, op, http.MethodDelete, deleteDocumentEndpoint, vaultID, `"2"`, nil)
+		require.Equal(t, http.StatusConflict, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.DeleteDocumentFailure, testDocID, vaultID,
+			fmt.Errorf(messages.UnexpectedDeleteSequence, messages.ErrDocumentSequenceConflict, 0, 2)), rr.Body.String())
+
+		rr = sendDocumentRequestWithIfMatch(t, op, http.MethodGet, readDocumentEndpoint, vaultID, "", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+	t.Run("Failure - invalid If-Match header", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+
+		rr := sendDocumentRequestWithIfMatch(t, op, http.MethodDelete, deleteDocumentEndpoint, testVaultID, "0", nil)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.InvalidIfMatchHeader, testDocID, testVaultID,
+			"0 is not a quoted ETag"), rr.Body.String())
+	})
+	t.Run("Failure - unable to escape vault ID path variable", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		deleteDocumentExpectError(t, op, "%", testDocID, fmt.Sprintf(messages.UnescapeFailure,
+			vaultIDPathVariable, `invalid URL escape "%"`), http.StatusBadRequest)
+	})
+	t.Run("Failure - unable to escape doc ID path variable", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		deleteDocumentExpectError(t, op, testVaultID, "%", fmt.Sprintf(messages.UnescapeFailure,
+			docIDPathVariable, `invalid URL escape "%"`), http.StatusBadRequest)
+	})
+	t.Run("Failure - vault does not exist", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		createConfigStoreExpectSuccess(t, op)
+
+		deleteDocumentExpectError(t, op, testVaultID, testDocID, fmt.Sprintf(messages.DeleteDocumentFailure, testDocID,
+			testVaultID, messages.ErrVaultNotFound), http.StatusNotFound)
+	})
+	t.Run("Failure - other error while opening store", func(t *testing.T) {
+		provider := &mockProvider{
+			numTimesOpenStoreCalledBeforeErr: 3,
+			errOpenStore:                     errors.New("test error"),
+		}
+
+		op := New(&Config{Provider: edvprovider.NewProvider(provider, 100)})
+
+		createConfigStoreExpectSuccess(t, op)
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		provider.storeExistsReturn = true
+
+		deleteDocumentExpectError(t, op, vaultID, testDocID, fmt.Sprintf(messages.DeleteDocumentFailure, testDocID,
+			vaultID, "test error"), http.StatusBadRequest)
+	})
+	t.Run("Failure - document does not exist", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		createConfigStoreExpectSuccess(t, op)
 		vaultID, _ := createDataVaultExpectSuccess(t, op)
 
 		deleteDocumentExpectError(t, op, vaultID, testDocID, fmt.Sprintf(messages.DeleteDocumentFailure, testDocID,
 			vaultID, messages.ErrDocumentNotFound), http.StatusNotFound)
 	})
 	t.Run("Response writer fails while writing delete document failure", func(t *testing.T) {
-		writeDeleteDocumentFailure(failingResponseWriter{}, errors.New("test error"), testDocID, testVaultID)
+		writeDeleteDocumentFailure(logger, failingResponseWriter{}, errors.New("test error"), testDocID, testVaultID)
 
 		require.Contains(t, mockLoggerProvider.MockLogger.AllLogContents,
 			fmt.Sprintf(messages.DeleteDocumentFailure+messages.FailWriteResponse, testDocID, testVaultID, "test error",
@@ -1581,6 +2542,77 @@ func TestDeleteDocument(t *testing.T) {
 	})
 }
 
+func TestRestoreDocument(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100,
+			edvprovider.WithTombstoneRetention(time.Hour))})
+		createConfigStoreExpectSuccess(t, op)
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
+
+		rr := sendDocumentRequestWithIfMatch(t, op, http.MethodDelete, deleteDocumentEndpoint, vaultID, "", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rr = sendDocumentRequestWithIfMatch(t, op, http.MethodGet, readDocumentEndpoint, vaultID, "", nil)
+		require.Equal(t, http.StatusGone, rr.Code)
+
+		var tombstone models.Tombstone
+
+		err := json.Unmarshal(rr.Body.Bytes(), &tombstone)
+		require.NoError(t, err)
+		require.Equal(t, testDocID, tombstone.ID)
+		require.NotContains(t, rr.Body.String(), "jwe")
+
+		rr = sendDocumentRequestWithIfMatch(t, op, http.MethodPost, restoreDocumentEndpoint, vaultID, "", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, `"0"`, rr.Header().Get(eTagHeader))
+
+		rr = sendDocumentRequestWithIfMatch(t, op, http.MethodGet, readDocumentEndpoint, vaultID, "", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+	t.Run("Failure - no tombstone", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		createConfigStoreExpectSuccess(t, op)
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
+
+		rr := sendDocumentRequestWithIfMatch(t, op, http.MethodDelete, deleteDocumentEndpoint, vaultID, "", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rr = sendDocumentRequestWithIfMatch(t, op, http.MethodPost, restoreDocumentEndpoint, vaultID, "", nil)
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.RestoreDocumentFailure, testDocID, vaultID,
+			messages.ErrDocumentNotFound), rr.Body.String())
+	})
+	t.Run("Failure - document already exists", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100,
+			edvprovider.WithTombstoneRetention(time.Hour))})
+		createConfigStoreExpectSuccess(t, op)
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
+
+		rr := sendDocumentRequestWithIfMatch(t, op, http.MethodDelete, deleteDocumentEndpoint, vaultID, "", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
+
+		rr = sendDocumentRequestWithIfMatch(t, op, http.MethodPost, restoreDocumentEndpoint, vaultID, "", nil)
+		require.Equal(t, http.StatusConflict, rr.Code)
+	})
+	t.Run("Failure - vault does not exist", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		createConfigStoreExpectSuccess(t, op)
+
+		rr := sendDocumentRequestWithIfMatch(t, op, http.MethodPost, restoreDocumentEndpoint, testVaultID, "", nil)
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.RestoreDocumentFailure, testDocID, testVaultID,
+			messages.ErrVaultNotFound), rr.Body.String())
+	})
+}
+
 func TestBatch(t *testing.T) {
 	upsertNewDoc1 := models.VaultOperation{
 		Operation:         models.UpsertDocumentVaultOperation,
@@ -1594,7 +2626,7 @@ func TestBatch(t *testing.T) {
 
 	upsertExistingDoc1 := models.VaultOperation{
 		Operation:         models.UpsertDocumentVaultOperation,
-		EncryptedDocument: models.EncryptedDocument{ID: testDocID2, JWE: []byte(testJWE1)},
+		EncryptedDocument: models.EncryptedDocument{ID: testDocID2, Sequence: 1, JWE: []byte(testJWE1)},
 	}
 
 	deleteExistingDoc1 := models.VaultOperation{
@@ -1670,102 +2702,914 @@ func TestBatch(t *testing.T) {
 			EnabledExtensions: &EnabledExtensions{Batch: true},
 		})
 
-		req, err := http.NewRequest("POST", "", bytes.NewBuffer([]byte("")))
-		require.NoError(t, err)
+		req, err := http.NewRequest("POST", "", bytes.NewBuffer([]byte("")))
+		require.NoError(t, err)
+
+		urlVars := make(map[string]string)
+		urlVars[vaultIDPathVariable] = "%"
+
+		req = mux.SetURLVars(req, urlVars)
+
+		rr := httptest.NewRecorder()
+
+		batchEndpointHandler := getHandler(t, op, batchEndpoint, http.MethodPost)
+		batchEndpointHandler.Handle().ServeHTTP(rr, req)
+
+		require.Equal(t,
+			fmt.Sprintf(messages.UnescapeFailure, vaultIDPathVariable, `invalid URL escape "%"`),
+			rr.Body.String())
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+	t.Run("Failure: unable to marshal request", func(t *testing.T) {
+		op := New(&Config{
+			Provider:          edvprovider.NewProvider(mem.NewProvider(), 100),
+			EnabledExtensions: &EnabledExtensions{Batch: true},
+		})
+
+		req, err := http.NewRequest("POST", "", bytes.NewBuffer([]byte("Incorrect format")))
+		require.NoError(t, err)
+
+		urlVars := make(map[string]string)
+		urlVars[vaultIDPathVariable] = testVaultID
+
+		req = mux.SetURLVars(req, urlVars)
+
+		rr := httptest.NewRecorder()
+
+		batchEndpointHandler := getHandler(t, op, batchEndpoint, http.MethodPost)
+		batchEndpointHandler.Handle().ServeHTTP(rr, req)
+
+		require.Equal(t,
+			fmt.Sprintf(messages.InvalidBatch, testVaultID,
+				"invalid character 'I' looking for beginning of value"),
+			rr.Body.String())
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+	t.Run("Failure: delete with a missing document ID", func(t *testing.T) {
+		rr, _ := doBatchCall(t, &models.Batch{
+			deleteMissingDocumentID,
+		}, mem.NewProvider())
+
+		require.Equal(t, `["document ID cannot be empty for a delete operation"]`,
+			rr.Body.String())
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+	t.Run("Failure: unable to upsert document in underlying storage provider", func(t *testing.T) {
+		errTestBatch := errors.New("batch error")
+		rr, _ := doBatchCall(t, &models.Batch{upsertNewDoc1}, &mockProvider{
+			numTimesOpenStoreCalledBeforeErr: 4,
+			errStoreBatch:                    errTestBatch,
+		})
+
+		require.Equal(t, `["failed to store encrypted document(s) and their associated mapping `+
+			`document(s): batch error"]`,
+			rr.Body.String())
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+	t.Run("Failure: only part of the upserts could be stored after retrying", func(t *testing.T) {
+		edvProvider := edvprovider.NewProvider(&failingBatchKeyProvider{Provider: mem.NewProvider(),
+			failingKey: testDocID2}, 100, edvprovider.WithBatchRetry(1, time.Millisecond))
+
+		rr, vaultID := doBatchCallWithEDVProvider(t, &models.Batch{upsertNewDoc1, upsertNewDoc2}, edvProvider, nil,
+			func() {})
+
+		require.Equal(t, `["/encrypted-data-vaults/`+vaultID+`/documents/`+testDocID+`",`+
+			`"failed to store encrypted document(s) and their associated mapping document(s): `+
+			`failed to store documents `+testDocID2+`: batch error: unexpected EOF"]`,
+			rr.Body.String())
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+	t.Run("Failure: unable to delete document in underlying storage provider", func(t *testing.T) {
+		errTestDelete := errors.New("delete error")
+		rr, _ := doBatchCall(t, &models.Batch{deleteExistingDoc1}, &mockProvider{
+			numTimesOpenStoreCalledBeforeErr: 4,
+			errStoreDelete:                   errTestDelete,
+		})
+
+		require.Equal(t, `["`+errTestDelete.Error()+`"]`,
+			rr.Body.String())
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestBatchLimits(t *testing.T) {
+	upsertNewDoc1 := models.VaultOperation{
+		Operation:         models.UpsertDocumentVaultOperation,
+		EncryptedDocument: models.EncryptedDocument{ID: testDocID, JWE: []byte(testJWE1)},
+	}
+
+	upsertNewDoc2 := models.VaultOperation{
+		Operation:         models.UpsertDocumentVaultOperation,
+		EncryptedDocument: models.EncryptedDocument{ID: testDocID2, JWE: []byte(testJWE2)},
+	}
+
+	t.Run("Success: batch is within all limits", func(t *testing.T) {
+		rr, _ := doBatchCallWithLimits(t, &models.Batch{upsertNewDoc1, upsertNewDoc2}, mem.NewProvider(),
+			&BatchLimits{MaxOperations: 2, MaxBytes: 10000, MaxConcurrentBatches: 1})
+
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+	t.Run("Failure: too many operations", func(t *testing.T) {
+		rr, vaultID := doBatchCallWithLimits(t, &models.Batch{upsertNewDoc1, upsertNewDoc2}, mem.NewProvider(),
+			&BatchLimits{MaxOperations: 1})
+
+		require.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.BatchRejected, vaultID,
+			fmt.Sprintf(messages.BatchTooManyOperations, 2, 1)), rr.Body.String())
+	})
+	t.Run("Failure: too many bytes", func(t *testing.T) {
+		rr, vaultID := doBatchCallWithLimits(t, &models.Batch{upsertNewDoc1, upsertNewDoc2}, mem.NewProvider(),
+			&BatchLimits{MaxBytes: 10})
+
+		require.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.BatchRejected, vaultID,
+			fmt.Sprintf(messages.BatchTooLargeUnknownSize, 10)), rr.Body.String())
+	})
+	t.Run("Failure: document is too large", func(t *testing.T) {
+		op := New(&Config{
+			Provider:          edvprovider.NewProvider(mem.NewProvider(), 100),
+			EnabledExtensions: &EnabledExtensions{Batch: true},
+			MaxDocumentSize:   100,
+		})
+
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		batchBytes, err := json.Marshal(models.Batch{upsertNewDoc1})
+		require.NoError(t, err)
+
+		req, err := http.NewRequest(http.MethodPost, "", bytes.NewBuffer(batchBytes))
+		require.NoError(t, err)
+
+		req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID})
+
+		rr := httptest.NewRecorder()
+
+		getHandler(t, op, batchEndpoint, http.MethodPost).Handle().ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+		require.Contains(t, rr.Body.String(), "operation 0 has a document of")
+		require.Contains(t, rr.Body.String(), "which exceeds the maximum of 100 bytes")
+	})
+	t.Run("Failure: server is at batch capacity", func(t *testing.T) {
+		op := New(&Config{
+			Provider:          edvprovider.NewProvider(mem.NewProvider(), 100),
+			EnabledExtensions: &EnabledExtensions{Batch: true},
+			BatchLimits:       &BatchLimits{MaxConcurrentBatches: 1},
+		})
+
+		require.True(t, op.acquireBatchSlot())
+		require.False(t, op.acquireBatchSlot())
+
+		req, err := http.NewRequest(http.MethodPost, "", bytes.NewBuffer([]byte("[]")))
+		require.NoError(t, err)
+
+		req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: testVaultID})
+
+		rr := httptest.NewRecorder()
+
+		getHandler(t, op, batchEndpoint, http.MethodPost).Handle().ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.BatchRejected, testVaultID,
+			fmt.Sprintf(messages.ServerAtBatchCapacity, 1)), rr.Body.String())
+
+		op.releaseBatchSlot()
+		require.True(t, op.acquireBatchSlot())
+	})
+}
+
+func TestBatchCapacity(t *testing.T) {
+	t.Run("Success: batch would be accepted", func(t *testing.T) {
+		rr := doBatchCapacityCall(t, &BatchLimits{MaxOperations: 10, MaxBytes: 1000, MaxConcurrentBatches: 5},
+			`{"operations":10,"totalBytes":1000}`, true)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var result models.BatchCapacityCheckResult
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+		require.True(t, result.Accepted)
+		require.Empty(t, result.Reasons)
+		require.Equal(t, uint(10), result.MaxOperations)
+		require.Equal(t, uint64(1000), result.MaxBytes)
+		require.Equal(t, uint(5), result.MaxConcurrentBatches)
+		require.Equal(t, uint(0), result.CurrentBatches)
+	})
+	t.Run("Success: no limits set", func(t *testing.T) {
+		rr := doBatchCapacityCall(t, nil, `{"operations":100000,"totalBytes":100000000}`, true)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var result models.BatchCapacityCheckResult
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+		require.True(t, result.Accepted)
+	})
+	t.Run("Success: batch would be rejected", func(t *testing.T) {
+		rr := doBatchCapacityCall(t, &BatchLimits{MaxOperations: 10, MaxBytes: 1000},
+			`{"operations":11,"totalBytes":1001}`, true)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var result models.BatchCapacityCheckResult
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+		require.False(t, result.Accepted)
+		require.Equal(t, []string{
+			fmt.Sprintf(messages.BatchTooManyOperations, 11, 10),
+			fmt.Sprintf(messages.BatchTooLarge, 1001, 1000),
+		}, result.Reasons)
+	})
+	t.Run("Success: server is at batch capacity", func(t *testing.T) {
+		op := New(&Config{
+			Provider:          edvprovider.NewProvider(mem.NewProvider(), 100),
+			EnabledExtensions: &EnabledExtensions{Batch: true},
+			BatchLimits:       &BatchLimits{MaxConcurrentBatches: 1},
+		})
+
+		require.True(t, op.acquireBatchSlot())
+
+		result, err := op.checkBatchCapacity(httptest.NewRequest(http.MethodPost, "/", nil), testVaultID,
+			&models.BatchCapacityCheck{NumOperations: 1})
+		require.NoError(t, err)
+		require.False(t, result.Accepted)
+		require.Equal(t, []string{fmt.Sprintf(messages.ServerAtBatchCapacity, 1)}, result.Reasons)
+		require.Equal(t, uint(1), result.CurrentBatches)
+	})
+	t.Run("Success: document would be too large", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100), MaxDocumentSize: 100})
+
+		result, err := op.checkBatchCapacity(httptest.NewRequest(http.MethodPost, "/", nil), testVaultID,
+			&models.BatchCapacityCheck{NumOperations: 1, LargestDocumentBytes: 101})
+		require.NoError(t, err)
+		require.False(t, result.Accepted)
+		require.Equal(t, []string{fmt.Sprintf(messages.BatchCheckDocumentTooLarge, 101, 100)}, result.Reasons)
+	})
+	t.Run("Success: batch would take the tenant over its quotas", func(t *testing.T) {
+		op, token := newMultiTenantOperation(t, models.TenantQuotas{MaxDocuments: 3, MaxBytes: 100000})
+
+		vaultID := getVaultIDFromURL(
+			createTenantDataVault(t, op, testDataVaultConfiguration, token).Header().Get("Location"))
+
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
+
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+
+		result, err := op.checkBatchCapacity(req, vaultID, &models.BatchCapacityCheck{NumOperations: 2})
+		require.NoError(t, err)
+		require.True(t, result.Accepted)
+
+		result, err = op.checkBatchCapacity(req, vaultID,
+			&models.BatchCapacityCheck{NumOperations: 3, TotalBytes: 100000})
+		require.NoError(t, err)
+		require.False(t, result.Accepted)
+		require.Len(t, result.Reasons, 2)
+		require.Equal(t, fmt.Sprintf(messages.BatchOverTenantDocumentQuota, 3, testTenantID, 2), result.Reasons[0])
+		require.Regexp(t, `^batch could store 100000 more bytes, but tenant tenant-1 can only store \d+ more$`,
+			result.Reasons[1])
+	})
+	t.Run("Failure: tenant of the vault can't be found", func(t *testing.T) {
+		op, token := newMultiTenantOperation(t, models.TenantQuotas{})
+
+		vaultID := getVaultIDFromURL(
+			createTenantDataVault(t, op, testDataVaultConfiguration, token).Header().Get("Location"))
+
+		tenantStore, err := op.vaultCollection.provider.OpenStore(edvprovider.TenantStoreName)
+		require.NoError(t, err)
+		require.NoError(t, tenantStore.Delete(testTenantID))
+
+		_, err = op.checkBatchCapacity(httptest.NewRequest(http.MethodPost, "/", nil), vaultID,
+			&models.BatchCapacityCheck{NumOperations: 1})
+		require.True(t, errors.Is(err, messages.ErrTenantNotFound))
+	})
+	t.Run("Success: server would turn the batch away", func(t *testing.T) {
+		op := New(&Config{
+			Provider:    edvprovider.NewProvider(mem.NewProvider(), 100),
+			Bulkheads:   &mockRejecter{},
+			RateLimiter: &mockRejecter{rejection: "too many requests"},
+		})
+
+		result, err := op.checkBatchCapacity(httptest.NewRequest(http.MethodPost, "/", nil), testVaultID,
+			&models.BatchCapacityCheck{NumOperations: 1})
+		require.NoError(t, err)
+		require.False(t, result.Accepted)
+		require.Equal(t, []string{"too many requests"}, result.Reasons)
+	})
+	t.Run("Failure: invalid request body", func(t *testing.T) {
+		rr := doBatchCapacityCall(t, nil, `Incorrect format`, true)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "Received invalid batch capacity check")
+	})
+	t.Run("Failure: vault does not exist", func(t *testing.T) {
+		rr := doBatchCapacityCall(t, nil, `{"operations":1,"totalBytes":1}`, false)
+
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.BatchCapacityCheckFailure, testVaultID, messages.ErrVaultNotFound),
+			rr.Body.String())
+	})
+	t.Run("Failure: unable to escape vault ID", func(t *testing.T) {
+		op := New(&Config{
+			Provider:          edvprovider.NewProvider(mem.NewProvider(), 100),
+			EnabledExtensions: &EnabledExtensions{Batch: true},
+		})
+
+		req, err := http.NewRequest(http.MethodPost, "", bytes.NewBuffer([]byte("")))
+		require.NoError(t, err)
+
+		req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: "%"})
+
+		rr := httptest.NewRecorder()
+
+		getHandler(t, op, batchCapacityEndpoint, http.MethodPost).Handle().ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+	t.Run("Failure: error while reading request body", func(t *testing.T) {
+		op := New(&Config{
+			Provider:          edvprovider.NewProvider(mem.NewProvider(), 100),
+			EnabledExtensions: &EnabledExtensions{Batch: true},
+		})
+
+		req, err := http.NewRequest(http.MethodPost, "", failingReadCloser{})
+		require.NoError(t, err)
+
+		req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: testVaultID})
+
+		rr := httptest.NewRecorder()
+
+		getHandler(t, op, batchCapacityEndpoint, http.MethodPost).Handle().ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.BatchCapacityCheckFailReadRequestBody, testVaultID,
+			errFailingReadCloser), rr.Body.String())
+	})
+}
+
+func TestUpdateConfiguration(t *testing.T) {
+	t.Run("Success: rotate controller and change invokers and delegators", func(t *testing.T) {
+		authService := &mockAuthService{}
+
+		op := New(&Config{
+			Provider: edvprovider.NewProvider(mem.NewProvider(), 100), AuthEnable: true, AuthService: authService,
+		})
+
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		rr := doInvokedUpdateConfigurationCall(t, op, vaultID, &zcapldcore.Capability{ID: vaultID},
+			`{"sequence":1,"controller":"did:example:newcontroller","invoker":["did:example:invoker"],`+
+				`"delegator":[],"invocationMethod":"did:example:newcontroller#key1"}`)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+		var result models.DataVaultConfigurationUpdateResult
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+		require.Equal(t, uint64(1), result.Configuration.Sequence)
+		require.Equal(t, "did:example:newcontroller", result.Configuration.Controller)
+		require.Equal(t, []string{"did:example:invoker"}, result.Configuration.Invoker)
+		require.Empty(t, result.Configuration.Delegator)
+		require.Equal(t, "did:example:newcontroller#key1", result.Configuration.InvocationMethod)
+		require.Equal(t, testReferenceID, result.Configuration.ReferenceID)
+		require.JSONEq(t, `{"id":"urn:uuid:delegated"}`, string(result.Capability))
+
+		require.Equal(t, []*zcapld.Delegation{{Invoker: "did:example:newcontroller"}}, authService.delegations)
+
+		// The reference ID can be sent unchanged, and the controller is only delegated a capability if it's set.
+		rr = doUpdateConfigurationCall(t, op, vaultID, `{"referenceId":"`+testReferenceID+`"}`)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.NotContains(t, rr.Body.String(), "capability")
+		require.Len(t, authService.delegations, 1)
+	})
+	t.Run("Failure: webhooks require the Notifications extension", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		rr := doUpdateConfigurationCall(t, op, vaultID, `{"webhooks":{"endpoints":["https://example.com/webhook"]}}`)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), messages.ErrWebhooksNotEnabled.Error())
+	})
+	t.Run("Failure: invalid configuration values", func(t *testing.T) {
+		op, vaultID := createOperationWithNotifier(t, &mockNotifier{})
+
+		for requestBody, expectedError := range map[string]string{
+			`{"controller":""}`:             messages.BlankController,
+			`{"controller":"notAURI"}`:      "invalid controller value",
+			`{"invoker":["notAURI"]}`:       "invalid invoker value",
+			`{"delegator":["notAURI"]}`:     "invalid delegator value",
+			`{"invocationMethod":"notURI"}`: "invalid invocation method value",
+		} {
+			rr := doUpdateConfigurationCall(t, op, vaultID, requestBody)
+			require.Equal(t, http.StatusBadRequest, rr.Code, requestBody)
+			require.Contains(t, rr.Body.String(), expectedError, requestBody)
+		}
+	})
+	t.Run("Failure: reference ID can't be changed", func(t *testing.T) {
+		op, vaultID := createOperationWithNotifier(t, &mockNotifier{})
+
+		rr := doUpdateConfigurationCall(t, op, vaultID, `{"referenceId":"anotherReferenceID"}`)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.UpdateConfigurationFailure, vaultID, messages.ErrReferenceIDImmutable),
+			rr.Body.String())
+	})
+	t.Run("Failure: sequence conflict", func(t *testing.T) {
+		op, vaultID := createOperationWithNotifier(t, &mockNotifier{})
+
+		rr := doUpdateConfigurationCall(t, op, vaultID, `{"sequence":1}`)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rr = doUpdateConfigurationCall(t, op, vaultID, `{"sequence":1}`)
+		require.Equal(t, http.StatusConflict, rr.Code)
+		require.Contains(t, rr.Body.String(), messages.ErrConfigurationSequenceConflict.Error())
+	})
+	t.Run("Failure: error while delegating capability to the new controller", func(t *testing.T) {
+		op := New(&Config{
+			Provider: edvprovider.NewProvider(mem.NewProvider(), 100), AuthEnable: true,
+			AuthService: &mockAuthService{delegateErr: fmt.Errorf("%w: delegate error", zcapld.ErrDelegationInvalid)},
+		})
+
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		rr := doInvokedUpdateConfigurationCall(t, op, vaultID, &zcapldcore.Capability{ID: vaultID},
+			`{"controller":"did:example:newcontroller"}`)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "failed to delegate capability to new controller")
+	})
+	t.Run("Failure: controller can't be changed without invoking a capability", func(t *testing.T) {
+		authService := &mockAuthService{}
+
+		op := New(&Config{
+			Provider: edvprovider.NewProvider(mem.NewProvider(), 100), AuthEnable: true, AuthService: authService,
+		})
+
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		rr := doUpdateConfigurationCall(t, op, vaultID, `{"controller":"did:example:newcontroller"}`)
+		require.Equal(t, http.StatusForbidden, rr.Code)
+		require.Contains(t, rr.Body.String(), "by invoking a capability of its controller")
+		require.Empty(t, authService.delegations)
+
+		configuration, err := op.vaultCollection.provider.VaultConfiguration(vaultID)
+		require.NoError(t, err)
+		require.NotEqual(t, "did:example:newcontroller", configuration.Controller)
+	})
+	t.Run("Failure: delegated write capability can't change the controller", func(t *testing.T) {
+		authService := &mockAuthService{authorityErr: fmt.Errorf("%w: delegated capability",
+			zcapld.ErrActionNotAllowed)}
+
+		op := New(&Config{
+			Provider: edvprovider.NewProvider(mem.NewProvider(), 100), AuthEnable: true, AuthService: authService,
+		})
+
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		for _, requestBody := range []string{
+			`{"controller":"did:example:delegatee"}`,
+			`{"invoker":["did:example:delegatee"]}`,
+			`{"delegator":["did:example:delegatee"]}`,
+			`{"invocationMethod":"did:example:delegatee#key1"}`,
+		} {
+			rr := doInvokedUpdateConfigurationCall(t, op, vaultID,
+				&zcapldcore.Capability{ID: "urn:uuid:delegated"}, requestBody)
+			require.Equal(t, http.StatusForbidden, rr.Code, requestBody)
+			require.Contains(t, rr.Body.String(), "delegated capability", requestBody)
+		}
+
+		require.Empty(t, authService.delegations)
+
+		configuration, err := op.vaultCollection.provider.VaultConfiguration(vaultID)
+		require.NoError(t, err)
+		require.NotEqual(t, "did:example:delegatee", configuration.Controller)
+		require.Equal(t, uint64(0), configuration.Sequence)
+
+		// Settings that don't affect authorization can still be changed with a delegated capability.
+		rr := doInvokedUpdateConfigurationCall(t, op, vaultID, &zcapldcore.Capability{ID: "urn:uuid:delegated"},
+			`{"retrievalPageSize":10}`)
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+	t.Run("Success: configure and remove webhooks", func(t *testing.T) {
+		op, vaultID := createOperationWithNotifier(t, &mockNotifier{})
+
+		rr := doUpdateConfigurationCall(t, op, vaultID,
+			`{"webhooks":{"endpoints":["https://example.com/webhook"],"secret":"secret"}}`)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		webhooks, err := op.vaultCollection.provider.VaultWebhooks(vaultID)
+		require.NoError(t, err)
+		require.Equal(t, &models.VaultWebhooks{Endpoints: []string{"https://example.com/webhook"}, Secret: "secret"},
+			webhooks)
+
+		// Updates without webhooks leave them as they are.
+		rr = doUpdateConfigurationCall(t, op, vaultID, `{}`)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		webhooks, err = op.vaultCollection.provider.VaultWebhooks(vaultID)
+		require.NoError(t, err)
+		require.NotNil(t, webhooks)
+
+		rr = doUpdateConfigurationCall(t, op, vaultID, `{"webhooks":{"endpoints":[]}}`)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		webhooks, err = op.vaultCollection.provider.VaultWebhooks(vaultID)
+		require.NoError(t, err)
+		require.Nil(t, webhooks)
+	})
+	t.Run("Failure: vault does not exist", func(t *testing.T) {
+		op, _ := createOperationWithNotifier(t, &mockNotifier{})
+
+		rr := doUpdateConfigurationCall(t, op, testVaultID, `{"webhooks":{"endpoints":["https://example.com"]}}`)
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.UpdateConfigurationFailure, testVaultID, messages.ErrVaultNotFound),
+			rr.Body.String())
+	})
+	t.Run("Failure: invalid request body", func(t *testing.T) {
+		op, vaultID := createOperationWithNotifier(t, &mockNotifier{})
+
+		rr := doUpdateConfigurationCall(t, op, vaultID, "Incorrect format")
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "Received invalid configuration update")
+	})
+	t.Run("Failure: invalid webhook URL", func(t *testing.T) {
+		op, vaultID := createOperationWithNotifier(t, &mockNotifier{})
+
+		rr := doUpdateConfigurationCall(t, op, vaultID, `{"webhooks":{"endpoints":["/webhook"]}}`)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), messages.ErrInvalidWebhookURL.Error())
+	})
+	t.Run("Private webhook addresses are only allowed if enabled", func(t *testing.T) {
+		requestBody := `{"webhooks":{"endpoints":["http://169.254.169.254/latest/meta-data"]}}`
+
+		op, vaultID := createOperationWithNotifier(t, &mockNotifier{})
+
+		rr := doUpdateConfigurationCall(t, op, vaultID, requestBody)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), messages.ErrPrivateWebhookAddress.Error())
+
+		op.allowPrivateWebhookAddresses = true
+
+		rr = doUpdateConfigurationCall(t, op, vaultID, requestBody)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	})
+	t.Run("Failure: error while reading request body", func(t *testing.T) {
+		op, vaultID := createOperationWithNotifier(t, &mockNotifier{})
+
+		req, err := http.NewRequest(http.MethodPatch, "", failingReadCloser{})
+		require.NoError(t, err)
+
+		req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID})
+
+		rr := httptest.NewRecorder()
+
+		getHandler(t, op, configurationEndpoint, http.MethodPatch).Handle().ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.UpdateConfigurationFailReadRequestBody, vaultID,
+			errFailingReadCloser), rr.Body.String())
+	})
+	t.Run("Failure: unable to escape path variables", func(t *testing.T) {
+		op, _ := createOperationWithNotifier(t, &mockNotifier{})
+
+		rr := doUpdateConfigurationCall(t, op, "%", `{}`)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+	t.Run("Failure: error while storing configuration", func(t *testing.T) {
+		op := New(&Config{
+			Provider: edvprovider.NewProvider(&mock.Provider{OpenStoreReturn: &mock.Store{
+				GetReturn: []byte(`{}`), ErrPut: errors.New("put error"),
+			}}, 100),
+			EnabledExtensions: &EnabledExtensions{Notifications: true}, Notifier: &mockNotifier{},
+		})
+
+		rr := doUpdateConfigurationCall(t, op, testVaultID, `{"webhooks":{"endpoints":["https://example.com"]}}`)
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Contains(t, rr.Body.String(), "put error")
+	})
+}
+
+func TestCapabilities(t *testing.T) {
+	createOperation := func(t *testing.T, authService *mockAuthService) (*Operation, string) {
+		t.Helper()
+
+		op := New(&Config{
+			Provider: edvprovider.NewProvider(mem.NewProvider(), 100), AuthEnable: true, AuthService: authService,
+		})
+
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		return op, vaultID
+	}
+
+	t.Run("Endpoints are only registered if auth is enabled", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+
+		for _, handler := range op.GetRESTHandlers() {
+			require.NotEqual(t, capabilitiesEndpoint, handler.Path())
+			require.NotEqual(t, capabilityEndpoint, handler.Path())
+		}
+	})
+	t.Run("Success: delegate and revoke capability", func(t *testing.T) {
+		authService := &mockAuthService{}
+		op, vaultID := createOperation(t, authService)
+
+		expires := time.Now().Add(time.Hour).UTC()
+
+		rr := doCapabilityCall(t, op, http.MethodPost, capabilitiesEndpoint, vaultID, "", nil,
+			fmt.Sprintf(`{"invoker":"did:key:z1","allowedAction":["read"],"documentId":"doc1","expires":%q}`,
+				expires.Format(time.RFC3339Nano)))
+		require.Equal(t, http.StatusCreated, rr.Code)
+		require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		require.Equal(t, `{"id":"urn:uuid:delegated"}`, rr.Body.String())
+		require.Equal(t, []*zcapld.Delegation{{
+			Invoker: "did:key:z1", AllowedActions: []string{"read"}, DocumentID: "doc1", Expires: expires,
+			NotFromRoot: true,
+		}}, authService.delegations)
+
+		rr = doCapabilityCall(t, op, http.MethodPost, capabilitiesEndpoint, vaultID, "", nil,
+			`{"invoker":"did:key:z1","operations":["read","query"],"attribute":{"name":"name1","value":"value1"}}`)
+		require.Equal(t, http.StatusCreated, rr.Code)
+		require.Equal(t, &zcapld.Delegation{
+			Invoker: "did:key:z1", Operations: []string{auth.OperationRead, auth.OperationQuery},
+			Attribute: &auth.Attribute{Name: "name1", Value: "value1"}, NotFromRoot: true,
+		}, authService.delegations[1])
+
+		rr = doCapabilityCall(t, op, http.MethodDelete, capabilityEndpoint, vaultID, "urn:uuid:delegated", nil, "")
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, [][2]string{{"urn:uuid:delegated", ""}}, authService.revocations)
+	})
+	t.Run("Success: the invoked capability is the parent and revoker", func(t *testing.T) {
+		authService := &mockAuthService{}
+		op, vaultID := createOperation(t, authService)
+
+		invokedCapability := &zcapldcore.Capability{ID: "urn:uuid:invoked"}
+
+		rr := doCapabilityCall(t, op, http.MethodPost, capabilitiesEndpoint, vaultID, "", invokedCapability,
+			`{"invoker":"did:key:z1"}`)
+		require.Equal(t, http.StatusCreated, rr.Code)
+		require.Equal(t, "urn:uuid:invoked", authService.delegations[0].Parent)
+		require.False(t, authService.delegations[0].NotFromRoot)
+
+		rr = doCapabilityCall(t, op, http.MethodDelete, capabilityEndpoint, vaultID, "urn:uuid:delegated",
+			invokedCapability, "")
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, [][2]string{{"urn:uuid:delegated", "urn:uuid:invoked"}}, authService.revocations)
+	})
+	t.Run("Failure: parent isn't the invoked capability", func(t *testing.T) {
+		authService := &mockAuthService{}
+		op, vaultID := createOperation(t, authService)
+
+		rr := doCapabilityCall(t, op, http.MethodPost, capabilitiesEndpoint, vaultID, "",
+			&zcapldcore.Capability{ID: "urn:uuid:invoked"}, `{"parentCapability":"urn:uuid:other","invoker":"a"}`)
+		require.Equal(t, http.StatusForbidden, rr.Code)
+		require.Contains(t, rr.Body.String(), zcapld.ErrActionNotAllowed.Error())
+		require.Empty(t, authService.delegations)
+	})
+	t.Run("Failure: invalid delegation", func(t *testing.T) {
+		op, vaultID := createOperation(t, &mockAuthService{})
+
+		rr := doCapabilityCall(t, op, http.MethodPost, capabilitiesEndpoint, vaultID, "", nil, "Incorrect format")
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), fmt.Sprintf("Received invalid capability delegation for data vault %s",
+			vaultID))
+	})
+	t.Run("Failure: auth service errors", func(t *testing.T) {
+		op, vaultID := createOperation(t, &mockAuthService{
+			delegateErr: fmt.Errorf("%w: invalid", zcapld.ErrDelegationInvalid),
+			revokeErr:   fmt.Errorf("%w: revoker", zcapld.ErrActionNotAllowed),
+		})
+
+		rr := doCapabilityCall(t, op, http.MethodPost, capabilitiesEndpoint, vaultID, "", nil, `{"invoker":"a"}`)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.DelegateCapabilityFailure, vaultID,
+			"capability delegation is invalid: invalid"), rr.Body.String())
+
+		rr = doCapabilityCall(t, op, http.MethodDelete, capabilityEndpoint, vaultID, "urn:uuid:capability", nil, "")
+		require.Equal(t, http.StatusForbidden, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.RevokeCapabilityFailure, "urn:uuid:capability", vaultID,
+			"action not allowed by capability: revoker"), rr.Body.String())
+	})
+	t.Run("Failure: vault not found", func(t *testing.T) {
+		op, _ := createOperation(t, &mockAuthService{})
+
+		rr := doCapabilityCall(t, op, http.MethodPost, capabilitiesEndpoint, testVaultID, "", nil, `{"invoker":"a"}`)
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.DelegateCapabilityFailure, testVaultID, messages.ErrVaultNotFound),
+			rr.Body.String())
+
+		rr = doCapabilityCall(t, op, http.MethodDelete, capabilityEndpoint, testVaultID, "urn:uuid:capability", nil, "")
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.RevokeCapabilityFailure, "urn:uuid:capability", testVaultID,
+			messages.ErrVaultNotFound), rr.Body.String())
+	})
+	t.Run("Failure: unable to read request body", func(t *testing.T) {
+		op, vaultID := createOperation(t, &mockAuthService{})
+
+		req, err := http.NewRequest(http.MethodPost, "", failingReadCloser{})
+		require.NoError(t, err)
+
+		req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID})
+
+		rr := httptest.NewRecorder()
+
+		getHandler(t, op, capabilitiesEndpoint, http.MethodPost).Handle().ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.DelegateCapabilityFailReadRequestBody, vaultID,
+			errFailingReadCloser), rr.Body.String())
+	})
+	t.Run("Failure: unable to escape path variables", func(t *testing.T) {
+		op, vaultID := createOperation(t, &mockAuthService{})
+
+		rr := doCapabilityCall(t, op, http.MethodPost, capabilitiesEndpoint, "%", "", nil, "")
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = doCapabilityCall(t, op, http.MethodDelete, capabilityEndpoint, "%", "urn:uuid:capability", nil, "")
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = doCapabilityCall(t, op, http.MethodDelete, capabilityEndpoint, vaultID, "%", nil, "")
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
 
-		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = "%"
+func TestVaultEvents(t *testing.T) {
+	t.Run("Events are published for document changes", func(t *testing.T) {
+		notifier := &mockNotifier{}
+		op, vaultID := createOperationWithNotifier(t, notifier)
 
-		req = mux.SetURLVars(req, urlVars)
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
 
-		rr := httptest.NewRecorder()
+		updatedDoc := `{"id":"` + testDocID + `","sequence":1,"indexed":null,"jwe":` + testJWE1 + `}`
+		rr := sendDocumentRequestWithIfMatch(t, op, http.MethodPost, updateDocumentEndpoint, vaultID, "",
+			[]byte(updatedDoc))
+		require.Equal(t, http.StatusOK, rr.Code)
 
-		batchEndpointHandler := getHandler(t, op, batchEndpoint, http.MethodPost)
-		batchEndpointHandler.Handle().ServeHTTP(rr, req)
+		rr = sendDocumentRequestWithIfMatch(t, op, http.MethodDelete, deleteDocumentEndpoint, vaultID, "", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
 
-		require.Equal(t,
-			fmt.Sprintf(messages.UnescapeFailure, vaultIDPathVariable, `invalid URL escape "%"`),
-			rr.Body.String())
-		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Len(t, notifier.publishedEvents, 3)
+
+		for i, expected := range []struct {
+			eventType string
+			sequence  uint64
+		}{
+			{models.DocumentCreatedVaultEvent, 0},
+			{models.DocumentUpdatedVaultEvent, 1},
+			{models.DocumentDeletedVaultEvent, 1},
+		} {
+			event := notifier.publishedEvents[i]
+			require.Equal(t, vaultID, event.VaultID)
+			require.Equal(t, testDocID, event.DocumentID)
+			require.Equal(t, expected.eventType, event.Type)
+			require.Equal(t, expected.sequence, event.Sequence)
+			require.False(t, event.Timestamp.IsZero())
+		}
 	})
-	t.Run("Failure: unable to marshal request", func(t *testing.T) {
+	t.Run("Events are published for batch operations", func(t *testing.T) {
+		notifier := &mockNotifier{}
 		op := New(&Config{
 			Provider:          edvprovider.NewProvider(mem.NewProvider(), 100),
-			EnabledExtensions: &EnabledExtensions{Batch: true},
+			EnabledExtensions: &EnabledExtensions{Batch: true, Notifications: true},
+			Notifier:          notifier,
 		})
+		createConfigStoreExpectSuccess(t, op)
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
 
-		req, err := http.NewRequest("POST", "", bytes.NewBuffer([]byte("Incorrect format")))
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID2, testEncryptedDocument2, vaultID)
+
+		notifier.publishedEvents = nil
+
+		batchBytes, err := json.Marshal(models.Batch{
+			{
+				Operation:         models.UpsertDocumentVaultOperation,
+				EncryptedDocument: models.EncryptedDocument{ID: testDocID, JWE: []byte(testJWE1)},
+			},
+			{Operation: models.DeleteDocumentVaultOperation, DocumentID: testDocID2},
+		})
 		require.NoError(t, err)
 
-		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = testVaultID
+		req, err := http.NewRequest(http.MethodPost, "", bytes.NewBuffer(batchBytes))
+		require.NoError(t, err)
 
-		req = mux.SetURLVars(req, urlVars)
+		req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID})
 
 		rr := httptest.NewRecorder()
 
-		batchEndpointHandler := getHandler(t, op, batchEndpoint, http.MethodPost)
-		batchEndpointHandler.Handle().ServeHTTP(rr, req)
+		getHandler(t, op, batchEndpoint, http.MethodPost).Handle().ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
 
-		require.Equal(t,
-			fmt.Sprintf(messages.InvalidBatch, testVaultID,
-				"invalid character 'I' looking for beginning of value"),
-			rr.Body.String())
-		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Len(t, notifier.publishedEvents, 2)
+		require.Equal(t, models.DocumentUpsertedVaultEvent, notifier.publishedEvents[0].Type)
+		require.Equal(t, testDocID, notifier.publishedEvents[0].DocumentID)
+		require.Equal(t, models.DocumentDeletedVaultEvent, notifier.publishedEvents[1].Type)
+		require.Equal(t, testDocID2, notifier.publishedEvents[1].DocumentID)
 	})
-	t.Run("Failure: delete with a missing document ID", func(t *testing.T) {
-		rr, _ := doBatchCall(t, &models.Batch{
-			deleteMissingDocumentID,
-		}, mem.NewProvider())
+	t.Run("No events are published for failed operations", func(t *testing.T) {
+		notifier := &mockNotifier{}
+		op, vaultID := createOperationWithNotifier(t, notifier)
 
-		require.Equal(t, `["document ID cannot be empty for a delete operation"]`,
-			rr.Body.String())
-		require.Equal(t, http.StatusBadRequest, rr.Code)
-	})
-	t.Run("Failure: unable to upsert document in underlying storage provider", func(t *testing.T) {
-		errTestBatch := errors.New("batch error")
-		rr, _ := doBatchCall(t, &models.Batch{upsertNewDoc1}, &mockProvider{
-			numTimesOpenStoreCalledBeforeErr: 4,
-			errStoreBatch:                    errTestBatch,
-		})
+		rr := sendDocumentRequestWithIfMatch(t, op, http.MethodDelete, deleteDocumentEndpoint, vaultID, "", nil)
+		require.Equal(t, http.StatusNotFound, rr.Code)
 
-		require.Equal(t, `["failed to store encrypted document(s) and their associated mapping `+
-			`document(s): batch error"]`,
-			rr.Body.String())
-		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Empty(t, notifier.publishedEvents)
 	})
-	t.Run("Failure: unable to delete document in underlying storage provider", func(t *testing.T) {
-		errTestDelete := errors.New("delete error")
-		rr, _ := doBatchCall(t, &models.Batch{deleteExistingDoc1}, &mockProvider{
-			numTimesOpenStoreCalledBeforeErr: 4,
-			errStoreDelete:                   errTestDelete,
-		})
+}
 
-		require.Equal(t, `["`+errTestDelete.Error()+`"]`,
-			rr.Body.String())
-		require.Equal(t, http.StatusBadRequest, rr.Code)
+func doBatchCapacityCall(t *testing.T, batchLimits *BatchLimits, requestBody string,
+	createVault bool) *httptest.ResponseRecorder {
+	t.Helper()
+
+	op := New(&Config{
+		Provider:          edvprovider.NewProvider(mem.NewProvider(), 100),
+		EnabledExtensions: &EnabledExtensions{Batch: true},
+		BatchLimits:       batchLimits,
 	})
+
+	createConfigStoreExpectSuccess(t, op)
+
+	vaultID := testVaultID
+
+	if createVault {
+		vaultID, _ = createDataVaultExpectSuccess(t, op)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "", bytes.NewBuffer([]byte(requestBody)))
+	require.NoError(t, err)
+
+	req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID})
+
+	rr := httptest.NewRecorder()
+
+	getHandler(t, op, batchCapacityEndpoint, http.MethodPost).Handle().ServeHTTP(rr, req)
+
+	return rr
+}
+
+// failingBatchKeyProvider opens stores that fail every batch containing failingKey with a transient error.
+type failingBatchKeyProvider struct {
+	storage.Provider
+	failingKey string
+}
+
+func (p *failingBatchKeyProvider) OpenStore(name string) (storage.Store, error) {
+	store, err := p.Provider.OpenStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &failingBatchKeyStore{Store: store, failingKey: p.failingKey}, nil
+}
+
+type failingBatchKeyStore struct {
+	storage.Store
+	failingKey string
+}
+
+func (s *failingBatchKeyStore) Batch(operations []storage.Operation) error {
+	for _, operation := range operations {
+		if operation.Key == s.failingKey {
+			return fmt.Errorf("batch error: %w", io.ErrUnexpectedEOF)
+		}
+	}
+
+	return s.Store.Batch(operations)
 }
 
 func doBatchCall(t *testing.T, batch *models.Batch,
 	provider storage.Provider) (*httptest.ResponseRecorder, string) {
 	t.Helper()
 
-	edvProvider := edvprovider.NewProvider(provider, 100)
+	return doBatchCallWithLimits(t, batch, provider, nil)
+}
+
+func doBatchCallWithLimits(t *testing.T, batch *models.Batch,
+	provider storage.Provider, batchLimits *BatchLimits) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+
+	return doBatchCallWithEDVProvider(t, batch, edvprovider.NewProvider(provider, 100), batchLimits, func() {
+		mockProvider, isMockProvider := provider.(*mockProvider)
+		if isMockProvider {
+			mockProvider.storeExistsReturn = true
+		}
+	})
+}
+
+// doBatchCallWithEDVProvider creates a vault with the given provider and calls the batch endpoint for it.
+// beforeBatch is called after the vault is created.
+func doBatchCallWithEDVProvider(t *testing.T, batch *models.Batch, edvProvider *edvprovider.Provider,
+	batchLimits *BatchLimits, beforeBatch func()) (*httptest.ResponseRecorder, string) {
+	t.Helper()
 
 	op := New(&Config{
 		Provider:          edvProvider,
 		EnabledExtensions: &EnabledExtensions{Batch: true},
+		BatchLimits:       batchLimits,
 	})
 
 	createConfigStoreExpectSuccess(t, op)
 
 	vaultID, _ := createDataVaultExpectSuccess(t, op)
 
-	mockProvider, isMockProvider := provider.(*mockProvider)
-	if isMockProvider {
-		mockProvider.storeExistsReturn = true
-	}
+	beforeBatch()
 
 	batchBytes, err := json.Marshal(batch)
 	require.NoError(t, err)
@@ -1827,6 +3671,199 @@ func deleteDocumentExpectError(t *testing.T, op *Operation, pathVarVaultID, path
 	require.Equal(t, expectedErrorString, rr.Body.String())
 }
 
+func createOperationWithNotifier(t *testing.T, notifier notifier) (*Operation, string) {
+	t.Helper()
+
+	op := New(&Config{
+		Provider:          edvprovider.NewProvider(mem.NewProvider(), 100),
+		EnabledExtensions: &EnabledExtensions{Notifications: true},
+		Notifier:          notifier,
+	})
+
+	createConfigStoreExpectSuccess(t, op)
+
+	vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+	return op, vaultID
+}
+
+func doListDocumentsCall(t *testing.T, op *Operation, vaultID, query string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, query, nil)
+	require.NoError(t, err)
+
+	req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID})
+
+	rr := httptest.NewRecorder()
+
+	getHandler(t, op, listDocumentsEndpoint, http.MethodGet).Handle().ServeHTTP(rr, req)
+
+	return rr
+}
+
+func doUpdateConfigurationCall(t *testing.T, op *Operation, vaultID,
+	requestBody string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	return doInvokedUpdateConfigurationCall(t, op, vaultID, nil, requestBody)
+}
+
+// doInvokedUpdateConfigurationCall calls the configuration endpoint. If invokedCapability is set, the request
+// invokes it.
+func doInvokedUpdateConfigurationCall(t *testing.T, op *Operation, vaultID string,
+	invokedCapability *zcapldcore.Capability, requestBody string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPatch, "", bytes.NewBuffer([]byte(requestBody)))
+	require.NoError(t, err)
+
+	if invokedCapability != nil {
+		compressedCapability, errCompress := zcapldcore.CompressZCAP(invokedCapability)
+		require.NoError(t, errCompress)
+
+		req.Header.Set(zcapldcore.CapabilityInvocationHTTPHeader,
+			fmt.Sprintf(`zcap capability="%s",action="write"`, compressedCapability))
+	}
+
+	req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID})
+
+	rr := httptest.NewRecorder()
+
+	getHandler(t, op, configurationEndpoint, http.MethodPatch).Handle().ServeHTTP(rr, req)
+
+	return rr
+}
+
+// doCapabilityCall calls a capabilities endpoint. If invokedCapability is set, the request invokes it.
+func doCapabilityCall(t *testing.T, op *Operation, method, endpoint, vaultID, capabilityID string,
+	invokedCapability *zcapldcore.Capability, requestBody string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, err := http.NewRequest(method, "", bytes.NewBuffer([]byte(requestBody)))
+	require.NoError(t, err)
+
+	if invokedCapability != nil {
+		compressedCapability, errCompress := zcapldcore.CompressZCAP(invokedCapability)
+		require.NoError(t, errCompress)
+
+		req.Header.Set(zcapldcore.CapabilityInvocationHTTPHeader,
+			fmt.Sprintf(`zcap capability="%s",action="write"`, compressedCapability))
+	}
+
+	req = mux.SetURLVars(req, map[string]string{
+		vaultIDPathVariable: vaultID, capabilityIDPathVariable: capabilityID,
+	})
+
+	rr := httptest.NewRecorder()
+
+	getHandler(t, op, endpoint, method).Handle().ServeHTTP(rr, req)
+
+	return rr
+}
+
+func TestMultiTenancy(t *testing.T) {
+	t.Run("Vaults are created for the tenant that the token was issued to", func(t *testing.T) {
+		op, token := newMultiTenantOperation(t, models.TenantQuotas{})
+
+		rr := createTenantDataVault(t, op, testDataVaultConfiguration, token)
+		require.Equal(t, http.StatusCreated, rr.Code)
+
+		status, err := op.vaultCollection.provider.Tenant(testTenantID)
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), status.Usage.Vaults)
+	})
+	t.Run("Missing or invalid tenant token", func(t *testing.T) {
+		op, token := newMultiTenantOperation(t, models.TenantQuotas{})
+
+		for _, invalidToken := range []string{"", token + "a"} {
+			rr := createTenantDataVault(t, op, testDataVaultConfiguration, invalidToken)
+			require.Equal(t, http.StatusForbidden, rr.Code)
+			require.Equal(t, "Failed to create a new data vault: missing or invalid EDV-Tenant-Token header: "+
+				"specified tenant does not exist.", rr.Body.String())
+		}
+	})
+	t.Run("Vault quota", func(t *testing.T) {
+		op, token := newMultiTenantOperation(t, models.TenantQuotas{MaxVaults: 1})
+
+		require.Equal(t, http.StatusCreated, createTenantDataVault(t, op, testDataVaultConfiguration, token).Code)
+
+		rr := createTenantDataVault(t, op, testDataVaultConfiguration, token)
+		require.Equal(t, http.StatusForbidden, rr.Code)
+		require.Contains(t, rr.Body.String(), "tenant quota exceeded: tenant tenant-1 is limited to 1 vaults")
+	})
+	t.Run("Document quota", func(t *testing.T) {
+		op, token := newMultiTenantOperation(t, models.TenantQuotas{MaxDocuments: 1})
+
+		vaultID := getVaultIDFromURL(
+			createTenantDataVault(t, op, testDataVaultConfiguration, token).Header().Get("Location"))
+
+		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
+
+		rr := createDocument(t, op, vaultID, testEncryptedDocument2)
+		require.Equal(t, http.StatusForbidden, rr.Code)
+		require.Contains(t, rr.Body.String(), "tenant quota exceeded: tenant tenant-1 is limited to 1 documents")
+	})
+	t.Run("Byte quota", func(t *testing.T) {
+		op, token := newMultiTenantOperation(t, models.TenantQuotas{MaxBytes: 1})
+
+		vaultID := getVaultIDFromURL(
+			createTenantDataVault(t, op, testDataVaultConfiguration, token).Header().Get("Location"))
+
+		rr := createDocument(t, op, vaultID, testEncryptedDocument)
+		require.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+		require.Contains(t, rr.Body.String(), "tenant quota exceeded: tenant tenant-1 is limited to 1 bytes")
+	})
+}
+
+func newMultiTenantOperation(t *testing.T, quotas models.TenantQuotas) (*Operation, string) {
+	t.Helper()
+
+	provider := edvprovider.NewProvider(mem.NewProvider(), 100, edvprovider.WithMultiTenancy())
+	require.NoError(t, provider.CreateTenantStore())
+
+	token, err := provider.CreateTenant(&models.Tenant{ID: testTenantID, Quotas: quotas})
+	require.NoError(t, err)
+
+	op := New(&Config{Provider: provider})
+
+	createConfigStoreExpectSuccess(t, op)
+
+	return op, token
+}
+
+func createTenantDataVault(t *testing.T, op *Operation, config, token string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, "", bytes.NewBuffer([]byte(config)))
+	require.NoError(t, err)
+
+	if token != "" {
+		req.Header.Set(tenantTokenHeader, token)
+	}
+
+	rr := httptest.NewRecorder()
+
+	getHandler(t, op, createVaultEndpoint, http.MethodPost).Handle().ServeHTTP(rr, req)
+
+	return rr
+}
+
+func createDocument(t *testing.T, op *Operation, vaultID, encryptedDoc string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, "", bytes.NewBuffer([]byte(encryptedDoc)))
+	require.NoError(t, err)
+
+	req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID})
+
+	rr := httptest.NewRecorder()
+
+	getHandler(t, op, createDocumentEndpoint, http.MethodPost).Handle().ServeHTTP(rr, req)
+
+	return rr
+}
+
 func createConfigStoreExpectSuccess(t *testing.T, op *Operation) {
 	t.Helper()
 
@@ -1933,6 +3970,31 @@ func readDocumentExpectSuccess(t *testing.T, op *Operation) {
 	require.Equal(t, http.StatusOK, rr.Code)
 
 	require.Equal(t, testEncryptedDocument, rr.Body.String())
+	require.Equal(t, `"0"`, rr.Header().Get(eTagHeader))
+}
+
+func sendDocumentRequestWithIfMatch(t *testing.T, op *Operation, method, endpoint, vaultID, ifMatch string,
+	requestBody []byte) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, err := http.NewRequest(method, "", bytes.NewBuffer(requestBody))
+	require.NoError(t, err)
+
+	if ifMatch != "" {
+		req.Header.Set(ifMatchHeader, ifMatch)
+	}
+
+	urlVars := make(map[string]string)
+	urlVars[vaultIDPathVariable] = vaultID
+	urlVars[docIDPathVariable] = testDocID
+
+	req = mux.SetURLVars(req, urlVars)
+
+	rr := httptest.NewRecorder()
+
+	getHandler(t, op, endpoint, method).Handle().ServeHTTP(rr, req)
+
+	return rr
 }
 
 func getHandler(t *testing.T, op *Operation, pathToLookup, methodToLookup string) Handler {
@@ -2088,11 +4150,68 @@ func getMapWithDocIDThatCannotBeEscaped() map[string]string {
 	}
 }
 
+type mockRejecter struct {
+	rejection string
+}
+
+func (m *mockRejecter) Rejection(*http.Request) string {
+	return m.rejection
+}
+
 type mockAuthService struct {
-	createValue []byte
-	createErr   error
+	createValue      []byte
+	createErr        error
+	deletedResources []string
+	deleteErr        error
+	delegations      []*zcapld.Delegation
+	delegateErr      error
+	revocations      [][2]string // The revoked capability ID and the revoker ID.
+	revokeErr        error
+	authorityErr     error
 }
 
 func (m *mockAuthService) Create(resourceID, verificationMethod string) ([]byte, error) {
 	return m.createValue, m.createErr
 }
+
+func (m *mockAuthService) DeleteCapabilities(resourceID string) error {
+	if m.deleteErr != nil {
+		return m.deleteErr
+	}
+
+	m.deletedResources = append(m.deletedResources, resourceID)
+
+	return nil
+}
+
+func (m *mockAuthService) Delegate(resourceID string, delegation *zcapld.Delegation) ([]byte, error) {
+	if m.delegateErr != nil {
+		return nil, m.delegateErr
+	}
+
+	m.delegations = append(m.delegations, delegation)
+
+	return []byte(`{"id":"urn:uuid:delegated"}`), nil
+}
+
+func (m *mockAuthService) CheckControllerAuthority(resourceID, capabilityID string) error {
+	return m.authorityErr
+}
+
+func (m *mockAuthService) Revoke(resourceID, capabilityID, revokerID string) error {
+	if m.revokeErr != nil {
+		return m.revokeErr
+	}
+
+	m.revocations = append(m.revocations, [2]string{capabilityID, revokerID})
+
+	return nil
+}
+
+type mockNotifier struct {
+	publishedEvents []*models.VaultEvent
+}
+
+func (m *mockNotifier) Publish(event *models.VaultEvent) {
+	m.publishedEvents = append(m.publishedEvents, event)
+}
@@ -0,0 +1,112 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/trustbloc/edv/pkg/edvprovider"
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// The endpoint is under the configuration route, so it's authorized like configuration updates, and then only
+// allowed for the vault's controller.
+const referenceIDEndpoint = configurationEndpoint + "/reference-id"
+
+// Rotate Reference ID swagger:route POST /encrypted-data-vaults/{vaultID}/configuration/reference-id rotateReferenceIDReq
+//
+// Replaces the reference ID of a data vault, for example after it was leaked or to move to a new naming scheme. The
+// new reference ID must not be used by any vault. The previous one is no longer associated with the vault, and can
+// be given to other vaults. Only the vault's controller can rotate its reference ID.
+//
+// Responses:
+//    default: genericError
+//        200: rotateReferenceIDRes
+//        404: genericError
+//        409: genericError
+func (c *Operation) rotateReferenceIDHandler(rw http.ResponseWriter, req *http.Request) {
+	logger := c.requestLogger(req)
+
+	vaultID, success := unescapePathVar(logger, vaultIDPathVariable, mux.Vars(req), rw)
+	if !success {
+		return
+	}
+
+	requestBody, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusInternalServerError,
+			messages.RotateReferenceIDFailReadRequestBody, err, vaultID, nil)
+		return
+	}
+
+	// Rotations don't have webhooks, but their secret is still kept out of the logs if it's sent.
+	redactedBody := redactWebhookSecret(requestBody)
+
+	logger.Debugf(messages.DebugLogEventWithReceivedData, fmt.Sprintf(messages.RotateReferenceIDReceiveRequest,
+		vaultID), redactedBody)
+
+	var rotation models.ReferenceIDRotation
+
+	err = json.Unmarshal(requestBody, &rotation)
+	if err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusBadRequest, messages.InvalidReferenceIDRotation, err,
+			vaultID, redactedBody)
+		return
+	}
+
+	if rotation.ReferenceID == "" {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusBadRequest, messages.InvalidReferenceIDRotation,
+			errors.New(messages.BlankReferenceID), vaultID, redactedBody)
+		return
+	}
+
+	config, err := c.rotateReferenceID(vaultID, &rotation, req)
+	if err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, configurationErrorStatus(err), messages.RotateReferenceIDFailure,
+			err, vaultID, redactedBody)
+		return
+	}
+
+	configBytes, err := json.Marshal(configurationForResponse(config))
+	if err != nil {
+		writeErrorWithVaultID(logger, rw, http.StatusInternalServerError, messages.RotateReferenceIDFailure, err, vaultID)
+		return
+	}
+
+	logger.Infof(messages.RotateReferenceIDSuccess, vaultID)
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	_, err = rw.Write(configBytes)
+	if err != nil {
+		logger.Errorf(messages.RotateReferenceIDSuccess+messages.FailWriteResponse, vaultID, err)
+	}
+}
+
+func (c *Operation) rotateReferenceID(vaultID string, rotation *models.ReferenceIDRotation,
+	req *http.Request) (*models.DataVaultConfiguration, error) {
+	// The reference ID is how clients find the vault, so rotating it is left to the controller, like changing who
+	// controls the vault.
+	err := c.checkControllerAuthority(vaultID, req, "the reference ID can only be rotated")
+	if err != nil {
+		return nil, err
+	}
+
+	configStore, err := c.vaultCollection.provider.OpenStore(edvprovider.VaultConfigurationStoreName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store for vault configurations: %w", err)
+	}
+
+	return configStore.RotateReferenceID(vaultID, rotation)
+}
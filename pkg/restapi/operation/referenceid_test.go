@@ -0,0 +1,156 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/stretchr/testify/require"
+	zcapldcore "github.com/trustbloc/edge-core/pkg/zcapld"
+
+	"github.com/trustbloc/edv/pkg/auth/zcapld"
+	"github.com/trustbloc/edv/pkg/edvprovider"
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestRotateReferenceID(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		rr := doRotateReferenceIDCall(t, op, vaultID, `{"referenceId":"newReferenceID","sequence":1}`)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+		var config models.DataVaultConfiguration
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &config))
+		require.Equal(t, "newReferenceID", config.ReferenceID)
+		require.Equal(t, uint64(1), config.Sequence)
+
+		// The old reference ID can be used by a new vault.
+		createDataVaultExpectSuccess(t, op)
+	})
+	t.Run("Failure: invalid request body", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		rr := doRotateReferenceIDCall(t, op, vaultID, `{`)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "unexpected end of JSON input")
+
+		rr = doRotateReferenceIDCall(t, op, vaultID, `{"referenceId":""}`)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), messages.BlankReferenceID)
+	})
+	t.Run("Failure: reference ID is taken", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		rr := doRotateReferenceIDCall(t, op, vaultID, `{"referenceId":"`+testReferenceID+`"}`)
+		require.Equal(t, http.StatusConflict, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.RotateReferenceIDFailure, vaultID, messages.ErrDuplicateVault),
+			rr.Body.String())
+	})
+	t.Run("Failure: sequence conflict", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		rr := doRotateReferenceIDCall(t, op, vaultID, `{"referenceId":"newReferenceID","sequence":2}`)
+		require.Equal(t, http.StatusConflict, rr.Code)
+		require.Contains(t, rr.Body.String(), messages.ErrConfigurationSequenceConflict.Error())
+	})
+	t.Run("Failure: vault does not exist", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+		createConfigStoreExpectSuccess(t, op)
+
+		rr := doRotateReferenceIDCall(t, op, testVaultID, `{"referenceId":"newReferenceID"}`)
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.RotateReferenceIDFailure, testVaultID, messages.ErrVaultNotFound),
+			rr.Body.String())
+	})
+	t.Run("Success: the controller's capability is invoked", func(t *testing.T) {
+		op := New(&Config{
+			Provider: edvprovider.NewProvider(mem.NewProvider(), 100), AuthEnable: true,
+			AuthService: &mockAuthService{},
+		})
+
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		rr := doInvokedRotateReferenceIDCall(t, op, vaultID, &zcapldcore.Capability{ID: vaultID},
+			`{"referenceId":"newReferenceID"}`)
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+	t.Run("Failure: the invoked capability isn't the controller's", func(t *testing.T) {
+		op := New(&Config{
+			Provider: edvprovider.NewProvider(mem.NewProvider(), 100), AuthEnable: true,
+			AuthService: &mockAuthService{authorityErr: fmt.Errorf("%w: delegated capability",
+				zcapld.ErrActionNotAllowed)},
+		})
+
+		vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+		rr := doInvokedRotateReferenceIDCall(t, op, vaultID, &zcapldcore.Capability{ID: "urn:uuid:delegated"},
+			`{"referenceId":"newReferenceID"}`)
+		require.Equal(t, http.StatusForbidden, rr.Code)
+		require.Contains(t, rr.Body.String(), "delegated capability")
+
+		// Requests that don't invoke a capability, such as those authorized with a bearer token, are refused too.
+		rr = doRotateReferenceIDCall(t, op, vaultID, `{"referenceId":"newReferenceID"}`)
+		require.Equal(t, http.StatusForbidden, rr.Code)
+		require.Contains(t, rr.Body.String(), "the reference ID can only be rotated by invoking a capability")
+
+		configuration, err := op.vaultCollection.provider.VaultConfiguration(vaultID)
+		require.NoError(t, err)
+		require.Equal(t, testReferenceID, configuration.ReferenceID)
+	})
+}
+
+func doRotateReferenceIDCall(t *testing.T, op *Operation, vaultID,
+	requestBody string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	return doInvokedRotateReferenceIDCall(t, op, vaultID, nil, requestBody)
+}
+
+// doInvokedRotateReferenceIDCall calls the reference ID endpoint. If invokedCapability is set, the request invokes
+// it.
+func doInvokedRotateReferenceIDCall(t *testing.T, op *Operation, vaultID string,
+	invokedCapability *zcapldcore.Capability, requestBody string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, "", bytes.NewBuffer([]byte(requestBody)))
+	require.NoError(t, err)
+
+	if invokedCapability != nil {
+		compressedCapability, errCompress := zcapldcore.CompressZCAP(invokedCapability)
+		require.NoError(t, errCompress)
+
+		req.Header.Set(zcapldcore.CapabilityInvocationHTTPHeader,
+			fmt.Sprintf(`zcap capability="%s",action="write"`, compressedCapability))
+	}
+
+	req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID})
+
+	rr := httptest.NewRecorder()
+
+	getHandler(t, op, referenceIDEndpoint, http.MethodPost).Handle().ServeHTTP(rr, req)
+
+	return rr
+}
@@ -10,15 +10,20 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 
+	"github.com/trustbloc/edv/pkg/auth/zcapld"
+	"github.com/trustbloc/edv/pkg/edvprovider"
+	"github.com/trustbloc/edv/pkg/logging"
 	"github.com/trustbloc/edv/pkg/restapi/messages"
 	"github.com/trustbloc/edv/pkg/restapi/models"
 )
 
-func writeCreateDataVaultRequestReadFailure(rw http.ResponseWriter, errBodyRead error) {
+func writeCreateDataVaultRequestReadFailure(logger logging.Logger, rw http.ResponseWriter, errBodyRead error) {
 	logger.Errorf(messages.CreateVaultFailReadRequestBody, errBodyRead)
 
 	rw.WriteHeader(http.StatusInternalServerError)
@@ -29,7 +34,8 @@ func writeCreateDataVaultRequestReadFailure(rw http.ResponseWriter, errBodyRead
 	}
 }
 
-func writeCreateDataVaultInvalidRequest(rw http.ResponseWriter, errInvalid error, receivedConfig []byte) {
+func writeCreateDataVaultInvalidRequest(logger logging.Logger, rw http.ResponseWriter, errInvalid error,
+	receivedConfig []byte) {
 	logger.Errorf(messages.InvalidVaultConfig, errInvalid)
 	logger.Debugf(messages.DebugLogEventWithReceivedData,
 		fmt.Sprintf(messages.InvalidVaultConfig, errInvalid),
@@ -46,7 +52,8 @@ func writeCreateDataVaultInvalidRequest(rw http.ResponseWriter, errInvalid error
 	}
 }
 
-func writeCreateDataVaultFailure(rw http.ResponseWriter, errVaultCreation error, configBytesForLog []byte) {
+func writeCreateDataVaultFailure(logger logging.Logger, rw http.ResponseWriter, errVaultCreation error,
+	configBytesForLog []byte) {
 	logger.Errorf(messages.VaultCreationFailure, errVaultCreation)
 	logger.Debugf(messages.DebugLogEventWithReceivedData,
 		fmt.Sprintf(messages.VaultCreationFailure, errVaultCreation), configBytesForLog)
@@ -54,6 +61,10 @@ func writeCreateDataVaultFailure(rw http.ResponseWriter, errVaultCreation error,
 	switch {
 	case strings.Contains(errVaultCreation.Error(), string(messages.ErrDuplicateVault)):
 		rw.WriteHeader(http.StatusConflict)
+	case strings.Contains(errVaultCreation.Error(), string(messages.ErrTenantNotFound)),
+		strings.Contains(errVaultCreation.Error(), string(messages.ErrTenantQuotaExceeded)),
+		strings.Contains(errVaultCreation.Error(), string(messages.ErrVaultLimitExceeded)):
+		rw.WriteHeader(http.StatusForbidden)
 	default:
 		rw.WriteHeader(http.StatusInternalServerError)
 	}
@@ -67,7 +78,7 @@ func writeCreateDataVaultFailure(rw http.ResponseWriter, errVaultCreation error,
 	}
 }
 
-func writeCreateDataVaultSuccess(rw http.ResponseWriter, vaultID, hostURL string,
+func writeCreateDataVaultSuccess(logger logging.Logger, rw http.ResponseWriter, vaultID, hostURL string,
 	configBytesForLog, body []byte) {
 	urlEncodedVaultID := url.PathEscape(vaultID)
 
@@ -85,17 +96,17 @@ func writeCreateDataVaultSuccess(rw http.ResponseWriter, vaultID, hostURL string
 	}
 }
 
-func writeQueryResponse(rw http.ResponseWriter, matchingDocuments []models.EncryptedDocument, vaultID string,
-	queryBytesForLog []byte, returnFullDocument bool, host string) {
+func writeQueryResponse(logger logging.Logger, rw http.ResponseWriter, matchingDocuments []models.EncryptedDocument,
+	vaultID string, queryBytesForLog []byte, returnFullDocument bool, host string) {
 	if returnFullDocument {
-		writeQueryResponseWithFullDocuments(rw, matchingDocuments, vaultID, queryBytesForLog)
+		writeQueryResponseWithFullDocuments(logger, rw, matchingDocuments, vaultID, queryBytesForLog)
 	} else {
-		writeQueryResponseWithDocumentIDs(rw, matchingDocuments, vaultID, queryBytesForLog, host)
+		writeQueryResponseWithDocumentIDs(logger, rw, matchingDocuments, vaultID, queryBytesForLog, host)
 	}
 }
 
-func writeQueryResponseWithDocumentIDs(rw http.ResponseWriter, matchingDocuments []models.EncryptedDocument,
-	vaultID string, queryBytesForLog []byte, host string) {
+func writeQueryResponseWithDocumentIDs(logger logging.Logger, rw http.ResponseWriter,
+	matchingDocuments []models.EncryptedDocument, vaultID string, queryBytesForLog []byte, host string) {
 	var matchingDocumentIDs []string
 
 	for _, matchingDocument := range matchingDocuments {
@@ -106,7 +117,7 @@ func writeQueryResponseWithDocumentIDs(rw http.ResponseWriter, matchingDocuments
 
 	fullDocumentURLsBytes, err := json.Marshal(fullDocumentURLs)
 	if err != nil {
-		writeErrorWithVaultIDAndReceivedData(rw, http.StatusInternalServerError, messages.FailToMarshalDocIDs,
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusInternalServerError, messages.FailToMarshalDocIDs,
 			err, vaultID, queryBytesForLog)
 		return
 	}
@@ -124,11 +135,11 @@ func writeQueryResponseWithDocumentIDs(rw http.ResponseWriter, matchingDocuments
 	}
 }
 
-func writeQueryResponseWithFullDocuments(rw http.ResponseWriter, matchingDocuments []models.EncryptedDocument,
-	vaultID string, queryBytesForLog []byte) {
+func writeQueryResponseWithFullDocuments(logger logging.Logger, rw http.ResponseWriter,
+	matchingDocuments []models.EncryptedDocument, vaultID string, queryBytesForLog []byte) {
 	matchingDocumentsBytes, err := json.Marshal(matchingDocuments)
 	if err != nil {
-		writeErrorWithVaultIDAndReceivedData(rw, http.StatusInternalServerError, messages.FailToMarshalDocuments,
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusInternalServerError, messages.FailToMarshalDocuments,
 			err, vaultID, queryBytesForLog)
 		return
 	}
@@ -146,15 +157,59 @@ func writeQueryResponseWithFullDocuments(rw http.ResponseWriter, matchingDocumen
 	}
 }
 
-func writeCreateDocumentFailure(rw http.ResponseWriter, errCreateDoc error, vaultID string, docBytesForLog []byte) {
+func writeQueryCountResponse(logger logging.Logger, rw http.ResponseWriter, count int, vaultID string,
+	queryBytesForLog []byte) {
+	countBytes, err := json.Marshal(models.QueryCount{Count: count})
+	if err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusInternalServerError, messages.FailToMarshalQueryCount,
+			err, vaultID, queryBytesForLog)
+		return
+	}
+
+	logger.Debugf(messages.DebugLogEventWithReceivedData, fmt.Sprintf(messages.CountQuerySuccess, count, vaultID),
+		queryBytesForLog)
+
+	rw.Header().Set(queryCountHeader, strconv.Itoa(count))
+
+	_, err = rw.Write(countBytes)
+	if err != nil {
+		logger.Errorf(messages.QuerySuccess+messages.FailWriteResponse, vaultID, err)
+	}
+}
+
+func writeCountQueryFailure(logger logging.Logger, rw http.ResponseWriter, errCount error, vaultID string) {
+	logger.Infof(messages.QueryFailure, vaultID, errCount)
+
+	if errors.Is(errCount, messages.ErrVaultNotFound) {
+		rw.WriteHeader(http.StatusNotFound)
+	} else {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func writeCreateDocumentFailure(logger logging.Logger, rw http.ResponseWriter, errCreateDoc error, vaultID string,
+	docBytesForLog []byte) {
 	logger.Errorf(messages.CreateDocumentFailure, vaultID, errCreateDoc)
 	logger.Debugf(messages.DebugLogEventWithReceivedData,
 		fmt.Sprintf(messages.CreateDocumentFailure, vaultID, errCreateDoc),
 		docBytesForLog)
 
-	if errors.Is(errCreateDoc, messages.ErrDuplicateDocument) {
+	var limitErr *edvprovider.MappingDocumentLimitError
+	if errors.As(errCreateDoc, &limitErr) {
+		writeMappingDocumentLimitFailure(logger, rw, limitErr, fmt.Sprintf(messages.CreateDocumentFailure, vaultID,
+			errCreateDoc))
+		return
+	}
+
+	var quotaErr *edvprovider.TenantQuotaError
+
+	switch {
+	case errors.Is(errCreateDoc, messages.ErrDuplicateDocument),
+		errors.Is(errCreateDoc, messages.ErrUniqueIndexConflict):
 		rw.WriteHeader(http.StatusConflict)
-	} else {
+	case errors.As(errCreateDoc, &quotaErr):
+		rw.WriteHeader(tenantQuotaStatusCode(quotaErr))
+	default:
 		rw.WriteHeader(http.StatusBadRequest)
 	}
 
@@ -167,7 +222,8 @@ func writeCreateDocumentFailure(rw http.ResponseWriter, errCreateDoc error, vaul
 	}
 }
 
-func writeCreateDocumentSuccess(rw http.ResponseWriter, host, vaultID, docID string, docBytesForLog []byte) {
+func writeCreateDocumentSuccess(logger logging.Logger, rw http.ResponseWriter, host, vaultID, docID string,
+	docBytesForLog []byte) {
 	newDocLocation := host + "/encrypted-data-vaults/" +
 		url.PathEscape(vaultID) + "/documents/" + url.PathEscape(docID)
 
@@ -179,7 +235,8 @@ func writeCreateDocumentSuccess(rw http.ResponseWriter, host, vaultID, docID str
 	rw.WriteHeader(http.StatusCreated)
 }
 
-func writeErrorWithVaultID(rw http.ResponseWriter, statusCode int, message string, err error, vaultID string) {
+func writeErrorWithVaultID(logger logging.Logger, rw http.ResponseWriter, statusCode int, message string, err error,
+	vaultID string) {
 	logger.Errorf(message, vaultID, err)
 	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(message, vaultID, err))
 
@@ -193,9 +250,8 @@ func writeErrorWithVaultID(rw http.ResponseWriter, statusCode int, message strin
 	}
 }
 
-func writeErrorWithVaultIDAndReceivedData(rw http.ResponseWriter, statusCode int, message string,
-	err error, vaultID string,
-	receivedData []byte) {
+func writeErrorWithVaultIDAndReceivedData(logger logging.Logger, rw http.ResponseWriter, statusCode int,
+	message string, err error, vaultID string, receivedData []byte) {
 	logger.Errorf(message, vaultID, err)
 	logger.Debugf(messages.DebugLogEventWithReceivedData, fmt.Sprintf(message, vaultID, err), receivedData)
 
@@ -210,8 +266,8 @@ func writeErrorWithVaultIDAndReceivedData(rw http.ResponseWriter, statusCode int
 	}
 }
 
-func writeErrorWithVaultIDAndDocID(rw http.ResponseWriter, statusCode int, message string, err error,
-	docID, vaultID string) {
+func writeErrorWithVaultIDAndDocID(logger logging.Logger, rw http.ResponseWriter, statusCode int, message string,
+	err error, docID, vaultID string) {
 	logger.Errorf(message, docID, vaultID, err)
 
 	rw.WriteHeader(statusCode)
@@ -222,13 +278,14 @@ func writeErrorWithVaultIDAndDocID(rw http.ResponseWriter, statusCode int, messa
 	}
 }
 
-func writeReadAllDocumentsSuccess(rw http.ResponseWriter, allDocuments []json.RawMessage, vaultID string) {
+func writeReadAllDocumentsSuccess(logger logging.Logger, rw http.ResponseWriter, allDocuments []json.RawMessage,
+	vaultID string) {
 	logger.Debugf(messages.DebugLogEvent,
 		fmt.Sprintf(messages.ReadAllDocumentsSuccessWithRetrievedDocs, vaultID, allDocuments))
 
 	allDocumentsMarshalled, err := json.Marshal(allDocuments)
 	if err != nil {
-		writeErrorWithVaultID(rw, http.StatusInternalServerError, messages.FailToMarshalAllDocuments, err, vaultID)
+		writeErrorWithVaultID(logger, rw, http.StatusInternalServerError, messages.FailToMarshalAllDocuments, err, vaultID)
 		return
 	}
 
@@ -242,7 +299,8 @@ func writeReadAllDocumentsSuccess(rw http.ResponseWriter, allDocuments []json.Ra
 	}
 }
 
-func writeReadDocumentFailure(rw http.ResponseWriter, errReadDoc error, docID, vaultID string) { //nolint:dupl
+//nolint:dupl
+func writeReadDocumentFailure(logger logging.Logger, rw http.ResponseWriter, errReadDoc error, docID, vaultID string) {
 	logger.Infof(messages.ReadDocumentFailure, docID, vaultID, errReadDoc)
 
 	if errors.Is(errReadDoc, messages.ErrDocumentNotFound) || errors.Is(errReadDoc, messages.ErrVaultNotFound) {
@@ -257,26 +315,135 @@ func writeReadDocumentFailure(rw http.ResponseWriter, errReadDoc error, docID, v
 	}
 }
 
-func writeReadDocumentSuccess(rw http.ResponseWriter, documentBytes []byte, docID, vaultID string) {
-	logger.Debugf(messages.DebugLogEvent,
-		fmt.Sprintf(messages.ReadDocumentSuccessWithRetrievedDoc, docID, vaultID, documentBytes))
+// writeReadDocumentSuccess copies a document to the response in chunks, flushing each one to the client if the
+// response writer supports it, so that the whole document never has to be buffered in the response.
+// Since there's no Content-Length, net/http uses chunked transfer encoding for documents bigger than its buffer.
+func writeReadDocumentSuccess(logger logging.Logger, rw http.ResponseWriter, document io.Reader, docID,
+	vaultID string) {
+	flusher, canFlush := rw.(http.Flusher)
 
-	_, errWrite := rw.Write(documentBytes)
-	if errWrite != nil {
+	buffer := make([]byte, documentChunkSize)
+	written := false
+
+	for {
+		n, errRead := document.Read(buffer)
+
+		if n > 0 {
+			_, errWrite := rw.Write(buffer[:n])
+			if errWrite != nil {
+				logger.Errorf(messages.ReadDocumentSuccess+messages.FailWriteResponse, docID, vaultID, errWrite)
+				return
+			}
+
+			written = true
+
+			if canFlush {
+				flusher.Flush()
+			}
+		}
+
+		if errors.Is(errRead, io.EOF) {
+			break
+		}
+
+		if errRead != nil {
+			logger.Errorf(messages.ReadDocumentFailure, docID, vaultID, fmt.Errorf("failed to stream document: %w",
+				errRead))
+
+			// Once part of the document has been sent, the client can only be told by the body being cut short.
+			if !written {
+				rw.WriteHeader(http.StatusInternalServerError)
+			}
+
+			return
+		}
+	}
+
+	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.ReadDocumentSuccess, docID, vaultID))
+}
+
+func writeReadDeletedDocument(logger logging.Logger, rw http.ResponseWriter, tombstone *models.Tombstone, docID,
+	vaultID string) {
+	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.ReadDeletedDocument, docID, vaultID))
+
+	tombstoneBytes, err := json.Marshal(tombstone)
+	if err != nil {
+		writeErrorWithVaultIDAndDocID(logger, rw, http.StatusInternalServerError, messages.ReadDocumentFailure, err,
+			docID, vaultID)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusGone)
+
+	_, err = rw.Write(tombstoneBytes)
+	if err != nil {
+		logger.Errorf(messages.ReadDeletedDocument+messages.FailWriteResponse, docID, vaultID, err)
+	}
+}
+
+// writeCheckDocumentFailure only writes the status code, since responses to HEAD requests have no body.
+func writeCheckDocumentFailure(logger logging.Logger, rw http.ResponseWriter, errCheckDoc error, docID,
+	vaultID string) {
+	logger.Infof(messages.CheckDocumentFailure, docID, vaultID, errCheckDoc)
+
+	if errors.Is(errCheckDoc, messages.ErrVaultNotFound) {
+		rw.WriteHeader(http.StatusNotFound)
+	} else {
 		rw.WriteHeader(http.StatusInternalServerError)
-		logger.Errorf(messages.ReadDocumentSuccess+messages.FailWriteResponse, docID, vaultID, errWrite)
-		logger.Debugf(messages.DebugLogEvent,
-			fmt.Sprintf(messages.ReadDocumentSuccessWithRetrievedDoc+messages.FailWriteResponse,
-				docID, vaultID, errWrite, documentBytes))
 	}
 }
 
-func writeUpdateDocumentFailure(rw http.ResponseWriter, errUpdateDoc error, docID, vaultID string) { //nolint:dupl
+func writeListDocumentsFailure(logger logging.Logger, rw http.ResponseWriter, errListDocuments error, vaultID string) {
+	statusCode := http.StatusInternalServerError
+	if errors.Is(errListDocuments, messages.ErrVaultNotFound) {
+		statusCode = http.StatusNotFound
+	}
+
+	writeErrorWithVaultID(logger, rw, statusCode, messages.ListDocumentsFailure, errListDocuments, vaultID)
+}
+
+func writeListDocumentsSuccess(logger logging.Logger, rw http.ResponseWriter, list *models.DocumentList,
+	vaultID string) {
+	listBytes, err := json.Marshal(list)
+	if err != nil {
+		writeErrorWithVaultID(logger, rw, http.StatusInternalServerError, messages.FailToMarshalDocumentList, err, vaultID)
+		return
+	}
+
+	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.ListDocumentsSuccess, len(list.Documents), vaultID))
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	_, err = rw.Write(listBytes)
+	if err != nil {
+		logger.Errorf(messages.ListDocumentsSuccess+messages.FailWriteResponse, len(list.Documents), vaultID, err)
+	}
+}
+
+//nolint:dupl
+func writeUpdateDocumentFailure(logger logging.Logger, rw http.ResponseWriter, errUpdateDoc error, docID,
+	vaultID string) {
 	logger.Infof(messages.UpdateDocumentFailure, docID, vaultID, errUpdateDoc)
 
-	if errors.Is(errUpdateDoc, messages.ErrDocumentNotFound) || errors.Is(errUpdateDoc, messages.ErrVaultNotFound) {
+	var limitErr *edvprovider.MappingDocumentLimitError
+	if errors.As(errUpdateDoc, &limitErr) {
+		writeMappingDocumentLimitFailure(logger, rw, limitErr,
+			fmt.Sprintf(messages.UpdateDocumentFailure, docID, vaultID, errUpdateDoc))
+		return
+	}
+
+	var quotaErr *edvprovider.TenantQuotaError
+
+	switch {
+	case errors.Is(errUpdateDoc, messages.ErrDocumentNotFound) || errors.Is(errUpdateDoc, messages.ErrVaultNotFound):
 		rw.WriteHeader(http.StatusNotFound)
-	} else {
+	case errors.Is(errUpdateDoc, messages.ErrDocumentSequenceConflict),
+		errors.Is(errUpdateDoc, messages.ErrUniqueIndexConflict):
+		rw.WriteHeader(http.StatusConflict)
+	case errors.As(errUpdateDoc, &quotaErr):
+		rw.WriteHeader(tenantQuotaStatusCode(quotaErr))
+	default:
 		rw.WriteHeader(http.StatusBadRequest)
 	}
 
@@ -286,12 +453,67 @@ func writeUpdateDocumentFailure(rw http.ResponseWriter, errUpdateDoc error, docI
 	}
 }
 
-func writeDeleteDocumentFailure(rw http.ResponseWriter, errDeleteDoc error, docID, vaultID string) { //nolint:dupl
+// tenantQuotaStatusCode returns the status code of a response to a write that would take a tenant over one of its
+// quotas: 413 for the byte quota, since the write is too large for what the tenant has left, and 403 otherwise.
+func tenantQuotaStatusCode(quotaErr *edvprovider.TenantQuotaError) int {
+	if quotaErr.Quota == edvprovider.BytesQuota {
+		return http.StatusRequestEntityTooLarge
+	}
+
+	return http.StatusForbidden
+}
+
+// writeMappingDocumentLimitFailure writes a 400 response explaining that a document declares more indexed attributes
+// than the server allows. logging.Middleware has already set the request's correlation ID in the response's header,
+// so it's included in the response body from there.
+func writeMappingDocumentLimitFailure(logger logging.Logger, rw http.ResponseWriter,
+	limitErr *edvprovider.MappingDocumentLimitError, message string) {
+	responseBytes, err := json.Marshal(models.MappingDocumentLimitError{
+		Error:               models.MappingDocumentLimitErrorCode,
+		Message:             message,
+		DocumentID:          limitErr.DocumentID,
+		MappingDocuments:    limitErr.MappingDocuments,
+		MaxMappingDocuments: limitErr.Max,
+		CorrelationID:       rw.Header().Get(logging.CorrelationIDHeader),
+	})
+	if err != nil {
+		logger.Errorf(messages.FailToMarshalMappingDocumentLimitError, err)
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusBadRequest)
+
+	_, errWrite := rw.Write(responseBytes)
+	if errWrite != nil {
+		logger.Errorf("%s"+messages.FailWriteResponse, message, errWrite)
+	}
+}
+
+func writeDeleteVaultFailure(logger logging.Logger, rw http.ResponseWriter, errDeleteVault error, vaultID string) {
+	if errors.Is(errDeleteVault, messages.ErrVaultNotFound) {
+		writeErrorWithVaultID(logger, rw, http.StatusNotFound, messages.DeleteVaultFailure, errDeleteVault, vaultID)
+		return
+	}
+
+	if statusCode := zcapld.HTTPStatus(errDeleteVault); statusCode != http.StatusInternalServerError {
+		writeErrorWithVaultID(logger, rw, statusCode, messages.DeleteVaultFailure, errDeleteVault, vaultID)
+		return
+	}
+
+	writeErrorWithVaultID(logger, rw, http.StatusInternalServerError, messages.DeleteVaultFailure, errDeleteVault, vaultID)
+}
+
+//nolint:dupl
+func writeDeleteDocumentFailure(logger logging.Logger, rw http.ResponseWriter, errDeleteDoc error, docID,
+	vaultID string) {
 	logger.Infof(messages.DeleteDocumentFailure, docID, vaultID, errDeleteDoc)
 
-	if errors.Is(errDeleteDoc, messages.ErrDocumentNotFound) || errors.Is(errDeleteDoc, messages.ErrVaultNotFound) {
+	switch {
+	case errors.Is(errDeleteDoc, messages.ErrDocumentNotFound) || errors.Is(errDeleteDoc, messages.ErrVaultNotFound):
 		rw.WriteHeader(http.StatusNotFound)
-	} else {
+	case errors.Is(errDeleteDoc, messages.ErrDocumentSequenceConflict):
+		rw.WriteHeader(http.StatusConflict)
+	default:
 		rw.WriteHeader(http.StatusBadRequest)
 	}
 
@@ -301,7 +523,23 @@ func writeDeleteDocumentFailure(rw http.ResponseWriter, errDeleteDoc error, docI
 	}
 }
 
-func writeBatchResponse(rw http.ResponseWriter, batchResponseMsg, vaultID string, request []byte, responses []string) {
+func writeRestoreDocumentFailure(logger logging.Logger, rw http.ResponseWriter, errRestoreDoc error, docID,
+	vaultID string) {
+	switch {
+	case errors.Is(errRestoreDoc, messages.ErrDocumentNotFound) || errors.Is(errRestoreDoc, messages.ErrVaultNotFound):
+		writeErrorWithVaultIDAndDocID(logger, rw, http.StatusNotFound, messages.RestoreDocumentFailure, errRestoreDoc,
+			docID, vaultID)
+	case errors.Is(errRestoreDoc, messages.ErrDuplicateDocument):
+		writeErrorWithVaultIDAndDocID(logger, rw, http.StatusConflict, messages.RestoreDocumentFailure, errRestoreDoc,
+			docID, vaultID)
+	default:
+		writeErrorWithVaultIDAndDocID(logger, rw, http.StatusBadRequest, messages.RestoreDocumentFailure, errRestoreDoc,
+			docID, vaultID)
+	}
+}
+
+func writeBatchResponse(logger logging.Logger, rw http.ResponseWriter, batchResponseMsg, vaultID string,
+	request []byte, responses []string) {
 	responsesBytes, err := json.Marshal(responses)
 	if err != nil {
 		logger.Errorf(batchResponseMsg+messages.FailWriteResponse, vaultID, request, responsesBytes, err)
@@ -319,3 +557,95 @@ func writeBatchResponse(rw http.ResponseWriter, batchResponseMsg, vaultID string
 		logger.Errorf(batchResponseMsg+messages.FailWriteResponse, vaultID, request, responsesBytes, err)
 	}
 }
+
+func writeBatchCapacityCheckResult(logger logging.Logger, rw http.ResponseWriter,
+	result *models.BatchCapacityCheckResult, vaultID string) {
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		writeErrorWithVaultID(logger, rw, http.StatusInternalServerError, messages.FailToMarshalBatchCapacityCheckResult,
+			err, vaultID)
+		return
+	}
+
+	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf("Batch capacity check result for vault %s: %s",
+		vaultID, resultBytes))
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	_, err = rw.Write(resultBytes)
+	if err != nil {
+		logger.Errorf(messages.BatchCapacityCheckSuccess+messages.FailWriteResponse, vaultID, err)
+	}
+}
+
+func writeUpdateConfigurationSuccess(logger logging.Logger, rw http.ResponseWriter, vaultID string,
+	result *models.DataVaultConfigurationUpdateResult) {
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		writeErrorWithVaultID(logger, rw, http.StatusInternalServerError, messages.FailToMarshalUpdatedConfiguration, err,
+			vaultID)
+		return
+	}
+
+	logger.Infof(messages.UpdateConfigurationSuccess, vaultID)
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	_, err = rw.Write(resultBytes)
+	if err != nil {
+		logger.Errorf(messages.UpdateConfigurationSuccess+messages.FailWriteResponse, vaultID, err)
+	}
+}
+
+func writeUpdateConfigurationFailure(logger logging.Logger, rw http.ResponseWriter, errUpdateConfig error,
+	vaultID string, receivedData []byte) {
+	writeErrorWithVaultIDAndReceivedData(logger, rw, configurationErrorStatus(errUpdateConfig),
+		messages.UpdateConfigurationFailure, errUpdateConfig, vaultID, receivedData)
+}
+
+// configurationErrorStatus returns the status code to respond to a failed change to a vault's configuration with.
+func configurationErrorStatus(errUpdateConfig error) int {
+	switch {
+	case errors.Is(errUpdateConfig, messages.ErrVaultNotFound):
+		return http.StatusNotFound
+	case errors.Is(errUpdateConfig, messages.ErrReferenceIDImmutable):
+		return http.StatusBadRequest
+	case errors.Is(errUpdateConfig, messages.ErrConfigurationSequenceConflict),
+		errors.Is(errUpdateConfig, messages.ErrDuplicateVault):
+		return http.StatusConflict
+	default:
+		return zcapld.HTTPStatus(errUpdateConfig)
+	}
+}
+
+func writeDelegateCapabilitySuccess(logger logging.Logger, rw http.ResponseWriter, vaultID string,
+	capabilityBytes []byte) {
+	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf("Delegated capability in vault %s: %s",
+		vaultID, capabilityBytes))
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusCreated)
+
+	_, err := rw.Write(capabilityBytes)
+	if err != nil {
+		logger.Errorf(messages.DelegateCapabilityFailure+messages.FailWriteResponse, vaultID, err, err)
+	}
+}
+
+func writeRevokeCapabilityFailure(logger logging.Logger, rw http.ResponseWriter, errRevokeCapability error,
+	capabilityID, vaultID string) {
+	logger.Infof(messages.RevokeCapabilityFailure, capabilityID, vaultID, errRevokeCapability)
+
+	if errors.Is(errRevokeCapability, messages.ErrVaultNotFound) {
+		rw.WriteHeader(http.StatusNotFound)
+	} else {
+		rw.WriteHeader(zcapld.HTTPStatus(errRevokeCapability))
+	}
+
+	_, errWrite := rw.Write([]byte(fmt.Sprintf(messages.RevokeCapabilityFailure, capabilityID, vaultID,
+		errRevokeCapability)))
+	if errWrite != nil {
+		logger.Errorf(messages.RevokeCapabilityFailure+messages.FailWriteResponse, capabilityID, vaultID,
+			errRevokeCapability, errWrite)
+	}
+}
@@ -0,0 +1,195 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+
+	"github.com/trustbloc/edv/pkg/audit"
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// restrictedOperations maps the operations that are audited to the operations that the restrictions of requests
+// allow (see auth.Restrictions). The operations that aren't listed are writes.
+// nolint:gochecknoglobals
+var restrictedOperations = map[string]string{
+	audit.ReadDocumentOperation:   auth.OperationRead,
+	audit.CheckDocumentOperation:  auth.OperationRead,
+	audit.ListDocumentsOperation:  auth.OperationRead,
+	audit.ExportVaultOperation:    auth.OperationRead,
+	audit.ExportAuditLogOperation: auth.OperationRead,
+	audit.IndexingStatusOperation: auth.OperationRead,
+	audit.QueryOperation:          auth.OperationQuery,
+	audit.CountQueryOperation:     auth.OperationQuery,
+}
+
+// attributeRestrictedOperations are the operations that requests restricted to the documents indexed with some
+// attributes may perform. The other operations aren't for single documents or queries, so the attributes can't be
+// checked for them.
+// nolint:gochecknoglobals
+var attributeRestrictedOperations = map[string]bool{
+	audit.CreateDocumentOperation: true,
+	audit.ReadDocumentOperation:   true,
+	audit.CheckDocumentOperation:  true,
+	audit.UpdateDocumentOperation: true,
+	audit.DeleteDocumentOperation: true,
+	audit.QueryOperation:          true,
+	audit.CountQueryOperation:     true,
+}
+
+// restricted returns a handler that enforces the restrictions of authorized requests (see auth.Restrictions) before
+// passing them on to handler: the request's operation must be allowed, and the document that it reads, updates or
+// deletes must be indexed with the attributes that it's restricted to. The documents that are created or updated,
+// and queries, are in the request's body, so they're checked by their handlers.
+func (c *Operation) restricted(operation string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		restrictions := auth.RestrictionsFrom(req.Context())
+		if restrictions == nil {
+			handler(rw, req)
+
+			return
+		}
+
+		logger := c.requestLogger(req)
+		vaultID := unescapedPathVar(mux.Vars(req), vaultIDPathVariable)
+
+		if err := checkOperationRestrictions(restrictions, operation); err != nil {
+			writeErrorWithVaultID(logger, rw, http.StatusForbidden, messages.OperationRestricted, err, vaultID)
+
+			return
+		}
+
+		docID := unescapedPathVar(mux.Vars(req), docIDPathVariable)
+
+		if docID != "" && len(restrictions.Attributes) > 0 {
+			err := c.vaultCollection.checkStoredDocumentRestrictions(req.Context(), vaultID, docID, restrictions)
+			if errors.Is(err, messages.ErrOperationRestricted) {
+				writeErrorWithVaultIDAndDocID(logger, rw, http.StatusForbidden, messages.DocumentOperationRestricted,
+					err, docID, vaultID)
+
+				return
+			}
+
+			if err != nil {
+				writeErrorWithVaultIDAndDocID(logger, rw, http.StatusInternalServerError,
+					messages.CheckRestrictionsFailure, err, docID, vaultID)
+
+				return
+			}
+		}
+
+		handler(rw, req)
+	}
+}
+
+// checkStoredDocumentRestrictions checks that the stored document with the given ID is indexed with the attributes
+// that the request is restricted to. Documents and vaults that don't exist are left to the request's handler to
+// respond to.
+func (vc *VaultCollection) checkStoredDocumentRestrictions(ctx context.Context, vaultID, docID string,
+	restrictions *auth.Restrictions) error {
+	exists, err := vc.provider.StoreExists(vaultID)
+	if err != nil || !exists {
+		return err
+	}
+
+	store, err := vc.openStore(ctx, vaultID)
+	if err != nil {
+		return err
+	}
+
+	documentBytes, err := store.Get(docID)
+	if errors.Is(err, storage.ErrDataNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var document models.EncryptedDocument
+
+	if err = json.Unmarshal(documentBytes, &document); err != nil {
+		return fmt.Errorf("failed to unmarshal document: %w", err)
+	}
+
+	return checkDocumentRestrictions(restrictions, &document)
+}
+
+// checkOperationRestrictions checks that the restrictions allow the given operation, as it's audited.
+func checkOperationRestrictions(restrictions *auth.Restrictions, operation string) error {
+	restrictedOperation, ok := restrictedOperations[operation]
+	if !ok {
+		restrictedOperation = auth.OperationWrite
+	}
+
+	if !restrictions.AllowsOperation(restrictedOperation) {
+		return fmt.Errorf("%w: %s operations aren't allowed", messages.ErrOperationRestricted, restrictedOperation)
+	}
+
+	if len(restrictions.Attributes) > 0 && !attributeRestrictedOperations[operation] {
+		return fmt.Errorf("%w: %s isn't allowed for requests that are restricted to the documents with some "+
+			"attributes", messages.ErrOperationRestricted, operation)
+	}
+
+	return nil
+}
+
+// checkDocumentRestrictions checks that the document is indexed with all the attributes that the restrictions
+// restrict requests to.
+func checkDocumentRestrictions(restrictions *auth.Restrictions, document *models.EncryptedDocument) error {
+	if restrictions == nil {
+		return nil
+	}
+
+	for _, attribute := range restrictions.Attributes {
+		if !hasIndexedAttribute(document, attribute) {
+			return fmt.Errorf("%w: document %s isn't indexed with attribute %s", messages.ErrOperationRestricted,
+				document.ID, attribute.Name)
+		}
+	}
+
+	return nil
+}
+
+// checkQueryRestrictions checks that the query is for the attribute that the restrictions restrict requests to,
+// so that it only matches documents that the request may read. Requests restricted to more than one attribute
+// can't query.
+func checkQueryRestrictions(restrictions *auth.Restrictions, query *models.Query) error {
+	if restrictions == nil {
+		return nil
+	}
+
+	for _, attribute := range restrictions.Attributes {
+		if query.Name != attribute.Name || query.Value != attribute.Value {
+			return fmt.Errorf("%w: only queries for documents with attribute %s equal to %s are allowed",
+				messages.ErrOperationRestricted, attribute.Name, attribute.Value)
+		}
+	}
+
+	return nil
+}
+
+func hasIndexedAttribute(document *models.EncryptedDocument, attribute auth.Attribute) bool {
+	for _, collection := range document.IndexedAttributeCollections {
+		for _, indexedAttribute := range collection.IndexedAttributes {
+			if indexedAttribute.Name == attribute.Name && indexedAttribute.Value == attribute.Value {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,135 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/edvprovider"
+)
+
+func TestOperation_Restrictions(t *testing.T) {
+	op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+
+	createConfigStoreExpectSuccess(t, op)
+
+	vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+	shared := auth.Attribute{Name: testIndexName1, Value: "shared"}
+	private := auth.Attribute{Name: testIndexName1, Value: "private"}
+
+	storeEncryptedDocumentExpectSuccess(t, op, testDocID, restrictionsTestDocument(testDocID, 0, shared), vaultID)
+	storeEncryptedDocumentExpectSuccess(t, op, testDocID2, restrictionsTestDocument(testDocID2, 0, private), vaultID)
+
+	readOnly := &auth.Restrictions{Operations: []string{auth.OperationRead, auth.OperationQuery}}
+	attributeScoped := &auth.Restrictions{Attributes: []auth.Attribute{shared}}
+
+	sharedQuery := fmt.Sprintf(`{"index":%q,"equals":%q}`, shared.Name, shared.Value)
+	privateQuery := fmt.Sprintf(`{"index":%q,"equals":%q}`, private.Name, private.Value)
+
+	// The requests are sent in order, so that documents are created before they're read.
+	tests := []struct {
+		name         string
+		restrictions *auth.Restrictions
+		endpoint     string
+		method       string
+		target       string
+		docID        string
+		body         string
+		statusCode   int
+	}{
+		{"Read-only: read", readOnly, readDocumentEndpoint, http.MethodGet, "/", testDocID2, "", http.StatusOK},
+		{"Read-only: list", readOnly, listDocumentsEndpoint, http.MethodGet, "/", "", "", http.StatusOK},
+		{"Read-only: query", readOnly, queryVaultEndpoint, http.MethodPost, "/", "", privateQuery, http.StatusOK},
+		{"Read-only: create", readOnly, createDocumentEndpoint, http.MethodPost, "/", "",
+			restrictionsTestDocument(testDocID3, 0, shared), http.StatusForbidden},
+		{"Read-only: delete", readOnly, deleteDocumentEndpoint, http.MethodDelete, "/", testDocID2, "",
+			http.StatusForbidden},
+		{"Attribute: read", attributeScoped, readDocumentEndpoint, http.MethodGet, "/", testDocID, "", http.StatusOK},
+		{"Attribute: read another document", attributeScoped, readDocumentEndpoint, http.MethodGet, "/", testDocID2, "",
+			http.StatusForbidden},
+		{"Attribute: check another document", attributeScoped, readDocumentEndpoint, http.MethodHead, "/", testDocID2,
+			"", http.StatusForbidden},
+		{"Attribute: read a missing document", attributeScoped, readDocumentEndpoint, http.MethodGet, "/", testDocID3,
+			"", http.StatusNotFound},
+		{"Attribute: list", attributeScoped, listDocumentsEndpoint, http.MethodGet, "/", "", "", http.StatusForbidden},
+		{"Attribute: query", attributeScoped, queryVaultEndpoint, http.MethodPost, "/", "", sharedQuery, http.StatusOK},
+		{"Attribute: query for another attribute", attributeScoped, queryVaultEndpoint, http.MethodPost, "/", "",
+			privateQuery, http.StatusForbidden},
+		{"Attribute: count", attributeScoped, queryVaultEndpoint, http.MethodHead,
+			"/?" + url.Values{"index": {shared.Name}, "equals": {shared.Value}}.Encode(), "", "", http.StatusOK},
+		{"Attribute: count another attribute", attributeScoped, queryVaultEndpoint, http.MethodHead,
+			"/?" + url.Values{"index": {private.Name}, "equals": {private.Value}}.Encode(), "", "",
+			http.StatusForbidden},
+		{"Attribute: create", attributeScoped, createDocumentEndpoint, http.MethodPost, "/", "",
+			restrictionsTestDocument(testDocID3, 0, shared), http.StatusCreated},
+		{"Attribute: create without the attribute", attributeScoped, createDocumentEndpoint, http.MethodPost, "/", "",
+			restrictionsTestDocument("DJYHHJx4C8J9Fsgz7rZqSp", 0, private), http.StatusForbidden},
+		{"Attribute: update another document", attributeScoped, updateDocumentEndpoint, http.MethodPost, "/",
+			testDocID2, restrictionsTestDocument(testDocID2, 1, shared), http.StatusForbidden},
+		{"Attribute: update removing the attribute", attributeScoped, updateDocumentEndpoint, http.MethodPost, "/",
+			testDocID, restrictionsTestDocument(testDocID, 1, private), http.StatusForbidden},
+		{"Attribute: update", attributeScoped, updateDocumentEndpoint, http.MethodPost, "/", testDocID,
+			restrictionsTestDocument(testDocID, 1, shared), http.StatusOK},
+		{"Attribute: update the configuration", attributeScoped, configurationEndpoint, http.MethodPatch, "/", "",
+			`{"referenceId":"ref"}`, http.StatusForbidden},
+		{"Attribute: delete another document", attributeScoped, deleteDocumentEndpoint, http.MethodDelete, "/",
+			testDocID2, "", http.StatusForbidden},
+		{"Attribute: delete", attributeScoped, deleteDocumentEndpoint, http.MethodDelete, "/", testDocID, "",
+			http.StatusOK},
+		{"Unrestricted: read", nil, readDocumentEndpoint, http.MethodGet, "/", testDocID2, "", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+		req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID, docIDPathVariable: test.docID})
+
+		if test.restrictions != nil {
+			req = req.WithContext(auth.WithRestrictions(req.Context(), test.restrictions))
+		}
+
+		rr := httptest.NewRecorder()
+
+		getHandler(t, op, test.endpoint, test.method).Handle().ServeHTTP(rr, req)
+
+		require.Equal(t, test.statusCode, rr.Code, test.name+": "+rr.Body.String())
+	}
+
+	t.Run("Fail to check the stored document", func(t *testing.T) {
+		failingOp := New(&Config{Provider: edvprovider.NewProvider(&mock.Provider{
+			OpenStoreReturn: &mock.Store{ErrGet: errors.New("get error")},
+		}, 100)})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = mux.SetURLVars(req, map[string]string{vaultIDPathVariable: vaultID, docIDPathVariable: testDocID})
+		req = req.WithContext(auth.WithRestrictions(req.Context(), attributeScoped))
+
+		rr := httptest.NewRecorder()
+
+		getHandler(t, failingOp, readDocumentEndpoint, http.MethodGet).Handle().ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Contains(t, rr.Body.String(), "get error")
+	})
+}
+
+func restrictionsTestDocument(docID string, sequence int, attribute auth.Attribute) string {
+	return fmt.Sprintf(`{"id":%q,"sequence":%d,"indexed":[{"sequence":0,"hmac":{"id":"","type":""},`+
+		`"attributes":[{"name":%q,"value":%q}]}],"jwe":%s}`, docID, sequence, attribute.Name, attribute.Value, testJWE1)
+}
@@ -0,0 +1,123 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// documentChunkSize is the size of the chunks that documents are streamed to clients in.
+const documentChunkSize = 32 * 1024
+
+// errIncompleteDocument is returned when a request body ends before the document in it does. It has the same
+// message that json.Unmarshal gives for incomplete input.
+var errIncompleteDocument = errors.New("unexpected end of JSON input")
+
+// errDocumentTooLarge is returned when reading a request body that's larger than the maximum document size.
+var errDocumentTooLarge = errors.New("document is too large")
+
+// readError is returned by decodeDocument when the request body couldn't be read, as opposed to not being a valid
+// document.
+type readError struct {
+	err error
+}
+
+func (e *readError) Error() string {
+	return e.err.Error()
+}
+
+func (e *readError) Unwrap() error {
+	return e.err
+}
+
+// readErrorRecorder keeps the first error returned by the reader it wraps, so that it can be told apart from
+// JSON decoding errors.
+type readErrorRecorder struct {
+	reader io.Reader
+	err    error
+}
+
+func (r *readErrorRecorder) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) && r.err == nil {
+		r.err = err
+	}
+
+	return n, err
+}
+
+// documentSizeLimiter returns errDocumentTooLarge once more than the maximum document size has been read from the
+// reader it wraps. Unlike http.MaxBytesReader, the error can be told apart from other read errors.
+type documentSizeLimiter struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (l *documentSizeLimiter) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// The document is as large as it's allowed to be, so the body must end here.
+		var next [1]byte
+
+		n, err := l.reader.Read(next[:])
+		if n > 0 {
+			return 0, errDocumentTooLarge
+		}
+
+		return 0, err
+	}
+
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+
+	n, err := l.reader.Read(p)
+	l.remaining -= int64(n)
+
+	return n, err
+}
+
+// limitDocumentSize returns a reader that fails with errDocumentTooLarge if body is larger than maxSize bytes.
+// If maxSize is 0, then body is returned as it is.
+func limitDocumentSize(body io.Reader, maxSize uint64) io.Reader {
+	if maxSize == 0 {
+		return body
+	}
+
+	return &documentSizeLimiter{reader: body, remaining: int64(maxSize)}
+}
+
+// decodeDocument decodes an encrypted document as it's read from body, instead of reading the whole body into memory
+// first. A *readError is returned if body can't be read.
+func decodeDocument(body io.Reader) (models.EncryptedDocument, error) {
+	recorder := &readErrorRecorder{reader: body}
+	decoder := json.NewDecoder(recorder)
+
+	var document models.EncryptedDocument
+
+	err := decoder.Decode(&document)
+	if err == nil {
+		// Like json.Unmarshal, anything other than whitespace after the document is rejected.
+		if _, errToken := decoder.Token(); !errors.Is(errToken, io.EOF) {
+			err = errors.New("invalid character after top-level value")
+		}
+	}
+
+	switch {
+	case recorder.err != nil:
+		return models.EncryptedDocument{}, &readError{err: recorder.err}
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return models.EncryptedDocument{}, errIncompleteDocument
+	case err != nil:
+		return models.EncryptedDocument{}, err
+	}
+
+	return document, nil
+}
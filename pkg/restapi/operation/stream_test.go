@@ -0,0 +1,111 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeDocument(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		document, err := decodeDocument(strings.NewReader(testEncryptedDocument + "\n"))
+		require.NoError(t, err)
+		require.Equal(t, testDocID, document.ID)
+	})
+	t.Run("Incomplete document", func(t *testing.T) {
+		for _, body := range []string{"", `{"id":`} {
+			_, err := decodeDocument(strings.NewReader(body))
+			require.EqualError(t, err, "unexpected end of JSON input", body)
+		}
+	})
+	t.Run("Data after the document", func(t *testing.T) {
+		_, err := decodeDocument(strings.NewReader(testEncryptedDocument + "{}"))
+		require.EqualError(t, err, "invalid character after top-level value")
+	})
+	t.Run("Invalid document", func(t *testing.T) {
+		_, err := decodeDocument(strings.NewReader(`{"id":1}`))
+
+		var errRead *readError
+
+		require.Error(t, err)
+		require.False(t, errors.As(err, &errRead))
+	})
+	t.Run("Fail to read body", func(t *testing.T) {
+		_, err := decodeDocument(failingReadCloser{})
+
+		var errRead *readError
+
+		require.True(t, errors.As(err, &errRead))
+		require.True(t, errors.Is(err, errFailingReadCloser))
+	})
+}
+
+func TestLimitDocumentSize(t *testing.T) {
+	t.Run("Documents up to the maximum size are read", func(t *testing.T) {
+		for _, maxSize := range []uint64{0, uint64(len(testEncryptedDocument))} {
+			document, err := decodeDocument(limitDocumentSize(strings.NewReader(testEncryptedDocument), maxSize))
+			require.NoError(t, err)
+			require.Equal(t, testDocID, document.ID)
+		}
+	})
+	t.Run("Documents larger than the maximum size are rejected", func(t *testing.T) {
+		_, err := decodeDocument(limitDocumentSize(strings.NewReader(testEncryptedDocument+"\n"),
+			uint64(len(testEncryptedDocument))))
+		require.True(t, errors.Is(err, errDocumentTooLarge))
+
+		_, err = decodeDocument(limitDocumentSize(strings.NewReader(testEncryptedDocument), 10))
+		require.True(t, errors.Is(err, errDocumentTooLarge))
+	})
+}
+
+func TestWriteReadDocumentSuccess(t *testing.T) {
+	t.Run("The document is written and flushed in chunks", func(t *testing.T) {
+		document := strings.Repeat("a", documentChunkSize*2+1)
+
+		rr := httptest.NewRecorder()
+		rw := &flushCountingResponseWriter{ResponseWriter: rr}
+
+		writeReadDocumentSuccess(logger, rw, strings.NewReader(document), testDocID, testVaultID)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, document, rr.Body.String())
+		require.Equal(t, 3, rw.flushes)
+	})
+	t.Run("Fail to read document before anything is written", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+
+		writeReadDocumentSuccess(logger, rr, failingReadCloser{}, testDocID, testVaultID)
+
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Empty(t, rr.Body.String())
+	})
+	t.Run("Fail to read document after part of it is written", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+
+		writeReadDocumentSuccess(logger, rr, io.MultiReader(strings.NewReader("{"), failingReadCloser{}), testDocID,
+			testVaultID)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "{", rr.Body.String())
+	})
+}
+
+type flushCountingResponseWriter struct {
+	http.ResponseWriter
+	flushes int
+}
+
+func (f *flushCountingResponseWriter) Flush() {
+	f.flushes++
+}
@@ -0,0 +1,289 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+
+	"github.com/trustbloc/edv/pkg/logging"
+	"github.com/trustbloc/edv/pkg/notification"
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// The subscription endpoints are deprecated aliases for changing the webhook endpoints in a vault's configuration,
+// kept for the clients that used them before webhooks became part of vault configurations. Each subscription is one
+// of the endpoints, and its ID is derived from its URL.
+const (
+	subscriptionIDPathVariable = "subscriptionID"
+
+	subscriptionsEndpoint = edvCommonEndpointPathRoot + "/{" + vaultIDPathVariable + "}/subscriptions"
+	subscriptionEndpoint  = subscriptionsEndpoint + "/{" + subscriptionIDPathVariable + "}"
+
+	// deprecationHeader marks the responses of deprecated endpoints, and the link header points to the configuration
+	// endpoint that replaces them.
+	deprecationHeader = "Deprecation"
+	linkHeader        = "Link"
+)
+
+// Create subscription swagger route
+// swagger:route POST /encrypted-data-vaults/{vaultID}/subscriptions subscriptions createSubscriptionReq
+//
+// Deprecated: set the webhooks in the vault's configuration instead. Adds a webhook endpoint to the vault's
+// configuration, which is notified when documents in the vault are created, updated or deleted.
+//
+// Responses:
+//    default: genericError
+//        201: createSubscriptionRes
+func (c *Operation) createSubscriptionHandler(rw http.ResponseWriter, req *http.Request) {
+	logger := c.requestLogger(req)
+
+	vaultID, success := unescapePathVar(logger, vaultIDPathVariable, mux.Vars(req), rw)
+	if !success {
+		return
+	}
+
+	setDeprecationHeaders(rw, vaultID)
+
+	requestBody, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusInternalServerError,
+			messages.CreateSubscriptionFailReadRequestBody, err, vaultID, nil)
+		return
+	}
+
+	logger.Debugf(messages.DebugLogEventWithReceivedData, fmt.Sprintf(messages.CreateSubscriptionReceiveRequest,
+		vaultID), requestBody)
+
+	var incomingSubscription models.Subscription
+
+	err = json.Unmarshal(requestBody, &incomingSubscription)
+	if err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusBadRequest, messages.InvalidSubscription, err,
+			vaultID, requestBody)
+		return
+	}
+
+	err = notification.ValidateWebhooks(&models.VaultWebhooks{Endpoints: []string{incomingSubscription.URL}},
+		c.allowPrivateWebhookAddresses)
+	if err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, http.StatusBadRequest, messages.InvalidSubscription, err,
+			vaultID, requestBody)
+		return
+	}
+
+	_, err = c.vaultCollection.provider.ChangeVaultWebhooks(vaultID,
+		func(webhooks *models.VaultWebhooks) (*models.VaultWebhooks, error) {
+			return addWebhookEndpoint(webhooks, incomingSubscription.URL), nil
+		})
+	if err != nil {
+		writeErrorWithVaultIDAndReceivedData(logger, rw, configurationErrorStatus(err),
+			messages.CreateSubscriptionFailure, err, vaultID, requestBody)
+		return
+	}
+
+	writeCreateSubscriptionSuccess(logger, rw, req.Host, newSubscription(vaultID, incomingSubscription.URL))
+}
+
+// Read subscriptions swagger route
+// swagger:route GET /encrypted-data-vaults/{vaultID}/subscriptions subscriptions readSubscriptionsReq
+//
+// Deprecated: read the webhooks in the vault's configuration instead. Returns the webhook endpoints of the vault.
+//
+// Responses:
+//    default: genericError
+//        200: readSubscriptionsRes
+func (c *Operation) readSubscriptionsHandler(rw http.ResponseWriter, req *http.Request) {
+	logger := c.requestLogger(req)
+
+	vaultID, success := unescapePathVar(logger, vaultIDPathVariable, mux.Vars(req), rw)
+	if !success {
+		return
+	}
+
+	setDeprecationHeaders(rw, vaultID)
+
+	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.ReadSubscriptionsReceiveRequest, vaultID))
+
+	webhooks, err := c.vaultCollection.provider.VaultWebhooks(vaultID)
+	if err != nil {
+		writeErrorWithVaultID(logger, rw, configurationErrorStatus(err), messages.ReadSubscriptionsFailure, err,
+			vaultID)
+		return
+	}
+
+	subscriptions := []models.Subscription{}
+
+	if webhooks != nil {
+		for _, endpoint := range webhooks.Endpoints {
+			subscriptions = append(subscriptions, *newSubscription(vaultID, endpoint))
+		}
+	}
+
+	writeReadSubscriptionsSuccess(logger, rw, subscriptions, vaultID)
+}
+
+// Delete subscription swagger route
+// swagger:route DELETE /encrypted-data-vaults/{vaultID}/subscriptions/{subscriptionID} subscriptions deleteSubscriptionReq
+//
+// Deprecated: set the webhooks in the vault's configuration instead. Removes a webhook endpoint from the vault's
+// configuration.
+//
+// Responses:
+//    default: genericError
+//        200: emptyRes
+func (c *Operation) deleteSubscriptionHandler(rw http.ResponseWriter, req *http.Request) {
+	logger := c.requestLogger(req)
+
+	vaultID, success := unescapePathVar(logger, vaultIDPathVariable, mux.Vars(req), rw)
+	if !success {
+		return
+	}
+
+	subscriptionID, success := unescapePathVar(logger, subscriptionIDPathVariable, mux.Vars(req), rw)
+	if !success {
+		return
+	}
+
+	setDeprecationHeaders(rw, vaultID)
+
+	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.DeleteSubscriptionReceiveRequest,
+		subscriptionID, vaultID))
+
+	_, err := c.vaultCollection.provider.ChangeVaultWebhooks(vaultID,
+		func(webhooks *models.VaultWebhooks) (*models.VaultWebhooks, error) {
+			return removeWebhookEndpoint(webhooks, subscriptionID)
+		})
+	if err != nil {
+		writeDeleteSubscriptionFailure(logger, rw, err, subscriptionID, vaultID)
+	}
+}
+
+// setDeprecationHeaders marks the response of a deprecated subscription endpoint as deprecated (RFC 9745), and links
+// to the configuration endpoint that replaces it.
+func setDeprecationHeaders(rw http.ResponseWriter, vaultID string) {
+	rw.Header().Set(deprecationHeader, "true")
+	rw.Header().Set(linkHeader,
+		fmt.Sprintf(`<%s/%s/configuration>; rel="successor-version"`, edvCommonEndpointPathRoot, url.PathEscape(vaultID)))
+}
+
+func newSubscription(vaultID, endpoint string) *models.Subscription {
+	return &models.Subscription{ID: subscriptionID(endpoint), VaultID: vaultID, URL: endpoint}
+}
+
+// subscriptionID returns the ID of the subscription for the given webhook endpoint, which is derived from its URL so
+// that subscriptions don't have to be stored separately from the vault's configuration.
+func subscriptionID(endpoint string) string {
+	hash := sha256.Sum256([]byte(endpoint))
+
+	return hex.EncodeToString(hash[:16])
+}
+
+// addWebhookEndpoint returns webhooks with the given endpoint added, unless they already have it.
+func addWebhookEndpoint(webhooks *models.VaultWebhooks, endpoint string) *models.VaultWebhooks {
+	if webhooks == nil {
+		webhooks = &models.VaultWebhooks{}
+	}
+
+	for _, existingEndpoint := range webhooks.Endpoints {
+		if existingEndpoint == endpoint {
+			return webhooks
+		}
+	}
+
+	webhooks.Endpoints = append(webhooks.Endpoints, endpoint)
+
+	return webhooks
+}
+
+// removeWebhookEndpoint returns webhooks without the endpoint whose subscription has the given ID, or
+// messages.ErrSubscriptionNotFound if they don't have it.
+func removeWebhookEndpoint(webhooks *models.VaultWebhooks, id string) (*models.VaultWebhooks, error) {
+	if webhooks == nil {
+		return nil, messages.ErrSubscriptionNotFound
+	}
+
+	for i, endpoint := range webhooks.Endpoints {
+		if subscriptionID(endpoint) == id {
+			webhooks.Endpoints = append(webhooks.Endpoints[:i], webhooks.Endpoints[i+1:]...)
+
+			return webhooks, nil
+		}
+	}
+
+	return nil, messages.ErrSubscriptionNotFound
+}
+
+func writeCreateSubscriptionSuccess(logger logging.Logger, rw http.ResponseWriter, host string,
+	subscription *models.Subscription) {
+	subscriptionBytes, err := json.Marshal(subscription)
+	if err != nil {
+		writeErrorWithVaultID(logger, rw, http.StatusInternalServerError, messages.CreateSubscriptionFailure, err,
+			subscription.VaultID)
+		return
+	}
+
+	newSubscriptionLocation := host + "/encrypted-data-vaults/" +
+		url.PathEscape(subscription.VaultID) + "/subscriptions/" + url.PathEscape(subscription.ID)
+
+	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf("Created subscription %s in vault %s: %s",
+		subscription.ID, subscription.VaultID, subscriptionBytes))
+
+	rw.Header().Set("Location", newSubscriptionLocation)
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusCreated)
+
+	_, err = rw.Write(subscriptionBytes)
+	if err != nil {
+		logger.Errorf(messages.CreateSubscriptionSuccess+messages.FailWriteResponse, subscription.VaultID, err)
+	}
+}
+
+func writeReadSubscriptionsSuccess(logger logging.Logger, rw http.ResponseWriter,
+	subscriptions []models.Subscription, vaultID string) {
+	subscriptionsBytes, err := json.Marshal(subscriptions)
+	if err != nil {
+		writeErrorWithVaultID(logger, rw, http.StatusInternalServerError, messages.ReadSubscriptionsFailure, err,
+			vaultID)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	_, err = rw.Write(subscriptionsBytes)
+	if err != nil {
+		logger.Errorf(messages.ReadSubscriptionsSuccess+messages.FailWriteResponse, vaultID, err)
+	}
+}
+
+func writeDeleteSubscriptionFailure(logger logging.Logger, rw http.ResponseWriter, errDeleteSubscription error,
+	subscriptionID, vaultID string) {
+	logger.Infof(messages.DeleteSubscriptionFailure, subscriptionID, vaultID, errDeleteSubscription)
+
+	statusCode := configurationErrorStatus(errDeleteSubscription)
+	if errors.Is(errDeleteSubscription, messages.ErrSubscriptionNotFound) {
+		statusCode = http.StatusNotFound
+	}
+
+	rw.WriteHeader(statusCode)
+
+	_, errWrite := rw.Write([]byte(fmt.Sprintf(messages.DeleteSubscriptionFailure, subscriptionID, vaultID,
+		errDeleteSubscription)))
+	if errWrite != nil {
+		logger.Errorf(messages.DeleteSubscriptionFailure+messages.FailWriteResponse, subscriptionID, vaultID,
+			errDeleteSubscription, errWrite)
+	}
+}
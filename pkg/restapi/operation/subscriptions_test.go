@@ -0,0 +1,165 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperledger/aries-framework-go/component/storageutil/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/edvprovider"
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestSubscriptions(t *testing.T) {
+	t.Run("Endpoints are only registered if the extension is enabled", func(t *testing.T) {
+		op := New(&Config{Provider: edvprovider.NewProvider(mem.NewProvider(), 100)})
+
+		for _, handler := range op.GetRESTHandlers() {
+			require.NotEqual(t, subscriptionsEndpoint, handler.Path())
+			require.NotEqual(t, subscriptionEndpoint, handler.Path())
+		}
+	})
+	t.Run("Success: subscriptions change the webhooks in the vault's configuration", func(t *testing.T) {
+		op, vaultID := createOperationWithNotifier(t, &mockNotifier{})
+
+		rr := doUpdateConfigurationCall(t, op, vaultID,
+			`{"webhooks":{"endpoints":["https://example.com/configured"],"secret":"secret"}}`)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rr = doSubscriptionCall(t, op, http.MethodPost, subscriptionsEndpoint, vaultID, "",
+			`{"url":"https://example.com/webhook"}`)
+		require.Equal(t, http.StatusCreated, rr.Code)
+		require.Equal(t, "true", rr.Header().Get(deprecationHeader))
+		require.Equal(t, `</encrypted-data-vaults/`+vaultID+`/configuration>; rel="successor-version"`,
+			rr.Header().Get(linkHeader))
+
+		var subscription models.Subscription
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &subscription))
+		require.Equal(t, vaultID, subscription.VaultID)
+		require.Equal(t, "https://example.com/webhook", subscription.URL)
+		require.NotEmpty(t, subscription.ID)
+		require.Equal(t, "/encrypted-data-vaults/"+vaultID+"/subscriptions/"+subscription.ID,
+			rr.Header().Get("Location"))
+
+		// Subscribing the same URL again doesn't add it twice, and the secret is kept.
+		rr = doSubscriptionCall(t, op, http.MethodPost, subscriptionsEndpoint, vaultID, "",
+			`{"url":"https://example.com/webhook"}`)
+		require.Equal(t, http.StatusCreated, rr.Code)
+
+		webhooks, err := op.vaultCollection.provider.VaultWebhooks(vaultID)
+		require.NoError(t, err)
+		require.Equal(t, &models.VaultWebhooks{
+			Endpoints: []string{"https://example.com/configured", "https://example.com/webhook"}, Secret: "secret",
+		}, webhooks)
+
+		rr = doSubscriptionCall(t, op, http.MethodGet, subscriptionsEndpoint, vaultID, "", "")
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "true", rr.Header().Get(deprecationHeader))
+
+		var subscriptions []models.Subscription
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &subscriptions))
+		require.Equal(t, []models.Subscription{
+			*newSubscription(vaultID, "https://example.com/configured"), subscription,
+		}, subscriptions)
+
+		rr = doSubscriptionCall(t, op, http.MethodDelete, subscriptionEndpoint, vaultID, subscription.ID, "")
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		webhooks, err = op.vaultCollection.provider.VaultWebhooks(vaultID)
+		require.NoError(t, err)
+		require.Equal(t, []string{"https://example.com/configured"}, webhooks.Endpoints)
+
+		rr = doSubscriptionCall(t, op, http.MethodDelete, subscriptionEndpoint, vaultID, subscriptions[0].ID, "")
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rr = doSubscriptionCall(t, op, http.MethodGet, subscriptionsEndpoint, vaultID, "", "")
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "[]", rr.Body.String())
+	})
+	t.Run("Failure: vault does not exist", func(t *testing.T) {
+		op, _ := createOperationWithNotifier(t, &mockNotifier{})
+
+		rr := doSubscriptionCall(t, op, http.MethodPost, subscriptionsEndpoint, testVaultID, "",
+			`{"url":"https://example.com/webhook"}`)
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.CreateSubscriptionFailure, testVaultID, messages.ErrVaultNotFound),
+			rr.Body.String())
+
+		rr = doSubscriptionCall(t, op, http.MethodGet, subscriptionsEndpoint, testVaultID, "", "")
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.ReadSubscriptionsFailure, testVaultID, messages.ErrVaultNotFound),
+			rr.Body.String())
+
+		rr = doSubscriptionCall(t, op, http.MethodDelete, subscriptionEndpoint, testVaultID, "SubscriptionID", "")
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.DeleteSubscriptionFailure, "SubscriptionID", testVaultID,
+			messages.ErrVaultNotFound), rr.Body.String())
+	})
+	t.Run("Failure: invalid subscription", func(t *testing.T) {
+		op, vaultID := createOperationWithNotifier(t, &mockNotifier{})
+
+		rr := doSubscriptionCall(t, op, http.MethodPost, subscriptionsEndpoint, vaultID, "", "Incorrect format")
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), "Received invalid subscription")
+
+		rr = doSubscriptionCall(t, op, http.MethodPost, subscriptionsEndpoint, vaultID, "", `{"url":"/webhook"}`)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), messages.ErrInvalidWebhookURL.Error())
+	})
+	t.Run("Failure: subscription not found", func(t *testing.T) {
+		op, vaultID := createOperationWithNotifier(t, &mockNotifier{})
+
+		rr := doSubscriptionCall(t, op, http.MethodDelete, subscriptionEndpoint, vaultID, "SubscriptionID", "")
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.DeleteSubscriptionFailure, "SubscriptionID", vaultID,
+			messages.ErrSubscriptionNotFound), rr.Body.String())
+	})
+	t.Run("Failure: unable to escape path variables", func(t *testing.T) {
+		op, vaultID := createOperationWithNotifier(t, &mockNotifier{})
+
+		for _, endpoint := range []struct{ path, method string }{
+			{subscriptionsEndpoint, http.MethodPost},
+			{subscriptionsEndpoint, http.MethodGet},
+			{subscriptionEndpoint, http.MethodDelete},
+		} {
+			rr := doSubscriptionCall(t, op, endpoint.method, endpoint.path, "%", "SubscriptionID", "")
+			require.Equal(t, http.StatusBadRequest, rr.Code)
+		}
+
+		rr := doSubscriptionCall(t, op, http.MethodDelete, subscriptionEndpoint, vaultID, "%", "")
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func doSubscriptionCall(t *testing.T, op *Operation, method, endpoint, vaultID, subscriptionID,
+	requestBody string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, err := http.NewRequest(method, "", bytes.NewBuffer([]byte(requestBody)))
+	require.NoError(t, err)
+
+	req = mux.SetURLVars(req, map[string]string{
+		vaultIDPathVariable: vaultID, subscriptionIDPathVariable: subscriptionID,
+	})
+
+	rr := httptest.NewRecorder()
+
+	getHandler(t, op, endpoint, method).Handle().ServeHTTP(rr, req)
+
+	return rr
+}
@@ -7,18 +7,27 @@ SPDX-License-Identifier: Apache-2.0
 package operation
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
 
 	"github.com/trustbloc/edge-core/pkg/log"
 
+	"github.com/trustbloc/edv/pkg/logging"
 	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
 )
 
+// redactedSecret replaces the secret that a vault's webhook events are signed with wherever it would be logged or
+// sent back in a response. Anyone who knows the secret can forge events.
+const redactedSecret = "REDACTED"
+
 // Unescapes the given path variable from the vars map and writes a response if any failure occurs.
 // Returns the unescaped version of the path variable and a bool indicating whether the unescaping was successful.
-func unescapePathVar(pathVar string, vars map[string]string, rw http.ResponseWriter) (string, bool) {
+func unescapePathVar(logger logging.Logger, pathVar string, vars map[string]string, rw http.ResponseWriter) (string,
+	bool) {
 	unescapedPathVar, errUnescape := url.PathUnescape(vars[pathVar])
 	if errUnescape != nil {
 		logger.Errorf(messages.UnescapeFailure, pathVar, errUnescape)
@@ -53,3 +62,84 @@ func getFullDocumentURL(documentID, vaultID, host string) string {
 func debugLogLevelEnabled() bool {
 	return log.GetLevel(logModuleName) >= log.DEBUG
 }
+
+// redactWebhookSecret returns the given JSON object with the secret of its webhooks redacted, so that request bodies
+// can be logged and echoed back in error responses. If the object has a secret but can't be parsed, then all of it is
+// redacted.
+func redactWebhookSecret(data []byte) []byte {
+	if !bytes.Contains(data, []byte("secret")) {
+		return data
+	}
+
+	var object map[string]json.RawMessage
+
+	err := json.Unmarshal(data, &object)
+	if err != nil {
+		return []byte(redactedSecret)
+	}
+
+	webhooks, ok := object["webhooks"]
+	if !ok {
+		return data
+	}
+
+	object["webhooks"] = redactSecretMember(webhooks)
+
+	redacted, err := json.Marshal(object)
+	if err != nil {
+		return []byte(redactedSecret)
+	}
+
+	return redacted
+}
+
+// redactSecretMember returns the given JSON object with its secret member redacted.
+func redactSecretMember(data json.RawMessage) json.RawMessage {
+	var object map[string]json.RawMessage
+
+	err := json.Unmarshal(data, &object)
+	if err != nil {
+		return json.RawMessage(`"` + redactedSecret + `"`)
+	}
+
+	if _, ok := object["secret"]; !ok {
+		return data
+	}
+
+	object["secret"] = json.RawMessage(`"` + redactedSecret + `"`)
+
+	redacted, err := json.Marshal(object)
+	if err != nil {
+		return json.RawMessage(`"` + redactedSecret + `"`)
+	}
+
+	return redacted
+}
+
+// configurationForResponse returns a copy of the given configuration without webhook secrets. Webhooks aren't part of
+// the configuration, but clients can still send them as an extension when they create the vault.
+func configurationForResponse(config *models.DataVaultConfiguration) models.DataVaultConfiguration {
+	response := *config
+
+	if webhooks, ok := config.Extensions["webhooks"]; ok {
+		response.Extensions = make(models.Extensions, len(config.Extensions))
+
+		for name, value := range config.Extensions {
+			response.Extensions[name] = value
+		}
+
+		response.Extensions["webhooks"] = redactSecretMember(webhooks)
+	}
+
+	return response
+}
+
+// webhooksStatus describes the given webhooks in responses, without their secret. Webhooks without endpoints are
+// removed, so they're described as nil.
+func webhooksStatus(webhooks *models.VaultWebhooks) *models.VaultWebhooksStatus {
+	if webhooks == nil || len(webhooks.Endpoints) == 0 {
+		return nil
+	}
+
+	return &models.VaultWebhooksStatus{Endpoints: webhooks.Endpoints, SecretSet: webhooks.Secret != ""}
+}
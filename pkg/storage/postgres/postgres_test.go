@@ -0,0 +1,540 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hyperledger/aries-framework-go/spi/storage"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testStoreName = "TestStore"
+	testTable     = `"edv_teststore"`
+)
+
+func TestNewProvider(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		newTestProvider(t)
+	})
+	t.Run("Fail to connect", func(t *testing.T) {
+		db, mock := newMockDB(t)
+
+		mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+		_, err := newProvider(db)
+		require.EqualError(t, err, "failed to connect to PostgreSQL: connection refused")
+	})
+	t.Run("Fail to create store configurations table", func(t *testing.T) {
+		db, mock := newMockDB(t)
+
+		mock.ExpectPing()
+		mock.ExpectExec(`CREATE TABLE IF NOT EXISTS "store_configurations"`).
+			WillReturnError(errors.New("permission denied"))
+
+		_, err := newProvider(db)
+		require.EqualError(t, err, "failed to create store configurations table: permission denied")
+	})
+	t.Run("Invalid connection string", func(t *testing.T) {
+		_, err := NewProvider("postgres://localhost:notAPort")
+		require.Error(t, err)
+	})
+}
+
+func TestProvider_OpenStore(t *testing.T) {
+	t.Run("Creates the table and its tag index once", func(t *testing.T) {
+		provider, mock := newTestProvider(t)
+
+		expectOpenStore(mock)
+
+		store, err := provider.OpenStore(testStoreName)
+		require.NoError(t, err)
+
+		sameStore, err := provider.OpenStore(strings.ToLower(testStoreName))
+		require.NoError(t, err)
+		require.Equal(t, store, sameStore)
+		require.Len(t, provider.GetOpenStores(), 1)
+
+		require.NoError(t, store.Close())
+		require.Empty(t, provider.GetOpenStores())
+	})
+	t.Run("Empty name", func(t *testing.T) {
+		provider, _ := newTestProvider(t)
+
+		_, err := provider.OpenStore("")
+		require.EqualError(t, err, "store name cannot be empty")
+	})
+	t.Run("Name too long", func(t *testing.T) {
+		provider, _ := newTestProvider(t)
+
+		_, err := provider.OpenStore(strings.Repeat("a", 60))
+		require.Contains(t, err.Error(), "is longer than the 63 characters PostgreSQL allows")
+	})
+	t.Run("Fail to create table", func(t *testing.T) {
+		provider, mock := newTestProvider(t)
+
+		mock.ExpectExec(`CREATE TABLE IF NOT EXISTS ` + testTable).WillReturnError(errors.New("disk full"))
+
+		_, err := provider.OpenStore(testStoreName)
+		require.EqualError(t, err, "failed to create table for store TestStore: disk full")
+	})
+}
+
+func TestProvider_StoreConfig(t *testing.T) {
+	t.Run("Set and get", func(t *testing.T) {
+		provider, mock := newTestProvider(t)
+
+		expectOpenStore(mock)
+
+		_, err := provider.OpenStore(testStoreName)
+		require.NoError(t, err)
+
+		mock.ExpectExec(`INSERT INTO "edv_store_configurations"`).
+			WithArgs("edv_teststore", `{"tagNames":["TagName1"]}`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err = provider.SetStoreConfig(testStoreName, storage.StoreConfiguration{TagNames: []string{"TagName1"}})
+		require.NoError(t, err)
+
+		mock.ExpectQuery(`SELECT to_regclass`).WithArgs(testTable).
+			WillReturnRows(sqlmock.NewRows([]string{"to_regclass"}).AddRow("edv_teststore"))
+		mock.ExpectQuery(`SELECT config FROM "edv_store_configurations"`).WithArgs("edv_teststore").
+			WillReturnRows(sqlmock.NewRows([]string{"config"}).AddRow([]byte(`{"tagNames":["TagName1"]}`)))
+
+		config, err := provider.GetStoreConfig(testStoreName)
+		require.NoError(t, err)
+		require.Equal(t, []string{"TagName1"}, config.TagNames)
+	})
+	t.Run("Set on a store that isn't open", func(t *testing.T) {
+		provider, _ := newTestProvider(t)
+
+		err := provider.SetStoreConfig(testStoreName, storage.StoreConfiguration{})
+		require.ErrorIs(t, err, storage.ErrStoreNotFound)
+	})
+	t.Run("Set with an invalid tag name", func(t *testing.T) {
+		provider, _ := newTestProvider(t)
+
+		err := provider.SetStoreConfig(testStoreName, storage.StoreConfiguration{TagNames: []string{"a:b"}})
+		require.EqualError(t, err, "a:b is an invalid tag name since it contains one or more ':' characters")
+	})
+	t.Run("Get for a store that doesn't exist", func(t *testing.T) {
+		provider, mock := newTestProvider(t)
+
+		mock.ExpectQuery(`SELECT to_regclass`).WithArgs(testTable).
+			WillReturnRows(sqlmock.NewRows([]string{"to_regclass"}).AddRow(nil))
+
+		_, err := provider.GetStoreConfig(testStoreName)
+		require.ErrorIs(t, err, storage.ErrStoreNotFound)
+	})
+	t.Run("Get for a store that has never been configured", func(t *testing.T) {
+		provider, mock := newTestProvider(t)
+
+		mock.ExpectQuery(`SELECT to_regclass`).WithArgs(testTable).
+			WillReturnRows(sqlmock.NewRows([]string{"to_regclass"}).AddRow("edv_teststore"))
+		mock.ExpectQuery(`SELECT config FROM "edv_store_configurations"`).WithArgs("edv_teststore").
+			WillReturnError(sql.ErrNoRows)
+
+		config, err := provider.GetStoreConfig(testStoreName)
+		require.NoError(t, err)
+		require.Empty(t, config.TagNames)
+	})
+}
+
+func TestProvider_DeleteStore(t *testing.T) {
+	provider, mock := newTestProvider(t)
+
+	expectOpenStore(mock)
+
+	_, err := provider.OpenStore(testStoreName)
+	require.NoError(t, err)
+
+	mock.ExpectExec(`DROP TABLE IF EXISTS ` + testTable).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM "edv_store_configurations"`).WithArgs("edv_teststore").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, provider.DeleteStore(testStoreName))
+	require.Empty(t, provider.GetOpenStores())
+}
+
+func TestStore_PutAndGet(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store, mock := newTestStore(t)
+
+		mock.ExpectExec(`INSERT INTO ` + testTable + ` (key, value, tags)`).
+			WithArgs("key", []byte("value"), []byte(`[{"name":"TagName1","value":"TagValue1"}]`)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		require.NoError(t, store.Put("key", []byte("value"), storage.Tag{Name: "TagName1", Value: "TagValue1"}))
+
+		mock.ExpectQuery(`SELECT value FROM ` + testTable).WithArgs("key").
+			WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow([]byte("value")))
+
+		value, err := store.Get("key")
+		require.NoError(t, err)
+		require.Equal(t, []byte("value"), value)
+
+		mock.ExpectQuery(`SELECT tags FROM ` + testTable).WithArgs("key").
+			WillReturnRows(sqlmock.NewRows([]string{"tags"}).
+				AddRow([]byte(`[{"name":"TagName1","value":"TagValue1"}]`)))
+
+		tags, err := store.GetTags("key")
+		require.NoError(t, err)
+		require.Equal(t, []storage.Tag{{Name: "TagName1", Value: "TagValue1"}}, tags)
+	})
+	t.Run("Put without tags stores an empty array", func(t *testing.T) {
+		store, mock := newTestStore(t)
+
+		mock.ExpectExec(`INSERT INTO ` + testTable).WithArgs("key", []byte("value"), []byte(`[]`)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		require.NoError(t, store.Put("key", []byte("value")))
+	})
+	t.Run("Invalid puts", func(t *testing.T) {
+		store, _ := newTestStore(t)
+
+		require.EqualError(t, store.Put("", []byte("value")), "key cannot be empty")
+		require.EqualError(t, store.Put("key", nil), "value cannot be nil")
+		require.EqualError(t, store.Put("key", []byte("value"), storage.Tag{Name: "a:b"}),
+			"a:b is an invalid tag name since it contains one or more ':' characters")
+		require.EqualError(t, store.Put("key", []byte("value"), storage.Tag{Name: "a", Value: "b:c"}),
+			"b:c is an invalid tag value since it contains one or more ':' characters")
+	})
+	t.Run("Get a key that doesn't exist", func(t *testing.T) {
+		store, mock := newTestStore(t)
+
+		mock.ExpectQuery(`SELECT value FROM ` + testTable).WithArgs("key").WillReturnError(sql.ErrNoRows)
+
+		_, err := store.Get("key")
+		require.ErrorIs(t, err, storage.ErrDataNotFound)
+
+		mock.ExpectQuery(`SELECT tags FROM ` + testTable).WithArgs("key").WillReturnError(sql.ErrNoRows)
+
+		_, err = store.GetTags("key")
+		require.ErrorIs(t, err, storage.ErrDataNotFound)
+	})
+}
+
+func TestStore_Exists(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store, mock := newTestStore(t)
+
+		mock.ExpectQuery(`SELECT EXISTS (SELECT 1 FROM ` + testTable).WithArgs("key").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+		exists, err := store.(*Store).Exists("key")
+		require.NoError(t, err)
+		require.True(t, exists)
+	})
+	t.Run("Empty key", func(t *testing.T) {
+		store, _ := newTestStore(t)
+
+		_, err := store.(*Store).Exists("")
+		require.EqualError(t, err, "key is mandatory")
+	})
+	t.Run("Query failure", func(t *testing.T) {
+		store, mock := newTestStore(t)
+
+		mock.ExpectQuery(`SELECT EXISTS`).WithArgs("key").WillReturnError(errors.New("connection reset"))
+
+		_, err := store.(*Store).Exists("key")
+		require.EqualError(t, err, "failed to determine whether key key exists: connection reset")
+	})
+}
+
+func TestStore_GetBulk(t *testing.T) {
+	t.Run("Values are returned in the order of the keys", func(t *testing.T) {
+		store, mock := newTestStore(t)
+
+		mock.ExpectQuery(`SELECT key, value FROM ` + testTable + ` WHERE key = ANY`).
+			WillReturnRows(sqlmock.NewRows([]string{"key", "value"}).
+				AddRow("key2", []byte("value2")).AddRow("key1", []byte("value1")))
+
+		values, err := store.GetBulk("key1", "missing", "key2")
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{[]byte("value1"), nil, []byte("value2")}, values)
+	})
+	t.Run("Invalid keys", func(t *testing.T) {
+		store, _ := newTestStore(t)
+
+		_, err := store.GetBulk()
+		require.EqualError(t, err, "keys slice must contain at least one key")
+
+		_, err = store.GetBulk("key", "")
+		require.EqualError(t, err, "key cannot be empty")
+	})
+}
+
+func TestStore_Query(t *testing.T) {
+	t.Run("Pages through the results", func(t *testing.T) {
+		store, mock := newTestStore(t)
+
+		itr, err := store.Query("TagName1:TagValue1", storage.WithPageSize(2))
+		require.NoError(t, err)
+
+		mock.ExpectQuery(`SELECT key, value, tags FROM ` + testTable +
+			` WHERE (tags @> $1::jsonb) ORDER BY key LIMIT $2 OFFSET $3`).
+			WithArgs(`[{"name":"TagName1","value":"TagValue1"}]`, 2, 0).
+			WillReturnRows(sqlmock.NewRows([]string{"key", "value", "tags"}).
+				AddRow("key1", []byte("value1"), []byte(`[]`)).AddRow("key2", []byte("value2"), []byte(`[]`)))
+		mock.ExpectQuery(`SELECT key, value, tags FROM ` + testTable).
+			WithArgs(`[{"name":"TagName1","value":"TagValue1"}]`, 2, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"key", "value", "tags"}).
+				AddRow("key3", []byte("value3"), []byte(`[{"name":"TagName1","value":"TagValue1"}]`)))
+
+		var keys []string
+
+		more, err := itr.Next()
+		require.NoError(t, err)
+
+		for more {
+			key, errKey := itr.Key()
+			require.NoError(t, errKey)
+
+			keys = append(keys, key)
+
+			more, err = itr.Next()
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, []string{"key1", "key2", "key3"}, keys)
+
+		_, err = itr.Value()
+		require.EqualError(t, err, "iterator is exhausted or Next hasn't been called")
+		require.NoError(t, itr.Close())
+	})
+	t.Run("Combined expression with a sort order", func(t *testing.T) {
+		store, mock := newTestStore(t)
+
+		itr, err := store.Query("TagName1&&TagName2:TagValue2||TagName3", storage.WithSortOrder(
+			&storage.SortOptions{Order: storage.SortDescending, TagName: "TagName1"}))
+		require.NoError(t, err)
+
+		mock.ExpectQuery(`WHERE (tags @> $1::jsonb AND tags @> $2::jsonb) OR (tags @> $3::jsonb) ` +
+			`ORDER BY CASE WHEN`).
+			WithArgs(`[{"name":"TagName1"}]`, `[{"name":"TagName2","value":"TagValue2"}]`, `[{"name":"TagName3"}]`,
+				"TagName1", defaultPageSize, 0).
+			WillReturnRows(sqlmock.NewRows([]string{"key", "value", "tags"}).
+				AddRow("key1", []byte("value1"), []byte(`[{"name":"TagName1","value":"2"}]`)))
+
+		more, err := itr.Next()
+		require.NoError(t, err)
+		require.True(t, more)
+
+		tags, err := itr.Tags()
+		require.NoError(t, err)
+		require.Equal(t, []storage.Tag{{Name: "TagName1", Value: "2"}}, tags)
+
+		more, err = itr.Next()
+		require.NoError(t, err)
+		require.False(t, more)
+
+		mock.ExpectQuery(`SELECT count(*) FROM ` + testTable).
+			WithArgs(`[{"name":"TagName1"}]`, `[{"name":"TagName2","value":"TagValue2"}]`, `[{"name":"TagName3"}]`).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+		total, err := itr.TotalItems()
+		require.NoError(t, err)
+		require.Equal(t, 1, total)
+	})
+	t.Run("Invalid expressions", func(t *testing.T) {
+		store, _ := newTestStore(t)
+
+		for _, expression := range []string{"", "a:b:c", ":b", "a&&"} {
+			_, err := store.Query(expression)
+			require.Error(t, err, expression)
+		}
+	})
+}
+
+func TestStore_Batch(t *testing.T) {
+	t.Run("Operations are done in a transaction", func(t *testing.T) {
+		store, mock := newTestStore(t)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO ` + testTable).WithArgs("key1", []byte("value1"), []byte(`[]`)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`DELETE FROM ` + testTable).WithArgs("key2").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, store.Batch([]storage.Operation{
+			{Key: "key1", Value: []byte("value1")},
+			{Key: "key2"},
+		}))
+	})
+	t.Run("The transaction is rolled back if an operation fails", func(t *testing.T) {
+		store, mock := newTestStore(t)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`DELETE FROM ` + testTable).WithArgs("key1").WillReturnError(errors.New("deadlock"))
+		mock.ExpectRollback()
+
+		err := store.Batch([]storage.Operation{{Key: "key1"}})
+		require.EqualError(t, err, "failed to perform operation on key key1: deadlock")
+	})
+	t.Run("Puts of new keys are plain inserts", func(t *testing.T) {
+		store, mock := newTestStore(t)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO ` + testTable + ` (key, value, tags) VALUES ($1, $2, $3)`).
+			WithArgs("key1", []byte("value1"), []byte(`[]`)).
+			WillReturnError(&pq.Error{Code: "23505", Message: "duplicate key value violates unique constraint"})
+		mock.ExpectRollback()
+
+		err := store.Batch([]storage.Operation{
+			{Key: "key1", Value: []byte("value1"), PutOptions: &storage.PutOptions{IsNewKey: true}},
+		})
+		require.True(t, errors.Is(err, storage.ErrDuplicateKey))
+		require.EqualError(t, err, "failed to perform operation on key key1: "+
+			"duplicate key: duplicate key value violates unique constraint")
+	})
+	t.Run("Invalid operations", func(t *testing.T) {
+		store, _ := newTestStore(t)
+
+		require.EqualError(t, store.Batch(nil), "batch requires at least one operation")
+		require.EqualError(t, store.Batch([]storage.Operation{{Value: []byte("value")}}), "key cannot be empty")
+	})
+}
+
+func TestStore_BatchIf(t *testing.T) {
+	t.Run("Operations are done if the values match", func(t *testing.T) {
+		store, mock := newTestStore(t)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT value FROM ` + testTable + ` WHERE key = $1 FOR UPDATE`).WithArgs("key1").
+			WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow([]byte("value1")))
+		mock.ExpectExec(`ON CONFLICT (key) DO UPDATE`).WithArgs("key1", []byte("value2"), []byte(`[]`)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO ` + testTable + ` (key, value, tags) VALUES ($1, $2, $3)`).
+			WithArgs("key2", []byte("value2"), []byte(`[]`)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		written, err := store.(*Store).BatchIf(map[string][]byte{"key1": []byte("value1"), "key2": nil},
+			[]storage.Operation{
+				{Key: "key1", Value: []byte("value2")},
+				{Key: "key2", Value: []byte("value2")},
+			})
+		require.NoError(t, err)
+		require.True(t, written)
+	})
+	t.Run("Nothing is done if a value doesn't match", func(t *testing.T) {
+		store, mock := newTestStore(t)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT value FROM ` + testTable).WithArgs("key1").
+			WillReturnRows(sqlmock.NewRows([]string{"value"}).AddRow([]byte("value2")))
+		mock.ExpectRollback()
+
+		written, err := store.(*Store).BatchIf(map[string][]byte{"key1": []byte("value1")},
+			[]storage.Operation{{Key: "key1"}})
+		require.NoError(t, err)
+		require.False(t, written)
+	})
+	t.Run("Nothing is done if a key no longer exists", func(t *testing.T) {
+		store, mock := newTestStore(t)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT value FROM ` + testTable).WithArgs("key1").
+			WillReturnRows(sqlmock.NewRows([]string{"value"}))
+		mock.ExpectRollback()
+
+		written, err := store.(*Store).BatchIf(map[string][]byte{"key1": []byte("value1")},
+			[]storage.Operation{{Key: "key1"}})
+		require.NoError(t, err)
+		require.False(t, written)
+	})
+	t.Run("Nothing is done if a key that's expected not to exist was written to", func(t *testing.T) {
+		store, mock := newTestStore(t)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO ` + testTable + ` (key, value, tags) VALUES ($1, $2, $3)`).
+			WithArgs("key1", []byte("value1"), []byte(`[]`)).
+			WillReturnError(&pq.Error{Code: "23505", Message: "duplicate key value violates unique constraint"})
+		mock.ExpectRollback()
+
+		written, err := store.(*Store).BatchIf(map[string][]byte{"key1": nil},
+			[]storage.Operation{{Key: "key1", Value: []byte("value1")}})
+		require.NoError(t, err)
+		require.False(t, written)
+	})
+	t.Run("Fail to get a value", func(t *testing.T) {
+		store, mock := newTestStore(t)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT value FROM ` + testTable).WithArgs("key1").WillReturnError(errors.New("deadlock"))
+		mock.ExpectRollback().WillReturnError(errors.New("connection lost"))
+
+		_, err := store.(*Store).BatchIf(map[string][]byte{"key1": []byte("value1")},
+			[]storage.Operation{{Key: "key1"}})
+		require.EqualError(t, err, "failed to get value of key key1: deadlock "+
+			"(also failed to roll back transaction: connection lost)")
+	})
+	t.Run("Invalid operations", func(t *testing.T) {
+		store, _ := newTestStore(t)
+
+		_, err := store.(*Store).BatchIf(nil, nil)
+		require.EqualError(t, err, "batch requires at least one operation")
+	})
+}
+
+func newMockDB(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	t.Helper()
+
+	// Statements match if they contain the expected SQL.
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true),
+		sqlmock.QueryMatcherOption(sqlmock.QueryMatcherFunc(func(expectedSQL, actualSQL string) error {
+			if !strings.Contains(actualSQL, expectedSQL) {
+				return errors.New(actualSQL + " doesn't contain " + expectedSQL)
+			}
+
+			return nil
+		})))
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	return db, mock
+}
+
+func newTestProvider(t *testing.T) (*Provider, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock := newMockDB(t)
+
+	mock.ExpectPing()
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS "edv_store_configurations"`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	provider, err := newProvider(db, WithDBPrefix("edv_"))
+	require.NoError(t, err)
+
+	return provider, mock
+}
+
+func newTestStore(t *testing.T) (storage.Store, sqlmock.Sqlmock) {
+	t.Helper()
+
+	provider, mock := newTestProvider(t)
+
+	expectOpenStore(mock)
+
+	store, err := provider.OpenStore(testStoreName)
+	require.NoError(t, err)
+
+	return store, mock
+}
+
+func expectOpenStore(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS ` + testTable).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE INDEX IF NOT EXISTS "` + indexName("edv_teststore") + `" ON ` + testTable +
+		` USING GIN`).WillReturnResult(sqlmock.NewResult(0, 0))
+}
@@ -10,6 +10,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
@@ -18,9 +19,8 @@ import (
 	"github.com/cucumber/godog"
 
 	"github.com/trustbloc/edv/test/bdd/dockerutil"
-	"github.com/trustbloc/edv/test/bdd/pkg/common"
 	bddctx "github.com/trustbloc/edv/test/bdd/pkg/context"
-	"github.com/trustbloc/edv/test/bdd/pkg/edv"
+	"github.com/trustbloc/edv/test/bdd/pkg/harness"
 	"github.com/trustbloc/edv/test/bdd/pkg/interop"
 )
 
@@ -91,7 +91,7 @@ func runBDDTests(tags, format string) int { //nolint: gocognit
 	}, godog.Options{
 		Tags:          tags,
 		Format:        format,
-		Paths:         []string{"features"},
+		Paths:         []string{"features", filepath.Join("pkg", "harness", harness.FeaturesDir)},
 		Randomize:     time.Now().UTC().UnixNano(), // randomize scenario execution order
 		Strict:        true,
 		StopOnFailure: true,
@@ -133,7 +133,8 @@ func generateUUID() string {
 }
 
 func FeatureContext(s *godog.Suite) {
-	bddContext, err := bddctx.NewBDDContext("fixtures/keys/tls/ec-cacert.pem")
+	bddContext, err := bddctx.NewBDDContext("https://localhost:8076/encrypted-data-vaults",
+		"fixtures/keys/tls/ec-cacert.pem")
 	if err != nil {
 		panic(fmt.Sprintf("Failed to create a new NewBDDContext: %s", err))
 	}
@@ -143,7 +144,6 @@ func FeatureContext(s *godog.Suite) {
 		panic(fmt.Sprintf("Failed to create a new NewBDDInteropContext: %s", err))
 	}
 
-	edv.NewSteps(bddContext).RegisterSteps(s)
-	common.NewSteps(bddContext).RegisterSteps(s)
+	harness.RegisterSteps(s, bddContext)
 	interop.NewSteps(bddInteropContext).RegisterSteps(s)
 }
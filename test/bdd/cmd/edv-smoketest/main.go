@@ -0,0 +1,51 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// The edv-smoketest command runs the EDV BDD scenarios against an EDV server, for example:
+//
+//	go run ./cmd/edv-smoketest --url https://edv.example.com/encrypted-data-vaults --cacerts ca.pem
+//
+// It exits with a non-zero status if any of the scenarios fail.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/trustbloc/edv/test/bdd/pkg/harness"
+)
+
+func main() {
+	url := flag.String("url", "", "The URL of the vaults endpoint of the EDV server, "+
+		"for example https://edv.example.com/encrypted-data-vaults. Required.")
+	caCerts := flag.String("cacerts", "", "A comma-separated list of paths to the CA certs that the EDV server's "+
+		"TLS certificate is verified with. Defaults to the system's CA certs if not set.")
+	tags := flag.String("tags", harness.DefaultTags, `The tags of the scenarios to run, for example `+
+		`"all && ~@edv_batch" to leave out the batch scenarios if the EDV server doesn't have the Batch extension `+
+		`enabled.`)
+	format := flag.String("format", "pretty", "The output format, such as pretty or progress.")
+
+	flag.Parse()
+
+	var caCertPaths []string
+
+	for _, caCertPath := range strings.Split(*caCerts, ",") {
+		if caCertPath = strings.TrimSpace(caCertPath); caCertPath != "" {
+			caCertPaths = append(caCertPaths, caCertPath)
+		}
+	}
+
+	status, err := harness.Run(&harness.Options{URL: *url, CACertPaths: caCertPaths, Tags: *tags, Format: *format})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to run the EDV scenarios: %s\n", err)
+
+		os.Exit(1)
+	}
+
+	os.Exit(status)
+}
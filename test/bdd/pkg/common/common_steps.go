@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 
 	"github.com/cucumber/godog"
 	"github.com/tidwall/gjson"
@@ -33,6 +34,7 @@ func NewSteps(ctx *context.BDDContext) *Steps {
 // RegisterSteps registers agent steps.
 func (e *Steps) RegisterSteps(s *godog.Suite) {
 	s.Step(`^an HTTP GET is sent to "([^"]*)"$`, e.httpGet)
+	s.Step(`^an HTTP GET is sent to the EDV server's health check endpoint$`, e.httpGetHealthCheck)
 	s.Step(`^the JSON path "([^"]*)" of the response equals "([^"]*)"$`, e.jsonPathOfCCResponseEquals)
 }
 
@@ -73,6 +75,12 @@ func (e *Steps) httpGet(url string) error {
 	return nil
 }
 
+// httpGetHealthCheck sends a GET request to the health check endpoint of the EDV server, which is next to its vaults
+// endpoint.
+func (e *Steps) httpGetHealthCheck() error {
+	return e.httpGet(strings.TrimSuffix(e.bddContext.EDVURL, "/encrypted-data-vaults") + "/healthcheck")
+}
+
 func (e *Steps) jsonPathOfCCResponseEquals(path, expected string) error {
 	r := gjson.Get(e.queryValue, path)
 
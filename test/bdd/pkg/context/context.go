@@ -7,13 +7,9 @@ SPDX-License-Identifier: Apache-2.0
 package context
 
 import (
-	"bytes"
-	"compress/gzip"
 	"crypto/tls"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"net/http"
 
 	ariesmemstorage "github.com/hyperledger/aries-framework-go/component/storageutil/mem"
 	cryptoapi "github.com/hyperledger/aries-framework-go/pkg/crypto"
@@ -26,7 +22,6 @@ import (
 	"github.com/hyperledger/aries-framework-go/pkg/secretlock/noop"
 	"github.com/hyperledger/aries-framework-go/pkg/vdr/fingerprint"
 	ariesstorage "github.com/hyperledger/aries-framework-go/spi/storage"
-	"github.com/igor-pavlenko/httpsignatures-go"
 	tlsutils "github.com/trustbloc/edge-core/pkg/utils/tls"
 	"github.com/trustbloc/edge-core/pkg/zcapld"
 
@@ -83,6 +78,7 @@ const (
 
 	sampleUpdateEncryptedDoc = `{
     "id": "` + sampleDocID + `",
+    "sequence": 1,
     "indexed": [
         {
             "attributes": [
@@ -139,6 +135,9 @@ func (k kmsProvider) SecretLock() secretlock.Service {
 
 // BDDContext is a global context shared between different test suites in bddtests
 type BDDContext struct {
+	// EDVURL is the URL of the vaults endpoint of the EDV server under test, for example
+	// https://localhost:8076/encrypted-data-vaults.
+	EDVURL                     string
 	EDVClient                  *edvclient.Client
 	VaultID                    string
 	JWEDecrypter               *jose.JWEDecrypt
@@ -151,9 +150,10 @@ type BDDContext struct {
 	Crypto                     cryptoapi.Crypto
 }
 
-// NewBDDContext creates a new BDDContext
-func NewBDDContext(caCertPaths string) (*BDDContext, error) {
-	rootCAs, err := tlsutils.GetCertPool(false, []string{caCertPaths})
+// NewBDDContext creates a new BDDContext for the EDV server with the given vaults endpoint URL. The server's TLS
+// certificate is verified with the given CA certs, or with the system's if none are given.
+func NewBDDContext(edvURL string, caCertPaths ...string) (*BDDContext, error) {
+	rootCAs, err := tlsutils.GetCertPool(len(caCertPaths) == 0, caCertPaths)
 	if err != nil {
 		return nil, err
 	}
@@ -172,15 +172,11 @@ func NewBDDContext(caCertPaths string) (*BDDContext, error) {
 	}
 
 	instance := BDDContext{
+		EDVURL:    edvURL,
 		TLSConfig: &tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12}, KeyManager: keyManager, Crypto: crypto,
 	}
 
-	trustBlocEDVClient, err := createProxyEDVClient(&instance)
-	if err != nil {
-		return nil, err
-	}
-
-	instance.EDVClient = trustBlocEDVClient
+	instance.EDVClient = createProxyEDVClient(&instance)
 
 	return &instance, nil
 }
@@ -265,42 +261,9 @@ func NewBDDInteropContext() (*BDDInteropContext, error) {
 	return ctx, nil
 }
 
-func createProxyEDVClient(ctx *BDDContext) (*edvclient.Client, error) {
-	rootCAs, err := tlsutils.GetCertPool(false, []string{"fixtures/keys/tls/ec-cacert.pem"})
-	if err != nil {
-		return nil, err
-	}
-
-	return edvclient.New("https://"+trustBlocEDVHostURL, edvclient.WithTLSConfig(&tls.Config{
-		RootCAs:    rootCAs,
-		MinVersion: tls.VersionTLS12,
-	}), edvclient.WithHeaders(func(req *http.Request) (*http.Header, error) {
-		compressedZcap, err := compressZCAP(ctx.Capability)
-		if err != nil {
-			return nil, err
-		}
-
-		action := "write"
-		if req.Method == http.MethodGet {
-			action = "read"
-		}
-
-		req.Header.Set(zcapld.CapabilityInvocationHTTPHeader,
-			fmt.Sprintf(`zcap capability="%s",action="%s"`, compressedZcap, action))
-
-		hs := httpsignatures.NewHTTPSignatures(&zcapld.AriesDIDKeySecrets{})
-		hs.SetSignatureHashAlgorithm(&zcapld.AriesDIDKeySignatureHashAlgorithm{
-			Crypto: ctx.Crypto,
-			KMS:    ctx.KeyManager,
-		})
-
-		err = hs.Sign(ctx.Capability.Invoker, req)
-		if err != nil {
-			return nil, err
-		}
-
-		return &req.Header, nil
-	})), nil
+func createProxyEDVClient(ctx *BDDContext) *edvclient.Client {
+	return edvclient.New(ctx.EDVURL, edvclient.WithTLSConfig(ctx.TLSConfig),
+		edvclient.WithZCAP(ctx.Capability, ctx.Capability.Invoker, ctx.Crypto, ctx.KeyManager))
 }
 
 func createTrustBlocEDVClient(ctx *BDDInteropContext) (*edvclient.Client, error) {
@@ -312,54 +275,5 @@ func createTrustBlocEDVClient(ctx *BDDInteropContext) (*edvclient.Client, error)
 	return edvclient.New("https://"+trustBlocEDVHostURL, edvclient.WithTLSConfig(&tls.Config{
 		RootCAs:    rootCAs,
 		MinVersion: tls.VersionTLS12,
-	}), edvclient.WithHeaders(func(req *http.Request) (*http.Header, error) {
-		compressedZcap, err := compressZCAP(ctx.Capability)
-		if err != nil {
-			return nil, err
-		}
-
-		action := "write"
-		if req.Method == http.MethodGet {
-			action = "read"
-		}
-
-		req.Header.Set(zcapld.CapabilityInvocationHTTPHeader,
-			fmt.Sprintf(`zcap capability="%s",action="%s"`, compressedZcap, action))
-
-		hs := httpsignatures.NewHTTPSignatures(&zcapld.AriesDIDKeySecrets{})
-		hs.SetSignatureHashAlgorithm(&zcapld.AriesDIDKeySignatureHashAlgorithm{
-			Crypto: ctx.Crypto,
-			KMS:    ctx.KeyManager,
-		})
-
-		err = hs.Sign(ctx.VerificationMethod, req)
-		if err != nil {
-			return nil, err
-		}
-
-		return &req.Header, nil
-	})), nil
-}
-
-func compressZCAP(zcap *zcapld.Capability) (string, error) {
-	raw, err := json.Marshal(zcap)
-	if err != nil {
-		return "", err
-	}
-
-	compressed := bytes.NewBuffer(nil)
-
-	w := gzip.NewWriter(compressed)
-
-	_, err = w.Write(raw)
-	if err != nil {
-		return "", err
-	}
-
-	err = w.Close()
-	if err != nil {
-		return "", err
-	}
-
-	return base64.URLEncoding.EncodeToString(compressed.Bytes()), nil
+	}), edvclient.WithZCAP(ctx.Capability, ctx.VerificationMethod, ctx.Crypto, ctx.KeyManager)), nil
 }
@@ -60,6 +60,8 @@ const (
 // Steps is steps for EDV BDD tests
 type Steps struct {
 	bddContext *context.BDDContext
+	// batchDocuments are the documents stored by the last batch.
+	batchDocuments []models.EncryptedDocument
 }
 
 // NewSteps returns BDD test steps for EDV server
@@ -96,6 +98,16 @@ func (e *Steps) RegisterSteps(s *godog.Suite) {
 	s.Step(`^Client deletes the Encrypted Document with id "([^"]*)" from the vault$`, e.deleteDocument)
 	s.Step(`^Client stores the Encrypted Document again$`, e.storeDocumentInVault)
 	s.Step(`^Client stores (\d+) documents using (\d+) threads$`, e.clientStoresDocumentsInParallel)
+	s.Step(`^Client stores (\d+) documents in the data vault in a batch$`, e.storeDocumentsInBatch)
+	s.Step(`^Client reads each of the documents stored in the batch$`, e.readBatchDocuments)
+	s.Step(`^Client deletes the documents stored in the batch in another batch$`, e.deleteBatchDocuments)
+	s.Step(`^Client can no longer read any of the documents stored in the batch$`, e.batchDocumentsAreGone)
+	s.Step(`^Client is refused when it reads the Encrypted Document with id "([^"]*)" without a capability$`,
+		e.readDocumentWithoutCapability)
+	s.Step(`^Client is refused when it reads the Encrypted Document with id "([^"]*)" with the capability `+
+		`of another data vault$`, e.readDocumentWithOtherVaultCapability)
+	s.Step(`^Client deletes the data vault$`, e.deleteDataVault)
+	s.Step(`^Client can no longer read the Encrypted Document with id "([^"]*)"$`, e.documentIsGone)
 }
 
 func (e *Steps) createDataVault() error {
@@ -300,11 +312,10 @@ func (e *Steps) queryVault(queryIndexName, queryIndexValue string) error {
 			" document(s), but " + strconv.Itoa(numDocumentsFound) + " were found instead")
 	}
 
-	expectedDocURL := "edv/encrypted-data-vaults/" + e.bddContext.VaultID +
-		"/documents/VJYHHJx4C8J9Fsgz7rZqSp"
+	expectedDocPath := documentLocationPath(e.bddContext.VaultID, "VJYHHJx4C8J9Fsgz7rZqSp")
 
-	if docURLs[0] != expectedDocURL {
-		return common.UnexpectedValueError(expectedDocURL, docURLs[0])
+	if !strings.HasSuffix(docURLs[0], expectedDocPath) {
+		return common.UnexpectedValueError("a location ending with "+expectedDocPath, docURLs[0])
 	}
 
 	return nil
@@ -327,7 +338,15 @@ func (e *Steps) clientReconstructsAStructuredDocument(docID string) error {
 }
 
 func (e *Steps) updateDocumentInVault(docID string) error {
-	err := e.bddContext.EDVClient.UpdateDocument(e.bddContext.VaultID, docID, e.bddContext.EncryptedDocToStore)
+	currentDocument, err := e.bddContext.EDVClient.ReadDocument(e.bddContext.VaultID, docID)
+	if err != nil {
+		return err
+	}
+
+	// The EDV server only accepts an update whose sequence directly follows the stored document's sequence.
+	e.bddContext.EncryptedDocToStore.Sequence = currentDocument.Sequence + 1
+
+	err = e.bddContext.EDVClient.UpdateDocument(e.bddContext.VaultID, docID, e.bddContext.EncryptedDocToStore)
 
 	return err
 }
@@ -381,46 +400,176 @@ func (e *Steps) buildEncryptedDoc(jweEncrypter jose.Encrypter,
 
 // Currently hardcoded to use 100 documents and 10 threads (10 documents per thread).
 func (e *Steps) clientStoresDocumentsInParallel(_, _ int) error {
-	println("Creating key to encrypt documents with.")
-
-	_, ecPubKeyBytes, err := e.bddContext.KeyManager.CreateAndExportPubKeyBytes(kms.NISTP256ECDHKWType)
+	encryptedDocuments, err := e.encryptNewDocuments(numDocumentsForParallelTest)
 	if err != nil {
 		return err
 	}
 
-	ecPubKey := new(cryptoapi.PublicKey)
+	encryptedDocumentLocations := e.storeDocumentsInParallel(encryptedDocuments)
 
-	err = json.Unmarshal(ecPubKeyBytes, ecPubKey)
+	for i := 0; i < numDocumentsForParallelTest; i++ {
+		expectedDocumentPath := documentLocationPath(e.bddContext.VaultID, encryptedDocuments[i].ID)
+
+		if !strings.HasSuffix(encryptedDocumentLocations[i], expectedDocumentPath) {
+			return fmt.Errorf("document %d's location was expected to end with %s but got %s instead",
+				i, expectedDocumentPath, encryptedDocumentLocations[i])
+		}
+	}
+
+	return nil
+}
+
+func (e *Steps) storeDocumentsInBatch(numDocuments int) error {
+	encryptedDocuments, err := e.encryptNewDocuments(numDocuments)
 	if err != nil {
 		return err
 	}
 
-	jweEncrypter, err := jose.NewJWEEncrypt(jose.A256GCM, packer.ContentEncodingTypeV2, "", "", nil,
-		[]*cryptoapi.PublicKey{ecPubKey}, e.bddContext.Crypto)
+	batch := make(models.Batch, len(encryptedDocuments))
+
+	for i := range encryptedDocuments {
+		batch[i] = models.VaultOperation{
+			Operation:         models.UpsertDocumentVaultOperation,
+			EncryptedDocument: encryptedDocuments[i],
+		}
+	}
+
+	responses, err := e.bddContext.EDVClient.Batch(e.bddContext.VaultID, &batch)
 	if err != nil {
 		return err
 	}
 
-	encryptedDocuments, err := generateEncryptedDocuments(jweEncrypter)
+	if len(responses) != len(batch) {
+		return common.UnexpectedValueError(fmt.Sprintf("%d batch responses", len(batch)), fmt.Sprint(len(responses)))
+	}
+
+	for i, response := range responses {
+		expectedDocumentPath := documentLocationPath(e.bddContext.VaultID, encryptedDocuments[i].ID)
+
+		if !strings.HasSuffix(response, expectedDocumentPath) {
+			return common.UnexpectedValueError("a location ending with "+expectedDocumentPath, response)
+		}
+	}
+
+	e.batchDocuments = encryptedDocuments
+
+	return nil
+}
+
+func (e *Steps) readBatchDocuments() error {
+	for i := range e.batchDocuments {
+		retrievedDocument, err := e.bddContext.EDVClient.ReadDocument(e.bddContext.VaultID, e.batchDocuments[i].ID)
+		if err != nil {
+			return err
+		}
+
+		err = verifyEncryptedDocsAreEqual(retrievedDocument, &e.batchDocuments[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *Steps) deleteBatchDocuments() error {
+	batch := make(models.Batch, len(e.batchDocuments))
+
+	for i := range e.batchDocuments {
+		batch[i] = models.VaultOperation{
+			Operation:  models.DeleteDocumentVaultOperation,
+			DocumentID: e.batchDocuments[i].ID,
+		}
+	}
+
+	_, err := e.bddContext.EDVClient.Batch(e.bddContext.VaultID, &batch)
+
+	return err
+}
+
+func (e *Steps) batchDocumentsAreGone() error {
+	for i := range e.batchDocuments {
+		err := e.documentIsGone(e.batchDocuments[i].ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *Steps) readDocumentWithoutCapability(docID string) error {
+	_, err := e.bddContext.EDVClient.ReadDocument(e.bddContext.VaultID, docID,
+		client.WithRequestHeader(func(req *http.Request) (*http.Header, error) {
+			return nil, nil
+		}))
+
+	return expectRefused(err)
+}
+
+func (e *Steps) readDocumentWithOtherVaultCapability(docID string) error {
+	vaultID, capability := e.bddContext.VaultID, e.bddContext.Capability
+
+	err := e.createDataVault()
 	if err != nil {
-		return fmt.Errorf("failed to generate encrypted documents: %w", err)
+		return fmt.Errorf("failed to create another data vault: %w", err)
 	}
 
-	encryptedDocumentLocations := e.storeDocumentsInParallel(encryptedDocuments)
+	otherVaultCapability := e.bddContext.Capability
 
-	for i := 0; i < numDocumentsForParallelTest; i++ {
-		expectedDocumentLocation := fmt.Sprintf("edv/encrypted-data-vaults/%s/documents/%s",
-			e.bddContext.VaultID, encryptedDocuments[i].ID)
+	e.bddContext.VaultID, e.bddContext.Capability = vaultID, otherVaultCapability
 
-		if encryptedDocumentLocations[i] != expectedDocumentLocation {
-			return fmt.Errorf("document %d's location was expected to be %s but got %s instead",
-				i, expectedDocumentLocation, encryptedDocumentLocations[i])
+	defer func() {
+		e.bddContext.Capability = capability
+	}()
+
+	_, err = e.bddContext.EDVClient.ReadDocument(e.bddContext.VaultID, docID)
+
+	return expectRefused(err)
+}
+
+func (e *Steps) deleteDataVault() error {
+	return e.bddContext.EDVClient.DeleteDataVault(e.bddContext.VaultID)
+}
+
+// documentIsGone checks that the document can't be read. Depending on what was deleted, the EDV server responds
+// with a 404 or 410 status code, or refuses the request if the vault's capabilities were deleted along with it.
+func (e *Steps) documentIsGone(docID string) error {
+	_, err := e.bddContext.EDVClient.ReadDocument(e.bddContext.VaultID, docID)
+	if err == nil {
+		return fmt.Errorf("document %s can still be read", docID)
+	}
+
+	for _, statusCode := range []int{http.StatusNotFound, http.StatusGone, http.StatusUnauthorized,
+		http.StatusForbidden} {
+		if strings.Contains(err.Error(), fmt.Sprintf("status code %d", statusCode)) {
+			return nil
 		}
 	}
 
+	return fmt.Errorf("reading document %s failed for an unexpected reason: %w", docID, err)
+}
+
+// expectRefused checks that a request failed authorization.
+func expectRefused(err error) error {
+	if err == nil {
+		return errors.New("the request was allowed")
+	}
+
+	if !strings.Contains(err.Error(), fmt.Sprintf("status code %d", http.StatusUnauthorized)) &&
+		!strings.Contains(err.Error(), fmt.Sprintf("status code %d", http.StatusForbidden)) {
+		return fmt.Errorf("the request failed for a reason other than authorization: %w", err)
+	}
+
 	return nil
 }
 
+// documentLocationPath returns the path that the location of the given document ends with. Locations start with the
+// EDV server's host URL, which depends on how it's deployed.
+func documentLocationPath(vaultID, docID string) string {
+	return fmt.Sprintf("/encrypted-data-vaults/%s/documents/%s", vaultID, docID)
+}
+
 func (e *Steps) storeDocumentsInParallel(encryptedDocuments []models.EncryptedDocument) []string {
 	encryptedDocumentLocations := make([]string, numDocumentsForParallelTest)
 
@@ -651,12 +800,42 @@ func unableToAssertAsStringError(fieldName string) error {
 	return fmt.Errorf("unable to assert `" + fieldName + "` field value type as string")
 }
 
-func generateEncryptedDocuments(jweEncrypter *jose.JWEEncrypt) ([]models.EncryptedDocument, error) {
+// encryptNewDocuments encrypts the given number of Structured Documents with a new key.
+func (e *Steps) encryptNewDocuments(numDocuments int) ([]models.EncryptedDocument, error) {
+	println("Creating key to encrypt documents with.")
+
+	_, ecPubKeyBytes, err := e.bddContext.KeyManager.CreateAndExportPubKeyBytes(kms.NISTP256ECDHKWType)
+	if err != nil {
+		return nil, err
+	}
+
+	ecPubKey := new(cryptoapi.PublicKey)
+
+	err = json.Unmarshal(ecPubKeyBytes, ecPubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	jweEncrypter, err := jose.NewJWEEncrypt(jose.A256GCM, packer.ContentEncodingTypeV2, "", "", nil,
+		[]*cryptoapi.PublicKey{ecPubKey}, e.bddContext.Crypto)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedDocuments, err := generateEncryptedDocuments(jweEncrypter, numDocuments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate encrypted documents: %w", err)
+	}
+
+	return encryptedDocuments, nil
+}
+
+func generateEncryptedDocuments(jweEncrypter *jose.JWEEncrypt, numDocuments int) ([]models.EncryptedDocument, error) {
 	println("Generating encrypted documents.")
 
-	encryptedDocuments := make([]models.EncryptedDocument, numDocumentsForParallelTest)
+	encryptedDocuments := make([]models.EncryptedDocument, numDocuments)
 
-	for i := 0; i < numDocumentsForParallelTest; i++ {
+	for i := 0; i < numDocuments; i++ {
 		docID, err := edvutils.GenerateEDVCompatibleID()
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate an EDV document ID: %w", err)
@@ -0,0 +1,18 @@
+#
+# Copyright SecureKey Technologies Inc. All Rights Reserved.
+#
+# SPDX-License-Identifier: Apache-2.0
+#
+
+@all
+@edv_auth
+Feature: Authorizing requests to the EDV REST API
+
+  Scenario: Documents can only be read with a capability for their data vault. Requires the EDV server to have auth enabled.
+    Then Client sends request to create a new data vault and receives the vault location
+    Then Client constructs a Structured Document with id "VJYHHJx4C8J9Fsgz7rZqSp"
+    Then Client encrypts the Structured Document and uses it to construct an Encrypted Document
+    Then Client stores the Encrypted Document in the data vault
+    Then Client is refused when it reads the Encrypted Document with id "VJYHHJx4C8J9Fsgz7rZqSp" without a capability
+    Then Client is refused when it reads the Encrypted Document with id "VJYHHJx4C8J9Fsgz7rZqSp" with the capability of another data vault
+    Then Client sends request to retrieve the previously stored Encrypted Document with id "VJYHHJx4C8J9Fsgz7rZqSp" in the data vault and receives the previously stored Encrypted Document in response
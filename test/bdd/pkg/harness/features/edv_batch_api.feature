@@ -0,0 +1,16 @@
+#
+# Copyright SecureKey Technologies Inc. All Rights Reserved.
+#
+# SPDX-License-Identifier: Apache-2.0
+#
+
+@all
+@edv_batch
+Feature: Using the batch extension of the EDV REST API
+
+  Scenario: Storing and deleting documents in batches. Requires the EDV server to have the Batch extension enabled.
+    Then Client sends request to create a new data vault and receives the vault location
+    Then Client stores 10 documents in the data vault in a batch
+    Then Client reads each of the documents stored in the batch
+    Then Client deletes the documents stored in the batch in another batch
+    Then Client can no longer read any of the documents stored in the batch
@@ -0,0 +1,17 @@
+#
+# Copyright SecureKey Technologies Inc. All Rights Reserved.
+#
+# SPDX-License-Identifier: Apache-2.0
+#
+
+@all
+@edv_vault_lifecycle
+Feature: Managing data vaults with the EDV REST API
+
+  Scenario: Deleting a data vault deletes its documents.
+    Then Client sends request to create a new data vault and receives the vault location
+    Then Client constructs a Structured Document with id "VJYHHJx4C8J9Fsgz7rZqSp"
+    Then Client encrypts the Structured Document and uses it to construct an Encrypted Document
+    Then Client stores the Encrypted Document in the data vault
+    Then Client deletes the data vault
+    Then Client can no longer read the Encrypted Document with id "VJYHHJx4C8J9Fsgz7rZqSp"
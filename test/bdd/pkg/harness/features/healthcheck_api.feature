@@ -0,0 +1,13 @@
+#
+# Copyright SecureKey Technologies Inc. All Rights Reserved.
+#
+# SPDX-License-Identifier: Apache-2.0
+#
+
+@all
+@healthcheck
+Feature: health check
+
+  Scenario: The EDV server reports that it's healthy.
+    When an HTTP GET is sent to the EDV server's health check endpoint
+    Then the JSON path "status" of the response equals "success"
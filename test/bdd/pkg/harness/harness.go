@@ -0,0 +1,143 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package harness runs the EDV BDD scenarios (health check, vault lifecycle, documents, queries, batches and
+// authorization) against any EDV server, so that deployers can smoke-test their own installations. The scenarios are
+// embedded in the package, so it can be imported from other modules:
+//
+//	status, err := harness.Run(&harness.Options{URL: "https://edv.example.com/encrypted-data-vaults"})
+//
+// The EDV server must have auth enabled, since the scenarios use ZCAP-LD capabilities. The scenarios create vaults,
+// which are left behind, except for those that the vault lifecycle scenario deletes.
+package harness
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cucumber/godog"
+
+	"github.com/trustbloc/edv/test/bdd/pkg/common"
+	bddctx "github.com/trustbloc/edv/test/bdd/pkg/context"
+	"github.com/trustbloc/edv/test/bdd/pkg/edv"
+)
+
+// DefaultTags selects all of the scenarios.
+const DefaultTags = "all"
+
+// FeaturesDir is the directory that the feature files of the scenarios are in, relative to this package.
+const FeaturesDir = "features"
+
+//go:embed features/*.feature
+var features embed.FS
+
+// Options configures a run of the scenarios.
+type Options struct {
+	// URL is the URL of the vaults endpoint of the EDV server, for example
+	// https://edv.example.com/encrypted-data-vaults. The health check endpoint is expected next to it.
+	URL string
+	// CACertPaths are the paths to the CA certs that the EDV server's TLS certificate is verified with. If none are
+	// given, then the system's are used.
+	CACertPaths []string
+	// Tags is a godog tag expression that selects the scenarios to run, for example "all && ~@edv_batch" to leave
+	// out the batch scenarios if the EDV server doesn't have the Batch extension enabled. Defaults to DefaultTags.
+	Tags string
+	// Format is the godog output format, such as pretty or progress. Defaults to pretty.
+	Format string
+	// Output is where results are written. Defaults to standard output.
+	Output io.Writer
+}
+
+// Run runs the scenarios selected by opts against the EDV server at opts.URL. It returns the godog exit status,
+// which is 0 if all of the scenarios passed.
+func Run(opts *Options) (int, error) {
+	if opts.URL == "" {
+		return 0, errors.New("the URL of the EDV server must be given")
+	}
+
+	bddContext, err := bddctx.NewBDDContext(opts.URL, opts.CACertPaths...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create BDD context: %w", err)
+	}
+
+	featuresDir, err := ioutil.TempDir("", "edv-bdd-features")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create directory for feature files: %w", err)
+	}
+
+	defer func() {
+		if errRemove := os.RemoveAll(featuresDir); errRemove != nil {
+			fmt.Fprintf(os.Stderr, "Failed to remove %s: %s\n", featuresDir, errRemove)
+		}
+	}()
+
+	err = WriteFeatures(featuresDir)
+	if err != nil {
+		return 0, err
+	}
+
+	tags := opts.Tags
+	if tags == "" {
+		tags = DefaultTags
+	}
+
+	format := opts.Format
+	if format == "" {
+		format = "pretty"
+	}
+
+	var output io.Writer = os.Stdout
+	if opts.Output != nil {
+		output = opts.Output
+	}
+
+	return godog.RunWithOptions("edv", func(s *godog.Suite) {
+		RegisterSteps(s, bddContext)
+	}, godog.Options{
+		Tags:          tags,
+		Format:        format,
+		Paths:         []string{featuresDir},
+		Randomize:     time.Now().UTC().UnixNano(), // randomize scenario execution order
+		Strict:        true,
+		StopOnFailure: true,
+		Output:        output,
+	}), nil
+}
+
+// RegisterSteps registers the steps of the scenarios, which run against the EDV server of the given context.
+func RegisterSteps(s *godog.Suite, bddContext *bddctx.BDDContext) {
+	edv.NewSteps(bddContext).RegisterSteps(s)
+	common.NewSteps(bddContext).RegisterSteps(s)
+}
+
+// WriteFeatures writes the feature files of the scenarios to the given directory.
+func WriteFeatures(dir string) error {
+	featureFiles, err := fs.Glob(features, FeaturesDir+"/*.feature")
+	if err != nil {
+		return fmt.Errorf("failed to list feature files: %w", err)
+	}
+
+	for _, featureFile := range featureFiles {
+		featureBytes, err := features.ReadFile(featureFile)
+		if err != nil {
+			return fmt.Errorf("failed to read feature file %s: %w", featureFile, err)
+		}
+
+		err = ioutil.WriteFile(filepath.Join(dir, filepath.Base(featureFile)), featureBytes, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to write feature file %s: %w", featureFile, err)
+		}
+	}
+
+	return nil
+}